@@ -0,0 +1,175 @@
+package redis
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOverloaded is returned by transports configured with an AdaptiveLimiter
+// when a request is shed because the limit of in-flight requests is reached.
+var ErrOverloaded = errors.New("redis: request shed because too many requests are in flight")
+
+const (
+	// baselineDecay is the weight of new samples in the baseline latency of
+	// adaptive limiters, it is kept low so the baseline tracks the latency of a
+	// healthy server rather than short degradations.
+	baselineDecay = 0.05
+)
+
+// An AdaptiveLimiter limits the number of requests in flight, adjusting the
+// limit to the latency observed on responses.
+//
+// The limiter uses an additive-increase/multiplicative-decrease algorithm:
+// the limit grows slowly while the latency stays within Tolerance times the
+// baseline latency, and shrinks by Backoff when it exceeds it or when requests
+// fail. This way the load is shed early when the server degrades, instead of
+// queueing requests until they time out.
+//
+// The zero-value is a valid limiter using the default settings. Limiters are
+// safe to use concurrently from multiple goroutines.
+type AdaptiveLimiter struct {
+	// MinLimit is the lower bound of the limit. If zero, the limit is at
+	// least 1.
+	MinLimit int
+
+	// MaxLimit is the upper bound of the limit. If zero, the limit is at most
+	// 1000.
+	MaxLimit int
+
+	// InitialLimit is the limit used before any responses were observed. If
+	// zero, the initial limit is 10.
+	InitialLimit int
+
+	// Tolerance is the ratio between the latency of a response and the
+	// baseline latency above which the server is considered degraded. If
+	// zero, the tolerance is 2.
+	Tolerance float64
+
+	// Backoff is the factor applied to the limit when the server is degraded.
+	// If zero, the backoff is 0.9.
+	Backoff float64
+
+	mutex    sync.Mutex
+	init     bool
+	limit    float64
+	inflight int
+	baseline time.Duration
+}
+
+// Limit returns the current limit of in-flight requests.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.setup()
+	return int(l.limit)
+}
+
+// Inflight returns the number of requests currently in flight.
+func (l *AdaptiveLimiter) Inflight() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.inflight
+}
+
+// acquire reserves a slot for a request, returning a function which must be
+// called with the outcome of the request when it completes, or ErrOverloaded
+// if the limit is reached.
+func (l *AdaptiveLimiter) acquire() (func(error), error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.setup()
+
+	if l.inflight >= int(l.limit) {
+		return nil, ErrOverloaded
+	}
+
+	l.inflight++
+	start := time.Now()
+	once := sync.Once{}
+
+	return func(err error) {
+		once.Do(func() { l.observe(time.Since(start), err) })
+	}, nil
+}
+
+// observe releases a slot and adjusts the limit to the latency and error of a
+// completed request.
+func (l *AdaptiveLimiter) observe(rtt time.Duration, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.setup()
+
+	if l.inflight > 0 {
+		l.inflight--
+	}
+
+	switch ErrorClass(err) {
+	case ErrClassUnknown, ErrClassTimeout, ErrClassConnRefused, ErrClassLoading:
+		l.decrease()
+		return
+	}
+
+	if l.baseline == 0 {
+		l.baseline = rtt
+	}
+
+	if float64(rtt) > l.tolerance()*float64(l.baseline) {
+		l.decrease()
+	} else if l.limit += 1 / l.limit; l.limit > float64(l.maxLimit()) {
+		l.limit = float64(l.maxLimit())
+	}
+
+	l.baseline += time.Duration(baselineDecay * float64(rtt-l.baseline))
+}
+
+func (l *AdaptiveLimiter) decrease() {
+	if l.limit *= l.backoff(); l.limit < float64(l.minLimit()) {
+		l.limit = float64(l.minLimit())
+	}
+}
+
+func (l *AdaptiveLimiter) setup() {
+	if !l.init {
+		l.init = true
+		l.limit = float64(l.InitialLimit)
+
+		if l.limit <= 0 {
+			l.limit = 10
+		}
+		if min := float64(l.minLimit()); l.limit < min {
+			l.limit = min
+		}
+		if max := float64(l.maxLimit()); l.limit > max {
+			l.limit = max
+		}
+	}
+}
+
+func (l *AdaptiveLimiter) minLimit() int {
+	if l.MinLimit > 0 {
+		return l.MinLimit
+	}
+	return 1
+}
+
+func (l *AdaptiveLimiter) maxLimit() int {
+	if l.MaxLimit > 0 {
+		return l.MaxLimit
+	}
+	return 1000
+}
+
+func (l *AdaptiveLimiter) tolerance() float64 {
+	if l.Tolerance > 0 {
+		return l.Tolerance
+	}
+	return 2
+}
+
+func (l *AdaptiveLimiter) backoff() float64 {
+	if l.Backoff > 0 && l.Backoff < 1 {
+		return l.Backoff
+	}
+	return 0.9
+}
@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	l := &AdaptiveLimiter{InitialLimit: 2, MaxLimit: 4}
+
+	release1, err := l.acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release2, err := l.acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.acquire(); err != ErrOverloaded {
+		t.Fatal("bad error:", err)
+	}
+
+	release1(nil)
+	release2(nil)
+
+	for i := 0; i != 100; i++ {
+		l.acquire()
+		l.observe(time.Millisecond, nil)
+	}
+
+	if n := l.Limit(); n != 4 {
+		t.Error("the limit must grow up to the maximum while latency is stable:", n)
+	}
+
+	for i := 0; i != 10; i++ {
+		l.acquire()
+		l.observe(10*time.Millisecond, nil)
+	}
+
+	if n := l.Limit(); n >= 4 {
+		t.Error("the limit must shrink when latency degrades:", n)
+	}
+
+	for i := 0; i != 100; i++ {
+		l.acquire()
+		l.observe(time.Millisecond, errors.New("connection reset by peer"))
+	}
+
+	if n := l.Limit(); n != 1 {
+		t.Error("the limit must shrink down to the minimum when requests fail:", n)
+	}
+
+	if n := l.Inflight(); n != 0 {
+		t.Error("bad number of requests in flight:", n)
+	}
+}
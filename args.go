@@ -42,6 +42,54 @@ func List(args ...interface{}) Args {
 	}
 }
 
+// The AppendArgs interface may be implemented by argument lists which have a
+// specialized way of appending values to caller buffers. Programs should use
+// the NextAppend function instead of asserting to this interface.
+type AppendArgs interface {
+	Args
+
+	// NextAppend appends the next value of the argument list to dst, returning
+	// the extended buffer and whether a value was read.
+	NextAppend(dst []byte) ([]byte, bool)
+}
+
+// NextAppend appends the next value of args to dst, returning the extended
+// buffer and whether a value was read. Nil values append nothing.
+//
+// When dst has enough spare capacity the value is decoded in place, which
+// allows read loops to run without allocating by reusing the same buffer:
+//
+//	var buf []byte
+//	for {
+//		var ok bool
+//		if buf, ok = redis.NextAppend(args, buf[:0]); !ok {
+//			break
+//		}
+//		...
+//	}
+func NextAppend(args Args, dst []byte) ([]byte, bool) {
+	if a, ok := args.(AppendArgs); ok {
+		return a.NextAppend(dst)
+	}
+
+	// The decoder reuses the backing array of the destination slice, so
+	// decoding into the spare capacity of dst appends the value in place.
+	b := dst[len(dst):]
+	if b == nil {
+		b = []byte{}
+	}
+
+	if !args.Next(&b) {
+		return dst, false
+	}
+
+	if n := len(b); n != 0 && n <= cap(dst)-len(dst) && &dst[:len(dst)+1][len(dst)] == &b[0] {
+		return dst[:len(dst)+n], true
+	}
+
+	return append(dst, b...), true
+}
+
 // Int parses an integer value from the list of arguments and closes it,
 // returning an error if no integer could not be read.
 func Int(args Args) (i int, err error) {
@@ -63,6 +111,16 @@ func String(args Args) (s string, err error) {
 	return
 }
 
+// Bytes parses a binary string value from the list of arguments and closes it,
+// returning an error if no value could not be read.
+//
+// Unlike String, the returned value may be modified by the program, it is
+// never shared with the argument list.
+func Bytes(args Args) (b []byte, err error) {
+	err = ParseArgs(args, &b)
+	return
+}
+
 // ParseArgs reads a list of arguments into a sequence of destination pointers
 // and closes it, returning any error that occurred while parsing the values.
 func ParseArgs(args Args, dsts ...interface{}) error {
@@ -111,6 +169,17 @@ func (m *multiArgs) Len() (n int) {
 	return
 }
 
+func (m *multiArgs) NextType() Type {
+	if m.err == nil {
+		for _, a := range m.args {
+			if a.Len() != 0 {
+				return NextType(a)
+			}
+		}
+	}
+	return TypeUnknown
+}
+
 func (m *multiArgs) Next(dst interface{}) bool {
 	if len(m.args) == 0 || m.err != nil {
 		return false
@@ -156,12 +225,18 @@ func (tx *txArgs) Close() error {
 	tx.mutex.Lock()
 
 	for _, arg := range tx.args {
-		if err := arg.Close(); err != nil {
+		err := arg.Close()
+
+		// Closing an argument list of the transaction releases the lock, like
+		// when the program closes the lists returned by Next.
+		tx.mutex.Lock()
+
+		if err != nil {
 			if tx.err == nil {
 				tx.err = err
 			}
 
-			if _, stable := err.(*resp.Error); !stable {
+			if !isStableError(err) {
 				if tx.conn != nil {
 					tx.conn.Close()
 				}
@@ -171,6 +246,8 @@ func (tx *txArgs) Close() error {
 		}
 	}
 
+	tx.args = nil
+
 	if tx.conn != nil {
 		tx.conn.rmutex.Unlock()
 		tx.conn = nil
@@ -201,6 +278,32 @@ func (tx *txArgs) Next() Args {
 	return args
 }
 
+// singleTxArgs is a TxArgs producing a single argument list.
+type singleTxArgs struct {
+	args Args
+}
+
+func (tx *singleTxArgs) Close() (err error) {
+	if tx.args != nil {
+		err = tx.args.Close()
+		tx.args = nil
+	}
+	return
+}
+
+func (tx *singleTxArgs) Len() int {
+	if tx.args == nil {
+		return 0
+	}
+	return 1
+}
+
+func (tx *singleTxArgs) Next() Args {
+	args := tx.args
+	tx.args = nil
+	return args
+}
+
 type argsError struct {
 	err error
 }
@@ -212,6 +315,7 @@ func newArgsError(err error) *argsError {
 func (args *argsError) Close() error              { return args.err }
 func (args *argsError) Len() int                  { return 0 }
 func (args *argsError) Next(val interface{}) bool { return false }
+func (args *argsError) NextType() Type            { return TypeUnknown }
 
 type txArgsError struct {
 	err error
@@ -265,6 +369,17 @@ func (args *argsList) Len() int {
 	return args.dec.Len()
 }
 
+func (args *argsList) NextType() Type {
+	if args.err != nil || args.dec.Len() == 0 {
+		return TypeUnknown
+	}
+	t, err := args.dec.Parser.ParseType()
+	if err != nil {
+		return TypeUnknown
+	}
+	return makeType(t)
+}
+
 func (args *argsList) Next(val interface{}) bool {
 	if args.err != nil {
 		return false
@@ -294,13 +409,22 @@ func (args *byteArgs) Len() int {
 	return len(args.args)
 }
 
+func (args *byteArgs) NextType() Type {
+	if len(args.args) == 0 || args.err != nil {
+		return TypeUnknown
+	}
+	return TypeBulk
+}
+
 func (args *byteArgs) Next(dst interface{}) (ok bool) {
 	if len(args.args) == 0 || args.err != nil {
 		return false
 	}
 	a := args.args[0]
 	args.args = args.args[1:]
-	args.err = args.next(reflect.ValueOf(dst), a)
+	if v := reflect.ValueOf(dst); v.IsValid() {
+		args.err = args.next(v.Elem(), a)
+	}
 	return args.err == nil
 }
 
@@ -1,7 +1,9 @@
 package redis_test
 
 import (
+	"context"
 	"reflect"
+	"strconv"
 	"testing"
 
 	redis "github.com/segmentio/redis-go"
@@ -84,3 +86,112 @@ func testArgsReadValues(t *testing.T, makeArgs makeArgsFunc) {
 		t.Logf("found:    %#v", values)
 	}
 }
+
+func TestBinarySafety(t *testing.T) {
+	values := []string{
+		"",
+		"\x00",
+		"Hello\x00World!",
+		"\r\n",
+		"+OK\r\n",
+		"\xff\xfe\xfd",
+		string([]byte{0xc3, 0x28, 0x00, 0xa0, 0xa1}),
+	}
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.WriteStream(len(req.Cmds))
+
+		for _, cmd := range req.Cmds {
+			var b []byte
+			cmd.ParseArgs(&b)
+			res.Write(b)
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	ctx := context.Background()
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	for _, value := range values {
+		t.Run(strconv.Quote(value), func(t *testing.T) {
+			if b, err := redis.Bytes(cli.Query(ctx, "ECHO", []byte(value))); err != nil {
+				t.Error(err)
+			} else if string(b) != value {
+				t.Errorf("bad bytes: %q", b)
+			}
+
+			if s, err := redis.String(cli.Query(ctx, "ECHO", value)); err != nil {
+				t.Error(err)
+			} else if s != value {
+				t.Errorf("bad string: %q", s)
+			}
+
+			// Transactions are loaded in memory by the server, values must
+			// survive being buffered as byte slices.
+			tx := cli.MultiQuery(ctx,
+				redis.Command{Cmd: "ECHO", Args: redis.List(value)},
+				redis.Command{Cmd: "ECHO", Args: redis.List([]byte(value))},
+			)
+
+			for tx.Len() != 0 {
+				var s string
+				args := tx.Next()
+				args.Next(&s)
+
+				if err := args.Close(); err != nil {
+					t.Error(err)
+				} else if s != value {
+					t.Errorf("bad string in transaction: %q", s)
+				}
+			}
+
+			if err := tx.Close(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestNextAppend(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write([][]byte{[]byte("Hello"), []byte("World"), nil, []byte("!")})
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+	args := cli.Query(context.Background(), "LRANGE", "key", 0, -1)
+
+	buf := make([]byte, 0, 64)
+	out := buf
+
+	for {
+		var ok bool
+		if out, ok = redis.NextAppend(args, out); !ok {
+			break
+		}
+	}
+
+	if err := args.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != "HelloWorld!" {
+		t.Errorf("bad buffer: %q", out)
+	}
+
+	if &out[0] != &buf[:1][0] {
+		t.Error("values must be appended in place when the buffer has enough capacity")
+	}
+
+	// Buffers without enough capacity are grown.
+	b, ok := redis.NextAppend(redis.List("world"), []byte("hello "))
+	if !ok || string(b) != "hello world" {
+		t.Errorf("bad buffer: %q", b)
+	}
+}
@@ -0,0 +1,271 @@
+package redis
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BacklogPolicy represents the behavior of pub/sub buffers when a subscriber
+// falls behind and its backlog of messages is full.
+type BacklogPolicy int
+
+const (
+	// BacklogDisconnect disconnects the subscriber, like redis does with
+	// clients exceeding their pubsub output buffer limit.
+	BacklogDisconnect BacklogPolicy = iota
+
+	// BacklogBlock makes the publisher wait for the subscriber to catch up.
+	BacklogBlock
+
+	// BacklogDropOldest discards the oldest message of the backlog to make
+	// room for the new one.
+	BacklogDropOldest
+
+	// BacklogDropNewest discards the new message.
+	BacklogDropNewest
+)
+
+// String returns a human-readable representation of p.
+func (p BacklogPolicy) String() string {
+	switch p {
+	case BacklogDisconnect:
+		return "disconnect"
+	case BacklogBlock:
+		return "block"
+	case BacklogDropOldest:
+		return "drop-oldest"
+	case BacklogDropNewest:
+		return "drop-newest"
+	default:
+		return "unknown"
+	}
+}
+
+// BacklogStats carries counters of the messages buffered for subscribers.
+type BacklogStats struct {
+	// Delivered is the number of messages added to a backlog.
+	Delivered int64
+
+	// Blocked is the number of messages that waited for room in a backlog.
+	Blocked int64
+
+	// Dropped is the number of messages discarded from or not added to a
+	// full backlog.
+	Dropped int64
+
+	// Disconnected is the number of subscribers disconnected because their
+	// backlog was full.
+	Disconnected int64
+}
+
+type backlogStats struct {
+	delivered    int64
+	blocked      int64
+	dropped      int64
+	disconnected int64
+}
+
+func (s *backlogStats) load() BacklogStats {
+	return BacklogStats{
+		Delivered:    atomic.LoadInt64(&s.delivered),
+		Blocked:      atomic.LoadInt64(&s.blocked),
+		Dropped:      atomic.LoadInt64(&s.dropped),
+		Disconnected: atomic.LoadInt64(&s.disconnected),
+	}
+}
+
+// backlog is a bounded queue of values waiting to be sent to a subscriber.
+// Messages are subject to the policy of the backlog when it's full, other
+// values, like the replies to commands, always disconnect the subscriber
+// since they can't be dropped.
+type backlog struct {
+	size       int
+	policy     BacklogPolicy
+	timeout    time.Duration // maximum time blocked by BacklogBlock, zero means no limit
+	stats      *backlogStats
+	disconnect func()
+
+	mutex  sync.Mutex
+	items  []backlogItem
+	closed bool
+	ready  chan struct{}
+	space  chan struct{}
+	done   chan struct{}
+}
+
+type backlogItem struct {
+	value   interface{}
+	message bool
+}
+
+func newBacklog(size int, policy BacklogPolicy, timeout time.Duration, stats *backlogStats, disconnect func()) *backlog {
+	return &backlog{
+		size:       size,
+		policy:     policy,
+		timeout:    timeout,
+		stats:      stats,
+		disconnect: disconnect,
+		ready:      make(chan struct{}, 1),
+		space:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// push adds v to the backlog, returning false if v was not added, either
+// because it was dropped or because the subscriber was disconnected.
+func (b *backlog) push(v interface{}, message bool) bool {
+	var timer *time.Timer
+	var expired <-chan time.Time
+	var blocked bool
+
+	for {
+		b.mutex.Lock()
+
+		if b.closed {
+			b.mutex.Unlock()
+			return false
+		}
+
+		if len(b.items) < b.size {
+			b.append(v, message)
+
+			// Other publishers may be blocked, the signal is passed on while
+			// there is room in the backlog.
+			if blocked && len(b.items) < b.size {
+				b.signal(b.space)
+			}
+
+			b.mutex.Unlock()
+			return true
+		}
+
+		policy := b.policy
+		if !message {
+			policy = BacklogDisconnect
+		}
+
+		switch policy {
+		case BacklogDropNewest:
+			b.mutex.Unlock()
+			atomic.AddInt64(&b.stats.dropped, 1)
+			return false
+
+		case BacklogDropOldest:
+			if i := b.oldestMessage(); i >= 0 {
+				b.items = append(b.items[:i], b.items[i+1:]...)
+				b.append(v, message)
+				b.mutex.Unlock()
+				atomic.AddInt64(&b.stats.dropped, 1)
+				return true
+			}
+			// The backlog only contains replies which can't be dropped.
+			b.mutex.Unlock()
+
+		case BacklogBlock:
+			b.mutex.Unlock()
+
+			if !blocked {
+				blocked = true
+				atomic.AddInt64(&b.stats.blocked, 1)
+
+				if b.timeout > 0 {
+					timer = time.NewTimer(b.timeout)
+					defer timer.Stop()
+					expired = timer.C
+				}
+			}
+
+			select {
+			case <-b.space:
+				continue
+			case <-b.done:
+				return false
+			case <-expired:
+			}
+
+		default:
+			b.mutex.Unlock()
+		}
+
+		// Closing the backlog ensures that the subscriber is only counted once
+		// when multiple publishers race to disconnect it.
+		if b.close() {
+			atomic.AddInt64(&b.stats.disconnected, 1)
+			b.disconnect()
+		}
+		return false
+	}
+}
+
+func (b *backlog) append(v interface{}, message bool) {
+	b.items = append(b.items, backlogItem{value: v, message: message})
+
+	if message {
+		atomic.AddInt64(&b.stats.delivered, 1)
+	}
+
+	b.signal(b.ready)
+}
+
+func (b *backlog) oldestMessage() int {
+	for i, item := range b.items {
+		if item.message {
+			return i
+		}
+	}
+	return -1
+}
+
+// pop removes the first value of the backlog, waiting for one to be pushed if
+// it's empty. The method returns false when the backlog is closed and all its
+// values were consumed.
+func (b *backlog) pop() (interface{}, bool) {
+	for {
+		b.mutex.Lock()
+
+		if len(b.items) != 0 {
+			v := b.items[0].value
+			b.items[0] = backlogItem{}
+			b.items = b.items[1:]
+			b.mutex.Unlock()
+			b.signal(b.space)
+			return v, true
+		}
+
+		closed := b.closed
+		b.mutex.Unlock()
+
+		if closed {
+			return nil, false
+		}
+
+		select {
+		case <-b.ready:
+		case <-b.done:
+		}
+	}
+}
+
+func (b *backlog) signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// close prevents values from being pushed to the backlog, the values that it
+// contains can still be consumed. The method returns false if the backlog was
+// already closed.
+func (b *backlog) close() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return false
+	}
+
+	b.closed = true
+	close(b.done)
+	return true
+}
@@ -0,0 +1,395 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A ReadBalancer is a RoundTripper which splits reads and writes between a
+// primary and its replicas: requests made only of read-only commands are sent
+// to a replica, all other requests, including transactions, are sent to the
+// primary.
+//
+//	client := &redis.Client{
+//		Transport: &redis.ReadBalancer{
+//			Transport: &redis.Transport{ReadOnly: true},
+//			Primary:   "10.0.0.1:6379",
+//			Replicas: redis.ServerList{
+//				{Addr: "10.0.0.2:6379"},
+//				{Addr: "10.0.0.3:6379"},
+//			},
+//		},
+//	}
+//
+// Unless a Policy is set, reads are routed to the replica with the lowest
+// latency. The balancer maintains an exponentially weighted moving average of
+// the response time of each replica. Replicas that returned an error are
+// avoided for FailureTimeout, and a fraction of the requests are sent to a
+// random replica so the estimates of slow or recovered replicas are kept up
+// to date. When Zone is set, replicas of the same zone are always preferred,
+// requests are only sent to other zones when all replicas of the local zone
+// are failing.
+//
+// Replicas of a redis cluster only serve reads on connections which sent the
+// READONLY command, which the transport used for replicas sends when its
+// ReadOnly field is set.
+//
+// Replicas are updated asynchronously, programs which need to read their own
+// writes must send those reads to the primary, for example with a separate
+// client.
+type ReadBalancer struct {
+	// Transport is used to send requests to the primary. If nil,
+	// DefaultTransport is used.
+	Transport RoundTripper
+
+	// ReplicaTransport is used to send requests to the replicas. If nil,
+	// Transport is used.
+	ReplicaTransport RoundTripper
+
+	// Primary is the address of the primary server. If empty, writes are
+	// sent to the address set on the request.
+	Primary string
+
+	// Replicas exposes the list of endpoints that read-only requests can be
+	// routed to. If nil, or if it returns no endpoints, all requests are sent
+	// to the primary.
+	Replicas ServerRegistry
+
+	// Policy, if not nil, selects the replica that read-only requests are
+	// sent to instead of the latency of the replicas, RoundRobinReplicas
+	// distributes them evenly for example. The latency of the replicas is
+	// still measured.
+	Policy ReplicaPolicy
+
+	// Exploration is the fraction of read-only requests sent to a random
+	// replica. If zero, DefaultExploration is used, set to a negative value
+	// to disable exploration.
+	Exploration float64
+
+	// FailureTimeout is the amount of time during which a replica is avoided
+	// after returning an error. If zero, DefaultFailureTimeout is used.
+	FailureTimeout time.Duration
+
+	// Zone is the zone that the program runs in, matched against the Zone
+	// field of replica endpoints.
+	Zone string
+
+	mutex     sync.Mutex
+	stats     BalancerStats
+	latencies map[string]*latency
+	random    *rand.Rand
+}
+
+// A ReplicaPolicy selects the replicas that a ReadBalancer routes read-only
+// requests to.
+type ReplicaPolicy interface {
+	// SelectReplica returns the address of the replica that req is sent to,
+	// or an empty string to send it to the primary. The list of replicas is
+	// never empty.
+	SelectReplica(req *Request, replicas []ServerEndpoint) string
+}
+
+// ReplicaPolicyFunc is an adapter to allow the use of ordinary functions as
+// replica policies.
+type ReplicaPolicyFunc func(*Request, []ServerEndpoint) string
+
+// SelectReplica satisfies the ReplicaPolicy interface, it calls f.
+func (f ReplicaPolicyFunc) SelectReplica(req *Request, replicas []ServerEndpoint) string {
+	return f(req, replicas)
+}
+
+// RoundRobinReplicas is a ReplicaPolicy which distributes requests across the
+// replicas in turn. The zero value is ready to use.
+type RoundRobinReplicas struct {
+	next uint64
+}
+
+// SelectReplica satisfies the ReplicaPolicy interface.
+func (p *RoundRobinReplicas) SelectReplica(req *Request, replicas []ServerEndpoint) string {
+	i := atomic.AddUint64(&p.next, 1) - 1
+	return replicas[i%uint64(len(replicas))].Addr
+}
+
+const (
+	// DefaultExploration is the default value of ReadBalancer.Exploration.
+	DefaultExploration = 0.05
+
+	// DefaultFailureTimeout is the default value of
+	// ReadBalancer.FailureTimeout.
+	DefaultFailureTimeout = 5 * time.Second
+
+	// latencyDecay is the weight of new samples in latency estimates.
+	latencyDecay = 0.2
+)
+
+// BalancerStats carries counters of the requests routed by a ReadBalancer.
+type BalancerStats struct {
+	// Reads is the number of read-only requests routed to replicas.
+	Reads int64
+
+	// CrossZoneReads is the number of read-only requests routed to replicas
+	// of a zone different from the balancer's Zone.
+	CrossZoneReads int64
+
+	// Writes is the number of requests routed to the primary.
+	Writes int64
+}
+
+type latency struct {
+	estimate time.Duration
+	samples  int
+	failedAt time.Time
+}
+
+// RoundTrip satisfies the RoundTripper interface.
+func (b *ReadBalancer) RoundTrip(req *Request) (*Response, error) {
+	if replica, ok := b.replica(req); ok {
+		start := time.Now()
+		res, err := b.send(b.replicaTransport(), req, replica.Addr)
+		b.observe(replica.Addr, time.Since(start), err)
+		return res, err
+	}
+
+	b.mutex.Lock()
+	b.stats.Writes++
+	b.mutex.Unlock()
+
+	if len(b.Primary) == 0 {
+		return b.transport().RoundTrip(req)
+	}
+
+	return b.send(b.transport(), req, b.Primary)
+}
+
+// CloseIdleConnections closes the idle connections of the underlying
+// transports, if they support it.
+func (b *ReadBalancer) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if c, ok := b.transport().(closeIdler); ok {
+		c.CloseIdleConnections()
+	}
+	if b.ReplicaTransport != nil {
+		if c, ok := b.ReplicaTransport.(closeIdler); ok {
+			c.CloseIdleConnections()
+		}
+	}
+}
+
+// replica returns the replica that req must be sent to, or false if it must be
+// sent to the primary.
+func (b *ReadBalancer) replica(req *Request) (ServerEndpoint, bool) {
+	if b.Replicas == nil || req.IsTransaction() || classOfRequest(req) != ClassRead {
+		return ServerEndpoint{}, false
+	}
+
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	replicas, err := b.Replicas.LookupServers(ctx)
+	if err != nil || len(replicas) == 0 {
+		return ServerEndpoint{}, false
+	}
+
+	if b.Policy == nil {
+		return b.pick(replicas, time.Now()), true
+	}
+
+	addr := b.Policy.SelectReplica(req, replicas)
+	if len(addr) == 0 {
+		return ServerEndpoint{}, false
+	}
+
+	endpoint := ServerEndpoint{Addr: addr}
+
+	for _, replica := range replicas {
+		if replica.Addr == addr {
+			endpoint = replica
+			break
+		}
+	}
+
+	b.mutex.Lock()
+	b.countRead(endpoint)
+	b.mutex.Unlock()
+	return endpoint, true
+}
+
+func (b *ReadBalancer) send(transport RoundTripper, req *Request, addr string) (*Response, error) {
+	r := *req
+	r.Addr = addr
+
+	res, err := transport.RoundTrip(&r)
+	if res != nil {
+		res.Request = req
+	}
+	return res, err
+}
+
+// Stats returns the counters of requests routed by the balancer.
+func (b *ReadBalancer) Stats() BalancerStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.stats
+}
+
+// Latency returns the current latency estimate of the replica at addr, and
+// false if the balancer has not observed any request to it.
+func (b *ReadBalancer) Latency(addr string) (time.Duration, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if l := b.latencies[addr]; l != nil && l.samples != 0 {
+		return l.estimate, true
+	}
+
+	return 0, false
+}
+
+func (b *ReadBalancer) pick(replicas []ServerEndpoint, now time.Time) (endpoint ServerEndpoint) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	defer func() { b.countRead(endpoint) }()
+
+	if b.random == nil {
+		b.random = rand.New(rand.NewSource(now.UnixNano()))
+	}
+
+	if b.random.Float64() < b.exploration() {
+		// Explore within the local zone when it has replicas, there is no
+		// point paying for cross-zone traffic to refresh estimates of replicas
+		// that would only be used as a fallback.
+		local := make([]ServerEndpoint, 0, len(replicas))
+
+		for _, replica := range replicas {
+			if !b.isCrossZone(replica) {
+				local = append(local, replica)
+			}
+		}
+
+		if len(local) != 0 {
+			replicas = local
+		}
+
+		return replicas[b.random.Intn(len(replicas))]
+	}
+
+	var best replicaRank
+
+	for i, replica := range replicas {
+		rank := replicaRank{
+			index:     i,
+			failed:    true,
+			crossZone: b.isCrossZone(replica),
+		}
+
+		if l := b.latencies[replica.Addr]; l != nil {
+			rank.latency = l.estimate
+			rank.failed = !l.failedAt.IsZero() && now.Sub(l.failedAt) < b.failureTimeout()
+		} else {
+			rank.failed = false
+		}
+
+		if i == 0 || rank.less(best) {
+			best = rank
+		}
+	}
+
+	return replicas[best.index]
+}
+
+// countRead counts a read sent to endpoint, the mutex must be held when calling
+// the method.
+func (b *ReadBalancer) countRead(endpoint ServerEndpoint) {
+	b.stats.Reads++
+	if b.isCrossZone(endpoint) {
+		b.stats.CrossZoneReads++
+	}
+}
+
+func (b *ReadBalancer) isCrossZone(endpoint ServerEndpoint) bool {
+	return len(b.Zone) != 0 && endpoint.Zone != b.Zone
+}
+
+// replicaRank is used to order replicas by preference: healthy replicas first,
+// then replicas of the local zone, then replicas with the lowest latency.
+type replicaRank struct {
+	index     int
+	failed    bool
+	crossZone bool
+	latency   time.Duration
+}
+
+func (r replicaRank) less(other replicaRank) bool {
+	if r.failed != other.failed {
+		return !r.failed
+	}
+	if r.crossZone != other.crossZone {
+		return !r.crossZone
+	}
+	return r.latency < other.latency
+}
+
+func (b *ReadBalancer) observe(addr string, rtt time.Duration, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.latencies == nil {
+		b.latencies = make(map[string]*latency)
+	}
+
+	l := b.latencies[addr]
+	if l == nil {
+		l = &latency{}
+		b.latencies[addr] = l
+	}
+
+	if err != nil {
+		l.failedAt = time.Now()
+		return
+	}
+
+	if l.samples == 0 {
+		l.estimate = rtt
+	} else {
+		l.estimate += time.Duration(latencyDecay * float64(rtt-l.estimate))
+	}
+
+	l.samples++
+	l.failedAt = time.Time{}
+}
+
+func (b *ReadBalancer) transport() RoundTripper {
+	if b.Transport != nil {
+		return b.Transport
+	}
+	return DefaultTransport
+}
+
+func (b *ReadBalancer) replicaTransport() RoundTripper {
+	if b.ReplicaTransport != nil {
+		return b.ReplicaTransport
+	}
+	return b.transport()
+}
+
+func (b *ReadBalancer) exploration() float64 {
+	if b.Exploration == 0 {
+		return DefaultExploration
+	}
+	return b.Exploration
+}
+
+func (b *ReadBalancer) failureTimeout() time.Duration {
+	if b.FailureTimeout == 0 {
+		return DefaultFailureTimeout
+	}
+	return b.FailureTimeout
+}
@@ -0,0 +1,309 @@
+package redis_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestReadBalancer(t *testing.T) {
+	var slowCount, fastCount, primaryCount int32
+
+	newCountingServer := func(count *int32, delay time.Duration) (*redis.Server, string) {
+		return newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			atomic.AddInt32(count, 1)
+			time.Sleep(delay)
+			res.Write("OK")
+		}))
+	}
+
+	slow, slowURL := newCountingServer(&slowCount, 20*time.Millisecond)
+	defer slow.Close()
+
+	fast, fastURL := newCountingServer(&fastCount, 0)
+	defer fast.Close()
+
+	primary, primaryURL := newCountingServer(&primaryCount, 0)
+	defer primary.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	balancer := &redis.ReadBalancer{
+		Transport:   tr,
+		Replicas:    redis.ServerList{{Addr: slowURL}, {Addr: fastURL}},
+		Exploration: -1,
+	}
+
+	cli := &redis.Client{Addr: primaryURL, Transport: balancer}
+	ctx := context.Background()
+
+	for i := 0; i != 10; i++ {
+		if err := cli.Exec(ctx, "GET", "key"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cli.Exec(ctx, "SET", "key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&slowCount); n != 1 {
+		t.Error("bad number of requests sent to the slow replica:", n)
+	}
+
+	if n := atomic.LoadInt32(&fastCount); n != 9 {
+		t.Error("bad number of requests sent to the fast replica:", n)
+	}
+
+	if n := atomic.LoadInt32(&primaryCount); n != 1 {
+		t.Error("bad number of requests sent to the primary:", n)
+	}
+
+	if d, ok := balancer.Latency(slowURL); !ok || d < 20*time.Millisecond {
+		t.Error("bad latency estimate of the slow replica:", d)
+	}
+
+	// Once the fast replica fails, reads must fall back to the slow one.
+	fast.Close()
+	tr.CloseIdleConnections()
+	cli.Exec(ctx, "GET", "key")
+
+	if err := cli.Exec(ctx, "GET", "key"); err != nil {
+		t.Error(err)
+	}
+
+	if n := atomic.LoadInt32(&slowCount); n != 2 {
+		t.Error("bad number of requests sent to the slow replica after a failure:", n)
+	}
+}
+
+func TestReadBalancerZone(t *testing.T) {
+	var localCount, remoteCount int32
+
+	local, localURL := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		atomic.AddInt32(&localCount, 1)
+		time.Sleep(10 * time.Millisecond)
+		res.Write("OK")
+	}))
+	defer local.Close()
+
+	remote, remoteURL := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		atomic.AddInt32(&remoteCount, 1)
+		res.Write("OK")
+	}))
+	defer remote.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	balancer := &redis.ReadBalancer{
+		Transport: tr,
+		Replicas: redis.ServerList{
+			{Addr: remoteURL, Zone: "us-west-2b"},
+			{Addr: localURL, Zone: "us-west-2a"},
+		},
+		Zone:        "us-west-2a",
+		Exploration: -1,
+	}
+
+	cli := &redis.Client{Transport: balancer}
+	ctx := context.Background()
+
+	for i := 0; i != 5; i++ {
+		if err := cli.Exec(ctx, "GET", "key"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&localCount); n != 5 {
+		t.Error("bad number of requests sent to the local replica:", n)
+	}
+
+	// When the local replica fails, reads fall back to the other zone.
+	local.Close()
+	tr.CloseIdleConnections()
+	cli.Exec(ctx, "GET", "key")
+
+	if err := cli.Exec(ctx, "GET", "key"); err != nil {
+		t.Error(err)
+	}
+
+	if n := atomic.LoadInt32(&remoteCount); n != 1 {
+		t.Error("bad number of requests sent to the remote replica:", n)
+	}
+
+	if stats := balancer.Stats(); stats.Reads != 7 || stats.CrossZoneReads != 1 {
+		t.Errorf("bad stats: %+v", stats)
+	}
+}
+
+func TestReadBalancerPrimary(t *testing.T) {
+	var mutex sync.Mutex
+	var received = map[string][]string{}
+
+	newCountingServer := func(name string) string {
+		return newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+			if cmd == "CLIENT" {
+				return ""
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			received[name] = append(received[name], cmd)
+			return "+OK\r\n"
+		})
+	}
+
+	primary := newCountingServer("primary")
+	replica1 := newCountingServer("replica1")
+	replica2 := newCountingServer("replica2")
+
+	reset := func() map[string][]string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		r := received
+		received = map[string][]string{}
+		return r
+	}
+
+	tr := &redis.Transport{ReadOnly: true}
+	defer tr.CloseIdleConnections()
+
+	replicas := redis.ServerList{{Addr: replica1}, {Addr: replica2}}
+	ctx := context.Background()
+
+	tests := []struct {
+		scenario string
+		function func(*testing.T)
+	}{
+		{
+			scenario: "reads are distributed across replicas and writes sent to the primary",
+			function: func(t *testing.T) {
+				rt := &redis.ReadBalancer{Transport: tr, Replicas: replicas, Policy: &redis.RoundRobinReplicas{}}
+				cli := &redis.Client{Addr: primary, Transport: rt}
+
+				for i := 0; i != 4; i++ {
+					if err := cli.Exec(ctx, "GET", "key"); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				if err := cli.Exec(ctx, "SET", "key", "value"); err != nil {
+					t.Fatal(err)
+				}
+
+				r := reset()
+
+				if n := countCommands(r["replica1"], "GET"); n != 2 {
+					t.Error("bad number of reads sent to the first replica:", n)
+				}
+				if n := countCommands(r["replica2"], "GET"); n != 2 {
+					t.Error("bad number of reads sent to the second replica:", n)
+				}
+				if n := countCommands(r["primary"], "SET"); n != 1 {
+					t.Error("bad number of writes sent to the primary:", n)
+				}
+				if n := countCommands(r["primary"], "GET"); n != 0 {
+					t.Error("reads were sent to the primary:", n)
+				}
+				if n := countCommands(r["replica1"], "READONLY"); n != 1 {
+					t.Error("READONLY was not sent on the connection to the replica:", n)
+				}
+
+				if stats := rt.Stats(); stats.Reads != 4 || stats.Writes != 1 || stats.CrossZoneReads != 0 {
+					t.Errorf("bad stats: %+v", stats)
+				}
+			},
+		},
+		{
+			scenario: "transactions are sent to the primary",
+			function: func(t *testing.T) {
+				var addr string
+
+				rt := &redis.ReadBalancer{
+					Transport: roundTripperFunc(func(req *redis.Request) (*redis.Response, error) {
+						addr = req.Addr
+						req.Close()
+						return nil, io.EOF
+					}),
+					Replicas: replicas,
+				}
+
+				rt.RoundTrip(&redis.Request{
+					Addr: primary,
+					Cmds: []redis.Command{
+						{Cmd: "MULTI"},
+						{Cmd: "GET", Args: redis.List("key")},
+						{Cmd: "EXEC"},
+					},
+				})
+
+				if addr != primary {
+					t.Error("the transaction was not sent to the primary:", addr)
+				}
+			},
+		},
+		{
+			scenario: "the policy may send reads to the primary",
+			function: func(t *testing.T) {
+				rt := &redis.ReadBalancer{
+					Transport: tr,
+					Primary:   primary,
+					Replicas:  replicas,
+					Policy: redis.ReplicaPolicyFunc(func(req *redis.Request, replicas []redis.ServerEndpoint) string {
+						if req.Cmds[0].Cmd == "GET" {
+							return ""
+						}
+						return replicas[1].Addr
+					}),
+				}
+				cli := &redis.Client{Addr: "localhost:1", Transport: rt}
+
+				if err := cli.Exec(ctx, "GET", "key"); err != nil {
+					t.Fatal(err)
+				}
+				if err := cli.Exec(ctx, "EXISTS", "key"); err != nil {
+					t.Fatal(err)
+				}
+
+				r := reset()
+
+				if n := countCommands(r["primary"], "GET"); n != 1 {
+					t.Error("the read was not sent to the primary:", r)
+				}
+				if n := countCommands(r["replica2"], "EXISTS"); n != 1 {
+					t.Error("the read was not sent to the selected replica:", r)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			reset()
+			testFunc(t)
+		})
+	}
+}
+
+func countCommands(cmds []string, cmd string) int {
+	n := 0
+	for _, c := range cmds {
+		if c == cmd {
+			n++
+		}
+	}
+	return n
+}
+
+type roundTripperFunc func(*redis.Request) (*redis.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *redis.Request) (*redis.Response, error) {
+	return f(req)
+}
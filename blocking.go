@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ErrBlockTimeout is returned by the blocking helpers of Client when the
+// timeout of the command expired before an element was available.
+var ErrBlockTimeout = errors.New("redis: blocking command timed out")
+
+// QueryBlocking issues a blocking command whose timeout is its last argument,
+// like BLPOP, BRPOPLPUSH or BLMOVE, to the Redis server at the address set on
+// the client. The timeout is appended to args in seconds, zero blocks
+// indefinitely.
+//
+// Blocking commands hold a connection for as long as they wait. The connection
+// is taken out of the pool, where the transport doesn't send health pings, and
+// is returned to it once the response is read. The Timeout of the client is
+// added to the timeout of the command so the request isn't interrupted while
+// the server is legitimately waiting, and doesn't apply to commands blocking
+// indefinitely, which are only bounded by ctx. Canceling ctx closes the
+// connection, which makes the server drop the command.
+//
+// Blocking commands are never retried.
+func (c *Client) QueryBlocking(ctx context.Context, timeout time.Duration, cmd string, args ...interface{}) Args {
+	if c.Codec != nil {
+		var err error
+		if args, err = encodeValues(c.Codec, args); err != nil {
+			return newArgsError(err)
+		}
+	}
+
+	// The slice is copied so the array of the caller is never modified.
+	args = append(args[:len(args):len(args)], formatBlockTimeout(timeout))
+
+	var limit time.Duration
+	if timeout > 0 && c.Timeout > 0 {
+		limit = timeout + c.Timeout
+	}
+
+	r, err := c.do(&Request{
+		Addr:    clientAddr(c),
+		Cmds:    []Command{{cmd, List(args...)}},
+		Context: ctx,
+	}, limit)
+	if err != nil {
+		return newArgsError(err)
+	}
+
+	if c.Codec != nil {
+		return &codecArgs{Args: r.Args, codec: c.Codec}
+	}
+
+	return r.Args
+}
+
+// ExecBlocking is like QueryBlocking but discards the response.
+func (c *Client) ExecBlocking(ctx context.Context, timeout time.Duration, cmd string, args ...interface{}) error {
+	return ParseArgs(c.QueryBlocking(ctx, timeout, cmd, args...), nil)
+}
+
+// BLPop removes and returns the first element of the first non-empty list of
+// keys, waiting up to timeout for one to be available, using BLPOP. The
+// method returns ErrBlockTimeout if the timeout expired.
+func (c *Client) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (key, value string, err error) {
+	return c.blockingPop(ctx, timeout, "BLPOP", keys)
+}
+
+// BRPop is like BLPop but removes the last element of the list, using BRPOP.
+func (c *Client) BRPop(ctx context.Context, timeout time.Duration, keys ...string) (key, value string, err error) {
+	return c.blockingPop(ctx, timeout, "BRPOP", keys)
+}
+
+// BRPopLPush moves the last element of the list at src to the head of the list
+// at dst and returns it, waiting up to timeout for one to be available, using
+// BRPOPLPUSH. The method returns ErrBlockTimeout if the timeout expired.
+func (c *Client) BRPopLPush(ctx context.Context, src, dst string, timeout time.Duration) (string, error) {
+	return c.blockingString(ctx, timeout, "BRPOPLPUSH", src, dst)
+}
+
+// BLMove moves an element from the list at src to the list at dst and returns
+// it, waiting up to timeout for one to be available, using BLMOVE. The sides
+// are either "LEFT" or "RIGHT". The method returns ErrBlockTimeout if the
+// timeout expired.
+func (c *Client) BLMove(ctx context.Context, src, dst, srcSide, dstSide string, timeout time.Duration) (string, error) {
+	return c.blockingString(ctx, timeout, "BLMOVE", src, dst, srcSide, dstSide)
+}
+
+func (c *Client) blockingPop(ctx context.Context, timeout time.Duration, cmd string, keys []string) (key, value string, err error) {
+	var kv []string
+
+	if kv, err = readStrings(c.QueryBlocking(ctx, timeout, cmd, stringArgs(keys)...)); err != nil {
+		return
+	}
+
+	if len(kv) != 2 {
+		err = ErrBlockTimeout
+		return
+	}
+
+	return kv[0], kv[1], nil
+}
+
+func (c *Client) blockingString(ctx context.Context, timeout time.Duration, cmd string, args ...interface{}) (string, error) {
+	var s *string
+
+	if err := ParseArgs(c.QueryBlocking(ctx, timeout, cmd, args...), &s); err != nil {
+		return "", err
+	}
+
+	if s == nil {
+		return "", ErrBlockTimeout
+	}
+
+	return *s, nil
+}
+
+// formatBlockTimeout formats timeout in seconds, redis accepts decimal values
+// since version 6.
+func formatBlockTimeout(timeout time.Duration) string {
+	if timeout < 0 {
+		timeout = 0
+	}
+	return strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64)
+}
@@ -0,0 +1,141 @@
+package redis_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestClientBlockingCommands(t *testing.T) {
+	var mutex sync.Mutex
+	var command string
+	var reply string
+	var delay time.Duration
+
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		if cmd == "CLIENT" {
+			return "" // setup commands of the transport
+		}
+		mutex.Lock()
+		command = strings.Join(append([]string{cmd}, args...), " ")
+		r, d := reply, delay
+		mutex.Unlock()
+		time.Sleep(d)
+		return r
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	// The timeout of the client is shorter than the time the server blocks,
+	// it must not interrupt the blocking commands.
+	cli := &redis.Client{Addr: addr, Transport: tr, Timeout: 50 * time.Millisecond}
+
+	tests := []struct {
+		scenario string
+		function func(context.Context) (interface{}, error)
+		reply    string
+		delay    time.Duration
+		command  string
+		expect   interface{}
+		err      error
+	}{
+		{
+			scenario: "BLPop",
+			function: func(ctx context.Context) (interface{}, error) {
+				key, value, err := cli.BLPop(ctx, 200*time.Millisecond, "A", "B")
+				return key + "=" + value, err
+			},
+			reply:   "*2\r\n$1\r\nB\r\n$5\r\nhello\r\n",
+			delay:   100 * time.Millisecond,
+			command: "BLPOP A B 0.2",
+			expect:  "B=hello",
+		},
+		{
+			scenario: "BRPop which times out",
+			function: func(ctx context.Context) (interface{}, error) {
+				key, value, err := cli.BRPop(ctx, time.Second, "A")
+				return key + "=" + value, err
+			},
+			reply:   "*-1\r\n",
+			command: "BRPOP A 1",
+			expect:  "=",
+			err:     redis.ErrBlockTimeout,
+		},
+		{
+			scenario: "BRPopLPush",
+			function: func(ctx context.Context) (interface{}, error) {
+				return cli.BRPopLPush(ctx, "A", "B", 0)
+			},
+			reply:   "$1\r\nx\r\n",
+			delay:   100 * time.Millisecond,
+			command: "BRPOPLPUSH A B 0",
+			expect:  "x",
+		},
+		{
+			scenario: "BLMove which times out",
+			function: func(ctx context.Context) (interface{}, error) {
+				return cli.BLMove(ctx, "A", "B", "LEFT", "RIGHT", 1500*time.Millisecond)
+			},
+			reply:   "$-1\r\n",
+			command: "BLMOVE A B LEFT RIGHT 1.5",
+			expect:  "",
+			err:     redis.ErrBlockTimeout,
+		},
+		{
+			scenario: "ExecBlocking",
+			function: func(ctx context.Context) (interface{}, error) {
+				return nil, cli.ExecBlocking(ctx, 100*time.Millisecond, "BZPOPMIN", "Z")
+			},
+			reply:   "*3\r\n$1\r\nZ\r\n$1\r\nm\r\n$1\r\n1\r\n",
+			command: "BZPOPMIN Z 0.1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			mutex.Lock()
+			reply, delay = test.reply, test.delay
+			mutex.Unlock()
+
+			v, err := test.function(context.Background())
+			if err != test.err {
+				t.Error("bad error:", err)
+			}
+
+			if v != test.expect {
+				t.Errorf("bad value: %#v != %#v", v, test.expect)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if command != test.command {
+				t.Errorf("bad command: %q != %q", command, test.command)
+			}
+		})
+	}
+
+	t.Run("canceling the context interrupts blocking commands", func(t *testing.T) {
+		mutex.Lock()
+		reply, delay = "*-1\r\n", time.Second
+		mutex.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+
+		if _, _, err := cli.BLPop(ctx, 0, "A"); redis.ErrorClass(err) != redis.ErrClassTimeout {
+			t.Error("bad error:", err)
+		}
+
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Error("the command was not interrupted:", elapsed)
+		}
+	})
+}
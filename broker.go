@@ -0,0 +1,565 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+const (
+	// DefaultBrokerMaxPending is the default value of Broker.MaxPending.
+	DefaultBrokerMaxPending = 1024
+
+	// DefaultBrokerBlockTimeout is the default value of Broker.BlockTimeout.
+	DefaultBrokerBlockTimeout = 1 * time.Second
+)
+
+// A Broker implements the publish/subscribe commands of redis on servers.
+//
+// Connections sending SUBSCRIBE or PSUBSCRIBE are hijacked by the broker and
+// switched to subscriber mode, where only the SUBSCRIBE, UNSUBSCRIBE,
+// PSUBSCRIBE, PUNSUBSCRIBE, PING and QUIT commands are accepted. Unlike redis,
+// connections stay in subscriber mode after unsubscribing from all channels.
+//
+// Brokers are local to a process unless they have a Backend, which shares the
+// messages published on a set of brokers so a horizontally scaled group of
+// servers presents consistent pub/sub to clients.
+//
+// The zero value is a broker ready to use.
+type Broker struct {
+	// Backend, if not nil, fans out messages published on the broker to other
+	// brokers, Run must be called to receive the messages published on them.
+	Backend BrokerBackend
+
+	// MaxPending is the maximum number of messages waiting to be written to a
+	// subscriber. Subscribers falling further behind are handled according to
+	// Policy. Zero means DefaultBrokerMaxPending.
+	MaxPending int
+
+	// Policy is the behavior of the broker when a subscriber has MaxPending
+	// messages waiting to be written. The default, BacklogDisconnect,
+	// disconnects the subscriber like redis does with clients exceeding the
+	// pubsub output buffer limit.
+	Policy BacklogPolicy
+
+	// BlockTimeout is the maximum time a publisher waits for a subscriber to
+	// catch up when Policy is BacklogBlock, the subscriber is disconnected
+	// when it expires. Zero means DefaultBrokerBlockTimeout.
+	BlockTimeout time.Duration
+
+	stats    backlogStats
+	limits   brokerLimits
+	mutex    sync.RWMutex
+	channels map[string]map[*subscriber]struct{}
+	patterns map[string]map[*subscriber]struct{}
+}
+
+// HandlePubSub registers the SUBSCRIBE, PSUBSCRIBE, PUBLISH and PUBSUB
+// commands on mux.
+func (b *Broker) HandlePubSub(mux *ServeMux) {
+	mux.HandleArity("SUBSCRIBE", -2, HandlerFunc(b.serveSubscribe))
+	mux.HandleArity("PSUBSCRIBE", -2, HandlerFunc(b.serveSubscribe))
+	mux.HandleArity("PUBLISH", 3, HandlerFunc(b.servePublish))
+	mux.HandleArity("PUBSUB CHANNELS", -2, HandlerFunc(b.serveChannels))
+	mux.HandleArity("PUBSUB NUMSUB", -2, HandlerFunc(b.serveNumSub))
+	mux.HandleArity("PUBSUB NUMPAT", 2, HandlerFunc(b.serveNumPat))
+}
+
+// A BrokerBackend fans out the messages published on brokers sharing the
+// backend, it may be built on another redis server, a message bus like NATS,
+// or anything that can broadcast messages to a group of processes.
+//
+// Implementations must be safe to use concurrently from multiple goroutines.
+type BrokerBackend interface {
+	// Publish forwards a message published on the local broker to the other
+	// brokers sharing the backend.
+	Publish(ctx context.Context, channel string, message []byte) error
+
+	// Subscribe calls deliver with the messages published on the other
+	// brokers sharing the backend, until ctx is canceled or an error occurs.
+	// Messages forwarded by Publish must not be delivered back to the broker
+	// which published them, since brokers deliver their own messages to
+	// their local subscribers.
+	Subscribe(ctx context.Context, deliver func(channel string, message []byte)) error
+}
+
+// Run receives the messages published on the other brokers sharing the
+// backend and delivers them to the local subscribers, until ctx is canceled
+// or the backend fails. It returns nil right away if the broker has no
+// backend.
+func (b *Broker) Run(ctx context.Context) error {
+	if b.Backend == nil {
+		return nil
+	}
+	return b.Backend.Subscribe(ctx, func(channel string, message []byte) {
+		b.Publish(channel, message)
+	})
+}
+
+// PublishContext sends message to the local subscribers of channel, and
+// forwards it to the backend if the broker has one. The method returns the
+// number of local subscribers that received the message, like PUBLISH on a
+// redis cluster.
+func (b *Broker) PublishContext(ctx context.Context, channel string, message []byte) (int, error) {
+	n := b.Publish(channel, message)
+
+	if b.Backend != nil {
+		if err := b.Backend.Publish(ctx, channel, message); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// Publish sends message to the local subscribers of channel, returning the
+// number of subscribers that received it. Unlike PublishContext, the message
+// is not forwarded to the backend.
+func (b *Broker) Publish(channel string, message []byte) int {
+	// The subscribers are collected while holding the lock and the message is
+	// delivered after releasing it, subscribers which block the publisher
+	// (see BacklogBlock) must not block subscriptions or other publishers.
+	type delivery struct {
+		sub *subscriber
+		msg []interface{}
+	}
+
+	var deliveries []delivery
+	b.mutex.RLock()
+
+	if subs := b.channels[channel]; len(subs) != 0 {
+		msg := []interface{}{[]byte("message"), []byte(channel), message}
+
+		for sub := range subs {
+			deliveries = append(deliveries, delivery{sub: sub, msg: msg})
+		}
+	}
+
+	for pattern, subs := range b.patterns {
+		if matchGlob(pattern, channel) {
+			pmsg := []interface{}{[]byte("pmessage"), []byte(pattern), []byte(channel), message}
+
+			for sub := range subs {
+				deliveries = append(deliveries, delivery{sub: sub, msg: pmsg})
+			}
+		}
+	}
+
+	b.mutex.RUnlock()
+
+	n := 0
+	for _, d := range deliveries {
+		if d.sub.publish(d.msg) {
+			n++
+		}
+	}
+	return n
+}
+
+// Channels returns the sorted list of channels which have subscribers and
+// whose names match the glob-style pattern, or all of them if pattern is
+// empty. Subscriptions to patterns are not counted.
+func (b *Broker) Channels(pattern string) []string {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	channels := make([]string, 0, len(b.channels))
+
+	for channel := range b.channels {
+		if len(pattern) == 0 || matchGlob(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+
+	sort.Strings(channels)
+	return channels
+}
+
+// NumSub returns the number of subscribers of each of the channels.
+func (b *Broker) NumSub(channels ...string) []int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	counts := make([]int, len(channels))
+
+	for i, channel := range channels {
+		counts[i] = len(b.channels[channel])
+	}
+
+	return counts
+}
+
+// NumPat returns the number of patterns that subscribers are subscribed to.
+func (b *Broker) NumPat() int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return len(b.patterns)
+}
+
+func (b *Broker) servePublish(res ResponseWriter, req *Request) {
+	var channel string
+	var message []byte
+
+	if err := req.Cmds[0].ParseArgs(&channel, &message); err != nil {
+		res.Write(err)
+		return
+	}
+
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	n, err := b.PublishContext(ctx, channel, message)
+	if err != nil {
+		res.Write(err)
+		return
+	}
+
+	res.Write(int64(n))
+}
+
+func (b *Broker) serveChannels(res ResponseWriter, req *Request) {
+	var pattern string
+
+	if err := req.Cmds[0].ParseArgs(&pattern); err != nil {
+		res.Write(err)
+		return
+	}
+
+	channels := b.Channels(pattern)
+	res.WriteStream(len(channels))
+
+	for _, channel := range channels {
+		res.Write([]byte(channel))
+	}
+}
+
+func (b *Broker) serveNumSub(res ResponseWriter, req *Request) {
+	channels, err := readStrings(req.Cmds[0].Args)
+	if err != nil {
+		res.Write(err)
+		return
+	}
+
+	counts := b.NumSub(channels...)
+	res.WriteStream(2 * len(channels))
+
+	for i, channel := range channels {
+		res.Write([]byte(channel))
+		res.Write(int64(counts[i]))
+	}
+}
+
+func (b *Broker) serveNumPat(res ResponseWriter, req *Request) {
+	res.Write(int64(b.NumPat()))
+}
+
+func (b *Broker) serveSubscribe(res ResponseWriter, req *Request) {
+	args, err := readStrings(req.Cmds[0].Args)
+	if err != nil {
+		res.Write(err)
+		return
+	}
+
+	hijacker, ok := res.(Hijacker)
+	if !ok {
+		res.Write(resp.NewError("ERR subscriptions are not supported by this server"))
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+
+	if rw.Writer.Flush() != nil {
+		return
+	}
+
+	// The broker owns the connection from now on, subscribers wait for
+	// messages for as long as they are connected.
+	conn.SetDeadline(time.Time{})
+
+	c := NewServerConn(&bufferedConn{Conn: conn, r: rw.Reader})
+	sub := &subscriber{
+		backlog:  newBacklog(b.maxPending(), b.Policy, b.blockTimeout(), &b.stats, func() { c.Close() }),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			v, ok := sub.backlog.pop()
+			if !ok {
+				return
+			}
+			c.writeValue(v)
+		}
+	}()
+
+	defer func() {
+		b.unsubscribeAll(sub)
+		sub.backlog.close()
+		<-done
+	}()
+
+	for name := req.Cmds[0].Cmd; b.serveSubscriber(sub, name, args); {
+		r := c.ReadCommands()
+		cmd := Command{}
+
+		if !r.Read(&cmd) {
+			r.Close()
+			return
+		}
+
+		args, err = readStrings(cmd.Args)
+
+		if e := r.Close(); e != nil || err != nil {
+			return
+		}
+
+		name = cmd.Cmd
+	}
+}
+
+// serveSubscriber serves a command received by a connection in subscriber
+// mode, returning false if the connection must be closed.
+func (b *Broker) serveSubscriber(sub *subscriber, cmd string, args []string) bool {
+	switch cmd = strings.ToUpper(cmd); cmd {
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		if len(args) == 0 {
+			return sub.push(errWrongNumberOfArgs(strings.ToLower(cmd)))
+		}
+
+		for _, name := range args {
+			b.subscribe(sub, cmd == "PSUBSCRIBE", name)
+
+			if !sub.push([]interface{}{[]byte(strings.ToLower(cmd)), []byte(name), sub.count()}) {
+				return false
+			}
+		}
+
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		if len(args) == 0 {
+			args = sub.names(cmd == "PUNSUBSCRIBE")
+		}
+
+		if len(args) == 0 {
+			return sub.push([]interface{}{[]byte(strings.ToLower(cmd)), nil, sub.count()})
+		}
+
+		for _, name := range args {
+			b.unsubscribe(sub, cmd == "PUNSUBSCRIBE", name)
+
+			if !sub.push([]interface{}{[]byte(strings.ToLower(cmd)), []byte(name), sub.count()}) {
+				return false
+			}
+		}
+
+	case "PING":
+		msg := ""
+		if len(args) != 0 {
+			msg = args[0]
+		}
+		return sub.push([]interface{}{[]byte("pong"), []byte(msg)})
+
+	case "QUIT":
+		sub.push("OK")
+		return false
+
+	default:
+		return sub.push(resp.NewError(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(cmd))))
+	}
+
+	return true
+}
+
+func (b *Broker) subscribe(sub *subscriber, pattern bool, name string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	table, names := &b.channels, sub.channels
+	if pattern {
+		table, names = &b.patterns, sub.patterns
+	}
+
+	if *table == nil {
+		*table = make(map[string]map[*subscriber]struct{})
+	}
+
+	subs := (*table)[name]
+
+	if subs == nil {
+		subs = make(map[*subscriber]struct{})
+		(*table)[name] = subs
+	}
+
+	subs[sub] = struct{}{}
+	names[name] = struct{}{}
+}
+
+func (b *Broker) unsubscribe(sub *subscriber, pattern bool, name string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.unsubscribeLocked(sub, pattern, name)
+}
+
+func (b *Broker) unsubscribeLocked(sub *subscriber, pattern bool, name string) {
+	table, names := b.channels, sub.channels
+	if pattern {
+		table, names = b.patterns, sub.patterns
+	}
+
+	if subs := table[name]; subs != nil {
+		if delete(subs, sub); len(subs) == 0 {
+			delete(table, name)
+		}
+	}
+
+	delete(names, name)
+}
+
+func (b *Broker) unsubscribeAll(sub *subscriber) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for name := range sub.channels {
+		b.unsubscribeLocked(sub, false, name)
+	}
+
+	for name := range sub.patterns {
+		b.unsubscribeLocked(sub, true, name)
+	}
+}
+
+// Stats returns the counters of messages published to the subscribers of b.
+func (b *Broker) Stats() BacklogStats {
+	return b.stats.load()
+}
+
+// RegisterTunables registers the limits of the backlogs of subscribers on r,
+// so they can be changed with CONFIG SET while the broker is running:
+//
+//	pubsub-max-pending    MaxPending
+//	pubsub-block-timeout  BlockTimeout, in milliseconds
+//
+// The tunables are initialized with the values of the fields of the broker,
+// or their defaults, which must not be changed afterwards. New values apply
+// to the connections which subscribe after they were set.
+func (b *Broker) RegisterTunables(r *TunableRegistry) {
+	limits := b.loadLimits()
+	r.Register("pubsub-max-pending", &limits.maxPending)
+	r.Register("pubsub-block-timeout", &limits.blockTimeout)
+}
+
+// brokerLimits holds the limits of a broker which can be changed while it's
+// running, they are loaded from the fields of the broker the first time they
+// are needed.
+type brokerLimits struct {
+	once         sync.Once
+	maxPending   IntTunable
+	blockTimeout DurationTunable
+}
+
+func (b *Broker) loadLimits() *brokerLimits {
+	limits := &b.limits
+
+	limits.once.Do(func() {
+		limits.maxPending.Min, limits.maxPending.Max = 1, math.MaxInt32
+		limits.blockTimeout.Unit = time.Millisecond
+
+		limits.maxPending.Store(DefaultBrokerMaxPending)
+		if b.MaxPending > 0 {
+			limits.maxPending.Store(int64(b.MaxPending))
+		}
+
+		limits.blockTimeout.Store(DefaultBrokerBlockTimeout)
+		if b.BlockTimeout > 0 {
+			limits.blockTimeout.Store(b.BlockTimeout)
+		}
+	})
+
+	return limits
+}
+
+func (b *Broker) maxPending() int {
+	return int(b.loadLimits().maxPending.Load())
+}
+
+func (b *Broker) blockTimeout() time.Duration {
+	return b.loadLimits().blockTimeout.Load()
+}
+
+// subscriber is the state of a connection in subscriber mode. The maps of
+// channels and patterns are only modified by the goroutine serving the
+// connection, while holding the lock of the broker.
+type subscriber struct {
+	backlog  *backlog
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+// push queues the reply v to be written to the subscriber, the connection is
+// closed if the backlog is full.
+func (sub *subscriber) push(v interface{}) bool {
+	return sub.backlog.push(v, false)
+}
+
+// publish queues the message v to be written to the subscriber, applying the
+// policy of the broker if the backlog is full.
+func (sub *subscriber) publish(v interface{}) bool {
+	return sub.backlog.push(v, true)
+}
+
+func (sub *subscriber) count() int64 {
+	return int64(len(sub.channels) + len(sub.patterns))
+}
+
+func (sub *subscriber) names(pattern bool) []string {
+	set := sub.channels
+	if pattern {
+		set = sub.patterns
+	}
+
+	names := make([]string, 0, len(set))
+
+	for name := range set {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// bufferedConn is a net.Conn reading from a buffer first, used to not lose
+// the data buffered when connections are hijacked.
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func readStrings(args Args) ([]string, error) {
+	var list []string
+	var s string
+
+	for args.Next(&s) {
+		list = append(list, s)
+	}
+
+	return list, args.Close()
+}
@@ -0,0 +1,445 @@
+package redis_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestBroker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	broker := &redis.Broker{}
+	mux := redis.NewServeMux()
+	broker.HandlePubSub(mux)
+
+	srv, url := newServer(mux)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "tcp://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := redis.NewSubConn(conn)
+	defer sub.Close()
+
+	if err := sub.WriteCommand("SUBSCRIBE", "A", "B"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sub.WriteCommand("PSUBSCRIBE", "C*"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, ctx, func() bool { return broker.NumPat() == 1 })
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	t.Run("PUBLISH returns the number of subscribers which received the message", func(t *testing.T) {
+		n, err := cli.ExecInt(ctx, "PUBLISH", "A", "hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Error("bad number of subscribers:", n)
+		}
+
+		// Publishing to a channel without subscribers must not produce
+		// messages.
+		if n, _ := cli.ExecInt(ctx, "PUBLISH", "D", "nobody"); n != 0 {
+			t.Error("bad number of subscribers:", n)
+		}
+
+		channel, message, err := sub.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if channel != "A" || string(message) != "hello" {
+			t.Errorf("bad message: %s %s", channel, message)
+		}
+	})
+
+	t.Run("patterns match channels with the glob syntax of redis", func(t *testing.T) {
+		// Unlike path.Match, '*' matches '/' in the patterns of redis.
+		n, err := cli.ExecInt(ctx, "PUBLISH", "C/1", "hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Error("bad number of subscribers:", n)
+		}
+	})
+
+	t.Run("PUBSUB CHANNELS lists the channels with subscribers", func(t *testing.T) {
+		channels, err := cli.PubSubChannels(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(channels, []string{"A", "B"}) {
+			t.Error("bad channels:", channels)
+		}
+
+		channels, err = cli.PubSubChannels(ctx, "B*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(channels, []string{"B"}) {
+			t.Error("bad channels:", channels)
+		}
+	})
+
+	t.Run("PUBSUB NUMSUB returns the number of subscribers of channels", func(t *testing.T) {
+		counts, err := cli.PubSubNumSub(ctx, "A", "C")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(counts, map[string]int64{"A": 1, "C": 0}) {
+			t.Error("bad subscriber counts:", counts)
+		}
+	})
+
+	t.Run("PUBSUB NUMPAT returns the number of patterns", func(t *testing.T) {
+		n, err := cli.PubSubNumPat(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Error("bad number of patterns:", n)
+		}
+	})
+
+	sub.Close()
+	waitFor(t, ctx, func() bool { return len(broker.Channels("")) == 0 && broker.NumPat() == 0 })
+}
+
+func TestBrokerBacklogPolicy(t *testing.T) {
+	tests := []struct {
+		scenario string
+		policy   redis.BacklogPolicy
+		function func(redis.BacklogStats) bool
+	}{
+		{
+			scenario: "the disconnect policy closes the connections of slow subscribers",
+			policy:   redis.BacklogDisconnect,
+			function: func(s redis.BacklogStats) bool { return s.Disconnected != 0 && s.Dropped == 0 },
+		},
+		{
+			scenario: "the block policy disconnects slow subscribers after the block timeout",
+			policy:   redis.BacklogBlock,
+			function: func(s redis.BacklogStats) bool { return s.Blocked != 0 && s.Disconnected == 1 },
+		},
+		{
+			scenario: "the drop-oldest policy discards messages of slow subscribers",
+			policy:   redis.BacklogDropOldest,
+			function: func(s redis.BacklogStats) bool { return s.Dropped != 0 && s.Disconnected == 0 },
+		},
+		{
+			scenario: "the drop-newest policy discards messages of slow subscribers",
+			policy:   redis.BacklogDropNewest,
+			function: func(s redis.BacklogStats) bool { return s.Dropped != 0 && s.Disconnected == 0 },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			broker := &redis.Broker{
+				MaxPending:   2,
+				Policy:       test.policy,
+				BlockTimeout: 10 * time.Millisecond,
+			}
+			mux := redis.NewServeMux()
+			broker.HandlePubSub(mux)
+
+			srv, url := newServer(mux)
+			defer srv.Close()
+
+			conn, err := net.Dial("tcp", strings.TrimPrefix(url, "tcp://"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sub := redis.NewSubConn(conn)
+			defer sub.Close()
+
+			if err := sub.WriteCommand("SUBSCRIBE", "A"); err != nil {
+				t.Fatal(err)
+			}
+
+			waitFor(t, ctx, func() bool { return len(broker.Channels("")) == 1 })
+
+			// The subscriber never reads, publishing large messages fills the
+			// socket buffers and then the backlog.
+			message := make([]byte, 64*1024)
+
+			waitFor(t, ctx, func() bool {
+				broker.Publish("A", message)
+				return test.function(broker.Stats())
+			})
+
+			if stats := broker.Stats(); stats.Delivered == 0 || stats.Disconnected > 1 {
+				t.Error("bad stats:", stats)
+			}
+		})
+	}
+}
+
+func TestBrokerTunables(t *testing.T) {
+	broker := &redis.Broker{MaxPending: 2}
+	reg := &redis.TunableRegistry{}
+	broker.RegisterTunables(reg)
+
+	if pairs, expect := reg.Get("pubsub-*"), []string{"pubsub-block-timeout", "1000", "pubsub-max-pending", "2"}; !reflect.DeepEqual(pairs, expect) {
+		t.Errorf("bad tunables: %q", pairs)
+	}
+
+	if err := reg.Set("pubsub-max-pending", "0"); err == nil {
+		t.Error("setting pubsub-max-pending to zero must fail")
+	}
+
+	if err := reg.Set("pubsub-max-pending", "100", "pubsub-block-timeout", "50"); err != nil {
+		t.Fatal(err)
+	}
+
+	if pairs, expect := reg.Get("pubsub-*"), []string{"pubsub-block-timeout", "50", "pubsub-max-pending", "100"}; !reflect.DeepEqual(pairs, expect) {
+		t.Errorf("bad tunables after CONFIG SET: %q", pairs)
+	}
+}
+
+func TestBrokerBlockedPublisher(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	broker := &redis.Broker{
+		MaxPending:   2,
+		Policy:       redis.BacklogBlock,
+		BlockTimeout: 4 * time.Second,
+	}
+	mux := redis.NewServeMux()
+	broker.HandlePubSub(mux)
+
+	srv, url := newServer(mux)
+	defer srv.Close()
+
+	subscribe := func(channel string) *redis.SubConn {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(url, "tcp://"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub := redis.NewSubConn(conn)
+		if err := sub.WriteCommand("SUBSCRIBE", channel); err != nil {
+			t.Fatal(err)
+		}
+		return sub
+	}
+
+	slow := subscribe("A")
+	defer slow.Close()
+
+	waitFor(t, ctx, func() bool { return len(broker.Channels("")) == 1 })
+
+	// The subscriber never reads, the publisher ends up blocked waiting for
+	// it to catch up.
+	go func() {
+		message := make([]byte, 64*1024)
+		for ctx.Err() == nil && broker.Publish("A", message) != 0 {
+		}
+	}()
+
+	waitFor(t, ctx, func() bool { return broker.Stats().Blocked != 0 })
+
+	// Subscriptions and publishers to other channels must not wait for the
+	// blocked publisher.
+	start := time.Now()
+
+	other := subscribe("B")
+	defer other.Close()
+
+	waitFor(t, ctx, func() bool { return len(broker.Channels("")) == 2 })
+	broker.Publish("B", []byte("hello"))
+
+	if _, msg, err := other.ReadMessage(); err != nil {
+		t.Fatal(err)
+	} else if string(msg) != "hello" {
+		t.Error("bad message:", string(msg))
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("the subscription waited for the blocked publisher:", elapsed)
+	}
+}
+
+func TestSubConnMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	broker := &redis.Broker{}
+	mux := redis.NewServeMux()
+	broker.HandlePubSub(mux)
+
+	srv, url := newServer(mux)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "tcp://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := redis.NewSubConn(conn)
+	defer sub.Close()
+
+	if err := sub.WriteCommand("SUBSCRIBE", "A"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, ctx, func() bool { return len(broker.Channels("")) == 1 })
+
+	messages := sub.Messages(2, redis.BacklogDropNewest)
+
+	for _, m := range []string{"1", "2", "3"} {
+		broker.Publish("A", []byte(m))
+	}
+
+	// The third message is dropped since the program didn't receive any of
+	// the messages buffered on the connection.
+	waitFor(t, ctx, func() bool { return sub.Stats().Delivered+sub.Stats().Dropped == 3 })
+
+	if stats := sub.Stats(); stats.Dropped > 1 {
+		t.Error("bad stats:", stats)
+	}
+
+	msg := <-messages
+	if msg.Channel != "A" || string(msg.Payload) != "1" {
+		t.Errorf("bad message: %s %s", msg.Channel, msg.Payload)
+	}
+
+	// The program stops receiving messages, closing the connection must
+	// release the goroutine delivering them even though one is buffered.
+	broker.Publish("A", []byte("4"))
+	waitFor(t, ctx, func() bool { return sub.Stats().Delivered+sub.Stats().Dropped == 4 })
+	time.Sleep(10 * time.Millisecond)
+
+	sub.Close()
+
+	for range messages {
+	}
+}
+
+func waitFor(t *testing.T, ctx context.Context, cond func() bool) {
+	for !cond() {
+		select {
+		case <-time.After(time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	}
+}
+
+func TestRedisBrokerBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The hub plays the role of the redis server shared by the brokers.
+	hub := &redis.Broker{}
+	hubMux := redis.NewServeMux()
+	hub.HandlePubSub(hubMux)
+
+	hubSrv, hubURL := newServer(hubMux)
+	defer hubSrv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	// The subscriptions of the backends are made with the transport of their
+	// client.
+	var dials int32
+
+	backendTr := &redis.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return redis.DefaultDialer.DialContext(ctx, network, address)
+		},
+	}
+	defer backendTr.CloseIdleConnections()
+
+	urls := make([]string, 2)
+
+	for i := range urls {
+		broker := &redis.Broker{
+			Backend: &redis.RedisBrokerBackend{
+				Client: &redis.Client{Addr: hubURL, Transport: backendTr},
+			},
+		}
+
+		mux := redis.NewServeMux()
+		broker.HandlePubSub(mux)
+
+		srv, url := newServer(mux)
+		defer srv.Close()
+		urls[i] = url
+
+		go broker.Run(ctx)
+	}
+
+	waitFor(t, ctx, func() bool { return hub.NumSub(redis.DefaultBrokerChannel)[0] == 2 })
+
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Error("the subscriptions were not made with the transport of the client:", n)
+	}
+
+	subs := make([]*redis.SubConn, 2)
+
+	for i, url := range urls {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(url, "tcp://"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs[i] = redis.NewSubConn(conn)
+		defer subs[i].Close()
+
+		if err := subs[i].WriteCommand("SUBSCRIBE", "A"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Wait for the subscriptions to be registered on both servers.
+	for _, url := range urls {
+		cli := &redis.Client{Addr: url, Transport: tr}
+		waitFor(t, ctx, func() bool {
+			counts, _ := cli.PubSubNumSub(ctx, "A")
+			return counts["A"] == 1
+		})
+	}
+
+	cli := &redis.Client{Addr: urls[0], Transport: tr}
+
+	// Messages must be delivered once to each subscriber, the broker which
+	// published them does not receive them back from the backend.
+	for _, msg := range []string{"hello", "world"} {
+		if n, err := cli.ExecInt(ctx, "PUBLISH", "A", msg); err != nil {
+			t.Fatal(err)
+		} else if n != 1 {
+			t.Error("bad number of local subscribers:", n)
+		}
+
+		for i, sub := range subs {
+			channel, message, err := sub.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if channel != "A" || string(message) != msg {
+				t.Errorf("subscriber #%d received a bad message: %s %s", i, channel, message)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// DefaultBrokerChannel is the default value of RedisBrokerBackend.Channel.
+const DefaultBrokerChannel = "redis-go:broker"
+
+// RedisBrokerBackend is a BrokerBackend which fans out messages through the
+// pub/sub of a redis server. All messages are published on a single channel
+// of the server, wrapped with the name of their channel and the identifier of
+// the backend which published them.
+type RedisBrokerBackend struct {
+	// Client is used to publish messages and to subscribe to them, with the
+	// configuration of its transport. If nil, DefaultClient is used.
+	Client *Client
+
+	// Channel is the name of the channel that messages are exchanged on. If
+	// empty, DefaultBrokerChannel is used.
+	Channel string
+
+	once sync.Once
+	id   string
+}
+
+// Publish satisfies the BrokerBackend interface.
+func (r *RedisBrokerBackend) Publish(ctx context.Context, channel string, message []byte) error {
+	return r.client().Exec(ctx, "PUBLISH", r.channel(), r.wrap(channel, message))
+}
+
+// Subscribe satisfies the BrokerBackend interface.
+func (r *RedisBrokerBackend) Subscribe(ctx context.Context, deliver func(channel string, message []byte)) error {
+	sub, err := r.client().Subscribe(ctx, r.channel())
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, payload, err := sub.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return err
+		}
+
+		id, channel, message, err := unwrapBrokerMessage(payload)
+		if err != nil || id == r.identifier() {
+			continue
+		}
+
+		deliver(channel, message)
+	}
+}
+
+func (r *RedisBrokerBackend) client() *Client {
+	if r.Client != nil {
+		return r.Client
+	}
+	return DefaultClient
+}
+
+func (r *RedisBrokerBackend) channel() string {
+	if len(r.Channel) != 0 {
+		return r.Channel
+	}
+	return DefaultBrokerChannel
+}
+
+func (r *RedisBrokerBackend) identifier() string {
+	r.once.Do(func() { r.id = NewCorrelationID() })
+	return r.id
+}
+
+// wrap encodes a message as "<id> <length of channel> <channel><message>".
+func (r *RedisBrokerBackend) wrap(channel string, message []byte) []byte {
+	b := make([]byte, 0, 32+len(channel)+len(message))
+	b = append(b, r.identifier()...)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(len(channel)), 10)
+	b = append(b, ' ')
+	b = append(b, channel...)
+	return append(b, message...)
+}
+
+var errMalformedBrokerMessage = errors.New("redis: malformed broker message")
+
+func unwrapBrokerMessage(b []byte) (id string, channel string, message []byte, err error) {
+	i := bytes.IndexByte(b, ' ')
+	if i < 0 {
+		err = errMalformedBrokerMessage
+		return
+	}
+	id, b = string(b[:i]), b[i+1:]
+
+	j := bytes.IndexByte(b, ' ')
+	if j < 0 {
+		err = errMalformedBrokerMessage
+		return
+	}
+
+	n, e := strconv.Atoi(string(b[:j]))
+	if b = b[j+1:]; e != nil || n < 0 || n > len(b) {
+		err = errMalformedBrokerMessage
+		return
+	}
+
+	channel, message = string(b[:n]), b[n:]
+	return
+}
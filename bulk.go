@@ -0,0 +1,137 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// forEachKeyCount is the COUNT hint of the SCAN commands sent by ForEachKey.
+const forEachKeyCount = 1000
+
+// ForEachKey calls fn with every key matching the glob-style pattern match, or
+// all keys if pattern is empty, using client (or DefaultClient if nil). The
+// keys are found with SCAN and dispatched to parallelism goroutines, so fn
+// must be safe to call concurrently. If parallelism is less than one, keys are
+// processed one at a time.
+//
+// The first error returned by fn cancels the context passed to the other
+// calls and stops the iteration, the errors are then returned as KeyErrors,
+// ordered like the keys were returned by SCAN. Errors of the calls which were
+// interrupted by the cancellation are not reported. If ctx is canceled, its
+// error is returned.
+//
+// The guarantees of SCAN apply, fn may be called more than once for the same
+// key, and keys added or removed during the iteration may be missed.
+func ForEachKey(ctx context.Context, client *Client, pattern string, parallelism int, fn func(ctx context.Context, key string) error) error {
+	if client == nil {
+		client = DefaultClient
+	}
+
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type job struct {
+		index int
+		key   string
+	}
+
+	type jobError struct {
+		index int
+		err   *KeyError
+	}
+
+	var jobs = make(chan job)
+	var mutex sync.Mutex
+	var errs []jobError
+	var wg sync.WaitGroup
+
+	for i := 0; i != parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := fn(ctx, j.key); err != nil {
+					mutex.Lock()
+					errs = append(errs, jobError{index: j.index, err: &KeyError{Key: j.key, Err: err}})
+					mutex.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+
+	it := client.Scan(ctx, pattern, forEachKeyCount)
+
+scan:
+	for index, key := 0, ""; it.Next(&key); index++ {
+		select {
+		case jobs <- job{index: index, key: key}:
+		case <-ctx.Done():
+			break scan
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	scanErr := it.Close()
+
+	if err := parent.Err(); err != nil {
+		return err
+	}
+
+	// The parent context wasn't canceled, so cancellation errors are caused by
+	// the failure of other calls.
+	sort.Slice(errs, func(i, j int) bool { return errs[i].index < errs[j].index })
+	keyErrs := make(KeyErrors, 0, len(errs))
+
+	for _, e := range errs {
+		if !errors.Is(e.err.Err, context.Canceled) {
+			keyErrs = append(keyErrs, e.err)
+		}
+	}
+
+	if len(keyErrs) != 0 {
+		return keyErrs
+	}
+
+	return scanErr
+}
+
+// KeyError wraps an error that occurred while processing a key.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+// Error satisfies the error interface.
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("redis: %s: %s", e.Key, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// KeyErrors is returned by ForEachKey when processing some of the keys failed.
+type KeyErrors []*KeyError
+
+// Error satisfies the error interface.
+func (e KeyErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "redis: no errors"
+	case 1:
+		return e[0].Error()
+	default:
+		return fmt.Sprintf("%s (and %d other errors)", e[0], len(e)-1)
+	}
+}
@@ -0,0 +1,105 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestForEachKey(t *testing.T) {
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		switch {
+		case cmd == "CLIENT":
+			return ""
+		case cmd != "SCAN":
+			return "-ERR unknown command\r\n"
+		case args[0] == "0":
+			return "*2\r\n$2\r\n17\r\n*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"
+		default:
+			return "*2\r\n$1\r\n0\r\n*2\r\n$1\r\nd\r\n$1\r\ne\r\n"
+		}
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+
+	tests := []struct {
+		scenario string
+		function func(*testing.T)
+	}{
+		{
+			scenario: "the function is called with every key",
+			function: func(t *testing.T) {
+				var mutex sync.Mutex
+				var keys []string
+
+				err := redis.ForEachKey(context.Background(), cli, "*", 3, func(ctx context.Context, key string) error {
+					mutex.Lock()
+					keys = append(keys, key)
+					mutex.Unlock()
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				sort.Strings(keys)
+
+				if !reflect.DeepEqual(keys, []string{"a", "b", "c", "d", "e"}) {
+					t.Error("bad keys:", keys)
+				}
+			},
+		},
+		{
+			scenario: "errors are returned in the order of the keys and cancel the other calls",
+			function: func(t *testing.T) {
+				errFailed := errors.New("failed")
+
+				err := redis.ForEachKey(context.Background(), cli, "", 1, func(ctx context.Context, key string) error {
+					if key == "b" {
+						return errFailed
+					}
+					return ctx.Err()
+				})
+
+				var keyErrs redis.KeyErrors
+				if !errors.As(err, &keyErrs) {
+					t.Fatal("bad error:", err)
+				}
+
+				if len(keyErrs) != 1 || keyErrs[0].Key != "b" || !errors.Is(keyErrs[0], errFailed) {
+					t.Error("bad errors:", keyErrs)
+				}
+			},
+		},
+		{
+			scenario: "canceling the context returns its error",
+			function: func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+
+				err := redis.ForEachKey(ctx, cli, "", 2, func(ctx context.Context, key string) error {
+					cancel()
+					return ctx.Err()
+				})
+
+				if err != context.Canceled {
+					t.Error("bad error:", err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			testFunc(t)
+		})
+	}
+}
@@ -0,0 +1,440 @@
+package redis
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the maximum number of results retained by a CachedClient
+// when its Size field is zero.
+const DefaultCacheSize = 1024
+
+// A CachedClient wraps a Client to cache the results of read commands in
+// memory.
+//
+// Results are cached for the duration configured for the command in TTLs, and
+// the least recently used results are evicted when the cache grows over Size.
+// Commands that have no TTL are forwarded to the Client, and invalidate the
+// cached results of all their keys unless they are reads. The keys of commands
+// are found from the specification of the standard redis commands, at all
+// their positions, like the destination and sources of ZUNIONSTORE.
+//
+// Results of commands without keys, like DBSIZE, or whose keys can't be found,
+// like commands missing from the specification, depend on the whole data set
+// and are invalidated by every write. Writes without keys, like FLUSHALL, or
+// whose keys can't be found purge the cache.
+//
+// Only writes going through the CachedClient are observed, writes made by other
+// clients will be visible once the cached results expire.
+//
+// CachedClient values are safe for concurrent use by multiple goroutines.
+type CachedClient struct {
+	// Client is used to send commands that cannot be served from the cache.
+	// If nil, DefaultClient is used.
+	Client *Client
+
+	// TTLs maps command patterns to the duration for which results of matching
+	// commands are cached. Patterns are matched against upper-case command
+	// names using the syntax of path.Match, for example "GET" or "Z*SCORE".
+	TTLs map[string]time.Duration
+
+	// NegativeTTL is the duration for which nil results, like the result of
+	// GET on a missing key, are cached. Caching them protects servers from
+	// programs repeatedly looking up absent keys, which is a common load
+	// pattern, with a TTL shorter than the results of existing keys so new
+	// keys written by other clients are seen quickly. Nil results are
+	// invalidated by writes going through the CachedClient like any other.
+	//
+	// If zero, nil results are cached for the TTL of their command, and if
+	// negative they are not cached.
+	NegativeTTL time.Duration
+
+	// Size is the maximum number of results kept in the cache. If zero,
+	// DefaultCacheSize is used.
+	Size int
+
+	mutex     sync.Mutex
+	epoch     uint64
+	globalGen uint64
+	reads     map[string]*cacheReads
+	results   cacheStore
+}
+
+type cacheEntry struct {
+	id      string
+	keys    []string
+	global  bool
+	values  []interface{}
+	expires time.Time
+}
+
+// cacheReads tracks the reads in flight on a key, gen is incremented by the
+// writes on the key so the results read concurrently aren't cached. Keys are
+// only tracked while they have reads in flight.
+type cacheReads struct {
+	count int
+	gen   uint64
+}
+
+// cacheRead is a read in flight, with the generations of its keys when it
+// started. The epoch is incremented when the cache is purged, and the global
+// generation by all writes, for the reads which depend on the whole data set.
+type cacheRead struct {
+	keys      []string
+	gens      []uint64
+	global    bool
+	globalGen uint64
+	epoch     uint64
+}
+
+// Exec behaves like Client.Exec, but may be served from the cache.
+func (c *CachedClient) Exec(ctx context.Context, cmd string, args ...interface{}) error {
+	return ParseArgs(c.Query(ctx, cmd, args...), nil)
+}
+
+// Query behaves like Client.Query, but may be served from the cache.
+//
+// The returned Args are fully loaded in memory when cmd is cacheable.
+func (c *CachedClient) Query(ctx context.Context, cmd string, args ...interface{}) Args {
+	keys, ok := cacheKeys(cmd, args)
+	ttl := c.ttl(cmd)
+
+	if ttl <= 0 {
+		if ClassOf(cmd) == ClassRead {
+			return c.client().Query(ctx, cmd, args...)
+		}
+		invalidate := func() { c.Invalidate(keys...) }
+		if !ok || len(keys) == 0 {
+			invalidate = c.Purge
+		}
+		invalidate()
+		return &cacheWriteArgs{Args: c.client().Query(ctx, cmd, args...), invalidate: invalidate}
+	}
+
+	id := cacheID(cmd, args)
+	now := time.Now()
+
+	c.mutex.Lock()
+	values, found := c.results.lookup(id, now)
+	var read *cacheRead
+	if !found {
+		read = c.startRead(keys, !ok || len(keys) == 0)
+	}
+	c.mutex.Unlock()
+
+	if found {
+		return List(values...)
+	}
+
+	r := c.client().Query(ctx, cmd, args...)
+	values = make([]interface{}, 0, r.Len())
+
+	for {
+		var v interface{}
+		if !r.Next(&v) {
+			break
+		}
+		// Byte slices are converted to strings so the program cannot mutate
+		// the cached values through the Args returned by later queries.
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		values = append(values, v)
+	}
+
+	err := r.Close()
+	cache := err == nil
+
+	if isNilResult(values) {
+		switch {
+		case c.NegativeTTL < 0:
+			cache = false
+		case c.NegativeTTL > 0:
+			ttl = c.NegativeTTL
+		}
+	}
+
+	c.mutex.Lock()
+	// A write on the keys was observed while the command was in flight, the
+	// result may be stale and must not be cached.
+	if c.endRead(read) && cache {
+		c.results.store(&cacheEntry{
+			id:      id,
+			keys:    read.keys,
+			global:  read.global,
+			values:  values,
+			expires: now.Add(ttl),
+		}, c.size())
+	}
+	c.mutex.Unlock()
+
+	if err != nil {
+		return newArgsError(err)
+	}
+	return List(values...)
+}
+
+// startRead registers a read in flight on keys, global is true if the result
+// of the read depends on the whole data set. The mutex must be held.
+func (c *CachedClient) startRead(keys []string, global bool) *cacheRead {
+	read := &cacheRead{
+		keys:      keys,
+		gens:      make([]uint64, len(keys)),
+		global:    global,
+		globalGen: c.globalGen,
+		epoch:     c.epoch,
+	}
+
+	if c.reads == nil {
+		c.reads = make(map[string]*cacheReads)
+	}
+
+	for i, key := range keys {
+		r := c.reads[key]
+		if r == nil {
+			r = &cacheReads{}
+			c.reads[key] = r
+		}
+		r.count++
+		read.gens[i] = r.gen
+	}
+
+	return read
+}
+
+// endRead unregisters a read in flight, returning true if none of its keys
+// were written since it started. The mutex must be held.
+func (c *CachedClient) endRead(read *cacheRead) bool {
+	fresh := read.epoch == c.epoch
+
+	for i, key := range read.keys {
+		r := c.reads[key]
+		if r.gen != read.gens[i] {
+			fresh = false
+		}
+		if r.count--; r.count == 0 {
+			delete(c.reads, key)
+		}
+	}
+
+	if read.global && read.globalGen != c.globalGen {
+		fresh = false
+	}
+
+	return fresh
+}
+
+// Invalidate removes the cached results of commands issued on the given keys.
+// Results of commands depending on the whole data set are removed as well.
+func (c *CachedClient) Invalidate(keys ...string) {
+	c.mutex.Lock()
+
+	for _, key := range keys {
+		c.results.invalidate(key)
+		if r := c.reads[key]; r != nil {
+			r.gen++
+		}
+	}
+
+	c.results.invalidateGlobal()
+	c.globalGen++
+	c.mutex.Unlock()
+}
+
+// Purge removes all results from the cache.
+func (c *CachedClient) Purge() {
+	c.mutex.Lock()
+	c.epoch++
+	c.results.purge()
+	c.mutex.Unlock()
+}
+
+func (c *CachedClient) client() *Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return DefaultClient
+}
+
+func (c *CachedClient) ttl(cmd string) time.Duration {
+	cmd = strings.ToUpper(cmd)
+
+	if ttl, ok := c.TTLs[cmd]; ok {
+		return ttl
+	}
+
+	for pattern, ttl := range c.TTLs {
+		if match, _ := path.Match(pattern, cmd); match {
+			return ttl
+		}
+	}
+
+	return 0
+}
+
+func (c *CachedClient) size() int {
+	if c.Size > 0 {
+		return c.Size
+	}
+	return DefaultCacheSize
+}
+
+// cacheStore holds cached results, evicting the least recently used ones when
+// it grows over its size. The store isn't synchronized, its users must use a
+// mutex.
+type cacheStore struct {
+	lru     list.List
+	entries map[string]*list.Element
+	keys    map[string]map[string]struct{}
+	global  map[string]struct{}
+}
+
+// lookup returns the values of the entry identified by id, unless it expired.
+// Entries with a zero expiration time never expire.
+func (s *cacheStore) lookup(id string, now time.Time) ([]interface{}, bool) {
+	elem := s.entries[id]
+	if elem == nil {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+
+	if !entry.expires.IsZero() && now.After(entry.expires) {
+		s.remove(elem)
+		return nil, false
+	}
+
+	s.lru.MoveToFront(elem)
+	return entry.values, true
+}
+
+func (s *cacheStore) store(entry *cacheEntry, size int) {
+	if s.entries == nil {
+		s.entries = make(map[string]*list.Element)
+		s.keys = make(map[string]map[string]struct{})
+		s.global = make(map[string]struct{})
+	}
+
+	if elem := s.entries[entry.id]; elem != nil {
+		s.remove(elem)
+	}
+
+	for _, key := range entry.keys {
+		ids := s.keys[key]
+		if ids == nil {
+			ids = make(map[string]struct{})
+			s.keys[key] = ids
+		}
+		ids[entry.id] = struct{}{}
+	}
+
+	if entry.global {
+		s.global[entry.id] = struct{}{}
+	}
+
+	s.entries[entry.id] = s.lru.PushFront(entry)
+
+	for s.lru.Len() > size {
+		s.remove(s.lru.Back())
+	}
+}
+
+// invalidate removes the entries of commands issued on key.
+func (s *cacheStore) invalidate(key string) {
+	for id := range s.keys[key] {
+		s.remove(s.entries[id])
+	}
+}
+
+// invalidateGlobal removes the entries of commands depending on the whole data
+// set.
+func (s *cacheStore) invalidateGlobal() {
+	for id := range s.global {
+		s.remove(s.entries[id])
+	}
+}
+
+func (s *cacheStore) purge() {
+	s.lru.Init()
+	s.entries = nil
+	s.keys = nil
+	s.global = nil
+}
+
+func (s *cacheStore) remove(elem *list.Element) {
+	entry := s.lru.Remove(elem).(*cacheEntry)
+	delete(s.entries, entry.id)
+	delete(s.global, entry.id)
+
+	for _, key := range entry.keys {
+		if ids := s.keys[key]; ids != nil {
+			if delete(ids, entry.id); len(ids) == 0 {
+				delete(s.keys, key)
+			}
+		}
+	}
+}
+
+// cacheWriteArgs invalidates the keys of a write command a second time once
+// its response was received, in case a read cached a result concurrently.
+type cacheWriteArgs struct {
+	Args
+	invalidate func()
+}
+
+func (args *cacheWriteArgs) Close() error {
+	err := args.Args.Close()
+	args.invalidate()
+	return err
+}
+
+func isNilResult(values []interface{}) bool {
+	return len(values) == 1 && values[0] == nil
+}
+
+// cacheKeys returns the keys of a command, ok is false if they can't be found.
+func cacheKeys(cmd string, args []interface{}) (keys []string, ok bool) {
+	b := make([][]byte, len(args))
+	for i, arg := range args {
+		b[i] = []byte(cacheString(arg))
+	}
+
+	k, ok := commandKeys(cmd, b)
+	if !ok {
+		return nil, false
+	}
+
+	keys = make([]string, len(k))
+	for i := range k {
+		keys[i] = string(k[i])
+	}
+	return keys, true
+}
+
+func cacheID(cmd string, args []interface{}) string {
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(cmd))
+
+	for _, arg := range args {
+		b.WriteByte(0)
+		b.WriteString(cacheString(arg))
+	}
+
+	return b.String()
+}
+
+func cacheString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	default:
+		return fmt.Sprint(x)
+	}
+}
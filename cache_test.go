@@ -0,0 +1,278 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestCachedClient(t *testing.T) {
+	var reads int32
+	var mutex sync.Mutex
+	var store = map[string]string{}
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		cmd := req.Cmds[0]
+		key, val := "", ""
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch cmd.Cmd {
+		case "GET":
+			atomic.AddInt32(&reads, 1)
+			cmd.ParseArgs(&key)
+			res.Write(store[key])
+		case "SET":
+			cmd.ParseArgs(&key, &val)
+			store[key] = val
+			res.Write("OK")
+		case "MSET":
+			for cmd.Args.Next(&key) && cmd.Args.Next(&val) {
+				store[key] = val
+			}
+			res.Write("OK")
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	ctx := context.Background()
+	cli := &redis.CachedClient{
+		Client: &redis.Client{Addr: url, Transport: tr},
+		TTLs:   map[string]time.Duration{"GET": 10 * time.Millisecond},
+	}
+
+	get := func(key string) string {
+		s, err := redis.String(cli.Query(ctx, "GET", key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	if err := cli.Exec(ctx, "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i != 3; i++ {
+		if s := get("hello"); s != "world" {
+			t.Error("bad value:", s)
+		}
+	}
+
+	if n := atomic.LoadInt32(&reads); n != 1 {
+		t.Error("bad number of reads after caching a result:", n)
+	}
+
+	if err := cli.Exec(ctx, "SET", "hello", "redis"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := get("hello"); s != "redis" {
+		t.Error("bad value after a write:", s)
+	}
+
+	if n := atomic.LoadInt32(&reads); n != 2 {
+		t.Error("bad number of reads after a write:", n)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	get("hello")
+
+	if n := atomic.LoadInt32(&reads); n != 3 {
+		t.Error("bad number of reads after expiration:", n)
+	}
+
+	// Writes invalidate all their keys, not only their first argument.
+	get("other")
+
+	if err := cli.Exec(ctx, "MSET", "hello", "1", "other", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := get("other"); s != "2" {
+		t.Error("bad value after a write on multiple keys:", s)
+	}
+}
+
+func TestCachedClientNegativeTTL(t *testing.T) {
+	var reads int32
+	var mutex sync.Mutex
+	var store = map[string]string{}
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		cmd := req.Cmds[0]
+		key, val := "", ""
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch cmd.Cmd {
+		case "GET":
+			atomic.AddInt32(&reads, 1)
+			cmd.ParseArgs(&key)
+			if v, ok := store[key]; ok {
+				res.Write(v)
+			} else {
+				res.Write(nil)
+			}
+		case "SET":
+			cmd.ParseArgs(&key, &val)
+			store[key] = val
+			res.Write("OK")
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	ctx := context.Background()
+	get := func(cli *redis.CachedClient, key string) (value string, found bool) {
+		var p *string
+		if err := redis.ParseArgs(cli.Query(ctx, "GET", key), &p); err != nil {
+			t.Fatal(err)
+		}
+		if p != nil {
+			value, found = *p, true
+		}
+		return
+	}
+
+	t.Run("nil results are cached for the negative TTL", func(t *testing.T) {
+		atomic.StoreInt32(&reads, 0)
+		cli := &redis.CachedClient{
+			Client:      &redis.Client{Addr: url, Transport: tr},
+			TTLs:        map[string]time.Duration{"GET": time.Hour},
+			NegativeTTL: 10 * time.Millisecond,
+		}
+
+		for i := 0; i != 3; i++ {
+			if _, found := get(cli, "A"); found {
+				t.Fatal("the key must not exist")
+			}
+		}
+
+		if n := atomic.LoadInt32(&reads); n != 1 {
+			t.Error("bad number of reads after caching a nil result:", n)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		get(cli, "A")
+
+		if n := atomic.LoadInt32(&reads); n != 2 {
+			t.Error("bad number of reads after expiration:", n)
+		}
+
+		if err := cli.Exec(ctx, "SET", "A", "1"); err != nil {
+			t.Fatal(err)
+		}
+
+		if v, found := get(cli, "A"); !found || v != "1" {
+			t.Error("bad value after a write:", v, found)
+		}
+	})
+
+	t.Run("nil results are not cached when the negative TTL is negative", func(t *testing.T) {
+		atomic.StoreInt32(&reads, 0)
+		cli := &redis.CachedClient{
+			Client:      &redis.Client{Addr: url, Transport: tr},
+			TTLs:        map[string]time.Duration{"GET": time.Hour},
+			NegativeTTL: -1,
+		}
+
+		for i := 0; i != 3; i++ {
+			get(cli, "B")
+		}
+
+		if n := atomic.LoadInt32(&reads); n != 3 {
+			t.Error("bad number of reads:", n)
+		}
+	})
+}
+
+func TestCachedClientConcurrentWrites(t *testing.T) {
+	var reads int32
+	var release = make(chan struct{})
+	var started = make(chan struct{}, 1)
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		switch req.Cmds[0].Cmd {
+		case "GET":
+			atomic.AddInt32(&reads, 1)
+			started <- struct{}{}
+			<-release
+			res.Write("value")
+		default:
+			res.Write("OK")
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	ctx := context.Background()
+	cli := &redis.CachedClient{
+		Client: &redis.Client{Addr: url, Transport: tr},
+		TTLs:   map[string]time.Duration{"GET": time.Hour},
+	}
+
+	read := func(key string) <-chan error {
+		done := make(chan error, 1)
+		go func() { done <- cli.Exec(ctx, "GET", key) }()
+		<-started
+		return done
+	}
+
+	t.Run("writes on other keys don't prevent caching reads in flight", func(t *testing.T) {
+		atomic.StoreInt32(&reads, 0)
+		done := read("a")
+
+		if err := cli.Exec(ctx, "SET", "b", "value"); err != nil {
+			t.Fatal(err)
+		}
+
+		release <- struct{}{}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+
+		if err := cli.Exec(ctx, "GET", "a"); err != nil {
+			t.Fatal(err)
+		}
+		if n := atomic.LoadInt32(&reads); n != 1 {
+			t.Error("the result was not cached:", n)
+		}
+	})
+
+	t.Run("writes on the key prevent caching reads in flight", func(t *testing.T) {
+		atomic.StoreInt32(&reads, 0)
+		done := read("c")
+
+		if err := cli.Exec(ctx, "SET", "c", "value"); err != nil {
+			t.Fatal(err)
+		}
+
+		release <- struct{}{}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+
+		done = read("c")
+		release <- struct{}{}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if n := atomic.LoadInt32(&reads); n != 2 {
+			t.Error("the stale result was cached:", n)
+		}
+	})
+}
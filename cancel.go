@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Canceling the context of a request while its response is being read has the
+// following semantics:
+//
+//   - commands which were not sent yet are dropped, the request fails with the
+//     context error,
+//   - responses which were sent but not read yet are either drained, when other
+//     requests are pipelined after them on the same connection, or the
+//     connection is discarded,
+//   - the Close method of the response arguments (and of each argument list of
+//     transactions) reports the context error.
+//
+// cancelWatcher implements the interruption of reads, it sets a read deadline
+// in the past on the connection when the context is canceled, which makes any
+// blocking read return immediately.
+type cancelWatcher struct {
+	ctx      context.Context
+	stop     chan struct{}
+	once     sync.Once
+	mutex    sync.Mutex
+	stopped  bool
+	canceled bool
+}
+
+// watchCancel starts watching ctx and interrupts reads on conn when it gets
+// canceled. The function returns nil if ctx can never be canceled.
+func watchCancel(ctx context.Context, conn *Conn) *cancelWatcher {
+	if ctx == nil || ctx.Done() == nil {
+		return nil
+	}
+
+	w := &cancelWatcher{ctx: ctx, stop: make(chan struct{})}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			// The watcher may have been stopped concurrently, in which case the
+			// connection may already be reading the response of another
+			// request and must not be interrupted.
+			w.mutex.Lock()
+			if !w.stopped {
+				w.canceled = true
+				conn.SetReadDeadline(time.Unix(1, 0))
+			}
+			w.mutex.Unlock()
+		case <-w.stop:
+		}
+	}()
+
+	return w
+}
+
+// close stops the watcher, if the context was canceled while reading the
+// response the context error is returned in place of err.
+func (w *cancelWatcher) close(err error) error {
+	if w == nil {
+		return err
+	}
+
+	w.once.Do(func() { close(w.stop) })
+
+	w.mutex.Lock()
+	w.stopped = true
+	canceled := w.canceled
+	w.mutex.Unlock()
+
+	if canceled {
+		return w.ctx.Err()
+	}
+
+	return err
+}
+
+// cancelArgs cancels the context of a request when its response is closed.
+type cancelArgs struct {
+	Args
+	cancel context.CancelFunc
+}
+
+func (a *cancelArgs) Close() error {
+	err := a.Args.Close()
+	a.cancel()
+	return err
+}
+
+func (a *cancelArgs) NextType() Type {
+	return NextType(a.Args)
+}
+
+type cancelTxArgs struct {
+	TxArgs
+	cancel context.CancelFunc
+}
+
+func (a *cancelTxArgs) Close() error {
+	err := a.TxArgs.Close()
+	a.cancel()
+	return err
+}
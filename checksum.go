@@ -0,0 +1,126 @@
+package redis
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+)
+
+// ErrChecksumMismatch is returned by reads on connections with checksums
+// enabled when the data received doesn't match its checksum.
+var ErrChecksumMismatch = errors.New("redis: checksum mismatch, the data was corrupted in transit")
+
+// checksumAlgorithm is the only algorithm supported by the checksums
+// negotiated between clients and servers of this package.
+const checksumAlgorithm = "crc32c"
+
+const (
+	// checksumFrameHeaderSize is the size of the header of frames, made of
+	// the length of the payload and its checksum.
+	checksumFrameHeaderSize = 8
+
+	// checksumMaxFrameSize is the maximum size of the payload of frames,
+	// larger writes are split into multiple frames.
+	checksumMaxFrameSize = 65536
+)
+
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum switches c to exchanging data in checksummed frames. It must only
+// be called when no data is buffered.
+func (c *Conn) checksum() {
+	c.conn = newChecksumConn(c.conn)
+	c.rbuffer.Reset(c.conn)
+	c.wbuffer.Reset(c.conn)
+}
+
+// checksumConn is a net.Conn which exchanges data in frames made of a header,
+// carrying the length and the CRC-32C of the payload, followed by the payload.
+// Frames are validated before any of their data is returned by Read.
+//
+// Read errors, including timeouts, are not recoverable.
+type checksumConn struct {
+	net.Conn
+	rbuf   []byte
+	rframe []byte
+	wbuf   []byte
+	err    error
+}
+
+func newChecksumConn(c net.Conn) *checksumConn {
+	return &checksumConn{Conn: c}
+}
+
+func (c *checksumConn) Read(b []byte) (int, error) {
+	for len(c.rframe) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.rframe, c.err = c.readFrame()
+	}
+
+	n := copy(b, c.rframe)
+	c.rframe = c.rframe[n:]
+	return n, nil
+}
+
+func (c *checksumConn) readFrame() ([]byte, error) {
+	var header [checksumFrameHeaderSize]byte
+
+	if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:4])
+	sum := binary.BigEndian.Uint32(header[4:])
+
+	if size > checksumMaxFrameSize {
+		return nil, ErrChecksumMismatch
+	}
+
+	if cap(c.rbuf) < int(size) {
+		c.rbuf = make([]byte, size)
+	}
+
+	frame := c.rbuf[:size]
+
+	if _, err := io.ReadFull(c.Conn, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	if crc32.Checksum(frame, checksumTable) != sum {
+		return nil, ErrChecksumMismatch
+	}
+
+	return frame, nil
+}
+
+func (c *checksumConn) Write(b []byte) (int, error) {
+	n := 0
+
+	for len(b) != 0 {
+		chunk := b
+		if len(chunk) > checksumMaxFrameSize {
+			chunk = chunk[:checksumMaxFrameSize]
+		}
+
+		c.wbuf = append(c.wbuf[:0], make([]byte, checksumFrameHeaderSize)...)
+		binary.BigEndian.PutUint32(c.wbuf[:4], uint32(len(chunk)))
+		binary.BigEndian.PutUint32(c.wbuf[4:], crc32.Checksum(chunk, checksumTable))
+		c.wbuf = append(c.wbuf, chunk...)
+
+		if _, err := c.Conn.Write(c.wbuf); err != nil {
+			return n, err
+		}
+
+		n += len(chunk)
+		b = b[len(chunk):]
+	}
+
+	return n, nil
+}
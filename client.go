@@ -2,7 +2,9 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -11,7 +13,9 @@ import (
 //
 // The Client's Transport typically has internal state (cached TCP connections),
 // so Clients should be reused instead of created as needed. Clients are safe
-// for concurrent use by multiple goroutines.
+// for concurrent use by multiple goroutines. Programs creating clients which
+// are not needed for the lifetime of the process should call Close when they
+// are done using them.
 type Client struct {
 	// Addr is the server address used by the client's Exec or Query methods
 	// are called.
@@ -28,8 +32,54 @@ type Client struct {
 	//
 	// A Timeout of zero means no timeout.
 	Timeout time.Duration
+
+	// Codec is used to encode struct values passed to Exec and Query, and to
+	// decode them back when the Args returned by Query are read into struct
+	// pointers. If nil, struct values are passed to the protocol encoder as-is.
+	Codec Codec
+
+	// Retries is the maximum number of times that Query and Exec retry a
+	// read-only command which failed to reach the server. Commands which may
+	// have side effects and transactions are never retried, nor are errors
+	// returned by the server.
+	Retries int
+
+	// RetryPolicy, if not nil, configures the retries of Query and Exec,
+	// taking precedence over Retries. Unlike Retries, the policy waits before
+	// retrying and also applies to errors returned by the server, like
+	// LOADING.
+	RetryPolicy *RetryPolicy
+
+	// RetryBudget limits the number of retries to a fraction of the requests
+	// made by the client, across all goroutines. If nil, the client uses a
+	// budget with the default settings.
+	RetryBudget *RetryBudget
+
+	// Hooks intercept the requests sent by the client, in order, see Hook.
+	Hooks []Hook
+
+	once   sync.Once
+	budget *RetryBudget
+
+	mutex   sync.Mutex
+	closed  bool
+	closers map[*clientCloser]struct{}
+	scripts map[string]struct{}
 }
 
+// clientCloser is a function registered to be called when a client is closed.
+type clientCloser struct {
+	close func() error
+}
+
+// ErrDefaultClientClose is returned when closing DefaultClient, which is shared
+// by all the programs of the process.
+var ErrDefaultClientClose = errors.New("redis: the default client can't be closed")
+
+// ErrClientClosed is returned when making requests with a client that was
+// closed.
+var ErrClientClosed = errors.New("redis: client closed")
+
 // Do sends an Redis request and returns an Redis response.
 //
 // An error is returned if the transport failed to contact the Redis server, or
@@ -46,25 +96,50 @@ type Client struct {
 //
 // Generally Exec or Query will be used instead of Do.
 func (c *Client) Do(req *Request) (*Response, error) {
-	transport := c.Transport
+	return c.do(req, c.Timeout)
+}
 
-	if transport == nil {
-		transport = DefaultTransport
+// do is like Do but bounds the request with timeout instead of the Timeout of
+// the client.
+func (c *Client) do(req *Request, timeout time.Duration) (*Response, error) {
+	if c.isClosed() {
+		req.Close()
+		return nil, ErrClientClosed
 	}
 
-	if c.Timeout != 0 {
-		var ctx = req.Context
-		var cancel context.CancelFunc
+	transport := c.transport()
+	if len(c.Hooks) != 0 {
+		transport = &hookTransport{transport: transport, hooks: c.Hooks}
+	}
 
-		if ctx == nil {
-			ctx = context.Background()
-		}
+	if timeout == 0 {
+		return transport.RoundTrip(req)
+	}
+
+	var ctx = req.Context
+	var cancel context.CancelFunc
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	req.Context, cancel = context.WithTimeout(ctx, timeout)
 
-		req.Context, cancel = context.WithTimeout(ctx, c.Timeout)
-		defer cancel()
+	// The timer must keep running until the response is closed, canceling the
+	// context when Do returns would interrupt reading the response.
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		cancel()
+		return res, err
+	}
+
+	if res.TxArgs != nil {
+		res.TxArgs = &cancelTxArgs{TxArgs: res.TxArgs, cancel: cancel}
+	} else {
+		res.Args = &cancelArgs{Args: res.Args, cancel: cancel}
 	}
 
-	return transport.RoundTrip(req)
+	return res, nil
 }
 
 // Exec issues a request with cmd and args to the Redis server at the address
@@ -79,6 +154,27 @@ func (c *Client) Exec(ctx context.Context, cmd string, args ...interface{}) erro
 	return ParseArgs(c.Query(ctx, cmd, args...), nil)
 }
 
+// ExecStatus is like Exec but returns the simple string reply of the command,
+// for example "OK". Nil replies (like the one of SET NX on an existing key) are
+// returned as an empty string.
+func (c *Client) ExecStatus(ctx context.Context, cmd string, args ...interface{}) (string, error) {
+	var s *string
+
+	if err := ParseArgs(c.Query(ctx, cmd, args...), &s); err != nil || s == nil {
+		return "", err
+	}
+
+	return *s, nil
+}
+
+// ExecInt is like Exec but returns the integer reply of the command, for
+// example the number of keys removed by DEL. Nil replies are returned as zero.
+func (c *Client) ExecInt(ctx context.Context, cmd string, args ...interface{}) (int64, error) {
+	var i int64
+	err := ParseArgs(c.Query(ctx, cmd, args...), &i)
+	return i, err
+}
+
 // MultiExec issues a transaction composed of the given list of commands.
 //
 // An error is returned if the request couldn't be sent or if the command was
@@ -104,13 +200,51 @@ func (c *Client) Query(ctx context.Context, cmd string, args ...interface{}) Arg
 		addr = "localhost:6379"
 	}
 
-	r, err := c.Do(&Request{
-		Addr:    addr,
-		Cmds:    []Command{{cmd, List(args...)}},
-		Context: ctx,
-	})
-	if err != nil {
-		return newArgsError(err)
+	if c.Codec != nil {
+		var err error
+		if args, err = encodeValues(c.Codec, args); err != nil {
+			return newArgsError(err)
+		}
+	}
+
+	policy := c.RetryPolicy
+	retries := c.Retries
+
+	if policy != nil {
+		retries = policy.maxAttempts() - 1
+	}
+
+	if retries > 0 {
+		c.retryBudget().Deposit()
+	}
+
+	var r *Response
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		r, err = c.Do(&Request{
+			Addr:    addr,
+			Cmds:    []Command{{cmd, List(args...)}},
+			Context: ctx,
+		})
+		if err == nil && policy != nil && NextType(r.Args) == TypeError {
+			// The error returned by the server has to be read to figure out
+			// whether the command can be retried.
+			err = r.Args.Close()
+		}
+		if err == nil {
+			break
+		}
+		if attempt == retries || !c.retryable(ctx, cmd, err) {
+			return newArgsError(err)
+		}
+		if policy != nil && !policy.wait(ctx, attempt) {
+			return newArgsError(err)
+		}
+	}
+
+	if c.Codec != nil {
+		return &codecArgs{Args: r.Args, codec: c.Codec}
 	}
 
 	return r.Args
@@ -158,7 +292,249 @@ func (c *Client) MultiQuery(ctx context.Context, cmds ...Command) TxArgs {
 	return r.TxArgs
 }
 
-// DefaultClient is the default client and is used by Exec and Query.
+// Pipeline sends the given list of commands to the Redis server at the address
+// set on the client in a single write, returning the response's TxArgs (which
+// is never nil). The argument lists produced by the TxArgs are the responses
+// to each command, in the order they were passed to the method.
+//
+// Unlike MultiQuery, the commands don't run as a transaction: commands of
+// other clients may run in between, and errors returned by the server for
+// one command don't prevent the others from running. It is an error to put
+// MULTI, EXEC, or DISCARD in the command list.
+//
+// Errors returned by the server for a command are reported by the Close method
+// of its argument list, the TxArgs.Close method reports the errors of the
+// argument lists which were not consumed.
+//
+// The context passed as first argument allows the operation to be canceled
+// asynchronously.
+func (c *Client) Pipeline(ctx context.Context, cmds ...Command) TxArgs {
+	addr := c.Addr
+	if len(addr) == 0 {
+		addr = "localhost:6379"
+	}
+
+	for _, cmd := range cmds {
+		switch cmd.Cmd {
+		case "MULTI", "EXEC", "DISCARD":
+			return newTxArgsError(fmt.Errorf("commands passed to redis.(*Client).Pipeline cannot contain MULTI, EXEC, or DISCARD"))
+		}
+	}
+
+	if len(cmds) == 0 {
+		return newTxArgsError(nil)
+	}
+
+	r, err := c.Do(&Request{
+		Addr:    addr,
+		Cmds:    cmds,
+		Context: ctx,
+	})
+	if err != nil {
+		return newTxArgsError(err)
+	}
+
+	if r.TxArgs == nil {
+		// Requests with a single command are not pipelines, the response has
+		// a single argument list.
+		return &singleTxArgs{args: r.Args}
+	}
+
+	return r.TxArgs
+}
+
+func (c *Client) retryable(ctx context.Context, cmd string, err error) bool {
+	if p := c.RetryPolicy; p != nil {
+		if !p.retryable(cmd, err) {
+			return false
+		}
+	} else {
+		if ClassOf(cmd) != ClassRead {
+			return false
+		}
+		switch ErrorClass(err) {
+		case ErrClassUnknown, ErrClassTimeout, ErrClassConnRefused, ErrClassProtocol, ErrClassServerClosed:
+		default:
+			return false
+		}
+	}
+	if ctx != nil && ctx.Err() != nil {
+		return false
+	}
+	return c.retryBudget().Withdraw()
+}
+
+func (c *Client) retryBudget() *RetryBudget {
+	if c.RetryBudget != nil {
+		return c.RetryBudget
+	}
+	c.once.Do(func() { c.budget = &RetryBudget{} })
+	return c.budget
+}
+
+// CloseIdleConnections closes the idle connections of the client's transport,
+// if it supports it.
+func (c *Client) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if t, ok := c.transport().(closeIdler); ok {
+		t.CloseIdleConnections()
+	}
+}
+
+// Close releases the resources held by the client: the subscriptions opened
+// with Subscribe and PSubscribe which are still open, the connections of the
+// tracking clients using it, and the scripts that it loaded in the script
+// cache of its transport. After Close returned, requests made with the client
+// fail with ErrClientClosed.
+//
+// The client's transport is not closed since it may be shared with other
+// clients, programs owning the transport should call its Shutdown method. The
+// same goes for the topology watchers of transports and registries, like
+// Sentinel and DiscoveryRegistry, which are stopped by their own Close method.
+// Closing DefaultClient fails with ErrDefaultClientClose.
+//
+// The method returns the first error reported while releasing resources,
+// calling it more than once has no effect and returns nil.
+func (c *Client) Close() error {
+	if c == DefaultClient {
+		return ErrDefaultClientClose
+	}
+
+	c.mutex.Lock()
+	closers, scripts := c.closers, c.scripts
+	c.closers, c.scripts, c.closed = nil, nil, true
+	c.mutex.Unlock()
+
+	if cache := scriptCacheOf(c); cache != nil {
+		for hash := range scripts {
+			cache.remove(clientAddr(c), hash)
+		}
+	}
+
+	var err error
+
+	for closer := range closers {
+		if e := closer.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// onClose registers a function to be called when the client is closed, it
+// returns ErrClientClosed if the client was already closed. The returned
+// function unregisters f, it must be called when the resource that f releases
+// was released otherwise.
+func (c *Client) onClose(f func() error) (func(), error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+
+	closer := &clientCloser{close: f}
+
+	if c.closers == nil {
+		c.closers = make(map[*clientCloser]struct{})
+	}
+	c.closers[closer] = struct{}{}
+
+	return func() {
+		c.mutex.Lock()
+		delete(c.closers, closer)
+		c.mutex.Unlock()
+	}, nil
+}
+
+// loadedScript records that the script of the given hash was loaded through
+// the client, so it's removed from the script cache when the client is closed.
+func (c *Client) loadedScript(hash string) {
+	c.mutex.Lock()
+	if !c.closed && c != DefaultClient {
+		if c.scripts == nil {
+			c.scripts = make(map[string]struct{})
+		}
+		c.scripts[hash] = struct{}{}
+	}
+	c.mutex.Unlock()
+}
+
+// Subscribe opens a connection to the server that the client sends requests to,
+// subscribed to the given channels. The subscription is closed when the client
+// is, if it wasn't closed before. The transport of the client must be a
+// Transport, or support subscriptions with the same Subscribe method.
+func (c *Client) Subscribe(ctx context.Context, channels ...string) (*SubConn, error) {
+	return c.sub(ctx, false, channels)
+}
+
+// PSubscribe is like Subscribe but subscribes to patterns of channels.
+func (c *Client) PSubscribe(ctx context.Context, patterns ...string) (*SubConn, error) {
+	return c.sub(ctx, true, patterns)
+}
+
+func (c *Client) sub(ctx context.Context, patterns bool, channels []string) (*SubConn, error) {
+	type subscriber interface {
+		Subscribe(ctx context.Context, network string, address string, channels ...string) (*SubConn, error)
+		PSubscribe(ctx context.Context, network string, address string, patterns ...string) (*SubConn, error)
+	}
+
+	t, ok := c.transport().(subscriber)
+	if !ok {
+		return nil, errors.New("redis: the transport of the client doesn't support subscriptions")
+	}
+
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+
+	network, address := splitNetworkAddress(clientAddr(c))
+
+	var sub *SubConn
+	var err error
+
+	if patterns {
+		sub, err = t.PSubscribe(ctx, network, address, channels...)
+	} else {
+		sub, err = t.Subscribe(ctx, network, address, channels...)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c == DefaultClient {
+		return sub, nil
+	}
+
+	unregister, err := c.onClose(sub.Close)
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	sub.release = unregister
+	return sub, nil
+}
+
+func (c *Client) isClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
+}
+
+func (c *Client) transport() RoundTripper {
+	if c.Transport != nil {
+		return c.Transport
+	}
+	return DefaultTransport
+}
+
+// DefaultClient is the default client and is used by Exec and Query. It uses
+// DefaultTransport and connects to a redis server on localhost:6379.
 var DefaultClient = &Client{}
 
 // Exec is a wrapper around DefaultClient.Exec.
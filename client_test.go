@@ -2,8 +2,11 @@ package redis_test
 
 import (
 	"context"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/segmentio/objconv/resp"
 	redis "github.com/segmentio/redis-go"
 	"github.com/segmentio/redis-go/redistest"
 )
@@ -26,3 +29,262 @@ func (tc *testClient) Subscribe(ctx context.Context, channels ...string) (*redis
 func (tc *testClient) PSubscribe(ctx context.Context, patterns ...string) (*redis.SubConn, error) {
 	return tc.Transport.(*redis.Transport).PSubscribe(ctx, "tcp", tc.Addr, patterns...)
 }
+
+func TestClientDefaultTransport(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	rec := &correlationRecorder{RoundTripper: tr}
+
+	defaultTransport := redis.DefaultTransport
+	redis.DefaultTransport = rec
+	defer func() { redis.DefaultTransport = defaultTransport }()
+
+	cli := &redis.Client{Addr: url}
+
+	if err := cli.Exec(context.Background(), "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.ids) != 1 {
+		t.Error("clients without a transport must use DefaultTransport")
+	}
+}
+
+func TestClientExecReplies(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		switch req.Cmds[0].Cmd {
+		case "SET":
+			var key, value string
+			req.Cmds[0].ParseArgs(&key, &value)
+			if key == "exists" {
+				res.Write(nil)
+			} else {
+				res.Write("OK")
+			}
+		case "DEL":
+			res.Write(2)
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+	ctx := context.Background()
+
+	if s, err := cli.ExecStatus(ctx, "SET", "missing", "value", "NX"); err != nil {
+		t.Error(err)
+	} else if s != "OK" {
+		t.Errorf("bad status: %q", s)
+	}
+
+	if s, err := cli.ExecStatus(ctx, "SET", "exists", "value", "NX"); err != nil {
+		t.Error(err)
+	} else if s != "" {
+		t.Errorf("bad status for a nil reply: %q", s)
+	}
+
+	if n, err := cli.ExecInt(ctx, "DEL", "A", "B"); err != nil {
+		t.Error(err)
+	} else if n != 2 {
+		t.Error("bad integer:", n)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	cmds := make(chan string, 10)
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		cmds <- req.Cmds[0].Cmd
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+	ctx := context.Background()
+
+	if err := cli.Exec(ctx, "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	script := redis.NewScript("return 1")
+
+	if err := script.Load(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err := cli.Close(); err != nil {
+		t.Error("closing a client twice should not fail:", err)
+	}
+
+	if err := cli.Exec(ctx, "SET", "hello", "world"); err != redis.ErrClientClosed {
+		t.Error("bad error:", err)
+	}
+
+	// The transport is not closed with the client, but the scripts loaded
+	// by the client are removed from its cache and loaded again.
+	other := &redis.Client{Addr: url, Transport: tr}
+
+	if err := script.Exec(ctx, other, nil); err != nil {
+		t.Error(err)
+	}
+
+	close(cmds)
+	var found []string
+	for cmd := range cmds {
+		found = append(found, cmd)
+	}
+
+	if expect := []string{"SET", "SCRIPT", "SCRIPT", "EVALSHA"}; !reflect.DeepEqual(found, expect) {
+		t.Errorf("bad commands: %q != %q", found, expect)
+	}
+}
+
+func TestClientCloseSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	broker := &redis.Broker{}
+	mux := redis.NewServeMux()
+	broker.HandlePubSub(mux)
+
+	srv, url := newServer(mux)
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	sub, err := cli.Subscribe(ctx, "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Subscriptions closed before the client are forgotten by the client.
+	closed, err := cli.PSubscribe(ctx, "B*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	waitFor(t, ctx, func() bool { return broker.NumSub("A")[0] == 1 && broker.NumPat() == 0 })
+
+	if err := cli.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if _, _, err := sub.ReadMessage(); err == nil {
+		t.Error("the subscriptions of the client must be closed with it")
+	}
+
+	if _, err := cli.Subscribe(ctx, "A"); err != redis.ErrClientClosed {
+		t.Error("bad error subscribing with a closed client:", err)
+	}
+
+	if err := redis.DefaultClient.Close(); err != redis.ErrDefaultClientClose {
+		t.Error("bad error closing the default client:", err)
+	}
+}
+
+func TestClientPipeline(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var key string
+		req.Cmds[0].ParseArgs(&key)
+
+		switch req.Cmds[0].Cmd {
+		case "GET":
+			res.Write(key)
+		default:
+			res.Write(resp.NewError("ERR unknown command '" + req.Cmds[0].Cmd + "'"))
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+	ctx := context.Background()
+
+	t.Run("responses are produced in the order of the commands", func(t *testing.T) {
+		tx := cli.Pipeline(ctx,
+			redis.Command{Cmd: "GET", Args: redis.List("A")},
+			redis.Command{Cmd: "WHATEVER", Args: redis.List("B")},
+			redis.Command{Cmd: "GET", Args: redis.List("C")},
+		)
+
+		if n := tx.Len(); n != 3 {
+			t.Error("bad number of responses:", n)
+		}
+
+		var value string
+
+		if err := redis.ParseArgs(tx.Next(), &value); err != nil || value != "A" {
+			t.Errorf("bad first response: %q %v", value, err)
+		}
+
+		if err := redis.ParseArgs(tx.Next(), &value); err == nil {
+			t.Error("expected an error for the second response")
+		}
+
+		if err := redis.ParseArgs(tx.Next(), &value); err != nil || value != "C" {
+			t.Errorf("bad third response: %q %v", value, err)
+		}
+
+		if err := tx.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("closing a pipeline discards the responses which were not read", func(t *testing.T) {
+		for i := 0; i != 3; i++ {
+			tx := cli.Pipeline(ctx,
+				redis.Command{Cmd: "GET", Args: redis.List("A")},
+				redis.Command{Cmd: "WHATEVER", Args: redis.List("B")},
+			)
+
+			if err := tx.Close(); err == nil {
+				t.Fatal("the error of the second command must be reported when closing the pipeline")
+			}
+		}
+
+		var value string
+
+		if err := redis.ParseArgs(cli.Query(ctx, "GET", "D"), &value); err != nil || value != "D" {
+			t.Errorf("bad response after closing pipelines: %q %v", value, err)
+		}
+	})
+
+	t.Run("pipelines of a single command produce a single response", func(t *testing.T) {
+		tx := cli.Pipeline(ctx, redis.Command{Cmd: "GET", Args: redis.List("E")})
+
+		var value string
+
+		if err := redis.ParseArgs(tx.Next(), &value); err != nil || value != "E" {
+			t.Errorf("bad response: %q %v", value, err)
+		}
+
+		if args := tx.Next(); args != nil {
+			t.Error("unexpected response")
+		}
+
+		if err := tx.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultClientName is a client name template which produces names made of
+// the program name, host name, process id, and version of this package, for
+// example "myservice.host-1.4242.redis-go-v1.2.3".
+//
+// It can be assigned to the ClientName field of a Transport to get actionable
+// output from the CLIENT LIST command on the servers it connects to.
+const DefaultClientName = "${program}.${host}.${pid}.redis-go-${version}"
+
+// expandClientName expands the variables of a client name template.
+//
+// The supported variables are ${program}, ${host}, ${pid}, and ${version}, any
+// other variable is expanded from the environment. Redis only allows the
+// printable characters of ASCII other than space in client names, and fails
+// CLIENT SETNAME otherwise, so the other characters are replaced with dashes.
+func expandClientName(template string) string {
+	vars := clientNameVars()
+
+	name := os.Expand(template, func(key string) string {
+		if v, ok := vars[key]; ok {
+			return v
+		}
+		return os.Getenv(key)
+	})
+
+	return strings.Map(func(r rune) rune {
+		if r < '!' || r > '~' {
+			return '-'
+		}
+		return r
+	}, name)
+}
+
+var (
+	clientNameOnce sync.Once
+	clientNameMap  map[string]string
+)
+
+func clientNameVars() map[string]string {
+	clientNameOnce.Do(func() {
+		host, _ := os.Hostname()
+		if len(host) == 0 {
+			host = "localhost"
+		}
+		clientNameMap = map[string]string{
+			"program": filepath.Base(os.Args[0]),
+			"host":    host,
+			"pid":     strconv.Itoa(os.Getpid()),
+			"version": libraryVersion(),
+		}
+	})
+	return clientNameMap
+}
+
+// libraryVersion returns the version of this package as recorded in the build
+// information of the program, or "devel" if it could not be determined.
+func libraryVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/segmentio/redis-go" {
+				if dep.Replace != nil {
+					dep = dep.Replace
+				}
+				if len(dep.Version) != 0 {
+					return dep.Version
+				}
+			}
+		}
+	}
+	return "devel"
+}
+
+// makeClientInfo returns the list of attributes reported with CLIENT SETINFO,
+// lib-name and lib-ver first, then the other attributes sorted by name.
+// Redis doesn't allow spaces in the values so they are replaced with dashes.
+func makeClientInfo(libName, libVersion string, attrs map[string]string) [][2]string {
+	if len(libName) == 0 {
+		libName = "redis-go"
+	}
+
+	if len(libVersion) == 0 {
+		libVersion = libraryVersion()
+	}
+
+	info := [][2]string{{"lib-name", libName}, {"lib-ver", libVersion}}
+	names := make([]string, 0, len(attrs))
+
+	for name := range attrs {
+		if name != "lib-name" && name != "lib-ver" {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		info = append(info, [2]string{name, attrs[name]})
+	}
+
+	for i := range info {
+		info[i][1] = strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+				return '-'
+			}
+			return r
+		}, info[i][1])
+	}
+
+	return info
+}
+
+// ClientAttributes returns the attributes that the client which sent a request
+// reported with CLIENT SETINFO, for example lib-name and lib-ver, or nil if
+// it reported none. ctx must be the context of a request received by a server
+// of this package. The returned map must not be modified.
+func ClientAttributes(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	info, _ := ctx.Value(clientAttributesKey{}).(map[string]string)
+	return info
+}
+
+type clientAttributesKey struct{}
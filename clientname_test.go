@@ -0,0 +1,25 @@
+package redis
+
+import "testing"
+
+func TestExpandClientName(t *testing.T) {
+	t.Setenv("CLIENT_NAME_TEST", "café\x1bbar")
+
+	tests := []struct {
+		template string
+		name     string
+	}{
+		{template: "service.host-1", name: "service.host-1"},
+		{template: "my service\t1\r\n", name: "my-service-1--"},
+		{template: "naïve", name: "na-ve"},
+		{template: "a\x7fb\x01c", name: "a-b-c"},
+		{template: "app.${CLIENT_NAME_TEST}", name: "app.caf--bar"},
+		{template: "~!{}", name: "~!{}"},
+	}
+
+	for _, test := range tests {
+		if name := expandClientName(test.template); name != test.name {
+			t.Errorf("expandClientName(%q) = %q, expected %q", test.template, name, test.name)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// clusterSlots is the number of hash slots of a redis cluster.
+const clusterSlots = 16384
+
+// DefaultMaxRedirects is the maximum number of MOVED or ASK redirections that
+// a ClusterTransport follows for a request when MaxRedirects is zero.
+const DefaultMaxRedirects = 5
+
+// A ClusterTransport is a RoundTripper which sends requests to the nodes of a
+// redis cluster, routing each request to the primary serving the hash slot of
+// its key.
+//
+// The map of slots to nodes is loaded with CLUSTER SLOTS from one of the seed
+// nodes on the first request, and reloaded by RefreshTopology; concurrent
+// reloads share a single CLUSTER SLOTS command. When a node responds with a
+// MOVED error, only the slot named by the error is updated. MOVED and ASK
+// redirections are followed transparently, up to MaxRedirects times per
+// request. To be able to send them again, the arguments of requests are loaded
+// in memory before being sent.
+//
+// The keys of commands are found from the specification of the standard redis
+// commands, requests are routed to the node serving the slot of their first
+// key. Commands whose keys can't be found are sent to the seed node and
+// follow its redirections. Transactions and pipelines are routed like their
+// first command with keys, their redirections are not followed.
+//
+// The transport can be used by a Client, in which case the address of the
+// client is used as seed node when Nodes is empty:
+//
+//	client := &redis.Client{
+//		Addr:      "10.0.0.1:7000",
+//		Transport: &redis.ClusterTransport{},
+//	}
+type ClusterTransport struct {
+	// Transport is used to send requests. If nil, DefaultTransport is used.
+	Transport RoundTripper
+
+	// Nodes is the list of addresses of the seed nodes that the map of slots
+	// is loaded from. If empty, the addresses of requests are used.
+	Nodes []string
+
+	// MaxRedirects is the maximum number of redirections followed for a
+	// request. If zero, DefaultMaxRedirects is used.
+	MaxRedirects int
+
+	mutex     sync.RWMutex
+	slots     []string // address of the primary of each slot, nil until loaded
+	stats     ClusterStats
+	reloading *clusterReload
+}
+
+// clusterReload is a reload of the map of slots in progress, done is closed
+// when it completes.
+type clusterReload struct {
+	done chan struct{}
+	err  error
+}
+
+// ClusterStats carries counters of the redirections observed by a
+// ClusterTransport.
+type ClusterStats struct {
+	// Moved is the number of MOVED errors returned by nodes.
+	Moved int64
+
+	// Ask is the number of ASK errors returned by nodes.
+	Ask int64
+
+	// Refreshes is the number of times the map of slots was loaded.
+	Refreshes int64
+}
+
+// RoundTrip satisfies the RoundTripper interface.
+func (t *ClusterTransport) RoundTrip(req *Request) (*Response, error) {
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cmds := make([]Command, len(req.Cmds))
+	copy(cmds, req.Cmds)
+
+	for i := range cmds {
+		cmds[i].loadByteArgs()
+	}
+
+	addr, err := t.lookup(ctx, req.Addr, clusterSlotOfCommands(cmds))
+	if err != nil {
+		req.Close()
+		return nil, err
+	}
+
+	if len(cmds) != 1 {
+		return t.send(req, addr, cmds)
+	}
+
+	asking := false
+
+	for redirects := 0; ; redirects++ {
+		c := copyByteArgs(cmds)
+		if asking {
+			c = append([]Command{{Cmd: "ASKING"}}, c...)
+		}
+
+		res, err := t.send(req, addr, c)
+		if err != nil {
+			return nil, err
+		}
+
+		if asking {
+			if res, err = askingResponse(req, res); err != nil {
+				return nil, err
+			}
+		}
+
+		if NextType(res.Args) != TypeError {
+			return res, nil
+		}
+
+		// The response is a single error, it has to be read to figure out
+		// whether it's a redirection, and replaced by an equivalent response
+		// if it is not.
+		err = res.Args.Close()
+
+		kind, slot, target, ok := parseRedirect(err)
+		if !ok || redirects == t.maxRedirects() {
+			return &Response{Args: newArgsError(err), Request: req}, nil
+		}
+
+		addr, asking = target, kind == "ASK"
+
+		if asking {
+			t.mutex.Lock()
+			t.stats.Ask++
+			t.mutex.Unlock()
+			continue
+		}
+
+		// Slots are moved one at a time when a cluster is resharded, each
+		// MOVED error updates the slot it names.
+		t.mutex.Lock()
+		t.stats.Moved++
+		if t.slots != nil {
+			t.slots[slot] = target
+		}
+		t.mutex.Unlock()
+	}
+}
+
+// RefreshTopology reloads the map of slots from one of the seed nodes, or from
+// one of the nodes of the cluster if no seed nodes were configured.
+//
+// The method satisfies the TopologyRefresher interface.
+func (t *ClusterTransport) RefreshTopology(ctx context.Context) error {
+	return t.reload(ctx, "")
+}
+
+// Stats returns the counters of redirections observed by the transport.
+func (t *ClusterTransport) Stats() ClusterStats {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.stats
+}
+
+// lookup returns the address of the node serving slot, loading the map of
+// slots from seed if it wasn't loaded yet. Requests without keys, for which
+// slot is negative, are sent to seed.
+func (t *ClusterTransport) lookup(ctx context.Context, seed string, slot int) (string, error) {
+	if slot < 0 {
+		return seed, nil
+	}
+
+	t.mutex.RLock()
+	loaded := t.slots != nil
+	t.mutex.RUnlock()
+
+	if !loaded {
+		if err := t.reload(ctx, seed); err != nil {
+			return "", err
+		}
+	}
+
+	t.mutex.RLock()
+	addr := t.slots[slot]
+	t.mutex.RUnlock()
+
+	if len(addr) == 0 {
+		// The slot isn't served by any node, the server that the request is
+		// sent to responds with an error.
+		addr = seed
+	}
+
+	return addr, nil
+}
+
+// reload loads the map of slots, or waits for the reload in progress and
+// returns its result. When seed is not empty the map is only loaded if it
+// wasn't yet.
+func (t *ClusterTransport) reload(ctx context.Context, seed string) error {
+	t.mutex.Lock()
+
+	if r := t.reloading; r != nil {
+		t.mutex.Unlock()
+		select {
+		case <-r.done:
+			return r.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if t.slots != nil && len(seed) != 0 {
+		// The map was loaded by another goroutine.
+		t.mutex.Unlock()
+		return nil
+	}
+
+	r := &clusterReload{done: make(chan struct{})}
+	t.reloading = r
+	t.mutex.Unlock()
+
+	r.err = t.load(ctx, seed)
+
+	t.mutex.Lock()
+	t.reloading = nil
+	t.mutex.Unlock()
+
+	close(r.done)
+	return r.err
+}
+
+func (t *ClusterTransport) load(ctx context.Context, seed string) error {
+	var err = errors.New("redis: no seed nodes to load the cluster slots from")
+
+	for _, addr := range t.seeds(seed) {
+		var slots []string
+
+		if slots, err = t.clusterSlots(ctx, addr); err == nil {
+			t.mutex.Lock()
+			t.slots = slots
+			t.stats.Refreshes++
+			t.mutex.Unlock()
+			return nil
+		}
+	}
+
+	return err
+}
+
+// seeds returns the addresses that the map of slots can be loaded from.
+func (t *ClusterTransport) seeds(seed string) []string {
+	if len(t.Nodes) != 0 {
+		return t.Nodes
+	}
+
+	var seeds []string
+	var known = map[string]bool{}
+
+	if len(seed) != 0 {
+		seeds, known[seed] = append(seeds, seed), true
+	}
+
+	t.mutex.RLock()
+	for _, addr := range t.slots {
+		if len(addr) != 0 && !known[addr] {
+			seeds, known[addr] = append(seeds, addr), true
+		}
+	}
+	t.mutex.RUnlock()
+
+	return seeds
+}
+
+// clusterSlots loads the map of slots with a CLUSTER SLOTS command sent to
+// the node at addr.
+func (t *ClusterTransport) clusterSlots(ctx context.Context, addr string) ([]string, error) {
+	res, err := t.transport().RoundTrip(&Request{
+		Addr:    addr,
+		Cmds:    []Command{{Cmd: "CLUSTER", Args: List("SLOTS")}},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make([]string, clusterSlots)
+	var entry []interface{}
+
+	// Each entry is made of the range of slots, the primary serving it, and
+	// its replicas, for example: 0 5460 ["10.0.0.1" 7000 "<node id>"] ...
+	for ; res.Args.Next(&entry); entry = nil {
+		if len(entry) < 3 {
+			continue
+		}
+
+		start, _ := entry[0].(int64)
+		end, _ := entry[1].(int64)
+		node, _ := entry[2].([]interface{})
+
+		if len(node) < 2 || start < 0 || end >= clusterSlots {
+			continue
+		}
+
+		host := cacheString(node[0])
+		port := cacheString(node[1])
+
+		if len(host) == 0 {
+			// Nodes which don't know their own address report an empty host,
+			// they are reachable at the address the command was sent to.
+			_, address := splitNetworkAddress(addr)
+			host, _, _ = net.SplitHostPort(address)
+		}
+
+		for slot := start; slot <= end; slot++ {
+			slots[slot] = net.JoinHostPort(host, port)
+		}
+	}
+
+	if err := res.Args.Close(); err != nil {
+		return nil, fmt.Errorf("redis: loading the cluster slots from %s: %w", addr, err)
+	}
+
+	return slots, nil
+}
+
+func (t *ClusterTransport) send(req *Request, addr string, cmds []Command) (*Response, error) {
+	r := *req
+	r.Addr = addr
+	r.Cmds = cmds
+
+	res, err := t.transport().RoundTrip(&r)
+	if res != nil {
+		res.Request = req
+	}
+	return res, err
+}
+
+func (t *ClusterTransport) transport() RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return DefaultTransport
+}
+
+func (t *ClusterTransport) maxRedirects() int {
+	if t.MaxRedirects != 0 {
+		return t.MaxRedirects
+	}
+	return DefaultMaxRedirects
+}
+
+// askingResponse turns the response to a pipeline made of ASKING and a command
+// into the response to the command.
+func askingResponse(req *Request, res *Response) (*Response, error) {
+	tx := res.TxArgs
+
+	if err := ParseArgs(tx.Next(), nil); err != nil {
+		tx.Close()
+		return nil, err
+	}
+
+	return &Response{Args: &askingArgs{Args: tx.Next(), tx: tx}, Request: req}, nil
+}
+
+// askingArgs is the argument list of the command following ASKING in a
+// pipeline, closing it closes the pipeline.
+type askingArgs struct {
+	Args
+	tx TxArgs
+}
+
+func (args *askingArgs) NextType() Type {
+	return NextType(args.Args)
+}
+
+func (args *askingArgs) Close() error {
+	err := args.Args.Close()
+	if e := args.tx.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// parseRedirect parses MOVED and ASK errors, which carry the slot and the
+// address of the node that the request must be sent to:
+//
+//	MOVED 3999 127.0.0.1:6381
+func parseRedirect(err error) (kind string, slot int, addr string, ok bool) {
+	if ErrorClass(err) != ErrClassMoved {
+		return
+	}
+
+	fields := strings.Fields(err.Error())
+	if len(fields) != 3 {
+		return
+	}
+
+	if slot, err = strconv.Atoi(fields[1]); err != nil || slot < 0 || slot >= clusterSlots {
+		return
+	}
+
+	return fields[0], slot, fields[2], true
+}
+
+// clusterSlotOfCommands returns the hash slot of the first key of cmds, or -1
+// if none of the commands have keys that can be found. The arguments must be
+// loaded in memory.
+func clusterSlotOfCommands(cmds []Command) int {
+	for _, cmd := range cmds {
+		var args [][]byte
+		if a, ok := cmd.Args.(*byteArgs); ok {
+			args = a.args
+		}
+		if keys, ok := commandKeys(cmd.Cmd, args); ok && len(keys) != 0 {
+			return ClusterSlot(string(keys[0]))
+		}
+	}
+	return -1
+}
+
+// ClusterSlot returns the hash slot of key in a redis cluster. When the key
+// contains a hash tag, like "{user1000}.following", only the tag is hashed.
+func ClusterSlot(key string) int {
+	return int(crc16(hashTag(key)) % clusterSlots)
+}
+
+// hashTag returns the part of key between the first pair of braces if it is
+// not empty, or key itself.
+func hashTag(key string) string {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	return key
+}
+
+// crc16 implements the CRC-16/XMODEM checksum used by redis cluster to hash
+// keys to slots.
+func crc16(s string) uint16 {
+	var crc uint16
+
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+
+		for j := 0; j != 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,249 @@
+package redis_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestClusterSlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		slot int
+	}{
+		{key: "", slot: 0},
+		{key: "123456789", slot: 12739},
+		{key: "foo", slot: 12182},
+		{key: "{user1000}.following", slot: redis.ClusterSlot("user1000")},
+		{key: "{user1000}.followers", slot: redis.ClusterSlot("user1000")},
+		{key: "foo{}{bar}", slot: redis.ClusterSlot("foo{}{bar}")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			if slot := redis.ClusterSlot(test.key); slot != test.slot {
+				t.Error("bad slot:", slot, "!=", test.slot)
+			}
+		})
+	}
+}
+
+// fakeCluster is a cluster of two nodes, each node serves half of the slots
+// unless the slot was moved or is being migrated to the other node.
+type fakeCluster struct {
+	mutex     sync.Mutex
+	addrs     [2]string
+	servers   [2]interface{ Close() error }
+	store     map[string]string
+	moved     map[int]int // slot => index of the node serving it
+	migrating map[int]int // slot => index of the node it's migrated to
+	asking    map[string]bool
+}
+
+func newFakeCluster() *fakeCluster {
+	c := &fakeCluster{
+		store:     map[string]string{},
+		moved:     map[int]int{},
+		migrating: map[int]int{},
+		asking:    map[string]bool{},
+	}
+
+	for i := range c.addrs {
+		srv, url := newServer(c.handler(i))
+		c.servers[i], c.addrs[i] = srv, url
+	}
+
+	return c
+}
+
+func (c *fakeCluster) Close() {
+	for _, srv := range c.servers {
+		srv.Close()
+	}
+}
+
+func (c *fakeCluster) owner(slot int) int {
+	if node, ok := c.moved[slot]; ok {
+		return node
+	}
+	return slot * 2 / 16384
+}
+
+// hostPort returns the address of node i, as reported by redis cluster.
+func (c *fakeCluster) hostPort(i int) string {
+	return strings.TrimPrefix(c.addrs[i], "tcp://")
+}
+
+func (c *fakeCluster) node(i int) []interface{} {
+	host, port, _ := net.SplitHostPort(c.hostPort(i))
+	p, _ := strconv.Atoi(port)
+	return []interface{}{host, int64(p)}
+}
+
+func (c *fakeCluster) handler(node int) redis.Handler {
+	return redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		cmd := req.Cmds[0]
+		asking := c.asking[req.Addr]
+		delete(c.asking, req.Addr)
+
+		switch cmd.Cmd {
+		case "CLUSTER":
+			res.WriteStream(len(c.addrs) + len(c.moved))
+			for i := range c.addrs {
+				res.Write([]interface{}{int64(i * 8192), int64(i*8192 + 8191), c.node(i)})
+			}
+			// Moved slots are listed after the ranges, so they override them.
+			for slot, i := range c.moved {
+				res.Write([]interface{}{int64(slot), int64(slot), c.node(i)})
+			}
+			return
+
+		case "ASKING":
+			c.asking[req.Addr] = true
+			res.Write("OK")
+			return
+		}
+
+		var key, val string
+		if cmd.Cmd == "OBJECT" {
+			cmd.ParseArgs(&val, &key)
+		} else {
+			cmd.ParseArgs(&key, &val)
+		}
+		slot := redis.ClusterSlot(key)
+
+		if owner := c.owner(slot); owner != node {
+			if target, ok := c.migrating[slot]; !ok || target != node || !asking {
+				res.Write(resp.NewError("MOVED " + strconv.Itoa(slot) + " " + c.hostPort(owner)))
+				return
+			}
+		} else if target, ok := c.migrating[slot]; ok {
+			res.Write(resp.NewError("ASK " + strconv.Itoa(slot) + " " + c.hostPort(target)))
+			return
+		}
+
+		switch cmd.Cmd {
+		case "GET":
+			res.Write(c.store[key] + "@" + strconv.Itoa(node))
+		case "SET":
+			c.store[key] = val
+			res.Write("OK")
+		case "OBJECT":
+			res.Write("embstr@" + strconv.Itoa(node))
+		}
+	})
+}
+
+func TestClusterTransport(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	ct := &redis.ClusterTransport{Transport: tr}
+	cli := &redis.Client{Addr: cluster.addrs[0], Transport: ct}
+	ctx := context.Background()
+
+	// "foo" hashes to a slot of the second node, "123" to one of the first.
+	get := func(key string) string {
+		s, err := redis.String(cli.Query(ctx, "GET", key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	if err := cli.Exec(ctx, "SET", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := get("foo"); s != "bar@1" {
+		t.Error("keys must be routed to the node serving their slot:", s)
+	}
+
+	if s := get("123"); s != "@0" {
+		t.Error("keys must be routed to the node serving their slot:", s)
+	}
+
+	if stats := ct.Stats(); stats != (redis.ClusterStats{Refreshes: 1}) {
+		t.Errorf("bad cluster stats: %+v", stats)
+	}
+
+	// The slot of "foo" is migrated to the first node, requests are sent to
+	// the first node with ASKING.
+	cluster.mutex.Lock()
+	cluster.migrating[redis.ClusterSlot("foo")] = 0
+	cluster.mutex.Unlock()
+
+	if s := get("foo"); s != "bar@0" {
+		t.Error("ASK redirections must be followed:", s)
+	}
+
+	if stats := ct.Stats(); stats != (redis.ClusterStats{Ask: 1, Refreshes: 1}) {
+		t.Errorf("bad cluster stats: %+v", stats)
+	}
+
+	// The migration completed, the first node serves the slot of "foo".
+	cluster.mutex.Lock()
+	delete(cluster.migrating, redis.ClusterSlot("foo"))
+	cluster.moved[redis.ClusterSlot("foo")] = 0
+	cluster.mutex.Unlock()
+
+	if s := get("foo"); s != "bar@0" {
+		t.Error("MOVED redirections must be followed:", s)
+	}
+
+	if stats := ct.Stats(); stats != (redis.ClusterStats{Moved: 1, Ask: 1, Refreshes: 1}) {
+		t.Errorf("bad cluster stats: %+v", stats)
+	}
+
+	// The slot map was updated with the slot of the MOVED error, the request
+	// is sent to the first node directly.
+	if s := get("foo"); s != "bar@0" {
+		t.Error("bad node after the redirection:", s)
+	}
+
+	if stats := ct.Stats(); stats.Moved != 1 {
+		t.Errorf("the slot map must be updated after a MOVED error: %+v", stats)
+	}
+
+	// The keys of subcommands are found from the command spec.
+	if s, err := redis.String(cli.Query(ctx, "OBJECT", "ENCODING", "foo")); err != nil || s != "embstr@0" {
+		t.Error("bad node for the key of a subcommand:", s, err)
+	}
+
+	if stats := ct.Stats(); stats.Moved != 1 {
+		t.Errorf("the key of the subcommand must be routed to its node: %+v", stats)
+	}
+
+	// Concurrent reloads share a single CLUSTER SLOTS command, the reloads
+	// are blocked by the lock of the cluster until they all started.
+	cluster.mutex.Lock()
+	errs := make(chan error, 10)
+	for i := 0; i != cap(errs); i++ {
+		go func() { errs <- ct.RefreshTopology(ctx) }()
+	}
+	time.Sleep(50 * time.Millisecond)
+	cluster.mutex.Unlock()
+
+	for i := 0; i != cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+
+	if stats := ct.Stats(); stats.Refreshes != 2 {
+		t.Errorf("concurrent reloads must be coalesced: %+v", stats)
+	}
+}
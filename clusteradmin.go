@@ -0,0 +1,713 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+// ClusterNode describes a node of a redis cluster, as seen by the node which
+// answered CLUSTER NODES.
+type ClusterNode struct {
+	// ID is the unique identifier of the node in the cluster.
+	ID string
+
+	// Addr is the address that clients connect to, in the host:port form.
+	Addr string
+
+	// Flags is the list of flags of the node ("myself", "master", "slave",
+	// "fail?", "fail", "handshake", "noaddr", ...).
+	Flags []string
+
+	// Primary is the ID of the primary that the node replicates, or empty if
+	// the node is a primary.
+	Primary string
+
+	// LinkState is the state of the cluster bus link to the node, "connected"
+	// or "disconnected".
+	LinkState string
+
+	// Slots is the list of ranges of slots served by the node.
+	Slots []SlotRange
+
+	// Migrating maps the slots being migrated from the node to the ID of the
+	// node they are migrated to. It is only set for the node which answered
+	// CLUSTER NODES.
+	Migrating map[int]string
+
+	// Importing maps the slots being imported by the node to the ID of the
+	// node they are imported from. It is only set for the node which answered
+	// CLUSTER NODES.
+	Importing map[int]string
+}
+
+// SlotRange is a range of hash slots, both ends included.
+type SlotRange struct {
+	Start int
+	End   int
+}
+
+// HasFlag returns true if the node has the given flag.
+func (n *ClusterNode) HasFlag(flag string) bool {
+	for _, f := range n.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrimary returns true if the node is a primary.
+func (n *ClusterNode) IsPrimary() bool {
+	return n.HasFlag("master")
+}
+
+// ServesSlot returns true if slot is in one of the ranges served by the node.
+func (n *ClusterNode) ServesSlot(slot int) bool {
+	for _, r := range n.Slots {
+		if slot >= r.Start && slot <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// SlotState is the state that a slot is set to with CLUSTER SETSLOT.
+type SlotState string
+
+const (
+	// SlotImporting sets a slot of the target node of a migration in the
+	// importing state.
+	SlotImporting SlotState = "IMPORTING"
+
+	// SlotMigrating sets a slot of the source node of a migration in the
+	// migrating state.
+	SlotMigrating SlotState = "MIGRATING"
+
+	// SlotNode assigns a slot to a node, it completes a migration.
+	SlotNode SlotState = "NODE"
+
+	// SlotStable clears the importing or migrating state of a slot, it
+	// aborts a migration.
+	SlotStable SlotState = "STABLE"
+)
+
+// FailoverMode configures the behavior of CLUSTER FAILOVER.
+type FailoverMode string
+
+const (
+	// FailoverSafe makes the replica wait until it has processed the
+	// replication stream of its primary before taking over, no writes are
+	// lost.
+	FailoverSafe FailoverMode = ""
+
+	// FailoverForce makes the replica take over without coordinating with
+	// its primary, for example when the primary is down. It still needs the
+	// agreement of a majority of primaries.
+	FailoverForce FailoverMode = "FORCE"
+
+	// FailoverTakeover makes the replica take over without any agreement
+	// from the cluster. It should only be used when a majority of primaries
+	// is unreachable.
+	FailoverTakeover FailoverMode = "TAKEOVER"
+)
+
+// ClusterNodes returns the nodes of the cluster known to the server with
+// CLUSTER NODES. The node which answered the command has the "myself" flag.
+func (c *Client) ClusterNodes(ctx context.Context) ([]ClusterNode, error) {
+	var s string
+
+	if err := ParseArgs(c.Query(ctx, "CLUSTER", "NODES"), &s); err != nil {
+		return nil, err
+	}
+
+	return parseClusterNodes(s)
+}
+
+// ClusterMyself returns the node of the cluster that the client is connected
+// to.
+func (c *Client) ClusterMyself(ctx context.Context) (ClusterNode, error) {
+	nodes, err := c.ClusterNodes(ctx)
+	if err != nil {
+		return ClusterNode{}, err
+	}
+
+	for _, node := range nodes {
+		if node.HasFlag("myself") {
+			return node, nil
+		}
+	}
+
+	return ClusterNode{}, fmt.Errorf("redis: the node at %s is missing from its own list of cluster nodes", c.Addr)
+}
+
+// ClusterMeet connects the server to the node at addr with CLUSTER MEET, adding
+// it to the cluster.
+func (c *Client) ClusterMeet(ctx context.Context, addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	return c.Exec(ctx, "CLUSTER", "MEET", host, port)
+}
+
+// ClusterForget removes the node identified by id from the nodes known to the
+// server with CLUSTER FORGET.
+//
+// The method refuses to forget nodes which, according to the server, still
+// serve slots, as their keys would become unreachable. The command must be
+// sent to all nodes of the cluster within a minute, otherwise the forgotten
+// node is added back by the gossip protocol.
+func (c *Client) ClusterForget(ctx context.Context, id string) error {
+	nodes, err := c.ClusterNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		if node.ID == id && len(node.Slots) != 0 {
+			return fmt.Errorf("redis: cannot forget cluster node %s which still serves slots", id)
+		}
+	}
+
+	return c.Exec(ctx, "CLUSTER", "FORGET", id)
+}
+
+// ClusterFailover starts a manual failover with CLUSTER FAILOVER, promoting the
+// replica that the client is connected to. The method returns once the
+// failover has started; the replica becomes a primary asynchronously, which
+// programs can observe with ClusterMyself.
+//
+// The method verifies that the server is a replica before sending the command.
+func (c *Client) ClusterFailover(ctx context.Context, mode FailoverMode) error {
+	myself, err := c.ClusterMyself(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(myself.Primary) == 0 {
+		return fmt.Errorf("redis: cannot fail over to cluster node %s which is not a replica", myself.ID)
+	}
+
+	args := []interface{}{"FAILOVER"}
+	if len(mode) != 0 {
+		args = append(args, string(mode))
+	}
+
+	return c.Exec(ctx, "CLUSTER", args...)
+}
+
+// ClusterSetSlot changes the state of slot on the server with CLUSTER SETSLOT.
+// The node is the ID of the other node of a migration for SlotImporting and
+// SlotMigrating, the ID of the new owner of the slot for SlotNode, and is
+// ignored for SlotStable.
+func (c *Client) ClusterSetSlot(ctx context.Context, slot int, state SlotState, node string) error {
+	if err := checkSlot(slot); err != nil {
+		return err
+	}
+
+	if state == SlotStable {
+		return c.Exec(ctx, "CLUSTER", "SETSLOT", slot, string(state))
+	}
+
+	return c.Exec(ctx, "CLUSTER", "SETSLOT", slot, string(state), node)
+}
+
+// ClusterCountKeysInSlot returns the number of keys stored in slot on the
+// server.
+func (c *Client) ClusterCountKeysInSlot(ctx context.Context, slot int) (int, error) {
+	var n int
+
+	if err := checkSlot(slot); err != nil {
+		return 0, err
+	}
+
+	err := ParseArgs(c.Query(ctx, "CLUSTER", "COUNTKEYSINSLOT", slot), &n)
+	return n, err
+}
+
+// ClusterGetKeysInSlot returns up to count keys stored in slot on the server.
+func (c *Client) ClusterGetKeysInSlot(ctx context.Context, slot int, count int) ([]string, error) {
+	var keys []string
+
+	if err := checkSlot(slot); err != nil {
+		return nil, err
+	}
+
+	r := c.Query(ctx, "CLUSTER", "GETKEYSINSLOT", slot, count)
+	var key string
+
+	for r.Next(&key) {
+		keys = append(keys, key)
+	}
+
+	return keys, r.Close()
+}
+
+// A SlotMigrator moves hash slots between two primaries of a redis cluster,
+// following the procedure used by redis-cli to reshard clusters:
+//
+//   - the slot is set in the importing state on the target,
+//   - the slot is set in the migrating state on the source,
+//   - the keys of the slot are moved in batches with MIGRATE,
+//   - the slot is assigned to the target on both nodes.
+//
+// Keys are moved with DUMP and RESTORE when MIGRATE fails, for example because
+// the source can't connect to the target, their time to live is preserved.
+//
+// Clients of a ClusterTransport keep working during the migration, they are
+// redirected to the target with ASK errors for keys which were already moved.
+//
+//	migrator := &redis.SlotMigrator{
+//		Source: &redis.Client{Addr: "10.0.0.1:6379"},
+//		Target: &redis.Client{Addr: "10.0.0.2:6379"},
+//		Progress: func(p redis.SlotProgress) {
+//			log.Printf("slot %d: %d keys moved", p.Slot, p.Keys)
+//		},
+//	}
+//
+//	if err := migrator.MigrateSlots(ctx, 0, 1, 2); err != nil {
+//		...
+//	}
+//
+// The migration of a slot interrupted by an error is rolled back, see
+// SlotMigrationError. If the rollback fails too, the migration can be resumed
+// by calling MigrateSlots again with the same slots.
+type SlotMigrator struct {
+	// Source is connected to the primary that slots are migrated from.
+	Source *Client
+
+	// Target is connected to the primary that slots are migrated to. Keys
+	// are migrated to the address of the client, which must be a TCP address.
+	Target *Client
+
+	// BatchSize is the number of keys moved by each MIGRATE command. If zero,
+	// DefaultMigrateBatchSize is used.
+	BatchSize int
+
+	// Timeout is the maximum idle time of the transfers of MIGRATE commands.
+	// If zero, DefaultMigrateTimeout is used.
+	Timeout time.Duration
+
+	// Replace configures the migrator to overwrite the keys which already
+	// exist on the target. By default, the migration of a slot fails with a
+	// BUSYKEY error if one of its keys exists on the target.
+	Replace bool
+
+	// Progress, if not nil, is called after each batch of keys is moved, and
+	// when a slot is assigned to the target.
+	Progress func(SlotProgress)
+}
+
+// MoveSlotOptions carries the options of MoveSlot, which have the same meaning
+// as the fields of SlotMigrator.
+type MoveSlotOptions struct {
+	BatchSize int
+	Timeout   time.Duration
+	Replace   bool
+	Progress  func(SlotProgress)
+}
+
+// MoveSlot moves slot from the primary that from is connected to, to the
+// primary that to is connected to, see SlotMigrator for details. The options
+// may be nil.
+func MoveSlot(ctx context.Context, slot int, from *Client, to *Client, opts *MoveSlotOptions) error {
+	m := &SlotMigrator{Source: from, Target: to}
+
+	if opts != nil {
+		m.BatchSize = opts.BatchSize
+		m.Timeout = opts.Timeout
+		m.Replace = opts.Replace
+		m.Progress = opts.Progress
+	}
+
+	return m.MigrateSlots(ctx, slot)
+}
+
+// SlotMigrationError is returned when the migration of a slot fails. When the
+// error happens before the slot is assigned to the target, the migration is
+// rolled back: the keys are moved back to the source and the slot is set
+// stable on both nodes.
+type SlotMigrationError struct {
+	// Slot is the slot whose migration failed.
+	Slot int
+
+	// Err is the error which interrupted the migration.
+	Err error
+
+	// RollbackErr is the error which interrupted the rollback, if any. The
+	// slot is then left in the importing and migrating states.
+	RollbackErr error
+}
+
+// Error satisfies the error interface.
+func (e *SlotMigrationError) Error() string {
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("redis: migrating slot %d: %s (rollback failed: %s)", e.Slot, e.Err, e.RollbackErr)
+	}
+	return fmt.Sprintf("redis: migrating slot %d: %s", e.Slot, e.Err)
+}
+
+// Unwrap returns the error which interrupted the migration.
+func (e *SlotMigrationError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	// DefaultMigrateBatchSize is the default value of SlotMigrator.BatchSize.
+	DefaultMigrateBatchSize = 100
+
+	// DefaultMigrateTimeout is the default value of SlotMigrator.Timeout.
+	DefaultMigrateTimeout = 10 * time.Second
+)
+
+// SlotProgress reports the progress of the migration of a slot.
+type SlotProgress struct {
+	// Slot is the slot being migrated.
+	Slot int
+
+	// Keys is the number of keys of the slot moved so far.
+	Keys int
+
+	// Done is true when the slot was assigned to the target.
+	Done bool
+}
+
+// MigrateSlots moves slots from the source to the target. Slots are migrated
+// one at a time, in order.
+//
+// Before changing any state, the method verifies that the source and target
+// are distinct primaries, and that the source serves all slots (or is already
+// migrating them to the target).
+func (m *SlotMigrator) MigrateSlots(ctx context.Context, slots ...int) error {
+	source, err := m.Source.ClusterMyself(ctx)
+	if err != nil {
+		return err
+	}
+
+	target, err := m.Target.ClusterMyself(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case source.ID == target.ID:
+		return fmt.Errorf("redis: cannot migrate slots from cluster node %s to itself", source.ID)
+	case !source.IsPrimary():
+		return fmt.Errorf("redis: cannot migrate slots from cluster node %s which is not a primary", source.ID)
+	case !target.IsPrimary():
+		return fmt.Errorf("redis: cannot migrate slots to cluster node %s which is not a primary", target.ID)
+	}
+
+	for _, slot := range slots {
+		if err := checkSlot(slot); err != nil {
+			return err
+		}
+		if !source.ServesSlot(slot) && source.Migrating[slot] != target.ID {
+			return fmt.Errorf("redis: cannot migrate slot %d which is not served by cluster node %s", slot, source.ID)
+		}
+	}
+
+	for _, slot := range slots {
+		if err := m.migrateSlot(ctx, slot, source.ID, target.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *SlotMigrator) migrateSlot(ctx context.Context, slot int, source, target string) error {
+	if err := m.Target.ClusterSetSlot(ctx, slot, SlotImporting, source); err != nil {
+		return err
+	}
+
+	var moved []string
+
+	if err := m.moveSlotKeys(ctx, slot, target, &moved); err != nil {
+		return m.rollback(slot, moved, err)
+	}
+
+	// The source is updated last, so clients it redirects find the slot on
+	// the target.
+	if err := m.Source.ClusterSetSlot(ctx, slot, SlotNode, target); err != nil {
+		return err
+	}
+
+	m.progress(SlotProgress{Slot: slot, Keys: len(moved), Done: true})
+	return nil
+}
+
+// moveSlotKeys moves the keys of slot to the target, and assigns the slot to
+// the target on the target. The keys that were moved are appended to moved.
+func (m *SlotMigrator) moveSlotKeys(ctx context.Context, slot int, target string, moved *[]string) error {
+	if err := m.Source.ClusterSetSlot(ctx, slot, SlotMigrating, target); err != nil {
+		return err
+	}
+
+	for {
+		keys, err := m.Source.ClusterGetKeysInSlot(ctx, slot, m.batchSize())
+		if err != nil {
+			return err
+		}
+
+		if len(keys) == 0 {
+			break
+		}
+
+		if err := m.moveKeys(ctx, m.Source, m.Target, keys); err != nil {
+			return err
+		}
+
+		*moved = append(*moved, keys...)
+		m.progress(SlotProgress{Slot: slot, Keys: len(*moved)})
+	}
+
+	return m.Target.ClusterSetSlot(ctx, slot, SlotNode, target)
+}
+
+// rollback moves the keys of slot which were moved to the target back to the
+// source, and clears the migration state of the slot on both nodes.
+func (m *SlotMigrator) rollback(slot int, moved []string, err error) error {
+	// The context of the migration may have been canceled, the rollback
+	// gets its own.
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout())
+	defer cancel()
+
+	var rollbackErr error
+
+	if len(moved) != 0 {
+		rollbackErr = m.moveKeys(ctx, m.Target, m.Source, moved)
+	}
+
+	for _, c := range []*Client{m.Target, m.Source} {
+		if err := c.ClusterSetSlot(ctx, slot, SlotStable, ""); err != nil && rollbackErr == nil {
+			rollbackErr = err
+		}
+	}
+
+	return &SlotMigrationError{Slot: slot, Err: err, RollbackErr: rollbackErr}
+}
+
+// moveKeys moves keys from one node to another with MIGRATE, falling back to
+// DUMP and RESTORE if the source node fails to run the command, for example
+// because it can't connect to the other node.
+func (m *SlotMigrator) moveKeys(ctx context.Context, from *Client, to *Client, keys []string) error {
+	_, addr := splitNetworkAddress(clientAddr(to))
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	args := make([]interface{}, 0, 7+len(keys))
+	args = append(args, host, port, "", 0, int(m.timeout()/time.Millisecond))
+
+	if m.Replace {
+		args = append(args, "REPLACE")
+	}
+
+	args = append(args, "KEYS")
+
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	err = askingQuery(ctx, from, "MIGRATE", List(args...))
+
+	if e, ok := err.(*resp.Error); ok && e.Type() != "BUSYKEY" {
+		err = m.restoreKeys(ctx, from, to, keys)
+	}
+
+	return err
+}
+
+// restoreKeys copies keys from one node to another with DUMP and RESTORE,
+// preserving their time to live, then deletes them from the source node.
+func (m *SlotMigrator) restoreKeys(ctx context.Context, from *Client, to *Client, keys []string) error {
+	for _, key := range keys {
+		var value []byte
+		var ttl int64
+
+		if err := askingQuery(ctx, from, "DUMP", List(key), &value); err != nil {
+			return err
+		}
+
+		if err := askingQuery(ctx, from, "PTTL", List(key), &ttl); err != nil {
+			return err
+		}
+
+		switch {
+		case value == nil || ttl == -2: // the key doesn't exist anymore
+			continue
+		case ttl == -1: // the key doesn't expire
+			ttl = 0
+		}
+
+		args := List(key, ttl, value)
+		if m.Replace {
+			args = List(key, ttl, value, "REPLACE")
+		}
+
+		if err := askingQuery(ctx, to, "RESTORE", args); err != nil {
+			return err
+		}
+
+		if err := askingQuery(ctx, from, "DEL", List(key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *SlotMigrator) progress(p SlotProgress) {
+	if m.Progress != nil {
+		m.Progress(p)
+	}
+}
+
+func (m *SlotMigrator) batchSize() int {
+	if m.BatchSize > 0 {
+		return m.BatchSize
+	}
+	return DefaultMigrateBatchSize
+}
+
+func (m *SlotMigrator) timeout() time.Duration {
+	if m.Timeout > 0 {
+		return m.Timeout
+	}
+	return DefaultMigrateTimeout
+}
+
+// askingQuery sends cmd preceded by ASKING, which lets a node importing a slot
+// serve commands on its keys, and parses the response into dsts.
+func askingQuery(ctx context.Context, c *Client, cmd string, args Args, dsts ...interface{}) error {
+	tx := c.Pipeline(ctx, Command{Cmd: "ASKING"}, Command{Cmd: cmd, Args: args})
+	var err error
+
+	if asking := tx.Next(); asking != nil {
+		err = asking.Close()
+
+		if res := tx.Next(); res != nil {
+			if e := ParseArgs(res, dsts...); err == nil {
+				err = e
+			}
+		}
+	}
+
+	if e := tx.Close(); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+func checkSlot(slot int) error {
+	if slot < 0 || slot >= clusterSlots {
+		return fmt.Errorf("redis: invalid cluster slot %d", slot)
+	}
+	return nil
+}
+
+// parseClusterNodes parses the response of CLUSTER NODES, which has one line
+// per node:
+//
+//	<id> <ip:port@cport[,hostname]> <flags> <primary> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> ...
+func parseClusterNodes(s string) ([]ClusterNode, error) {
+	var nodes []ClusterNode
+
+	for _, line := range strings.Split(s, "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("redis: malformed CLUSTER NODES line: %q", line)
+		}
+
+		node := ClusterNode{
+			ID:        fields[0],
+			Addr:      fields[1],
+			Flags:     strings.Split(fields[2], ","),
+			LinkState: fields[7],
+		}
+
+		if i := strings.IndexAny(node.Addr, "@,"); i >= 0 {
+			node.Addr = node.Addr[:i]
+		}
+
+		if fields[3] != "-" {
+			node.Primary = fields[3]
+		}
+
+		for _, slot := range fields[8:] {
+			if err := node.parseSlot(slot); err != nil {
+				return nil, err
+			}
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// parseSlot parses a slot field of CLUSTER NODES, which is either a single
+// slot, a range of slots, or a migration in the [slot->-id] or [slot-<-id]
+// form.
+func (n *ClusterNode) parseSlot(s string) error {
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+
+		if i := strings.Index(s, "->-"); i >= 0 {
+			slot, err := strconv.Atoi(s[:i])
+			if err != nil {
+				return fmt.Errorf("redis: malformed CLUSTER NODES slot: %q", s)
+			}
+			if n.Migrating == nil {
+				n.Migrating = make(map[int]string)
+			}
+			n.Migrating[slot] = s[i+3:]
+			return nil
+		}
+
+		if i := strings.Index(s, "-<-"); i >= 0 {
+			slot, err := strconv.Atoi(s[:i])
+			if err != nil {
+				return fmt.Errorf("redis: malformed CLUSTER NODES slot: %q", s)
+			}
+			if n.Importing == nil {
+				n.Importing = make(map[int]string)
+			}
+			n.Importing[slot] = s[i+3:]
+			return nil
+		}
+
+		return fmt.Errorf("redis: malformed CLUSTER NODES slot: %q", s)
+	}
+
+	start, end := s, s
+
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		start, end = s[:i], s[i+1:]
+	}
+
+	first, err1 := strconv.Atoi(start)
+	last, err2 := strconv.Atoi(end)
+
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("redis: malformed CLUSTER NODES slot: %q", s)
+	}
+
+	n.Slots = append(n.Slots, SlotRange{Start: first, End: last})
+	return nil
+}
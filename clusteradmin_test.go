@@ -0,0 +1,476 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestClusterAdmin(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context)
+	}{
+		{
+			scenario: "migrating a slot moves its keys in batches and assigns it to the target",
+			function: testClusterAdminMigrateSlots,
+		},
+		{
+			scenario: "keys are moved with DUMP and RESTORE when MIGRATE fails, preserving their TTL",
+			function: testClusterAdminMoveSlotFallback,
+		},
+		{
+			scenario: "migrations interrupted by an error are rolled back",
+			function: testClusterAdminMoveSlotRollback,
+		},
+		{
+			scenario: "slots which are not served by the source are not migrated",
+			function: testClusterAdminMigrateUnservedSlot,
+		},
+		{
+			scenario: "nodes which serve slots cannot be forgotten",
+			function: testClusterAdminForget,
+		},
+		{
+			scenario: "failovers are only started on replicas",
+			function: testClusterAdminFailover,
+		},
+		{
+			scenario: "the nodes of the cluster are parsed with their slots and migrations",
+			function: testClusterAdminNodes,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			testFunc(t, ctx)
+		})
+	}
+}
+
+// testCluster simulates a cluster of two primaries, "source" serving slots 0 to
+// 99 and "target" serving slots 100 to 199.
+type testCluster struct {
+	mutex sync.Mutex
+	slots map[int]string
+	keys  map[string]map[int][]string
+	state map[string]map[int]string
+	log   []string
+	addrs map[string]string
+
+	// ttls maps keys to their time to live in milliseconds, keys without a
+	// TTL are absent.
+	ttls map[string]int64
+
+	// busy is the set of keys which exist on the target.
+	busy map[string]bool
+
+	// noMigrate makes MIGRATE fail like when nodes can't connect to each
+	// other.
+	noMigrate bool
+}
+
+func newTestCluster(t *testing.T) (*testCluster, *redis.Client, *redis.Client) {
+	c := &testCluster{
+		slots: make(map[int]string),
+		keys:  map[string]map[int][]string{"source": {}, "target": {}},
+		state: map[string]map[int]string{"source": {}, "target": {}},
+		addrs: make(map[string]string),
+		ttls:  make(map[string]int64),
+		busy:  make(map[string]bool),
+	}
+
+	for slot := 0; slot < 200; slot++ {
+		if slot < 100 {
+			c.slots[slot] = "source"
+		} else {
+			c.slots[slot] = "target"
+		}
+	}
+
+	clients := make([]*redis.Client, 2)
+
+	for i, id := range []string{"source", "target"} {
+		id := id
+		srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			var args []string
+			var arg string
+			for req.Cmds[0].Args.Next(&arg) {
+				args = append(args, arg)
+			}
+			res.Write(c.serve(id, req.Cmds[0].Cmd, args))
+		}))
+		t.Cleanup(func() { srv.Close() })
+
+		c.addrs[id] = url
+		clients[i] = &redis.Client{Addr: url}
+	}
+
+	return c, clients[0], clients[1]
+}
+
+func (c *testCluster) serve(id string, cmd string, args []string) interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	line := strings.Join(append([]string{id, cmd}, args...), " ")
+	c.log = append(c.log, line)
+
+	other := "target"
+	if id == "target" {
+		other = "source"
+	}
+
+	switch cmd {
+	case "ASKING":
+		return "OK"
+
+	case "MIGRATE":
+		if c.noMigrate {
+			return resp.NewError("IOERR error or timeout connecting to the client")
+		}
+		keys := args[6:]
+		for _, key := range keys {
+			if other == "target" && c.busy[key] {
+				return resp.NewError("BUSYKEY Target key name already exists.")
+			}
+		}
+		for _, key := range keys {
+			c.move(id, other, key)
+		}
+		return "OK"
+
+	case "DUMP":
+		if !c.exists(id, args[0]) {
+			return nil
+		}
+		return []byte("payload:" + args[0])
+
+	case "PTTL":
+		if ttl, ok := c.ttls[args[0]]; ok {
+			return ttl
+		}
+		return -1
+
+	case "RESTORE":
+		key := args[0]
+		if args[2] != "payload:"+key {
+			return resp.NewError("ERR DUMP payload version or checksum are wrong")
+		}
+		if id == "target" && c.busy[key] {
+			return resp.NewError("BUSYKEY Target key name already exists.")
+		}
+		slot := redis.ClusterSlot(key)
+		c.keys[id][slot] = append(c.keys[id][slot], key)
+		if args[1] != "0" {
+			var ttl int64
+			fmt.Sscan(args[1], &ttl)
+			c.ttls[key] = ttl
+		}
+		return "OK"
+
+	case "DEL":
+		slot := redis.ClusterSlot(args[0])
+		c.keys[id][slot] = removeKey(c.keys[id][slot], args[0])
+		return 1
+	}
+
+	switch args[0] {
+	case "NODES":
+		return c.nodes(id)
+
+	case "SETSLOT":
+		var slot int
+		fmt.Sscan(args[1], &slot)
+		switch args[2] {
+		case "NODE":
+			c.slots[slot] = args[3]
+			delete(c.state[id], slot)
+		case "STABLE":
+			delete(c.state[id], slot)
+		default:
+			c.state[id][slot] = args[2] + " " + args[3]
+		}
+		return "OK"
+
+	case "GETKEYSINSLOT":
+		var slot, count int
+		fmt.Sscan(args[1], &slot)
+		fmt.Sscan(args[2], &count)
+		keys := c.keys[id][slot]
+		if len(keys) > count {
+			keys = keys[:count]
+		}
+		return append([]string{}, keys...)
+
+	case "FAILOVER", "FORGET":
+		return "OK"
+	}
+
+	return fmt.Errorf("ERR unsupported command %q", line)
+}
+
+func (c *testCluster) nodes(myself string) string {
+	var s strings.Builder
+
+	for _, id := range []string{"source", "target"} {
+		flags := "master"
+		if id == myself {
+			flags = "myself,master"
+		}
+
+		fmt.Fprintf(&s, "%s %s@16379 %s - 0 0 1 connected", id, c.addrs[id], flags)
+
+		for slot := 0; slot < 16384; slot++ {
+			if c.slots[slot] == id {
+				fmt.Fprintf(&s, " %d", slot)
+			}
+		}
+
+		s.WriteString("\n")
+	}
+
+	return s.String()
+}
+
+func (c *testCluster) exists(id string, key string) bool {
+	for _, k := range c.keys[id][redis.ClusterSlot(key)] {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *testCluster) move(from string, to string, key string) {
+	slot := redis.ClusterSlot(key)
+	c.keys[from][slot] = removeKey(c.keys[from][slot], key)
+	c.keys[to][slot] = append(c.keys[to][slot], key)
+}
+
+func removeKey(list []string, s string) []string {
+	for i, v := range list {
+		if v == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+func testClusterAdminMigrateSlots(t *testing.T, ctx context.Context) {
+	c, source, target := newTestCluster(t)
+
+	// Keys of the same hash tag are in the same slot.
+	var keys []string
+	for i := 0; i < 5; i++ {
+		keys = append(keys, fmt.Sprintf("{a}%d", i))
+	}
+	slot := redis.ClusterSlot("{a}")
+	c.slots[slot] = "source"
+	c.keys["source"][slot] = append([]string{}, keys...)
+
+	var progress []redis.SlotProgress
+
+	migrator := &redis.SlotMigrator{
+		Source:    source,
+		Target:    target,
+		BatchSize: 2,
+		Progress:  func(p redis.SlotProgress) { progress = append(progress, p) },
+	}
+
+	if err := migrator.MigrateSlots(ctx, slot); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(c.keys["target"][slot], keys) {
+		t.Error("bad keys on the target:", c.keys["target"][slot])
+	}
+	if c.slots[slot] != "target" {
+		t.Error("the slot was not assigned to the target:", c.slots[slot])
+	}
+
+	expected := []redis.SlotProgress{
+		{Slot: slot, Keys: 2},
+		{Slot: slot, Keys: 4},
+		{Slot: slot, Keys: 5},
+		{Slot: slot, Keys: 5, Done: true},
+	}
+	if !reflect.DeepEqual(progress, expected) {
+		t.Errorf("bad progress:\n%+v\n%+v", progress, expected)
+	}
+
+	var setslots []string
+	for _, line := range c.log {
+		if strings.Contains(line, "SETSLOT") {
+			setslots = append(setslots, line)
+		}
+	}
+
+	expectedSetslots := []string{
+		fmt.Sprintf("target CLUSTER SETSLOT %d IMPORTING source", slot),
+		fmt.Sprintf("source CLUSTER SETSLOT %d MIGRATING target", slot),
+		fmt.Sprintf("target CLUSTER SETSLOT %d NODE target", slot),
+		fmt.Sprintf("source CLUSTER SETSLOT %d NODE target", slot),
+	}
+	if !reflect.DeepEqual(setslots, expectedSetslots) {
+		t.Errorf("bad SETSLOT commands:\n%q\n%q", setslots, expectedSetslots)
+	}
+}
+
+func testClusterAdminMoveSlotFallback(t *testing.T, ctx context.Context) {
+	c, source, target := newTestCluster(t)
+	c.noMigrate = true
+
+	slot := redis.ClusterSlot("{a}")
+	c.slots[slot] = "source"
+	c.keys["source"][slot] = []string{"{a}0", "{a}1"}
+	c.ttls["{a}1"] = 60000
+
+	if err := redis.MoveSlot(ctx, slot, source, target, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := c.keys["target"][slot]; !reflect.DeepEqual(keys, []string{"{a}0", "{a}1"}) {
+		t.Error("bad keys on the target:", keys)
+	}
+	if keys := c.keys["source"][slot]; len(keys) != 0 {
+		t.Error("keys were left on the source:", keys)
+	}
+	if !reflect.DeepEqual(c.ttls, map[string]int64{"{a}1": 60000}) {
+		t.Error("bad TTLs:", c.ttls)
+	}
+	if c.slots[slot] != "target" {
+		t.Error("the slot was not assigned to the target:", c.slots[slot])
+	}
+}
+
+func testClusterAdminMoveSlotRollback(t *testing.T, ctx context.Context) {
+	c, source, target := newTestCluster(t)
+
+	slot := redis.ClusterSlot("{a}")
+	c.slots[slot] = "source"
+	c.keys["source"][slot] = []string{"{a}0", "{a}1", "{a}2", "{a}3"}
+	c.busy["{a}2"] = true
+
+	err := redis.MoveSlot(ctx, slot, source, target, &redis.MoveSlotOptions{BatchSize: 2})
+
+	e, ok := err.(*redis.SlotMigrationError)
+	if !ok {
+		t.Fatal("bad error:", err)
+	}
+	if busy, ok := e.Err.(*resp.Error); !ok || busy.Type() != "BUSYKEY" || e.Slot != slot || e.RollbackErr != nil {
+		t.Error("bad error:", e)
+	}
+
+	if keys := c.keys["source"][slot]; !reflect.DeepEqual(keys, []string{"{a}2", "{a}3", "{a}0", "{a}1"}) {
+		t.Error("bad keys on the source:", keys)
+	}
+	if keys := c.keys["target"][slot]; len(keys) != 0 {
+		t.Error("keys were left on the target:", keys)
+	}
+	if c.slots[slot] != "source" {
+		t.Error("the slot was reassigned:", c.slots[slot])
+	}
+	if len(c.state["source"]) != 0 || len(c.state["target"]) != 0 {
+		t.Error("the migration state was not cleared:", c.state)
+	}
+}
+
+func testClusterAdminMigrateUnservedSlot(t *testing.T, ctx context.Context) {
+	c, source, target := newTestCluster(t)
+
+	migrator := &redis.SlotMigrator{Source: source, Target: target}
+
+	if err := migrator.MigrateSlots(ctx, 150); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, line := range c.log {
+		if strings.Contains(line, "SETSLOT") {
+			t.Error("the state of the cluster was changed:", line)
+		}
+	}
+}
+
+func testClusterAdminForget(t *testing.T, ctx context.Context) {
+	c, source, _ := newTestCluster(t)
+
+	if err := source.ClusterForget(ctx, "target"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	c.mutex.Lock()
+	for slot, id := range c.slots {
+		if id == "target" {
+			c.slots[slot] = "source"
+		}
+	}
+	c.mutex.Unlock()
+
+	if err := source.ClusterForget(ctx, "target"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testClusterAdminFailover(t *testing.T, ctx context.Context) {
+	c, source, _ := newTestCluster(t)
+
+	if err := source.ClusterFailover(ctx, redis.FailoverForce); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, line := range c.log {
+		if strings.Contains(line, "FAILOVER") {
+			t.Error("the failover command was sent to a primary:", line)
+		}
+	}
+}
+
+func testClusterAdminNodes(t *testing.T, ctx context.Context) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("" +
+			"07c37dfeb235213a872192d90877d0cd55635b91 127.0.0.1:30004@31004,replica.local slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238317239 4 connected\n" +
+			"e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:30001@31001 myself,master - 0 0 1 connected 0-5460 5462 [5461->-67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1]\n")
+	}))
+	defer srv.Close()
+
+	nodes, err := (&redis.Client{Addr: url}).ClusterNodes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []redis.ClusterNode{
+		{
+			ID:        "07c37dfeb235213a872192d90877d0cd55635b91",
+			Addr:      "127.0.0.1:30004",
+			Flags:     []string{"slave"},
+			Primary:   "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca",
+			LinkState: "connected",
+		},
+		{
+			ID:        "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca",
+			Addr:      "127.0.0.1:30001",
+			Flags:     []string{"myself", "master"},
+			LinkState: "connected",
+			Slots:     []redis.SlotRange{{Start: 0, End: 5460}, {Start: 5462, End: 5462}},
+			Migrating: map[int]string{5461: "67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1"},
+		},
+	}
+
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("bad nodes:\n%+v\n%+v", nodes, expected)
+	}
+}
@@ -23,6 +23,7 @@ func main() {
 		Commands: []conf.Command{
 			{"proxy", "Run the RED proxy"},
 			{"test", "Run the RED proxy test"},
+			{"warm", "Copy keys listed in a manifest from a source server to a destination"},
 			{"help", "Show the RED help"},
 			{"version", "Show the RED version"},
 		},
@@ -33,6 +34,8 @@ func main() {
 		err = proxy(args)
 	case "test":
 		err = test(args)
+	case "warm":
+		err = warm(args)
 	case "help":
 		ld.PrintHelp(nil)
 	case "version":
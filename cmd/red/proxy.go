@@ -131,6 +131,9 @@ func makeRegistry(upstream string) (registry redis.ServerRegistry) {
 		case "consul":
 			registry = makeConsulRegistry(u)
 
+		case "srv":
+			registry = makeSRVRegistry(u)
+
 		default:
 			panic("unsupported registry: " + u.Scheme)
 		}
@@ -139,6 +142,13 @@ func makeRegistry(upstream string) (registry redis.ServerRegistry) {
 	return
 }
 
+func makeSRVRegistry(u *url.URL) *redis.DiscoveryRegistry {
+	events.Log("looking up upstream redis servers from SRV records of '%{redis_service}s'", u.Host)
+	return &redis.DiscoveryRegistry{
+		Discovery: &redis.SRVDiscovery{Name: u.Host},
+	}
+}
+
 func makeStaticRegistry(upstream string) redis.ServerList {
 	addrs := strings.Split(upstream, ",")
 	servers := make(redis.ServerList, len(addrs))
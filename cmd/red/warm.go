@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"github.com/segmentio/conf"
+	"github.com/segmentio/events"
+	redis "github.com/segmentio/redis-go"
+)
+
+type warmConfig struct {
+	Source      string `conf:"source"      help:"Address of the redis server to read keys from, in ip:port format."                 validate:"nonzero"`
+	Destination string `conf:"destination" help:"Address of the redis server (or proxy) to write keys to, in ip:port format."     validate:"nonzero"`
+	Manifest    string `conf:"manifest"    help:"Path to the manifest file listing keys or key patterns to copy, one per line." validate:"nonzero"`
+	Concurrency int    `conf:"concurrency" help:"Maximum number of keys copied concurrently."`
+	Bandwidth   int    `conf:"bandwidth"   help:"Maximum number of bytes of values copied per second, zero means no limit."`
+}
+
+func warm(args []string) (err error) {
+	config := warmConfig{
+		Concurrency: 10,
+	}
+
+	conf.LoadWith(&config, conf.Loader{
+		Name: "red warm",
+		Args: args,
+		Sources: []conf.Source{
+			conf.NewEnvSource("RED", os.Environ()...),
+		},
+	})
+
+	f, err := os.Open(config.Manifest)
+	if err != nil {
+		return
+	}
+	manifest, err := redis.ReadManifest(f)
+	f.Close()
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigchan, sigstop := signals(syscall.SIGINT, syscall.SIGTERM)
+	defer sigstop()
+
+	go func() {
+		select {
+		case <-sigchan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	transport := &redis.Transport{}
+	defer transport.CloseIdleConnections()
+
+	warmer := &redis.Warmer{
+		Source:         &redis.Client{Addr: config.Source, Transport: transport},
+		Destination:    &redis.Client{Addr: config.Destination, Transport: transport},
+		Concurrency:    config.Concurrency,
+		BytesPerSecond: config.Bandwidth,
+	}
+
+	events.Log("warming '%{destination}s' from '%{source}s' with %{entries}d manifest entries", config.Destination, config.Source, len(manifest))
+
+	stats, err := warmer.Warm(ctx, manifest)
+	events.Log("copied %{keys}d keys (%{bytes}d bytes), skipped %{skipped}d keys", stats.Keys, stats.Bytes, stats.Skipped)
+	return
+}
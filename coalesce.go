@@ -0,0 +1,138 @@
+package redis
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+)
+
+// A CoalescingClient wraps a Client to coalesce concurrent identical reads
+// into a single request, which protects servers against storms of requests
+// for the same hot key.
+//
+// When a command matching one of the Commands patterns is issued while an
+// identical command (same name and arguments) is in flight, the program
+// waits for the reply of the in-flight command instead of sending a new
+// request, and the reply is shared between all callers. Commands that don't
+// match any of the patterns are forwarded to the Client unchanged.
+//
+// Only idempotent reads should be coalesced: a caller may observe a reply that
+// was produced slightly before it issued its command.
+//
+// CoalescingClient values are safe for concurrent use by multiple goroutines.
+type CoalescingClient struct {
+	// Client is used to send commands. If nil, DefaultClient is used.
+	Client *Client
+
+	// Commands is the list of patterns of the commands that are coalesced.
+	// Patterns are matched against upper-case command names using the
+	// syntax of path.Match, for example "GET" or "H*GET".
+	Commands []string
+
+	mutex sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done   chan struct{}
+	values []interface{}
+	err    error
+}
+
+// Exec behaves like Client.Exec, but may share the reply of an identical
+// command in flight.
+func (c *CoalescingClient) Exec(ctx context.Context, cmd string, args ...interface{}) error {
+	return ParseArgs(c.Query(ctx, cmd, args...), nil)
+}
+
+// Query behaves like Client.Query, but may share the reply of an identical
+// command in flight.
+//
+// The returned Args are fully loaded in memory when cmd is coalesced. The
+// request is made with the context of the first caller, canceling it fails
+// the callers waiting for the same reply, while canceling the context of
+// any other caller only interrupts its own wait.
+func (c *CoalescingClient) Query(ctx context.Context, cmd string, args ...interface{}) Args {
+	if !c.coalesced(cmd) {
+		return c.client().Query(ctx, cmd, args...)
+	}
+
+	id := cacheID(cmd, args)
+
+	c.mutex.Lock()
+
+	if call := c.calls[id]; call != nil {
+		c.mutex.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return newArgsError(ctx.Err())
+		}
+
+		if call.err != nil {
+			return newArgsError(call.err)
+		}
+		return List(call.values...)
+	}
+
+	if c.calls == nil {
+		c.calls = make(map[string]*coalescedCall)
+	}
+
+	call := &coalescedCall{done: make(chan struct{})}
+	c.calls[id] = call
+	c.mutex.Unlock()
+
+	call.values, call.err = c.query(ctx, cmd, args)
+
+	c.mutex.Lock()
+	delete(c.calls, id)
+	c.mutex.Unlock()
+	close(call.done)
+
+	if call.err != nil {
+		return newArgsError(call.err)
+	}
+	return List(call.values...)
+}
+
+func (c *CoalescingClient) query(ctx context.Context, cmd string, args []interface{}) ([]interface{}, error) {
+	r := c.client().Query(ctx, cmd, args...)
+	values := make([]interface{}, 0, r.Len())
+
+	for {
+		var v interface{}
+		if !r.Next(&v) {
+			break
+		}
+		// Byte slices are converted to strings so callers sharing the reply
+		// cannot mutate the values read by the others.
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		values = append(values, v)
+	}
+
+	return values, r.Close()
+}
+
+func (c *CoalescingClient) client() *Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return DefaultClient
+}
+
+func (c *CoalescingClient) coalesced(cmd string) bool {
+	cmd = strings.ToUpper(cmd)
+
+	for _, pattern := range c.Commands {
+		if match, _ := path.Match(pattern, cmd); match {
+			return true
+		}
+	}
+
+	return false
+}
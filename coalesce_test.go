@@ -0,0 +1,82 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestCoalescingClient(t *testing.T) {
+	var gets int32
+	var sets int32
+	var release = make(chan struct{})
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		switch req.Cmds[0].Cmd {
+		case "GET":
+			atomic.AddInt32(&gets, 1)
+			<-release
+			res.Write("world")
+		case "SET":
+			atomic.AddInt32(&sets, 1)
+			res.Write("OK")
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cli := &redis.CoalescingClient{
+		Client:   &redis.Client{Addr: url, Transport: tr},
+		Commands: []string{"GET"},
+	}
+
+	var wg sync.WaitGroup
+	var values = make([]string, 10)
+
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, err := redis.String(cli.Query(ctx, "GET", "hello"))
+			if err != nil {
+				t.Error(err)
+			}
+			values[i] = s
+		}(i)
+	}
+
+	waitFor(t, ctx, func() bool { return atomic.LoadInt32(&gets) != 0 })
+	// Gives time to the other goroutines to join the in-flight command.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&gets); n != 1 {
+		t.Error("concurrent identical commands must be coalesced into one request, found", n)
+	}
+
+	for _, s := range values {
+		if s != "world" {
+			t.Error("bad value:", s)
+		}
+	}
+
+	for i := 0; i != 3; i++ {
+		if err := cli.Exec(ctx, "SET", "hello", "world"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&sets); n != 3 {
+		t.Error("commands not matching any pattern must not be coalesced, found", n)
+	}
+}
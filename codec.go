@@ -0,0 +1,153 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// A Codec is used by clients to encode structured values to binary strings
+// stored in Redis, and decode them back.
+//
+// Encoded values are prefixed with the codec's content type byte, which allows
+// the client to detect values that were not written with the same codec.
+//
+// Codecs for formats like msgpack or protobuf can be provided by programs by
+// implementing this interface.
+type Codec interface {
+	// ContentType returns the byte identifying values encoded by the codec.
+	ContentType() byte
+
+	// Marshal encodes v, it does not include the content type prefix.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes b into v, the content type prefix has already been
+	// removed from b.
+	Unmarshal(b []byte, v interface{}) error
+}
+
+// JSONCodec is a Codec that encodes values to JSON using the standard
+// encoding/json package.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() byte { return 'j' }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(b []byte, v interface{}) error { return json.Unmarshal(b, v) }
+
+// ContentTypeError is returned when a value read with a codec was encoded with
+// a different content type.
+type ContentTypeError struct {
+	Expect byte
+	Found  byte
+}
+
+// Error satisfies the error interface.
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("redis: expected value with content type %q but found %q", e.Expect, e.Found)
+}
+
+// encodeValues returns a copy of args where structured values were replaced by
+// their encoded representation.
+func encodeValues(codec Codec, args []interface{}) ([]interface{}, error) {
+	var values []interface{}
+
+	for i, arg := range args {
+		if !isCodecValue(reflect.TypeOf(arg)) {
+			continue
+		}
+
+		if values == nil {
+			values = make([]interface{}, len(args))
+			copy(values, args)
+		}
+
+		b, err := codec.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		v := make([]byte, 0, len(b)+1)
+		v = append(v, codec.ContentType())
+		v = append(v, b...)
+		values[i] = v
+	}
+
+	if values == nil {
+		values = args
+	}
+
+	return values, nil
+}
+
+// isCodecValue returns true if values of type t must go through a codec, which
+// is the case for structs or pointers to structs. time.Time is excluded since
+// it is already supported as a plain argument.
+func isCodecValue(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// codecArgs wraps an argument list to decode structured values with a codec.
+type codecArgs struct {
+	Args
+	codec Codec
+	err   error
+}
+
+func (args *codecArgs) Close() error {
+	err := args.Args.Close()
+
+	if err == nil {
+		err = args.err
+	}
+
+	return err
+}
+
+func (args *codecArgs) NextType() Type {
+	return NextType(args.Args)
+}
+
+func (args *codecArgs) Next(dst interface{}) bool {
+	if args.err != nil {
+		return false
+	}
+
+	if t := reflect.TypeOf(dst); t == nil || t.Kind() != reflect.Ptr || !isCodecValue(t.Elem()) {
+		return args.Args.Next(dst)
+	}
+
+	var b []byte
+
+	if !args.Args.Next(&b) {
+		return false
+	}
+
+	if len(b) == 0 || b[0] != args.codec.ContentType() {
+		var found byte
+		if len(b) != 0 {
+			found = b[0]
+		}
+		args.err = &ContentTypeError{Expect: args.codec.ContentType(), Found: found}
+		return false
+	}
+
+	if err := args.codec.Unmarshal(b[1:], dst); err != nil {
+		args.err = err
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,67 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestClientCodec(t *testing.T) {
+	type point struct {
+		X int
+		Y int
+	}
+
+	var mutex sync.Mutex
+	var store = map[string][]byte{}
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var key string
+		var val []byte
+
+		cmd := req.Cmds[0]
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch cmd.Cmd {
+		case "GET":
+			cmd.ParseArgs(&key)
+			res.Write(store[key])
+		case "SET":
+			cmd.ParseArgs(&key, &val)
+			store[key] = val
+			res.Write("OK")
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	ctx := context.Background()
+	cli := &redis.Client{Addr: url, Transport: tr, Codec: redis.JSONCodec}
+
+	if err := cli.Exec(ctx, "SET", "point", point{X: 1, Y: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	var p point
+	if err := redis.ParseArgs(cli.Query(ctx, "GET", "point"), &p); err != nil {
+		t.Error(err)
+	} else if p != (point{X: 1, Y: 2}) {
+		t.Error("bad value:", p)
+	}
+
+	if err := cli.Exec(ctx, "SET", "raw", "{}"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := redis.ParseArgs(cli.Query(ctx, "GET", "raw"), &p)
+	if e, ok := err.(*redis.ContentTypeError); !ok {
+		t.Error("expected a content type error but got", err)
+	} else if e.Found != '{' {
+		t.Errorf("bad content type: %q", e.Found)
+	}
+}
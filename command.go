@@ -177,6 +177,16 @@ func (args *cmdArgsReader) Len() int {
 	return args.dec.Len()
 }
 
+func (args *cmdArgsReader) NextType() Type {
+	if args.err != nil || args.dec.Len() == 0 {
+		return TypeUnknown
+	}
+	if t, _ := args.dec.Parser.ParseType(); t == objconv.Error {
+		return TypeError
+	}
+	return TypeBulk
+}
+
 func (args *cmdArgsReader) Next(val interface{}) bool {
 	args.b = args.b[:0]
 
@@ -0,0 +1,242 @@
+package redis
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CommandClass represents categories of redis commands, used by the proxy to
+// schedule requests toward upstream servers.
+type CommandClass int
+
+const (
+	// ClassRead is the class of commands that don't modify the data set.
+	ClassRead CommandClass = iota
+
+	// ClassWrite is the class of commands that may modify the data set, it is
+	// also the class of unknown commands.
+	ClassWrite
+
+	// ClassAdmin is the class of commands that operate on the server itself
+	// rather than on keys, like CONFIG or BGSAVE.
+	ClassAdmin
+
+	numCommandClasses = 3
+)
+
+// String returns a human-readable representation of c.
+func (c CommandClass) String() string {
+	switch c {
+	case ClassRead:
+		return "read"
+	case ClassWrite:
+		return "write"
+	case ClassAdmin:
+		return "admin"
+	default:
+		return "unknown"
+	}
+}
+
+// ClassOf returns the class of the given command name, derived from the flags
+// of the command in the specification of the standard redis commands.
+// Commands with subcommands have the highest class of their subcommands.
+func ClassOf(cmd string) CommandClass {
+	spec := lookupCommandSpec(cmd)
+	if spec == nil {
+		return ClassWrite
+	}
+	return spec.class
+}
+
+// classOfRequest returns the class of req, which is the highest class of all
+// the commands it contains.
+func classOfRequest(req *Request) CommandClass {
+	class := ClassRead
+
+	for _, cmd := range req.Cmds {
+		if c := ClassOf(cmd.Cmd); c > class {
+			class = c
+		}
+	}
+
+	return class
+}
+
+// classOfFlags returns the class of a command with the given command flags.
+// Commands flagged as neither readonly nor write, like PING or MULTI, don't
+// touch the data set, except scripts which may replicate writes.
+func classOfFlags(flags []string) CommandClass {
+	switch {
+	case contains(flags, "admin"):
+		return ClassAdmin
+	case contains(flags, "readonly"):
+		return ClassRead
+	case contains(flags, "write"), contains(flags, "may_replicate"):
+		return ClassWrite
+	default:
+		return ClassRead
+	}
+}
+
+// commandKeys returns the keys of a command, found by applying the key specs
+// of the command to its arguments, which must be loaded in memory. ok is false
+// when the command is unknown, when its arguments are malformed, or when its
+// keys can't be found from its arguments.
+func commandKeys(cmd string, args [][]byte) (keys [][]byte, ok bool) {
+	spec := lookupCommandSpec(cmd)
+	if spec == nil {
+		return nil, false
+	}
+
+	if spec.subs != nil {
+		if len(args) == 0 {
+			return nil, true
+		}
+		if spec = spec.subs[strings.ToUpper(string(args[0]))]; spec == nil {
+			return nil, false
+		}
+	}
+
+	if getKeys := getKeysFuncs[spec.name]; getKeys != nil {
+		return getKeys(args)
+	}
+
+	// Positions of key specs count the command name, argv[0].
+	argv := make([][]byte, 0, len(args)+1)
+	argv = append(argv, []byte(cmd))
+	argv = append(argv, args...)
+
+	for i := range spec.KeySpecs {
+		k, ok := spec.KeySpecs[i].keys(argv)
+		if !ok {
+			return nil, false
+		}
+		keys = append(keys, k...)
+	}
+
+	return keys, true
+}
+
+// keys returns the keys found by the key spec in argv.
+func (ks *keySpec) keys(argv [][]byte) ([][]byte, bool) {
+	if contains(ks.Flags, "INCOMPLETE") {
+		return nil, false
+	}
+
+	argc := len(argv)
+	first := 0
+
+	switch begin := ks.BeginSearch; {
+	case begin.Index != nil:
+		first = begin.Index.Pos
+
+	case begin.Keyword != nil:
+		// Keywords are searched from the start position, toward the end of
+		// the arguments when it's positive, toward the beginning otherwise.
+		start, step := begin.Keyword.StartFrom, 1
+		if start < 0 {
+			start, step = argc+start, -1
+		}
+		for i := start; i > 0 && i < argc; i += step {
+			if strings.EqualFold(string(argv[i]), begin.Keyword.Keyword) {
+				first = i + 1
+				break
+			}
+		}
+		if first == 0 {
+			return nil, true
+		}
+
+	default:
+		return nil, false
+	}
+
+	last, step := 0, 1
+
+	switch find := ks.FindKeys; {
+	case find.Range != nil:
+		r := find.Range
+		switch {
+		case r.LastKey >= 0:
+			last = first + r.LastKey
+		case r.Limit <= 1:
+			last = argc + r.LastKey
+		default:
+			last = first + (argc-first)/r.Limit + r.LastKey
+		}
+		step = r.Step
+
+	case find.Keynum != nil:
+		k := find.Keynum
+		if first+k.KeyNumIdx >= argc {
+			return nil, false
+		}
+		numkeys, err := strconv.Atoi(string(argv[first+k.KeyNumIdx]))
+		if err != nil || numkeys < 0 {
+			return nil, false
+		}
+		first += k.FirstKey
+		last, step = first+(numkeys-1)*k.KeyStep, k.KeyStep
+
+	default:
+		return nil, false
+	}
+
+	if last >= argc || step <= 0 {
+		return nil, false
+	}
+
+	var keys [][]byte
+	for i := first; i <= last; i += step {
+		keys = append(keys, argv[i])
+	}
+	return keys, true
+}
+
+// getKeysFuncs are the functions finding the keys of the commands whose key
+// specs are incomplete, indexed by command name.
+var getKeysFuncs = map[string]func(args [][]byte) ([][]byte, bool){
+	"sort":    sortKeys,
+	"sort_ro": sortKeys,
+}
+
+// sortKeys returns the keys of SORT: the sorted key, and the destination of
+// the STORE option. Like in redis, the keys named by the patterns of the BY and
+// GET options are not reported.
+func sortKeys(args [][]byte) ([][]byte, bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+
+	keys := [][]byte{args[0]}
+	store := -1
+
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "LIMIT":
+			i += 2
+		case "BY", "GET":
+			i++
+		case "STORE":
+			if i+1 < len(args) {
+				store = i + 1
+			}
+			i++
+		}
+	}
+
+	if store >= 0 {
+		keys = append(keys, args[store])
+	}
+	return keys, true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
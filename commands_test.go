@@ -0,0 +1,37 @@
+package redis_test
+
+import (
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestClassOf(t *testing.T) {
+	tests := []struct {
+		cmd   string
+		class redis.CommandClass
+	}{
+		{cmd: "GET", class: redis.ClassRead},
+		{cmd: "get", class: redis.ClassRead},
+		{cmd: "XREAD", class: redis.ClassRead},
+		{cmd: "PFCOUNT", class: redis.ClassRead},
+		{cmd: "EVAL_RO", class: redis.ClassRead},
+		{cmd: "PING", class: redis.ClassRead},
+		{cmd: "OBJECT", class: redis.ClassRead},
+		{cmd: "SET", class: redis.ClassWrite},
+		{cmd: "XADD", class: redis.ClassWrite},
+		{cmd: "EVAL", class: redis.ClassWrite},
+		{cmd: "PUBLISH", class: redis.ClassWrite},
+		{cmd: "FUNCTION", class: redis.ClassWrite},
+		{cmd: "HELLO.WORLD", class: redis.ClassWrite},
+		{cmd: "CONFIG", class: redis.ClassAdmin},
+		{cmd: "CLUSTER", class: redis.ClassAdmin},
+		{cmd: "SHUTDOWN", class: redis.ClassAdmin},
+	}
+
+	for _, test := range tests {
+		if class := redis.ClassOf(test.cmd); class != test.class {
+			t.Errorf("%s: expected class %s but got %s", test.cmd, test.class, class)
+		}
+	}
+}
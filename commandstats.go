@@ -0,0 +1,228 @@
+package redis
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandStats records the number of calls and the time spent serving each
+// command, and renders them in the format of the commandstats section of the
+// INFO command, so the dashboards and exporters built for redis work unchanged
+// against custom servers and proxies:
+//
+//	# Commandstats
+//	cmdstat_get:calls=21,usec=175,usec_per_call=8.33
+//	cmdstat_set:calls=4,usec=52,usec_per_call=13.00
+//
+// Servers and proxies configured with a CommandStats value answer INFO
+// commandstats themselves, other INFO sections are passed to the handler.
+// Servers also add the section to the responses of their handler to INFO,
+// INFO default, INFO all and INFO everything, replacing the commandstats
+// section that the responses may already have.
+//
+// CommandStats values must not be copied after first use.
+type CommandStats struct {
+	mutex sync.Mutex
+	stats map[string]*CommandStat
+}
+
+// CommandStat carries the statistics of a single command.
+type CommandStat struct {
+	// Calls is the number of times the command was called.
+	Calls int64
+
+	// Usec is the total time spent serving the command, in microseconds.
+	Usec int64
+}
+
+// UsecPerCall returns the average time spent serving the command, in
+// microseconds.
+func (s CommandStat) UsecPerCall() float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+	return float64(s.Usec) / float64(s.Calls)
+}
+
+// Observe records a call to cmd which took the given amount of time. Command
+// names are case insensitive. The method is safe to call on a nil value, it
+// does nothing in that case.
+func (c *CommandStats) Observe(cmd string, elapsed time.Duration) {
+	if c == nil {
+		return
+	}
+
+	name := strings.ToLower(cmd)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stats == nil {
+		c.stats = make(map[string]*CommandStat)
+	}
+
+	stat := c.stats[name]
+	if stat == nil {
+		stat = &CommandStat{}
+		c.stats[name] = stat
+	}
+
+	stat.Calls++
+	stat.Usec += elapsed.Microseconds()
+}
+
+// Stats returns a snapshot of the statistics, indexed by lower-case command
+// names.
+func (c *CommandStats) Stats() map[string]CommandStat {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := make(map[string]CommandStat, len(c.stats))
+	for name, stat := range c.stats {
+		stats[name] = *stat
+	}
+	return stats
+}
+
+// Reset clears the statistics, like CONFIG RESETSTAT does on redis.
+func (c *CommandStats) Reset() {
+	c.mutex.Lock()
+	c.stats = nil
+	c.mutex.Unlock()
+}
+
+// WriteInfo writes the commandstats section of INFO to w, commands are sorted
+// by name.
+func (c *CommandStats) WriteInfo(w io.Writer) error {
+	stats := c.Stats()
+	names := make([]string, 0, len(stats))
+
+	for name := range stats {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	b := &bytes.Buffer{}
+	b.WriteString("# Commandstats\r\n")
+
+	for _, name := range names {
+		s := stats[name]
+		fmt.Fprintf(b, "cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f\r\n", name, s.Calls, s.Usec, s.UsecPerCall())
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// observeRequest records the commands of req, the elapsed time is divided
+// between the commands of transactions.
+func (c *CommandStats) observeRequest(req *Request, elapsed time.Duration) {
+	if c == nil || len(req.Cmds) == 0 {
+		return
+	}
+
+	elapsed /= time.Duration(len(req.Cmds))
+
+	for _, cmd := range req.Cmds {
+		c.Observe(cmd.Cmd, elapsed)
+	}
+}
+
+// serveInfo writes the commandstats section of INFO as a bulk string.
+func (c *CommandStats) serveInfo(res ResponseWriter) error {
+	b := &bytes.Buffer{}
+	c.WriteInfo(b)
+	return res.Write(b.Bytes())
+}
+
+// infoResponseWriter adds the commandstats section to the response of a
+// handler to INFO.
+type infoResponseWriter struct {
+	ResponseWriter
+	stats  *CommandStats
+	stream bool
+}
+
+func (w *infoResponseWriter) WriteStream(n int) error {
+	w.stream = true
+	return w.ResponseWriter.WriteStream(n)
+}
+
+func (w *infoResponseWriter) Write(v interface{}) error {
+	if !w.stream {
+		switch info := v.(type) {
+		case string:
+			v = w.stats.mergeInfo(info)
+		case []byte:
+			v = w.stats.mergeInfo(string(info))
+		}
+	}
+	return w.ResponseWriter.Write(v)
+}
+
+// mergeInfo returns the response to INFO with the commandstats section of c,
+// which replaces the commandstats section of info if it has one.
+func (c *CommandStats) mergeInfo(info string) []byte {
+	const header = "# Commandstats\r\n"
+
+	b := &bytes.Buffer{}
+
+	if i := strings.Index(info, header); i >= 0 {
+		b.WriteString(info[:i])
+		c.WriteInfo(b)
+
+		// The sections following commandstats are separated by an empty line.
+		if rest := info[i+len(header):]; strings.Contains(rest, "\r\n\r\n") {
+			b.WriteString(rest[strings.Index(rest, "\r\n\r\n")+2:])
+		}
+
+		return b.Bytes()
+	}
+
+	b.WriteString(info)
+
+	if len(info) != 0 {
+		if !strings.HasSuffix(info, "\r\n") {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("\r\n")
+	}
+
+	c.WriteInfo(b)
+	return b.Bytes()
+}
+
+// isInfoRequest returns true if req is an INFO command requesting the default
+// sections or all of them, which include commandstats.
+func isInfoRequest(req *Request) bool {
+	if len(req.Cmds) != 1 || !strings.EqualFold(req.Cmds[0].Cmd, "INFO") {
+		return false
+	}
+
+	section, ok := peekArg(&req.Cmds[0])
+	if !ok {
+		return true
+	}
+
+	switch strings.ToLower(section) {
+	case "default", "all", "everything":
+		return true
+	default:
+		return false
+	}
+}
+
+// isCommandStatsRequest returns true if req is an INFO commandstats command.
+func isCommandStatsRequest(req *Request) bool {
+	if len(req.Cmds) != 1 || !strings.EqualFold(req.Cmds[0].Cmd, "INFO") {
+		return false
+	}
+	section, ok := peekArg(&req.Cmds[0])
+	return ok && strings.EqualFold(section, "commandstats")
+}
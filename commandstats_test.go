@@ -0,0 +1,149 @@
+package redis_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestCommandStats(t *testing.T) {
+	stats := &redis.CommandStats{}
+	stats.Observe("GET", 10*time.Microsecond)
+	stats.Observe("get", 15*time.Microsecond)
+	stats.Observe("GET", 0)
+	stats.Observe("SET", 13*time.Microsecond)
+
+	b := &bytes.Buffer{}
+	if err := stats.WriteInfo(b); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "# Commandstats\r\n" +
+		"cmdstat_get:calls=3,usec=25,usec_per_call=8.33\r\n" +
+		"cmdstat_set:calls=1,usec=13,usec_per_call=13.00\r\n"
+
+	if s := b.String(); s != expect {
+		t.Errorf("bad commandstats section:\n%q\n%q", s, expect)
+	}
+
+	stats.Reset()
+
+	if s := stats.Stats(); len(s) != 0 {
+		t.Error("the statistics must be cleared after a reset:", s)
+	}
+}
+
+func TestServerCommandStats(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			switch req.Cmds[0].Cmd {
+			case "INFO":
+				var section string
+				if req.Cmds[0].ParseArgs(&section); section == "all" {
+					// The commandstats section of the handler is replaced.
+					res.Write("# Server\r\nredis_version:7.0.0\r\n\r\n" +
+						"# Commandstats\r\ncmdstat_handler:calls=1,usec=1,usec_per_call=1.00\r\n\r\n" +
+						"# Keyspace\r\n")
+				} else {
+					res.Write("# Server\r\nredis_version:7.0.0\r\n")
+				}
+			default:
+				res.Write("OK")
+			}
+		}),
+		CommandStats: &redis.CommandStats{},
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	testCommandStats(t, l.Addr().String())
+
+	tr := &redis.Transport{NoClientInfo: true}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: l.Addr().String(), Transport: tr}
+
+	// The section is also part of the sections returned by default and by
+	// INFO all, along with the sections of the handler.
+	match := regexp.MustCompile(`^# Server\r\nredis_version:7\.0\.0\r\n\r\n` +
+		`# Commandstats\r\n` +
+		`cmdstat_get:calls=3,usec=\d+,usec_per_call=\d+\.\d\d\r\n` +
+		`(cmdstat_info:calls=\d,usec=\d+,usec_per_call=\d+\.\d\d\r\n)?` +
+		`cmdstat_set:calls=1,usec=\d+,usec_per_call=\d+\.\d\d\r\n` +
+		`(\r\n# Keyspace\r\n)?$`)
+
+	for _, args := range [][]interface{}{nil, {"all"}} {
+		info, err := redis.String(cli.Query(context.Background(), "INFO", args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !match.MatchString(info) {
+			t.Errorf("bad response to INFO %v: %q", args, info)
+		}
+	}
+}
+
+func TestReverseProxyCommandStats(t *testing.T) {
+	upstream, upstreamURL := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("OK")
+	}))
+	defer upstream.Close()
+
+	transport := &redis.Transport{}
+	defer transport.CloseIdleConnections()
+
+	srv, serverURL := newServer(&redis.ReverseProxy{
+		Transport:    transport,
+		Registry:     redis.ServerEndpoint{Addr: upstreamURL},
+		ErrorLog:     log.New(os.Stderr, "proxy commandstats test ==> ", 0),
+		CommandStats: &redis.CommandStats{},
+	})
+	defer srv.Close()
+
+	testCommandStats(t, serverURL)
+}
+
+// testCommandStats sends commands to the server at addr, and verifies that
+// they are reported by INFO commandstats.
+func testCommandStats(t *testing.T, addr string) {
+	tr := &redis.Transport{NoClientInfo: true}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+	ctx := context.Background()
+
+	for i := 0; i != 3; i++ {
+		if err := cli.Exec(ctx, "GET", "hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cli.Exec(ctx, "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := redis.String(cli.Query(ctx, "INFO", "commandstats"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match := regexp.MustCompile(`^# Commandstats\r\n` +
+		`cmdstat_get:calls=3,usec=\d+,usec_per_call=\d+\.\d\d\r\n` +
+		`cmdstat_set:calls=1,usec=\d+,usec_per_call=\d+\.\d\d\r\n$`)
+
+	if !match.MatchString(info) {
+		t.Errorf("bad commandstats section: %q", info)
+	}
+}
@@ -0,0 +1,202 @@
+package redis
+
+import (
+	"compress/flate"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+// compressionAlgorithm is the only algorithm supported by the compression
+// negotiated between clients and servers of this package.
+const compressionAlgorithm = "deflate"
+
+// negotiate asks the server that c is connected to for compressing and/or
+// checksumming the traffic of the connection, with a HELLO command carrying
+// the COMPRESS and CHECKSUM attributes. Servers which don't support these
+// attributes, like vanilla redis, reply with an error and the connection is
+// left unchanged. Servers of this package only enable the features they were
+// configured with, and report them in their response.
+func (c *Conn) negotiate(compression bool, checksum bool) error {
+	args := []interface{}{2}
+
+	if compression {
+		args = append(args, "COMPRESS", compressionAlgorithm)
+	}
+
+	if checksum {
+		args = append(args, "CHECKSUM", checksumAlgorithm)
+	}
+
+	if err := c.WriteCommands(Command{Cmd: "HELLO", Args: List(args...)}); err != nil {
+		return err
+	}
+
+	var values []interface{}
+	var value interface{}
+	var reply = c.ReadArgs()
+
+	for reply.Next(&value) {
+		values = append(values, value)
+		value = nil
+	}
+
+	switch err := reply.Close(); err.(type) {
+	case nil:
+	case *resp.Error:
+		return nil
+	default:
+		return err
+	}
+
+	compression, checksum = false, false
+
+	for i := 0; i+1 < len(values); i += 2 {
+		switch key, val := fmt.Sprintf("%s", values[i]), fmt.Sprintf("%s", values[i+1]); {
+		case key == "compress" && val == compressionAlgorithm:
+			compression = true
+		case key == "checksum" && val == checksumAlgorithm:
+			checksum = true
+		}
+	}
+
+	// The checksums are computed on the data sent over the network, which
+	// is compressed when both features are enabled.
+	if checksum {
+		c.checksum()
+	}
+
+	if compression {
+		c.compress()
+	}
+
+	return nil
+}
+
+// serveHello handles HELLO commands on servers which support compression or
+// checksums, returning false if the command carried neither the COMPRESS nor
+// the CHECKSUM attribute, in which case it must be passed to the handler.
+func (s *Server) serveHello(c *Conn, res *responseWriter, req *Request) (bool, error) {
+	args, err := readStrings(req.Cmds[0].Args)
+	if err != nil {
+		return true, writeError(res, err)
+	}
+
+	compression, checksum := "", ""
+
+	for i := 0; i+1 < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "COMPRESS"):
+			compression = args[i+1]
+		case strings.EqualFold(args[i], "CHECKSUM"):
+			checksum = args[i+1]
+		}
+	}
+
+	if len(compression) == 0 && len(checksum) == 0 {
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			values[i] = arg
+		}
+		req.Cmds[0].Args = List(values...)
+		return false, nil
+	}
+
+	if len(compression) != 0 && compression != compressionAlgorithm {
+		return true, writeError(res, resp.NewError(fmt.Sprintf("ERR unsupported compression algorithm '%s'", compression)))
+	}
+
+	if len(checksum) != 0 && checksum != checksumAlgorithm {
+		return true, writeError(res, resp.NewError(fmt.Sprintf("ERR unsupported checksum algorithm '%s'", checksum)))
+	}
+
+	compress := len(compression) != 0 && s.Compression
+	verify := len(checksum) != 0 && s.Checksum
+
+	n := 4
+	if compress {
+		n += 2
+	}
+	if verify {
+		n += 2
+	}
+
+	res.WriteStream(n)
+	res.Write("server")
+	res.Write("redis-go")
+	res.Write("proto")
+	res.Write(2)
+
+	if compress {
+		res.Write("compress")
+		res.Write(compressionAlgorithm)
+	}
+
+	if verify {
+		res.Write("checksum")
+		res.Write(checksumAlgorithm)
+	}
+
+	if err := res.Flush(); err != nil {
+		return true, err
+	}
+
+	// The client waits for the response before sending transformed data, so
+	// nothing was buffered past the HELLO command.
+	if verify {
+		c.checksum()
+	}
+
+	if compress {
+		c.compress()
+	}
+
+	return true, nil
+}
+
+func isHelloRequest(req *Request) bool {
+	return len(req.Cmds) == 1 && strings.EqualFold(req.Cmds[0].Cmd, "HELLO")
+}
+
+// compress switches c to compressing the data it writes and decompressing the
+// data it reads. It must only be called when no data is buffered.
+func (c *Conn) compress() {
+	c.conn = newCompressedConn(c.conn)
+	c.rbuffer.Reset(c.conn)
+	c.wbuffer.Reset(c.conn)
+}
+
+// compressedConn is a net.Conn which compresses the data it writes and
+// decompresses the data it reads with the deflate algorithm. Each write is
+// flushed so the peer can decode it without waiting for more data.
+//
+// Read errors, including timeouts, are not recoverable.
+type compressedConn struct {
+	net.Conn
+	r io.ReadCloser
+	w *flate.Writer
+}
+
+func newCompressedConn(c net.Conn) *compressedConn {
+	w, _ := flate.NewWriter(c, flate.BestSpeed)
+	return &compressedConn{
+		Conn: c,
+		r:    flate.NewReader(c),
+		w:    w,
+	}
+}
+
+func (c *compressedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *compressedConn) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	if err == nil {
+		err = c.w.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,234 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerConfig carries the subset of redis.conf directives supported by
+// Server. It eases the migration of deployments replacing a redis instance
+// with a custom server built on this package, which can keep using their
+// existing configuration files.
+type ServerConfig struct {
+	// Bind is the list of addresses set by the bind directive.
+	Bind []string
+
+	// Port is the value of the port directive, 6379 if not set.
+	Port int
+
+	// Timeout is the value of the timeout directive, the amount of time after
+	// which idle connections are closed. Zero means no timeout.
+	Timeout time.Duration
+
+	// TCPKeepAlive is the value of the tcp-keepalive directive.
+	TCPKeepAlive time.Duration
+
+	// MaxClients is the value of the maxclients directive.
+	MaxClients int
+
+	// RequirePass is the value of the requirepass directive.
+	RequirePass string
+
+	// RenameCommands maps commands to their new names, as set by the
+	// rename-command directives. An empty name disables the command.
+	RenameCommands map[string]string
+
+	// Ignored lists the directives that were read but are not supported, in
+	// the order they appeared. Programs may log them to help with migrations.
+	Ignored []string
+}
+
+// LoadServerConfig reads the redis configuration file at path.
+func LoadServerConfig(path string) (*ServerConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadServerConfig(f)
+}
+
+// ReadServerConfig reads a redis configuration from r, in the redis.conf
+// format. Empty lines and comments are skipped, and unsupported directives are
+// recorded in the Ignored field of the returned configuration.
+func ReadServerConfig(r io.Reader) (*ServerConfig, error) {
+	config := &ServerConfig{Port: 6379}
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		args, err := splitConfigLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("redis: line %d of the configuration: %s", lineno, err)
+		}
+
+		if err := config.set(strings.ToLower(args[0]), args[1:]); err != nil {
+			return nil, fmt.Errorf("redis: line %d of the configuration: %s: %s", lineno, args[0], err)
+		}
+	}
+
+	return config, scanner.Err()
+}
+
+func (config *ServerConfig) set(directive string, args []string) (err error) {
+	arity := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("expected %d argument(s) but got %d", n, len(args))
+		}
+		return nil
+	}
+
+	seconds := func() (time.Duration, error) {
+		if err := arity(1); err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of seconds: %q", args[0])
+		}
+		return time.Duration(n) * time.Second, nil
+	}
+
+	integer := func() (int, error) {
+		if err := arity(1); err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number: %q", args[0])
+		}
+		return n, nil
+	}
+
+	switch directive {
+	case "bind":
+		if len(args) == 0 {
+			return fmt.Errorf("expected at least one address")
+		}
+		config.Bind = append([]string{}, args...)
+
+	case "port":
+		config.Port, err = integer()
+
+	case "timeout":
+		config.Timeout, err = seconds()
+
+	case "tcp-keepalive":
+		config.TCPKeepAlive, err = seconds()
+
+	case "maxclients":
+		config.MaxClients, err = integer()
+
+	case "requirepass":
+		if err = arity(1); err == nil {
+			config.RequirePass = args[0]
+		}
+
+	case "rename-command":
+		if err = arity(2); err == nil {
+			if config.RenameCommands == nil {
+				config.RenameCommands = make(map[string]string)
+			}
+			config.RenameCommands[strings.ToUpper(args[0])] = args[1]
+		}
+
+	default:
+		config.Ignored = append(config.Ignored, directive)
+	}
+
+	return
+}
+
+// Addr returns the address that a server configured with config listens on.
+// Only the first address of the bind directive is used since servers listen
+// on a single address, the "*" wildcard listens on all interfaces.
+func (config *ServerConfig) Addr() string {
+	host := ""
+
+	if len(config.Bind) != 0 {
+		host = strings.TrimPrefix(config.Bind[0], "-") // "-" marks optional addresses
+	}
+
+	if host == "*" {
+		host = ""
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(config.Port))
+}
+
+// Apply sets the options of s from the configuration.
+func (config *ServerConfig) Apply(s *Server) {
+	s.Addr = config.Addr()
+	s.IdleTimeout = config.Timeout
+	s.KeepAlive = config.TCPKeepAlive
+	s.MaxClients = config.MaxClients
+	s.RequirePass = config.RequirePass
+	s.RenameCommands = config.RenameCommands
+}
+
+// splitConfigLine splits a line of configuration into its directive and
+// arguments, arguments may be quoted to contain spaces.
+func splitConfigLine(line string) ([]string, error) {
+	var args []string
+
+	for {
+		line = strings.TrimLeft(line, " \t")
+
+		if len(line) == 0 {
+			return args, nil
+		}
+
+		var arg string
+
+		switch quote := line[0]; quote {
+		case '"', '\'':
+			end := 1
+
+			for end < len(line) && line[end] != quote {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+
+			if end >= len(line) {
+				return nil, fmt.Errorf("unbalanced quotes")
+			}
+
+			arg = line[1:end]
+			line = line[end+1:]
+
+			if quote == '"' {
+				s, err := strconv.Unquote(`"` + arg + `"`)
+				if err != nil {
+					return nil, fmt.Errorf("invalid quoted string: %s", arg)
+				}
+				arg = s
+			} else {
+				arg = strings.Replace(arg, `\'`, `'`, -1)
+			}
+
+		default:
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			arg, line = line[:end], line[end:]
+		}
+
+		args = append(args, arg)
+	}
+}
@@ -0,0 +1,98 @@
+package redis_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestReadServerConfig(t *testing.T) {
+	config, err := redis.ReadServerConfig(strings.NewReader(`
+# a redis.conf file
+bind 127.0.0.1 -::1
+port 6380
+timeout 300
+tcp-keepalive 60
+maxclients 1000
+requirepass "hello world"
+rename-command config ""
+rename-command flushall 'secret-flushall'
+save 900 1
+appendonly yes
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &redis.ServerConfig{
+		Bind:         []string{"127.0.0.1", "-::1"},
+		Port:         6380,
+		Timeout:      300 * time.Second,
+		TCPKeepAlive: 60 * time.Second,
+		MaxClients:   1000,
+		RequirePass:  "hello world",
+		RenameCommands: map[string]string{
+			"CONFIG":   "",
+			"FLUSHALL": "secret-flushall",
+		},
+		Ignored: []string{"save", "appendonly"},
+	}
+
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("bad configuration:\n%#v\n%#v", expected, config)
+	}
+
+	srv := &redis.Server{}
+	config.Apply(srv)
+
+	if srv.Addr != "127.0.0.1:6380" {
+		t.Error("bad address:", srv.Addr)
+	}
+
+	if srv.IdleTimeout != 300*time.Second || srv.KeepAlive != 60*time.Second {
+		t.Error("bad timeouts:", srv.IdleTimeout, srv.KeepAlive)
+	}
+
+	if srv.MaxClients != 1000 || srv.RequirePass != "hello world" {
+		t.Error("bad limits:", srv.MaxClients, srv.RequirePass)
+	}
+}
+
+func TestReadServerConfigError(t *testing.T) {
+	tests := []string{
+		"port abc",
+		"timeout -1",
+		"requirepass",
+		`requirepass "unbalanced`,
+		"rename-command config",
+	}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			if _, err := redis.ReadServerConfig(strings.NewReader(test)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestServerConfigAddr(t *testing.T) {
+	tests := []struct {
+		config redis.ServerConfig
+		addr   string
+	}{
+		{config: redis.ServerConfig{Port: 6379}, addr: ":6379"},
+		{config: redis.ServerConfig{Bind: []string{"*"}, Port: 6379}, addr: ":6379"},
+		{config: redis.ServerConfig{Bind: []string{"::1"}, Port: 6379}, addr: "[::1]:6379"},
+	}
+
+	for _, test := range tests {
+		if addr := test.config.Addr(); addr != test.addr {
+			t.Errorf("bad address: %q != %q", addr, test.addr)
+		}
+	}
+}
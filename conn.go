@@ -4,14 +4,20 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/segmentio/objconv"
 	"github.com/segmentio/objconv/resp"
 )
 
+// DefaultBufferSize is the default size of the read and write buffers of
+// connections.
+const DefaultBufferSize = 4096
+
 var (
 	// ErrDiscard is the error returned to indicate that transactions are
 	// discarded.
@@ -30,7 +36,32 @@ type Conn struct {
 	wmutex  sync.Mutex
 	wbuffer bufio.Writer
 	encoder objconv.StreamEncoder
-	emitter resp.ClientEmitter
+	emitter argEmitter
+
+	// When strict is true, values read from the connection aren't coerced to
+	// the type of the destination they are decoded into.
+	strict bool
+
+	// options configures the types of values decoded into interface{}.
+	options DecodeOptions
+
+	// werr is the error that caused the connection to be closed while writing
+	// commands, it is reported by reads that fail because of the closed
+	// connection.
+	emutex sync.Mutex
+	werr   error
+
+	// rerr is the first error that caused the connection to be closed while
+	// reading responses, it is reported for the commands of a pipeline which
+	// were not answered.
+	rerr error
+
+	// created is the time the connection was established, and idleSince the
+	// time it was put in the pool of a transport, they are used to recycle
+	// the connections of the pool. idleSince is protected by the mutex of the
+	// pool.
+	created   time.Time
+	idleSince time.Time
 }
 
 // Dial connects to the redis server at the given address, returing a new client
@@ -43,7 +74,7 @@ func Dial(network string, address string) (*Conn, error) {
 // redis connection. Connecting may be asynchronously cancelled by the context
 // passed as first argument.
 func DialContext(ctx context.Context, network string, address string) (*Conn, error) {
-	c, err := (&net.Dialer{}).DialContext(ctx, network, address)
+	c, err := DefaultDialer.DialContext(ctx, network, address)
 	if err != nil {
 		return nil, err
 	}
@@ -53,30 +84,51 @@ func DialContext(ctx context.Context, network string, address string) (*Conn, er
 // NewClientConn creates a new redis connection from an already open client
 // connections.
 func NewClientConn(conn net.Conn) *Conn {
-	c := &Conn{
-		conn:    conn,
-		rbuffer: *bufio.NewReader(conn),
-		wbuffer: *bufio.NewWriter(conn),
-	}
-	c.parser.Reset(&c.rbuffer)
-	c.emitter.Reset(&c.wbuffer)
-	c.decoder = objconv.StreamDecoder{Parser: &c.parser}
-	c.encoder = objconv.StreamEncoder{Emitter: &c.emitter}
-	return c
+	return newClientConn(conn, 0, 0)
 }
 
 // NewServerConn creates a new redis connection from an already open server
 // connections.
 func NewServerConn(conn net.Conn) *Conn {
+	return newServerConn(conn, 0, 0)
+}
+
+func newClientConn(conn net.Conn, readBufferSize int, writeBufferSize int) *Conn {
+	c := newConn(conn, readBufferSize, writeBufferSize)
+	c.encoder = objconv.StreamEncoder{Emitter: &c.emitter}
+	return c
+}
+
+func newServerConn(conn net.Conn, readBufferSize int, writeBufferSize int) *Conn {
+	c := newConn(conn, readBufferSize, writeBufferSize)
+	c.encoder = objconv.StreamEncoder{Emitter: &c.emitter.Emitter}
+	return c
+}
+
+// newConn creates a connection with read and write buffers of the given sizes,
+// zero or negative sizes select DefaultBufferSize.
+//
+// The buffers bound the memory used by the connection: commands and values
+// larger than the write buffer are written across multiple flushes, and
+// values are read through the read buffer as they are decoded.
+func newConn(conn net.Conn, readBufferSize int, writeBufferSize int) *Conn {
+	if readBufferSize <= 0 {
+		readBufferSize = DefaultBufferSize
+	}
+
+	if writeBufferSize <= 0 {
+		writeBufferSize = DefaultBufferSize
+	}
+
 	c := &Conn{
 		conn:    conn,
-		rbuffer: *bufio.NewReader(conn),
-		wbuffer: *bufio.NewWriter(conn),
+		rbuffer: *bufio.NewReaderSize(conn, readBufferSize),
+		wbuffer: *bufio.NewWriterSize(conn, writeBufferSize),
+		created: time.Now(),
 	}
 	c.parser.Reset(&c.rbuffer)
 	c.emitter.Reset(&c.wbuffer)
 	c.decoder = objconv.StreamDecoder{Parser: &c.parser}
-	c.encoder = objconv.StreamEncoder{Emitter: &c.emitter.Emitter}
 	return c
 }
 
@@ -197,6 +249,8 @@ func (c *Conn) ReadArgs() Args {
 	return &connArgs{
 		conn:    c,
 		decoder: c.decoder,
+		strict:  c.strict,
+		options: c.options,
 	}
 }
 
@@ -230,6 +284,10 @@ func (c *Conn) ReadTxArgs(n int) TxArgs {
 	}
 
 	if err != nil {
+		if err == io.EOF {
+			err = ErrServerClosed
+		}
+
 		c.conn.Close()
 		c.rmutex.Unlock()
 
@@ -241,6 +299,36 @@ func (c *Conn) ReadTxArgs(n int) TxArgs {
 	return tx
 }
 
+// ReadPipelineArgs opens a stream to read the arguments in response to n
+// pipelined commands. The argument lists returned by the TxArgs' Next method
+// read the responses of the commands in the order they were sent, errors
+// returned by the server for one command are reported by the Close method of
+// its argument list and don't affect the other commands.
+//
+// Like ReadTxArgs, the method never returns a nil object.
+func (c *Conn) ReadPipelineArgs(n int) TxArgs {
+	c.rmutex.Lock()
+
+	tx := &txArgs{
+		conn: c,
+		args: make([]Args, n),
+	}
+
+	// Each response is a separate value on the connection, the argument lists
+	// are consumed in order so they can all share the parser.
+	for i := range tx.args {
+		tx.args[i] = &connArgs{
+			conn:    c,
+			tx:      tx,
+			decoder: objconv.StreamDecoder{Parser: &c.parser},
+			strict:  c.strict,
+			options: c.options,
+		}
+	}
+
+	return tx
+}
+
 func (c *Conn) readMultiArgs(tx *txArgs) (err error) {
 	status, error, err := c.readTxStatus()
 
@@ -321,7 +409,7 @@ func (c *Conn) readTxArgs(tx *txArgs, i int, n int) (int, error) {
 		tx.args[i] = &connArgs{tx: tx, respErr: error}
 
 	case status == "QUEUED":
-		tx.args[i] = &connArgs{conn: c, tx: tx, decoder: c.decoder}
+		tx.args[i] = &connArgs{conn: c, tx: tx, decoder: c.decoder, strict: c.strict, options: c.options}
 		n++
 
 	default:
@@ -375,6 +463,24 @@ func (c *Conn) WriteArgs(args Args) error {
 	return err
 }
 
+// writeValue writes a single value to c, unlike WriteArgs it doesn't wrap the
+// value in an array.
+func (c *Conn) writeValue(val interface{}) error {
+	c.wmutex.Lock()
+	err := resp.NewEncoder(&c.wbuffer).Encode(val)
+
+	if err == nil {
+		err = c.wbuffer.Flush()
+	}
+
+	if err != nil {
+		c.conn.Close()
+	}
+
+	c.wmutex.Unlock()
+	return err
+}
+
 // WriteCommands writes a set of commands to c.
 //
 // This is a low-level API intended to be called to write a set of client
@@ -390,6 +496,13 @@ func (c *Conn) WriteArgs(args Args) error {
 // however it is not enforced at the connection level, applications are expected
 // to respect the protocol semantics.
 func (c *Conn) WriteCommands(cmds ...Command) error {
+	return c.writeCommands(cmds, true)
+}
+
+// writeCommands is like WriteCommands but leaves the commands in the write
+// buffer when flush is false, so they are sent with the commands of a later
+// call.
+func (c *Conn) writeCommands(cmds []Command, flush bool) error {
 	var err error
 	c.wmutex.Lock()
 
@@ -400,11 +513,12 @@ func (c *Conn) WriteCommands(cmds ...Command) error {
 		}
 	}
 
-	if err == nil {
+	if err == nil && flush {
 		err = c.wbuffer.Flush()
 	}
 
 	if err != nil {
+		c.setWriteError(err)
 		c.conn.Close()
 
 		for _, cmd := range cmds {
@@ -418,6 +532,29 @@ func (c *Conn) WriteCommands(cmds ...Command) error {
 	return err
 }
 
+func (c *Conn) setWriteError(err error) {
+	c.emutex.Lock()
+	c.werr = err
+	c.emutex.Unlock()
+}
+
+func (c *Conn) writeError() error {
+	c.emutex.Lock()
+	defer c.emutex.Unlock()
+	return c.werr
+}
+
+// setReadError records err as the read error of c if none was recorded yet,
+// and returns the recorded error.
+func (c *Conn) setReadError(err error) error {
+	c.emutex.Lock()
+	defer c.emutex.Unlock()
+	if c.rerr == nil {
+		c.rerr = err
+	}
+	return c.rerr
+}
+
 func (c *Conn) writeCommand(cmd *Command) (err error) {
 	var n int
 
@@ -470,6 +607,17 @@ func (c *Conn) encodeArgs(args Args) (err error) {
 	return
 }
 
+// isStableError returns true if err is an error which leaves the connection it
+// occurred on in a stable state, such as redis protocol errors.
+func isStableError(err error) bool {
+	switch err.(type) {
+	case *resp.Error, *TypeMismatchError:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *Conn) resetEncoder() {
 	c.encoder = objconv.StreamEncoder{Emitter: c.encoder.Emitter}
 }
@@ -480,7 +628,7 @@ func (c *Conn) resetDecoder() {
 
 func (c *Conn) waitReadyRead(timeout time.Duration) (err error) {
 	c.rmutex.Lock()
-	if c.rbuffer.Buffered() == 0 {
+	if c.buffered() == 0 {
 		c.setReadTimeout(timeout)
 		_, err = c.rbuffer.Peek(1)
 		c.setReadTimeout(0)
@@ -489,6 +637,61 @@ func (c *Conn) waitReadyRead(timeout time.Duration) (err error) {
 	return
 }
 
+// waitResponse blocks until the next response starts arriving on c, without
+// setting a deadline on the connection.
+func (c *Conn) waitResponse() (err error) {
+	c.rmutex.Lock()
+	if c.buffered() == 0 {
+		_, err = c.rbuffer.Peek(1)
+	}
+	c.rmutex.Unlock()
+	return
+}
+
+// watchClose starts watching c for the peer closing the connection, calling
+// cancel when it happens. The returned function stops watching and must be
+// called before reading from c again. Connections with buffered data are not
+// watched since the peer has already sent its next commands.
+func (c *Conn) watchClose(cancel context.CancelFunc) (stop func()) {
+	if c.buffered() != 0 {
+		return func() {}
+	}
+
+	var stopped int32
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		if _, err := c.rbuffer.Peek(1); err != nil && atomic.LoadInt32(&stopped) == 0 {
+			cancel()
+		}
+	}()
+
+	return func() {
+		atomic.StoreInt32(&stopped, 1)
+		// Expiring the read deadline unblocks the read, the buffer retains the
+		// data that it may have received.
+		c.conn.SetReadDeadline(time.Now())
+		<-done
+		c.setReadTimeout(0)
+	}
+}
+
+// buffered returns the number of bytes that can be read from c without doing
+// any I/O, the parser reads ahead so pipelined commands may be buffered there
+// as well.
+func (c *Conn) buffered() int {
+	n := c.rbuffer.Buffered()
+
+	if r, ok := c.parser.Buffered().(interface {
+		Len() int
+	}); ok {
+		n += r.Len()
+	}
+
+	return n
+}
+
 func (c *Conn) setTimeout(timeout time.Duration) {
 	if timeout == 0 {
 		c.conn.SetDeadline(time.Time{})
@@ -519,6 +722,9 @@ type connArgs struct {
 	conn    *Conn
 	tx      *txArgs
 	respErr *resp.Error
+	typeErr *TypeMismatchError
+	strict  bool
+	options DecodeOptions
 }
 
 func (args *connArgs) Close() error {
@@ -539,9 +745,27 @@ func (args *connArgs) Close() error {
 		err = args.respErr
 	}
 
+	if err == nil && args.typeErr != nil {
+		err = args.typeErr
+	}
+
 	if args.conn != nil {
-		if _, stable := err.(*resp.Error); err != nil && !stable {
+		if err != nil && !isStableError(err) {
+			if err == io.EOF {
+				// The connection was closed at the boundary of a response,
+				// the server went away before answering the command.
+				err = ErrServerClosed
+			} else if werr := args.conn.writeError(); werr != nil {
+				err = werr
+			}
+			// The commands which follow in a pipeline weren't answered
+			// either, they report the same error.
+			err = args.conn.setReadError(err)
 			args.conn.Close()
+
+			if args.tx != nil && args.tx.err == nil {
+				args.tx.err = err
+			}
 		}
 		if args.tx == nil { // no transcation, owner of the connection read lock
 			args.conn.rmutex.Unlock()
@@ -571,9 +795,12 @@ func (args *connArgs) Next(dst interface{}) bool {
 	var err error
 	args.mutex.Lock()
 
-	if args.respErr != nil {
+	switch {
+	case args.respErr != nil:
 		err = args.respErr
-	} else {
+	case args.typeErr != nil:
+		err = args.typeErr
+	default:
 		err = args.next(dst)
 	}
 
@@ -581,6 +808,22 @@ func (args *connArgs) Next(dst interface{}) bool {
 	return err == nil
 }
 
+func (args *connArgs) NextType() (t Type) {
+	args.mutex.Lock()
+
+	switch {
+	case args.respErr != nil:
+		t = TypeError
+	case args.conn != nil && args.typeErr == nil && args.decoder.Len() != 0:
+		if typ, err := args.decoder.Parser.ParseType(); err == nil {
+			t = makeType(typ)
+		}
+	}
+
+	args.mutex.Unlock()
+	return
+}
+
 func (args *connArgs) next(dst interface{}) (err error) {
 	var typ objconv.Type
 
@@ -591,7 +834,15 @@ func (args *connArgs) next(dst interface{}) (err error) {
 
 	if typ, err = args.decoder.Parser.ParseType(); err == nil {
 		if typ != objconv.Error {
-			err = args.decoder.Decode(dst)
+			if args.strict && dst != nil {
+				if e := checkStrictType(typ, dst); e != nil {
+					args.typeErr = e.(*TypeMismatchError)
+					return e
+				}
+			}
+			if err = args.decoder.Decode(dst); err == nil {
+				args.options.apply(dst)
+			}
 		} else {
 			args.decoder.Decode(&args.respErr)
 			err = args.respErr
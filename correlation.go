@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+// WithCorrelationID returns a copy of ctx carrying the given correlation id.
+//
+// Correlation ids are used to tie together the logs produced while handling a
+// single user request in a process. The id set on the context of a request is
+// seen by the transports which send it, servers attach an id to every request
+// they receive, and proxies forward the context of the requests they receive
+// to the upstream transports, so a program only needs to set the id once (for
+// example from an HTTP request header) for it to be propagated.
+//
+// Correlation ids are not sent over the network, the id seen by a server is
+// unrelated to the one of the client which sent the request.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation id carried by ctx, or an empty string
+// if it has none.
+func CorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	switch id := ctx.Value(correlationKey{}).(type) {
+	case string:
+		return id
+	case *lazyCorrelationID:
+		return id.get()
+	default:
+		return ""
+	}
+}
+
+// NewCorrelationID generates a random correlation id.
+func NewCorrelationID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+type correlationKey struct{}
+
+// lazyCorrelationID is the correlation id attached by servers to the requests
+// they receive, it's only generated if it's used.
+type lazyCorrelationID struct {
+	once sync.Once
+	id   string
+}
+
+func (l *lazyCorrelationID) get() string {
+	l.once.Do(func() { l.id = NewCorrelationID() })
+	return l.id
+}
+
+// withLazyCorrelationID returns a copy of ctx carrying a correlation id which
+// is generated the first time it's used.
+func withLazyCorrelationID(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, correlationKey{}, &lazyCorrelationID{})
+}
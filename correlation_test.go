@@ -0,0 +1,71 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+type correlationRecorder struct {
+	redis.RoundTripper
+	ids []string
+}
+
+func (r *correlationRecorder) RoundTrip(req *redis.Request) (*redis.Response, error) {
+	r.ids = append(r.ids, redis.CorrelationID(req.Context))
+	return r.RoundTripper.RoundTrip(req)
+}
+
+func TestCorrelationID(t *testing.T) {
+	var mutex sync.Mutex
+	var served []string
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		mutex.Lock()
+		served = append(served, redis.CorrelationID(req.Context))
+		mutex.Unlock()
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	rec := &correlationRecorder{RoundTripper: tr}
+	cli := &redis.Client{Addr: url, Transport: rec}
+	ctx := context.Background()
+
+	if err := cli.Exec(redis.WithCorrelationID(ctx, "1234"), "SET", "A", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Exec(ctx, "SET", "B", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.ids) != 2 {
+		t.Fatal("bad number of requests sent:", len(rec.ids))
+	}
+
+	if rec.ids[0] != "1234" {
+		t.Error("the correlation id set by the program was not propagated:", rec.ids[0])
+	}
+
+	if rec.ids[1] != "" {
+		t.Error("the client must not generate correlation ids:", rec.ids[1])
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(served) != 2 {
+		t.Fatal("bad number of requests served:", len(served))
+	}
+
+	// Correlation ids don't cross the network, the server generates its own.
+	if served[0] == "" || served[1] == "" || served[0] == served[1] || served[0] == "1234" {
+		t.Error("bad correlation ids generated by the server:", served)
+	}
+}
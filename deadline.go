@@ -0,0 +1,41 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// RemainingBudget returns the time left before the deadline of ctx minus
+// margin, and false if ctx has no deadline. The returned duration is negative
+// when the budget is already exhausted.
+//
+// The margin accounts for the time needed to send the response back to the
+// caller, work done past the budget is wasted since the caller has already
+// given up by the time the response reaches it.
+func RemainingBudget(ctx context.Context, margin time.Duration) (time.Duration, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline) - margin, true
+}
+
+// WithDeadlineBudget returns a copy of ctx whose deadline is the deadline of
+// ctx minus margin. It is intended to be used to derive the context of a
+// request sent to an upstream server from the context of the downstream
+// request being served.
+//
+// If ctx has no deadline the returned context has none either. If the budget
+// is already exhausted the returned context is expired.
+func WithDeadlineBudget(ctx context.Context, margin time.Duration) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(ctx, deadline.Add(-margin))
+	}
+	return context.WithCancel(ctx)
+}
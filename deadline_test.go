@@ -0,0 +1,99 @@
+package redis_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestWithDeadlineBudget(t *testing.T) {
+	t.Run("contexts without deadlines have no budget", func(t *testing.T) {
+		ctx, cancel := redis.WithDeadlineBudget(context.Background(), time.Second)
+		defer cancel()
+
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("unexpected deadline on the derived context")
+		}
+
+		if _, ok := redis.RemainingBudget(ctx, time.Second); ok {
+			t.Error("unexpected budget on a context without deadline")
+		}
+	})
+
+	t.Run("the margin is subtracted from the deadline", func(t *testing.T) {
+		parent, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		ctx, cancel := redis.WithDeadlineBudget(parent, 10*time.Second)
+		defer cancel()
+
+		parentDeadline, _ := parent.Deadline()
+		deadline, ok := ctx.Deadline()
+
+		if !ok {
+			t.Fatal("missing deadline on the derived context")
+		}
+
+		if d := parentDeadline.Sub(deadline); d != 10*time.Second {
+			t.Error("bad deadline margin:", d)
+		}
+
+		if budget, _ := redis.RemainingBudget(parent, 10*time.Second); budget <= 0 || budget > 50*time.Second {
+			t.Error("bad remaining budget:", budget)
+		}
+	})
+
+	t.Run("exhausted budgets produce expired contexts", func(t *testing.T) {
+		parent, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		ctx, cancel := redis.WithDeadlineBudget(parent, 2*time.Second)
+		defer cancel()
+
+		if ctx.Err() != context.DeadlineExceeded {
+			t.Error("bad context error:", ctx.Err())
+		}
+
+		if budget, _ := redis.RemainingBudget(parent, 2*time.Second); budget > 0 {
+			t.Error("bad remaining budget:", budget)
+		}
+	})
+}
+
+func TestReverseProxyDeadlineMargin(t *testing.T) {
+	var count int32
+
+	upstream, upstreamURL := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		atomic.AddInt32(&count, 1)
+		res.Write("OK")
+	}))
+	defer upstream.Close()
+
+	// The proxy server has a 100ms read timeout, which is shorter than the
+	// margin, so requests must be rejected without reaching the upstream.
+	srv, serverURL := newServer(&redis.ReverseProxy{
+		Transport:      &redis.Transport{},
+		Registry:       redis.ServerEndpoint{Addr: upstreamURL},
+		ErrorLog:       log.New(os.Stderr, "proxy deadline test ==> ", 0),
+		DeadlineMargin: time.Second,
+	})
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: serverURL, Transport: tr}
+
+	if err := cli.Exec(context.Background(), "SET", "A", "1"); err == nil {
+		t.Error("expected an error but got nil")
+	}
+
+	if n := atomic.LoadInt32(&count); n != 0 {
+		t.Error("bad number of requests sent upstream:", n)
+	}
+}
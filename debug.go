@@ -0,0 +1,159 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+// ErrDebugNotAllowed is the error returned to DEBUG commands when they are
+// not enabled on the server.
+var ErrDebugNotAllowed = resp.NewError("ERR DEBUG command not allowed. If the enable-debug-command option is set to \"local\", you can run it from a local connection, otherwise you need to set this option in the configuration file, and then restart the server.")
+
+// DebugHandler implements a safe subset of the DEBUG command for custom
+// servers, intended for test harnesses and chaos tools which expect them:
+//
+//	DEBUG SLEEP <seconds>             blocks the connection, for latency injection
+//	DEBUG OBJECT <key>                reports the properties of a key
+//	DEBUG SET-ACTIVE-EXPIRE <0|1>     toggles the active expiration of keys
+//	DEBUG JMAP                        does nothing, like on redis
+//
+// DEBUG commands are rejected with ErrDebugNotAllowed unless Enabled is set.
+type DebugHandler struct {
+	// Enabled gates the DEBUG commands, they are disabled by default. The
+	// field may be registered on a TunableRegistry to allow enabling them
+	// at runtime.
+	Enabled BoolTunable
+
+	// MaxSleep bounds the duration of DEBUG SLEEP. Zero means no limit.
+	MaxSleep time.Duration
+
+	// Object, if not nil, returns the properties of keys reported by DEBUG
+	// OBJECT, servers with an embedded store set it to expose their objects.
+	// It returns ErrNoSuchKey for keys that don't exist.
+	Object func(ctx context.Context, key string) (ObjectInfo, error)
+
+	// ActiveExpireDisabled is set by DEBUG SET-ACTIVE-EXPIRE 0 and cleared by
+	// DEBUG SET-ACTIVE-EXPIRE 1, stores which expire keys in the background
+	// are expected to stop doing so while it is set.
+	ActiveExpireDisabled BoolTunable
+}
+
+// HandleDebug registers the DEBUG subcommands on mux.
+func (d *DebugHandler) HandleDebug(mux *ServeMux) {
+	mux.HandleArity("DEBUG SLEEP", 3, d.gate(d.serveSleep))
+	mux.HandleArity("DEBUG OBJECT", 3, d.gate(d.serveObject))
+	mux.HandleArity("DEBUG SET-ACTIVE-EXPIRE", 3, d.gate(d.serveSetActiveExpire))
+	mux.HandleArity("DEBUG JMAP", 2, d.gate(func(res ResponseWriter, req *Request) {
+		res.Write("OK")
+	}))
+}
+
+func (d *DebugHandler) gate(handler HandlerFunc) Handler {
+	return HandlerFunc(func(res ResponseWriter, req *Request) {
+		if !d.Enabled.Load() {
+			res.Write(ErrDebugNotAllowed)
+			return
+		}
+		handler(res, req)
+	})
+}
+
+func (d *DebugHandler) serveSleep(res ResponseWriter, req *Request) {
+	var arg string
+
+	if err := req.Cmds[0].ParseArgs(&arg); err != nil {
+		res.Write(err)
+		return
+	}
+
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil || seconds < 0 {
+		res.Write(resp.NewError("ERR value is not a valid float"))
+		return
+	}
+
+	delay := time.Duration(seconds * float64(time.Second))
+
+	if d.MaxSleep != 0 && delay > d.MaxSleep {
+		delay = d.MaxSleep
+	}
+
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		res.Write(ctx.Err())
+		return
+	}
+
+	res.Write("OK")
+}
+
+func (d *DebugHandler) serveObject(res ResponseWriter, req *Request) {
+	var key string
+
+	if err := req.Cmds[0].ParseArgs(&key); err != nil {
+		res.Write(err)
+		return
+	}
+
+	if d.Object == nil {
+		res.Write(resp.NewError("ERR DEBUG OBJECT is not supported by this server"))
+		return
+	}
+
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	info, err := d.Object(ctx, key)
+
+	switch err {
+	case nil:
+	case ErrNoSuchKey:
+		res.Write(resp.NewError("ERR no such key"))
+		return
+	default:
+		res.Write(err)
+		return
+	}
+
+	res.Write(fmt.Sprintf("Value at:0x0 refcount:%d encoding:%s lru_seconds_idle:%d",
+		info.RefCount,
+		info.Encoding,
+		int64(info.IdleTime/time.Second),
+	))
+}
+
+func (d *DebugHandler) serveSetActiveExpire(res ResponseWriter, req *Request) {
+	var arg string
+
+	if err := req.Cmds[0].ParseArgs(&arg); err != nil {
+		res.Write(err)
+		return
+	}
+
+	switch arg {
+	case "0":
+		d.ActiveExpireDisabled.Store(true)
+	case "1":
+		d.ActiveExpireDisabled.Store(false)
+	default:
+		res.Write(resp.NewError("ERR value is out of range, must be 0 or 1"))
+		return
+	}
+
+	res.Write("OK")
+}
@@ -0,0 +1,87 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestDebugHandler(t *testing.T) {
+	debug := &redis.DebugHandler{
+		MaxSleep: 10 * time.Millisecond,
+		Object: func(ctx context.Context, key string) (redis.ObjectInfo, error) {
+			if key != "A" {
+				return redis.ObjectInfo{}, redis.ErrNoSuchKey
+			}
+			return redis.ObjectInfo{Encoding: "embstr", RefCount: 1, IdleTime: 3 * time.Second}, nil
+		},
+	}
+
+	mux := redis.NewServeMux()
+	debug.HandleDebug(mux)
+
+	serve := func(args ...interface{}) []interface{} {
+		res := &testResponseWriter{}
+		mux.ServeRedis(res, redis.NewRequest("", "DEBUG", redis.List(args...)))
+		return res.values
+	}
+
+	if values := serve("JMAP"); !reflect.DeepEqual(values, []interface{}{redis.ErrDebugNotAllowed}) {
+		t.Fatalf("DEBUG commands must be disabled by default: %#v", values)
+	}
+
+	debug.Enabled.Store(true)
+
+	tests := []struct {
+		scenario string
+		args     []interface{}
+		res      interface{}
+	}{
+		{
+			scenario: "DEBUG SLEEP blocks for at most the maximum sleep duration",
+			args:     []interface{}{"SLEEP", "3600"},
+			res:      "OK",
+		},
+		{
+			scenario: "DEBUG SLEEP rejects invalid durations",
+			args:     []interface{}{"SLEEP", "soon"},
+			res:      resp.NewError("ERR value is not a valid float"),
+		},
+		{
+			scenario: "DEBUG OBJECT reports the properties of existing keys",
+			args:     []interface{}{"OBJECT", "A"},
+			res:      "Value at:0x0 refcount:1 encoding:embstr lru_seconds_idle:3",
+		},
+		{
+			scenario: "DEBUG OBJECT fails on keys that don't exist",
+			args:     []interface{}{"OBJECT", "B"},
+			res:      resp.NewError("ERR no such key"),
+		},
+		{
+			scenario: "DEBUG SET-ACTIVE-EXPIRE disables the active expiration",
+			args:     []interface{}{"SET-ACTIVE-EXPIRE", "0"},
+			res:      "OK",
+		},
+		{
+			scenario: "DEBUG SET-ACTIVE-EXPIRE rejects values other than 0 or 1",
+			args:     []interface{}{"SET-ACTIVE-EXPIRE", "2"},
+			res:      resp.NewError("ERR value is out of range, must be 0 or 1"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if values := serve(test.args...); !reflect.DeepEqual(values, []interface{}{test.res}) {
+				t.Errorf("bad response:\nexpected: %#v\nfound:    %#v", test.res, values)
+			}
+		})
+	}
+
+	if !debug.ActiveExpireDisabled.Load() {
+		t.Error("the active expiration was not disabled")
+	}
+}
@@ -0,0 +1,76 @@
+package redis
+
+// DecodeOptions controls the Go types of values decoded into interface{}
+// destinations, for example by generic tools like proxies or recorders which
+// don't know in advance the types of the values they read.
+//
+// By default, values decoded into interface{} have the following types:
+//
+//	simple strings   string
+//	bulk strings     []byte
+//	integers         int64
+//	nil values       nil
+//	arrays           []interface{}, with elements of the types above
+//
+// Error replies are never decoded as values, they are returned by the Close
+// method of the argument list. The RESP2 protocol has no map type, replies of
+// commands like HGETALL are flat arrays of fields and values.
+type DecodeOptions struct {
+	// BulkAsString decodes bulk strings as string values instead of []byte.
+	BulkAsString bool
+
+	// IntAsInt decodes integers as int values instead of int64.
+	IntAsInt bool
+}
+
+// WithDecodeOptions returns an argument list which applies opts to values
+// read from args into interface{} destinations.
+func WithDecodeOptions(args Args, opts DecodeOptions) Args {
+	return &decodeArgs{Args: args, opts: opts}
+}
+
+type decodeArgs struct {
+	Args
+	opts DecodeOptions
+}
+
+func (args *decodeArgs) Next(dst interface{}) bool {
+	if !args.Args.Next(dst) {
+		return false
+	}
+	args.opts.apply(dst)
+	return true
+}
+
+func (args *decodeArgs) NextType() Type {
+	return NextType(args.Args)
+}
+
+func (opts DecodeOptions) isDefault() bool {
+	return opts == DecodeOptions{}
+}
+
+// apply converts the value pointed by dst if it is an interface{}.
+func (opts DecodeOptions) apply(dst interface{}) {
+	if p, ok := dst.(*interface{}); ok && !opts.isDefault() {
+		*p = opts.convert(*p)
+	}
+}
+
+func (opts DecodeOptions) convert(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		if opts.BulkAsString {
+			return string(x)
+		}
+	case int64:
+		if opts.IntAsInt {
+			return int(x)
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = opts.convert(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,90 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestDecodeOptions(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.WriteStream(4)
+		res.Write("OK")
+		res.Write([]byte("hello"))
+		res.Write(42)
+		res.Write([]interface{}{[]byte("A"), 1})
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		scenario string
+		options  redis.DecodeOptions
+		values   []interface{}
+	}{
+		{
+			scenario: "values are decoded into the default types",
+			values:   []interface{}{"OK", []byte("hello"), int64(42), []interface{}{[]byte("A"), int64(1)}},
+		},
+		{
+			scenario: "bulk strings are decoded as strings with BulkAsString",
+			options:  redis.DecodeOptions{BulkAsString: true},
+			values:   []interface{}{"OK", "hello", int64(42), []interface{}{"A", int64(1)}},
+		},
+		{
+			scenario: "integers are decoded as int with IntAsInt",
+			options:  redis.DecodeOptions{IntAsInt: true},
+			values:   []interface{}{"OK", []byte("hello"), 42, []interface{}{[]byte("A"), 1}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			tr := &redis.Transport{DecodeOptions: test.options}
+			defer tr.CloseIdleConnections()
+
+			cli := &redis.Client{Addr: url, Transport: tr}
+			args := cli.Query(context.Background(), "GET", "key")
+
+			var values []interface{}
+			var value interface{}
+
+			for args.Next(&value) {
+				values = append(values, value)
+				value = nil
+			}
+
+			if err := args.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(values, test.values) {
+				t.Errorf("bad values:\n%#v\n%#v", test.values, values)
+			}
+		})
+	}
+}
+
+func TestWithDecodeOptions(t *testing.T) {
+	args := redis.WithDecodeOptions(redis.List([]byte("hello"), int64(42)), redis.DecodeOptions{
+		BulkAsString: true,
+		IntAsInt:     true,
+	})
+
+	var values []interface{}
+	var value interface{}
+
+	for args.Next(&value) {
+		values = append(values, value)
+		value = nil
+	}
+
+	if err := args.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(values, []interface{}{"hello", 42}) {
+		t.Errorf("bad values: %#v", values)
+	}
+}
@@ -0,0 +1,383 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The Discovery interface is implemented by types that discover the set of
+// available redis servers, and notify programs when it changes.
+type Discovery interface {
+	// Watch returns a channel which receives the current set of endpoints, then
+	// a new set every time it changes. The channel is closed when ctx is
+	// canceled.
+	Watch(ctx context.Context) (<-chan []ServerEndpoint, error)
+}
+
+// Watch satisfies the Discovery interface, the list never changes so the
+// returned channel receives a single set of endpoints.
+func (list ServerList) Watch(ctx context.Context) (<-chan []ServerEndpoint, error) {
+	return watchStatic(ctx, list)
+}
+
+// Watch satisfies the Discovery interface, the returned channel receives a
+// single set containing only the endpoint.
+func (endpoint ServerEndpoint) Watch(ctx context.Context) (<-chan []ServerEndpoint, error) {
+	return watchStatic(ctx, []ServerEndpoint{endpoint})
+}
+
+func watchStatic(ctx context.Context, endpoints []ServerEndpoint) (<-chan []ServerEndpoint, error) {
+	ch := make(chan []ServerEndpoint, 1)
+	ch <- copyEndpoints(endpoints)
+
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+// SRVDiscovery is a Discovery implementation which looks up servers from DNS
+// SRV records, as published for example by Kubernetes headless services or
+// consul's DNS interface.
+type SRVDiscovery struct {
+	// Service, Proto, and Name are passed to net.Resolver.LookupSRV, if both
+	// Service and Proto are empty Name is looked up directly.
+	Service string
+	Proto   string
+	Name    string
+
+	// Resolver is used to lookup SRV records. If nil, net.DefaultResolver is
+	// used.
+	Resolver *net.Resolver
+
+	// Interval is the time between two lookups of the SRV records. If zero,
+	// records are looked up every 10 seconds.
+	Interval time.Duration
+}
+
+// Watch satisfies the Discovery interface.
+//
+// The method returns an error if the first lookup fails, errors occurring on
+// later lookups are ignored and the last known set of endpoints is retained.
+func (d *SRVDiscovery) Watch(ctx context.Context) (<-chan []ServerEndpoint, error) {
+	return watchLookup(ctx, d.interval(), d.lookup)
+}
+
+func (d *SRVDiscovery) lookup(ctx context.Context) ([]ServerEndpoint, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	_, records, err := resolver.LookupSRV(ctx, d.Service, d.Proto, d.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]ServerEndpoint, len(records))
+
+	for i, r := range records {
+		host := strings.TrimSuffix(r.Target, ".")
+		endpoints[i] = ServerEndpoint{
+			Name: host,
+			Addr: net.JoinHostPort(host, strconv.Itoa(int(r.Port))),
+		}
+	}
+
+	sort.Slice(endpoints, func(i int, j int) bool {
+		return endpoints[i].Addr < endpoints[j].Addr
+	})
+
+	return endpoints, nil
+}
+
+func (d *SRVDiscovery) interval() time.Duration {
+	if d.Interval > 0 {
+		return d.Interval
+	}
+	return 10 * time.Second
+}
+
+// HostDiscovery is a Discovery implementation which looks up servers from the
+// DNS A and AAAA records of a host name, as published for example by Kubernetes
+// headless services.
+type HostDiscovery struct {
+	// Host is the name looked up with net.Resolver.LookupHost.
+	Host string
+
+	// Port is the port that the servers listen on, it is the same for all
+	// addresses of the host.
+	Port string
+
+	// Resolver is used to lookup the addresses of the host. If nil,
+	// net.DefaultResolver is used.
+	Resolver *net.Resolver
+
+	// Interval is the time between two lookups of the addresses. If zero,
+	// addresses are looked up every 10 seconds.
+	Interval time.Duration
+}
+
+// Watch satisfies the Discovery interface.
+//
+// The method returns an error if the first lookup fails, errors occurring on
+// later lookups are ignored and the last known set of endpoints is retained.
+func (d *HostDiscovery) Watch(ctx context.Context) (<-chan []ServerEndpoint, error) {
+	return watchLookup(ctx, d.interval(), d.lookup)
+}
+
+func (d *HostDiscovery) lookup(ctx context.Context) ([]ServerEndpoint, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	addrs, err := resolver.LookupHost(ctx, d.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]ServerEndpoint, len(addrs))
+
+	for i, addr := range addrs {
+		endpoints[i] = ServerEndpoint{
+			Name: d.Host,
+			Addr: net.JoinHostPort(addr, d.Port),
+		}
+	}
+
+	sort.Slice(endpoints, func(i int, j int) bool {
+		return endpoints[i].Addr < endpoints[j].Addr
+	})
+
+	return endpoints, nil
+}
+
+func (d *HostDiscovery) interval() time.Duration {
+	if d.Interval > 0 {
+		return d.Interval
+	}
+	return 10 * time.Second
+}
+
+// watchLookup calls lookup every interval, sending the endpoints it returns to
+// the returned channel when they change.
+func watchLookup(ctx context.Context, interval time.Duration, lookup func(context.Context) ([]ServerEndpoint, error)) (<-chan []ServerEndpoint, error) {
+	endpoints, err := lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []ServerEndpoint, 1)
+	ch <- endpoints
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			next, err := lookup(ctx)
+			if err != nil || reflect.DeepEqual(next, endpoints) {
+				continue
+			}
+
+			select {
+			case ch <- next:
+				endpoints = next
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// EndpointWatcher is a Discovery implementation which programs update by
+// calling its Set method. It is intended to be plugged into external watch
+// mechanisms, for example the callbacks of a Kubernetes Endpoints informer.
+//
+// The zero-value is a valid watcher with no endpoints, watchers must not be
+// copied after first use.
+type EndpointWatcher struct {
+	mutex     sync.Mutex
+	version   int
+	endpoints []ServerEndpoint
+	changed   chan struct{}
+}
+
+// Set replaces the set of endpoints exposed by the watcher.
+func (w *EndpointWatcher) Set(endpoints []ServerEndpoint) {
+	w.mutex.Lock()
+	w.version++
+	w.endpoints = copyEndpoints(endpoints)
+
+	if w.changed != nil {
+		close(w.changed)
+		w.changed = nil
+	}
+
+	w.mutex.Unlock()
+}
+
+// Watch satisfies the Discovery interface.
+//
+// Watchers that were never set first send an empty set of endpoints. When the
+// endpoints change faster than the program consumes them, intermediate sets
+// are skipped and only the latest one is received.
+func (w *EndpointWatcher) Watch(ctx context.Context) (<-chan []ServerEndpoint, error) {
+	ch := make(chan []ServerEndpoint)
+
+	go func() {
+		defer close(ch)
+		version := -1
+
+		for {
+			w.mutex.Lock()
+			current, endpoints := w.version, w.endpoints
+
+			if w.changed == nil {
+				w.changed = make(chan struct{})
+			}
+
+			changed := w.changed
+			w.mutex.Unlock()
+
+			if current != version {
+				select {
+				case ch <- copyEndpoints(endpoints):
+					version = current
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// DiscoveryRegistry adapts a Discovery to the ServerRegistry interface, so it
+// can be used as the registry of a ReverseProxy for example.
+//
+// The registry starts watching the discovery on the first call to
+// LookupServers, and stops when Close is called.
+type DiscoveryRegistry struct {
+	// Discovery is the source of endpoints exposed by the registry.
+	Discovery Discovery
+
+	once      sync.Once
+	mutex     sync.Mutex
+	ready     chan struct{}
+	endpoints []ServerEndpoint
+	err       error
+	cancel    context.CancelFunc
+}
+
+// LookupServers satisfies the ServerRegistry interface, it returns the last
+// set of endpoints received from the discovery.
+func (r *DiscoveryRegistry) LookupServers(ctx context.Context) ([]ServerEndpoint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.once.Do(r.start)
+
+	select {
+	case <-r.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	r.mutex.Lock()
+	endpoints, err := copyEndpoints(r.endpoints), r.err
+	r.mutex.Unlock()
+	return endpoints, err
+}
+
+// Close stops watching the discovery.
+func (r *DiscoveryRegistry) Close() error {
+	r.once.Do(func() {
+		r.ready = make(chan struct{})
+		r.err = errors.New("redis: LookupServers called on a closed registry")
+		close(r.ready)
+	})
+
+	r.mutex.Lock()
+	cancel := r.cancel
+	r.cancel = nil
+	r.mutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	return nil
+}
+
+func (r *DiscoveryRegistry) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.ready = make(chan struct{})
+	r.cancel = cancel
+
+	ch, err := r.Discovery.Watch(ctx)
+	if err != nil {
+		r.err = err
+		close(r.ready)
+		cancel()
+		return
+	}
+
+	go func() {
+		first := true
+
+		for endpoints := range ch {
+			r.mutex.Lock()
+			r.endpoints = endpoints
+			r.mutex.Unlock()
+
+			if first {
+				close(r.ready)
+				first = false
+			}
+		}
+
+		if first {
+			r.mutex.Lock()
+			r.err = errors.New("redis: discovery stopped before sending any endpoints")
+			r.mutex.Unlock()
+			close(r.ready)
+		}
+	}()
+}
+
+func copyEndpoints(endpoints []ServerEndpoint) []ServerEndpoint {
+	if endpoints == nil {
+		return nil
+	}
+	return append(make([]ServerEndpoint, 0, len(endpoints)), endpoints...)
+}
@@ -0,0 +1,69 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+	"github.com/segmentio/redis-go/redistest"
+)
+
+func TestDiscoveryRegistry(t *testing.T) {
+	redistest.TestServerRegistry(t, func() (redis.ServerRegistry, []redis.ServerEndpoint, func(), error) {
+		endpoints := []redis.ServerEndpoint{
+			{Name: "A", Addr: "127.0.0.1:4242"},
+			{Name: "B", Addr: "127.0.0.1:4243"},
+		}
+		registry := &redis.DiscoveryRegistry{Discovery: redis.ServerList(endpoints)}
+		return registry, endpoints, func() { registry.Close() }, nil
+	})
+}
+
+func TestEndpointWatcher(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	watcher := &redis.EndpointWatcher{}
+	registry := &redis.DiscoveryRegistry{Discovery: watcher}
+	defer registry.Close()
+
+	endpoints := []redis.ServerEndpoint{
+		{Name: "A", Addr: "127.0.0.1:4242"},
+	}
+	watcher.Set(endpoints)
+
+	ch, err := watcher.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found := <-ch; !reflect.DeepEqual(found, endpoints) {
+		t.Error("bad endpoints:", found)
+	}
+
+	endpoints = append(endpoints, redis.ServerEndpoint{Name: "B", Addr: "127.0.0.1:4243"})
+	watcher.Set(endpoints)
+
+	if found := <-ch; !reflect.DeepEqual(found, endpoints) {
+		t.Error("bad endpoints after update:", found)
+	}
+
+	// The registry must eventually observe the latest set of endpoints.
+	for {
+		found, err := registry.LookupServers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.DeepEqual(found, endpoints) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+
+	for range ch {
+	}
+}
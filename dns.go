@@ -0,0 +1,201 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A DNSTransport is a RoundTripper which resolves the host names of request
+// addresses to the set of servers published in DNS, and distributes the
+// requests across them. It allows clients to use the names of Kubernetes
+// headless services or of consul services as address, without an external
+// load balancer:
+//
+//	client := &redis.Client{
+//		Addr:      "redis.default.svc.cluster.local:6379",
+//		Transport: &redis.DNSTransport{},
+//	}
+//
+// Each host name is resolved on the first request sent to it, then in the
+// background every Interval, the last known set of servers is retained when
+// lookups fail. Requests are distributed round-robin across the servers, which
+// spreads the connections of the underlying transport over the resolved set.
+// Addresses which are IP addresses are not resolved.
+//
+// When the underlying transport is a Transport establishing connections over
+// TLS, the certificates of the servers are verified against the host name of
+// the address, unless its TLSConfig sets a ServerName.
+type DNSTransport struct {
+	// Transport is used to send requests. If nil, DefaultTransport is used.
+	Transport RoundTripper
+
+	// Resolver is used to lookup the host names. If nil, net.DefaultResolver
+	// is used.
+	Resolver *net.Resolver
+
+	// SRV configures the transport to resolve addresses from their SRV
+	// records instead of their A and AAAA records, in which case addresses
+	// are names without ports, like "_redis._tcp.redis.service.consul".
+	SRV bool
+
+	// Interval is the time between two lookups of a host name. If zero, host
+	// names are looked up every 10 seconds.
+	Interval time.Duration
+
+	mutex  sync.Mutex
+	hosts  map[string]*dnsHost
+	closed bool
+}
+
+type dnsHost struct {
+	registry DiscoveryRegistry
+	next     uint64
+}
+
+// RoundTrip satisfies the RoundTripper interface.
+func (t *DNSTransport) RoundTrip(req *Request) (*Response, error) {
+	var scheme, address = "", req.Addr
+
+	if i := strings.Index(address, "://"); i >= 0 {
+		scheme, address = address[:i+3], address[i+3:]
+	}
+
+	if !t.SRV {
+		if host, _, err := net.SplitHostPort(address); err != nil || net.ParseIP(host) != nil {
+			return t.transport().RoundTrip(req)
+		}
+	}
+
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	h, err := t.host(address)
+	if err != nil {
+		req.Close()
+		return nil, err
+	}
+
+	endpoints, err := h.registry.LookupServers(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			// The first lookup failed, the host is forgotten so the next
+			// request looks it up again.
+			t.forget(address, h)
+		}
+		req.Close()
+		return nil, err
+	}
+
+	if len(endpoints) == 0 {
+		req.Close()
+		return nil, errors.New("redis: no servers found in DNS for " + address)
+	}
+
+	i := atomic.AddUint64(&h.next, 1)
+	r := *req
+	r.Addr = scheme + endpoints[i%uint64(len(endpoints))].Addr
+
+	// The certificates of servers reached over TLS are verified against the
+	// host name, not the IP address that it resolved to.
+	if !t.SRV {
+		host, _, _ := net.SplitHostPort(address)
+		r.Context = context.WithValue(ctx, tlsServerNameKey{}, host)
+	}
+
+	res, err := t.transport().RoundTrip(&r)
+	if res != nil {
+		res.Request = req
+	}
+	return res, err
+}
+
+// CloseIdleConnections closes the idle connections of the underlying
+// transport, if it supports it.
+func (t *DNSTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if c, ok := t.transport().(closeIdler); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// Close stops the background lookups of the transport. After Close returned,
+// requests sent to host names fail with ErrTransportClosed.
+func (t *DNSTransport) Close() error {
+	t.mutex.Lock()
+	hosts := t.hosts
+	t.hosts, t.closed = nil, true
+	t.mutex.Unlock()
+
+	for _, h := range hosts {
+		h.registry.Close()
+	}
+
+	return nil
+}
+
+func (t *DNSTransport) host(address string) (*dnsHost, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return nil, ErrTransportClosed
+	}
+
+	h := t.hosts[address]
+
+	if h == nil {
+		h = &dnsHost{}
+		h.registry.Discovery = t.discovery(address)
+
+		if t.hosts == nil {
+			t.hosts = make(map[string]*dnsHost)
+		}
+		t.hosts[address] = h
+	}
+
+	return h, nil
+}
+
+func (t *DNSTransport) forget(address string, h *dnsHost) {
+	t.mutex.Lock()
+	if t.hosts[address] == h {
+		delete(t.hosts, address)
+	}
+	t.mutex.Unlock()
+	h.registry.Close()
+}
+
+func (t *DNSTransport) discovery(address string) Discovery {
+	if t.SRV {
+		return &SRVDiscovery{
+			Name:     address,
+			Resolver: t.Resolver,
+			Interval: t.Interval,
+		}
+	}
+
+	host, port, _ := net.SplitHostPort(address)
+
+	return &HostDiscovery{
+		Host:     host,
+		Port:     port,
+		Resolver: t.Resolver,
+		Interval: t.Interval,
+	}
+}
+
+func (t *DNSTransport) transport() RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return DefaultTransport
+}
@@ -0,0 +1,302 @@
+package redis_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestDNSTransport(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		scenario string
+		srv      bool
+		addr     string
+		hosts    []string
+		records  []net.SRV
+		dials    []string
+	}{
+		{
+			scenario: "requests are distributed across the A records of the host",
+			addr:     "redis.test:6379",
+			hosts:    []string{"10.0.0.1", "10.0.0.2"},
+			dials:    []string{"10.0.0.1:6379", "10.0.0.2:6379"},
+		},
+		{
+			scenario: "requests are distributed across the SRV records of the name",
+			srv:      true,
+			addr:     "_redis._tcp.redis.test",
+			records: []net.SRV{
+				{Target: "a.redis.test.", Port: 6379},
+				{Target: "b.redis.test.", Port: 6380},
+			},
+			dials: []string{"a.redis.test:6379", "b.redis.test:6380"},
+		},
+		{
+			scenario: "IP addresses are not resolved",
+			addr:     "10.0.0.9:6379",
+			hosts:    []string{"10.0.0.1"},
+			dials:    []string{"10.0.0.9:6379"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.scenario, func(t *testing.T) {
+			dns := &fakeDNS{hosts: test.hosts, records: test.records}
+			tr, dials := newDialRecorder(url)
+			defer tr.CloseIdleConnections()
+
+			dt := &redis.DNSTransport{Transport: tr, Resolver: dns.resolver(), SRV: test.srv}
+			defer dt.Close()
+
+			cli := &redis.Client{Addr: test.addr, Transport: dt}
+
+			for i := 0; i != 10; i++ {
+				if err := cli.Exec(context.Background(), "SET", "key", "value"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if found := dials(); !reflect.DeepEqual(found, test.dials) {
+				t.Errorf("bad dialed addresses: %q != %q", found, test.dials)
+			}
+		})
+	}
+
+	t.Run("hosts are resolved again periodically", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		dns := &fakeDNS{hosts: []string{"10.0.0.1"}}
+		tr, dials := newDialRecorder(url)
+		defer tr.CloseIdleConnections()
+
+		dt := &redis.DNSTransport{Transport: tr, Resolver: dns.resolver(), Interval: 10 * time.Millisecond}
+		defer dt.Close()
+
+		cli := &redis.Client{Addr: "redis.test:6379", Transport: dt}
+
+		if err := cli.Exec(ctx, "SET", "key", "value"); err != nil {
+			t.Fatal(err)
+		}
+
+		dns.set([]string{"10.0.0.3"})
+
+		waitFor(t, ctx, func() bool {
+			if err := cli.Exec(ctx, "SET", "key", "value"); err != nil {
+				t.Fatal(err)
+			}
+			return reflect.DeepEqual(dials(), []string{"10.0.0.1:6379", "10.0.0.3:6379"})
+		})
+	})
+
+	t.Run("certificates are verified against the host name", func(t *testing.T) {
+		cert, roots := newTestCertificate(t, "redis.test")
+
+		l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srv := &redis.Server{
+			Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+				res.Write("OK")
+			}),
+		}
+		go srv.Serve(l)
+		defer srv.Close()
+
+		_, port, _ := net.SplitHostPort(l.Addr().String())
+
+		tr := &redis.Transport{TLSConfig: &tls.Config{RootCAs: roots}}
+		defer tr.CloseIdleConnections()
+
+		dns := &fakeDNS{hosts: []string{"127.0.0.1"}}
+		dt := &redis.DNSTransport{Transport: tr, Resolver: dns.resolver()}
+		defer dt.Close()
+
+		cli := &redis.Client{Addr: "rediss://redis.test:" + port, Transport: dt}
+
+		if err := cli.Exec(context.Background(), "GET", "key"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("lookup errors are returned and the host is resolved again on the next request", func(t *testing.T) {
+		dns := &fakeDNS{}
+		tr, dials := newDialRecorder(url)
+		defer tr.CloseIdleConnections()
+
+		dt := &redis.DNSTransport{Transport: tr, Resolver: dns.resolver()}
+		defer dt.Close()
+
+		cli := &redis.Client{Addr: "redis.test:6379", Transport: dt}
+
+		if err := cli.Exec(context.Background(), "SET", "key", "value"); err == nil {
+			t.Error("expected an error")
+		}
+
+		dns.set([]string{"10.0.0.1"})
+
+		if err := cli.Exec(context.Background(), "SET", "key", "value"); err != nil {
+			t.Error(err)
+		}
+
+		if found := dials(); !reflect.DeepEqual(found, []string{"10.0.0.1:6379"}) {
+			t.Errorf("bad dialed addresses: %q", found)
+		}
+	})
+}
+
+// newDialRecorder returns a transport which connects to url for all addresses,
+// and a function returning the sorted list of addresses that were dialed.
+func newDialRecorder(url string) (*redis.Transport, func() []string) {
+	var mutex sync.Mutex
+	var dialed = map[string]bool{}
+
+	tr := &redis.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			mutex.Lock()
+			dialed[address] = true
+			mutex.Unlock()
+			return redis.DefaultDialer.DialContext(ctx, "tcp", strings.TrimPrefix(url, "tcp://"))
+		},
+	}
+
+	return tr, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		addrs := make([]string, 0, len(dialed))
+		for addr := range dialed {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		return addrs
+	}
+}
+
+// fakeDNS answers the A and SRV queries of a net.Resolver with the records it
+// holds, whatever the name that was queried.
+type fakeDNS struct {
+	mutex   sync.Mutex
+	hosts   []string
+	records []net.SRV
+}
+
+func (d *fakeDNS) set(hosts []string) {
+	d.mutex.Lock()
+	d.hosts = hosts
+	d.mutex.Unlock()
+}
+
+func (d *fakeDNS) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			// The resolver uses the TCP framing of messages on connections
+			// which are not net.PacketConn.
+			c1, c2 := net.Pipe()
+			go d.serve(c2)
+			return c1, nil
+		},
+	}
+}
+
+func (d *fakeDNS) serve(c net.Conn) {
+	defer c.Close()
+
+	for {
+		var size [2]byte
+
+		if _, err := io.ReadFull(c, size[:]); err != nil {
+			return
+		}
+
+		query := make([]byte, binary.BigEndian.Uint16(size[:]))
+
+		if _, err := io.ReadFull(c, query); err != nil {
+			return
+		}
+
+		answer := d.answer(query)
+		binary.BigEndian.PutUint16(size[:], uint16(len(answer)))
+
+		if _, err := c.Write(append(size[:], answer...)); err != nil {
+			return
+		}
+	}
+}
+
+func (d *fakeDNS) answer(query []byte) []byte {
+	const typeA, typeSRV = 1, 33
+
+	// The question starts after the 12 bytes header, it is made of the name
+	// followed by the type and class of the query.
+	end := 12
+	for query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	end += 5
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var records [][]byte
+
+	switch qtype {
+	case typeA:
+		for _, host := range d.hosts {
+			records = append(records, dnsRecord(typeA, net.ParseIP(host).To4()))
+		}
+	case typeSRV:
+		for _, r := range d.records {
+			data := make([]byte, 6)
+			binary.BigEndian.PutUint16(data[4:], r.Port)
+			for _, label := range strings.Split(strings.TrimSuffix(r.Target, "."), ".") {
+				data = append(data, byte(len(label)))
+				data = append(data, label...)
+			}
+			records = append(records, dnsRecord(typeSRV, append(data, 0)))
+		}
+	}
+
+	msg := make([]byte, 12, 512)
+	copy(msg, query[:2])                        // id
+	binary.BigEndian.PutUint16(msg[2:], 0x8180) // response, recursion available
+	binary.BigEndian.PutUint16(msg[4:], 1)      // questions
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(records)))
+	if len(records) == 0 && qtype == typeA {
+		binary.BigEndian.PutUint16(msg[2:], 0x8183) // name error
+	}
+
+	msg = append(msg, query[12:end]...)
+
+	for _, r := range records {
+		msg = append(msg, r...)
+	}
+
+	return msg
+}
+
+func dnsRecord(rtype uint16, data []byte) []byte {
+	r := []byte{0xc0, 0x0c, 0, 0, 0, 1, 0, 0, 0, 60, 0, 0} // name pointer, class IN, ttl
+	binary.BigEndian.PutUint16(r[2:], rtype)
+	binary.BigEndian.PutUint16(r[10:], uint16(len(data)))
+	return append(r, data...)
+}
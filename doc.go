@@ -1,4 +1,11 @@
 // Package redis provides Redis client and server implementations.
 //
 // Exec and Query make Redis requests.
+//
+// Like the net/http package, the package exposes a DefaultClient used by the
+// package-level Exec and Query functions, and a DefaultTransport used by all
+// clients which don't configure their own. DefaultTransport pools connections,
+// so programs should share clients (or at least transports) instead of creating
+// them for every request. Both variables may be reassigned at startup to change
+// the defaults of the program.
 package redis
@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"errors"
+	"math"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+var (
+	// ErrNilArg is returned when sending a command with a nil argument (nil
+	// interface or nil pointer) and the NilEncoding is NilError.
+	ErrNilArg = errors.New("redis: nil values cannot be encoded as command arguments")
+
+	// ErrNaNArg is returned when sending a command with a NaN floating point
+	// argument and the NaNEncoding is NaNError.
+	ErrNaNArg = errors.New("redis: NaN cannot be encoded as a command argument")
+)
+
+// ArgEncoding defines how values that have no obvious representation as
+// redis command arguments are encoded.
+//
+// The zero-value is the default encoding: nil values and NaN are rejected,
+// and booleans are encoded as "1" and "0". Empty and nil byte slices are
+// always encoded as empty bulk strings.
+type ArgEncoding struct {
+	Nil  NilEncoding
+	Bool BoolEncoding
+	NaN  NaNEncoding
+}
+
+// NilEncoding is an enumeration of the ways nil values are encoded as command
+// arguments.
+type NilEncoding int
+
+const (
+	// NilError causes commands with nil arguments to fail with ErrNilArg.
+	NilError NilEncoding = iota
+
+	// NilEmpty encodes nil arguments as empty bulk strings.
+	NilEmpty
+)
+
+// BoolEncoding is an enumeration of the ways booleans are encoded as command
+// arguments.
+type BoolEncoding int
+
+const (
+	// BoolInt encodes booleans as "1" and "0", the representation used by
+	// redis in integer replies of commands like EXISTS or SISMEMBER.
+	BoolInt BoolEncoding = iota
+
+	// BoolString encodes booleans as "true" and "false".
+	BoolString
+)
+
+// NaNEncoding is an enumeration of the ways NaN floating point values are
+// encoded as command arguments.
+type NaNEncoding int
+
+const (
+	// NaNError causes commands with NaN arguments to fail with ErrNaNArg,
+	// redis rejects NaN in all commands taking floating point arguments.
+	NaNError NaNEncoding = iota
+
+	// NaNString encodes NaN as the "nan" string.
+	NaNString
+)
+
+// argEmitter wraps the client emitter of connections to apply an ArgEncoding
+// to the command arguments.
+type argEmitter struct {
+	resp.ClientEmitter
+	encoding ArgEncoding
+}
+
+func (e *argEmitter) EmitNil() error {
+	if e.encoding.Nil == NilEmpty {
+		return e.EmitBytes(nil)
+	}
+	return ErrNilArg
+}
+
+func (e *argEmitter) EmitBool(v bool) error {
+	if e.encoding.Bool == BoolString {
+		if v {
+			return e.EmitString("true")
+		}
+		return e.EmitString("false")
+	}
+	return e.ClientEmitter.EmitBool(v)
+}
+
+func (e *argEmitter) EmitFloat(v float64, bitSize int) error {
+	if math.IsNaN(v) {
+		if e.encoding.NaN == NaNString {
+			return e.EmitString("nan")
+		}
+		return ErrNaNArg
+	}
+	return e.ClientEmitter.EmitFloat(v, bitSize)
+}
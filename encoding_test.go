@@ -0,0 +1,92 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestArgEncoding(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var arg string
+		req.Cmds[0].ParseArgs(&arg)
+		res.Write(arg)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		scenario string
+		encoding redis.ArgEncoding
+		arg      interface{}
+		value    string
+		err      error
+	}{
+		{
+			scenario: "nil values are rejected by default",
+			arg:      nil,
+			err:      redis.ErrNilArg,
+		},
+		{
+			scenario: "nil values are encoded as empty strings with NilEmpty",
+			encoding: redis.ArgEncoding{Nil: redis.NilEmpty},
+			arg:      nil,
+			value:    "",
+		},
+		{
+			scenario: "empty byte slices are encoded as empty strings",
+			arg:      []byte{},
+			value:    "",
+		},
+		{
+			scenario: "booleans are encoded as integers by default",
+			arg:      true,
+			value:    "1",
+		},
+		{
+			scenario: "booleans are encoded as strings with BoolString",
+			encoding: redis.ArgEncoding{Bool: redis.BoolString},
+			arg:      false,
+			value:    "false",
+		},
+		{
+			scenario: "NaN is rejected by default",
+			arg:      math.NaN(),
+			err:      redis.ErrNaNArg,
+		},
+		{
+			scenario: "NaN is encoded as a string with NaNString",
+			encoding: redis.ArgEncoding{NaN: redis.NaNString},
+			arg:      math.NaN(),
+			value:    "nan",
+		},
+		{
+			scenario: "infinite floats are encoded as strings",
+			arg:      math.Inf(-1),
+			value:    "-Inf",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			tr := &redis.Transport{ArgEncoding: test.encoding}
+			defer tr.CloseIdleConnections()
+
+			cli := &redis.Client{Addr: url, Transport: tr}
+
+			var value string
+			err := redis.ParseArgs(cli.Query(context.Background(), "ECHO", test.arg), &value)
+
+			switch {
+			case test.err != nil && !errors.Is(err, test.err):
+				t.Errorf("bad error: %v", err)
+			case test.err == nil && err != nil:
+				t.Error(err)
+			case test.err == nil && value != test.value:
+				t.Errorf("bad value: %q", value)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+// ErrClass is the type of values returned by ErrorClass, it allows retry
+// policies, circuit breakers, and metrics to branch on the nature of errors
+// instead of matching their text.
+type ErrClass int
+
+const (
+	// ErrClassNone is the class of nil errors.
+	ErrClassNone ErrClass = iota
+
+	// ErrClassUnknown is the class of errors that don't fall in any other
+	// class, typically network errors other than timeouts and refused
+	// connections.
+	ErrClassUnknown
+
+	// ErrClassCanceled is the class of errors caused by the cancellation of
+	// the request context.
+	ErrClassCanceled
+
+	// ErrClassTimeout is the class of errors caused by deadlines being
+	// exceeded, on the request context or the network connection.
+	ErrClassTimeout
+
+	// ErrClassConnRefused is the class of errors caused by servers refusing
+	// connections.
+	ErrClassConnRefused
+
+	// ErrClassPoolExhausted is the class of errors returned when the client
+	// had no capacity left to send a request, for example ErrOverloaded.
+	ErrClassPoolExhausted
+
+	// ErrClassProtocol is the class of errors caused by responses which could
+	// not be decoded, or were truncated.
+	ErrClassProtocol
+
+	// ErrClassServer is the class of errors returned by servers which don't
+	// fall in a more specific class (ERR, WRONGTYPE, ...).
+	ErrClassServer
+
+	// ErrClassReadonly is the class of READONLY errors, returned by replicas
+	// (or demoted primaries) on write commands.
+	ErrClassReadonly
+
+	// ErrClassLoading is the class of LOADING errors, returned by servers
+	// which are still loading their dataset in memory.
+	ErrClassLoading
+
+	// ErrClassMoved is the class of MOVED and ASK errors, returned by cluster
+	// nodes when a key is served by another node.
+	ErrClassMoved
+
+	// ErrClassServerClosed is the class of ErrServerClosed, returned for
+	// commands which were not answered because the server gracefully closed
+	// the connection, for example when it timed out an idle connection that
+	// the client had pooled. Redis closes connections in between commands,
+	// those commands were not executed and may be retried on a new
+	// connection, unlike commands which failed because of a connection reset,
+	// which are reported as ErrClassUnknown.
+	ErrClassServerClosed
+
+	// ErrClassClusterDown is the class of CLUSTERDOWN errors, returned by
+	// cluster nodes while the cluster can't serve requests, for example
+	// during a failover.
+	ErrClassClusterDown
+)
+
+// String returns a human-readable representation of the error class.
+func (c ErrClass) String() string {
+	switch c {
+	case ErrClassNone:
+		return "none"
+	case ErrClassUnknown:
+		return "unknown"
+	case ErrClassCanceled:
+		return "canceled"
+	case ErrClassTimeout:
+		return "timeout"
+	case ErrClassConnRefused:
+		return "conn-refused"
+	case ErrClassPoolExhausted:
+		return "pool-exhausted"
+	case ErrClassProtocol:
+		return "protocol"
+	case ErrClassServer:
+		return "server"
+	case ErrClassReadonly:
+		return "readonly"
+	case ErrClassLoading:
+		return "loading"
+	case ErrClassMoved:
+		return "moved"
+	case ErrClassServerClosed:
+		return "server-closed"
+	case ErrClassClusterDown:
+		return "cluster-down"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrorClass returns the class of err, looking through the *net.OpError values
+// that transports wrap errors into.
+func ErrorClass(err error) ErrClass {
+	if err == nil {
+		return ErrClassNone
+	}
+
+	switch e := err.(type) {
+	case *resp.Error:
+		switch e.Type() {
+		case "READONLY":
+			return ErrClassReadonly
+		case "LOADING":
+			return ErrClassLoading
+		case "MOVED", "ASK":
+			return ErrClassMoved
+		case "CLUSTERDOWN":
+			return ErrClassClusterDown
+		default:
+			return ErrClassServer
+		}
+
+	case *TypeMismatchError, *ContentTypeError:
+		return ErrClassProtocol
+	}
+
+	switch {
+	case errors.Is(err, ErrOverloaded):
+		return ErrClassPoolExhausted
+	case errors.Is(err, context.Canceled):
+		return ErrClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrClassTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrClassConnRefused
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrClassProtocol
+	case errors.Is(err, ErrServerClosed):
+		return ErrClassServerClosed
+	}
+
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return ErrClassTimeout
+	}
+
+	return ErrClassUnknown
+}
@@ -0,0 +1,75 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorClass(t *testing.T) {
+	opError := func(err error) error {
+		return &net.OpError{Op: "request", Net: "redis", Err: err}
+	}
+
+	tests := []struct {
+		err   error
+		class redis.ErrClass
+	}{
+		{err: nil, class: redis.ErrClassNone},
+		{err: errors.New("whatever"), class: redis.ErrClassUnknown},
+		{err: opError(context.Canceled), class: redis.ErrClassCanceled},
+		{err: opError(context.DeadlineExceeded), class: redis.ErrClassTimeout},
+		{err: opError(timeoutError{}), class: redis.ErrClassTimeout},
+		{err: opError(os.NewSyscallError("connect", syscall.ECONNREFUSED)), class: redis.ErrClassConnRefused},
+		{err: redis.ErrOverloaded, class: redis.ErrClassPoolExhausted},
+		{err: io.ErrUnexpectedEOF, class: redis.ErrClassProtocol},
+		{err: &redis.TypeMismatchError{}, class: redis.ErrClassProtocol},
+		{err: resp.NewError("ERR unknown command"), class: redis.ErrClassServer},
+		{err: resp.NewError("READONLY You can't write against a read only replica."), class: redis.ErrClassReadonly},
+		{err: resp.NewError("LOADING Redis is loading the dataset in memory"), class: redis.ErrClassLoading},
+		{err: resp.NewError("MOVED 3999 127.0.0.1:6381"), class: redis.ErrClassMoved},
+		{err: resp.NewError("ASK 3999 127.0.0.1:6381"), class: redis.ErrClassMoved},
+		{err: redis.ErrServerClosed, class: redis.ErrClassServerClosed},
+		{err: resp.NewError("CLUSTERDOWN The cluster is down"), class: redis.ErrClassClusterDown},
+	}
+
+	for _, test := range tests {
+		t.Run(test.class.String(), func(t *testing.T) {
+			if class := redis.ErrorClass(test.err); class != test.class {
+				t.Errorf("bad class for %v: %s != %s", test.err, class, test.class)
+			}
+		})
+	}
+}
+
+func TestErrorClassConnRefused(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+	err = cli.Exec(context.Background(), "GET", "key")
+
+	if class := redis.ErrorClass(err); class != redis.ErrClassConnRefused {
+		t.Errorf("bad class for %v: %s", err, class)
+	}
+}
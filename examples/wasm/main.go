@@ -0,0 +1,60 @@
+//go:build js && wasm
+
+// Command wasm is an example of a program running in a web browser which talks
+// to a redis server, or to a proxy built on this package, through a WebSocket
+// endpoint bridging binary messages to the RESP connection. The bridge can be
+// any WebSocket to TCP relay, for example websockify:
+//
+//	websockify 8080 localhost:6379
+//
+// The program is built with:
+//
+//	GOOS=js GOARCH=wasm go build -o main.wasm ./examples/wasm
+//
+// and loaded in a page with the wasm_exec.js support file of the Go
+// distribution.
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/redis-go"
+)
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Browsers have no access to raw network connections, the connections of
+	// the transport are opened as WebSockets. The address of the client is
+	// the address of the bridge.
+	dialer := &webSocketDialer{}
+
+	client := &redis.Client{
+		Addr: "localhost:8080",
+
+		// The single connection transport doesn't start background goroutines
+		// to ping idle connections, which is a better fit for short-lived
+		// browser sessions.
+		Transport: &redis.SingleConnTransport{
+			Transport: &redis.Transport{DialContext: dialer.DialContext},
+		},
+	}
+
+	if err := client.Exec(ctx, "SET", "hello", "world"); err != nil {
+		fmt.Println(err)
+	}
+
+	var args = client.Query(ctx, "GET", "hello")
+	var value string
+
+	if args.Next(&value) {
+		fmt.Println(value)
+	}
+
+	if err := args.Close(); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,223 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// webSocketDialer opens WebSockets to a bridge which relays the binary messages
+// to a RESP connection, its DialContext method is set on redis.Transport.
+type webSocketDialer struct {
+	// Secure selects wss:// URLs instead of ws://.
+	Secure bool
+}
+
+// DialContext opens a WebSocket to the bridge. The network is ignored, the
+// address is the host and port of the bridge.
+func (d *webSocketDialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	url := "ws://" + address + "/"
+	if d.Secure {
+		url = "wss://" + address + "/"
+	}
+
+	c := &webSocketConn{
+		ws:     js.Global().Get("WebSocket").New(url),
+		addr:   webSocketAddr(url),
+		notify: make(chan struct{}, 1),
+	}
+	c.ws.Set("binaryType", "arraybuffer")
+
+	opened := make(chan error, 1)
+
+	c.on("open", func(js.Value) {
+		opened <- nil
+	})
+
+	c.on("message", func(event js.Value) {
+		data := js.Global().Get("Uint8Array").New(event.Get("data"))
+		b := make([]byte, data.Length())
+		js.CopyBytesToGo(b, data)
+
+		c.mutex.Lock()
+		c.rbuf.Write(b)
+		c.mutex.Unlock()
+		c.signal()
+	})
+
+	c.on("error", func(js.Value) {
+		select {
+		case opened <- errors.New("websocket: failed to connect to " + url):
+		default:
+		}
+		c.fail(errors.New("websocket: connection error"))
+	})
+
+	c.on("close", func(js.Value) {
+		select {
+		case opened <- errors.New("websocket: connection to " + url + " closed"):
+		default:
+		}
+		c.fail(io.EOF)
+	})
+
+	select {
+	case err := <-opened:
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+
+	case <-ctx.Done():
+		c.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// webSocketConn adapts a browser WebSocket to the net.Conn interface. Received
+// messages are buffered until they are read, writes are sent as binary
+// messages.
+type webSocketConn struct {
+	ws     js.Value
+	addr   webSocketAddr
+	funcs  []js.Func
+	notify chan struct{}
+
+	mutex     sync.Mutex
+	rbuf      bytes.Buffer
+	rerr      error
+	rdeadline time.Time
+	closed    bool
+}
+
+func (c *webSocketConn) Read(b []byte) (int, error) {
+	for {
+		c.mutex.Lock()
+		if c.rbuf.Len() != 0 {
+			n, _ := c.rbuf.Read(b)
+			c.mutex.Unlock()
+			return n, nil
+		}
+		err, deadline := c.rerr, c.rdeadline
+		c.mutex.Unlock()
+
+		if err != nil {
+			return 0, err
+		}
+
+		if deadline.IsZero() {
+			<-c.notify
+			continue
+		}
+
+		d := time.Until(deadline)
+		if d <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		timer := time.NewTimer(d)
+
+		select {
+		case <-c.notify:
+			timer.Stop()
+		case <-timer.C:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (c *webSocketConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	err := c.rerr
+	c.mutex.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	data := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(data, b)
+	c.ws.Call("send", data)
+	return len(b), nil
+}
+
+func (c *webSocketConn) Close() error {
+	c.mutex.Lock()
+	closed := c.closed
+	c.closed = true
+	c.mutex.Unlock()
+
+	if closed {
+		return nil
+	}
+
+	c.ws.Call("close")
+	c.fail(net.ErrClosed)
+
+	for _, f := range c.funcs {
+		f.Release()
+	}
+
+	return nil
+}
+
+func (c *webSocketConn) LocalAddr() net.Addr  { return c.addr }
+func (c *webSocketConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *webSocketConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *webSocketConn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.rdeadline = t
+	c.mutex.Unlock()
+	// Wakes up blocked reads so they observe the new deadline, this is how
+	// the transport interrupts reads when requests are canceled.
+	c.signal()
+	return nil
+}
+
+// SetWriteDeadline is a no-op, WebSocket writes never block.
+func (c *webSocketConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *webSocketConn) on(event string, handler func(js.Value)) {
+	f := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		handler(args[0])
+		return nil
+	})
+	c.funcs = append(c.funcs, f)
+	c.ws.Call("addEventListener", event, f)
+}
+
+func (c *webSocketConn) fail(err error) {
+	c.mutex.Lock()
+	if c.rerr == nil {
+		c.rerr = err
+	}
+	c.mutex.Unlock()
+	c.signal()
+}
+
+func (c *webSocketConn) signal() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+type webSocketAddr string
+
+func (a webSocketAddr) Network() string { return "websocket" }
+func (a webSocketAddr) String() string  { return string(a) }
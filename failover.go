@@ -0,0 +1,145 @@
+package redis
+
+import (
+	"context"
+	"sync"
+)
+
+// The TopologyRefresher interface is implemented by server registries which
+// cache the topology of servers (which server is the primary, which slots are
+// served by which node, ...) and can be asked to refresh it, typically after
+// an error indicating that the topology changed.
+type TopologyRefresher interface {
+	// RefreshTopology reloads the topology of servers.
+	RefreshTopology(ctx context.Context) error
+}
+
+// A FailoverTransport is a RoundTripper which sends requests to the primary
+// server exposed by a registry, and transparently recovers from failovers.
+//
+// When a write hits a demoted primary which responds with a READONLY error,
+// the transport refreshes the topology of the registry (if it implements the
+// TopologyRefresher interface) and retries the request once against the new
+// primary. To be able to retry them, the arguments of write requests are
+// loaded in memory before being sent. Transactions are not retried.
+type FailoverTransport struct {
+	// Transport is used to send requests. If nil, DefaultTransport is used.
+	Transport RoundTripper
+
+	// Primary exposes the primary server that requests are sent to, the first
+	// endpoint it returns is used. If nil, or if it returns no endpoints,
+	// requests are sent to their original address.
+	Primary ServerRegistry
+
+	mutex sync.Mutex
+	stats FailoverStats
+}
+
+// FailoverStats carries counters of the failovers observed by a
+// FailoverTransport.
+type FailoverStats struct {
+	// ReadonlyErrors is the number of READONLY errors returned by servers.
+	ReadonlyErrors int64
+
+	// Refreshes is the number of times the topology of the registry was
+	// refreshed after a READONLY error.
+	Refreshes int64
+}
+
+// RoundTrip satisfies the RoundTripper interface.
+func (t *FailoverTransport) RoundTrip(req *Request) (*Response, error) {
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if req.IsTransaction() || classOfRequest(req) == ClassRead {
+		return t.send(ctx, req, req.Cmds)
+	}
+
+	cmds := make([]Command, len(req.Cmds))
+	copy(cmds, req.Cmds)
+
+	for i := range cmds {
+		cmds[i].loadByteArgs()
+	}
+
+	res, err := t.send(ctx, req, copyByteArgs(cmds))
+	if err != nil || NextType(res.Args) != TypeError {
+		return res, err
+	}
+
+	// The response is a single error, it has to be read to figure out whether
+	// the request should be retried, and replaced by an equivalent response
+	// if it is not.
+	if err = res.Args.Close(); ErrorClass(err) != ErrClassReadonly {
+		return &Response{Args: newArgsError(err), Request: req}, nil
+	}
+
+	t.mutex.Lock()
+	t.stats.ReadonlyErrors++
+	t.mutex.Unlock()
+
+	if refresher, ok := t.Primary.(TopologyRefresher); ok {
+		if err := refresher.RefreshTopology(ctx); err != nil {
+			return nil, err
+		}
+		t.mutex.Lock()
+		t.stats.Refreshes++
+		t.mutex.Unlock()
+	}
+
+	return t.send(ctx, req, copyByteArgs(cmds))
+}
+
+// Stats returns the counters of failovers observed by the transport.
+func (t *FailoverTransport) Stats() FailoverStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.stats
+}
+
+func (t *FailoverTransport) send(ctx context.Context, req *Request, cmds []Command) (*Response, error) {
+	r := *req
+	r.Cmds = cmds
+
+	if t.Primary != nil {
+		endpoints, err := t.Primary.LookupServers(ctx)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		if len(endpoints) != 0 {
+			r.Addr = endpoints[0].Addr
+		}
+	}
+
+	res, err := t.transport().RoundTrip(&r)
+	if res != nil {
+		res.Request = req
+	}
+	return res, err
+}
+
+func (t *FailoverTransport) transport() RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return DefaultTransport
+}
+
+// copyByteArgs returns a copy of cmds where each byteArgs value is replaced by
+// a new value sharing the same arguments, so the commands can be sent again
+// after the original values were consumed.
+func copyByteArgs(cmds []Command) []Command {
+	c := make([]Command, len(cmds))
+
+	for i, cmd := range cmds {
+		if a, ok := cmd.Args.(*byteArgs); ok {
+			cmd.Args = &byteArgs{args: a.args}
+		}
+		c[i] = cmd
+	}
+
+	return c
+}
@@ -0,0 +1,91 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+// testPrimaryRegistry is a registry which switches to the next server in its
+// list every time its topology is refreshed.
+type testPrimaryRegistry struct {
+	mutex sync.Mutex
+	addrs []string
+}
+
+func (r *testPrimaryRegistry) LookupServers(ctx context.Context) ([]redis.ServerEndpoint, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return []redis.ServerEndpoint{{Addr: r.addrs[0]}}, nil
+}
+
+func (r *testPrimaryRegistry) RefreshTopology(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.addrs) > 1 {
+		r.addrs = r.addrs[1:]
+	}
+	return nil
+}
+
+func TestFailoverTransport(t *testing.T) {
+	values := make(chan string, 1)
+
+	demoted, demotedURL := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write(resp.NewError("READONLY You can't write against a read only replica."))
+	}))
+	defer demoted.Close()
+
+	primary, primaryURL := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var key, value string
+		req.Cmds[0].ParseArgs(&key, &value)
+		values <- value
+		res.Write("OK")
+	}))
+	defer primary.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	failover := &redis.FailoverTransport{
+		Transport: tr,
+		Primary:   &testPrimaryRegistry{addrs: []string{demotedURL, primaryURL}},
+	}
+
+	cli := &redis.Client{Transport: failover}
+
+	if err := cli.Exec(context.Background(), "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	if value := <-values; value != "world" {
+		t.Error("bad value received by the new primary:", value)
+	}
+
+	if stats := failover.Stats(); stats.ReadonlyErrors != 1 || stats.Refreshes != 1 {
+		t.Errorf("bad stats: %+v", stats)
+	}
+
+	// Other errors are returned as-is, and not retried.
+	other, otherURL := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write(resp.NewError("ERR something went wrong"))
+	}))
+	defer other.Close()
+
+	failover = &redis.FailoverTransport{
+		Transport: tr,
+		Primary:   redis.ServerEndpoint{Addr: otherURL},
+	}
+	cli.Transport = failover
+
+	if err := cli.Exec(context.Background(), "SET", "hello", "world"); redis.ErrorClass(err) != redis.ErrClassServer {
+		t.Error("bad error:", err)
+	}
+
+	if stats := failover.Stats(); stats.ReadonlyErrors != 0 {
+		t.Errorf("bad stats: %+v", stats)
+	}
+}
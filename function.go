@@ -0,0 +1,189 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// FunctionLibrary describes a library of Redis Functions loaded on a server,
+// as returned by FUNCTION LIST.
+type FunctionLibrary struct {
+	Name      string
+	Engine    string
+	Functions []string
+}
+
+// FunctionLoad loads a library of functions on the server with FUNCTION LOAD,
+// returning the name of the library. When replace is true, an existing library
+// of the same name is replaced.
+//
+// The code must start with a shebang declaring the engine and name of the
+// library, for example "#!lua name=mylib".
+func (c *Client) FunctionLoad(ctx context.Context, code string, replace bool) (string, error) {
+	var name string
+	var args = []interface{}{"LOAD"}
+
+	if replace {
+		args = append(args, "REPLACE")
+	}
+
+	err := ParseArgs(c.Query(ctx, "FUNCTION", append(args, code)...), &name)
+	return name, err
+}
+
+// FunctionList returns the libraries of functions loaded on the server whose
+// names match pattern, or all libraries if pattern is empty.
+func (c *Client) FunctionList(ctx context.Context, pattern string) ([]FunctionLibrary, error) {
+	var libs []FunctionLibrary
+	var args = []interface{}{"LIST"}
+
+	if len(pattern) != 0 {
+		args = append(args, "LIBRARYNAME", pattern)
+	}
+
+	r := c.Query(ctx, "FUNCTION", args...)
+	var v []interface{}
+
+	for r.Next(&v) {
+		libs = append(libs, makeFunctionLibrary(v))
+		v = nil
+	}
+
+	return libs, r.Close()
+}
+
+// FCall calls a function with FCALL, passing it keys and args, and returns the
+// values produced by the function.
+func (c *Client) FCall(ctx context.Context, function string, keys []string, args ...interface{}) Args {
+	return c.Query(ctx, "FCALL", fcallArgs(function, keys, args)...)
+}
+
+// FCallRO is like FCall but uses FCALL_RO, which may be sent to replicas. The
+// function must have been declared with the no-writes flag.
+func (c *Client) FCallRO(ctx context.Context, function string, keys []string, args ...interface{}) Args {
+	return c.Query(ctx, "FCALL_RO", fcallArgs(function, keys, args)...)
+}
+
+func fcallArgs(function string, keys []string, args []interface{}) []interface{} {
+	list := make([]interface{}, 0, 2+len(keys)+len(args))
+	list = append(list, function, len(keys))
+
+	for _, key := range keys {
+		list = append(list, key)
+	}
+
+	return append(list, args...)
+}
+
+// makeFunctionLibrary converts an entry of a FUNCTION LIST response, which is
+// a flat list of field names and values.
+func makeFunctionLibrary(v []interface{}) FunctionLibrary {
+	var lib FunctionLibrary
+
+	for i := 0; i+1 < len(v); i += 2 {
+		switch toString(v[i]) {
+		case "library_name":
+			lib.Name = toString(v[i+1])
+		case "engine":
+			lib.Engine = toString(v[i+1])
+		case "functions":
+			functions, _ := v[i+1].([]interface{})
+
+			for _, f := range functions {
+				fields, _ := f.([]interface{})
+
+				for j := 0; j+1 < len(fields); j += 2 {
+					if toString(fields[j]) == "name" {
+						lib.Functions = append(lib.Functions, toString(fields[j+1]))
+					}
+				}
+			}
+		}
+	}
+
+	return lib
+}
+
+func toString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// LibraryName returns the name of the library declared in the shebang of
+// code, or an empty string if it has none.
+func LibraryName(code string) string {
+	line := code
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+
+	for _, field := range strings.Fields(line[2:]) {
+		if strings.HasPrefix(field, "name=") {
+			return field[5:]
+		}
+	}
+
+	return ""
+}
+
+// A FunctionRegistry holds the libraries of functions that a program depends
+// on, and makes sure they are loaded on the server.
+//
+// Programs typically call Ensure at startup, and may call it again when FCALL
+// returns an error indicating that a function doesn't exist (for example
+// after a server restart without persistence).
+type FunctionRegistry struct {
+	// Client is used to send requests to the server.
+	Client *Client
+
+	// Libraries is the code of the libraries that the program depends on.
+	Libraries []string
+}
+
+// Ensure verifies that all libraries of the registry are loaded on the server,
+// and loads the missing ones.
+func (r *FunctionRegistry) Ensure(ctx context.Context) error {
+	loaded, err := r.Client.FunctionList(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(loaded))
+
+	for _, lib := range loaded {
+		names[lib.Name] = true
+	}
+
+	for _, code := range r.Libraries {
+		name := LibraryName(code)
+
+		if len(name) == 0 {
+			return fmt.Errorf("redis: missing library name in the shebang of a function library")
+		}
+
+		if names[name] {
+			continue
+		}
+
+		if _, err := r.Client.FunctionLoad(ctx, code, false); err != nil {
+			return err
+		}
+
+		names[name] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+const testLibrary = `#!lua name=testlib
+redis.register_function('echo', function(keys, args) return args[1] end)
+`
+
+func TestLibraryName(t *testing.T) {
+	tests := []struct {
+		code string
+		name string
+	}{
+		{code: testLibrary, name: "testlib"},
+		{code: "#!lua name=other", name: "other"},
+		{code: "#!lua\nreturn 1", name: ""},
+		{code: "return 1", name: ""},
+	}
+
+	for _, test := range tests {
+		if name := redis.LibraryName(test.code); name != test.name {
+			t.Errorf("bad library name: %q != %q", name, test.name)
+		}
+	}
+}
+
+func TestFunctionRegistry(t *testing.T) {
+	var mutex sync.Mutex
+	var loads int
+	var libraries = map[string]bool{}
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		cmd := req.Cmds[0]
+
+		switch cmd.Cmd {
+		case "FUNCTION":
+			var sub, code string
+			cmd.ParseArgs(&sub, &code)
+
+			switch sub {
+			case "LIST":
+				list := []interface{}{}
+				for name := range libraries {
+					list = append(list, []interface{}{
+						"library_name", name,
+						"engine", "LUA",
+						"functions", []interface{}{
+							[]interface{}{"name", "echo", "description", nil, "flags", []interface{}{}},
+						},
+					})
+				}
+				res.Write(list)
+
+			case "LOAD":
+				loads++
+				name := redis.LibraryName(code)
+				libraries[name] = true
+				res.Write(name)
+			}
+
+		case "FCALL", "FCALL_RO":
+			var function string
+			var numkeys int
+			var arg string
+			cmd.ParseArgs(&function, &numkeys, &arg)
+
+			if !libraries["testlib"] {
+				res.Write(resp.NewError("ERR Function not found"))
+			} else {
+				res.Write(arg)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+	ctx := context.Background()
+
+	registry := &redis.FunctionRegistry{
+		Client:    cli,
+		Libraries: []string{testLibrary},
+	}
+
+	for i := 0; i != 2; i++ {
+		if err := registry.Ensure(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if loads != 1 {
+		t.Error("libraries must only be loaded when they are missing:", loads)
+	}
+
+	libs, err := cli.FunctionList(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []redis.FunctionLibrary{{Name: "testlib", Engine: "LUA", Functions: []string{"echo"}}}
+
+	if !reflect.DeepEqual(libs, expect) {
+		t.Errorf("bad libraries: %#v", libs)
+	}
+
+	var value string
+
+	if err := redis.ParseArgs(cli.FCallRO(ctx, "echo", nil, "hello"), &value); err != nil {
+		t.Error(err)
+	} else if value != "hello" {
+		t.Error("bad value:", value)
+	}
+}
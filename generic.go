@@ -0,0 +1,77 @@
+//go:build go1.18
+
+package redis
+
+import "context"
+
+// This file contains generic helpers which decode replies into Go types given
+// as type parameters, instead of pointers passed to Args.Next. The package-level
+// Query and Exec functions predate them, so they are named QuerySeq and Exec1.
+
+// Seq is an iterator over a sequence of values of type T. It has the same
+// definition as iter.Seq, so with Go 1.23 and above it can be used in range
+// loops:
+//
+//	keys, err := redis.QuerySeq[string](ctx, client, "KEYS", "*")
+//	if err != nil {
+//		...
+//	}
+//	for key := range keys {
+//		...
+//	}
+type Seq[T any] func(yield func(T) bool)
+
+// QuerySeq sends cmd and args with client (or DefaultClient if nil), decodes
+// each element of the reply into a value of type T, and returns an iterator
+// over the values.
+//
+// The reply is read entirely before QuerySeq returns, so any error is reported
+// by the function instead of being deferred to the end of the iteration, and
+// the iterator can be used multiple times.
+func QuerySeq[T any](ctx context.Context, client *Client, cmd string, args ...interface{}) (Seq[T], error) {
+	values, err := queryValues[T](ctx, client, cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(T) bool) {
+		for _, v := range values {
+			if !yield(v) {
+				return
+			}
+		}
+	}, nil
+}
+
+// Exec1 sends cmd and args with client (or DefaultClient if nil) and decodes
+// the reply into a value of type T. The zero value of T is returned if the
+// reply is empty.
+func Exec1[T any](ctx context.Context, client *Client, cmd string, args ...interface{}) (T, error) {
+	var v T
+	err := ParseArgs(clientOrDefault(client).Query(ctx, cmd, args...), &v)
+	return v, err
+}
+
+func queryValues[T any](ctx context.Context, client *Client, cmd string, args ...interface{}) ([]T, error) {
+	it := clientOrDefault(client).Query(ctx, cmd, args...)
+	var values []T
+
+	for {
+		var v T
+		if !it.Next(&v) {
+			break
+		}
+		values = append(values, v)
+	}
+
+	if err := it.Close(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func clientOrDefault(client *Client) *Client {
+	if client != nil {
+		return client
+	}
+	return DefaultClient
+}
@@ -0,0 +1,125 @@
+//go:build go1.18
+
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestGenericQuery(t *testing.T) {
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		switch cmd {
+		case "CLIENT":
+			return ""
+		case "KEYS":
+			return "*3\r\n$1\r\nA\r\n$1\r\nB\r\n$1\r\nC\r\n"
+		case "INCR":
+			return ":42\r\n"
+		case "GET":
+			return "$5\r\nhello\r\n"
+		default:
+			return "-ERR unknown command\r\n"
+		}
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+	ctx := context.Background()
+
+	tests := []struct {
+		scenario string
+		function func(*testing.T)
+	}{
+		{
+			scenario: "QuerySeq decodes each element of the reply",
+			function: func(t *testing.T) {
+				keys, err := redis.QuerySeq[string](ctx, cli, "KEYS", "*")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var found []string
+				keys(func(key string) bool {
+					found = append(found, key)
+					return true
+				})
+
+				if !reflect.DeepEqual(found, []string{"A", "B", "C"}) {
+					t.Error("bad keys:", found)
+				}
+			},
+		},
+		{
+			scenario: "QuerySeq stops when yield returns false",
+			function: func(t *testing.T) {
+				keys, err := redis.QuerySeq[string](ctx, cli, "KEYS", "*")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				n := 0
+				keys(func(string) bool {
+					n++
+					return false
+				})
+
+				if n != 1 {
+					t.Error("bad number of values:", n)
+				}
+			},
+		},
+		{
+			scenario: "QuerySeq returns errors before iterating",
+			function: func(t *testing.T) {
+				if _, err := redis.QuerySeq[string](ctx, cli, "NOPE"); err == nil {
+					t.Error("expected an error")
+				}
+			},
+		},
+		{
+			scenario: "Exec1 decodes integer replies",
+			function: func(t *testing.T) {
+				n, err := redis.Exec1[int64](ctx, cli, "INCR", "A")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != 42 {
+					t.Error("bad value:", n)
+				}
+			},
+		},
+		{
+			scenario: "Exec1 decodes bulk string replies",
+			function: func(t *testing.T) {
+				s, err := redis.Exec1[string](ctx, cli, "GET", "A")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s != "hello" {
+					t.Error("bad value:", s)
+				}
+			},
+		},
+		{
+			scenario: "Exec1 returns error replies",
+			function: func(t *testing.T) {
+				if _, err := redis.Exec1[string](ctx, cli, "NOPE"); err == nil {
+					t.Error("expected an error")
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			testFunc(t)
+		})
+	}
+}
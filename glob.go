@@ -0,0 +1,104 @@
+package redis
+
+// matchGlob reports whether str matches the glob-style pattern, with the
+// semantics of redis (the stringmatchlen function) used by PSUBSCRIBE, KEYS or
+// SCAN: '*' matches any sequence of bytes, '?' any single byte, "[abc]" one of
+// the bytes in the brackets, "[^abc]" any other byte, "[a-z]" the bytes in the
+// range, and '\' escapes the next byte.
+//
+// Unlike path.Match, '/' has no special meaning, and malformed patterns match
+// like they do on redis instead of reporting an error.
+func matchGlob(pattern, str string) bool {
+	p, s := 0, 0
+
+	for p < len(pattern) && s < len(str) {
+		switch pattern[p] {
+		case '*':
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p+1 == len(pattern) {
+				return true
+			}
+			for ; s < len(str); s++ {
+				if matchGlob(pattern[p+1:], str[s:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			s++
+
+		case '[':
+			p++
+			not := p < len(pattern) && pattern[p] == '^'
+			if not {
+				p++
+			}
+			match := false
+
+			for {
+				if p == len(pattern) {
+					// Unterminated sets end with the pattern, p is moved back
+					// so it reaches the end of the pattern after the set.
+					p--
+					break
+				}
+
+				if pattern[p] == '\\' && p+1 < len(pattern) {
+					p++
+					if pattern[p] == str[s] {
+						match = true
+					}
+				} else if pattern[p] == ']' {
+					break
+				} else if p+2 < len(pattern) && pattern[p+1] == '-' {
+					start, end := pattern[p], pattern[p+2]
+					if start > end {
+						start, end = end, start
+					}
+					if c := str[s]; c >= start && c <= end {
+						match = true
+					}
+					p += 2
+				} else if pattern[p] == str[s] {
+					match = true
+				}
+
+				p++
+			}
+
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			s++
+
+		case '\\':
+			if p+1 < len(pattern) {
+				p++
+			}
+			fallthrough
+
+		default:
+			if pattern[p] != str[s] {
+				return false
+			}
+			s++
+		}
+
+		p++
+
+		if s == len(str) {
+			for p < len(pattern) && pattern[p] == '*' {
+				p++
+			}
+			break
+		}
+	}
+
+	return p == len(pattern) && s == len(str)
+}
@@ -0,0 +1,45 @@
+package redis
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{pattern: "news.*", str: "news.sports", match: true},
+		{pattern: "news.*", str: "news.sports/football", match: true},
+		{pattern: "news.*", str: "weather.today", match: false},
+		{pattern: "*", str: "a/b/c", match: true},
+		{pattern: "a*c", str: "abbbc", match: true},
+		{pattern: "a*c", str: "abbbd", match: false},
+		{pattern: "a**", str: "a", match: true},
+		{pattern: "h?llo", str: "hello", match: true},
+		{pattern: "h?llo", str: "hllo", match: false},
+		{pattern: "h[ae]llo", str: "hallo", match: true},
+		{pattern: "h[ae]llo", str: "hillo", match: false},
+		{pattern: "h[^e]llo", str: "hallo", match: true},
+		{pattern: "h[^e]llo", str: "hello", match: false},
+		{pattern: "h[a-b]llo", str: "hbllo", match: true},
+		{pattern: "h[b-a]llo", str: "hbllo", match: true},
+		{pattern: "h[a-b]llo", str: "hcllo", match: false},
+		{pattern: `h[\]]llo`, str: "h]llo", match: true},
+		{pattern: `h\*llo`, str: "h*llo", match: true},
+		{pattern: `h\*llo`, str: "hello", match: false},
+		{pattern: `h\?`, str: "h?", match: true},
+		{pattern: "h[el", str: "he", match: true},
+		{pattern: "h[el", str: "hl", match: true},
+		{pattern: "[", str: "x", match: false},
+		{pattern: `a\`, str: `a\`, match: true},
+		{pattern: "", str: "", match: true},
+		{pattern: "", str: "a", match: false},
+		{pattern: "a", str: "", match: false},
+	}
+
+	for _, test := range tests {
+		if match := matchGlob(test.pattern, test.str); match != test.match {
+			t.Errorf("matchGlob(%q, %q) = %t, expected %t", test.pattern, test.str, match, test.match)
+		}
+	}
+}
@@ -42,8 +42,13 @@ func makeHashRing(endpoints ...ServerEndpoint) hashRing {
 }
 
 func (ring hashRing) lookup(key string) (addr string) {
+	return ring.lookupHash(jody.HashString64(key))
+}
+
+// lookupHash is like lookup but takes the hash of the key.
+func (ring hashRing) lookupHash(hash uint64) (addr string) {
 	n := len(ring)
-	h := consistentHash(jody.HashString64(key))
+	h := consistentHash(hash)
 	i := sort.Search(n, func(i int) bool { return h < ring[i].hash })
 
 	if i == n {
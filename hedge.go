@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// hedgeStats counts the hedged requests of a transport.
+type hedgeStats struct {
+	sent int64
+	wins int64
+}
+
+type hedgeResult struct {
+	res    *Response
+	err    error
+	hedged bool
+}
+
+// roundTripHedged sends req, and sends it a second time if it got no response
+// after the hedge delay of the transport, returning the first response.
+//
+// The original request is not canceled when the hedged request wins, canceling
+// it would close its connection, which is what hedging tries to preserve when
+// the server is only slow to respond.
+func (t *Transport) roundTripHedged(req *Request) (*Response, error) {
+	// The arguments are loaded in memory so the command can be sent twice.
+	cmds := make([]Command, len(req.Cmds))
+	copy(cmds, req.Cmds)
+
+	for i := range cmds {
+		cmds[i].loadByteArgs()
+	}
+
+	results := make(chan hedgeResult, 2)
+
+	send := func(addr string, hedged bool) {
+		r := *req
+		r.Addr = addr
+		r.Cmds = copyByteArgs(cmds)
+
+		res, err := t.roundTrip(&r)
+		if res != nil {
+			res.Request = req
+		}
+
+		results <- hedgeResult{res: res, err: err, hedged: hedged}
+	}
+
+	go send(req.Addr, false)
+
+	timer := time.NewTimer(t.HedgeDelay)
+	defer timer.Stop()
+
+	timeout := timer.C
+	pending := 1
+
+	var err error
+
+	for {
+		select {
+		case <-timeout:
+			timeout = nil
+			pending++
+			atomic.AddInt64(&t.hedges.sent, 1)
+			go send(t.hedgeAddr(req.Addr), true)
+
+		case r := <-results:
+			pending--
+
+			if r.err == nil {
+				if r.hedged {
+					atomic.AddInt64(&t.hedges.wins, 1)
+				}
+				if pending != 0 {
+					go discardHedgeResult(results)
+				}
+				return r.res, nil
+			}
+
+			// A request which failed before the hedge delay expired is not
+			// hedged, retrying requests is the job of the client.
+			if err == nil {
+				err = r.err
+			}
+			if pending == 0 {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (t *Transport) hedgeAddr(addr string) string {
+	if t.HedgeAddr != nil {
+		if a := t.HedgeAddr(addr); len(a) != 0 {
+			return a
+		}
+	}
+	return addr
+}
+
+// discardHedgeResult waits for the response that lost the race and closes it,
+// returning its connection to the pool.
+func discardHedgeResult(results <-chan hedgeResult) {
+	if r := <-results; r.res != nil {
+		r.res.Args.Close()
+	}
+}
@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// A Hook intercepts the requests sent by a Client, to plug logging, metrics,
+// or request mutation without wrapping every call site. Either function may be
+// nil.
+//
+// Hooks are called for every request sent by the client, including each retry
+// of a command, with the context bounded by the client's timeout:
+//
+//	client := &redis.Client{
+//		Hooks: []redis.Hook{{
+//			AfterExec: func(req *redis.Request, info redis.ExecInfo) {
+//				log.Printf("%s %s: %s (%v)", req.Addr, redis.SpanName(req), info.Duration, info.Err)
+//			},
+//		}},
+//	}
+type Hook struct {
+	// BeforeExec is called before the request is sent. It may modify the
+	// request, for example to change its address or attach values to its
+	// context, but must not read the arguments of its commands. If it returns
+	// an error the request is not sent, the hooks that follow are not called,
+	// and the error is returned to the caller.
+	BeforeExec func(req *Request) error
+
+	// AfterExec is called once, when the response is closed or when the
+	// request fails. It is not called if BeforeExec aborted the request.
+	AfterExec func(req *Request, info ExecInfo)
+}
+
+// ExecInfo carries the outcome of a request intercepted by a Hook.
+type ExecInfo struct {
+	// Cmds describes the commands of the request, in order.
+	Cmds []CommandInfo
+
+	// Addr is the address that the request was sent to.
+	Addr string
+
+	// Values is the number of values read from the response, for
+	// transactions and pipelines it sums the values of all commands.
+	Values int
+
+	// Duration is the time elapsed between sending the request and closing
+	// its response.
+	Duration time.Duration
+
+	// Err is the error of the request, or the first error of the response,
+	// including redis error replies. Err is nil if the request succeeded.
+	Err error
+}
+
+// CommandInfo describes a command of a request without exposing the values of
+// its arguments.
+type CommandInfo struct {
+	// Cmd is the name of the command.
+	Cmd string
+
+	// Args is the number of arguments of the command.
+	Args int
+}
+
+// hookTransport is the RoundTripper used by clients which have hooks.
+type hookTransport struct {
+	transport RoundTripper
+	hooks     []Hook
+}
+
+func (t *hookTransport) RoundTrip(req *Request) (*Response, error) {
+	for _, hook := range t.hooks {
+		if hook.BeforeExec != nil {
+			if err := hook.BeforeExec(req); err != nil {
+				req.Close()
+				return nil, err
+			}
+		}
+	}
+
+	cmds := make([]CommandInfo, len(req.Cmds))
+	for i, cmd := range req.Cmds {
+		cmds[i].Cmd = cmd.Cmd
+		if cmd.Args != nil {
+			cmds[i].Args = cmd.Args.Len()
+		}
+	}
+
+	tracing := &TracingTransport{
+		Transport: t.transport,
+		Tracer:    hookTracer{hooks: t.hooks, cmds: cmds},
+	}
+	return tracing.RoundTrip(req)
+}
+
+// hookTracer reuses the response tracking of TracingTransport to call the
+// AfterExec functions of hooks.
+type hookTracer struct {
+	hooks []Hook
+	cmds  []CommandInfo
+}
+
+func (t hookTracer) Start(ctx context.Context, req *Request) (context.Context, Span) {
+	return ctx, &hookSpan{tracer: t, req: req, start: time.Now()}
+}
+
+type hookSpan struct {
+	tracer hookTracer
+	req    *Request
+	start  time.Time
+}
+
+func (s *hookSpan) End(info SpanInfo) {
+	exec := ExecInfo{
+		Cmds:     s.tracer.cmds,
+		Addr:     info.Addr,
+		Values:   info.Values,
+		Duration: time.Since(s.start),
+		Err:      info.Err,
+	}
+
+	for _, hook := range s.tracer.hooks {
+		if hook.AfterExec != nil {
+			hook.AfterExec(s.req, exec)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestClientHooks(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context)
+	}{
+		{
+			scenario: "hooks are called in order and see the commands, values and duration of requests",
+			function: testClientHooksOrder,
+		},
+		{
+			scenario: "error replies are passed to AfterExec",
+			function: testClientHooksErrorReply,
+		},
+		{
+			scenario: "BeforeExec can modify requests",
+			function: testClientHooksModifyRequest,
+		},
+		{
+			scenario: "an error returned by BeforeExec aborts the request",
+			function: testClientHooksAbort,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			testFunc(t, ctx)
+		})
+	}
+}
+
+func newHookedServer(hooks ...redis.Hook) (*redis.Client, func()) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		switch req.Cmds[0].Cmd {
+		case "LRANGE":
+			res.WriteStream(2)
+			res.Write("a")
+			res.Write("b")
+		default:
+			res.Write(errors.New("ERR unsupported"))
+		}
+	}))
+
+	tr := &redis.Transport{}
+	cli := &redis.Client{Addr: url, Transport: tr, Hooks: hooks}
+
+	return cli, func() {
+		tr.CloseIdleConnections()
+		srv.Close()
+	}
+}
+
+func testClientHooksOrder(t *testing.T, ctx context.Context) {
+	var calls []string
+	var info redis.ExecInfo
+
+	cli, teardown := newHookedServer(
+		redis.Hook{
+			BeforeExec: func(req *redis.Request) error {
+				calls = append(calls, "before 1")
+				return nil
+			},
+			AfterExec: func(req *redis.Request, i redis.ExecInfo) {
+				calls = append(calls, "after 1")
+				info = i
+			},
+		},
+		redis.Hook{
+			BeforeExec: func(req *redis.Request) error {
+				calls = append(calls, "before 2")
+				return nil
+			},
+			AfterExec: func(req *redis.Request, i redis.ExecInfo) {
+				calls = append(calls, "after 2")
+			},
+		},
+	)
+	defer teardown()
+
+	args := cli.Query(ctx, "LRANGE", "key", 0, -1)
+
+	if len(calls) != 2 {
+		t.Fatal("AfterExec was called before the response was closed:", calls)
+	}
+
+	for v := ""; args.Next(&v); {
+	}
+	if err := args.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"before 1", "before 2", "after 1", "after 2"}; !reflect.DeepEqual(calls, want) {
+		t.Error("bad calls:", calls)
+	}
+	if len(info.Cmds) != 1 || info.Cmds[0] != (redis.CommandInfo{Cmd: "LRANGE", Args: 3}) {
+		t.Errorf("bad commands: %+v", info.Cmds)
+	}
+	if info.Addr != cli.Addr {
+		t.Error("bad address:", info.Addr)
+	}
+	if info.Values != 2 {
+		t.Error("bad number of values:", info.Values)
+	}
+	if info.Duration <= 0 {
+		t.Error("bad duration:", info.Duration)
+	}
+	if info.Err != nil {
+		t.Error("unexpected error:", info.Err)
+	}
+}
+
+func testClientHooksErrorReply(t *testing.T, ctx context.Context) {
+	errs := make(chan error, 1)
+
+	cli, teardown := newHookedServer(redis.Hook{
+		AfterExec: func(req *redis.Request, info redis.ExecInfo) { errs <- info.Err },
+	})
+	defer teardown()
+
+	if err := cli.Exec(ctx, "SET", "key", "value"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if err := <-errs; err == nil || err.Error() != "ERR unsupported" {
+		t.Error("bad error:", err)
+	}
+}
+
+func testClientHooksModifyRequest(t *testing.T, ctx context.Context) {
+	cli, teardown := newHookedServer()
+	defer teardown()
+
+	addr := cli.Addr
+	cli.Addr = "127.0.0.1:0"
+	cli.Hooks = []redis.Hook{{
+		BeforeExec: func(req *redis.Request) error {
+			req.Addr = addr
+			return nil
+		},
+	}}
+
+	args := cli.Query(ctx, "LRANGE", "key", 0, -1)
+
+	var values []string
+	for v := ""; args.Next(&v); {
+		values = append(values, v)
+	}
+	if err := args.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 {
+		t.Error("bad values:", values)
+	}
+}
+
+func testClientHooksAbort(t *testing.T, ctx context.Context) {
+	abort := errors.New("abort")
+	sent := false
+
+	cli := &redis.Client{
+		Addr: "127.0.0.1:0",
+		Transport: roundTripperFunc(func(req *redis.Request) (*redis.Response, error) {
+			sent = true
+			req.Close()
+			return nil, errors.New("failure")
+		}),
+		Hooks: []redis.Hook{
+			{BeforeExec: func(req *redis.Request) error { return abort }},
+			{AfterExec: func(req *redis.Request, info redis.ExecInfo) { t.Error("AfterExec called on an aborted request") }},
+		},
+	}
+
+	if err := cli.Exec(ctx, "SET", "key", "value"); err != abort {
+		t.Fatal("bad error:", err)
+	}
+	if sent {
+		t.Error("the request was sent")
+	}
+}
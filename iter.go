@@ -0,0 +1,62 @@
+//go:build go1.23
+
+package redis
+
+import "iter"
+
+// This file exposes the iterators of the package as range-over-func sequences.
+// The sequences yield the error which ended the iteration as their last
+// element, and close the underlying iterator when the loop completes or is
+// stopped early:
+//
+//	for key, err := range redis.Values[string](client.Query(ctx, "KEYS", "*")) {
+//		if err != nil {
+//			...
+//		}
+//		...
+//	}
+
+// Values returns a sequence of the values of args decoded into T. The error
+// returned when closing args is yielded last, with the zero value of T.
+func Values[T any](args Args) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		if args == nil {
+			yield(zero, ErrNilArgs)
+			return
+		}
+
+		for {
+			var v T
+			if !args.Next(&v) {
+				break
+			}
+			if !yield(v, nil) {
+				args.Close()
+				return
+			}
+		}
+
+		if err := args.Close(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// Values returns a sequence of the elements of the iteration. The error which
+// ended the iteration, if any, is yielded last with an empty string.
+func (s *Scanner) Values() iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for v := ""; s.Next(&v); {
+			if !yield(v, nil) {
+				s.Close()
+				return
+			}
+		}
+
+		if err := s.Close(); err != nil {
+			yield("", err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+//go:build go1.23
+
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestIterators(t *testing.T) {
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		switch cmd {
+		case "CLIENT":
+			return ""
+		case "KEYS":
+			return "*3\r\n$1\r\nA\r\n$1\r\nB\r\n$1\r\nC\r\n"
+		case "SCAN":
+			if args[0] == "0" {
+				return "*2\r\n$2\r\n17\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n"
+			}
+			return "*2\r\n$1\r\n0\r\n*1\r\n$1\r\nc\r\n"
+		default:
+			return "-ERR unknown command\r\n"
+		}
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+	ctx := context.Background()
+
+	tests := []struct {
+		scenario string
+		function func(*testing.T)
+	}{
+		{
+			scenario: "ranging over the values of a query",
+			function: func(t *testing.T) {
+				var keys []string
+
+				for key, err := range redis.Values[string](cli.Query(ctx, "KEYS", "*")) {
+					if err != nil {
+						t.Fatal(err)
+					}
+					keys = append(keys, key)
+				}
+
+				if !reflect.DeepEqual(keys, []string{"A", "B", "C"}) {
+					t.Error("bad keys:", keys)
+				}
+			},
+		},
+		{
+			scenario: "breaking out of the loop closes the query",
+			function: func(t *testing.T) {
+				for range redis.Values[string](cli.Query(ctx, "KEYS", "*")) {
+					break
+				}
+
+				// The connection must have been returned to the pool in a
+				// usable state.
+				n := 0
+				for _, err := range redis.Values[string](cli.Query(ctx, "KEYS", "*")) {
+					if err != nil {
+						t.Fatal(err)
+					}
+					n++
+				}
+
+				if n != 3 {
+					t.Error("bad number of keys:", n)
+				}
+			},
+		},
+		{
+			scenario: "errors are yielded last",
+			function: func(t *testing.T) {
+				var errs []error
+
+				for _, err := range redis.Values[string](cli.Query(ctx, "NOPE")) {
+					errs = append(errs, err)
+				}
+
+				if len(errs) != 1 || errs[0] == nil {
+					t.Error("bad errors:", errs)
+				}
+			},
+		},
+		{
+			scenario: "ranging over the values of a scanner",
+			function: func(t *testing.T) {
+				var keys []string
+
+				for key, err := range cli.Scan(ctx, "", 0).Values() {
+					if err != nil {
+						t.Fatal(err)
+					}
+					keys = append(keys, key)
+				}
+
+				if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+					t.Error("bad keys:", keys)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			testFunc(t)
+		})
+	}
+}
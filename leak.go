@@ -0,0 +1,210 @@
+package redis
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// DefaultLeakTimeout is the time after which a LeakDetector reports responses
+// which were not closed, when its Timeout is zero.
+const DefaultLeakTimeout = 30 * time.Second
+
+// A LeakDetector is a RoundTripper which reports the responses that were not
+// closed within Timeout of being returned by the underlying transport. Args and
+// iterators returned by Query that are never closed pin a connection of the
+// transport, which is eventually starved of connections; the detector records
+// the stack of the goroutine which sent the request so the call site can be
+// found.
+//
+// Capturing stacks has a significant cost, the detector is meant to be enabled
+// in tests and while debugging:
+//
+//	client := &redis.Client{
+//		Transport: &redis.LeakDetector{Transport: transport},
+//	}
+type LeakDetector struct {
+	// Transport is used to send the requests. If nil, DefaultTransport is
+	// used.
+	Transport RoundTripper
+
+	// Timeout is the time after which responses which were not closed are
+	// reported. If zero, DefaultLeakTimeout is used.
+	Timeout time.Duration
+
+	// OnLeak, if not nil, is called with the responses which were not closed
+	// in time, instead of logging them.
+	OnLeak func(Leak)
+
+	// ErrorLog specifies an optional logger for the responses which were not
+	// closed in time. If nil, logging goes to os.Stderr via the log package's
+	// standard logger.
+	ErrorLog *log.Logger
+
+	mutex sync.Mutex
+	open  map[*leakTracker]struct{}
+}
+
+// Leak describes a response which was not closed.
+type Leak struct {
+	// Addr is the address that the request was sent to.
+	Addr string
+
+	// Cmds is the list of the commands of the request.
+	Cmds []string
+
+	// Time is the time at which the response was returned.
+	Time time.Time
+
+	// Stack is the stack of the goroutine which sent the request, formatted
+	// like runtime/debug.Stack.
+	Stack []byte
+}
+
+// String returns a description of the leak, including its stack.
+func (l Leak) String() string {
+	return fmt.Sprintf("redis: the response of %v sent to %s was not closed %s after it was returned, it pins a connection of the transport. The request was sent by:\n%s",
+		l.Cmds, l.Addr, time.Since(l.Time).Round(time.Millisecond), l.Stack)
+}
+
+// RoundTrip satisfies the RoundTripper interface.
+func (d *LeakDetector) RoundTrip(req *Request) (*Response, error) {
+	cmds := make([]string, len(req.Cmds))
+	for i, cmd := range req.Cmds {
+		cmds[i] = cmd.Cmd
+	}
+
+	res, err := d.transport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tracker := &leakTracker{
+		detector: d,
+		leak: Leak{
+			Addr:  req.Addr,
+			Cmds:  cmds,
+			Time:  time.Now(),
+			Stack: debug.Stack(),
+		},
+	}
+
+	d.mutex.Lock()
+	if d.open == nil {
+		d.open = make(map[*leakTracker]struct{})
+	}
+	d.open[tracker] = struct{}{}
+	tracker.timer = time.AfterFunc(d.timeout(), tracker.report)
+	d.mutex.Unlock()
+
+	if res.TxArgs != nil {
+		res.TxArgs = &leakTxArgs{TxArgs: res.TxArgs, tracker: tracker}
+	} else {
+		res.Args = &leakArgs{Args: res.Args, tracker: tracker}
+	}
+
+	return res, nil
+}
+
+// Open returns the responses returned by the detector which are not closed
+// yet, whether they were reported or not. Tests may use it to verify that all
+// responses were closed.
+func (d *LeakDetector) Open() []Leak {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	leaks := make([]Leak, 0, len(d.open))
+	for tracker := range d.open {
+		leaks = append(leaks, tracker.leak)
+	}
+	return leaks
+}
+
+// CloseIdleConnections closes the idle connections of the underlying
+// transport, if it supports it.
+func (d *LeakDetector) CloseIdleConnections() {
+	if c, ok := d.transport().(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+func (d *LeakDetector) transport() RoundTripper {
+	if d.Transport != nil {
+		return d.Transport
+	}
+	return DefaultTransport
+}
+
+func (d *LeakDetector) timeout() time.Duration {
+	if d.Timeout != 0 {
+		return d.Timeout
+	}
+	return DefaultLeakTimeout
+}
+
+// leakTracker tracks a response until it's closed.
+type leakTracker struct {
+	detector *LeakDetector
+	leak     Leak
+	timer    *time.Timer
+	once     sync.Once
+}
+
+func (t *leakTracker) report() {
+	d := t.detector
+
+	d.mutex.Lock()
+	_, open := d.open[t]
+	d.mutex.Unlock()
+
+	if !open {
+		return
+	}
+
+	switch {
+	case d.OnLeak != nil:
+		d.OnLeak(t.leak)
+	case d.ErrorLog != nil:
+		d.ErrorLog.Print(t.leak)
+	default:
+		log.Print(t.leak)
+	}
+}
+
+func (t *leakTracker) close() {
+	t.once.Do(func() {
+		d := t.detector
+		d.mutex.Lock()
+		delete(d.open, t)
+		t.timer.Stop()
+		d.mutex.Unlock()
+	})
+}
+
+type leakArgs struct {
+	Args
+	tracker *leakTracker
+}
+
+func (args *leakArgs) NextType() Type {
+	return NextType(args.Args)
+}
+
+func (args *leakArgs) Close() error {
+	err := args.Args.Close()
+	args.tracker.close()
+	return err
+}
+
+type leakTxArgs struct {
+	TxArgs
+	tracker *leakTracker
+}
+
+func (tx *leakTxArgs) Close() error {
+	err := tx.TxArgs.Close()
+	tx.tracker.close()
+	return err
+}
@@ -0,0 +1,114 @@
+package redis_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestLeakDetector(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context)
+	}{
+		{
+			scenario: "responses which are not closed are reported with the stack of the caller",
+			function: testLeakDetectorReport,
+		},
+		{
+			scenario: "responses closed in time are not reported",
+			function: testLeakDetectorClosed,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			testFunc(t, ctx)
+		})
+	}
+}
+
+func newLeakServer(detector *redis.LeakDetector) (*redis.Client, func()) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("value")
+	}))
+
+	tr := &redis.Transport{}
+	detector.Transport = tr
+
+	return &redis.Client{Addr: url, Transport: detector}, func() {
+		tr.CloseIdleConnections()
+		srv.Close()
+	}
+}
+
+func testLeakDetectorReport(t *testing.T, ctx context.Context) {
+	leaks := make(chan redis.Leak, 1)
+	detector := &redis.LeakDetector{
+		Timeout: 10 * time.Millisecond,
+		OnLeak:  func(leak redis.Leak) { leaks <- leak },
+	}
+
+	cli, teardown := newLeakServer(detector)
+	defer teardown()
+
+	args := cli.Query(ctx, "GET", "key")
+
+	var leak redis.Leak
+	select {
+	case leak = <-leaks:
+	case <-ctx.Done():
+		t.Fatal("the leak was not reported")
+	}
+
+	if leak.Addr != cli.Addr {
+		t.Error("bad address:", leak.Addr)
+	}
+	if len(leak.Cmds) != 1 || leak.Cmds[0] != "GET" {
+		t.Error("bad commands:", leak.Cmds)
+	}
+	if !bytes.Contains(leak.Stack, []byte("testLeakDetectorReport")) {
+		t.Errorf("the stack does not contain the caller:\n%s", leak.Stack)
+	}
+	if open := detector.Open(); len(open) != 1 {
+		t.Error("bad number of open responses:", len(open))
+	}
+
+	if err := redis.ParseArgs(args, nil); err != nil {
+		t.Fatal(err)
+	}
+	if open := detector.Open(); len(open) != 0 {
+		t.Error("bad number of open responses:", len(open))
+	}
+}
+
+func testLeakDetectorClosed(t *testing.T, ctx context.Context) {
+	detector := &redis.LeakDetector{
+		Timeout: 50 * time.Millisecond,
+		OnLeak:  func(leak redis.Leak) { t.Error("unexpected leak:", leak) },
+	}
+
+	cli, teardown := newLeakServer(detector)
+	defer teardown()
+
+	for i := 0; i != 3; i++ {
+		if _, err := redis.String(cli.Query(ctx, "GET", "key")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if open := detector.Open(); len(open) != 0 {
+		t.Error("bad number of open responses:", len(open))
+	}
+
+	time.Sleep(100 * time.Millisecond)
+}
@@ -0,0 +1,183 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+// LimitPolicy represents the behavior of a ConcurrencyLimiter when a request
+// exceeds the limit configured for one of its commands.
+type LimitPolicy int
+
+const (
+	// LimitReject makes the limiter reply with a BUSY error to requests that
+	// exceed the limit.
+	LimitReject LimitPolicy = iota
+
+	// LimitQueue makes the limiter wait for running requests to complete
+	// before serving requests that exceed the limit. Queued requests are
+	// rejected if their context is canceled, or if the queue is full.
+	LimitQueue
+)
+
+// A ConcurrencyLimiter is a Handler which caps the number of requests that a
+// handler executes concurrently for each command name.
+//
+// The limiter is intended to protect servers from overload caused by expensive
+// commands, for example:
+//
+//	handler := &redis.ConcurrencyLimiter{
+//		Handler: h,
+//		Limits:  map[string]int{"SAVE": 1, "SUNION": 2},
+//		Policy:  redis.LimitQueue,
+//	}
+//
+// Requests are admitted only when a slot is available for each of their
+// limited commands, which means transactions count once against the limit of
+// every command they contain.
+type ConcurrencyLimiter struct {
+	// Handler is the handler that admitted requests are passed to.
+	Handler Handler
+
+	// Limits maps command names to the maximum number of requests running the
+	// command concurrently. Commands absent from the map are not limited.
+	Limits map[string]int
+
+	// Policy configures how requests exceeding a limit are handled.
+	Policy LimitPolicy
+
+	// MaxQueue is the maximum number of requests waiting for each command
+	// when Policy is LimitQueue. Zero means no maximum.
+	MaxQueue int
+
+	once  sync.Once
+	mutex sync.Mutex
+	slots map[string]chan struct{}
+	queue map[string]int
+}
+
+// ServeRedis satisfies the Handler interface.
+func (l *ConcurrencyLimiter) ServeRedis(res ResponseWriter, req *Request) {
+	l.once.Do(l.init)
+
+	names := l.limited(req)
+
+	for i, name := range names {
+		if err := l.acquire(req.Context, name); err != nil {
+			l.release(names[:i])
+			writeErrors(res, req, err)
+			return
+		}
+	}
+
+	defer l.release(names)
+	l.Handler.ServeRedis(res, req)
+}
+
+func (l *ConcurrencyLimiter) init() {
+	l.slots = make(map[string]chan struct{}, len(l.Limits))
+	l.queue = make(map[string]int, len(l.Limits))
+
+	for name, limit := range l.Limits {
+		if limit > 0 {
+			l.slots[strings.ToUpper(name)] = make(chan struct{}, limit)
+		}
+	}
+}
+
+// limited returns the sorted list of limited command names in req, sorting
+// guarantees that slots are always acquired in the same order and concurrent
+// requests cannot deadlock.
+func (l *ConcurrencyLimiter) limited(req *Request) []string {
+	var names []string
+
+	for _, cmd := range req.Cmds {
+		name := strings.ToUpper(cmd.Cmd)
+
+		if _, ok := l.slots[name]; ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	// remove duplicates, a request takes a single slot for each command
+	j := 0
+	for i, name := range names {
+		if i == 0 || name != names[j-1] {
+			names[j] = name
+			j++
+		}
+	}
+
+	return names[:j]
+}
+
+func (l *ConcurrencyLimiter) acquire(ctx context.Context, name string) error {
+	slots := l.slots[name]
+
+	select {
+	case slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	busy := resp.NewError(fmt.Sprintf("BUSY too many concurrent %s commands", name))
+
+	if l.Policy != LimitQueue {
+		return busy
+	}
+
+	l.mutex.Lock()
+	full := l.MaxQueue > 0 && l.queue[name] >= l.MaxQueue
+	if !full {
+		l.queue[name]++
+	}
+	l.mutex.Unlock()
+
+	if full {
+		return busy
+	}
+
+	defer func() {
+		l.mutex.Lock()
+		l.queue[name]--
+		l.mutex.Unlock()
+	}()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return busy
+	}
+}
+
+func (l *ConcurrencyLimiter) release(names []string) {
+	for _, name := range names {
+		<-l.slots[name]
+	}
+}
+
+// writeErrors replies to every command of req with err.
+func writeErrors(res ResponseWriter, req *Request, err error) {
+	if len(req.Cmds) <= 1 {
+		res.Write(err)
+		return
+	}
+
+	res.WriteStream(len(req.Cmds))
+
+	for range req.Cmds {
+		res.Write(err)
+	}
+}
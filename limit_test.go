@@ -0,0 +1,133 @@
+package redis_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context)
+	}{
+		{
+			scenario: "requests exceeding the limit are rejected with the reject policy",
+			function: testConcurrencyLimiterReject,
+		},
+		{
+			scenario: "requests exceeding the limit wait for a slot with the queue policy",
+			function: testConcurrencyLimiterQueue,
+		},
+		{
+			scenario: "commands with no limit are not throttled",
+			function: testConcurrencyLimiterUnlimited,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			testFunc(t, ctx)
+		})
+	}
+}
+
+// newLimitedServer starts a server where SLOW commands block until a value is
+// sent on the returned channel, with at most one SLOW command running at a time.
+func newLimitedServer(policy redis.LimitPolicy) (*redis.Client, chan struct{}, chan struct{}, func()) {
+	started := make(chan struct{}, 10)
+	unblock := make(chan struct{}, 10)
+
+	srv, url := newServerTimeout(&redis.ConcurrencyLimiter{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			if req.Cmds[0].Cmd == "SLOW" {
+				started <- struct{}{}
+				<-unblock
+			}
+			res.Write("OK")
+		}),
+		Limits: map[string]int{"SLOW": 1},
+		Policy: policy,
+	}, 2*time.Second)
+
+	tr := &redis.Transport{}
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	return cli, started, unblock, func() {
+		tr.CloseIdleConnections()
+		srv.Close()
+	}
+}
+
+func testConcurrencyLimiterReject(t *testing.T, ctx context.Context) {
+	cli, started, unblock, teardown := newLimitedServer(redis.LimitReject)
+	defer teardown()
+
+	errs := make(chan error, 1)
+	go func() { errs <- cli.Exec(ctx, "SLOW") }()
+	<-started
+
+	if err := cli.Exec(ctx, "SLOW"); err == nil || !strings.HasPrefix(err.Error(), "BUSY") {
+		t.Error("expected a BUSY error but got", err)
+	}
+
+	unblock <- struct{}{}
+
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+}
+
+func testConcurrencyLimiterQueue(t *testing.T, ctx context.Context) {
+	cli, started, unblock, teardown := newLimitedServer(redis.LimitQueue)
+	defer teardown()
+
+	errs := make(chan error, 2)
+	go func() { errs <- cli.Exec(ctx, "SLOW") }()
+	<-started
+	go func() { errs <- cli.Exec(ctx, "SLOW") }()
+
+	select {
+	case <-started:
+		t.Error("a second SLOW command started while the first one was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unblock <- struct{}{}
+	<-started
+	unblock <- struct{}{}
+
+	for i := 0; i != 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func testConcurrencyLimiterUnlimited(t *testing.T, ctx context.Context) {
+	cli, started, unblock, teardown := newLimitedServer(redis.LimitReject)
+	defer teardown()
+
+	errs := make(chan error, 1)
+	go func() { errs <- cli.Exec(ctx, "SLOW") }()
+	<-started
+
+	if err := cli.Exec(ctx, "FAST"); err != nil {
+		t.Error(err)
+	}
+
+	unblock <- struct{}{}
+
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+var (
+	// ErrOOM is the error returned by servers to write commands when their
+	// memory guard reports that the memory threshold is exceeded. The message
+	// is the one used by redis when maxmemory is reached.
+	ErrOOM = resp.NewError("OOM command not allowed when used memory > 'maxmemory'.")
+)
+
+// A MemoryGuard watches the memory used by the program, and reports when it
+// exceeds a threshold. Servers configured with a guard refuse new connections
+// and reply ErrOOM to write commands while the threshold is exceeded, so
+// embedded stores and proxies degrade predictably instead of being killed
+// when running out of memory.
+//
+// MemoryGuard values must not be copied after first use.
+type MemoryGuard struct {
+	// Threshold is the memory usage, in bytes, above which the guard reports
+	// that the program is under memory pressure. Zero disables the guard.
+	Threshold uint64
+
+	// Usage returns the current memory usage of the program, in bytes. If
+	// nil, the guard uses the amount of memory mapped by the Go runtime and
+	// not released to the operating system, which approximates the resident
+	// set size of programs that don't allocate memory outside of Go.
+	Usage func() uint64
+
+	// Interval is the minimum amount of time between two samples of the
+	// memory usage, the last value is reused in between. If zero,
+	// DefaultMemoryGuardInterval is used. Sampling the memory of the Go
+	// runtime briefly stops the world, the interval amortizes this cost.
+	Interval time.Duration
+
+	mutex     sync.Mutex
+	usage     uint64
+	sampledAt time.Time
+}
+
+// DefaultMemoryGuardInterval is the default value of MemoryGuard.Interval.
+const DefaultMemoryGuardInterval = 100 * time.Millisecond
+
+// Exceeded returns true if the memory usage of the program is above the
+// threshold of the guard. The method is safe to call on a nil guard, it
+// returns false in that case.
+func (g *MemoryGuard) Exceeded() bool {
+	if g == nil || g.Threshold == 0 {
+		return false
+	}
+	return g.sample() > g.Threshold
+}
+
+// sample returns the last sampled memory usage of the program, sampling it
+// again if it is older than the guard's interval.
+func (g *MemoryGuard) sample() uint64 {
+	now := time.Now()
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.sampledAt.IsZero() || now.Sub(g.sampledAt) >= g.interval() {
+		if g.Usage != nil {
+			g.usage = g.Usage()
+		} else {
+			g.usage = runtimeMemoryUsage()
+		}
+		g.sampledAt = now
+	}
+
+	return g.usage
+}
+
+func (g *MemoryGuard) interval() time.Duration {
+	if g.Interval > 0 {
+		return g.Interval
+	}
+	return DefaultMemoryGuardInterval
+}
+
+func runtimeMemoryUsage() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys - stats.HeapReleased
+}
+
+// deniedByMemoryGuard returns true if any of the commands of req is a write
+// command. Read and administrative commands are still served under memory
+// pressure, so operators can inspect the server and free memory.
+func deniedByMemoryGuard(req *Request) bool {
+	for _, cmd := range req.Cmds {
+		if ClassOf(cmd.Cmd) == ClassWrite {
+			return true
+		}
+	}
+	return false
+}
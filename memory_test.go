@@ -0,0 +1,92 @@
+package redis_test
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestMemoryGuard(t *testing.T) {
+	var usage uint64
+
+	guard := &redis.MemoryGuard{
+		Threshold: 1000,
+		Usage:     func() uint64 { return atomic.LoadUint64(&usage) },
+		Interval:  time.Nanosecond,
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			res.Write("OK")
+		}),
+		MemoryGuard: guard,
+		ErrorLog:    log.New(os.Stderr, "", 0),
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: l.Addr().String(), Transport: tr}
+	ctx := context.Background()
+
+	if err := cli.Exec(ctx, "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreUint64(&usage, 2000)
+
+	if !guard.Exceeded() {
+		t.Error("the guard should report that the threshold is exceeded")
+	}
+
+	if err := cli.Exec(ctx, "GET", "hello"); err != nil {
+		t.Error("read commands must be served under memory pressure:", err)
+	}
+
+	if err := cli.Exec(ctx, "SET", "hello", "world"); err == nil {
+		t.Error("write commands must fail under memory pressure")
+	} else if e, ok := err.(*resp.Error); !ok || e.Error() != redis.ErrOOM.Error() {
+		t.Error("bad error:", err)
+	}
+
+	other := &redis.Transport{}
+	defer other.CloseIdleConnections()
+
+	if err := (&redis.Client{Addr: cli.Addr, Transport: other}).Exec(ctx, "GET", "hello"); err == nil {
+		t.Error("new connections must be refused under memory pressure")
+	}
+
+	atomic.StoreUint64(&usage, 0)
+
+	if err := cli.Exec(ctx, "SET", "hello", "world"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemoryGuardRuntimeUsage(t *testing.T) {
+	var guard *redis.MemoryGuard
+
+	if guard.Exceeded() {
+		t.Error("a nil guard must never report that a threshold is exceeded")
+	}
+
+	guard = &redis.MemoryGuard{Threshold: 1}
+
+	if !guard.Exceeded() {
+		t.Error("the memory used by the runtime should exceed a threshold of one byte")
+	}
+}
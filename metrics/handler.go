@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"bufio"
+	"net"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+// A Handler is a redis.Handler which records the requests served by its
+// Handler in its Metrics. A request counts as failed if the handler wrote an
+// error in its response.
+//
+// Transactions and pipelines are recorded as a single "multi" or "pipeline"
+// command.
+type Handler struct {
+	// Handler is the handler that requests are passed to.
+	Handler redis.Handler
+
+	// Metrics records the requests served by the handler, it must not be nil.
+	Metrics *Metrics
+}
+
+// ServeRedis satisfies the redis.Handler interface.
+func (h *Handler) ServeRedis(res redis.ResponseWriter, req *redis.Request) {
+	start := time.Now()
+	cmd := redis.SpanName(req)
+	w := &observedResponseWriter{base: res}
+
+	defer func() {
+		h.Metrics.observeServer(cmd, time.Since(start), w.err)
+	}()
+
+	h.Handler.ServeRedis(w, req)
+}
+
+// observedResponseWriter records the first error written to a response.
+type observedResponseWriter struct {
+	base redis.ResponseWriter
+	err  error
+}
+
+func (w *observedResponseWriter) WriteStream(n int) error {
+	return w.base.WriteStream(n)
+}
+
+func (w *observedResponseWriter) Write(v interface{}) error {
+	if err, ok := v.(error); ok && w.err == nil {
+		// Errors are sent to clients as error replies, they are classified
+		// the same way.
+		if _, ok := err.(*resp.Error); !ok {
+			err = resp.NewError(err.Error())
+		}
+		w.err = err
+	}
+	return w.base.Write(v)
+}
+
+func (w *observedResponseWriter) Flush() (err error) {
+	if f, ok := w.base.(redis.Flusher); ok {
+		err = f.Flush()
+	}
+	return
+}
+
+func (w *observedResponseWriter) Hijack() (c net.Conn, rw *bufio.ReadWriter, err error) {
+	if h, ok := w.base.(redis.Hijacker); ok {
+		c, rw, err = h.Hijack()
+	} else {
+		err = redis.ErrNotHijackable
+	}
+	return
+}
@@ -0,0 +1,353 @@
+// Package metrics instruments redis clients and servers, counting commands,
+// errors by class and command latency, and reporting the connections of
+// transports and servers.
+//
+// Metrics are exposed in the Prometheus text format by Metrics.ServeHTTP, and
+// programs built with the prometheus tag can register them against a
+// prometheus.Registerer instead:
+//
+//	m := &metrics.Metrics{}
+//
+//	transport := &redis.Transport{}
+//	m.WatchTransport("default", transport)
+//
+//	client := &redis.Client{
+//		Transport: &metrics.Transport{Transport: transport, Metrics: m},
+//	}
+//
+//	server := &redis.Server{
+//		Handler: &metrics.Handler{Handler: handler, Metrics: m},
+//	}
+//	m.WatchServer("default", server)
+//
+//	http.Handle("/metrics", m)
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+// DefaultBuckets are the default upper bounds of latency histograms, in
+// seconds, from 100µs to 1s.
+var DefaultBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// Metrics collects the metrics of redis clients and servers. The zero value is
+// ready to use.
+//
+// Metrics values must not be copied after first use.
+type Metrics struct {
+	// Buckets are the upper bounds of latency histograms, in seconds. If nil,
+	// DefaultBuckets is used. Buckets must not be changed after first use.
+	Buckets []float64
+
+	mutex      sync.Mutex
+	client     map[string]*commandMetrics
+	server     map[string]*commandMetrics
+	transports map[string]*redis.Transport
+	servers    map[string]*redis.Server
+}
+
+// commandMetrics carries the metrics of a single command.
+type commandMetrics struct {
+	calls   uint64
+	errors  map[string]uint64
+	latency histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative, the last one is +Inf
+	count  uint64
+	sum    float64
+}
+
+// WatchTransport adds the connections of t to the metrics, labeled with name.
+func (m *Metrics) WatchTransport(name string, t *redis.Transport) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.transports == nil {
+		m.transports = make(map[string]*redis.Transport)
+	}
+
+	m.transports[name] = t
+}
+
+// WatchServer adds the connections of s to the metrics, labeled with name.
+func (m *Metrics) WatchServer(name string, s *redis.Server) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.servers == nil {
+		m.servers = make(map[string]*redis.Server)
+	}
+
+	m.servers[name] = s
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteText(w)
+}
+
+// WriteText writes the metrics to w in the Prometheus text format.
+func (m *Metrics) WriteText(w io.Writer) error {
+	b := &strings.Builder{}
+
+	for _, f := range m.gather() {
+		fmt.Fprintf(b, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.kind)
+
+		for _, s := range f.samples {
+			if s.histogram == nil {
+				fmt.Fprintf(b, "%s%s %s\n", f.name, formatLabels(f.labels, s.labels, ""), formatFloat(s.value))
+				continue
+			}
+
+			h := s.histogram
+			var count uint64
+
+			for i, n := range h.counts {
+				count += n
+				le := "+Inf"
+				if i < len(h.buckets) {
+					le = formatFloat(h.buckets[i])
+				}
+				fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, formatLabels(f.labels, s.labels, le), count)
+			}
+
+			fmt.Fprintf(b, "%s_sum%s %s\n", f.name, formatLabels(f.labels, s.labels, ""), formatFloat(h.sum))
+			fmt.Fprintf(b, "%s_count%s %d\n", f.name, formatLabels(f.labels, s.labels, ""), h.count)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// observeClient records a request sent by a client.
+func (m *Metrics) observeClient(cmd string, elapsed time.Duration, err error) {
+	m.observe(&m.client, cmd, elapsed, err)
+}
+
+// observeServer records a request served by a server.
+func (m *Metrics) observeServer(cmd string, elapsed time.Duration, err error) {
+	m.observe(&m.server, cmd, elapsed, err)
+}
+
+func (m *Metrics) observe(commands *map[string]*commandMetrics, cmd string, elapsed time.Duration, err error) {
+	cmd = strings.ToLower(cmd)
+	buckets := m.buckets()
+	seconds := elapsed.Seconds()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if *commands == nil {
+		*commands = make(map[string]*commandMetrics)
+	}
+
+	c := (*commands)[cmd]
+	if c == nil {
+		c = &commandMetrics{latency: histogram{counts: make([]uint64, len(buckets)+1)}}
+		(*commands)[cmd] = c
+	}
+
+	c.calls++
+
+	if err != nil {
+		if c.errors == nil {
+			c.errors = make(map[string]uint64)
+		}
+		c.errors[redis.ErrorClass(err).String()]++
+	}
+
+	c.latency.counts[sort.SearchFloat64s(buckets, seconds)]++
+	c.latency.count++
+	c.latency.sum += seconds
+}
+
+func (m *Metrics) buckets() []float64 {
+	if m.Buckets != nil {
+		return m.Buckets
+	}
+	return DefaultBuckets
+}
+
+// family is a snapshot of a metric and its samples, in a form which can be
+// written in the text format or converted to Prometheus metrics.
+type family struct {
+	name    string
+	help    string
+	kind    string // counter, gauge or histogram
+	labels  []string
+	samples []sample
+}
+
+type sample struct {
+	labels    []string
+	value     float64
+	histogram *histogramSample
+}
+
+type histogramSample struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// gather returns a snapshot of the metrics, with samples sorted by label values.
+func (m *Metrics) gather() []family {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var families []family
+
+	families = append(families, m.gatherCommands("client", "sent by clients", m.client)...)
+	families = append(families, m.gatherCommands("server", "served by servers", m.server)...)
+
+	if len(m.transports) != 0 {
+		names := make([]string, 0, len(m.transports))
+		for name := range m.transports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		stats := make([]redis.TransportStats, len(names))
+		for i, name := range names {
+			stats[i] = m.transports[name].Stats()
+		}
+
+		transportGauge := func(name, help string, value func(redis.TransportStats) float64) {
+			f := family{name: name, help: help, kind: "gauge", labels: []string{"transport"}}
+			for i, name := range names {
+				f.samples = append(f.samples, sample{labels: []string{name}, value: value(stats[i])})
+			}
+			families = append(families, f)
+		}
+
+		transportCounter := func(name, help string, value func(redis.TransportStats) float64) {
+			transportGauge(name, help, value)
+			families[len(families)-1].kind = "counter"
+		}
+
+		transportGauge("redis_client_connections", "Number of open connections of transports.",
+			func(s redis.TransportStats) float64 { return float64(s.Conns) })
+		transportGauge("redis_client_idle_connections", "Number of idle connections of transports.",
+			func(s redis.TransportStats) float64 { return float64(s.IdleConns) })
+		transportGauge("redis_client_active_connections", "Number of connections of transports used by in-flight requests.",
+			func(s redis.TransportStats) float64 { return float64(s.ActiveConns) })
+		transportGauge("redis_client_pipelined_connections", "Number of connections of transports shared by pipelined requests.",
+			func(s redis.TransportStats) float64 { return float64(s.PipelinedConns) })
+		transportCounter("redis_client_dials_total", "Number of connections that transports attempted to establish.",
+			func(s redis.TransportStats) float64 { return float64(s.Dials) })
+		transportCounter("redis_client_dial_errors_total", "Number of connections that transports failed to establish.",
+			func(s redis.TransportStats) float64 { return float64(s.DialErrors) })
+		transportCounter("redis_client_waits_total", "Number of pipelined requests which waited for the requests sent before them.",
+			func(s redis.TransportStats) float64 { return float64(s.Waits) })
+		transportCounter("redis_client_wait_seconds_total", "Time spent by pipelined requests waiting for the requests sent before them.",
+			func(s redis.TransportStats) float64 { return s.WaitTime.Seconds() })
+	}
+
+	if len(m.servers) != 0 {
+		names := make([]string, 0, len(m.servers))
+		for name := range m.servers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		conns := family{name: "redis_server_connections", help: "Number of open client connections of servers.", kind: "gauge", labels: []string{"server"}}
+		accepted := family{name: "redis_server_connections_accepted_total", help: "Number of client connections accepted by servers.", kind: "counter", labels: []string{"server"}}
+
+		for _, name := range names {
+			stats := m.servers[name].Stats()
+			conns.samples = append(conns.samples, sample{labels: []string{name}, value: float64(stats.Conns)})
+			accepted.samples = append(accepted.samples, sample{labels: []string{name}, value: float64(stats.Accepted)})
+		}
+
+		families = append(families, conns, accepted)
+	}
+
+	return families
+}
+
+func (m *Metrics) gatherCommands(side, verb string, commands map[string]*commandMetrics) []family {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	prefix := "redis_" + side + "_"
+
+	calls := family{name: prefix + "commands_total", help: "Number of commands " + verb + ".", kind: "counter", labels: []string{"command"}}
+	errors := family{name: prefix + "errors_total", help: "Number of commands " + verb + " which failed, by class of error.", kind: "counter", labels: []string{"command", "class"}}
+	latency := family{name: prefix + "command_duration_seconds", help: "Latency of commands " + verb + ".", kind: "histogram", labels: []string{"command"}}
+
+	names := make([]string, 0, len(commands))
+	for cmd := range commands {
+		names = append(names, cmd)
+	}
+	sort.Strings(names)
+
+	for _, cmd := range names {
+		c := commands[cmd]
+		calls.samples = append(calls.samples, sample{labels: []string{cmd}, value: float64(c.calls)})
+
+		classes := make([]string, 0, len(c.errors))
+		for class := range c.errors {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+
+		for _, class := range classes {
+			errors.samples = append(errors.samples, sample{labels: []string{cmd, class}, value: float64(c.errors[class])})
+		}
+
+		latency.samples = append(latency.samples, sample{
+			labels: []string{cmd},
+			histogram: &histogramSample{
+				buckets: m.buckets(),
+				counts:  append([]uint64(nil), c.latency.counts...),
+				count:   c.latency.count,
+				sum:     c.latency.sum,
+			},
+		})
+	}
+
+	return []family{calls, errors, latency}
+}
+
+func formatLabels(names []string, values []string, le string) string {
+	b := &strings.Builder{}
+	b.WriteByte('{')
+
+	for i, name := range names {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, "%s=%s", name, strconv.Quote(values[i]))
+	}
+
+	if len(le) != 0 {
+		if len(names) != 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, "le=%q", le)
+	}
+
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,92 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+	"github.com/segmentio/redis-go/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &metrics.Metrics{Buckets: []float64{0.5, 1}}
+
+	srv := &redis.Server{
+		Handler: &metrics.Handler{
+			Metrics: m,
+			Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+				if req.Cmds[0].Cmd == "GET" {
+					res.Write("value")
+				} else {
+					res.Write(errors.New("ERR unsupported"))
+				}
+			}),
+		},
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	transport := &redis.Transport{}
+	defer transport.CloseIdleConnections()
+
+	m.WatchTransport("default", transport)
+	m.WatchServer("default", srv)
+
+	client := &redis.Client{
+		Addr:      l.Addr().String(),
+		Transport: &metrics.Transport{Transport: transport, Metrics: m},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	for i := 0; i != 2; i++ {
+		if err := redis.ParseArgs(client.Query(ctx, "GET", "key"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := client.Exec(ctx, "SET", "key", "value"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	b := &bytes.Buffer{}
+	if err := m.WriteText(b); err != nil {
+		t.Fatal(err)
+	}
+	text := b.String()
+
+	for _, line := range []string{
+		`# TYPE redis_client_commands_total counter`,
+		`redis_client_commands_total{command="get"} 2`,
+		`redis_client_commands_total{command="set"} 1`,
+		`redis_client_errors_total{command="set",class="server"} 1`,
+		`# TYPE redis_client_command_duration_seconds histogram`,
+		`redis_client_command_duration_seconds_bucket{command="get",le="0.5"} 2`,
+		`redis_client_command_duration_seconds_bucket{command="get",le="+Inf"} 2`,
+		`redis_client_command_duration_seconds_count{command="get"} 2`,
+		`redis_server_commands_total{command="get"} 2`,
+		`redis_server_errors_total{command="set",class="server"} 1`,
+		`redis_client_connections{transport="default"} 1`,
+		`redis_client_idle_connections{transport="default"} 1`,
+		`redis_client_dials_total{transport="default"} 1`,
+		`redis_server_connections{server="default"} 1`,
+		`redis_server_connections_accepted_total{server="default"} 1`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("missing %q in the metrics:\n%s", line, text)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+//go:build prometheus
+
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Register registers the metrics against r, programs can then expose them with
+// the handlers of the prometheus packages instead of ServeHTTP.
+//
+// The method is only available to programs built with the prometheus tag, so
+// the package doesn't depend on the Prometheus client otherwise.
+func (m *Metrics) Register(r prometheus.Registerer) error {
+	return r.Register(m)
+}
+
+// Describe satisfies the prometheus.Collector interface. The series of the
+// metrics depend on the commands observed, the metrics are reported as an
+// unchecked collector so no descriptions are sent.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect satisfies the prometheus.Collector interface.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, f := range m.gather() {
+		desc := prometheus.NewDesc(f.name, f.help, f.labels, nil)
+
+		for _, s := range f.samples {
+			switch {
+			case s.histogram != nil:
+				h := s.histogram
+				buckets := make(map[float64]uint64, len(h.buckets))
+				var count uint64
+
+				for i, bound := range h.buckets {
+					count += h.counts[i]
+					buckets[bound] = count
+				}
+
+				ch <- prometheus.MustNewConstHistogram(desc, h.count, h.sum, buckets, s.labels...)
+
+			case f.kind == "counter":
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, s.value, s.labels...)
+
+			default:
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, s.value, s.labels...)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+// A Transport is a redis.RoundTripper which records the requests it sends in
+// its Metrics. The latency of a request is measured until its response is
+// closed, and the request counts as failed if it returned an error or if its
+// response contained one.
+//
+// Transactions and pipelines are recorded as a single "multi" or "pipeline"
+// command.
+type Transport struct {
+	// Transport is used to send the requests. If nil, redis.DefaultTransport
+	// is used.
+	Transport redis.RoundTripper
+
+	// Metrics records the requests sent by the transport, it must not be nil.
+	Metrics *Metrics
+}
+
+// RoundTrip satisfies the redis.RoundTripper interface.
+func (t *Transport) RoundTrip(req *redis.Request) (*redis.Response, error) {
+	start := time.Now()
+	cmd := redis.SpanName(req)
+
+	res, err := t.transport().RoundTrip(req)
+	if err != nil {
+		t.Metrics.observeClient(cmd, time.Since(start), err)
+		return nil, err
+	}
+
+	o := &observation{metrics: t.Metrics, cmd: cmd, start: start}
+
+	if res.TxArgs != nil {
+		res.TxArgs = &observedTxArgs{TxArgs: res.TxArgs, o: o}
+		if res.Args != nil {
+			res.Args = &observedArgs{Args: res.Args, o: o, part: true}
+		}
+	} else {
+		res.Args = &observedArgs{Args: res.Args, o: o}
+	}
+
+	return res, nil
+}
+
+// CloseIdleConnections closes the idle connections of the underlying
+// transport, if it supports it.
+func (t *Transport) CloseIdleConnections() {
+	if c, ok := t.transport().(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+func (t *Transport) transport() redis.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return redis.DefaultTransport
+}
+
+// observation records a request when its response is closed.
+type observation struct {
+	metrics *Metrics
+	cmd     string
+	start   time.Time
+	once    sync.Once
+	mutex   sync.Mutex
+	err     error
+}
+
+func (o *observation) fail(err error) {
+	if err != nil {
+		o.mutex.Lock()
+		if o.err == nil {
+			o.err = err
+		}
+		o.mutex.Unlock()
+	}
+}
+
+func (o *observation) done(err error) {
+	o.fail(err)
+	o.once.Do(func() {
+		o.mutex.Lock()
+		err := o.err
+		o.mutex.Unlock()
+		o.metrics.observeClient(o.cmd, time.Since(o.start), err)
+	})
+}
+
+type observedArgs struct {
+	redis.Args
+	o    *observation
+	part bool // the argument list is part of a transaction or pipeline
+}
+
+func (args *observedArgs) NextType() redis.Type {
+	return redis.NextType(args.Args)
+}
+
+func (args *observedArgs) Close() error {
+	err := args.Args.Close()
+	if args.part {
+		args.o.fail(err)
+	} else {
+		args.o.done(err)
+	}
+	return err
+}
+
+type observedTxArgs struct {
+	redis.TxArgs
+	o *observation
+}
+
+func (tx *observedTxArgs) Next() redis.Args {
+	args := tx.TxArgs.Next()
+	if args == nil {
+		return nil
+	}
+	return &observedArgs{Args: args, o: tx.o, part: true}
+}
+
+func (tx *observedTxArgs) Close() error {
+	err := tx.TxArgs.Close()
+	tx.o.done(err)
+	return err
+}
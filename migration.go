@@ -0,0 +1,370 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+// Migration configures a ProxyRoute to migrate its keys online from the pool of
+// the route, the old pool, to a new pool of upstream servers:
+//
+//	writes are sent to both pools, the reply of the old pool is returned
+//	reads of a single key are sent to the new pool, and to the old pool when
+//	the key is missing from the new pool, in which case the key is copied to
+//	the new pool with DUMP and RESTORE after the reply was written to the
+//	client
+//	reads of multiple keys are sent to the old pool, since their replies
+//	don't tell which keys are missing from the new pool
+//
+// The old pool remains the source of truth until the migration is complete,
+// after which the route can be switched to the new pool.
+//
+// Transactions and requests with multiple commands are handled like writes.
+type Migration struct {
+	// Registry exposes the upstream servers of the new pool.
+	Registry ServerRegistry
+
+	// RequireNew, when true, fails the writes which couldn't be sent to the
+	// new pool, instead of only counting them in NewWriteErrors.
+	RequireNew bool
+
+	fallbacks      int64
+	backfills      int64
+	backfillErrors int64
+	divergences    int64
+	newWriteErrors int64
+}
+
+// MigrationStats carries metrics about a migration between pools of upstream
+// servers, which expose how far the new pool diverges from the old one.
+type MigrationStats struct {
+	// Fallbacks is the number of reads served by the old pool because the
+	// key was missing from the new pool.
+	Fallbacks int64
+
+	// Backfills and BackfillErrors are the numbers of keys that were copied,
+	// or failed to be copied, to the new pool after a fallback.
+	Backfills      int64
+	BackfillErrors int64
+
+	// Divergences is the number of writes for which the pools returned
+	// different replies, like an INCR of a counter which had different values
+	// in the two pools.
+	Divergences int64
+
+	// NewWriteErrors is the number of writes which couldn't be sent to the
+	// new pool.
+	NewWriteErrors int64
+}
+
+// Stats returns the metrics of the migration.
+func (m *Migration) Stats() MigrationStats {
+	return MigrationStats{
+		Fallbacks:      atomic.LoadInt64(&m.fallbacks),
+		Backfills:      atomic.LoadInt64(&m.backfills),
+		BackfillErrors: atomic.LoadInt64(&m.backfillErrors),
+		Divergences:    atomic.LoadInt64(&m.divergences),
+		NewWriteErrors: atomic.LoadInt64(&m.newWriteErrors),
+	}
+}
+
+// serveMigration serves req, a request with keys on a route with a migration,
+// old is the registry of the pool of the route.
+func (proxy *ReverseProxy) serveMigration(w ResponseWriter, req *Request, keys []string, old ServerRegistry, m *Migration) {
+	ctx, cancel := WithDeadlineBudget(req.Context, proxy.DeadlineMargin)
+	defer cancel()
+
+	// The commands of req are never sent, each upstream server gets its own
+	// copy since the server closes the arguments of req when the handler
+	// returns, while the transport may still be closing the ones it sent.
+	cmds := loadCommands(req.Cmds)
+	read := len(req.Cmds) == 1 && classOfRequest(req) == ClassRead
+
+	if read && hasSingleKey(cmds[0]) {
+		cmd := req.Cmds[0].Cmd
+
+		reply, err := proxy.exchange(ctx, req, m.Registry, keys, copyByteArgs(cmds))
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+
+		if !reply.missing(cmd) {
+			writeReply(w, reply)
+			return
+		}
+
+		fallback, err := proxy.exchange(ctx, req, old, keys, copyByteArgs(cmds))
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+
+		writeReply(w, fallback)
+
+		if !fallback.missing(cmd) {
+			atomic.AddInt64(&m.fallbacks, 1)
+			go proxy.backfill(req, old, m, keys[0])
+		}
+		return
+	}
+
+	reply, err := proxy.exchange(ctx, req, old, keys, copyByteArgs(cmds))
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	if read {
+		writeReply(w, reply)
+		return
+	}
+
+	mirror, err := proxy.exchange(ctx, req, m.Registry, keys, copyByteArgs(cmds))
+
+	switch {
+	case err != nil:
+		atomic.AddInt64(&m.newWriteErrors, 1)
+		if m.RequireNew {
+			writeUpstreamError(w, err)
+			return
+		}
+	case !reflect.DeepEqual(reply, mirror):
+		atomic.AddInt64(&m.divergences, 1)
+	}
+
+	writeReply(w, reply)
+}
+
+// hasSingleKey returns true if cmd, a command with its arguments loaded in
+// memory, has exactly one key.
+func hasSingleKey(cmd Command) bool {
+	var args [][]byte
+	if a, ok := cmd.Args.(*byteArgs); ok {
+		args = a.args
+	}
+	keys, ok := commandKeys(cmd.Cmd, args)
+	return ok && len(keys) == 1
+}
+
+// backfill copies key from the old pool to the new pool of m. The key is not
+// replaced if it was written to the new pool in the meantime.
+//
+// The method runs in its own goroutine after the reply was written to the
+// client, so it doesn't add to the latency of the request, and has its own
+// timeout since the context of req is canceled when the handler returns.
+func (proxy *ReverseProxy) backfill(req *Request, old ServerRegistry, m *Migration, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), backfillTimeout)
+	defer cancel()
+
+	dump, err := proxy.exchange(ctx, req, old, []string{key}, []Command{
+		{Cmd: "DUMP", Args: List(key)},
+		{Cmd: "PTTL", Args: List(key)},
+	})
+
+	if err == nil {
+		var payload []byte
+		var ttl int64
+
+		if len(dump.values) == 2 && len(dump.values[0]) == 1 && len(dump.values[1]) == 1 {
+			payload, _ = dump.values[0][0].([]byte)
+			ttl, _ = dump.values[1][0].(int64)
+		}
+
+		if payload == nil {
+			// The key was deleted in the meantime, there is nothing to copy.
+			return
+		}
+
+		if ttl < 0 {
+			ttl = 0
+		}
+
+		var restore *proxyReply
+		restore, err = proxy.exchange(ctx, req, m.Registry, []string{key}, []Command{
+			{Cmd: "RESTORE", Args: List(key, ttl, payload)},
+		})
+
+		// BUSYKEY is returned when the key was written to the new pool after
+		// the fallback, the new pool already has the latest value then.
+		if err == nil && len(restore.values[0]) != 0 {
+			if e, ok := restore.values[0][0].(*resp.Error); ok && e.Type() != "BUSYKEY" {
+				err = e
+			}
+		}
+	}
+
+	if err != nil {
+		atomic.AddInt64(&m.backfillErrors, 1)
+		proxy.logRequest(req, err)
+		return
+	}
+
+	atomic.AddInt64(&m.backfills, 1)
+}
+
+// backfillTimeout is the maximum amount of time spent copying a key to the
+// new pool of a migration.
+const backfillTimeout = 5 * time.Second
+
+// exchange sends cmds to the server of the pool exposed by r that keys hash to,
+// and returns the reply loaded in memory.
+func (proxy *ReverseProxy) exchange(ctx context.Context, req *Request, r ServerRegistry, keys []string, cmds []Command) (*proxyReply, error) {
+	upstream, err := proxy.lookupUpstream(ctx, r, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := proxy.roundTrip(&Request{
+		Addr:    upstream,
+		Cmds:    cmds,
+		Context: ctx,
+	})
+	if err != nil {
+		if _, ok := err.(*resp.Error); !ok {
+			proxy.blacklistServer(r, upstream)
+			proxy.logRequest(req, err)
+		}
+		return nil, err
+	}
+
+	return loadReply(res)
+}
+
+// proxyReply is the reply of an upstream server loaded in memory, with a list
+// of values per command for transactions and pipelines.
+type proxyReply struct {
+	values [][]interface{}
+	tx     bool
+}
+
+func loadReply(res *Response) (*proxyReply, error) {
+	if res.Args != nil {
+		values, err := loadValues(res.Args)
+		if err != nil {
+			return nil, err
+		}
+		return &proxyReply{values: [][]interface{}{values}}, nil
+	}
+
+	reply := &proxyReply{tx: true}
+
+	for a := res.TxArgs.Next(); a != nil; a = res.TxArgs.Next() {
+		values, err := loadValues(a)
+		if err != nil {
+			res.TxArgs.Close()
+			return nil, err
+		}
+		reply.values = append(reply.values, values)
+	}
+
+	if err := res.TxArgs.Close(); err != nil {
+		if _, ok := err.(*resp.Error); !ok {
+			return nil, err
+		}
+	}
+
+	return reply, nil
+}
+
+// loadValues reads the values of args, errors returned by the server are
+// loaded as values.
+func loadValues(args Args) ([]interface{}, error) {
+	var values []interface{}
+	var v interface{}
+
+	for args.Next(&v) {
+		values = append(values, v)
+		v = nil
+	}
+
+	switch err := args.Close().(type) {
+	case nil:
+	case *resp.Error:
+		values = append(values, translateError(err))
+	default:
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// missing returns true if the reply is the reply of the read command cmd to a
+// key that doesn't exist, which is either nil or empty, or the value listed in
+// missingReplies for the commands which reply with a value.
+func (reply *proxyReply) missing(cmd string) bool {
+	if reply.tx || len(reply.values) != 1 {
+		return false
+	}
+	values := reply.values[0]
+	if len(values) == 0 || (len(values) == 1 && values[0] == nil) {
+		return true
+	}
+	v, ok := missingReplies[strings.ToUpper(cmd)]
+	return ok && len(values) == 1 && values[0] == v
+}
+
+// missingReplies are the replies of read commands to keys that don't exist,
+// for the commands which don't reply with nil or an empty list. The lengths
+// of empty keys are included since redis deletes the keys which become empty.
+var missingReplies = map[string]interface{}{
+	"EXISTS":      int64(0),
+	"TTL":         int64(-2),
+	"PTTL":        int64(-2),
+	"EXPIRETIME":  int64(-2),
+	"PEXPIRETIME": int64(-2),
+	"STRLEN":      int64(0),
+	"HLEN":        int64(0),
+	"LLEN":        int64(0),
+	"SCARD":       int64(0),
+	"ZCARD":       int64(0),
+}
+
+func (reply *proxyReply) write(w ResponseWriter) error {
+	if reply.tx {
+		w.WriteStream(len(reply.values))
+
+		for _, values := range reply.values {
+			w.Write(values)
+		}
+	} else {
+		values := reply.values[0]
+		w.WriteStream(len(values))
+
+		for _, v := range values {
+			w.Write(v)
+		}
+	}
+
+	if f, ok := w.(Flusher); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+func writeReply(w ResponseWriter, reply *proxyReply) {
+	if err := reply.write(w); err != nil {
+		// Get caught by the server, like in serveRequest.
+		panic(err)
+	}
+}
+
+func writeUpstreamError(w ResponseWriter, err error) {
+	switch e := err.(type) {
+	case *resp.Error:
+		w.Write(translateError(e))
+	case nil:
+	default:
+		if err == errKeysOnDifferentUpstreams {
+			w.Write(errorf("EXECABORT The transaction contains keys that hash to different upstream servers."))
+		} else {
+			w.Write(errorf("ERR Connecting to the upstream server failed."))
+		}
+	}
+}
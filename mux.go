@@ -0,0 +1,194 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+// ServeMux is a Redis request multiplexer. It matches the command of each
+// incoming request against a list of registered patterns and calls the
+// handler for the pattern that matches.
+//
+// Patterns are either a command name, like "GET", or a command name followed
+// by a subcommand, like "CONFIG GET". Container commands like CONFIG, CLIENT,
+// CLUSTER or XINFO may register a separate handler for each subcommand; the
+// subcommand is consumed by the multiplexer so those handlers receive only
+// the arguments that follow it. A handler registered for the container
+// command itself receives the requests for subcommands that have no handler
+// of their own, with the subcommand as first argument.
+//
+// Command and subcommand names are case insensitive.
+//
+// Requests carrying multiple commands, like transactions, are routed to the
+// handler of their first command, and every command is checked against the
+// arity of its pattern.
+type ServeMux struct {
+	mutex  sync.RWMutex
+	routes map[string]*muxEntry
+}
+
+type muxEntry struct {
+	name    string
+	handler Handler
+	arity   int
+	subs    map[string]*muxEntry
+}
+
+// NewServeMux allocates and returns a new ServeMux.
+func NewServeMux() *ServeMux {
+	return &ServeMux{}
+}
+
+// Handle registers the handler for the given pattern. If a handler already
+// exists for pattern, Handle panics.
+func (mux *ServeMux) Handle(pattern string, handler Handler) {
+	mux.HandleArity(pattern, 0, handler)
+}
+
+// HandleFunc registers the handler function for the given pattern.
+func (mux *ServeMux) HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
+	mux.Handle(pattern, HandlerFunc(handler))
+}
+
+// HandleArity registers the handler for the given pattern, requests which
+// don't match arity are rejected with an error and never reach the handler.
+//
+// The arity follows the conventions of the redis COMMAND command: it counts
+// the command name and subcommand name, a positive arity is the exact number
+// of arguments expected, and a negative arity is the minimum number of
+// arguments. For example, "CONFIG GET" has an arity of -3. Zero means any
+// number of arguments is accepted.
+func (mux *ServeMux) HandleArity(pattern string, arity int, handler Handler) {
+	if handler == nil {
+		panic("redis: nil handler")
+	}
+
+	names := strings.Fields(strings.ToUpper(pattern))
+
+	if len(names) == 0 || len(names) > 2 {
+		panic("redis: invalid pattern " + pattern)
+	}
+
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	if mux.routes == nil {
+		mux.routes = make(map[string]*muxEntry)
+	}
+
+	entry := mux.routes[names[0]]
+
+	if entry == nil {
+		entry = &muxEntry{name: strings.ToLower(names[0])}
+		mux.routes[names[0]] = entry
+	}
+
+	if len(names) == 2 {
+		if entry.subs == nil {
+			entry.subs = make(map[string]*muxEntry)
+		}
+		if entry.subs[names[1]] != nil {
+			panic("redis: multiple registrations for " + pattern)
+		}
+		entry.subs[names[1]] = &muxEntry{
+			name:    entry.name + "|" + strings.ToLower(names[1]),
+			handler: handler,
+			arity:   arity,
+		}
+		return
+	}
+
+	if entry.handler != nil {
+		panic("redis: multiple registrations for " + pattern)
+	}
+
+	entry.handler = handler
+	entry.arity = arity
+}
+
+// ServeRedis dispatches the request to the handler whose pattern matches the
+// request's commands, or responds with an error if none does.
+func (mux *ServeMux) ServeRedis(res ResponseWriter, req *Request) {
+	if len(req.Cmds) == 0 {
+		res.Write(resp.NewError("ERR empty request"))
+		return
+	}
+
+	cmds := make([]Command, len(req.Cmds))
+	copy(cmds, req.Cmds)
+
+	var handler Handler
+
+	for i := range cmds {
+		h, err := mux.route(&cmds[i])
+		if err != nil {
+			res.Write(err)
+			return
+		}
+		if i == 0 {
+			handler = h
+		}
+	}
+
+	r := *req
+	r.Cmds = cmds
+	handler.ServeRedis(res, &r)
+}
+
+// route returns the handler for cmd, consuming the subcommand from its
+// argument list when it was matched by a subcommand pattern.
+func (mux *ServeMux) route(cmd *Command) (Handler, error) {
+	mux.mutex.RLock()
+	entry := mux.routes[strings.ToUpper(cmd.Cmd)]
+	mux.mutex.RUnlock()
+
+	if entry == nil {
+		return nil, resp.NewError(fmt.Sprintf("ERR unknown command '%s'", cmd.Cmd))
+	}
+
+	if entry.subs != nil {
+		var sub string
+
+		if cmd.Args == nil || !cmd.Args.Next(&sub) {
+			if entry.handler == nil {
+				return nil, errWrongNumberOfArgs(entry.name)
+			}
+			return entry.handler, entry.checkArity(cmd.Args, 1)
+		}
+
+		if subEntry := entry.subs[strings.ToUpper(sub)]; subEntry != nil {
+			return subEntry.handler, subEntry.checkArity(cmd.Args, 2)
+		}
+
+		cmd.Args = MultiArgs(List(sub), cmd.Args)
+
+		if entry.handler == nil {
+			return nil, resp.NewError(fmt.Sprintf("ERR unknown subcommand '%s'. Try %s HELP.", sub, strings.ToUpper(entry.name)))
+		}
+	}
+
+	return entry.handler, entry.checkArity(cmd.Args, 1)
+}
+
+// checkArity verifies that args has the number of values expected by the
+// entry, n is the number of names already read from the command.
+func (entry *muxEntry) checkArity(args Args, n int) error {
+	if args != nil {
+		n += args.Len()
+	}
+
+	switch {
+	case entry.arity > 0 && n != entry.arity,
+		entry.arity < 0 && n < -entry.arity:
+		return errWrongNumberOfArgs(entry.name)
+	}
+
+	return nil
+}
+
+func errWrongNumberOfArgs(name string) error {
+	return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+}
@@ -0,0 +1,143 @@
+package redis_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestServeMux(t *testing.T) {
+	mux := redis.NewServeMux()
+
+	// Each handler responds with its name and the arguments it received.
+	handler := func(name string) redis.Handler {
+		return redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			var args []string
+			var arg string
+
+			for req.Cmds[0].Args.Next(&arg) {
+				args = append(args, arg)
+			}
+
+			res.Write(strings.Join(append([]string{name}, args...), " "))
+		})
+	}
+
+	mux.Handle("GET", handler("get"))
+	mux.HandleArity("CONFIG GET", -3, handler("config-get"))
+	mux.HandleArity("config set", 4, handler("config-set"))
+	mux.Handle("CLIENT", handler("client"))
+	mux.Handle("CLIENT LIST", handler("client-list"))
+	mux.Handle("XINFO STREAM", handler("xinfo-stream"))
+
+	tests := []struct {
+		cmd  string
+		args []interface{}
+		res  interface{}
+	}{
+		{
+			cmd:  "GET",
+			args: []interface{}{"key"},
+			res:  "get key",
+		},
+		{
+			cmd:  "config",
+			args: []interface{}{"get", "maxmemory", "timeout"},
+			res:  "config-get maxmemory timeout",
+		},
+		{
+			cmd:  "CONFIG",
+			args: []interface{}{"SET", "timeout", "10"},
+			res:  "config-set timeout 10",
+		},
+		{
+			cmd:  "CONFIG",
+			args: []interface{}{"GET"},
+			res:  resp.NewError("ERR wrong number of arguments for 'config|get' command"),
+		},
+		{
+			cmd:  "CONFIG",
+			args: []interface{}{"SET", "timeout"},
+			res:  resp.NewError("ERR wrong number of arguments for 'config|set' command"),
+		},
+		{
+			cmd:  "CONFIG",
+			args: []interface{}{"REWRITE"},
+			res:  resp.NewError("ERR unknown subcommand 'REWRITE'. Try CONFIG HELP."),
+		},
+		{
+			cmd: "CONFIG",
+			res: resp.NewError("ERR wrong number of arguments for 'config' command"),
+		},
+		{
+			cmd:  "CLIENT",
+			args: []interface{}{"LIST"},
+			res:  "client-list",
+		},
+		{
+			cmd:  "CLIENT",
+			args: []interface{}{"SETNAME", "A"},
+			res:  "client SETNAME A",
+		},
+		{
+			cmd:  "XINFO",
+			args: []interface{}{"STREAM", "key"},
+			res:  "xinfo-stream key",
+		},
+		{
+			cmd:  "SET",
+			args: []interface{}{"key", "value"},
+			res:  resp.NewError("ERR unknown command 'SET'"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(append([]string{test.cmd}, toStrings(test.args)...), " "), func(t *testing.T) {
+			res := &testResponseWriter{}
+			mux.ServeRedis(res, redis.NewRequest("", test.cmd, redis.List(test.args...)))
+
+			if len(res.values) != 1 {
+				t.Fatalf("expected one response but got %d", len(res.values))
+			}
+
+			if !reflect.DeepEqual(res.values[0], test.res) {
+				t.Errorf("bad response:\nexpected: %#v\nfound:    %#v", test.res, res.values[0])
+			}
+		})
+	}
+}
+
+func TestServeMuxMultipleRegistrations(t *testing.T) {
+	mux := redis.NewServeMux()
+	mux.Handle("CONFIG GET", redis.HandlerFunc(func(redis.ResponseWriter, *redis.Request) {}))
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering the same pattern twice must panic")
+		}
+	}()
+
+	mux.Handle("config get", redis.HandlerFunc(func(redis.ResponseWriter, *redis.Request) {}))
+}
+
+type testResponseWriter struct {
+	values []interface{}
+}
+
+func (res *testResponseWriter) WriteStream(n int) error { return nil }
+
+func (res *testResponseWriter) Write(v interface{}) error {
+	res.values = append(res.values, v)
+	return nil
+}
+
+func toStrings(values []interface{}) []string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = v.(string)
+	}
+	return s
+}
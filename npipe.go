@@ -0,0 +1,30 @@
+package redis
+
+import (
+	"net"
+	"strings"
+)
+
+// pipeNetwork is the network of Windows named pipe addresses, for example
+// "npipe://\\.\pipe\redis" or "npipe:////./pipe/redis".
+const pipeNetwork = "npipe"
+
+// pipeAddr is the net.Addr of named pipe connections and listeners.
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return pipeNetwork }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipePath converts the slashes of a named pipe address to backslashes, so
+// addresses can be written without escaping, like in URLs.
+func pipePath(address string) string {
+	return strings.ReplaceAll(address, "/", `\`)
+}
+
+// listen is like net.Listen but also supports named pipes.
+func listen(network string, address string) (net.Listener, error) {
+	if network == pipeNetwork {
+		return listenPipe(pipePath(address))
+	}
+	return net.Listen(network, address)
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+var errPipeUnsupported = errors.New("redis: named pipes are only supported on windows")
+
+func listenPipe(path string) (net.Listener, error) {
+	return nil, &net.OpError{Op: "listen", Net: pipeNetwork, Addr: pipeAddr(path), Err: errPipeUnsupported}
+}
+
+func dialPipe(ctx context.Context, path string) (net.Conn, error) {
+	return nil, &net.OpError{Op: "dial", Net: pipeNetwork, Addr: pipeAddr(path), Err: errPipeUnsupported}
+}
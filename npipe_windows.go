@@ -0,0 +1,442 @@
+//go:build windows
+
+package redis
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	kernel32                = syscall.NewLazyDLL("kernel32.dll")
+	procCreateNamedPipeW    = kernel32.NewProc("CreateNamedPipeW")
+	procConnectNamedPipe    = kernel32.NewProc("ConnectNamedPipe")
+	procCreateEventW        = kernel32.NewProc("CreateEventW")
+	procGetOverlappedResult = kernel32.NewProc("GetOverlappedResult")
+)
+
+const (
+	pipeAccessDuplex          = 0x3
+	pipeRejectRemoteClients   = 0x8
+	pipeUnlimitedInstances    = 255
+	pipeBufferSize            = 65536
+	fileFlagFirstPipeInstance = 0x80000
+
+	errorPipeBusy      syscall.Errno = 231
+	errorNoData        syscall.Errno = 232
+	errorPipeConnected syscall.Errno = 535
+
+	// pipeBusyRetryInterval is the time that dials wait before trying again
+	// when all instances of the pipe are busy.
+	pipeBusyRetryInterval = 10 * time.Millisecond
+)
+
+// pipeListener accepts connections on a named pipe. The listener always keeps
+// an instance of the pipe waiting for the next client, so clients don't see
+// the pipe disappear between two calls to Accept.
+type pipeListener struct {
+	path   string
+	accept sync.Mutex
+
+	mutex  sync.Mutex
+	next   syscall.Handle
+	closed bool
+}
+
+func listenPipe(path string) (net.Listener, error) {
+	// The first instance fails if another process already listens on the
+	// pipe, like binding an address that is in use.
+	h, err := createNamedPipe(path, true)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: pipeNetwork, Addr: pipeAddr(path), Err: err}
+	}
+	return &pipeListener{path: path, next: h}, nil
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.accept.Lock()
+	defer l.accept.Unlock()
+
+	l.mutex.Lock()
+	h, closed := l.next, l.closed
+	l.mutex.Unlock()
+
+	if closed {
+		return nil, l.opError(net.ErrClosed)
+	}
+
+	event, err := createEvent()
+	if err != nil {
+		return nil, l.opError(err)
+	}
+	defer syscall.CloseHandle(event)
+
+	o := &syscall.Overlapped{HEvent: event}
+	r, _, e := procConnectNamedPipe.Call(uintptr(h), uintptr(unsafe.Pointer(o)))
+
+	if r == 0 {
+		switch e {
+		case errorPipeConnected:
+			// The client connected before ConnectNamedPipe was called.
+		case syscall.ERROR_IO_PENDING:
+			// Close cancels the pending operation.
+			var n uint32
+			if err := getOverlappedResult(h, o, &n); err != nil {
+				if l.isClosed() {
+					return nil, l.opError(net.ErrClosed)
+				}
+				return nil, l.opError(err)
+			}
+		default:
+			return nil, l.opError(os.NewSyscallError("ConnectNamedPipe", e))
+		}
+	}
+
+	next, err := createNamedPipe(l.path, false)
+
+	l.mutex.Lock()
+	if l.closed {
+		l.mutex.Unlock()
+		if err == nil {
+			syscall.CloseHandle(next)
+		}
+		syscall.CloseHandle(h)
+		return nil, l.opError(net.ErrClosed)
+	}
+	if err == nil {
+		l.next = next
+	} else {
+		l.next = syscall.InvalidHandle
+		l.closed = true
+	}
+	l.mutex.Unlock()
+
+	conn, connErr := newPipeConn(h, l.path)
+	if connErr != nil {
+		syscall.CloseHandle(h)
+		return nil, l.opError(connErr)
+	}
+
+	// When the next instance couldn't be created the listener is closed, the
+	// connection that was accepted is still returned and the error reported
+	// by the next call to Accept.
+	return conn, nil
+}
+
+func (l *pipeListener) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return nil
+	}
+
+	l.closed = true
+	syscall.CancelIoEx(l.next, nil)
+	syscall.CloseHandle(l.next)
+	l.next = syscall.InvalidHandle
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.path)
+}
+
+func (l *pipeListener) isClosed() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.closed
+}
+
+func (l *pipeListener) opError(err error) error {
+	return &net.OpError{Op: "accept", Net: pipeNetwork, Addr: pipeAddr(l.path), Err: err}
+}
+
+func dialPipe(ctx context.Context, path string) (net.Conn, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: pipeNetwork, Addr: pipeAddr(path), Err: err}
+	}
+
+	for {
+		h, err := syscall.CreateFile(p,
+			syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+			syscall.OPEN_EXISTING, syscall.FILE_FLAG_OVERLAPPED, 0,
+		)
+
+		if err == nil {
+			conn, err := newPipeConn(h, path)
+			if err != nil {
+				syscall.CloseHandle(h)
+				return nil, &net.OpError{Op: "dial", Net: pipeNetwork, Addr: pipeAddr(path), Err: err}
+			}
+			return conn, nil
+		}
+
+		if err != errorPipeBusy {
+			return nil, &net.OpError{Op: "dial", Net: pipeNetwork, Addr: pipeAddr(path), Err: os.NewSyscallError("CreateFile", err)}
+		}
+
+		// All instances of the pipe are connected to other clients, the
+		// server creates new ones as it accepts connections.
+		select {
+		case <-time.After(pipeBusyRetryInterval):
+		case <-ctx.Done():
+			return nil, &net.OpError{Op: "dial", Net: pipeNetwork, Addr: pipeAddr(path), Err: ctx.Err()}
+		}
+	}
+}
+
+// pipeConn is a connection on a named pipe. Reads and writes use overlapped
+// I/O so they can be interrupted when their deadline expires.
+type pipeConn struct {
+	handle syscall.Handle
+	addr   pipeAddr
+	once   sync.Once
+	rio    pipeIO
+	wio    pipeIO
+}
+
+func newPipeConn(h syscall.Handle, path string) (*pipeConn, error) {
+	c := &pipeConn{handle: h, addr: pipeAddr(path)}
+
+	var err error
+	if c.rio.event, err = createEvent(); err != nil {
+		return nil, err
+	}
+	if c.wio.event, err = createEvent(); err != nil {
+		syscall.CloseHandle(c.rio.event)
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	n, err := c.rio.do(c.handle, func(o *syscall.Overlapped, n *uint32) error {
+		return syscall.ReadFile(c.handle, b, n, o)
+	})
+
+	switch err {
+	case nil:
+		return n, nil
+	case syscall.ERROR_BROKEN_PIPE, errorNoData, syscall.ERROR_HANDLE_EOF:
+		return n, io.EOF
+	default:
+		return n, c.opError("read", err)
+	}
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	written := 0
+
+	for written < len(b) {
+		p := b[written:]
+
+		n, err := c.wio.do(c.handle, func(o *syscall.Overlapped, n *uint32) error {
+			return syscall.WriteFile(c.handle, p, n, o)
+		})
+
+		written += n
+
+		if err != nil {
+			return written, c.opError("write", err)
+		}
+	}
+
+	return written, nil
+}
+
+func (c *pipeConn) Close() error {
+	c.once.Do(func() {
+		syscall.CancelIoEx(c.handle, nil)
+		syscall.CloseHandle(c.handle)
+		syscall.CloseHandle(c.rio.event)
+		syscall.CloseHandle(c.wio.event)
+	})
+	return nil
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.rio.setDeadline(c.handle, t)
+	c.wio.setDeadline(c.handle, t)
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.rio.setDeadline(c.handle, t)
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.wio.setDeadline(c.handle, t)
+	return nil
+}
+
+func (c *pipeConn) opError(op string, err error) error {
+	if errno, ok := err.(syscall.Errno); ok {
+		err = os.NewSyscallError(op, errno)
+	}
+	return &net.OpError{Op: op, Net: pipeNetwork, Addr: c.addr, Err: err}
+}
+
+// pipeIO serializes the reads or writes of a pipe connection and cancels them
+// when their deadline expires.
+type pipeIO struct {
+	serial sync.Mutex
+	event  syscall.Handle
+
+	mutex    sync.Mutex
+	deadline time.Time
+	timer    *time.Timer
+	pending  *syscall.Overlapped
+	timedOut bool
+}
+
+func (p *pipeIO) do(h syscall.Handle, op func(*syscall.Overlapped, *uint32) error) (int, error) {
+	p.serial.Lock()
+	defer p.serial.Unlock()
+
+	var n uint32
+	o := &syscall.Overlapped{HEvent: p.event}
+
+	if !p.begin(h, o) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	err := op(o, &n)
+	if err == syscall.ERROR_IO_PENDING {
+		err = getOverlappedResult(h, o, &n)
+	}
+
+	if p.end() && err == syscall.ERROR_OPERATION_ABORTED {
+		err = os.ErrDeadlineExceeded
+	}
+
+	return int(n), err
+}
+
+// begin registers o as the pending operation, arming a timer which cancels it
+// at the deadline. The method returns false if the deadline already expired.
+func (p *pipeIO) begin(h syscall.Handle, o *syscall.Overlapped) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.deadline.IsZero() && !time.Now().Before(p.deadline) {
+		return false
+	}
+
+	p.pending, p.timedOut = o, false
+	p.arm(h)
+	return true
+}
+
+// end clears the pending operation, returning whether it was canceled because
+// its deadline expired.
+func (p *pipeIO) end() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+
+	p.pending = nil
+	return p.timedOut
+}
+
+func (p *pipeIO) setDeadline(h syscall.Handle, t time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.deadline = t
+
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+
+	if p.pending != nil {
+		p.arm(h)
+	}
+}
+
+// arm starts the timer of the pending operation, it must be called with the
+// mutex held.
+func (p *pipeIO) arm(h syscall.Handle) {
+	if p.deadline.IsZero() {
+		return
+	}
+
+	o := p.pending
+
+	p.timer = time.AfterFunc(time.Until(p.deadline), func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		if p.pending == o {
+			p.timedOut = true
+			syscall.CancelIoEx(h, o)
+		}
+	})
+}
+
+func createNamedPipe(path string, first bool) (syscall.Handle, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return syscall.InvalidHandle, err
+	}
+
+	flags := uint32(pipeAccessDuplex | syscall.FILE_FLAG_OVERLAPPED)
+	if first {
+		flags |= fileFlagFirstPipeInstance
+	}
+
+	r, _, e := procCreateNamedPipeW.Call(
+		uintptr(unsafe.Pointer(p)),
+		uintptr(flags),
+		pipeRejectRemoteClients, // byte stream, blocking mode
+		pipeUnlimitedInstances,
+		pipeBufferSize,
+		pipeBufferSize,
+		0,
+		0,
+	)
+
+	if h := syscall.Handle(r); h != syscall.InvalidHandle {
+		return h, nil
+	}
+
+	return syscall.InvalidHandle, os.NewSyscallError("CreateNamedPipe", e)
+}
+
+func createEvent() (syscall.Handle, error) {
+	// Manual reset event, initially not signaled.
+	r, _, e := procCreateEventW.Call(0, 1, 0, 0)
+	if r == 0 {
+		return 0, os.NewSyscallError("CreateEvent", e)
+	}
+	return syscall.Handle(r), nil
+}
+
+func getOverlappedResult(h syscall.Handle, o *syscall.Overlapped, n *uint32) error {
+	r, _, e := procGetOverlappedResult.Call(uintptr(h), uintptr(unsafe.Pointer(o)), uintptr(unsafe.Pointer(n)), 1)
+	if r == 0 {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+//go:build windows
+
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestNamedPipe(t *testing.T) {
+	addr := fmt.Sprintf("npipe:////./pipe/redis-go-test-%d", os.Getpid())
+
+	srv := &redis.Server{
+		Addr: addr,
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			res.Write("OK")
+		}),
+	}
+	go srv.ListenAndServe()
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The server may not be listening yet when the first requests are sent.
+	waitFor(t, ctx, func() bool {
+		return cli.Exec(ctx, "SET", "key", "value") == nil
+	})
+
+	for i := 0; i != 10; i++ {
+		if s, err := cli.ExecStatus(ctx, "SET", "key", "value"); err != nil {
+			t.Fatal(err)
+		} else if s != "OK" {
+			t.Error("bad status:", s)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoSuchKey is returned by methods which operate on a single key when the
+// key doesn't exist.
+var ErrNoSuchKey = errors.New("redis: no such key")
+
+// ObjectInfo carries the internal properties of a key, as reported by the
+// OBJECT command.
+type ObjectInfo struct {
+	// Encoding is the internal representation of the value ("listpack",
+	// "hashtable", "embstr", "int", ...).
+	Encoding string
+
+	// RefCount is the number of references to the value.
+	RefCount int64
+
+	// IdleTime is the time since the key was last accessed. It is only
+	// available when the server uses an LRU eviction policy.
+	IdleTime time.Duration
+
+	// Freq is the logarithmic access frequency counter of the key. It is only
+	// available when the server uses an LFU eviction policy.
+	Freq int64
+}
+
+// ObjectInfo returns the internal properties of key, or ErrNoSuchKey if the
+// key doesn't exist.
+//
+// The method is mostly useful to debug performance issues or write tests which
+// verify the encoding of data structures.
+func (c *Client) ObjectInfo(ctx context.Context, key string) (ObjectInfo, error) {
+	var info ObjectInfo
+	var encoding *string
+	var idle int64
+
+	if err := ParseArgs(c.Query(ctx, "OBJECT", "ENCODING", key), &encoding); err != nil {
+		return info, err
+	}
+
+	if encoding == nil {
+		return info, ErrNoSuchKey
+	}
+
+	info.Encoding = *encoding
+
+	if err := ParseArgs(c.Query(ctx, "OBJECT", "REFCOUNT", key), &info.RefCount); err != nil {
+		return info, err
+	}
+
+	// IDLETIME and FREQ are mutually exclusive, the server returns an error for
+	// the one that doesn't match its eviction policy.
+	switch err := ParseArgs(c.Query(ctx, "OBJECT", "IDLETIME", key), &idle); ErrorClass(err) {
+	case ErrClassNone:
+		info.IdleTime = time.Duration(idle) * time.Second
+	case ErrClassServer:
+	default:
+		return info, err
+	}
+
+	switch err := ParseArgs(c.Query(ctx, "OBJECT", "FREQ", key), &info.Freq); ErrorClass(err) {
+	case ErrClassNone, ErrClassServer:
+	default:
+		return info, err
+	}
+
+	return info, nil
+}
@@ -0,0 +1,57 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+	"github.com/segmentio/redis-go/redistest"
+)
+
+func TestObjectInfo(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var sub, key string
+		req.Cmds[0].ParseArgs(&sub, &key)
+
+		if key != "list" {
+			res.Write(nil)
+			return
+		}
+
+		switch sub {
+		case "ENCODING":
+			res.Write("listpack")
+		case "REFCOUNT":
+			res.Write(1)
+		case "IDLETIME":
+			res.Write(42)
+		case "FREQ":
+			res.Write(resp.NewError("ERR An LFU maxmemory policy is not selected, access frequency not tracked."))
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	info, err := cli.ObjectInfo(context.Background(), "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := redis.ObjectInfo{Encoding: "listpack", RefCount: 1, IdleTime: 42 * time.Second}
+
+	if info != expect {
+		t.Errorf("bad object info: %+v", info)
+	}
+
+	if _, err := cli.ObjectInfo(context.Background(), "missing"); err != redis.ErrNoSuchKey {
+		t.Error("bad error:", err)
+	}
+
+	redistest.AssertEncoding(t, cli, "list", "listpack")
+}
@@ -0,0 +1,150 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pipelinePools holds the pools of connections shared by the pipelined
+// requests of a transport, indexed by address.
+type pipelinePools struct {
+	mutex sync.Mutex
+	pools map[string]*upstreamPool
+}
+
+// roundTripPipelined sends req on one of the connections shared by the
+// requests to the same address, see PipelinedConnsPerHost.
+func (t *Transport) roundTripPipelined(req *Request) (*Response, error) {
+	if !t.pool.startRequest() {
+		req.Close()
+		return nil, ErrTransportClosed
+	}
+
+	var limiterRelease func(error)
+
+	release := func(err error) {
+		if limiterRelease != nil {
+			limiterRelease(err)
+		}
+		t.pool.endRequest(nil)
+	}
+
+	if t.Limiter != nil {
+		r, err := t.Limiter.acquire()
+		if err != nil {
+			release(nil)
+			req.Close()
+			return nil, err
+		}
+		limiterRelease = r
+	}
+
+	res, err := t.pipelines.get(req.Addr, t.PipelinedConnsPerHost, t.MaxConnLifetime, t.dial, &t.stats).roundTrip(req, release)
+	if err != nil {
+		release(err)
+	}
+	return res, err
+}
+
+func (p *pipelinePools) get(addr string, size int, maxConnLifetime time.Duration, dial func(context.Context, string, string) (*Conn, error), stats *poolStats) *upstreamPool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pool := p.pools[addr]
+
+	if pool == nil {
+		if p.pools == nil {
+			p.pools = make(map[string]*upstreamPool)
+		}
+		pool = &upstreamPool{
+			addr:            addr,
+			size:            size,
+			dial:            dial,
+			stats:           stats,
+			maxConnLifetime: maxConnLifetime,
+		}
+		p.pools[addr] = pool
+	}
+
+	return pool
+}
+
+// conns returns the number of shared connections.
+func (p *pipelinePools) conns() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	n := 0
+	for _, pool := range p.pools {
+		n += pool.len()
+	}
+	return n
+}
+
+// closeIdle closes the shared connections which have no requests in flight.
+func (p *pipelinePools) closeIdle() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, pool := range p.pools {
+		pool.closeIdle()
+	}
+}
+
+// close closes all the shared connections, interrupting the requests in
+// flight.
+func (p *pipelinePools) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, pool := range p.pools {
+		pool.close()
+	}
+}
+
+// canPipeline returns true if the commands of req can share their connection
+// with other requests. Commands which change the state of their connection or
+// block it are sent on dedicated connections.
+func canPipeline(req *Request) bool {
+	for _, cmd := range req.Cmds {
+		if _, ok := unpipelinedCommands[strings.ToUpper(cmd.Cmd)]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+var unpipelinedCommands = map[string]struct{}{
+	// connection state
+	"AUTH":      {},
+	"CLIENT":    {},
+	"HELLO":     {},
+	"READONLY":  {},
+	"READWRITE": {},
+	"RESET":     {},
+	"SELECT":    {},
+	"UNWATCH":   {},
+	"WATCH":     {},
+
+	// blocking commands
+	"BLMOVE":     {},
+	"BLMPOP":     {},
+	"BLPOP":      {},
+	"BRPOP":      {},
+	"BRPOPLPUSH": {},
+	"BZMPOP":     {},
+	"BZPOPMAX":   {},
+	"BZPOPMIN":   {},
+	"WAIT":       {},
+	"WAITAOF":    {},
+	"XREAD":      {},
+	"XREADGROUP": {},
+
+	// pub/sub and monitoring
+	"MONITOR":    {},
+	"PSUBSCRIBE": {},
+	"SSUBSCRIBE": {},
+	"SUBSCRIBE":  {},
+}
@@ -0,0 +1,220 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestTransportPipelining(t *testing.T) {
+	var mutex sync.Mutex
+	var clients = map[string]bool{}
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		mutex.Lock()
+		clients[req.Addr] = true
+		mutex.Unlock()
+
+		if req.IsPipeline() {
+			res.WriteStream(len(req.Cmds))
+			for _, cmd := range req.Cmds {
+				var s string
+				cmd.ParseArgs(&s)
+				res.Write(s)
+			}
+			return
+		}
+
+		var s string
+		req.Cmds[0].ParseArgs(&s)
+		res.Write(s)
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{PipelinedConnsPerHost: 2}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i != 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprint("key-", i)
+
+			var value string
+			if err := redis.ParseArgs(cli.Query(ctx, "ECHO", key), &value); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if value != key {
+				t.Errorf("bad response to %s: %s", key, value)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	mutex.Lock()
+	n := len(clients)
+	mutex.Unlock()
+
+	if n > 2 {
+		t.Error("too many connections opened by the transport:", n)
+	}
+
+	if stats := tr.Stats(); stats.PipelinedConns != n || stats.Conns != n {
+		t.Errorf("bad stats: %+v", stats)
+	}
+}
+
+func TestTransportPipeliningCancel(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var s string
+		req.Cmds[0].ParseArgs(&s)
+		if s == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		res.Write(s)
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{PipelinedConnsPerHost: 1}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	slow := make(chan error, 1)
+	go func() {
+		start := time.Now()
+		_, err := redis.String(cli.Query(ctx, "ECHO", "slow"))
+		if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+			t.Error("the canceled request waited for its response:", elapsed)
+		}
+		slow <- err
+	}()
+
+	// Queue the second request behind the slow one on the shared connection.
+	time.Sleep(10 * time.Millisecond)
+
+	if s, err := redis.String(cli.Query(context.Background(), "ECHO", "fast")); err != nil {
+		t.Error("the request pipelined after a canceled request failed:", err)
+	} else if s != "fast" {
+		t.Error("bad response:", s)
+	}
+
+	if err := <-slow; err != context.DeadlineExceeded {
+		t.Error("bad error of the canceled request:", err)
+	}
+}
+
+func TestTransportPipeliningCancelLateResponse(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var s string
+		req.Cmds[0].ParseArgs(&s)
+		if s == "slow" {
+			// Longer than the time spent draining the responses of
+			// canceled requests.
+			time.Sleep(1500 * time.Millisecond)
+			s = "slow-reply"
+		}
+		res.Write(s)
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{PipelinedConnsPerHost: 1}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := redis.String(cli.Query(ctx, "ECHO", "slow"))
+		slow <- err
+	}()
+
+	// Queue the second request behind the slow one on the shared connection,
+	// it must never receive the late response of the canceled request.
+	time.Sleep(10 * time.Millisecond)
+
+	if s, err := redis.String(cli.Query(context.Background(), "ECHO", "queued")); err == nil && s != "queued" {
+		t.Error("the request pipelined after a canceled request received a bad response:", s)
+	}
+
+	if err := <-slow; err != context.DeadlineExceeded {
+		t.Error("bad error of the canceled request:", err)
+	}
+
+	// The broken connection was closed, the next requests use a new one.
+	if s, err := redis.String(cli.Query(context.Background(), "ECHO", "next")); err != nil {
+		t.Error(err)
+	} else if s != "next" {
+		t.Error("bad response:", s)
+	}
+}
+
+func TestTransportPipeliningMaxConnLifetime(t *testing.T) {
+	var mutex sync.Mutex
+	var clients = map[string]bool{}
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		mutex.Lock()
+		clients[req.Addr] = true
+		mutex.Unlock()
+
+		var s string
+		req.Cmds[0].ParseArgs(&s)
+		res.Write(s)
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{PipelinedConnsPerHost: 1, MaxConnLifetime: 20 * time.Millisecond}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// The response of the first request is held open while the connection
+	// expires, the connection must not be closed under it.
+	args := cli.Query(ctx, "ECHO", "first")
+	time.Sleep(30 * time.Millisecond)
+
+	if s, err := redis.String(cli.Query(ctx, "ECHO", "second")); err != nil {
+		t.Fatal(err)
+	} else if s != "second" {
+		t.Error("bad response:", s)
+	}
+
+	if s, err := redis.String(args); err != nil {
+		t.Error("the request in flight on the expired connection failed:", err)
+	} else if s != "first" {
+		t.Error("bad response:", s)
+	}
+
+	mutex.Lock()
+	n := len(clients)
+	mutex.Unlock()
+
+	if n != 2 {
+		t.Error("the expired connection was reused:", n)
+	}
+
+	// The expired connection is closed after its last request completed.
+	waitFor(t, ctx, func() bool { return srv.Stats().Conns == 1 })
+}
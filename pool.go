@@ -2,6 +2,7 @@ package redis
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -9,22 +10,38 @@ type connPool struct {
 	// immutable configuration
 	maxIdleConns        int
 	maxIdleConnsPerHost int
+	maxIdleConnsByHost  map[string]int
+	maxConnLifetime     time.Duration
+	maxIdleTime         time.Duration
 
 	// mutable state of the connection pool
-	mutex sync.Mutex
-	calls int
-	idles int
-	conns map[string]*connList
+	mutex    sync.Mutex
+	calls    int
+	idles    int
+	conns    map[string]*connList
+	closed   bool
+	inflight int
+	active   map[*Conn]struct{}
+	stop     func()
+
+	// counters of the pings sent on idle connections
+	pings      int64
+	pingErrors int64
 }
 
 func (p *connPool) getConn(host string) *Conn {
 	var list *connList
 	var conn *Conn
+	var expired []*Conn
+	var now = time.Now()
 
 	p.mutex.Lock()
 
 	if list = p.conns[host]; list != nil {
-		conn = list.pop()
+		for conn = list.pop(); conn != nil && p.expired(conn, now); conn = list.pop() {
+			expired = append(expired, conn)
+			p.idles--
+		}
 	}
 
 	if p.calls++; p.calls == 1000 {
@@ -44,6 +61,10 @@ func (p *connPool) getConn(host string) *Conn {
 
 	p.mutex.Unlock()
 
+	for _, c := range expired {
+		c.Close()
+	}
+
 	if conn != nil {
 		conn.SetDeadline(time.Time{}) // don't leak deadlines
 	}
@@ -57,9 +78,10 @@ func (p *connPool) putConn(host string, conn *Conn) {
 	}
 
 	var list *connList
+	var now = time.Now()
 	p.mutex.Lock()
 
-	if p.maxIdleConns == 0 || p.idles < p.maxIdleConns {
+	if !p.closed && !p.tooOld(conn, now) && (p.maxIdleConns == 0 || p.idles < p.maxIdleConns) {
 		if p.conns == nil {
 			p.conns = make(map[string]*connList)
 		}
@@ -70,7 +92,8 @@ func (p *connPool) putConn(host string, conn *Conn) {
 		}
 	}
 
-	if list != nil && (p.maxIdleConnsPerHost == 0 || list.len() < p.maxIdleConnsPerHost) {
+	if max := p.maxIdleConnsForHost(host); list != nil && (max == 0 || list.len() < max) {
+		conn.idleSince = now
 		list.push(conn)
 		p.idles++
 		conn = nil
@@ -83,22 +106,146 @@ func (p *connPool) putConn(host string, conn *Conn) {
 	}
 }
 
+// tooOld returns true if conn was established more than maxConnLifetime ago.
+func (p *connPool) tooOld(conn *Conn, now time.Time) bool {
+	return p.maxConnLifetime != 0 && now.Sub(conn.created) >= p.maxConnLifetime
+}
+
+// expired returns true if the idle connection conn must not be reused anymore,
+// the mutex of the pool must be held.
+func (p *connPool) expired(conn *Conn, now time.Time) bool {
+	return p.tooOld(conn, now) || (p.maxIdleTime != 0 && now.Sub(conn.idleSince) >= p.maxIdleTime)
+}
+
+// closeExpiredConnections closes the idle connections which exceeded their
+// lifetime or idle time.
+func (p *connPool) closeExpiredConnections() {
+	if p.maxConnLifetime == 0 && p.maxIdleTime == 0 {
+		return
+	}
+
+	var expired []*Conn
+	var now = time.Now()
+
+	p.mutex.Lock()
+
+	for _, list := range p.conns {
+		n := len(expired)
+		expired = list.remove(expired, func(conn *Conn) bool { return p.expired(conn, now) })
+		p.idles -= len(expired) - n
+	}
+
+	p.mutex.Unlock()
+
+	for _, conn := range expired {
+		conn.Close()
+	}
+}
+
+func (p *connPool) maxIdleConnsForHost(host string) int {
+	if max, ok := p.maxIdleConnsByHost[host]; ok {
+		return max
+	}
+	return p.maxIdleConnsPerHost
+}
+
 func (p *connPool) closeIdleConnections() {
 	p.mutex.Lock()
 
 	for _, conns := range p.conns {
 		for conn := conns.pop(); conn != nil; conn = conns.pop() {
 			conn.Close()
+			p.idles--
 		}
 	}
 
 	p.mutex.Unlock()
 }
 
+// startRequest registers a new in-flight request, it returns false if the
+// pool was closed.
+func (p *connPool) startRequest() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return false
+	}
+
+	p.inflight++
+	return true
+}
+
+// activate registers conn as being used by an in-flight request.
+func (p *connPool) activate(conn *Conn) {
+	p.mutex.Lock()
+
+	if p.active == nil {
+		p.active = make(map[*Conn]struct{})
+	}
+
+	p.active[conn] = struct{}{}
+	p.mutex.Unlock()
+}
+
+// endRequest unregisters an in-flight request and the connection it used,
+// conn may be nil if the request failed before obtaining a connection.
+func (p *connPool) endRequest(conn *Conn) {
+	p.mutex.Lock()
+	p.inflight--
+
+	if conn != nil {
+		delete(p.active, conn)
+	}
+
+	p.mutex.Unlock()
+}
+
+// connCounts returns the number of idle connections, and of connections used
+// by in-flight requests.
+func (p *connPool) connCounts() (idle int, active int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.idles, len(p.active)
+}
+
+func (p *connPool) inflightRequests() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.inflight
+}
+
+// close prevents new requests from starting and connections from being
+// pooled, and closes idle connections.
+func (p *connPool) close() {
+	p.mutex.Lock()
+	p.closed = true
+	stop := p.stop
+	p.mutex.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+
+	p.closeIdleConnections()
+}
+
+func (p *connPool) closeActiveConnections() {
+	p.mutex.Lock()
+
+	for conn := range p.active {
+		conn.Close()
+	}
+
+	p.mutex.Unlock()
+}
+
 func (p *connPool) pingIdleConnections(timeout time.Duration) {
 	for _, host := range p.hosts() {
 		if conn := p.getConn(host); conn != nil {
+			atomic.AddInt64(&p.pings, 1)
 			if ping(conn, timeout) != nil {
+				atomic.AddInt64(&p.pingErrors, 1)
 				conn.Close()
 			} else {
 				p.putConn(host, conn)
@@ -159,6 +306,28 @@ func (c *connList) push(conn *Conn) {
 	c.pushList = append(c.pushList, conn)
 }
 
+// remove removes the connections matching f from the list, appending them to
+// removed, which is returned.
+func (c *connList) remove(removed []*Conn, f func(*Conn) bool) []*Conn {
+	filter := func(conns []*Conn) []*Conn {
+		kept := conns[:0]
+		for _, conn := range conns {
+			if f(conn) {
+				removed = append(removed, conn)
+			} else {
+				kept = append(kept, conn)
+			}
+		}
+		for i := len(kept); i < len(conns); i++ {
+			conns[i] = nil
+		}
+		return kept
+	}
+	c.popList = filter(c.popList)
+	c.pushList = filter(c.pushList)
+	return removed
+}
+
 func reverse(conns []*Conn) {
 	for i, j := 0, len(conns)-1; i < j; {
 		conns[i], conns[j] = conns[j], conns[i]
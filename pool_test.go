@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnPoolMaxIdleConnsByHost(t *testing.T) {
+	pool := &connPool{
+		maxIdleConnsPerHost: 1,
+		maxIdleConnsByHost:  map[string]int{"big:6379": 3},
+	}
+	defer pool.closeIdleConnections()
+
+	for _, host := range []string{"small:6379", "big:6379"} {
+		for i := 0; i != 4; i++ {
+			c1, c2 := net.Pipe()
+			defer c2.Close()
+			pool.putConn(host, NewClientConn(c1))
+		}
+	}
+
+	if n := pool.conns["small:6379"].len(); n != 1 {
+		t.Error("bad number of idle connections to the host using the default limit:", n)
+	}
+
+	if n := pool.conns["big:6379"].len(); n != 3 {
+		t.Error("bad number of idle connections to the host with an override:", n)
+	}
+}
+
+func TestConnPoolExpiration(t *testing.T) {
+	pool := &connPool{
+		maxConnLifetime: time.Hour,
+		maxIdleTime:     time.Minute,
+	}
+	defer pool.closeIdleConnections()
+
+	newConn := func() *Conn {
+		c1, c2 := net.Pipe()
+		t.Cleanup(func() { c2.Close() })
+		return NewClientConn(c1)
+	}
+
+	old := newConn()
+	old.created = time.Now().Add(-2 * time.Hour)
+	pool.putConn("host:6379", old)
+
+	if n := pool.idles; n != 0 {
+		t.Error("connections older than their lifetime must not be pooled:", n)
+	}
+
+	idle, fresh := newConn(), newConn()
+	pool.putConn("host:6379", idle)
+	pool.putConn("host:6379", fresh)
+	idle.idleSince = time.Now().Add(-2 * time.Minute)
+
+	if conn := pool.getConn("host:6379"); conn != fresh {
+		t.Error("connections idle for longer than the idle time must not be reused")
+	}
+	if n := pool.idles; n != 0 {
+		t.Error("bad number of idle connections:", n)
+	}
+
+	pool.putConn("host:6379", fresh)
+	fresh.idleSince = time.Now().Add(-2 * time.Minute)
+	pool.putConn("host:6379", newConn())
+	pool.closeExpiredConnections()
+
+	if n := pool.conns["host:6379"].len(); n != 1 || pool.idles != 1 {
+		t.Errorf("bad number of idle connections: %d/%d", n, pool.idles)
+	}
+}
+
+func TestConnPoolCloseIdleConnections(t *testing.T) {
+	pool := &connPool{maxIdleConns: 2}
+	defer pool.closeIdleConnections()
+
+	newConn := func() *Conn {
+		c1, c2 := net.Pipe()
+		t.Cleanup(func() { c2.Close() })
+		return NewClientConn(c1)
+	}
+
+	pool.putConn("host:6379", newConn())
+	pool.putConn("host:6379", newConn())
+	pool.closeIdleConnections()
+
+	if n := pool.idles; n != 0 {
+		t.Error("bad number of idle connections after closing them:", n)
+	}
+
+	// The limit of idle connections applies to the connections left in the
+	// pool, not to the ones that were closed.
+	conn := newConn()
+	pool.putConn("host:6379", conn)
+
+	if c := pool.getConn("host:6379"); c != conn {
+		t.Error("connections must be pooled again after closing the idle connections")
+	}
+}
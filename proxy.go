@@ -8,6 +8,12 @@ import (
 	"io"
 	"log"
 	"net"
+	"path"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/segmentio/objconv/resp"
 )
@@ -22,15 +28,91 @@ type ReverseProxy struct {
 	// requests to.
 	Registry ServerRegistry
 
+	// Routes is an ordered list of rules routing keyspaces to other pools of
+	// upstream servers than the one exposed by Registry, for example to keep
+	// sessions:* and cache:* on different backends behind the same proxy
+	// endpoint. The keys of a request are routed by the first rule that they
+	// match, keys matching none of the rules are routed to Registry.
+	//
+	// Requests with keys routed to different pools are rejected, like requests
+	// with keys hashing to different servers.
+	Routes []ProxyRoute
+
 	// ErrorLog specifies an optional logger for errors accepting connections
 	// and unexpected behavior from handlers. If nil, logging goes to os.Stderr
 	// via the log package's standard logger.
 	ErrorLog *log.Logger
+
+	// MaxUpstreamRequests limits the number of requests that the proxy has in
+	// flight to each upstream server. When the limit is reached, requests are
+	// queued and dispatched according to ClassWeights. Zero means no limit.
+	MaxUpstreamRequests int
+
+	// ClassWeights configures the relative share of upstream requests given
+	// to each class of commands when requests are queued. If nil,
+	// DefaultClassWeights is used.
+	ClassWeights map[CommandClass]int
+
+	// UpstreamConns is the number of connections that the proxy opens to each
+	// upstream server. When non-zero, requests from all clients are pipelined
+	// over these connections instead of being sent through Transport, which
+	// decouples the number of upstream connections from the number of client
+	// connections. Combine with MaxUpstreamRequests to bound the depth of the
+	// pipelines.
+	//
+	// The responses of canceled requests are read and discarded in the
+	// background. A connection whose response doesn't arrive in time is
+	// closed, failing the requests of the other clients pipelined after it.
+	UpstreamConns int
+
+	// DeadlineMargin is subtracted from the deadline of requests received by
+	// the proxy to compute the deadline of the requests it sends upstream,
+	// leaving time to forward the responses back to the clients. Requests
+	// whose budget is exhausted are rejected without being sent upstream.
+	// Zero means that upstream requests share the deadline of the client
+	// requests.
+	DeadlineMargin time.Duration
+
+	// CommandStats, if not nil, records the calls and the time spent serving
+	// each command, including the round trips to the upstream servers, and
+	// the proxy answers INFO commandstats with them instead of forwarding the
+	// command.
+	CommandStats *CommandStats
+
+	// SLO, if not nil, tracks the latency of requests against objectives set
+	// per class of commands, including the round trips to the upstream
+	// servers.
+	SLO *SLO
+
+	mutex      sync.Mutex
+	schedulers map[string]*scheduler
+	upstreams  map[string]*upstreamPool
+	used       map[string]time.Time
 }
 
+// upstreamIdleTimeout is the time after which the proxy forgets the upstream
+// servers that it hasn't sent requests to, closing their connections, so the
+// state of servers removed from the registries isn't retained forever.
+const upstreamIdleTimeout = 5 * time.Minute
+
 // ServeRedis satisfies the Handler interface.
 func (proxy *ReverseProxy) ServeRedis(w ResponseWriter, r *Request) {
+	if proxy.CommandStats == nil && proxy.SLO == nil {
+		proxy.serveRequest(w, r)
+		return
+	}
+
+	if proxy.CommandStats != nil && isCommandStatsRequest(r) {
+		proxy.CommandStats.serveInfo(w)
+		return
+	}
+
+	start := time.Now()
 	proxy.serveRequest(w, r)
+
+	elapsed := time.Since(start)
+	proxy.CommandStats.observeRequest(r, elapsed)
+	proxy.SLO.observeRequest(r, elapsed)
 }
 
 func (proxy *ReverseProxy) serveRequest(w ResponseWriter, req *Request) {
@@ -41,41 +123,71 @@ func (proxy *ReverseProxy) serveRequest(w ResponseWriter, req *Request) {
 		keys = cmds[i].getKeys(keys)
 	}
 
-	servers, err := proxy.lookupServers(req.Context)
-	if err != nil {
-		w.Write(errorf("ERR No upstream server were found to route the request to."))
-		proxy.log(err)
+	target, ok := proxy.route(keys)
+	if !ok {
+		w.Write(errorf("EXECABORT The transaction contains keys that are routed to different upstream pools."))
 		return
 	}
+	registry := target.registry
 
-	// TODO: looking up servers and rebuilding the hash ring for every request
-	// is not efficient, we should cache and reuse the state.
-	hashring := makeHashRing(servers...)
-	upstream := ""
+	if target.migration != nil {
+		proxy.serveMigration(w, req, keys, registry, target.migration)
+		return
+	}
 
-	for _, key := range keys {
-		addr := hashring.lookup(key)
+	upstream, err := proxy.lookupUpstream(req.Context, registry, keys)
+	switch err {
+	case nil:
+	case errKeysOnDifferentUpstreams:
+		w.Write(errorf("EXECABORT The transaction contains keys that hash to different upstream servers."))
+		return
+	default:
+		w.Write(errorf("ERR No upstream server were found to route the request to."))
+		proxy.logRequest(req, err)
+		return
+	}
 
-		if len(upstream) == 0 {
-			upstream = addr
-		} else if upstream != addr {
-			w.Write(errorf("EXECABORT The transaction contains keys that hash to different upstream servers."))
+	var send = req
+	var mirror []Command
+	var mirrorCtx = req.Context
+	if target.mirror != nil && classOfRequest(req) != ClassRead {
+		// Writes are loaded in memory so they can be sent to the pool they
+		// are mirrored to once the response was written. The upstream and the
+		// mirror get their own copies of the commands, the arguments of req
+		// are closed by the server when the handler returns.
+		mirror = loadCommands(req.Cmds)
+		send = &Request{Cmds: copyByteArgs(mirror)}
+	}
+
+	if sched := proxy.scheduler(upstream); sched != nil {
+		if err := sched.acquire(req.Context, classOfRequest(req)); err != nil {
+			w.Write(errorf("ERR Timed out waiting to send the request to the upstream server."))
 			return
 		}
+		defer sched.release()
+	}
+
+	if budget, ok := RemainingBudget(req.Context, proxy.DeadlineMargin); ok && budget <= 0 {
+		w.Write(errorf("ERR The request deadline was exceeded before it could be sent to the upstream server."))
+		return
 	}
 
-	req.Addr = upstream
-	res, err := proxy.roundTrip(req)
+	ctx, cancel := WithDeadlineBudget(req.Context, proxy.DeadlineMargin)
+	defer cancel()
 
-	switch err.(type) {
+	send.Context = ctx
+	send.Addr = upstream
+	res, err := proxy.roundTrip(send)
+
+	switch e := err.(type) {
 	case nil:
 	case *resp.Error:
-		w.Write(err)
+		w.Write(translateError(e))
 		return
 	default:
 		w.Write(errorf("ERR Connecting to the upstream server failed."))
-		proxy.blacklistServer(upstream)
-		proxy.log(err)
+		proxy.blacklistServer(registry, upstream)
+		proxy.logRequest(req, err)
 		return
 	}
 
@@ -90,6 +202,10 @@ func (proxy *ReverseProxy) serveRequest(w ResponseWriter, req *Request) {
 		// left in an unpredictable state.
 		panic(err)
 	}
+
+	if mirror != nil {
+		proxy.mirror(mirrorCtx, req, target.mirror, keys, mirror)
+	}
 }
 
 func (proxy *ReverseProxy) writeTxArgs(w ResponseWriter, tx TxArgs) (err error) {
@@ -107,8 +223,8 @@ func (proxy *ReverseProxy) writeTxArgs(w ResponseWriter, tx TxArgs) (err error)
 
 		err = a.Close()
 
-		if _, ok := err.(*resp.Error); ok {
-			v = append(v, err)
+		if e, ok := err.(*resp.Error); ok {
+			v = append(v, translateError(e))
 			n++
 		}
 
@@ -134,7 +250,7 @@ func (proxy *ReverseProxy) writeArgs(w ResponseWriter, a Args) (err error) {
 	err = a.Close()
 
 	if e, ok := err.(*resp.Error); ok {
-		w.Write(e)
+		w.Write(translateError(e))
 		err = nil
 	}
 
@@ -153,35 +269,303 @@ func (proxy *ReverseProxy) servePubSub(conn net.Conn, rw *bufio.ReadWriter, comm
 	// - refresh the list of servers periodically so we can rebalance when new servers are added
 }
 
-func (proxy *ReverseProxy) lookupServers(ctx context.Context) ([]ServerEndpoint, error) {
-	r := proxy.Registry
+// proxyTarget is the pool of upstream servers that a request is routed to,
+// and the pool that its writes are mirrored to or the migration of the pool,
+// if any.
+type proxyTarget struct {
+	registry  ServerRegistry
+	mirror    ServerRegistry
+	migration *Migration
+}
+
+// route returns the target that keys are routed to, or false if they are
+// routed to different pools.
+func (proxy *ReverseProxy) route(keys []string) (proxyTarget, bool) {
+	if len(proxy.Routes) == 0 || len(keys) == 0 {
+		return proxyTarget{registry: proxy.Registry}, true
+	}
+
+	// Registries may not be comparable, keys are compared by the index of
+	// their route and the side of the split they fall on.
+	route, split := proxy.routeKey(keys[0])
+
+	for _, key := range keys[1:] {
+		if r, s := proxy.routeKey(key); r != route || s != split {
+			return proxyTarget{}, false
+		}
+	}
+
+	if route < 0 {
+		return proxyTarget{registry: proxy.Registry}, true
+	}
+
+	return proxy.Routes[route].target(split), true
+}
+
+// routeKey returns the index of the route of key, or -1 if it matches none of
+// them, and whether it's routed to the pool of the split of the route.
+func (proxy *ReverseProxy) routeKey(key string) (int, bool) {
+	for i := range proxy.Routes {
+		if route := &proxy.Routes[i]; route.match(key) {
+			return i, route.Migration == nil && route.Split != nil && route.Split.contains(key)
+		}
+	}
+	return -1, false
+}
+
+// errKeysOnDifferentUpstreams is returned by lookupUpstream when the keys hash
+// to different servers of the pool.
+var errKeysOnDifferentUpstreams = errors.New("keys hash to different upstream servers")
+
+// lookupUpstream returns the address of the server of the pool exposed by r
+// that keys hash to.
+func (proxy *ReverseProxy) lookupUpstream(ctx context.Context, r ServerRegistry, keys []string) (string, error) {
+	servers, err := proxy.lookupServers(ctx, r)
+	if err != nil {
+		return "", err
+	}
+
+	// TODO: looking up servers and rebuilding the hash ring for every request
+	// is not efficient, we should cache and reuse the state.
+	hashring := makeHashRing(servers...)
+	upstream := ""
+
+	for _, key := range keys {
+		addr := hashring.lookup(key)
+
+		if len(upstream) == 0 {
+			upstream = addr
+		} else if upstream != addr {
+			return "", errKeysOnDifferentUpstreams
+		}
+	}
+
+	return upstream, nil
+}
+
+func (proxy *ReverseProxy) lookupServers(ctx context.Context, r ServerRegistry) ([]ServerEndpoint, error) {
 	if r == nil {
 		return nil, errors.New("a redis proxy needs a non-nil registry to lookup the list of avaiable servers")
 	}
 	return r.LookupServers(ctx)
 }
 
-func (proxy *ReverseProxy) blacklistServer(upstream string) {
-	if b, ok := proxy.Registry.(ServerBlacklist); !ok {
+func (proxy *ReverseProxy) blacklistServer(r ServerRegistry, upstream string) {
+	if b, ok := r.(ServerBlacklist); ok {
 		b.BlacklistServer(ServerEndpoint{Addr: upstream})
 	}
 }
 
+func (proxy *ReverseProxy) scheduler(upstream string) *scheduler {
+	if proxy.MaxUpstreamRequests <= 0 {
+		return nil
+	}
+
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	sched := proxy.schedulers[upstream]
+
+	if sched == nil {
+		if proxy.schedulers == nil {
+			proxy.schedulers = make(map[string]*scheduler)
+		}
+		proxy.forgetIdleUpstreams(upstreamIdleTimeout)
+		sched = newScheduler(proxy.MaxUpstreamRequests, proxy.ClassWeights)
+		proxy.schedulers[upstream] = sched
+	}
+
+	proxy.use(upstream)
+	return sched
+}
+
 func (proxy *ReverseProxy) roundTrip(req *Request) (*Response, error) {
-	t := proxy.Transport
-	if t == nil {
-		t = DefaultTransport
+	if pool := proxy.upstreamPool(req.Addr); pool != nil {
+		// Once the request was sent, the connection it was sent on keeps
+		// the pool busy until the response is closed.
+		res, err := pool.roundTrip(req, nil)
+		atomic.AddInt32(&pool.refs, -1)
+		return res, err
+	}
+	return proxy.transport().RoundTrip(req)
+}
+
+// upstreamPool returns the pool of connections to upstream, the caller must
+// decrement the refs of the pool once it's done with it.
+func (proxy *ReverseProxy) upstreamPool(upstream string) *upstreamPool {
+	if proxy.UpstreamConns <= 0 {
+		return nil
+	}
+
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	pool := proxy.upstreams[upstream]
+
+	if pool == nil {
+		if proxy.upstreams == nil {
+			proxy.upstreams = make(map[string]*upstreamPool)
+		}
+		proxy.forgetIdleUpstreams(upstreamIdleTimeout)
+		pool = &upstreamPool{
+			addr: upstream,
+			size: proxy.UpstreamConns,
+			dial: proxy.dialUpstream,
+		}
+		proxy.upstreams[upstream] = pool
+	}
+
+	atomic.AddInt32(&pool.refs, 1)
+	proxy.use(upstream)
+	return pool
+}
+
+// use records that a request is being sent to upstream. The mutex must be held
+// when calling the method.
+func (proxy *ReverseProxy) use(upstream string) {
+	if proxy.used == nil {
+		proxy.used = make(map[string]time.Time)
+	}
+	proxy.used[upstream] = time.Now()
+}
+
+// forgetIdleUpstreams closes the connections and drops the schedulers of the
+// upstream servers which have no requests in flight, and to which no requests
+// were sent for longer than timeout. The mutex must be held when calling the
+// method.
+func (proxy *ReverseProxy) forgetIdleUpstreams(timeout time.Duration) {
+	now := time.Now()
+
+	for upstream, used := range proxy.used {
+		if now.Sub(used) < timeout {
+			continue
+		}
+
+		sched := proxy.schedulers[upstream]
+		pool := proxy.upstreams[upstream]
+
+		if (sched != nil && !sched.idle()) || (pool != nil && !pool.idle()) {
+			continue
+		}
+
+		if pool != nil {
+			pool.close()
+		}
+
+		delete(proxy.schedulers, upstream)
+		delete(proxy.upstreams, upstream)
+		delete(proxy.used, upstream)
+	}
+}
+
+// CloseIdleConnections closes the connections that the proxy opened to upstream
+// servers when UpstreamConns is set, and which have no requests in flight. The
+// proxy also forgets the upstream servers without requests in flight, which
+// it otherwise does only when they haven't been used for a few minutes.
+//
+// The idle connections of Transport are closed as well if it supports it.
+func (proxy *ReverseProxy) CloseIdleConnections() {
+	proxy.mutex.Lock()
+
+	for _, pool := range proxy.upstreams {
+		pool.closeIdle()
 	}
-	return t.RoundTrip(req)
+
+	proxy.forgetIdleUpstreams(0)
+	proxy.mutex.Unlock()
+
+	if c, ok := proxy.transport().(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// Close closes all the connections that the proxy opened to upstream servers
+// when UpstreamConns is set, including the ones with requests in flight, whose
+// responses fail. It must be called once the server which uses the proxy was
+// closed or shut down.
+func (proxy *ReverseProxy) Close() error {
+	proxy.mutex.Lock()
+	upstreams := proxy.upstreams
+	proxy.schedulers, proxy.upstreams, proxy.used = nil, nil, nil
+	proxy.mutex.Unlock()
+
+	for _, pool := range upstreams {
+		pool.close()
+	}
+
+	return nil
+}
+
+func (proxy *ReverseProxy) dialUpstream(ctx context.Context, network string, address string) (*Conn, error) {
+	if t, ok := proxy.transport().(*Transport); ok {
+		t.once.Do(t.init)
+		return t.dial(ctx, network, address)
+	}
+
+	c, err := DefaultDialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClientConn(c), nil
+}
+
+// UpstreamStats returns metrics about the upstream servers that the proxy has
+// sent requests to, sorted by address.
+func (proxy *ReverseProxy) UpstreamStats() []UpstreamStats {
+	proxy.mutex.Lock()
+	stats := make(map[string]*UpstreamStats)
+
+	get := func(addr string) *UpstreamStats {
+		s := stats[addr]
+		if s == nil {
+			s = &UpstreamStats{Addr: addr}
+			stats[addr] = s
+		}
+		return s
+	}
+
+	for addr, sched := range proxy.schedulers {
+		s := get(addr)
+		sched.mutex.Lock()
+		s.Inflight, s.Queued = sched.inflight, sched.queued()
+		sched.mutex.Unlock()
+	}
+
+	for addr, pool := range proxy.upstreams {
+		get(addr).Conns = pool.len()
+	}
+
+	proxy.mutex.Unlock()
+
+	list := make([]UpstreamStats, 0, len(stats))
+
+	for _, s := range stats {
+		list = append(list, *s)
+	}
+
+	sort.Slice(list, func(i int, j int) bool { return list[i].Addr < list[j].Addr })
+	return list
 }
 
 func (proxy *ReverseProxy) log(err error) {
+	proxy.logRequest(nil, err)
+}
+
+// logRequest logs an error which occurred while serving req, prefixed with the
+// correlation id of the request.
+func (proxy *ReverseProxy) logRequest(req *Request, err error) {
 	switch err {
 	case io.EOF, io.ErrUnexpectedEOF, io.ErrClosedPipe:
 		// Don't log these errors because they are very common and it doesn't
 		// bring any value to know that a client disconnected.
 		return
 	}
+	if req != nil {
+		if id := CorrelationID(req.Context); len(id) != 0 {
+			err = fmt.Errorf("request %s: %s", id, err)
+		}
+	}
 	print := log.Print
 	if logger := proxy.ErrorLog; logger != nil {
 		print = logger.Print
@@ -196,6 +580,71 @@ func (proxy *ReverseProxy) transport() RoundTripper {
 	return DefaultTransport
 }
 
+// translateError rewrites errors that only make sense to cluster-aware clients
+// into plain ERR errors. The proxy hides the topology of upstream servers, so
+// a redirection returned by an upstream means that the proxy's view of the
+// cluster is stale, not that the client should connect to another server.
+func translateError(err *resp.Error) *resp.Error {
+	switch err.Type() {
+	case "MOVED", "ASK":
+		return resp.NewError("ERR The key is served by another upstream server, the proxy's view of the servers is out of date.")
+	case "CLUSTERDOWN":
+		return resp.NewError("ERR The upstream cluster is down.")
+	case "TRYAGAIN":
+		return resp.NewError("ERR The upstream servers are being resharded, try again later.")
+	case "CROSSSLOT":
+		return resp.NewError("ERR The keys in the request don't hash to the same upstream slot.")
+	default:
+		return err
+	}
+}
+
+// ProxyRoute is a rule of a ReverseProxy routing the keys matching a pattern
+// to a pool of upstream servers.
+type ProxyRoute struct {
+	// Pattern is matched against keys using the syntax of path.Match, for
+	// example "sessions:*".
+	Pattern string
+
+	// Regexp, if not nil, is matched against keys instead of Pattern.
+	Regexp *regexp.Regexp
+
+	// Registry exposes the upstream servers of the pool.
+	Registry ServerRegistry
+
+	// Split, if not nil, routes a share of the keys of the route to another
+	// pool, for example to migrate them gradually to a new cluster.
+	Split *TrafficSplit
+
+	// Migration, if not nil, migrates the keys of the route to another pool
+	// with dual writes and read repair. Split is ignored when Migration is
+	// set.
+	Migration *Migration
+}
+
+func (route *ProxyRoute) target(split bool) proxyTarget {
+	switch {
+	case route.Migration != nil:
+		return proxyTarget{registry: route.Registry, migration: route.Migration}
+	case split && route.Split.DualWrite:
+		return proxyTarget{registry: route.Split.Registry, mirror: route.Registry}
+	case split:
+		return proxyTarget{registry: route.Split.Registry}
+	case route.Split != nil && route.Split.DualWrite:
+		return proxyTarget{registry: route.Registry, mirror: route.Split.Registry}
+	default:
+		return proxyTarget{registry: route.Registry}
+	}
+}
+
+func (route *ProxyRoute) match(key string) bool {
+	if route.Regexp != nil {
+		return route.Regexp.MatchString(key)
+	}
+	match, _ := path.Match(route.Pattern, key)
+	return match
+}
+
 func errorf(format string, args ...interface{}) error {
 	return resp.NewError(fmt.Sprintf(format, args...))
 }
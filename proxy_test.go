@@ -1,14 +1,22 @@
 package redis_test
 
 import (
-	redis "github.com/segmentio/redis-go"
-	"github.com/segmentio/redis-go/redistest"
-	"github.com/stretchr/testify/assert"
+	"context"
 	"log"
+	"net"
 	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+	"github.com/segmentio/redis-go/redistest"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestReverseProxy(t *testing.T) {
@@ -129,3 +137,565 @@ func makeServerList() (full redis.ServerList, broken redis.ServerList, onedowns
 	}
 	return
 }
+
+func TestReverseProxyUpstreamConns(t *testing.T) {
+	var mutex sync.Mutex
+	var clients = map[string]bool{}
+
+	upstream, upstreamURL := newServerTimeout(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var s string
+		req.Cmds[0].ParseArgs(&s)
+
+		mutex.Lock()
+		clients[req.Addr] = true
+		mutex.Unlock()
+
+		res.Write(s)
+	}), 2*time.Second)
+	defer upstream.Close()
+
+	proxy := &redis.ReverseProxy{
+		Transport:           &redis.Transport{},
+		Registry:            redis.ServerEndpoint{Addr: upstreamURL},
+		ErrorLog:            log.New(os.Stderr, "proxy upstream conns test ==> ", 0),
+		MaxUpstreamRequests: 4,
+		UpstreamConns:       1,
+	}
+
+	srv, serverURL := newServerTimeout(proxy, 2*time.Second)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i != 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// Each client uses its own transport to get distinct downstream
+			// connections to the proxy.
+			tr := &redis.Transport{}
+			defer tr.CloseIdleConnections()
+
+			cli := &redis.Client{Addr: serverURL, Transport: tr}
+			key := strconv.Itoa(i)
+
+			for j := 0; j != 10; j++ {
+				if s, err := redis.String(cli.Query(context.Background(), "GET", key)); err != nil {
+					t.Error(err)
+					return
+				} else if s != key {
+					t.Errorf("bad response: %q != %q", s, key)
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	mutex.Lock()
+	n := len(clients)
+	mutex.Unlock()
+
+	if n != 1 {
+		t.Error("bad number of upstream connections:", n)
+	}
+
+	stats := proxy.UpstreamStats()
+
+	if len(stats) != 1 {
+		t.Fatal("bad number of upstream stats:", len(stats))
+	}
+
+	if s := stats[0]; s.Addr != upstreamURL || s.Conns != 1 {
+		t.Errorf("bad upstream stats: %+v", s)
+	}
+
+	// Upstream servers without requests in flight are forgotten when the idle
+	// connections are closed, and used again on the next request.
+	proxy.CloseIdleConnections()
+
+	if stats := proxy.UpstreamStats(); len(stats) != 0 {
+		t.Error("idle upstream servers must be forgotten:", stats)
+	}
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: serverURL, Transport: tr}
+
+	if s, err := redis.String(cli.Query(context.Background(), "GET", "hello")); err != nil || s != "hello" {
+		t.Errorf("bad response after closing idle connections: %q %v", s, err)
+	}
+
+	if err := proxy.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if stats := proxy.UpstreamStats(); len(stats) != 0 {
+		t.Error("closing the proxy must close all the upstream connections:", stats)
+	}
+}
+
+func TestReverseProxyUpstreamConnsCancel(t *testing.T) {
+	upstream, upstreamURL := newServerTimeout(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var s string
+		req.Cmds[0].ParseArgs(&s)
+		if s == "slow" {
+			// Longer than the time spent draining the responses of
+			// canceled requests.
+			time.Sleep(1500 * time.Millisecond)
+			s = "slow-reply"
+		}
+		res.Write(s)
+	}), 5*time.Second)
+	defer upstream.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: &redis.ReverseProxy{
+			Transport:     &redis.Transport{},
+			Registry:      redis.ServerEndpoint{Addr: upstreamURL},
+			ErrorLog:      log.New(os.Stderr, "proxy upstream conns cancel test ==> ", 0),
+			UpstreamConns: 1,
+		},
+		CancelOnDisconnect: true,
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	// The first client disconnects while its request is in flight on the
+	// upstream connection, which cancels it.
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("*2\r\n$3\r\nGET\r\n$4\r\nslow\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(100*time.Millisecond, func() { conn.Close() })
+	time.Sleep(20 * time.Millisecond)
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: l.Addr().String(), Transport: tr}
+
+	// The request of the second client is queued behind the canceled one on
+	// the upstream connection, it must never receive its late response.
+	if s, err := redis.String(cli.Query(context.Background(), "GET", "queued")); err == nil && s != "queued" {
+		t.Error("a client received the response of another client:", s)
+	}
+
+	if s, err := redis.String(cli.Query(context.Background(), "GET", "next")); err != nil {
+		t.Error(err)
+	} else if s != "next" {
+		t.Error("bad response:", s)
+	}
+}
+
+func TestReverseProxyTranslateClusterErrors(t *testing.T) {
+	upstream, upstreamURL := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var msg string
+		req.Cmds[0].ParseArgs(&msg)
+		res.Write(resp.NewError(msg))
+	}))
+	defer upstream.Close()
+
+	srv, serverURL := newServer(&redis.ReverseProxy{
+		Transport: &redis.Transport{},
+		Registry:  redis.ServerEndpoint{Addr: upstreamURL},
+		ErrorLog:  log.New(os.Stderr, "proxy cluster errors test ==> ", 0),
+	})
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: serverURL, Transport: tr}
+
+	tests := []struct {
+		upstream string
+		expect   string
+	}{
+		{upstream: "MOVED 3999 127.0.0.1:6381", expect: "ERR"},
+		{upstream: "ASK 3999 127.0.0.1:6381", expect: "ERR"},
+		{upstream: "CLUSTERDOWN The cluster is down", expect: "ERR"},
+		{upstream: "TRYAGAIN Multiple keys request during rehashing of slot", expect: "ERR"},
+		{upstream: "WRONGTYPE Operation against a key holding the wrong kind of value", expect: "WRONGTYPE"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.upstream, func(t *testing.T) {
+			err := cli.Exec(context.Background(), "FAIL", test.upstream)
+
+			if e, ok := err.(*resp.Error); !ok {
+				t.Error("bad error:", err)
+			} else if e.Type() != test.expect {
+				t.Errorf("bad error type: %q != %q (%s)", e.Type(), test.expect, e)
+			}
+		})
+	}
+}
+
+func TestReverseProxyRoutes(t *testing.T) {
+	newUpstream := func(name string) (*redis.Server, string) {
+		return newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			res.WriteStream(len(req.Cmds))
+			for range req.Cmds {
+				res.Write(name)
+			}
+		}))
+	}
+
+	upstreamA, upstreamURLA := newUpstream("A")
+	defer upstreamA.Close()
+
+	upstreamB, upstreamURLB := newUpstream("B")
+	defer upstreamB.Close()
+
+	upstreamC, upstreamURLC := newUpstream("C")
+	defer upstreamC.Close()
+
+	srv, serverURL := newServer(&redis.ReverseProxy{
+		Transport: &redis.Transport{},
+		Registry:  redis.ServerEndpoint{Addr: upstreamURLA},
+		Routes: []redis.ProxyRoute{
+			{Pattern: "sessions:*", Registry: redis.ServerEndpoint{Addr: upstreamURLB}},
+			{Regexp: regexp.MustCompile(`^queues:[0-9]+$`), Registry: redis.ServerEndpoint{Addr: upstreamURLC}},
+			{Pattern: "sessions:1", Registry: redis.ServerEndpoint{Addr: upstreamURLC}},
+		},
+		ErrorLog: log.New(os.Stderr, "proxy routes test ==> ", 0),
+	})
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: serverURL, Transport: tr}
+	ctx := context.Background()
+
+	tests := []struct {
+		key    string
+		expect string
+	}{
+		{key: "sessions:1", expect: "B"},
+		{key: "queues:42", expect: "C"},
+		{key: "queues:abc", expect: "A"},
+		{key: "cache:1", expect: "A"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			if s, err := redis.String(cli.Query(ctx, "GET", test.key)); err != nil {
+				t.Error(err)
+			} else if s != test.expect {
+				t.Errorf("bad upstream: %q != %q", s, test.expect)
+			}
+		})
+	}
+
+	t.Run("transactions with keys routed to different pools are rejected", func(t *testing.T) {
+		err := cli.MultiExec(ctx,
+			redis.Command{Cmd: "GET", Args: redis.List("sessions:1")},
+			redis.Command{Cmd: "GET", Args: redis.List("cache:1")},
+		)
+
+		if e, ok := err.(*resp.Error); !ok || e.Type() != "EXECABORT" {
+			t.Error("bad error:", err)
+		}
+	})
+}
+
+func TestReverseProxySplit(t *testing.T) {
+	var writesA, writesB int32
+
+	newUpstream := func(name string, writes *int32) (*redis.Server, string) {
+		return newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			if req.Cmds[0].Cmd == "SET" {
+				atomic.AddInt32(writes, 1)
+			}
+			res.Write(name)
+		}))
+	}
+
+	upstreamA, upstreamURLA := newUpstream("A", &writesA)
+	defer upstreamA.Close()
+
+	upstreamB, upstreamURLB := newUpstream("B", &writesB)
+	defer upstreamB.Close()
+
+	split := &redis.TrafficSplit{Registry: redis.ServerEndpoint{Addr: upstreamURLB}}
+
+	srv, serverURL := newServer(&redis.ReverseProxy{
+		Transport: &redis.Transport{},
+		Registry:  redis.ServerEndpoint{Addr: upstreamURLA},
+		Routes: []redis.ProxyRoute{
+			{Pattern: "*", Registry: redis.ServerEndpoint{Addr: upstreamURLA}, Split: split},
+		},
+		ErrorLog: log.New(os.Stderr, "proxy split test ==> ", 0),
+	})
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: serverURL, Transport: tr}
+	ctx := context.Background()
+
+	// count returns the number of keys out of 100 that are routed to B.
+	count := func() (n int) {
+		for i := 0; i != 100; i++ {
+			s, err := redis.String(cli.Query(ctx, "GET", "key-"+strconv.Itoa(i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == "B" {
+				n++
+			}
+		}
+		return
+	}
+
+	if n := count(); n != 0 {
+		t.Error("no keys must be routed to the split when the percentage is zero, found", n)
+	}
+
+	split.Percent.Store(50)
+
+	if n := count(); n < 25 || n > 75 {
+		t.Error("about half of the keys must be routed to the split, found", n)
+	}
+
+	if err := split.Ramp(ctx, 100, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(); n != 100 {
+		t.Error("all the keys must be routed to the split when the percentage is 100, found", n)
+	}
+
+	// Durations too short to be divided in steps change the percentage at
+	// once.
+	if err := split.Ramp(ctx, 0, 0); err != nil || split.Percent.Load() != 0 {
+		t.Error("bad percentage after a ramp without duration:", split.Percent.Load(), err)
+	}
+
+	split.Percent.Store(100)
+
+	if err := cli.Exec(ctx, "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, b := atomic.LoadInt32(&writesA), atomic.LoadInt32(&writesB); a != 0 || b != 1 {
+		t.Error("writes must not be mirrored without dual writes:", a, b)
+	}
+
+	split.DualWrite = true
+
+	if err := cli.Exec(ctx, "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes are mirrored after the response was sent to the client.
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	waitFor(t, waitCtx, func() bool { return atomic.LoadInt32(&writesA) == 1 })
+
+	if b := atomic.LoadInt32(&writesB); b != 2 {
+		t.Error("bad number of writes to the split:", b)
+	}
+}
+
+func TestReverseProxyMigration(t *testing.T) {
+	// The mutex is shared by the servers and the test, which reads and
+	// writes their stores directly.
+	var mutex sync.Mutex
+
+	newMapServer := func(store map[string]string) (*redis.Server, string) {
+		exec := func(cmd redis.Command) interface{} {
+			key, val := "", ""
+			ttl := int64(0)
+
+			switch cmd.Cmd {
+			case "GET":
+				cmd.ParseArgs(&key)
+				if v, ok := store[key]; ok {
+					return v
+				}
+				return nil
+			case "MGET":
+				var values []interface{}
+				for cmd.Args.Next(&key) {
+					if v, ok := store[key]; ok {
+						values = append(values, v)
+					} else {
+						values = append(values, nil)
+					}
+				}
+				cmd.Args.Close()
+				return values
+			case "EXISTS":
+				n := int64(0)
+				for cmd.Args.Next(&key) {
+					if _, ok := store[key]; ok {
+						n++
+					}
+				}
+				cmd.Args.Close()
+				return n
+			case "SET":
+				cmd.ParseArgs(&key, &val)
+				store[key] = val
+				return "OK"
+			case "INCR":
+				cmd.ParseArgs(&key)
+				n, _ := strconv.Atoi(store[key])
+				store[key] = strconv.Itoa(n + 1)
+				return int64(n + 1)
+			case "DUMP":
+				cmd.ParseArgs(&key)
+				if v, ok := store[key]; ok {
+					return []byte("dump:" + v)
+				}
+				return nil
+			case "PTTL":
+				cmd.ParseArgs(&key)
+				if _, ok := store[key]; ok {
+					return int64(-1)
+				}
+				return int64(-2)
+			case "RESTORE":
+				cmd.ParseArgs(&key, &ttl, &val)
+				if _, ok := store[key]; ok {
+					return resp.NewError("BUSYKEY Target key name already exists.")
+				}
+				store[key] = val[len("dump:"):]
+				return "OK"
+			default:
+				return resp.NewError("ERR unknown command '" + cmd.Cmd + "'")
+			}
+		}
+
+		return newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if len(req.Cmds) == 1 {
+				res.Write(exec(req.Cmds[0]))
+				return
+			}
+
+			res.WriteStream(len(req.Cmds))
+			for _, cmd := range req.Cmds {
+				res.Write(exec(cmd))
+			}
+		}))
+	}
+
+	oldStore := map[string]string{"counter": "10"}
+	newStore := map[string]string{"counter": "20"}
+
+	load := func(store map[string]string, key string) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return store[key]
+	}
+
+	oldUpstream, oldURL := newMapServer(oldStore)
+	defer oldUpstream.Close()
+
+	newUpstream, newURL := newMapServer(newStore)
+	defer newUpstream.Close()
+
+	migration := &redis.Migration{Registry: redis.ServerEndpoint{Addr: newURL}}
+
+	srv, serverURL := newServer(&redis.ReverseProxy{
+		Transport: &redis.Transport{},
+		Routes: []redis.ProxyRoute{
+			{Pattern: "*", Registry: redis.ServerEndpoint{Addr: oldURL}, Migration: migration},
+		},
+		ErrorLog: log.New(os.Stderr, "proxy migration test ==> ", 0),
+	})
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: serverURL, Transport: tr}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := cli.Exec(ctx, "SET", "A", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, b := load(oldStore, "A"), load(newStore, "A"); a != "1" || b != "1" {
+		t.Error("writes must be sent to both pools:", a, b)
+	}
+
+	mutex.Lock()
+	oldStore["B"] = "2"
+	oldStore["C"] = "3"
+	oldStore["D"] = "4"
+	mutex.Unlock()
+
+	if s, err := redis.String(cli.Query(ctx, "GET", "B")); err != nil || s != "2" {
+		t.Error("reads of keys missing from the new pool must fall back to the old pool:", s, err)
+	}
+
+	// The keys are copied to the new pool in the background.
+	waitFor(t, ctx, func() bool { return migration.Stats().Backfills == 1 })
+
+	if s, err := redis.String(cli.Query(ctx, "GET", "B")); err != nil || s != "2" {
+		t.Error("bad value read after the backfill:", s, err)
+	}
+
+	if b := load(newStore, "B"); b != "2" {
+		t.Error("keys read from the old pool must be copied to the new pool:", b)
+	}
+
+	if n, err := redis.Int(cli.Query(ctx, "EXISTS", "C")); err != nil || n != 1 {
+		t.Error("EXISTS of a key missing from the new pool must fall back to the old pool:", n, err)
+	}
+
+	waitFor(t, ctx, func() bool { return migration.Stats().Backfills == 2 })
+
+	var a, d string
+
+	if err := redis.ParseArgs(cli.Query(ctx, "MGET", "A", "D"), &a, &d); err != nil {
+		t.Error(err)
+	} else if a != "1" || d != "4" {
+		t.Error("MGET of keys missing from the new pool must be served by the old pool:", a, d)
+	}
+
+	if n, err := redis.Int(cli.Query(ctx, "EXISTS", "A", "D")); err != nil || n != 2 {
+		t.Error("EXISTS of keys missing from the new pool must be served by the old pool:", n, err)
+	}
+
+	if n, err := redis.Int(cli.Query(ctx, "INCR", "counter")); err != nil || n != 11 {
+		t.Error("the reply of the old pool must be returned:", n, err)
+	}
+
+	if stats := migration.Stats(); stats != (redis.MigrationStats{Fallbacks: 2, Backfills: 2, Divergences: 1}) {
+		t.Errorf("bad migration stats: %+v", stats)
+	}
+
+	// Writes fail when the new pool is required and unreachable.
+	newUpstream.Close()
+	migration.RequireNew = true
+
+	if err := cli.Exec(ctx, "SET", "E", "5"); err == nil {
+		t.Error("writes must fail when the new pool is required and unreachable")
+	}
+
+	if stats := migration.Stats(); stats.NewWriteErrors != 1 {
+		t.Errorf("bad number of write errors on the new pool: %+v", stats)
+	}
+}
@@ -0,0 +1,48 @@
+package redis
+
+import "context"
+
+// PubSubChannels returns the channels which have subscribers and whose names
+// match pattern, or all of them if pattern is empty, using PUBSUB CHANNELS.
+func (c *Client) PubSubChannels(ctx context.Context, pattern string) ([]string, error) {
+	args := []interface{}{"CHANNELS"}
+
+	if len(pattern) != 0 {
+		args = append(args, pattern)
+	}
+
+	return readStrings(c.Query(ctx, "PUBSUB", args...))
+}
+
+// PubSubNumSub returns the number of subscribers of each of the channels,
+// using PUBSUB NUMSUB.
+func (c *Client) PubSubNumSub(ctx context.Context, channels ...string) (map[string]int64, error) {
+	args := make([]interface{}, 0, 1+len(channels))
+	args = append(args, "NUMSUB")
+
+	for _, channel := range channels {
+		args = append(args, channel)
+	}
+
+	r := c.Query(ctx, "PUBSUB", args...)
+	counts := make(map[string]int64, len(channels))
+
+	for {
+		var channel string
+		var count int64
+
+		if !r.Next(&channel) || !r.Next(&count) {
+			break
+		}
+
+		counts[channel] = count
+	}
+
+	return counts, r.Close()
+}
+
+// PubSubNumPat returns the number of patterns that clients are subscribed to,
+// using PUBSUB NUMPAT.
+func (c *Client) PubSubNumPat(ctx context.Context) (int64, error) {
+	return c.ExecInt(ctx, "PUBSUB", "NUMPAT")
+}
@@ -0,0 +1,89 @@
+package rediscli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+// A Console is a read-eval-print loop which sends the commands it reads to a
+// redis server and prints the replies.
+type Console struct {
+	// Client is used to send commands. If nil, redis.DefaultClient is used.
+	Client *redis.Client
+
+	// Prompt is written before reading each command line. If empty, no prompt
+	// is written, which is usually what programs driving the console want.
+	Prompt string
+}
+
+// Run reads command lines from r until it reaches the end of the input, or
+// reads a "quit" or "exit" command, and writes the replies to w.
+//
+// Empty lines are ignored, lines that fail to parse and errors returned by the
+// server are reported to w and don't interrupt the loop. The method returns
+// an error if reading r or writing w failed, or if the context was canceled.
+func (c *Console) Run(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+
+	for {
+		if len(c.Prompt) != 0 {
+			if _, err := io.WriteString(w, c.Prompt); err != nil {
+				return err
+			}
+		}
+
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		args, err := Split(scanner.Text())
+		if err != nil {
+			if _, err := fmt.Fprintln(w, "Invalid argument(s)"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		switch strings.ToLower(args[0]) {
+		case "quit", "exit":
+			return nil
+		}
+
+		if err := Print(w, c.client().Query(ctx, args[0], toInterfaces(args[1:])...)); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if _, err := fmt.Fprintf(w, "(error) %s\n", err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *Console) client() *redis.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return redis.DefaultClient
+}
+
+func toInterfaces(args []string) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return values
+}
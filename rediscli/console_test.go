@@ -0,0 +1,77 @@
+package rediscli_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+	"github.com/segmentio/redis-go/rediscli"
+)
+
+func TestConsole(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			var key string
+			req.Cmds[0].ParseArgs(&key)
+
+			switch req.Cmds[0].Cmd {
+			case "SET":
+				res.Write("OK")
+			case "GET":
+				res.Write([]byte(key))
+			case "LRANGE":
+				res.Write([][]byte{[]byte("a"), []byte("b")})
+			default:
+				res.Write(resp.NewError("ERR unknown command '" + req.Cmds[0].Cmd + "'"))
+			}
+		}),
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	console := &rediscli.Console{
+		Client: &redis.Client{Addr: l.Addr().String(), Transport: tr},
+	}
+
+	input := strings.Join([]string{
+		`SET key "hello world"`,
+		``,
+		`GET "hello world"`,
+		`LRANGE list 0 -1`,
+		`NOPE`,
+		`GET "unterminated`,
+		`quit`,
+		`GET ignored`,
+	}, "\n")
+
+	output := &bytes.Buffer{}
+
+	if err := console.Run(context.Background(), strings.NewReader(input), output); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		`OK`,
+		`"hello world"`,
+		`1) "a"`,
+		`2) "b"`,
+		`(error) ERR unknown command 'NOPE'`,
+		`Invalid argument(s)`,
+	}, "\n") + "\n"
+
+	if s := output.String(); s != expected {
+		t.Errorf("bad output:\n%s", s)
+	}
+}
@@ -0,0 +1,151 @@
+package rediscli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+// Print reads all values from args and writes them to w in the format used by
+// redis-cli: bulk strings are quoted, integers and nil values are printed as
+// "(integer) 42" and "(nil)", and the elements of arrays are printed one per
+// line prefixed by their index, with nested arrays indented under the index of
+// their parent.
+//
+// Error replies are printed as "(error) ..." and are not returned, Print only
+// returns errors that occurred while reading args for other reasons, or while
+// writing to w.
+//
+// The argument lists of responses don't distinguish between arrays of one
+// element and single values, Print formats both as a single value.
+func Print(w io.Writer, args redis.Args) error {
+	var values []interface{}
+	var value interface{}
+
+	for args.Next(&value) {
+		values = append(values, value)
+		value = nil
+	}
+
+	err := args.Close()
+
+	if e, ok := err.(*resp.Error); ok {
+		_, err = fmt.Fprintf(w, "(error) %s\n", e.Error())
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var s strings.Builder
+
+	if len(values) == 1 {
+		format(&s, values[0], "")
+	} else {
+		format(&s, values, "")
+	}
+
+	_, err = io.WriteString(w, s.String())
+	return err
+}
+
+// Format returns the redis-cli representation of a value decoded from a redis
+// reply into an interface{}, see redis.DecodeOptions for the types of those
+// values.
+func Format(v interface{}) string {
+	var s strings.Builder
+	format(&s, v, "")
+	return s.String()
+}
+
+func format(s *strings.Builder, v interface{}, indent string) {
+	switch x := v.(type) {
+	case nil:
+		s.WriteString("(nil)\n")
+
+	case int64:
+		s.WriteString("(integer) ")
+		s.WriteString(strconv.FormatInt(x, 10))
+		s.WriteByte('\n')
+
+	case int:
+		s.WriteString("(integer) ")
+		s.WriteString(strconv.Itoa(x))
+		s.WriteByte('\n')
+
+	case string: // simple strings, like status replies
+		s.WriteString(x)
+		s.WriteByte('\n')
+
+	case []byte:
+		s.WriteString(quote(x))
+		s.WriteByte('\n')
+
+	case []interface{}:
+		if len(x) == 0 {
+			s.WriteString("(empty array)\n")
+			return
+		}
+
+		width := len(strconv.Itoa(len(x)))
+
+		for i, e := range x {
+			label := strconv.Itoa(i + 1)
+			label = strings.Repeat(" ", width-len(label)) + label + ") "
+
+			if i != 0 {
+				s.WriteString(indent)
+			}
+
+			s.WriteString(label)
+			format(s, e, indent+strings.Repeat(" ", len(label)))
+		}
+
+	case error:
+		s.WriteString("(error) ")
+		s.WriteString(x.Error())
+		s.WriteByte('\n')
+
+	default:
+		fmt.Fprintf(s, "%v\n", x)
+	}
+}
+
+// quote returns a double-quoted representation of b where non-printable bytes
+// are escaped, the output can be parsed back by Split.
+func quote(b []byte) string {
+	s := make([]byte, 0, len(b)+2)
+	s = append(s, '"')
+
+	for _, c := range b {
+		switch c {
+		case '\\', '"':
+			s = append(s, '\\', c)
+		case '\n':
+			s = append(s, '\\', 'n')
+		case '\r':
+			s = append(s, '\\', 'r')
+		case '\t':
+			s = append(s, '\\', 't')
+		case '\a':
+			s = append(s, '\\', 'a')
+		case '\b':
+			s = append(s, '\\', 'b')
+		default:
+			if c >= 0x20 && c < 0x7f {
+				s = append(s, c)
+			} else {
+				s = append(s, '\\', 'x', hex[c>>4], hex[c&0xf])
+			}
+		}
+	}
+
+	return string(append(s, '"'))
+}
+
+const hex = "0123456789abcdef"
@@ -0,0 +1,73 @@
+package rediscli_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/segmentio/redis-go/rediscli"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		scenario string
+		value    interface{}
+		output   string
+	}{
+		{
+			scenario: "nil",
+			value:    nil,
+			output:   "(nil)\n",
+		},
+		{
+			scenario: "integer",
+			value:    int64(42),
+			output:   "(integer) 42\n",
+		},
+		{
+			scenario: "simple string",
+			value:    "OK",
+			output:   "OK\n",
+		},
+		{
+			scenario: "bulk string",
+			value:    []byte("hello\n\"world\"\x00"),
+			output:   `"hello\n\"world\"\x00"` + "\n",
+		},
+		{
+			scenario: "error",
+			value:    errors.New("ERR unknown command"),
+			output:   "(error) ERR unknown command\n",
+		},
+		{
+			scenario: "empty array",
+			value:    []interface{}{},
+			output:   "(empty array)\n",
+		},
+		{
+			scenario: "nested arrays",
+			value: []interface{}{
+				[]byte("a"),
+				[]interface{}{[]byte("b"), nil},
+				int64(1),
+			},
+			output: "1) \"a\"\n2) 1) \"b\"\n   2) (nil)\n3) (integer) 1\n",
+		},
+		{
+			scenario: "indices are aligned",
+			value: []interface{}{
+				int64(1), int64(2), int64(3), int64(4), int64(5),
+				int64(6), int64(7), int64(8), int64(9), int64(10),
+			},
+			output: " 1) (integer) 1\n 2) (integer) 2\n 3) (integer) 3\n 4) (integer) 4\n 5) (integer) 5\n" +
+				" 6) (integer) 6\n 7) (integer) 7\n 8) (integer) 8\n 9) (integer) 9\n10) (integer) 10\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if s := rediscli.Format(test.value); s != test.output {
+				t.Errorf("bad output:\n%s", s)
+			}
+		})
+	}
+}
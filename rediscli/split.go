@@ -0,0 +1,143 @@
+// Package rediscli provides the building blocks of redis-cli like consoles:
+// parsing of command lines, pretty-printing of replies, and a read-eval-print
+// loop which programs can embed to expose an admin console, or to drive test
+// harnesses.
+package rediscli
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidArgs is returned by Split when a command line has unbalanced
+// quotes, or a closing quote which is not followed by a space.
+var ErrInvalidArgs = errors.New("rediscli: invalid argument(s)")
+
+// Split splits a command line into arguments, following the rules of
+// redis-cli:
+//
+// Arguments are separated by spaces. Double-quoted arguments support the \n,
+// \r, \t, \b, \a, \\, \" and \xHH escape sequences, single-quoted arguments
+// only support \'. Quoted arguments must be followed by a space or the end of
+// the line.
+func Split(line string) ([]string, error) {
+	var args []string
+	var i = 0
+
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+
+		if i == len(line) {
+			return args, nil
+		}
+
+		var arg strings.Builder
+		var inDoubleQuotes, inSingleQuotes, done bool
+
+		for !done {
+			switch {
+			case inDoubleQuotes:
+				if i == len(line) {
+					return nil, ErrInvalidArgs // unterminated quotes
+				}
+				switch c := line[i]; {
+				case c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+					arg.WriteByte(unhex(line[i+2])<<4 | unhex(line[i+3]))
+					i += 3
+				case c == '\\' && i+1 < len(line):
+					i++
+					arg.WriteByte(unescape(line[i]))
+				case c == '"':
+					// closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, ErrInvalidArgs
+					}
+					done = true
+				default:
+					arg.WriteByte(c)
+				}
+
+			case inSingleQuotes:
+				if i == len(line) {
+					return nil, ErrInvalidArgs // unterminated quotes
+				}
+				switch c := line[i]; {
+				case c == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+					arg.WriteByte('\'')
+				case c == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, ErrInvalidArgs
+					}
+					done = true
+				default:
+					arg.WriteByte(c)
+				}
+
+			default:
+				if i == len(line) {
+					done = true
+					continue
+				}
+				switch c := line[i]; c {
+				case ' ', '\n', '\r', '\t', 0:
+					done = true
+				case '"':
+					inDoubleQuotes = true
+				case '\'':
+					inSingleQuotes = true
+				default:
+					arg.WriteByte(c)
+				}
+			}
+
+			if i < len(line) {
+				i++
+			}
+		}
+
+		args = append(args, arg.String())
+	}
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\n', '\r', '\t', '\v', '\f':
+		return true
+	}
+	return false
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	default:
+		return c
+	}
+}
@@ -0,0 +1,43 @@
+package rediscli_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/redis-go/rediscli"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		line string
+		args []string
+		fail bool
+	}{
+		{line: "", args: nil},
+		{line: "   ", args: nil},
+		{line: "GET key", args: []string{"GET", "key"}},
+		{line: "  SET  key   value ", args: []string{"SET", "key", "value"}},
+		{line: `SET key "hello world"`, args: []string{"SET", "key", "hello world"}},
+		{line: `SET key "a\nb\x41\"c"`, args: []string{"SET", "key", "a\nbA\"c"}},
+		{line: `SET key 'it\'s \n'`, args: []string{"SET", "key", `it's \n`}},
+		{line: `SET key ""`, args: []string{"SET", "key", ""}},
+		{line: `SET key "unterminated`, fail: true},
+		{line: `SET key 'unterminated`, fail: true},
+		{line: `SET key "value"suffix`, fail: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			args, err := rediscli.Split(test.line)
+
+			switch {
+			case test.fail && err == nil:
+				t.Error("expected an error but got", args)
+			case !test.fail && err != nil:
+				t.Error(err)
+			case !test.fail && !reflect.DeepEqual(args, test.args):
+				t.Errorf("bad arguments: %q", args)
+			}
+		})
+	}
+}
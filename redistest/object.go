@@ -0,0 +1,30 @@
+package redistest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+// AssertEncoding reports a test error if the internal encoding of key, as
+// returned by OBJECT ENCODING, is not the expected one. It is intended to be
+// used in tests which verify that data structures keep a compact encoding
+// (like "listpack" or "intset") under a given workload.
+func AssertEncoding(t testing.TB, client *redis.Client, key string, encoding string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	info, err := client.ObjectInfo(ctx, key)
+	if err != nil {
+		t.Errorf("fetching the encoding of %q: %s", key, err)
+		return
+	}
+
+	if info.Encoding != encoding {
+		t.Errorf("bad encoding of %q: %s != %s", key, info.Encoding, encoding)
+	}
+}
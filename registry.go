@@ -20,6 +20,10 @@ type ServerBlacklist interface {
 type ServerEndpoint struct {
 	Name string
 	Addr string
+
+	// Zone is an optional label of the zone or region that the server runs
+	// in, it is used to prefer servers that are close to the client.
+	Zone string
 }
 
 // LookupServers satisfies the ServerRegistry interface.
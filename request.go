@@ -54,3 +54,9 @@ func (req *Request) Close() error {
 func (req *Request) IsTransaction() bool {
 	return len(req.Cmds) == 0 || req.Cmds[0].Cmd == "MULTI"
 }
+
+// IsPipeline returns true if the request carries multiple commands which are
+// not sent as a transaction, false otherwise.
+func (req *Request) IsPipeline() bool {
+	return len(req.Cmds) > 1 && !req.IsTransaction()
+}
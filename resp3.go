@@ -0,0 +1,429 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+// negotiateRESP3 switches the connection to RESP3 with a HELLO 3 command. The
+// package decodes RESP2, so the replies received on the connection are then
+// translated back to RESP2 as they are read, and push messages are passed to
+// push instead of being returned as replies.
+//
+// Servers which don't support RESP3 reply with an error and the connection
+// keeps using RESP2, which the translation leaves unchanged. The method
+// returns whether the server accepted to use RESP3.
+func (c *Conn) negotiateRESP3(push func([]interface{})) (bool, error) {
+	// The reply to HELLO 3 is already a RESP3 map, the translation must be in
+	// place before it is read.
+	if r, ok := c.conn.(*resp3Conn); ok {
+		r.push = push
+	} else {
+		c.conn = newRESP3Conn(c.conn, push)
+		c.rbuffer.Reset(c.conn)
+	}
+
+	if err := c.WriteCommands(Command{Cmd: "HELLO", Args: List(3)}); err != nil {
+		return false, err
+	}
+
+	switch err := c.ReadArgs().Close(); err.(type) {
+	case nil:
+		return true, nil
+	case *resp.Error:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// errHelloUnsupported is returned when setting up a connection to a server
+// which closed the connection or didn't reply to HELLO 3.
+var errHelloUnsupported = errors.New("redis: the server doesn't support HELLO")
+
+// resp3RetryInterval is how long the transport remembers that an address
+// doesn't support RESP3, HELLO is attempted again after that in case the
+// server was upgraded.
+const resp3RetryInterval = 10 * time.Minute
+
+// negotiateRESP3 switches conn to RESP3, recording the protocol used with the
+// address. The method returns errHelloUnsupported if the connection can't be
+// used anymore because the server closed it or didn't reply in time.
+func (t *Transport) negotiateRESP3(ctx context.Context, conn *Conn, address string) error {
+	push := func([]interface{}) {}
+
+	if onPush := t.OnPush; onPush != nil {
+		push = func(msg []interface{}) { onPush(address, msg) }
+	}
+
+	// Proxies which don't know HELLO may never reply, the wait is bounded by
+	// the ping timeout unless the context expires earlier.
+	deadline := time.Now().Add(t.pingTimeout())
+	ctxDeadline, hasDeadline := ctx.Deadline()
+	expires := hasDeadline && !ctxDeadline.After(deadline)
+
+	if expires {
+		deadline = ctxDeadline
+	}
+
+	conn.SetDeadline(deadline)
+	ok, err := conn.negotiateRESP3(push)
+
+	if hasDeadline {
+		conn.SetDeadline(ctxDeadline)
+	} else {
+		conn.SetDeadline(time.Time{})
+	}
+
+	switch ErrorClass(err) {
+	case ErrClassNone:
+		t.protocols.store(address, ok)
+		return nil
+	case ErrClassTimeout:
+		if expires {
+			return err
+		}
+	case ErrClassServerClosed:
+	default:
+		return err
+	}
+
+	t.protocols.store(address, false)
+	return errHelloUnsupported
+}
+
+// protocolCache records the version of the protocol used with each address.
+type protocolCache struct {
+	mutex     sync.Mutex
+	protocols map[string]protocolEntry
+}
+
+type protocolEntry struct {
+	version int
+	time    time.Time
+}
+
+// tryRESP3 returns whether HELLO 3 should be sent on new connections to
+// address.
+func (c *protocolCache) tryRESP3(address string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.protocols[address]
+	return !ok || entry.version == 3 || time.Since(entry.time) > resp3RetryInterval
+}
+
+func (c *protocolCache) store(address string, resp3 bool) {
+	entry := protocolEntry{version: 2, time: time.Now()}
+	if resp3 {
+		entry.version = 3
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.protocols == nil {
+		c.protocols = make(map[string]protocolEntry)
+	}
+
+	c.protocols[address] = entry
+}
+
+func (c *protocolCache) load() map[string]int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	protocols := make(map[string]int, len(c.protocols))
+
+	for address, entry := range c.protocols {
+		protocols[address] = entry.version
+	}
+
+	return protocols
+}
+
+// resp3Conn is a net.Conn which translates the RESP3 data it reads to RESP2:
+//
+//	maps are translated to arrays of key/value pairs
+//	sets are translated to arrays
+//	nulls are translated to nil bulk strings
+//	booleans are translated to the integers 1 and 0
+//	doubles and big numbers are translated to bulk strings
+//	verbatim strings are translated to bulk strings, without their format
+//	blob errors are translated to simple errors
+//	attributes are discarded
+//
+// Push messages are passed to push, or translated to arrays if push is nil.
+// The data of bulk strings is streamed through without being buffered.
+//
+// Read errors, including timeouts, are not recoverable.
+type resp3Conn struct {
+	net.Conn
+	r    *bufio.Reader
+	push func([]interface{})
+	out  []byte // translated data which wasn't read yet
+	blob int    // number of bytes of a bulk string left to stream through
+	skip int    // number of bytes to discard before streaming the bulk string
+}
+
+func newRESP3Conn(c net.Conn, push func([]interface{})) *resp3Conn {
+	return &resp3Conn{
+		Conn: c,
+		r:    bufio.NewReader(c),
+		push: push,
+	}
+}
+
+func (c *resp3Conn) Read(b []byte) (int, error) {
+	for {
+		if len(c.out) != 0 {
+			n := copy(b, c.out)
+			c.out = c.out[n:]
+			return n, nil
+		}
+
+		if c.skip != 0 {
+			n, err := c.r.Discard(c.skip)
+			c.skip -= n
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		if c.blob != 0 {
+			if len(b) > c.blob {
+				b = b[:c.blob]
+			}
+			n, err := c.r.Read(b)
+			c.blob -= n
+			return n, err
+		}
+
+		if err := c.translate(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// translate reads the next header line and produces its translation in c.out.
+func (c *resp3Conn) translate() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+
+	if len(line) == 0 {
+		return errResp3Protocol(line)
+	}
+
+	switch data := line[1:]; line[0] {
+	case '+', '-', ':', '*':
+		c.out = appendLine(c.out[:0], line[0], string(data))
+
+	case '$':
+		c.out = appendLine(c.out[:0], line[0], string(data))
+		if n, _ := strconv.Atoi(string(data)); n >= 0 {
+			c.blob = n + 2
+		}
+
+	case '=':
+		n, err := strconv.Atoi(string(data))
+		if err != nil || n < 4 {
+			return errResp3Protocol(line)
+		}
+		// Verbatim strings start with their format, like "txt:".
+		c.out = appendLine(c.out[:0], '$', strconv.Itoa(n-4))
+		c.skip, c.blob = 4, n-4+2
+
+	case '%':
+		n, err := strconv.Atoi(string(data))
+		if err != nil {
+			return errResp3Protocol(line)
+		}
+		c.out = appendLine(c.out[:0], '*', strconv.Itoa(2*n))
+
+	case '~':
+		c.out = appendLine(c.out[:0], '*', string(data))
+
+	case '_':
+		c.out = append(c.out[:0], "$-1\r\n"...)
+
+	case '#':
+		if string(data) == "t" {
+			c.out = append(c.out[:0], ":1\r\n"...)
+		} else {
+			c.out = append(c.out[:0], ":0\r\n"...)
+		}
+
+	case ',', '(':
+		c.out = appendLine(c.out[:0], '$', strconv.Itoa(len(data)))
+		c.out = append(c.out, data...)
+		c.out = append(c.out, '\r', '\n')
+
+	case '!':
+		v, err := c.readBlob(data)
+		if err != nil {
+			return err
+		}
+		// Simple errors cannot span multiple lines.
+		msg := bytes.Replace(bytes.Replace(v, []byte("\r"), nil, -1), []byte("\n"), []byte(" "), -1)
+		c.out = appendLine(c.out[:0], '-', string(msg))
+
+	case '|':
+		n, err := strconv.Atoi(string(data))
+		if err != nil {
+			return errResp3Protocol(line)
+		}
+		for i := 0; i != 2*n; i++ {
+			if _, err := c.readValue(); err != nil {
+				return err
+			}
+		}
+
+	case '>':
+		n, err := strconv.Atoi(string(data))
+		if err != nil {
+			return errResp3Protocol(line)
+		}
+		if c.push == nil {
+			c.out = appendLine(c.out[:0], '*', string(data))
+			break
+		}
+		msg := make([]interface{}, n)
+		for i := range msg {
+			if msg[i], err = c.readValue(); err != nil {
+				return err
+			}
+		}
+		c.push(msg)
+
+	default:
+		return errResp3Protocol(line)
+	}
+
+	return nil
+}
+
+// readValue reads a whole value, strings are returned as []byte, integers as
+// int64, booleans as bool, errors as *resp.Error, and aggregates as
+// []interface{}.
+func (c *resp3Conn) readValue() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, errResp3Protocol(line)
+	}
+
+	// The line is only valid until the next read, its type is saved for when
+	// the value spans multiple lines.
+	typ, data := line[0], line[1:]
+
+	switch typ {
+	case '+', ',', '(':
+		return []byte(string(data)), nil
+
+	case '-':
+		return resp.NewError(string(data)), nil
+
+	case ':':
+		return strconv.ParseInt(string(data), 10, 64)
+
+	case '#':
+		return string(data) == "t", nil
+
+	case '_':
+		return nil, nil
+
+	case '$', '=', '!':
+		if string(data) == "-1" {
+			return nil, nil
+		}
+		v, err := c.readBlob(data)
+		if err != nil {
+			return nil, err
+		}
+		if typ == '=' && len(v) >= 4 {
+			v = v[4:]
+		}
+		if typ == '!' {
+			return resp.NewError(string(v)), nil
+		}
+		return v, nil
+
+	case '*', '~', '>', '%', '|':
+		n, err := strconv.Atoi(string(data))
+		if err != nil {
+			return nil, errResp3Protocol(line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if typ == '%' || typ == '|' {
+			n *= 2
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.readValue(); err != nil {
+				return nil, err
+			}
+		}
+		if typ == '|' {
+			// Attributes are followed by the value they describe.
+			return c.readValue()
+		}
+		return values, nil
+
+	default:
+		return nil, errResp3Protocol(line)
+	}
+}
+
+func (c *resp3Conn) readBlob(size []byte) ([]byte, error) {
+	n, err := strconv.Atoi(string(size))
+	if err != nil || n < 0 {
+		return nil, errResp3Protocol(size)
+	}
+	b := make([]byte, n+2)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
+
+// readLine reads a line terminated by CRLF, the returned line excludes the
+// terminator and is only valid until the next read.
+func (c *resp3Conn) readLine() ([]byte, error) {
+	line, err := c.r.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			err = errResp3Protocol(line)
+		}
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errResp3Protocol(line)
+	}
+	return line[:len(line)-2], nil
+}
+
+func appendLine(b []byte, typ byte, data string) []byte {
+	b = append(b, typ)
+	b = append(b, data...)
+	return append(b, '\r', '\n')
+}
+
+func errResp3Protocol(line []byte) error {
+	return fmt.Errorf("redis: invalid RESP3 data: %q", line)
+}
@@ -9,7 +9,8 @@ type Response struct {
 	Args Args
 
 	// TxArgs is the argument list of response to requests that were sent as
-	// transactions.
+	// transactions or pipelines, see Request.IsTransaction and
+	// Request.IsPipeline.
 	TxArgs TxArgs
 
 	// Request is the request that was sent to obtain this Response.
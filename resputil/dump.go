@@ -0,0 +1,230 @@
+// Package resputil provides tools to inspect the RESP traffic exchanged by
+// redis clients and servers, intended to help debugging protocol issues.
+package resputil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strconv"
+)
+
+// Dump writes a structured representation of the RESP frames in frame to w,
+// using a Dumper with the default settings.
+func Dump(w io.Writer, frame []byte) error {
+	return (&Dumper{}).Dump(w, frame)
+}
+
+// A Dumper writes structured representations of RESP frames, one value per
+// line with the elements of arrays indented under their array, for example:
+//
+//	*2
+//	  $3 "GET"
+//	  $3 "key"
+//
+// Incomplete or malformed trailing data, which is expected when dumping
+// arbitrary chunks of network traffic, is written as a quoted string after a
+// "(incomplete)" or "(malformed)" marker.
+type Dumper struct {
+	// MaxBytes is the maximum number of bytes of bulk strings written, longer
+	// strings are truncated and the number of bytes omitted is reported. Zero
+	// means DefaultMaxBytes, negative values mean no limit.
+	MaxBytes int
+
+	// MaxElements is the maximum number of elements of arrays written, the
+	// number of elements omitted is reported. Zero means DefaultMaxElements,
+	// negative values mean no limit.
+	MaxElements int
+
+	// Hex, when true, writes a hex dump of the raw bytes after the structured
+	// representation. The hex dump is truncated to MaxBytes.
+	Hex bool
+}
+
+const (
+	// DefaultMaxBytes is the default value of Dumper.MaxBytes.
+	DefaultMaxBytes = 64
+
+	// DefaultMaxElements is the default value of Dumper.MaxElements.
+	DefaultMaxElements = 16
+)
+
+// Dump writes the structured representation of the RESP frames in frame to w.
+func (d *Dumper) Dump(w io.Writer, frame []byte) error {
+	buf := &bytes.Buffer{}
+	tmp := &bytes.Buffer{}
+
+	for i := 0; i < len(frame); {
+		// Values are dumped to a temporary buffer first so nothing is written
+		// for values that turn out to be incomplete or malformed.
+		tmp.Reset()
+		n, err := d.dumpValue(tmp, frame[i:], 0, true)
+		if err != nil {
+			buf.WriteString("(")
+			buf.WriteString(err.Error())
+			buf.WriteString(") ")
+			buf.WriteString(quote(frame[i:], d.maxBytes()))
+			buf.WriteString("\n")
+			break
+		}
+		buf.Write(tmp.Bytes())
+		i += n
+	}
+
+	if d.Hex {
+		b := frame
+		if max := d.maxBytes(); max >= 0 && len(b) > max {
+			b = b[:max]
+		}
+		buf.WriteString(hex.Dump(b))
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type dumpError string
+
+func (e dumpError) Error() string { return string(e) }
+
+const (
+	errIncomplete = dumpError("incomplete")
+	errMalformed  = dumpError("malformed")
+)
+
+// dumpValue writes the value at the beginning of b, returning the number of
+// bytes it spans. When print is false the value is only skipped.
+func (d *Dumper) dumpValue(buf *bytes.Buffer, b []byte, depth int, print bool) (int, error) {
+	line, n, err := readLine(b)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(line) == 0 {
+		return 0, errMalformed
+	}
+
+	indent := func() {
+		for i := 0; i != depth; i++ {
+			buf.WriteString("  ")
+		}
+	}
+
+	switch line[0] {
+	case '+', '-', ':':
+		if print {
+			indent()
+			buf.Write(line)
+			buf.WriteString("\n")
+		}
+		return n, nil
+
+	case '$':
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < -1 {
+			return 0, errMalformed
+		}
+
+		if size == -1 {
+			if print {
+				indent()
+				buf.WriteString("$-1\n")
+			}
+			return n, nil
+		}
+
+		if len(b) < n+size+2 {
+			return 0, errIncomplete
+		}
+
+		if b[n+size] != '\r' || b[n+size+1] != '\n' {
+			return 0, errMalformed
+		}
+
+		if print {
+			indent()
+			buf.Write(line)
+			buf.WriteString(" ")
+			buf.WriteString(quote(b[n:n+size], d.maxBytes()))
+			buf.WriteString("\n")
+		}
+		return n + size + 2, nil
+
+	case '*':
+		count, err := strconv.Atoi(string(line[1:]))
+		if err != nil || count < -1 {
+			return 0, errMalformed
+		}
+
+		if print {
+			indent()
+			buf.Write(line)
+			buf.WriteString("\n")
+		}
+
+		max := d.maxElements()
+
+		for i := 0; i < count; i++ {
+			printElem := print && (max < 0 || i < max)
+
+			m, err := d.dumpValue(buf, b[n:], depth+1, printElem)
+			if err != nil {
+				return 0, err
+			}
+
+			n += m
+		}
+
+		if print && max >= 0 && count > max {
+			indent()
+			buf.WriteString("  ... (+")
+			buf.WriteString(strconv.Itoa(count - max))
+			buf.WriteString(" elements)\n")
+		}
+
+		return n, nil
+
+	default:
+		return 0, errMalformed
+	}
+}
+
+func (d *Dumper) maxBytes() int {
+	if d.MaxBytes == 0 {
+		return DefaultMaxBytes
+	}
+	return d.MaxBytes
+}
+
+func (d *Dumper) maxElements() int {
+	if d.MaxElements == 0 {
+		return DefaultMaxElements
+	}
+	return d.MaxElements
+}
+
+func readLine(b []byte) ([]byte, int, error) {
+	i := bytes.Index(b, []byte("\r\n"))
+	if i < 0 {
+		return nil, 0, errIncomplete
+	}
+	return b[:i], i + 2, nil
+}
+
+// quote returns a quoted representation of b, truncated to max bytes if max
+// is not negative.
+func quote(b []byte, max int) string {
+	var omitted int
+
+	if max >= 0 && len(b) > max {
+		omitted, b = len(b)-max, b[:max]
+	}
+
+	s := strconv.Quote(string(b))
+
+	if omitted != 0 {
+		s += "... (+" + strconv.Itoa(omitted) + " bytes)"
+	}
+
+	return s
+}
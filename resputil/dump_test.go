@@ -0,0 +1,85 @@
+package resputil_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/redis-go/resputil"
+)
+
+func TestDump(t *testing.T) {
+	tests := []struct {
+		scenario string
+		dumper   resputil.Dumper
+		frame    string
+		output   string
+	}{
+		{
+			scenario: "simple values",
+			frame:    "+OK\r\n-ERR oops\r\n:42\r\n$-1\r\n",
+			output:   "+OK\n-ERR oops\n:42\n$-1\n",
+		},
+		{
+			scenario: "commands",
+			frame:    "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$6\r\nva\r\nue\r\n",
+			output:   "*3\n  $3 \"SET\"\n  $3 \"key\"\n  $6 \"va\\r\\nue\"\n",
+		},
+		{
+			scenario: "nested arrays",
+			frame:    "*2\r\n*1\r\n:1\r\n*0\r\n",
+			output:   "*2\n  *1\n    :1\n  *0\n",
+		},
+		{
+			scenario: "long bulk strings are truncated",
+			dumper:   resputil.Dumper{MaxBytes: 4},
+			frame:    "$10\r\n0123456789\r\n",
+			output:   "$10 \"0123\"... (+6 bytes)\n",
+		},
+		{
+			scenario: "long arrays are truncated",
+			dumper:   resputil.Dumper{MaxElements: 2},
+			frame:    "*4\r\n:1\r\n:2\r\n:3\r\n:4\r\n+OK\r\n",
+			output:   "*4\n  :1\n  :2\n  ... (+2 elements)\n+OK\n",
+		},
+		{
+			scenario: "incomplete frames",
+			frame:    "+OK\r\n*2\r\n$3\r\nGE",
+			output:   "+OK\n(incomplete) \"*2\\r\\n$3\\r\\nGE\"\n",
+		},
+		{
+			scenario: "malformed frames",
+			frame:    "hello\r\n",
+			output:   "(malformed) \"hello\\r\\n\"\n",
+		},
+		{
+			scenario: "hex dump",
+			dumper:   resputil.Dumper{Hex: true},
+			frame:    "+OK\r\n",
+			output:   "+OK\n00000000  2b 4f 4b 0d 0a                                    |+OK..|\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+
+			if err := test.dumper.Dump(buf, []byte(test.frame)); err != nil {
+				t.Fatal(err)
+			}
+
+			if s := buf.String(); s != test.output {
+				t.Errorf("bad output:\n%s", s)
+			}
+		})
+	}
+}
+
+func TestDumpDefaults(t *testing.T) {
+	buf := &bytes.Buffer{}
+	resputil.Dump(buf, []byte("$100\r\n"+strings.Repeat("x", 100)+"\r\n"))
+
+	if s := buf.String(); !strings.HasSuffix(s, "... (+36 bytes)\n") {
+		t.Errorf("bad output:\n%s", s)
+	}
+}
@@ -0,0 +1,85 @@
+package resputil
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+// A WireLogger dumps the traffic of the connections it wraps. It is typically
+// set on a redis.Transport or redis.Server to debug protocol interoperability
+// issues.
+//
+// Each chunk of data read or written is dumped separately, so values split
+// across multiple network reads are reported as incomplete.
+type WireLogger struct {
+	// Output is where the traffic is dumped. If nil, os.Stderr is used.
+	Output io.Writer
+
+	// Dumper is used to format the traffic.
+	Dumper Dumper
+
+	mutex sync.Mutex
+}
+
+// Conn wraps c so data read from and written to the connection are dumped by
+// the logger. Each line of the dumps is prefixed with the local and remote
+// addresses of the connection, and the direction of the traffic.
+func (l *WireLogger) Conn(c net.Conn) net.Conn {
+	laddr, raddr := c.LocalAddr().String(), c.RemoteAddr().String()
+	return &wireConn{
+		Conn:        c,
+		logger:      l,
+		readPrefix:  laddr + " <- " + raddr + " | ",
+		writePrefix: laddr + " -> " + raddr + " | ",
+	}
+}
+
+func (l *WireLogger) log(prefix string, data []byte) {
+	buf := &bytes.Buffer{}
+	l.Dumper.Dump(buf, data)
+
+	out := &bytes.Buffer{}
+
+	for _, line := range bytes.SplitAfter(buf.Bytes(), []byte("\n")) {
+		if len(line) != 0 {
+			out.WriteString(prefix)
+			out.Write(line)
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	w := l.Output
+	if w == nil {
+		w = os.Stderr
+	}
+
+	w.Write(out.Bytes())
+}
+
+type wireConn struct {
+	net.Conn
+	logger      *WireLogger
+	readPrefix  string
+	writePrefix string
+}
+
+func (c *wireConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.logger.log(c.readPrefix, b[:n])
+	}
+	return n, err
+}
+
+func (c *wireConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.logger.log(c.writePrefix, b[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,69 @@
+package resputil_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+	"github.com/segmentio/redis-go/resputil"
+)
+
+func TestWireLogger(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			res.Write("OK")
+		}),
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	out := &syncBuffer{}
+	tr := &redis.Transport{
+		WireLogger: &resputil.WireLogger{Output: out},
+	}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: l.Addr().String(), Transport: tr}
+
+	if err := cli.Exec(context.Background(), "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := out.String()
+
+	for _, line := range []string{
+		" -> " + l.Addr().String() + " | *3\n",
+		" -> " + l.Addr().String() + " |   $5 \"world\"\n",
+		" <- " + l.Addr().String() + " | +OK\n",
+	} {
+		if !strings.Contains(s, line) {
+			t.Errorf("missing line %q in the wire log:\n%s", line, s)
+		}
+	}
+}
+
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
@@ -0,0 +1,216 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRetryRatio is the default value of RetryBudget.Ratio.
+	DefaultRetryRatio = 0.1
+
+	// DefaultRetryBurst is the default value of RetryBudget.Burst.
+	DefaultRetryBurst = 10
+)
+
+// A RetryBudget limits the number of retries to a fraction of the number of
+// requests, so retry policies cannot amplify an outage into a retry storm.
+//
+// The budget is a token bucket: every request deposits Ratio tokens, and every
+// retry withdraws one token. Retries are refused when the bucket is empty.
+//
+// The zero-value is a valid budget using DefaultRetryRatio and
+// DefaultRetryBurst. Budgets are safe to use concurrently from multiple
+// goroutines, and are intended to be shared by all requests of a Client.
+type RetryBudget struct {
+	// Ratio is the maximum number of retries per request, for example 0.1
+	// allows one retry every ten requests. If zero, DefaultRetryRatio is used.
+	Ratio float64
+
+	// Burst is the number of retries allowed before any requests were made,
+	// and the maximum number of retries that the budget accumulates. If zero,
+	// DefaultRetryBurst is used.
+	Burst int
+
+	mutex  sync.Mutex
+	tokens float64
+	init   bool
+}
+
+// Deposit records that a request was made, crediting the budget.
+func (b *RetryBudget) Deposit() {
+	b.mutex.Lock()
+	b.setup()
+
+	if b.tokens += b.ratio(); b.tokens > float64(b.burst()) {
+		b.tokens = float64(b.burst())
+	}
+
+	b.mutex.Unlock()
+}
+
+// Withdraw returns true and debits the budget if a retry is allowed, false
+// otherwise.
+func (b *RetryBudget) Withdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.setup()
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+func (b *RetryBudget) setup() {
+	if !b.init {
+		b.init = true
+		b.tokens = float64(b.burst())
+	}
+}
+
+func (b *RetryBudget) ratio() float64 {
+	if b.Ratio > 0 {
+		return b.Ratio
+	}
+	return DefaultRetryRatio
+}
+
+func (b *RetryBudget) burst() int {
+	if b.Burst > 0 {
+		return b.Burst
+	}
+	return DefaultRetryBurst
+}
+
+const (
+	// DefaultRetryMaxAttempts is the default value of RetryPolicy.MaxAttempts.
+	DefaultRetryMaxAttempts = 3
+
+	// DefaultRetryMinBackoff is the default value of RetryPolicy.MinBackoff.
+	DefaultRetryMinBackoff = 10 * time.Millisecond
+
+	// DefaultRetryMaxBackoff is the default value of RetryPolicy.MaxBackoff.
+	DefaultRetryMaxBackoff = 1 * time.Second
+)
+
+// A RetryPolicy configures the retries of a Client, so programs don't have to
+// wrap their calls in retry loops to survive transient failures like
+// reconnections, failovers, or servers restarting:
+//
+//	client := &redis.Client{
+//		Addr:        "localhost:6379",
+//		RetryPolicy: &redis.RetryPolicy{MaxAttempts: 5},
+//	}
+//
+// Retries are still subject to the RetryBudget of the client. The zero-value
+// is a valid policy using the defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of each request, including
+	// the first one. If zero, DefaultRetryMaxAttempts is used.
+	MaxAttempts int
+
+	// MinBackoff is the delay before the first retry, it doubles on each
+	// retry up to MaxBackoff. The delays are randomized between half and the
+	// full value to spread the retries of concurrent requests. If zero,
+	// DefaultRetryMinBackoff is used.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between retries. If zero,
+	// DefaultRetryMaxBackoff is used.
+	MaxBackoff time.Duration
+
+	// Retryable, if not nil, decides whether a command which failed with err
+	// is retried. If nil, DefaultRetryable is used.
+	Retryable func(cmd string, err error) bool
+}
+
+// DefaultRetryable is the default classification of retryable errors of retry
+// policies. Commands are retried when they can't have run on the server:
+// the connection couldn't be established, or the server refused the command
+// because it was loading its dataset or the cluster was down. Read-only
+// commands are also retried after network errors, timeouts, and connections
+// closed by the server, since running them twice has no side effects.
+func DefaultRetryable(cmd string, err error) bool {
+	if isDialError(err) {
+		return true
+	}
+
+	switch ErrorClass(err) {
+	case ErrClassConnRefused, ErrClassLoading, ErrClassClusterDown:
+		return true
+	case ErrClassUnknown, ErrClassTimeout, ErrClassProtocol, ErrClassServerClosed:
+		return ClassOf(cmd) == ClassRead
+	default:
+		return false
+	}
+}
+
+func isDialError(err error) bool {
+	var e *net.OpError
+	return errors.As(err, &e) && e.Op == "dial"
+}
+
+func (p *RetryPolicy) retryable(cmd string, err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(cmd, err)
+	}
+	return DefaultRetryable(cmd, err)
+}
+
+// wait sleeps for the backoff delay of the given attempt, returning false if
+// ctx expired in the meantime.
+func (p *RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timer := time.NewTimer(p.backoff(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.maxBackoff()
+
+	if attempt < 32 {
+		if b := p.minBackoff() << uint(attempt); b > 0 && b < d {
+			d = b
+		}
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+	return DefaultRetryMaxAttempts
+}
+
+func (p *RetryPolicy) minBackoff() time.Duration {
+	if p.MinBackoff > 0 {
+		return p.MinBackoff
+	}
+	return DefaultRetryMinBackoff
+}
+
+func (p *RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff > 0 {
+		return p.MaxBackoff
+	}
+	return DefaultRetryMaxBackoff
+}
@@ -0,0 +1,274 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+type failingTransport struct {
+	redis.RoundTripper
+	failures int
+	attempts int
+}
+
+func (t *failingTransport) RoundTrip(req *redis.Request) (*redis.Response, error) {
+	if t.attempts++; t.attempts <= t.failures {
+		req.Close()
+		return nil, errors.New("connection reset by peer")
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := &redis.RetryBudget{Ratio: 0.5, Burst: 2}
+
+	if !budget.Withdraw() || !budget.Withdraw() {
+		t.Fatal("the burst of the budget must allow retries before any requests")
+	}
+
+	if budget.Withdraw() {
+		t.Fatal("the budget must be exhausted after the burst")
+	}
+
+	budget.Deposit()
+
+	if budget.Withdraw() {
+		t.Error("half a token must not allow a retry")
+	}
+
+	budget.Deposit()
+	budget.Deposit()
+
+	if !budget.Withdraw() {
+		t.Error("one token must allow a retry")
+	}
+
+	for i := 0; i != 100; i++ {
+		budget.Deposit()
+	}
+
+	if !budget.Withdraw() || !budget.Withdraw() || budget.Withdraw() {
+		t.Error("the budget must not accumulate more than its burst")
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	tests := []struct {
+		scenario string
+		cmd      string
+		failures int
+		budget   *redis.RetryBudget
+		attempts int
+		success  bool
+	}{
+		{
+			scenario: "read-only commands are retried",
+			cmd:      "GET",
+			failures: 2,
+			attempts: 3,
+			success:  true,
+		},
+		{
+			scenario: "retries stop after the configured limit",
+			cmd:      "GET",
+			failures: 5,
+			attempts: 4,
+			success:  false,
+		},
+		{
+			scenario: "write commands are not retried",
+			cmd:      "SET",
+			failures: 1,
+			attempts: 1,
+			success:  false,
+		},
+		{
+			scenario: "retries stop when the budget is exhausted",
+			cmd:      "GET",
+			failures: 5,
+			budget:   &redis.RetryBudget{Burst: 1},
+			attempts: 2,
+			success:  false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			ft := &failingTransport{RoundTripper: tr, failures: test.failures}
+			cli := &redis.Client{
+				Addr:        url,
+				Transport:   ft,
+				Retries:     3,
+				RetryBudget: test.budget,
+			}
+
+			err := cli.Exec(context.Background(), test.cmd, "key")
+
+			if test.success && err != nil {
+				t.Error(err)
+			}
+
+			if !test.success && err == nil {
+				t.Error("expected an error but got nil")
+			}
+
+			if ft.attempts != test.attempts {
+				t.Error("bad number of attempts:", ft.attempts)
+			}
+		})
+	}
+}
+
+func TestClientRetryPolicy(t *testing.T) {
+	var mutex sync.Mutex
+	var errors int
+	var reply string
+
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		if cmd == "CLIENT" {
+			return "" // setup commands of the transport
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if errors > 0 {
+			errors--
+			return reply
+		}
+		return "+OK\r\n"
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	tests := []struct {
+		scenario  string
+		cmd       string
+		reply     string
+		errors    int
+		failures  int
+		retryable func(string, error) bool
+		attempts  int
+		class     redis.ErrClass
+	}{
+		{
+			scenario: "write commands are retried while the server is loading",
+			cmd:      "SET",
+			reply:    "-LOADING Redis is loading the dataset in memory\r\n",
+			errors:   2,
+			attempts: 3,
+		},
+		{
+			scenario: "write commands are retried while the cluster is down",
+			cmd:      "SET",
+			reply:    "-CLUSTERDOWN The cluster is down\r\n",
+			errors:   1,
+			attempts: 2,
+		},
+		{
+			scenario: "retries stop after the maximum number of attempts",
+			cmd:      "GET",
+			reply:    "-LOADING Redis is loading the dataset in memory\r\n",
+			errors:   5,
+			attempts: 3,
+			class:    redis.ErrClassLoading,
+		},
+		{
+			scenario: "other errors returned by the server are not retried",
+			cmd:      "GET",
+			reply:    "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+			errors:   1,
+			attempts: 1,
+			class:    redis.ErrClassServer,
+		},
+		{
+			scenario: "read-only commands are retried after network errors",
+			cmd:      "GET",
+			failures: 2,
+			attempts: 3,
+		},
+		{
+			scenario: "write commands are not retried after network errors",
+			cmd:      "SET",
+			failures: 1,
+			attempts: 1,
+			class:    redis.ErrClassUnknown,
+		},
+		{
+			scenario:  "the policy uses the custom classification of errors",
+			cmd:       "SET",
+			failures:  1,
+			retryable: func(string, error) bool { return true },
+			attempts:  2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			mutex.Lock()
+			errors, reply = test.errors, test.reply
+			mutex.Unlock()
+
+			ft := &failingTransport{RoundTripper: tr, failures: test.failures}
+			cli := &redis.Client{
+				Addr:      addr,
+				Transport: ft,
+				RetryPolicy: &redis.RetryPolicy{
+					MinBackoff: time.Millisecond,
+					MaxBackoff: 5 * time.Millisecond,
+					Retryable:  test.retryable,
+				},
+			}
+
+			err := cli.Exec(context.Background(), test.cmd, "key")
+
+			switch {
+			case test.class == redis.ErrClassNone && err != nil:
+				t.Error(err)
+			case test.class != redis.ErrClassNone && redis.ErrorClass(err) != test.class:
+				t.Errorf("bad error class: %v (%v)", redis.ErrorClass(err), err)
+			}
+
+			if ft.attempts != test.attempts {
+				t.Error("bad number of attempts:", ft.attempts)
+			}
+		})
+	}
+
+	t.Run("canceling the context interrupts the backoff", func(t *testing.T) {
+		mutex.Lock()
+		errors, reply = 1, "-LOADING Redis is loading the dataset in memory\r\n"
+		mutex.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		cli := &redis.Client{
+			Addr:        addr,
+			Transport:   tr,
+			RetryPolicy: &redis.RetryPolicy{MinBackoff: 10 * time.Second, MaxBackoff: 10 * time.Second},
+		}
+
+		start := time.Now()
+
+		if err := cli.Exec(ctx, "SET", "key", "value"); redis.ErrorClass(err) != redis.ErrClassLoading {
+			t.Error("bad error:", err)
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Error("the backoff was not interrupted:", elapsed)
+		}
+	})
+}
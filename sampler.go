@@ -0,0 +1,237 @@
+package redis
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Sampler is a Handler which records the commands of one request in Every,
+// with their arguments, in a ring buffer retrievable with Samples. It answers
+// the question of what exactly clients are sending to a server or a proxy in
+// production, at a bounded cost:
+//
+//	sampler := &redis.Sampler{
+//		Handler: proxy,
+//		Every:   1000,
+//	}
+//
+// Arguments are truncated to MaxArgLen bytes and commands to MaxArgs arguments,
+// and the arguments carrying secrets are redacted before they are recorded.
+type Sampler struct {
+	// Handler is the handler that requests are passed to.
+	Handler Handler
+
+	// Every is the sampling interval, one request in Every is recorded. If
+	// zero, DefaultSampleEvery is used, set to 1 to record all requests.
+	Every int
+
+	// Size is the number of samples kept by the ring buffer, the oldest ones
+	// are discarded. If zero, DefaultSampleSize is used.
+	Size int
+
+	// MaxArgs is the maximum number of arguments recorded for each command,
+	// the extra arguments are counted but not recorded. If zero,
+	// DefaultSampleMaxArgs is used.
+	MaxArgs int
+
+	// MaxArgLen is the maximum length of arguments recorded, longer values are
+	// truncated. If zero, DefaultSampleMaxArgLen is used.
+	MaxArgLen int
+
+	// Redact, if not nil, is called with the upper-case name and the
+	// arguments of sampled commands, it replaces the arguments which must not
+	// be recorded. If nil, RedactSecrets is used.
+	Redact func(cmd string, args []string)
+
+	count   uint64
+	mutex   sync.Mutex
+	samples []Sample
+	next    int
+}
+
+const (
+	// DefaultSampleEvery is the default value of Sampler.Every.
+	DefaultSampleEvery = 100
+
+	// DefaultSampleSize is the default value of Sampler.Size.
+	DefaultSampleSize = 100
+
+	// DefaultSampleMaxArgs is the default value of Sampler.MaxArgs.
+	DefaultSampleMaxArgs = 16
+
+	// DefaultSampleMaxArgLen is the default value of Sampler.MaxArgLen.
+	DefaultSampleMaxArgLen = 64
+)
+
+// Sample is a request recorded by a Sampler.
+type Sample struct {
+	Time time.Time
+	Addr string
+	Cmds []SampledCommand
+}
+
+// SampledCommand is a command of a request recorded by a Sampler.
+type SampledCommand struct {
+	Cmd  string
+	Args []string
+
+	// Truncated is the number of arguments which were not recorded because
+	// the command had more than MaxArgs arguments.
+	Truncated int
+}
+
+// ServeRedis satisfies the Handler interface.
+func (s *Sampler) ServeRedis(res ResponseWriter, req *Request) {
+	if n := atomic.AddUint64(&s.count, 1); n%uint64(s.every()) == 0 {
+		s.record(req)
+	}
+	s.Handler.ServeRedis(res, req)
+}
+
+// Samples returns the samples recorded by s, from the oldest to the most
+// recent.
+func (s *Sampler) Samples() []Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	samples := make([]Sample, 0, len(s.samples))
+	samples = append(samples, s.samples[s.next:]...)
+	samples = append(samples, s.samples[:s.next]...)
+	return samples
+}
+
+// record loads the arguments of req in memory, so they can be read again by
+// the handler, and adds the request to the ring buffer.
+func (s *Sampler) record(req *Request) {
+	sample := Sample{
+		Time: time.Now(),
+		Addr: req.Addr,
+		Cmds: make([]SampledCommand, len(req.Cmds)),
+	}
+
+	for i := range req.Cmds {
+		cmd := &req.Cmds[i]
+		cmd.loadByteArgs()
+
+		name := strings.ToUpper(cmd.Cmd)
+		sampled := SampledCommand{Cmd: name}
+
+		if args, ok := cmd.Args.(*byteArgs); ok {
+			for j, arg := range args.args {
+				if j == s.maxArgs() {
+					sampled.Truncated = len(args.args) - j
+					break
+				}
+				if len(arg) > s.maxArgLen() {
+					arg = arg[:s.maxArgLen()]
+				}
+				sampled.Args = append(sampled.Args, string(arg))
+			}
+		}
+
+		s.redact(name, sampled.Args)
+
+		sample.Cmds[i] = sampled
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if size := s.size(); len(s.samples) < size {
+		s.samples = append(s.samples, sample)
+	} else {
+		s.samples[s.next] = sample
+		s.next = (s.next + 1) % size
+	}
+}
+
+func (s *Sampler) redact(cmd string, args []string) {
+	if s.Redact != nil {
+		s.Redact(cmd, args)
+	} else {
+		RedactSecrets(cmd, args)
+	}
+}
+
+func (s *Sampler) every() int {
+	if s.Every > 0 {
+		return s.Every
+	}
+	return DefaultSampleEvery
+}
+
+func (s *Sampler) size() int {
+	if s.Size > 0 {
+		return s.Size
+	}
+	return DefaultSampleSize
+}
+
+func (s *Sampler) maxArgs() int {
+	if s.MaxArgs > 0 {
+		return s.MaxArgs
+	}
+	return DefaultSampleMaxArgs
+}
+
+func (s *Sampler) maxArgLen() int {
+	if s.MaxArgLen > 0 {
+		return s.MaxArgLen
+	}
+	return DefaultSampleMaxArgLen
+}
+
+// RedactSecrets is the default redaction function of samplers, it replaces the
+// credentials passed to AUTH, HELLO, MIGRATE and ACL SETUSER, and the values
+// passed to CONFIG SET, with "(redacted)".
+func RedactSecrets(cmd string, args []string) {
+	redact := func(i int) {
+		if i < len(args) {
+			args[i] = redacted
+		}
+	}
+
+	switch cmd {
+	case "AUTH":
+		for i := range args {
+			redact(i)
+		}
+
+	case "HELLO", "MIGRATE":
+		for i, arg := range args {
+			// HELLO AUTH <username> <password>
+			// MIGRATE ... AUTH <password>
+			// MIGRATE ... AUTH2 <username> <password>
+			switch strings.ToUpper(arg) {
+			case "AUTH":
+				if cmd == "HELLO" {
+					redact(i + 2)
+				} else {
+					redact(i + 1)
+				}
+			case "AUTH2":
+				redact(i + 2)
+			}
+		}
+
+	case "CONFIG":
+		if len(args) != 0 && strings.EqualFold(args[0], "SET") {
+			for i := 2; i < len(args); i += 2 {
+				redact(i)
+			}
+		}
+
+	case "ACL":
+		if len(args) != 0 && strings.EqualFold(args[0], "SETUSER") {
+			for i, arg := range args[1:] {
+				if strings.HasPrefix(arg, ">") || strings.HasPrefix(arg, "#") {
+					redact(i + 1)
+				}
+			}
+		}
+	}
+}
+
+const redacted = "(redacted)"
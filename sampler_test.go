@@ -0,0 +1,131 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestSampler(t *testing.T) {
+	values := make(chan string, 10)
+
+	sampler := &redis.Sampler{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			// The handler must receive the arguments of sampled requests.
+			var args []string
+			var arg string
+			for req.Cmds[0].Args.Next(&arg) {
+				args = append(args, arg)
+			}
+			values <- strings.Join(args, " ")
+			res.Write("OK")
+		}),
+		Every:     2,
+		Size:      2,
+		MaxArgs:   2,
+		MaxArgLen: 4,
+	}
+
+	srv, url := newServer(sampler)
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+	ctx := context.Background()
+
+	requests := [][]interface{}{
+		{"SET", "A", "1"},
+		{"SET", "B", "hello world"},
+		{"GET", "C"},
+		{"AUTH", "user", "secret"},
+		{"GET", "D"},
+		{"MSET", "E", "1", "F", "2"},
+	}
+
+	for _, r := range requests {
+		if err := cli.Exec(ctx, r[0].(string), r[1:]...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if v := <-values; v != "A 1" {
+		t.Errorf("bad arguments received by the handler: %q", v)
+	}
+
+	if v := <-values; v != "B hello world" {
+		t.Errorf("bad arguments of a sampled request received by the handler: %q", v)
+	}
+
+	samples := sampler.Samples()
+	cmds := make([]redis.SampledCommand, len(samples))
+
+	for i, s := range samples {
+		if len(s.Cmds) != 1 || s.Time.IsZero() || len(s.Addr) == 0 {
+			t.Fatalf("bad sample: %+v", s)
+		}
+		cmds[i] = s.Cmds[0]
+	}
+
+	// The two most recent samples are kept, the arguments are truncated and
+	// the credentials redacted.
+	expect := []redis.SampledCommand{
+		{Cmd: "AUTH", Args: []string{"(redacted)", "(redacted)"}},
+		{Cmd: "MSET", Args: []string{"E", "1"}, Truncated: 2},
+	}
+
+	if !reflect.DeepEqual(cmds, expect) {
+		t.Errorf("bad samples:\n%+v\n%+v", cmds, expect)
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		args   []string
+		expect []string
+	}{
+		{
+			args:   []string{"GET", "key"},
+			expect: []string{"GET", "key"},
+		},
+		{
+			args:   []string{"AUTH", "secret"},
+			expect: []string{"AUTH", "(redacted)"},
+		},
+		{
+			args:   []string{"HELLO", "3", "AUTH", "user", "secret"},
+			expect: []string{"HELLO", "3", "AUTH", "user", "(redacted)"},
+		},
+		{
+			args:   []string{"MIGRATE", "host", "6379", "key", "0", "1000", "AUTH", "secret"},
+			expect: []string{"MIGRATE", "host", "6379", "key", "0", "1000", "AUTH", "(redacted)"},
+		},
+		{
+			args:   []string{"MIGRATE", "host", "6379", "key", "0", "1000", "AUTH2", "user", "secret"},
+			expect: []string{"MIGRATE", "host", "6379", "key", "0", "1000", "AUTH2", "user", "(redacted)"},
+		},
+		{
+			args:   []string{"CONFIG", "SET", "requirepass", "secret", "maxmemory", "1gb"},
+			expect: []string{"CONFIG", "SET", "requirepass", "(redacted)", "maxmemory", "(redacted)"},
+		},
+		{
+			args:   []string{"ACL", "SETUSER", "user", "on", ">secret", "~*"},
+			expect: []string{"ACL", "SETUSER", "user", "on", "(redacted)", "~*"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.args[0], func(t *testing.T) {
+			args := append([]string{}, test.args[1:]...)
+			redis.RedactSecrets(test.args[0], args)
+
+			if !reflect.DeepEqual(args, test.expect[1:]) {
+				t.Errorf("bad redacted arguments: %q", args)
+			}
+		})
+	}
+}
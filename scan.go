@@ -0,0 +1,116 @@
+package redis
+
+import "context"
+
+// A Scanner iterates over the elements returned by one of the SCAN, HSCAN,
+// SSCAN or ZSCAN commands, sending new commands with the cursor of the
+// previous reply until the iteration is complete:
+//
+//	it := client.Scan(ctx, "user:*", 100)
+//
+//	for key := ""; it.Next(&key); {
+//		...
+//	}
+//
+//	if err := it.Close(); err != nil {
+//		...
+//	}
+//
+// The guarantees of the commands apply, elements may be returned more than
+// once and elements added or removed during the iteration may be missed.
+type Scanner struct {
+	client *Client
+	ctx    context.Context
+	cmd    string
+	key    string
+	match  string
+	count  int
+
+	cursor string
+	batch  []string
+	done   bool
+	err    error
+}
+
+// Scan returns a Scanner over the keys matching the glob-style pattern match,
+// or all keys if match is empty, using SCAN. The count is passed as the COUNT
+// hint of the commands when it's not zero.
+func (c *Client) Scan(ctx context.Context, match string, count int) *Scanner {
+	return c.scanner(ctx, "SCAN", "", match, count)
+}
+
+// HScan returns a Scanner over the fields of the hash at key and their values,
+// using HSCAN. Fields and values are returned by consecutive calls to Next.
+func (c *Client) HScan(ctx context.Context, key, match string, count int) *Scanner {
+	return c.scanner(ctx, "HSCAN", key, match, count)
+}
+
+// SScan returns a Scanner over the members of the set at key, using SSCAN.
+func (c *Client) SScan(ctx context.Context, key, match string, count int) *Scanner {
+	return c.scanner(ctx, "SSCAN", key, match, count)
+}
+
+// ZScan returns a Scanner over the members of the sorted set at key and their
+// scores, using ZSCAN. Members and scores are returned by consecutive calls to
+// Next.
+func (c *Client) ZScan(ctx context.Context, key, match string, count int) *Scanner {
+	return c.scanner(ctx, "ZSCAN", key, match, count)
+}
+
+func (c *Client) scanner(ctx context.Context, cmd, key, match string, count int) *Scanner {
+	return &Scanner{
+		client: c,
+		ctx:    ctx,
+		cmd:    cmd,
+		key:    key,
+		match:  match,
+		count:  count,
+		cursor: "0",
+	}
+}
+
+// Next reads the next element of the iteration into dst, returning false when
+// the iteration is complete or an error occurred.
+func (s *Scanner) Next(dst *string) bool {
+	for len(s.batch) == 0 {
+		if s.done || s.err != nil {
+			return false
+		}
+		s.err = s.scan()
+	}
+
+	*dst, s.batch = s.batch[0], s.batch[1:]
+	return true
+}
+
+// Close stops the iteration, returning the error that occurred while sending
+// the commands, if any.
+func (s *Scanner) Close() error {
+	s.batch, s.done = nil, true
+	return s.err
+}
+
+func (s *Scanner) scan() error {
+	args := make([]interface{}, 0, 6)
+
+	if s.cmd != "SCAN" {
+		args = append(args, s.key)
+	}
+
+	args = append(args, s.cursor)
+
+	if len(s.match) != 0 {
+		args = append(args, "MATCH", s.match)
+	}
+
+	if s.count != 0 {
+		args = append(args, "COUNT", s.count)
+	}
+
+	if err := ParseArgs(s.client.Query(s.ctx, s.cmd, args...), &s.cursor, &s.batch); err != nil {
+		return err
+	}
+
+	s.done = s.cursor == "0"
+	return nil
+}
@@ -0,0 +1,118 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestScanner(t *testing.T) {
+	var mutex sync.Mutex
+	var commands []string
+
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		if cmd == "CLIENT" {
+			return "" // setup commands of the transport
+		}
+
+		mutex.Lock()
+		commands = append(commands, strings.Join(append([]string{cmd}, args...), " "))
+		mutex.Unlock()
+
+		if cmd != "SCAN" {
+			args = args[1:]
+		}
+
+		switch args[0] {
+		case "0":
+			return "*2\r\n$2\r\n17\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n"
+		case "17":
+			// Empty batches don't end the iteration.
+			return "*2\r\n$2\r\n42\r\n*0\r\n"
+		case "42":
+			return "*2\r\n$1\r\n0\r\n*1\r\n$1\r\nc\r\n"
+		default:
+			return "-ERR invalid cursor\r\n"
+		}
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+
+	tests := []struct {
+		scenario string
+		function func(context.Context) *redis.Scanner
+		commands []string
+	}{
+		{
+			scenario: "Scan",
+			function: func(ctx context.Context) *redis.Scanner { return cli.Scan(ctx, "", 0) },
+			commands: []string{"SCAN 0", "SCAN 17", "SCAN 42"},
+		},
+		{
+			scenario: "Scan with a pattern and a count",
+			function: func(ctx context.Context) *redis.Scanner { return cli.Scan(ctx, "k*", 10) },
+			commands: []string{"SCAN 0 MATCH k* COUNT 10", "SCAN 17 MATCH k* COUNT 10", "SCAN 42 MATCH k* COUNT 10"},
+		},
+		{
+			scenario: "HScan",
+			function: func(ctx context.Context) *redis.Scanner { return cli.HScan(ctx, "H", "", 0) },
+			commands: []string{"HSCAN H 0", "HSCAN H 17", "HSCAN H 42"},
+		},
+		{
+			scenario: "SScan",
+			function: func(ctx context.Context) *redis.Scanner { return cli.SScan(ctx, "S", "", 5) },
+			commands: []string{"SSCAN S 0 COUNT 5", "SSCAN S 17 COUNT 5", "SSCAN S 42 COUNT 5"},
+		},
+		{
+			scenario: "ZScan",
+			function: func(ctx context.Context) *redis.Scanner { return cli.ZScan(ctx, "Z", "m*", 0) },
+			commands: []string{"ZSCAN Z 0 MATCH m*", "ZSCAN Z 17 MATCH m*", "ZSCAN Z 42 MATCH m*"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			mutex.Lock()
+			commands = nil
+			mutex.Unlock()
+
+			it := test.function(context.Background())
+
+			var elems []string
+			for elem := ""; it.Next(&elem); {
+				elems = append(elems, elem)
+			}
+
+			if err := it.Close(); err != nil {
+				t.Error(err)
+			}
+
+			if !reflect.DeepEqual(elems, []string{"a", "b", "c"}) {
+				t.Error("bad elements:", elems)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if !reflect.DeepEqual(commands, test.commands) {
+				t.Errorf("bad commands: %q != %q", commands, test.commands)
+			}
+		})
+	}
+
+	t.Run("Close stops the iteration", func(t *testing.T) {
+		it := cli.HScan(context.Background(), "H", "", 0)
+		it.Close()
+
+		if it.Next(new(string)) {
+			t.Error("the iteration continued after Close")
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultClassWeights are the weights used by the proxy to schedule requests
+// when ReverseProxy.ClassWeights is nil.
+var DefaultClassWeights = map[CommandClass]int{
+	ClassRead:  4,
+	ClassWrite: 2,
+	ClassAdmin: 1,
+}
+
+// scheduler limits the number of requests in flight to a single upstream, and
+// dispatches queued requests with a smooth weighted round-robin over command
+// classes, so that no class can starve the others when the upstream is
+// saturated.
+type scheduler struct {
+	mutex    sync.Mutex
+	limit    int
+	inflight int
+	weights  [numCommandClasses]int
+	credits  [numCommandClasses]int
+	queues   [numCommandClasses][]chan struct{}
+}
+
+func newScheduler(limit int, weights map[CommandClass]int) *scheduler {
+	s := &scheduler{limit: limit}
+
+	if weights == nil {
+		weights = DefaultClassWeights
+	}
+
+	for class := range s.weights {
+		if w := weights[CommandClass(class)]; w > 0 {
+			s.weights[class] = w
+		} else {
+			s.weights[class] = 1
+		}
+	}
+
+	return s
+}
+
+// acquire blocks until a request of the given class can be sent upstream, or
+// ctx is canceled.
+func (s *scheduler) acquire(ctx context.Context, class CommandClass) error {
+	s.mutex.Lock()
+
+	if s.inflight < s.limit && s.queued() == 0 {
+		s.inflight++
+		s.mutex.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	s.queues[class] = append(s.queues[class], ready)
+	s.mutex.Unlock()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, c := range s.queues[class] {
+		if c == ready {
+			s.queues[class] = append(s.queues[class][:i], s.queues[class][i+1:]...)
+			return ctx.Err()
+		}
+	}
+
+	// The slot was handed to us concurrently with the cancellation, pass it
+	// on to the next request.
+	s.next()
+	return ctx.Err()
+}
+
+// release gives back a slot acquired by a previous call to acquire.
+func (s *scheduler) release() {
+	s.mutex.Lock()
+	s.next()
+	s.mutex.Unlock()
+}
+
+// next hands the slot of a completed request to a queued one, or frees it if
+// no requests are waiting. The mutex must be held when calling the method.
+func (s *scheduler) next() {
+	best, total := -1, 0
+
+	for class, queue := range s.queues {
+		if len(queue) != 0 {
+			s.credits[class] += s.weights[class]
+			total += s.weights[class]
+
+			if best < 0 || s.credits[class] > s.credits[best] {
+				best = class
+			}
+		}
+	}
+
+	if best < 0 {
+		s.inflight--
+		return
+	}
+
+	s.credits[best] -= total
+	close(s.queues[best][0])
+	s.queues[best] = s.queues[best][1:]
+}
+
+// idle returns true if no requests are in flight or queued.
+func (s *scheduler) idle() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.inflight == 0 && s.queued() == 0
+}
+
+func (s *scheduler) queued() (n int) {
+	for _, queue := range s.queues {
+		n += len(queue)
+	}
+	return
+}
@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScheduler(t *testing.T) {
+	s := newScheduler(1, map[CommandClass]int{
+		ClassRead:  3,
+		ClassWrite: 1,
+	})
+
+	if err := s.acquire(context.Background(), ClassWrite); err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan CommandClass, 8)
+	queue := func(class CommandClass) {
+		ready := make(chan struct{})
+		s.mutex.Lock()
+		s.queues[class] = append(s.queues[class], ready)
+		s.mutex.Unlock()
+		go func() { <-ready; order <- class }()
+	}
+
+	for i := 0; i != 4; i++ {
+		queue(ClassWrite)
+		queue(ClassRead)
+	}
+
+	var reads, writes int
+
+	for i := 0; i != 4; i++ {
+		s.release()
+
+		switch <-order {
+		case ClassRead:
+			reads++
+		case ClassWrite:
+			writes++
+		}
+	}
+
+	if reads != 3 || writes != 1 {
+		t.Errorf("bad distribution of dequeued requests: reads=%d writes=%d", reads, writes)
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	s := newScheduler(1, nil)
+
+	if err := s.acquire(context.Background(), ClassRead); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.acquire(ctx, ClassRead); err != context.Canceled {
+		t.Error("bad error:", err)
+	}
+
+	s.release()
+
+	if s.inflight != 0 || s.queued() != 0 {
+		t.Errorf("the scheduler was not reset: inflight=%d queued=%d", s.inflight, s.queued())
+	}
+}
@@ -0,0 +1,178 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"sync"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+// A Script is a Lua script run on redis servers with EVALSHA, so its body is
+// only sent to servers which don't have it in their script cache:
+//
+//	var incrBy = redis.NewScript(`
+//		return redis.call('INCRBY', KEYS[1], ARGV[1])
+//	`)
+//
+//	n, err := incrBy.ExecInt(ctx, client, []string{"counter"}, 42)
+//
+// When the client uses a Transport, the transport remembers the scripts loaded
+// on each host, the first time a script is run on a host it is loaded with
+// SCRIPT LOAD. Servers answering NOSCRIPT, because they were restarted or
+// their script cache was flushed, get the script loaded again, and EVAL is
+// used when SCRIPT LOAD isn't permitted.
+//
+// Scripts are safe to use concurrently from multiple goroutines.
+type Script struct {
+	src  string
+	hash string
+}
+
+// NewScript returns a Script running the Lua code in src.
+func NewScript(src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	return &Script{src: src, hash: hex.EncodeToString(sum[:])}
+}
+
+// Hash returns the SHA1 digest of the script, as passed to EVALSHA.
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+// Source returns the Lua code of the script.
+func (s *Script) Source() string {
+	return s.src
+}
+
+// Load loads the script in the script cache of the server that client sends
+// requests to, using SCRIPT LOAD.
+func (s *Script) Load(ctx context.Context, client *Client) error {
+	if err := client.Exec(ctx, "SCRIPT", "LOAD", s.src); err != nil {
+		return err
+	}
+	if cache := scriptCacheOf(client); cache != nil {
+		cache.add(clientAddr(client), s.hash)
+		client.loadedScript(s.hash)
+	}
+	return nil
+}
+
+// Query runs the script with keys and args, returning the reply of the script.
+//
+// Any error occurring while running the script is returned by the Close method
+// of the returned value.
+func (s *Script) Query(ctx context.Context, client *Client, keys []string, args ...interface{}) Args {
+	cache := scriptCacheOf(client)
+	addr := clientAddr(client)
+
+	// Without a cache of the scripts loaded on the host, EVALSHA is always
+	// attempted first.
+	if cache == nil || cache.loaded(addr, s.hash) {
+		r := client.Query(ctx, "EVALSHA", s.args(s.hash, keys, args)...)
+
+		if NextType(r) != TypeError {
+			return r
+		}
+
+		err := r.Close()
+
+		if !isNoScript(err) {
+			return newArgsError(err)
+		}
+
+		cache.remove(addr, s.hash)
+	}
+
+	if s.Load(ctx, client) != nil {
+		return client.Query(ctx, "EVAL", s.args(s.src, keys, args)...)
+	}
+
+	return client.Query(ctx, "EVALSHA", s.args(s.hash, keys, args)...)
+}
+
+// Exec is like Query but discards the reply of the script.
+func (s *Script) Exec(ctx context.Context, client *Client, keys []string, args ...interface{}) error {
+	return ParseArgs(s.Query(ctx, client, keys, args...), nil)
+}
+
+// ExecInt is like Exec but returns the integer reply of the script.
+func (s *Script) ExecInt(ctx context.Context, client *Client, keys []string, args ...interface{}) (int64, error) {
+	var i int64
+	err := ParseArgs(s.Query(ctx, client, keys, args...), &i)
+	return i, err
+}
+
+func (s *Script) args(script string, keys []string, args []interface{}) []interface{} {
+	list := make([]interface{}, 0, 2+len(keys)+len(args))
+	list = append(list, script, len(keys))
+	list = append(list, stringArgs(keys)...)
+	list = append(list, args...)
+	return list
+}
+
+func isNoScript(err error) bool {
+	e, ok := err.(*resp.Error)
+	return ok && e.Type() == "NOSCRIPT"
+}
+
+func clientAddr(client *Client) string {
+	if len(client.Addr) == 0 {
+		return "localhost:6379"
+	}
+	return client.Addr
+}
+
+func scriptCacheOf(client *Client) *scriptCache {
+	if t, ok := client.transport().(*Transport); ok {
+		return &t.scripts
+	}
+	return nil
+}
+
+// scriptCache records the hashes of the scripts loaded on each host. The
+// methods are safe to call on nil caches.
+type scriptCache struct {
+	mutex sync.RWMutex
+	hosts map[string]map[string]struct{}
+}
+
+func (c *scriptCache) loaded(addr, hash string) bool {
+	if c == nil {
+		return false
+	}
+	c.mutex.RLock()
+	_, ok := c.hosts[addr][hash]
+	c.mutex.RUnlock()
+	return ok
+}
+
+func (c *scriptCache) add(addr, hash string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.hosts == nil {
+		c.hosts = make(map[string]map[string]struct{})
+	}
+
+	hashes := c.hosts[addr]
+	if hashes == nil {
+		hashes = make(map[string]struct{})
+		c.hosts[addr] = hashes
+	}
+
+	hashes[hash] = struct{}{}
+}
+
+func (c *scriptCache) remove(addr, hash string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	delete(c.hosts[addr], hash)
+	c.mutex.Unlock()
+}
@@ -0,0 +1,126 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestScript(t *testing.T) {
+	script := redis.NewScript("return redis.call('INCRBY', KEYS[1], ARGV[1])")
+
+	if hash := script.Hash(); hash != "8cd00688c05c46bde4a2e60658ef20a2e5c0b248" {
+		t.Fatal("bad hash:", hash)
+	}
+
+	var mutex sync.Mutex
+	var commands []string
+	var loaded = map[string]bool{}
+	var denyLoad bool
+
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		if cmd == "CLIENT" {
+			return "" // setup commands of the transport
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		commands = append(commands, cmd)
+
+		switch cmd {
+		case "SCRIPT":
+			if denyLoad {
+				return "-NOPERM this user has no permissions to run the 'script|load' command\r\n"
+			}
+			loaded[script.Hash()] = true
+			return fmt.Sprintf("$40\r\n%s\r\n", script.Hash())
+		case "EVALSHA":
+			if !loaded[args[0]] {
+				return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+			}
+			return ":42\r\n"
+		case "EVAL":
+			if args[0] != script.Source() || args[1] != "1" || args[2] != "counter" {
+				return "-ERR bad arguments\r\n"
+			}
+			return ":42\r\n"
+		default:
+			return "-ERR unknown command\r\n"
+		}
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+
+	tests := []struct {
+		scenario string
+		setup    func()
+		commands []string
+	}{
+		{
+			scenario: "the script is loaded the first time it runs on a host",
+			commands: []string{"SCRIPT", "EVALSHA"},
+		},
+		{
+			scenario: "the script is run with EVALSHA once it was loaded",
+			commands: []string{"EVALSHA"},
+		},
+		{
+			scenario: "the script is loaded again after the server answered NOSCRIPT",
+			setup:    func() { delete(loaded, script.Hash()) },
+			commands: []string{"EVALSHA", "SCRIPT", "EVALSHA"},
+		},
+		{
+			scenario: "the script is run with EVAL when it cannot be loaded",
+			setup: func() {
+				delete(loaded, script.Hash())
+				denyLoad = true
+			},
+			commands: []string{"EVALSHA", "SCRIPT", "EVAL"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			mutex.Lock()
+			commands = nil
+			if test.setup != nil {
+				test.setup()
+			}
+			mutex.Unlock()
+
+			n, err := script.ExecInt(context.Background(), cli, []string{"counter"}, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 42 {
+				t.Error("bad result:", n)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if !reflect.DeepEqual(commands, test.commands) {
+				t.Errorf("bad commands: %q != %q", commands, test.commands)
+			}
+		})
+	}
+
+	t.Run("errors of the script are returned", func(t *testing.T) {
+		mutex.Lock()
+		loaded[script.Hash()] = true
+		mutex.Unlock()
+
+		other := redis.NewScript("return redis.error_reply('oops')")
+
+		if err := other.Exec(context.Background(), cli, nil); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
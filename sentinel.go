@@ -0,0 +1,235 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrMasterNotFound is returned when none of the sentinels knows the master of
+// a Sentinel registry.
+var ErrMasterNotFound = errors.New("redis: no sentinel knows the address of the master")
+
+// Sentinel is a ServerRegistry which exposes the master of a redis deployment
+// monitored by sentinels.
+//
+// The address of the master is resolved with SENTINEL get-master-addr-by-name
+// on the first lookup, and updated when the sentinels announce a failover on
+// their +switch-master channel. The registry also satisfies the
+// TopologyRefresher interface, so it can be used as the primary of a
+// FailoverTransport, which is how clients are configured to follow the master:
+//
+//	sentinel := &redis.Sentinel{
+//		Addrs:      []string{"10.0.0.1:26379", "10.0.0.2:26379", "10.0.0.3:26379"},
+//		MasterName: "mymaster",
+//	}
+//
+//	client := &redis.Client{
+//		Transport: &redis.FailoverTransport{Primary: sentinel},
+//	}
+//
+// Requests made after a failover are sent to the new master, connections to the
+// previous master are not reused. Programs should call Close when they don't
+// need the registry anymore.
+type Sentinel struct {
+	// Addrs is the list of addresses of the sentinels, they are contacted in
+	// order until one of them responds.
+	Addrs []string
+
+	// MasterName is the name of the master monitored by the sentinels.
+	MasterName string
+
+	// Transport is used to query and subscribe to the sentinels. If nil,
+	// DefaultTransport is used if it's a *Transport, or a transport with the
+	// default configuration otherwise.
+	Transport *Transport
+
+	// RetryInterval is the time waited before subscribing again to a sentinel
+	// after the subscription was lost. If zero, one second is used.
+	RetryInterval time.Duration
+
+	once   sync.Once
+	mutex  sync.Mutex
+	master string
+	cancel context.CancelFunc
+	closed bool
+}
+
+// LookupServers satisfies the ServerRegistry interface, it returns the current
+// master.
+func (s *Sentinel) LookupServers(ctx context.Context) ([]ServerEndpoint, error) {
+	s.once.Do(s.start)
+
+	s.mutex.Lock()
+	master, closed := s.master, s.closed
+	s.mutex.Unlock()
+
+	if closed {
+		return nil, errors.New("redis: LookupServers called on a closed sentinel registry")
+	}
+
+	if len(master) == 0 {
+		if err := s.RefreshTopology(ctx); err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		master = s.master
+		s.mutex.Unlock()
+	}
+
+	return []ServerEndpoint{{Name: s.MasterName, Addr: master}}, nil
+}
+
+// RefreshTopology asks the sentinels for the address of the master.
+//
+// The method satisfies the TopologyRefresher interface.
+func (s *Sentinel) RefreshTopology(ctx context.Context) error {
+	err := ErrMasterNotFound
+
+	for _, addr := range s.Addrs {
+		var master string
+
+		if master, err = s.getMasterAddr(ctx, addr); err == nil {
+			s.setMaster(master)
+			return nil
+		}
+	}
+
+	return err
+}
+
+// Close stops watching the sentinels for failovers.
+func (s *Sentinel) Close() error {
+	s.once.Do(func() {})
+
+	s.mutex.Lock()
+	cancel := s.cancel
+	s.cancel, s.closed = nil, true
+	s.mutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	return nil
+}
+
+func (s *Sentinel) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.watch(ctx)
+}
+
+// watch subscribes to the +switch-master channel of the sentinels, one at a
+// time, and updates the master when a failover is announced.
+func (s *Sentinel) watch(ctx context.Context) {
+	for i := 0; ctx.Err() == nil; i++ {
+		if len(s.Addrs) != 0 {
+			s.subscribe(ctx, s.Addrs[i%len(s.Addrs)])
+		}
+
+		timer := time.NewTimer(s.retryInterval())
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+}
+
+func (s *Sentinel) subscribe(ctx context.Context, addr string) {
+	network, address := splitNetworkAddress(addr)
+
+	sub, err := s.transport().Subscribe(ctx, network, address, "+switch-master")
+	if err != nil {
+		return
+	}
+	defer sub.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+		case <-done:
+		}
+	}()
+
+	// Failovers may have happened while the registry wasn't subscribed.
+	if master, err := s.getMasterAddr(ctx, addr); err == nil {
+		s.setMaster(master)
+	}
+
+	for {
+		_, msg, err := sub.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// The message is made of the master name, and the addresses of the
+		// previous and new masters: <name> <old ip> <old port> <ip> <port>
+		if fields := strings.Fields(string(msg)); len(fields) == 5 && fields[0] == s.MasterName {
+			s.setMaster(net.JoinHostPort(fields[3], fields[4]))
+		}
+	}
+}
+
+func (s *Sentinel) getMasterAddr(ctx context.Context, addr string) (string, error) {
+	res, err := s.transport().RoundTrip(&Request{
+		Addr:    addr,
+		Cmds:    []Command{{Cmd: "SENTINEL", Args: List("get-master-addr-by-name", s.MasterName)}},
+		Context: ctx,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var fields []string
+	var field string
+
+	for res.Args.Next(&field) {
+		fields = append(fields, field)
+	}
+
+	if err := res.Args.Close(); err != nil {
+		return "", fmt.Errorf("redis: asking sentinel %s for the master: %w", addr, err)
+	}
+
+	// Sentinels reply with a nil array when they don't know the master.
+	if len(fields) != 2 {
+		return "", ErrMasterNotFound
+	}
+
+	return net.JoinHostPort(fields[0], fields[1]), nil
+}
+
+func (s *Sentinel) setMaster(master string) {
+	s.mutex.Lock()
+	s.master = master
+	s.mutex.Unlock()
+}
+
+func (s *Sentinel) transport() *Transport {
+	if s.Transport != nil {
+		return s.Transport
+	}
+	if t, ok := DefaultTransport.(*Transport); ok {
+		return t
+	}
+	return sentinelTransport
+}
+
+func (s *Sentinel) retryInterval() time.Duration {
+	if s.RetryInterval > 0 {
+		return s.RetryInterval
+	}
+	return time.Second
+}
+
+var sentinelTransport = &Transport{}
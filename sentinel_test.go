@@ -0,0 +1,103 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestSentinel(t *testing.T) {
+	newMaster := func(name string) (*redis.Server, string) {
+		srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			res.Write(name)
+		}))
+		return srv, strings.TrimPrefix(url, "tcp://")
+	}
+
+	masterA, addrA := newMaster("A")
+	defer masterA.Close()
+
+	masterB, addrB := newMaster("B")
+	defer masterB.Close()
+
+	var mutex sync.Mutex
+	var master = addrA
+	var subscribers = make(chan *rawConn, 1)
+
+	sentinelAddr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		switch cmd {
+		case "SENTINEL":
+			if len(args) != 2 || args[1] != "mymaster" {
+				return "*-1\r\n"
+			}
+			mutex.Lock()
+			host, port, _ := net.SplitHostPort(master)
+			mutex.Unlock()
+			return fmt.Sprintf("*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(host), host, len(port), port)
+		case "SUBSCRIBE":
+			subscribers <- c
+			return "*3\r\n$9\r\nsubscribe\r\n$14\r\n+switch-master\r\n:1\r\n"
+		default:
+			return "-ERR unknown command\r\n"
+		}
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	sentinel := &redis.Sentinel{
+		Addrs:      []string{"127.0.0.1:1", sentinelAddr},
+		MasterName: "mymaster",
+		Transport:  tr,
+		// The first sentinel is unreachable, the registry retries with the
+		// second one.
+		RetryInterval: 10 * time.Millisecond,
+	}
+	defer sentinel.Close()
+
+	cli := &redis.Client{Transport: &redis.FailoverTransport{Transport: tr, Primary: sentinel}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	get := func() string {
+		s, err := redis.String(cli.Query(ctx, "GET", "key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	if s := get(); s != "A" {
+		t.Error("requests must be sent to the master resolved by the sentinels:", s)
+	}
+
+	var sub *rawConn
+	select {
+	case sub = <-subscribers:
+	case <-ctx.Done():
+		t.Fatal("the registry did not subscribe to the failovers announced by the sentinels")
+	}
+
+	mutex.Lock()
+	master = addrB
+	mutex.Unlock()
+
+	hostA, portA, _ := net.SplitHostPort(addrA)
+	hostB, portB, _ := net.SplitHostPort(addrB)
+	msg := strings.Join([]string{"mymaster", hostA, portA, hostB, portB}, " ")
+	fmt.Fprintf(sub, "*3\r\n$7\r\nmessage\r\n$14\r\n+switch-master\r\n$%d\r\n%s\r\n", len(msg), msg)
+
+	waitFor(t, ctx, func() bool { return get() == "B" })
+
+	sentinel.Close()
+
+	if _, err := sentinel.LookupServers(ctx); err == nil {
+		t.Error("looking up the master of a closed registry must fail")
+	}
+}
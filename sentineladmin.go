@@ -0,0 +1,283 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// SentinelInstance describes a master, replica, or sentinel, as reported by
+// SENTINEL MASTERS, MASTER, REPLICAS, or SENTINELS.
+type SentinelInstance struct {
+	// Name is the name of the instance, the master name for masters, and the
+	// address of the instance for replicas.
+	Name string
+
+	// Addr is the address of the instance, in the host:port form.
+	Addr string
+
+	// RunID is the run id of the instance.
+	RunID string
+
+	// Flags is the list of flags of the instance ("master", "slave",
+	// "s_down", "o_down", "disconnected", ...).
+	Flags []string
+
+	// Fields carries all the fields reported by the sentinel, including the
+	// ones above, like "quorum" or "num-slaves" for masters.
+	Fields map[string]string
+}
+
+// HasFlag returns true if the instance has the given flag.
+func (i *SentinelInstance) HasFlag(flag string) bool {
+	for _, f := range i.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// SentinelMasters returns the masters monitored by the sentinel that the
+// client is connected to, with SENTINEL MASTERS.
+func (c *Client) SentinelMasters(ctx context.Context) ([]SentinelInstance, error) {
+	return c.sentinelInstances(ctx, "MASTERS")
+}
+
+// SentinelMaster returns the master monitored by the sentinel under name, with
+// SENTINEL MASTER.
+func (c *Client) SentinelMaster(ctx context.Context, name string) (SentinelInstance, error) {
+	fields, err := readStrings(c.Query(ctx, "SENTINEL", "MASTER", name))
+	if err != nil {
+		return SentinelInstance{}, err
+	}
+	return makeSentinelInstance(fields), nil
+}
+
+// SentinelReplicas returns the replicas of the master monitored by the
+// sentinel under name, with SENTINEL REPLICAS.
+func (c *Client) SentinelReplicas(ctx context.Context, name string) ([]SentinelInstance, error) {
+	return c.sentinelInstances(ctx, "REPLICAS", name)
+}
+
+// SentinelSentinels returns the other sentinels monitoring the master known
+// under name, with SENTINEL SENTINELS.
+func (c *Client) SentinelSentinels(ctx context.Context, name string) ([]SentinelInstance, error) {
+	return c.sentinelInstances(ctx, "SENTINELS", name)
+}
+
+// SentinelFailover forces a failover of the master monitored under name, with
+// SENTINEL FAILOVER, without asking for the agreement of the other sentinels.
+// The failover runs asynchronously, its progress is reported by the events of
+// the sentinels, see Sentinel.Events.
+func (c *Client) SentinelFailover(ctx context.Context, name string) error {
+	return c.Exec(ctx, "SENTINEL", "FAILOVER", name)
+}
+
+// SentinelMonitor starts monitoring the master at addr under name, with
+// SENTINEL MONITOR. quorum is the number of sentinels which need to agree that
+// the master is down to start a failover.
+func (c *Client) SentinelMonitor(ctx context.Context, name string, addr string, quorum int) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if quorum <= 0 {
+		return errors.New("redis: the quorum of a sentinel master must be positive")
+	}
+	return c.Exec(ctx, "SENTINEL", "MONITOR", name, host, port, quorum)
+}
+
+// SentinelRemove stops monitoring the master known under name, with SENTINEL
+// REMOVE.
+func (c *Client) SentinelRemove(ctx context.Context, name string) error {
+	return c.Exec(ctx, "SENTINEL", "REMOVE", name)
+}
+
+func (c *Client) sentinelInstances(ctx context.Context, args ...interface{}) ([]SentinelInstance, error) {
+	var instances []SentinelInstance
+	var v []interface{}
+
+	r := c.Query(ctx, "SENTINEL", args...)
+
+	for ; r.Next(&v); v = nil {
+		fields := make([]string, len(v))
+		for i := range v {
+			fields[i] = toString(v[i])
+		}
+		instances = append(instances, makeSentinelInstance(fields))
+	}
+
+	return instances, r.Close()
+}
+
+// makeSentinelInstance converts the flat list of field names and values that
+// sentinels report for each instance.
+func makeSentinelInstance(fields []string) SentinelInstance {
+	i := SentinelInstance{Fields: make(map[string]string, len(fields)/2)}
+
+	for j := 0; j+1 < len(fields); j += 2 {
+		i.Fields[fields[j]] = fields[j+1]
+	}
+
+	i.Name = i.Fields["name"]
+	i.RunID = i.Fields["runid"]
+
+	if ip, port := i.Fields["ip"], i.Fields["port"]; len(ip) != 0 || len(port) != 0 {
+		i.Addr = net.JoinHostPort(ip, port)
+	}
+
+	if flags := i.Fields["flags"]; len(flags) != 0 {
+		i.Flags = strings.Split(flags, ",")
+	}
+
+	return i
+}
+
+// DefaultSentinelEvents is the list of events that Sentinel.Events subscribes
+// to when none are given: the changes of the subjective and objective down
+// states of instances, and the failovers.
+var DefaultSentinelEvents = []string{"+sdown", "-sdown", "+odown", "-odown", "+switch-master"}
+
+// SentinelEvent is an event published by a sentinel.
+//
+// Most events describe an instance, and the master it belongs to unless the
+// instance is a master:
+//
+//	<role> <name> <ip> <port> @ <master name> <master ip> <master port>
+//
+// +switch-master events are reported as an event of the master, with OldAddr
+// set to the address of the previous master.
+type SentinelEvent struct {
+	// Type is the type of event, which is the name of the channel it was
+	// published on, like "+sdown" or "+switch-master".
+	Type string
+
+	// Sentinel is the address of the sentinel which published the event.
+	Sentinel string
+
+	// Role is the role of the instance, "master", "slave", or "sentinel".
+	Role string
+
+	// Name and Addr are the name and address of the instance.
+	Name string
+	Addr string
+
+	// MasterName and MasterAddr are the name and address of the master of the
+	// instance, or of the instance itself if it is a master.
+	MasterName string
+	MasterAddr string
+
+	// OldAddr is the address of the previous master of +switch-master events.
+	OldAddr string
+
+	// Payload is the raw message of the event.
+	Payload string
+}
+
+// Events subscribes to the events published by the sentinels, and sends them
+// to the returned channel until ctx is canceled, after which the channel is
+// closed. If no events are given, DefaultSentinelEvents is used.
+//
+// The sentinels are subscribed to one at a time, in order, moving to the next
+// one after waiting RetryInterval when the subscription is lost; events
+// published while no sentinel is subscribed are missed. Events of all the
+// masters monitored by the sentinels are reported, not only MasterName.
+//
+// The program must keep receiving from the channel, the subscription doesn't
+// read events until the previous one was received.
+func (s *Sentinel) Events(ctx context.Context, events ...string) <-chan SentinelEvent {
+	if len(events) == 0 {
+		events = DefaultSentinelEvents
+	}
+
+	ch := make(chan SentinelEvent)
+
+	go func() {
+		defer close(ch)
+
+		for i := 0; ctx.Err() == nil; i++ {
+			if len(s.Addrs) != 0 {
+				s.readEvents(ctx, s.Addrs[i%len(s.Addrs)], events, ch)
+			}
+
+			timer := time.NewTimer(s.retryInterval())
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (s *Sentinel) readEvents(ctx context.Context, addr string, events []string, ch chan<- SentinelEvent) {
+	network, address := splitNetworkAddress(addr)
+
+	sub, err := s.transport().Subscribe(ctx, network, address, events...)
+	if err != nil {
+		return
+	}
+	defer sub.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		channel, msg, err := sub.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		select {
+		case ch <- parseSentinelEvent(addr, channel, string(msg)):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func parseSentinelEvent(sentinel string, channel string, msg string) SentinelEvent {
+	e := SentinelEvent{Type: channel, Sentinel: sentinel, Payload: msg}
+	fields := strings.Fields(msg)
+
+	if channel == "+switch-master" {
+		// <name> <old ip> <old port> <ip> <port>
+		if len(fields) == 5 {
+			e.Role = "master"
+			e.Name, e.MasterName = fields[0], fields[0]
+			e.OldAddr = net.JoinHostPort(fields[1], fields[2])
+			e.Addr = net.JoinHostPort(fields[3], fields[4])
+			e.MasterAddr = e.Addr
+		}
+		return e
+	}
+
+	if len(fields) < 4 {
+		return e
+	}
+
+	e.Role, e.Name = fields[0], fields[1]
+	e.Addr = net.JoinHostPort(fields[2], fields[3])
+
+	if len(fields) >= 8 && fields[4] == "@" {
+		e.MasterName = fields[5]
+		e.MasterAddr = net.JoinHostPort(fields[6], fields[7])
+	} else if e.Role == "master" {
+		e.MasterName, e.MasterAddr = e.Name, e.Addr
+	}
+
+	return e
+}
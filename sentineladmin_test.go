@@ -0,0 +1,215 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestSentinelAdmin(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context)
+	}{
+		{
+			scenario: "masters and replicas are returned as typed instances",
+			function: testSentinelAdminInstances,
+		},
+		{
+			scenario: "monitor, failover and remove send the SENTINEL commands",
+			function: testSentinelAdminCommands,
+		},
+		{
+			scenario: "events published by the sentinels are parsed and streamed",
+			function: testSentinelAdminEvents,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			testFunc(t, ctx)
+		})
+	}
+}
+
+func bulkArray(values ...string) string {
+	s := fmt.Sprintf("*%d\r\n", len(values))
+	for _, v := range values {
+		s += fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	}
+	return s
+}
+
+func testSentinelAdminInstances(t *testing.T, ctx context.Context) {
+	master := []string{"name", "mymaster", "ip", "10.0.0.1", "port", "6379", "runid", "abc", "flags", "master", "quorum", "2"}
+	replica := []string{"name", "10.0.0.2:6379", "ip", "10.0.0.2", "port", "6379", "runid", "def", "flags", "slave,s_down"}
+
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		if cmd != "SENTINEL" || len(args) == 0 {
+			return ""
+		}
+		switch args[0] {
+		case "MASTERS":
+			return "*1\r\n" + bulkArray(master...)
+		case "MASTER":
+			return bulkArray(master...)
+		case "REPLICAS":
+			return "*1\r\n" + bulkArray(replica...)
+		default:
+			return "-ERR unknown subcommand\r\n"
+		}
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+	cli := &redis.Client{Addr: addr, Transport: tr}
+
+	masters, err := cli.SentinelMasters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(masters) != 1 {
+		t.Fatal("bad masters:", masters)
+	}
+
+	m := masters[0]
+	if m.Name != "mymaster" || m.Addr != "10.0.0.1:6379" || m.RunID != "abc" || !m.HasFlag("master") || m.Fields["quorum"] != "2" {
+		t.Errorf("bad master: %+v", m)
+	}
+
+	if single, err := cli.SentinelMaster(ctx, "mymaster"); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(single, m) {
+		t.Errorf("bad master: %+v", single)
+	}
+
+	replicas, err := cli.SentinelReplicas(ctx, "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replicas) != 1 || replicas[0].Addr != "10.0.0.2:6379" || !reflect.DeepEqual(replicas[0].Flags, []string{"slave", "s_down"}) {
+		t.Errorf("bad replicas: %+v", replicas)
+	}
+}
+
+func testSentinelAdminCommands(t *testing.T, ctx context.Context) {
+	var mutex sync.Mutex
+	var commands []string
+
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		if cmd != "SENTINEL" {
+			return ""
+		}
+		mutex.Lock()
+		commands = append(commands, strings.Join(args, " "))
+		mutex.Unlock()
+		return "+OK\r\n"
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+	cli := &redis.Client{Addr: addr, Transport: tr}
+
+	if err := cli.SentinelMonitor(ctx, "mymaster", "10.0.0.1:6379", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.SentinelFailover(ctx, "mymaster"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.SentinelRemove(ctx, "mymaster"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.SentinelMonitor(ctx, "mymaster", "10.0.0.1:6379", 0); err == nil {
+		t.Error("expected an error for a zero quorum")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if want := []string{"MONITOR mymaster 10.0.0.1 6379 2", "FAILOVER mymaster", "REMOVE mymaster"}; !reflect.DeepEqual(commands, want) {
+		t.Error("bad commands:", commands)
+	}
+}
+
+func testSentinelAdminEvents(t *testing.T, ctx context.Context) {
+	subscribers := make(chan *rawConn, 1)
+
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		if cmd != "SUBSCRIBE" {
+			return ""
+		}
+		var reply string
+		for i, channel := range args {
+			reply += fmt.Sprintf("*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, i+1)
+		}
+		subscribers <- c
+		return reply
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	sentinel := &redis.Sentinel{Addrs: []string{addr}, Transport: tr, RetryInterval: 10 * time.Millisecond}
+	defer sentinel.Close()
+
+	events := sentinel.Events(ctx, "+sdown", "+switch-master")
+
+	var sub *rawConn
+	select {
+	case sub = <-subscribers:
+	case <-ctx.Done():
+		t.Fatal("the sentinel events were not subscribed to")
+	}
+
+	publish := func(channel, msg string) {
+		fmt.Fprintf(sub, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(channel), channel, len(msg), msg)
+	}
+
+	publish("+sdown", "slave 10.0.0.2:6379 10.0.0.2 6379 @ mymaster 10.0.0.1 6379")
+	publish("+switch-master", "mymaster 10.0.0.1 6379 10.0.0.2 6379")
+
+	for _, want := range []redis.SentinelEvent{
+		{
+			Type:       "+sdown",
+			Sentinel:   addr,
+			Role:       "slave",
+			Name:       "10.0.0.2:6379",
+			Addr:       "10.0.0.2:6379",
+			MasterName: "mymaster",
+			MasterAddr: "10.0.0.1:6379",
+			Payload:    "slave 10.0.0.2:6379 10.0.0.2 6379 @ mymaster 10.0.0.1 6379",
+		},
+		{
+			Type:       "+switch-master",
+			Sentinel:   addr,
+			Role:       "master",
+			Name:       "mymaster",
+			Addr:       "10.0.0.2:6379",
+			MasterName: "mymaster",
+			MasterAddr: "10.0.0.2:6379",
+			OldAddr:    "10.0.0.1:6379",
+			Payload:    "mymaster 10.0.0.1 6379 10.0.0.2 6379",
+		},
+	} {
+		select {
+		case e := <-events:
+			if !reflect.DeepEqual(e, want) {
+				t.Errorf("bad event:\n%+v\n%+v", e, want)
+			}
+		case <-ctx.Done():
+			t.Fatal("missing event:", want.Type)
+		}
+	}
+}
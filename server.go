@@ -3,15 +3,20 @@ package redis
 import (
 	"bufio"
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/segmentio/objconv"
 	"github.com/segmentio/objconv/resp"
+	"github.com/segmentio/redis-go/resputil"
 )
 
 // A ResponseWriter interface is used by a Redis handler to construct an Redis
@@ -86,7 +91,8 @@ type Server struct {
 	// The address to listen on, ":6379" if empty.
 	//
 	// The address may be prefixed with "tcp://" or "unix://" to specify the
-	// type of network to listen on.
+	// type of network to listen on. On Windows, "npipe://" addresses like
+	// "npipe:////./pipe/redis" listen on named pipes.
 	Addr string
 
 	// Handler invoked to handle Redis requests, must not be nil.
@@ -105,6 +111,91 @@ type Server struct {
 	// zero, there is no timeout.
 	IdleTimeout time.Duration
 
+	// ReadBufferSize and WriteBufferSize are the sizes of the buffers used
+	// when reading from and writing to client connections. If zero,
+	// DefaultBufferSize is used.
+	//
+	// Responses larger than the write buffer, like replies to very large
+	// pipelines, are written across multiple flushes.
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// KeepAlive is the keep-alive period set on accepted TCP connections. If
+	// zero, the operating system defaults are used.
+	KeepAlive time.Duration
+
+	// MaxClients, when non-zero, is the maximum number of connections that the
+	// server serves concurrently. Connections accepted above the limit receive
+	// an error and are closed.
+	MaxClients int
+
+	// RequirePass, when not empty, is the password that connections have to
+	// send with the AUTH command before issuing other commands. AUTH commands
+	// are then handled by the server and never passed to the Handler.
+	RequirePass string
+
+	// RenameCommands renames or disables commands, like the rename-command
+	// directive of redis. Keys are the names of the commands passed to the
+	// Handler, values are the names that clients must use to send them, an
+	// empty name disables the command. Commands sent with their original name
+	// are rejected as unknown commands and never reach the Handler.
+	//
+	// Renaming allows operators to hide dangerous commands, like FLUSHALL or
+	// CONFIG, on custom servers and proxies.
+	RenameCommands map[string]string
+
+	// Compression, when true, lets clients negotiate the compression of the
+	// traffic of their connections with a HELLO command carrying the COMPRESS
+	// attribute, as done by Transports with Compression enabled. The other
+	// HELLO commands are passed to the Handler.
+	//
+	// Compression reduces the bandwidth used by large values, for example
+	// between proxies running in different availability zones, at the cost
+	// of CPU time.
+	Compression bool
+
+	// Checksum, when true, lets clients negotiate the validation of the
+	// traffic of their connections with a HELLO command carrying the CHECKSUM
+	// attribute, as done by Transports with Checksum enabled. The data is
+	// then exchanged in frames carrying a CRC-32C of their payload, and the
+	// connections on which a corrupted frame is received are closed.
+	//
+	// Checksums protect long-haul links against corruptions that go
+	// undetected by the TCP checksum.
+	Checksum bool
+
+	// CancelOnDisconnect enables the detection of clients closing their
+	// connection while a handler is running, the context of the request is
+	// canceled when it happens so handlers stop working for clients that went
+	// away. Detecting disconnects requires a background read on connections,
+	// so the arguments of requests are loaded in memory before handlers are
+	// called. Disconnects are not detected when the client has already sent
+	// its next commands.
+	CancelOnDisconnect bool
+
+	// MemoryGuard, if not nil, protects the server against running out of
+	// memory. While the guard reports that its threshold is exceeded, new
+	// connections are closed right after being accepted, and requests with
+	// write commands fail with ErrOOM.
+	MemoryGuard *MemoryGuard
+
+	// CommandStats, if not nil, records the calls and the time spent serving
+	// each command. The server answers INFO commandstats with them, and adds
+	// them to the responses of the Handler to INFO and INFO all. The
+	// time of a command is measured until its handler returns, the commands
+	// of transactions share the time of the transaction. Commands rejected
+	// by the server, like those of unauthenticated clients, are not recorded.
+	CommandStats *CommandStats
+
+	// SLO, if not nil, tracks the latency of requests against objectives set
+	// per class of commands, measured like CommandStats.
+	SLO *SLO
+
+	// WireLogger, if not nil, dumps the traffic of the connections accepted
+	// by the server. It is intended to debug protocol issues, and has a
+	// significant performance cost.
+	WireLogger *resputil.WireLogger
+
 	// ErrorLog specifies an optional logger for errors accepting connections
 	// and unexpected behavior from handlers. If nil, logging goes to os.Stderr
 	// via the log package's standard logger.
@@ -113,8 +204,10 @@ type Server struct {
 	mutex       sync.Mutex
 	listeners   map[net.Listener]struct{}
 	connections map[*Conn]struct{}
+	accepted    int64
 	context     context.Context
 	shutdown    context.CancelFunc
+	limits      serverLimits
 }
 
 // ListenAndServe listens on the network address s.Addr and then calls Serve to
@@ -131,7 +224,7 @@ func (s *Server) ListenAndServe() error {
 		network = "tcp"
 	}
 
-	l, err := net.Listen(network, address)
+	l, err := listen(network, address)
 	if err != nil {
 		return err
 	}
@@ -163,6 +256,75 @@ func (s *Server) Close() error {
 	return err
 }
 
+// ServerStats carries counters of the connections of a Server.
+type ServerStats struct {
+	// Conns is the number of open client connections.
+	Conns int
+
+	// Accepted is the number of client connections accepted since the server
+	// started.
+	Accepted int64
+}
+
+// Stats returns the counters of the server's connections.
+func (s *Server) Stats() ServerStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return ServerStats{
+		Conns:    len(s.connections),
+		Accepted: s.accepted,
+	}
+}
+
+// RegisterTunables registers the limits of the server on r, so they can be
+// changed with CONFIG SET while the server is running:
+//
+//	timeout        IdleTimeout, in seconds
+//	read-timeout   ReadTimeout, in milliseconds
+//	write-timeout  WriteTimeout, in milliseconds
+//	maxclients     MaxClients
+//
+// The tunables are initialized with the values of the fields of the server,
+// which must not be changed afterwards. New values apply to connections that
+// are accepted and requests that are read after they were set.
+func (s *Server) RegisterTunables(r *TunableRegistry) {
+	limits := s.loadLimits()
+
+	r.Register("timeout", &limits.idleTimeout)
+	r.Register("read-timeout", &limits.readTimeout)
+	r.Register("write-timeout", &limits.writeTimeout)
+	r.Register("maxclients", &limits.maxClients)
+}
+
+// serverLimits holds the limits of a server which can be changed while it's
+// running, they are loaded from the fields of the server the first time they
+// are needed.
+type serverLimits struct {
+	once         sync.Once
+	idleTimeout  DurationTunable
+	readTimeout  DurationTunable
+	writeTimeout DurationTunable
+	maxClients   IntTunable
+}
+
+func (s *Server) loadLimits() *serverLimits {
+	limits := &s.limits
+
+	limits.once.Do(func() {
+		limits.readTimeout.Unit = time.Millisecond
+		limits.writeTimeout.Unit = time.Millisecond
+		limits.maxClients.Max = math.MaxInt32
+
+		limits.idleTimeout.Store(s.IdleTimeout)
+		limits.readTimeout.Store(s.ReadTimeout)
+		limits.writeTimeout.Store(s.WriteTimeout)
+		limits.maxClients.Store(int64(s.MaxClients))
+	})
+
+	return limits
+}
+
 // Shutdown gracefully shuts down the server without interrupting any active
 // connections. Shutdown works by first closing all open listeners, then closing
 // all idle connections, and then waiting indefinitely for connections to return
@@ -211,13 +373,8 @@ func (s *Server) Serve(l net.Listener) error {
 	attempt := 0
 
 	config := serverConfig{
-		idleTimeout:  s.IdleTimeout,
-		readTimeout:  s.ReadTimeout,
-		writeTimeout: s.WriteTimeout,
-	}
-
-	if config.idleTimeout == 0 {
-		config.idleTimeout = config.readTimeout
+		limits:  s.loadLimits(),
+		renames: makeCommandRenames(s.RenameCommands),
 	}
 
 	for {
@@ -245,7 +402,31 @@ func (s *Server) Serve(l net.Listener) error {
 		}
 
 		attempt = 0
-		c := NewServerConn(conn)
+
+		if s.MemoryGuard.Exceeded() {
+			conn.Close()
+			continue
+		}
+
+		// Keep-alives are set before wrapping the connection, the wire logger
+		// hides the *net.TCPConn.
+		if tcp, ok := conn.(*net.TCPConn); ok && s.KeepAlive > 0 {
+			tcp.SetKeepAlive(true)
+			tcp.SetKeepAlivePeriod(s.KeepAlive)
+		}
+
+		if s.WireLogger != nil {
+			conn = s.WireLogger.Conn(conn)
+		}
+
+		c := newServerConn(conn, s.ReadBufferSize, s.WriteBufferSize)
+
+		if max := int(config.limits.maxClients.Load()); max > 0 && s.numberOfConnections() >= max {
+			c.setTimeout(config.writeTimeout())
+			c.writeValue(errMaxClients)
+			c.Close()
+			continue
+		}
 		s.trackConnection(c)
 		go s.serveConnection(s.context, c, config)
 	}
@@ -257,7 +438,7 @@ func (s *Server) serveConnection(ctx context.Context, c *Conn, config serverConf
 	defer c.Close()
 	defer s.untrackConnection(c)
 
-	var addr = c.RemoteAddr().String()
+	var session = &serverSession{addr: c.RemoteAddr().String()}
 	for {
 		select {
 		default:
@@ -265,90 +446,277 @@ func (s *Server) serveConnection(ctx context.Context, c *Conn, config serverConf
 			return
 		}
 
-		if c.waitReadyRead(config.idleTimeout) != nil {
+		if c.waitReadyRead(config.idleTimeout()) != nil {
 			return
 		}
 
-		c.setTimeout(config.readTimeout)
-		cmdReader := c.ReadCommands()
-
-		cmds := make([]Command, 0, 4)
-		cmds = append(cmds, Command{})
-
-		if !cmdReader.Read(&cmds[0]) {
-			s.log(cmdReader.Close())
+		if !s.serveNext(c, session, config) {
 			return
 		}
+	}
+}
 
-		if cmds[0].Cmd == "MULTI" {
-			// Transactions have to be loaded in memory because the server has to
-			// interleave responses between each command it receives.
-			for {
-				lastIndex := len(cmds)
-				cmds[lastIndex].loadByteArgs()
-
-				if lastIndex == 0 {
-					c.WriteArgs(List("OK")) // response to MULTI
-				} else {
-					c.WriteArgs(List("QUEUED"))
-				}
+// serveNext reads and serves the next request available on c, returning false
+// if the connection must be closed.
+func (s *Server) serveNext(c *Conn, session *serverSession, config serverConfig) bool {
+	c.setTimeout(config.readTimeout())
+	cmdReader := c.ReadCommands()
 
-				cmds = append(cmds, Command{})
-				cmd := &cmds[lastIndex]
+	cmds := make([]Command, 0, 4)
+	cmds = append(cmds, Command{})
 
-				if !cmdReader.Read(cmd) {
-					cmds = cmds[:lastIndex]
-					break
-				}
-			}
+	if !cmdReader.Read(&cmds[0]) {
+		s.log(cmdReader.Close())
+		return false
+	}
 
+	if cmds[0].Cmd == "MULTI" {
+		// Transactions have to be loaded in memory because the server has to
+		// interleave responses between each command it receives.
+		for {
 			lastIndex := len(cmds) - 1
+			cmd := &cmds[lastIndex]
+			cmd.loadByteArgs()
 
-			if cmds[lastIndex].Cmd == "DISCARD" {
-				cmds[lastIndex].Args.Close()
-
-				if err := c.WriteArgs(List("OK")); err != nil {
-					return
-				}
+			if cmd.Cmd == "EXEC" || cmd.Cmd == "DISCARD" {
+				break
+			}
 
-				continue // discarded transactions are not passed to the handler
+			if lastIndex == 0 {
+				c.writeValue("OK") // response to MULTI
+			} else {
+				c.writeValue("QUEUED")
 			}
 
-			cmds = cmds[1:lastIndex]
-		}
+			cmds = append(cmds, Command{})
 
-		if err := s.serveCommands(c, addr, cmds, config); err != nil {
-			s.log(err)
-			return
+			// Transactions interrupted before EXEC are not served.
+			if !cmdReader.Read(&cmds[lastIndex+1]) {
+				s.log(cmdReader.Close())
+				return false
+			}
 		}
 
-		if err := cmdReader.Close(); err != nil {
-			s.log(err)
-			return
+		lastIndex := len(cmds) - 1
+
+		if cmds[lastIndex].Cmd == "DISCARD" {
+			cmds[lastIndex].Args.Close()
+
+			if err := c.writeValue("OK"); err != nil {
+				return false
+			}
+
+			if err := cmdReader.Close(); err != nil {
+				s.log(err)
+				return false
+			}
+
+			return true // discarded transactions are not passed to the handler
 		}
+
+		cmds = cmds[1:lastIndex]
 	}
+
+	if err := s.serveCommands(c, session, cmds, config); err != nil {
+		s.log(err)
+		return false
+	}
+
+	if err := cmdReader.Close(); err != nil {
+		s.log(err)
+		return false
+	}
+
+	return true
 }
 
-func (s *Server) serveCommands(c *Conn, addr string, cmds []Command, config serverConfig) (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), config.readTimeout)
+func (s *Server) serveCommands(c *Conn, session *serverSession, cmds []Command, config serverConfig) (err error) {
+	var ctx = withLazyCorrelationID(nil)
+	var cancel context.CancelFunc
+
+	if session.info != nil {
+		ctx = context.WithValue(ctx, clientAttributesKey{}, session.info)
+	}
+
+	// A zero read timeout means no timeout, the request context must not be
+	// expired before the handler even starts.
+	if timeout := config.readTimeout(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
 
 	req := &Request{
-		Addr:    addr,
+		Addr:    session.addr,
 		Cmds:    cmds,
 		Context: ctx,
 	}
 
 	res := &responseWriter{
 		conn:    c,
-		timeout: config.writeTimeout,
+		timeout: config.writeTimeout(),
+	}
+
+	if e := config.renames.apply(req.Cmds); e != nil {
+		err = writeError(res, e)
+		req.Close()
+		cancel()
+		return
+	}
+
+	if (s.Compression || s.Checksum) && isHelloRequest(req) {
+		var handled bool
+
+		if handled, err = s.serveHello(c, res, req); handled {
+			req.Close()
+			cancel()
+			return
+		}
+	}
+
+	if s.CancelOnDisconnect {
+		// The handler must not read from the connection while it's watched,
+		// the arguments are loaded in memory first.
+		for i := range req.Cmds {
+			req.Cmds[i].loadByteArgs()
+		}
+		res.unwatch = c.watchClose(cancel)
+		defer res.stopWatching()
+	}
+
+	start := time.Now()
+	observe := s.CommandStats != nil || s.SLO != nil
+
+	switch {
+	case len(s.RequirePass) != 0 && isAuthRequest(req):
+		err = s.serveAuth(res, req, session)
+	case len(s.RequirePass) != 0 && !session.authenticated:
+		err, observe = writeError(res, ErrNoAuth), false
+	case s.MemoryGuard.Exceeded() && deniedByMemoryGuard(req):
+		err, observe = writeError(res, ErrOOM), false
+	case isSetInfoRequest(req):
+		err = s.serveSetInfo(res, req, session)
+	case s.CommandStats != nil && isCommandStatsRequest(req):
+		if err = s.CommandStats.serveInfo(res); err == nil {
+			err = res.Flush()
+		}
+	default:
+		err = s.serveRequest(res, req)
+	}
+
+	if observe {
+		elapsed := time.Since(start)
+		s.CommandStats.observeRequest(req, elapsed)
+		s.SLO.observeRequest(req, elapsed)
 	}
 
-	err = s.serveRequest(res, req)
 	req.Close()
 	cancel()
 	return
 }
 
+// serveAuth handles AUTH commands on servers which require a password, the
+// username, if any, must be "default".
+func (s *Server) serveAuth(res *responseWriter, req *Request, session *serverSession) error {
+	var args []string
+	var arg string
+
+	for req.Cmds[0].Args.Next(&arg) {
+		args = append(args, arg)
+	}
+
+	switch {
+	case len(args) == 1 && s.checkPass(args[0]),
+		len(args) == 2 && args[0] == "default" && s.checkPass(args[1]):
+		session.authenticated = true
+		return writeError(res, nil)
+	case len(args) == 1 || len(args) == 2:
+		return writeError(res, ErrWrongPass)
+	default:
+		return writeError(res, resp.NewError("ERR wrong number of arguments for 'auth' command"))
+	}
+}
+
+// checkPass compares pass to RequirePass in constant time, so the time taken to
+// reject passwords doesn't leak how much of them matched.
+func (s *Server) checkPass(pass string) bool {
+	return subtle.ConstantTimeCompare([]byte(pass), []byte(s.RequirePass)) == 1
+}
+
+// writeError writes err as the response, or OK if err is nil.
+func writeError(res *responseWriter, err error) error {
+	var v interface{} = "OK"
+
+	if err != nil {
+		v = err
+	}
+
+	if err := res.Write(v); err != nil {
+		return err
+	}
+
+	return res.Flush()
+}
+
+func isAuthRequest(req *Request) bool {
+	return len(req.Cmds) == 1 && strings.EqualFold(req.Cmds[0].Cmd, "AUTH")
+}
+
+// serveSetInfo handles CLIENT SETINFO commands, the attributes are recorded on
+// the session and exposed to the handlers by ClientAttributes.
+func (s *Server) serveSetInfo(res *responseWriter, req *Request, session *serverSession) error {
+	var args []string
+	var arg string
+
+	for req.Cmds[0].Args.Next(&arg) {
+		args = append(args, arg)
+	}
+
+	if len(args) != 3 {
+		return writeError(res, resp.NewError("ERR wrong number of arguments for 'client|setinfo' command"))
+	}
+
+	// The map is copied so the contexts of previous requests are not mutated.
+	info := make(map[string]string, len(session.info)+1)
+	for k, v := range session.info {
+		info[k] = v
+	}
+	info[strings.ToLower(args[1])] = args[2]
+	session.info = info
+
+	return writeError(res, nil)
+}
+
+// isSetInfoRequest returns true if req is a CLIENT SETINFO command, the first
+// argument is put back in the argument list either way.
+func isSetInfoRequest(req *Request) bool {
+	if len(req.Cmds) != 1 || !strings.EqualFold(req.Cmds[0].Cmd, "CLIENT") {
+		return false
+	}
+	sub, ok := peekArg(&req.Cmds[0])
+	return ok && strings.EqualFold(sub, "SETINFO")
+}
+
+// peekArg returns the first argument of cmd, and puts it back in the argument
+// list so the command can still be passed to a handler.
+func peekArg(cmd *Command) (string, bool) {
+	var arg string
+
+	if cmd.Args == nil || !cmd.Args.Next(&arg) {
+		return "", false
+	}
+
+	cmd.Args = MultiArgs(List(arg), cmd.Args)
+	return arg, true
+}
+
+// serverSession carries the state of a client connection across requests.
+type serverSession struct {
+	addr          string
+	authenticated bool
+	info          map[string]string
+}
+
 func (s *Server) serveRequest(res *responseWriter, req *Request) (err error) {
 	var preparedRes *preparedResponseWriter
 	var w ResponseWriter = res
@@ -403,6 +771,9 @@ func (s *Server) serveRedis(res ResponseWriter, req *Request) (err error) {
 			err = convertPanicToError(v)
 		}
 	}()
+	if s.CommandStats != nil && isInfoRequest(req) {
+		res = &infoResponseWriter{ResponseWriter: res, stats: s.CommandStats}
+	}
 	s.Handler.ServeRedis(res, req)
 	return
 }
@@ -443,6 +814,7 @@ func (s *Server) trackConnection(c *Conn) {
 	}
 
 	s.connections[c] = struct{}{}
+	s.accepted++
 	s.mutex.Unlock()
 }
 
@@ -452,6 +824,13 @@ func (s *Server) untrackConnection(c *Conn) {
 	s.mutex.Unlock()
 }
 
+func (s *Server) numberOfConnections() int {
+	s.mutex.Lock()
+	n := len(s.connections)
+	s.mutex.Unlock()
+	return n
+}
+
 func (s *Server) numberOfActors() int {
 	s.mutex.Lock()
 	n := len(s.connections) + len(s.listeners)
@@ -495,9 +874,70 @@ type temporaryError interface {
 }
 
 type serverConfig struct {
-	idleTimeout  time.Duration
-	readTimeout  time.Duration
-	writeTimeout time.Duration
+	limits  *serverLimits
+	renames commandRenames
+}
+
+// idleTimeout returns the IdleTimeout of the server, or its ReadTimeout if
+// zero.
+func (c serverConfig) idleTimeout() time.Duration {
+	if timeout := c.limits.idleTimeout.Load(); timeout != 0 {
+		return timeout
+	}
+	return c.readTimeout()
+}
+
+func (c serverConfig) readTimeout() time.Duration { return c.limits.readTimeout.Load() }
+
+func (c serverConfig) writeTimeout() time.Duration { return c.limits.writeTimeout.Load() }
+
+// commandRenames maps the upper-case names that clients use to send commands
+// to the names of the commands passed to the handler. Commands that were
+// renamed or disabled are mapped to an empty string.
+type commandRenames map[string]string
+
+func makeCommandRenames(renames map[string]string) commandRenames {
+	if len(renames) == 0 {
+		return nil
+	}
+
+	m := make(commandRenames, 2*len(renames))
+
+	for name := range renames {
+		m[strings.ToUpper(name)] = ""
+	}
+
+	for name, newName := range renames {
+		if len(newName) != 0 {
+			m[strings.ToUpper(newName)] = strings.ToUpper(name)
+		}
+	}
+
+	return m
+}
+
+// apply translates the names of cmds, returning an error if one of them was
+// renamed or disabled.
+func (m commandRenames) apply(cmds []Command) error {
+	if m == nil {
+		return nil
+	}
+
+	for i := range cmds {
+		name, ok := m[strings.ToUpper(cmds[i].Cmd)]
+
+		if !ok {
+			continue
+		}
+
+		if len(name) == 0 {
+			return resp.NewError(fmt.Sprintf("ERR unknown command '%s'", cmds[i].Cmd))
+		}
+
+		cmds[i].Cmd = name
+	}
+
+	return nil
 }
 
 func backoff(attempt int, minDelay time.Duration, maxDelay time.Duration) time.Duration {
@@ -540,6 +980,14 @@ type responseWriter struct {
 	enc     objconv.Encoder
 	stream  objconv.StreamEncoder
 	timeout time.Duration
+	unwatch func() // stops watching the connection for disconnects
+}
+
+func (res *responseWriter) stopWatching() {
+	if res.unwatch != nil {
+		res.unwatch()
+		res.unwatch = nil
+	}
 }
 
 func (res *responseWriter) WriteStream(n int) error {
@@ -611,9 +1059,11 @@ func (res *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if res.conn == nil {
 		return nil, nil, ErrHijacked
 	}
+	res.stopWatching()
 	nc := res.conn.conn
 	rw := &bufio.ReadWriter{
-		Reader: &res.conn.rbuffer,
+		// The parser reads ahead, pipelined commands may be buffered there.
+		Reader: bufio.NewReader(io.MultiReader(res.conn.parser.Buffered(), &res.conn.rbuffer)),
 		Writer: &res.conn.wbuffer,
 	}
 	res.conn = nil
@@ -682,7 +1132,10 @@ func (res *preparedResponseWriter) writeRemainingValues() (err error) {
 }
 
 var (
-	// ErrServerClosed is returned by Server.Serve when the server is closed.
+	// ErrServerClosed is returned by Server.Serve when the server is closed,
+	// and by clients for the commands that a server didn't answer because it
+	// closed the connection (the client read an EOF between two responses).
+	// ErrorClass reports it as ErrClassServerClosed.
 	ErrNilArgs                       = errors.New("cannot parse values from a nil argument list")
 	ErrServerClosed                  = errors.New("redis: Server closed")
 	ErrNegativeStreamCount           = errors.New("invalid call to redis.ResponseWriter.WriteStream with a negative value")
@@ -693,3 +1146,17 @@ var (
 	ErrHijacked                      = errors.New("invalid use of a hijacked redis.ResponseWriter")
 	ErrNotHijackable                 = errors.New("the response writer is not hijackable")
 )
+
+var (
+	// ErrNoAuth is the error returned by servers requiring a password to
+	// requests sent by connections which are not authenticated.
+	ErrNoAuth = resp.NewError("NOAUTH Authentication required.")
+
+	// ErrWrongPass is the error returned by servers to AUTH commands with an
+	// invalid password.
+	ErrWrongPass = resp.NewError("WRONGPASS invalid username-password pair or user is disabled.")
+
+	// errMaxClients is written to connections refused because the server has
+	// reached its maximum number of clients.
+	errMaxClients = resp.NewError("ERR max number of clients reached")
+)
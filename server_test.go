@@ -2,6 +2,7 @@ package redis_test
 
 import (
 	"context"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -55,6 +56,26 @@ func TestServer(t *testing.T) {
 			scenario: "redis protocol errors written to the response writer are made visible by the client",
 			function: testServerWriteErrorToResponseWriter,
 		},
+		{
+			scenario: "a server requiring a password rejects requests of connections which are not authenticated",
+			function: testServerRequirePass,
+		},
+		{
+			scenario: "a server refuses connections above its maximum number of clients",
+			function: testServerMaxClients,
+		},
+		{
+			scenario: "the limits of a server are changed at runtime by setting its tunables",
+			function: testServerTunables,
+		},
+		{
+			scenario: "renamed and disabled commands are rejected, and their new names are translated",
+			function: testServerRenameCommands,
+		},
+		{
+			scenario: "the request context is canceled when the client disconnects while the handler is running",
+			function: testServerCancelOnDisconnect,
+		},
 	}
 
 	for _, test := range tests {
@@ -341,6 +362,187 @@ func testServerWriteErrorToResponseWriter(t *testing.T, ctx context.Context) {
 	}
 }
 
+func testServerRequirePass(t *testing.T, ctx context.Context) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			res.Write("OK")
+		}),
+		RequirePass: "secret",
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	conn, err := redis.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	exec := func(cmd string, args ...interface{}) error {
+		if err := conn.WriteCommands(redis.Command{Cmd: cmd, Args: redis.List(args...)}); err != nil {
+			return err
+		}
+		return conn.ReadArgs().Close()
+	}
+
+	if err := exec("SET", "hello", "world"); err == nil || err.Error() != redis.ErrNoAuth.Error() {
+		t.Error("bad error before authenticating:", err)
+	}
+
+	if err := exec("AUTH", "wrong"); err == nil || err.Error() != redis.ErrWrongPass.Error() {
+		t.Error("bad error with a wrong password:", err)
+	}
+
+	if err := exec("AUTH", "default", "secret"); err != nil {
+		t.Error(err)
+	}
+
+	if err := exec("SET", "hello", "world"); err != nil {
+		t.Error(err)
+	}
+}
+
+func testServerMaxClients(t *testing.T, ctx context.Context) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			res.Write("OK")
+		}),
+		MaxClients: 1,
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	first := &redis.Client{Addr: l.Addr().String(), Transport: tr}
+
+	if err := first.Exec(ctx, "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	second := &redis.Client{Addr: l.Addr().String(), Transport: &redis.Transport{}}
+
+	if err := second.Exec(ctx, "SET", "hello", "world"); err == nil {
+		t.Error("the second connection should have been refused")
+	}
+}
+
+func testServerTunables(t *testing.T, ctx context.Context) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg := &redis.TunableRegistry{}
+	mux := redis.NewServeMux()
+	mux.HandleFunc("SET", func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("OK")
+	})
+	reg.HandleConfig(mux)
+
+	srv := &redis.Server{
+		Handler:     mux,
+		ReadTimeout: 2 * time.Second,
+	}
+	srv.RegisterTunables(reg)
+	defer srv.Close()
+	go srv.Serve(l)
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: l.Addr().String(), Transport: tr}
+
+	var name, value string
+	if err := redis.ParseArgs(cli.Query(ctx, "CONFIG", "GET", "read-timeout"), &name, &value); err != nil {
+		t.Fatal(err)
+	}
+	if name != "read-timeout" || value != "2000" {
+		t.Errorf("bad read-timeout: %s=%s", name, value)
+	}
+
+	if err := cli.Exec(ctx, "CONFIG", "SET", "read-timeout", "500"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := redis.ParseArgs(cli.Query(ctx, "CONFIG", "GET", "read-timeout"), &name, &value); err != nil {
+		t.Fatal(err)
+	}
+	if value != "500" {
+		t.Errorf("bad read-timeout after CONFIG SET: %s", value)
+	}
+
+	if err := cli.Exec(ctx, "CONFIG", "SET", "maxclients", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	other := &redis.Client{Addr: l.Addr().String(), Transport: &redis.Transport{}}
+
+	if err := other.Exec(ctx, "SET", "hello", "world"); err == nil {
+		t.Error("connections above the new maxclients should have been refused")
+	}
+}
+
+func testServerRenameCommands(t *testing.T, ctx context.Context) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			res.Write(req.Cmds[0].Cmd)
+		}),
+		RenameCommands: map[string]string{
+			"FLUSHALL": "secret-flushall",
+			"CONFIG":   "",
+		},
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: l.Addr().String(), Transport: tr}
+
+	tests := []struct {
+		cmd  string
+		name string
+		fail bool
+	}{
+		{cmd: "GET", name: "GET"},
+		{cmd: "secret-flushall", name: "FLUSHALL"},
+		{cmd: "FLUSHALL", fail: true},
+		{cmd: "config", fail: true},
+	}
+
+	for _, test := range tests {
+		var name string
+		err := redis.ParseArgs(cli.Query(ctx, test.cmd, "arg"), &name)
+
+		switch {
+		case test.fail && err == nil:
+			t.Errorf("%s: expected an error but the handler received %s", test.cmd, name)
+		case !test.fail && err != nil:
+			t.Errorf("%s: %s", test.cmd, err)
+		case !test.fail && name != test.name:
+			t.Errorf("%s: bad command name received by the handler: %s", test.cmd, name)
+		}
+	}
+}
+
 func newServer(handler redis.Handler) (srv *redis.Server, url string) {
 	return newServerTimeout(handler, 100*time.Millisecond)
 }
@@ -390,3 +592,71 @@ type testErrorListener struct {
 func (l *testErrorListener) Accept() (net.Conn, error) { return nil, l.err }
 func (l *testErrorListener) Addr() net.Addr            { return &testAddr{} }
 func (l *testErrorListener) Close() error              { return nil }
+
+func testServerCancelOnDisconnect(t *testing.T, ctx context.Context) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan string)
+	canceled := make(chan bool)
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			var key string
+			req.Cmds[0].ParseArgs(&key)
+			started <- key
+
+			select {
+			case <-req.Context.Done():
+				canceled <- true
+			case <-time.After(100 * time.Millisecond):
+				canceled <- false
+				res.Write("OK")
+			}
+		}),
+		CancelOnDisconnect: true,
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	send := func() net.Conn {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write([]byte("*2\r\n$3\r\nGET\r\n$5\r\nhello\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		if key := <-started; key != "hello" {
+			t.Error("bad key:", key)
+		}
+		return conn
+	}
+
+	conn := send()
+	conn.Close()
+
+	if !<-canceled {
+		t.Error("the request context was not canceled after the client disconnected")
+	}
+
+	conn = send()
+	defer conn.Close()
+
+	if <-canceled {
+		t.Error("the request context was canceled while the client was connected")
+	}
+
+	// The connection is still usable after the handler returned.
+	buf := make([]byte, 5)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "+OK\r\n" {
+		t.Errorf("bad response: %q", buf)
+	}
+}
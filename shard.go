@@ -0,0 +1,329 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrCrossShard is returned by ShardedTransport when the keys of a request hash
+// to different servers.
+var ErrCrossShard = errors.New("redis: the keys of the request hash to different servers")
+
+// ErrUnknownKeys is returned by ShardedTransport when the keys of a command
+// can't be found, because the command is unknown or its keys depend on more
+// than its arguments.
+var ErrUnknownKeys = errors.New("redis: the keys of the command can't be determined")
+
+// A ShardedTransport is a RoundTripper which distributes keys across a set of
+// independent redis servers by consistent hashing, like twemproxy does, so a
+// client can use them as a single data set:
+//
+//	client := &redis.Client{
+//		Transport: &redis.ShardedTransport{
+//			Servers: redis.ServerList{
+//				{Addr: "10.0.0.1:6379"},
+//				{Addr: "10.0.0.2:6379"},
+//				{Addr: "10.0.0.3:6379"},
+//			},
+//		},
+//	}
+//
+// Each request is sent to the server that the keys of its commands hash to,
+// the address of the request is ignored. Requests whose keys hash to different
+// servers fail with ErrCrossShard, requests without keys are sent to the first
+// server. Adding or removing a server only moves the keys of that server.
+//
+// The keys of commands are found from the specification of the standard redis
+// commands, at all their positions: the keys following STREAMS in XREAD, the
+// keys counted by numkeys in ZUNION, the destination of STORE in SORT, and the
+// keys of subcommands like OBJECT ENCODING. Requests with commands that are
+// unknown, or whose keys can't be found from their arguments like MIGRATE, fail
+// with ErrUnknownKeys, unless KeyRules describes them.
+//
+// To find the keys of the commands, the arguments of requests are loaded in
+// memory before being sent.
+type ShardedTransport struct {
+	// Transport is used to send requests. If nil, DefaultTransport is used.
+	Transport RoundTripper
+
+	// Servers exposes the list of servers that keys are distributed across.
+	// If nil, or if it returns no endpoints, requests are sent to their
+	// original address.
+	Servers ServerRegistry
+
+	// Hash, if not nil, is the hash function applied to keys to place them on
+	// the ring of servers. If nil, the 64 bits FNV-1a hash is used.
+	Hash func(key string) uint64
+
+	// HashTags, when true, hashes only the part of keys between braces when
+	// they have one, like redis cluster does, so related keys like
+	// "{user1000}.following" and "{user1000}.followers" are placed on the
+	// same server.
+	HashTags bool
+
+	// KeyRules configures the positions of the keys in the arguments of
+	// commands, it takes precedence over the specification of the standard
+	// redis commands, and describes the commands missing from it, like the
+	// commands of modules. Command names must be upper case.
+	KeyRules map[string]KeyRule
+
+	mutex     sync.Mutex
+	ring      hashRing
+	endpoints []ServerEndpoint
+}
+
+// A KeyRule describes the positions of the keys in the arguments of a command.
+type KeyRule struct {
+	// First is the index of the first key in the arguments of the command,
+	// a negative value means that the command has no keys.
+	First int
+
+	// Last is the index of the last key in the arguments of the command, a
+	// negative value counts from the end of the arguments, -1 being the last
+	// argument.
+	Last int
+
+	// Step is the distance between two keys. If zero, 1 is used.
+	Step int
+
+	// NumKeys, when true, means that the argument at index First holds the
+	// number of keys, which immediately follow it. Last and Step are ignored.
+	NumKeys bool
+}
+
+// RoundTrip satisfies the RoundTripper interface.
+func (t *ShardedTransport) RoundTrip(req *Request) (*Response, error) {
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ring, first, err := t.lookup(ctx)
+	if err != nil {
+		req.Close()
+		return nil, err
+	}
+
+	if ring == nil {
+		return t.transport().RoundTrip(req)
+	}
+
+	cmds := make([]Command, len(req.Cmds))
+	copy(cmds, req.Cmds)
+
+	for i := range cmds {
+		cmds[i].loadByteArgs()
+	}
+
+	addr := ""
+
+	for _, cmd := range cmds {
+		keys, err := t.keys(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			a := ring.lookupHash(t.hash(string(key)))
+
+			if len(addr) == 0 {
+				addr = a
+			} else if addr != a {
+				return nil, ErrCrossShard
+			}
+		}
+	}
+
+	if len(addr) == 0 {
+		addr = first
+	}
+
+	r := *req
+	r.Addr = addr
+	r.Cmds = cmds
+
+	res, err := t.transport().RoundTrip(&r)
+	if res != nil {
+		res.Request = req
+	}
+	return res, err
+}
+
+// Lookup returns the address of the server that key is placed on.
+func (t *ShardedTransport) Lookup(ctx context.Context, key string) (string, error) {
+	ring, _, err := t.lookup(ctx)
+	if err != nil || ring == nil {
+		return "", err
+	}
+	return ring.lookupHash(t.hash(key)), nil
+}
+
+// lookup returns the hash ring of the servers and the address of the first
+// one, the ring is only rebuilt when the list of servers changes.
+func (t *ShardedTransport) lookup(ctx context.Context) (hashRing, string, error) {
+	if t.Servers == nil {
+		return nil, "", nil
+	}
+
+	endpoints, err := t.Servers.LookupServers(ctx)
+	if err != nil || len(endpoints) == 0 {
+		return nil, "", err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !sameEndpoints(endpoints, t.endpoints) {
+		t.ring = makeShardRing(endpoints)
+		t.endpoints = endpoints
+	}
+
+	return t.ring, endpoints[0].Addr, nil
+}
+
+func (t *ShardedTransport) hash(key string) uint64 {
+	if t.HashTags {
+		key = hashTag(key)
+	}
+	if t.Hash != nil {
+		return t.Hash(key)
+	}
+	return fnv1a(key)
+}
+
+// keys returns the keys of cmd, whose arguments must be loaded in memory.
+func (t *ShardedTransport) keys(cmd Command) ([][]byte, error) {
+	if rule, ok := t.keyRule(cmd.Cmd); ok {
+		return rule.keys(cmd.Args), nil
+	}
+
+	var args [][]byte
+	if a, ok := cmd.Args.(*byteArgs); ok {
+		args = a.args
+	}
+
+	keys, ok := commandKeys(cmd.Cmd, args)
+	if !ok {
+		return nil, ErrUnknownKeys
+	}
+	return keys, nil
+}
+
+func (t *ShardedTransport) keyRule(cmd string) (KeyRule, bool) {
+	if rule, ok := t.KeyRules[cmd]; ok {
+		return rule, true
+	}
+	rule, ok := t.KeyRules[strings.ToUpper(cmd)]
+	return rule, ok
+}
+
+func (t *ShardedTransport) transport() RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return DefaultTransport
+}
+
+// keys returns the keys of args according to the rule. The arguments must be
+// loaded in memory.
+func (rule KeyRule) keys(args Args) [][]byte {
+	a, ok := args.(*byteArgs)
+	if !ok || rule.First < 0 || rule.First >= len(a.args) {
+		return nil
+	}
+
+	if rule.NumKeys {
+		n, err := strconv.Atoi(string(a.args[rule.First]))
+		if err != nil || n <= 0 {
+			return nil
+		}
+		first, last := rule.First+1, rule.First+1+n
+		if last > len(a.args) {
+			last = len(a.args)
+		}
+		return a.args[first:last]
+	}
+
+	last := rule.Last
+	if last < 0 {
+		last += len(a.args)
+	}
+	if last >= len(a.args) {
+		last = len(a.args) - 1
+	}
+
+	step := rule.Step
+	if step <= 0 {
+		step = 1
+	}
+
+	var keys [][]byte
+
+	for i := rule.First; i <= last; i += step {
+		keys = append(keys, a.args[i])
+	}
+
+	return keys
+}
+
+// shardRingReplication is the number of points of each server on the ring of a
+// ShardedTransport, the same as ketama.
+const shardRingReplication = 160
+
+// makeShardRing builds the ring of a ShardedTransport. Unlike makeHashRing,
+// the points of each server are hashed independently from "addr-i" and mixed,
+// so they are spread across the ring instead of being clustered around the
+// hash of the address, which would give most keys to a single server.
+func makeShardRing(endpoints []ServerEndpoint) hashRing {
+	ring := make(hashRing, 0, shardRingReplication*len(endpoints))
+
+	for _, endpoint := range endpoints {
+		for i := 0; i != shardRingReplication; i++ {
+			ring = append(ring, hashNode{
+				addr: endpoint.Addr,
+				hash: consistentHash(mix64(fnv1a(endpoint.Addr + "-" + strconv.Itoa(i)))),
+			})
+		}
+	}
+
+	sort.Sort(ring)
+	return ring
+}
+
+// mix64 is the finalizer of MurmurHash3, every bit of h affects every bit of
+// the result.
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// fnv1a is the 64 bits FNV-1a hash of s.
+func fnv1a(s string) uint64 {
+	const offset, prime = 14695981039346656037, 1099511628211
+	h := uint64(offset)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime
+	}
+	return h
+}
+
+func sameEndpoints(a []ServerEndpoint, b []ServerEndpoint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Addr != b[i].Addr {
+			return false
+		}
+	}
+	return true
+}
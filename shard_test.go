@@ -0,0 +1,202 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestShardedTransport(t *testing.T) {
+	var servers redis.ServerList
+	var names = map[string]string{}
+
+	for i := 0; i != 3; i++ {
+		name := fmt.Sprintf("server-%d", i)
+		srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			res.Write(name)
+		}))
+		defer srv.Close()
+		servers = append(servers, redis.ServerEndpoint{Name: name, Addr: url})
+		names[url] = name
+	}
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	ctx := context.Background()
+
+	// server returns the name of the server that the sharded transport maps
+	// key to.
+	server := func(t *testing.T, st *redis.ShardedTransport, key string) string {
+		addr, err := st.Lookup(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names[addr]
+	}
+
+	t.Run("keys are distributed across the servers", func(t *testing.T) {
+		st := &redis.ShardedTransport{Transport: tr, Servers: servers}
+		cli := &redis.Client{Transport: st}
+		found := map[string]int{}
+
+		for i := 0; i != 100; i++ {
+			key := fmt.Sprintf("key-%d", i)
+
+			name, err := redis.String(cli.Query(ctx, "SET", key, "value"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expect := server(t, st, key); name != expect {
+				t.Errorf("%s was sent to %s instead of %s", key, name, expect)
+			}
+			found[name]++
+		}
+
+		if len(found) != len(servers) {
+			t.Error("keys were not distributed across all servers:", found)
+		}
+	})
+
+	t.Run("removing a server only moves its keys", func(t *testing.T) {
+		st1 := &redis.ShardedTransport{Servers: servers}
+		st2 := &redis.ShardedTransport{Servers: servers[:2]}
+
+		for i := 0; i != 100; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			if s1, s2 := server(t, st1, key), server(t, st2, key); s1 != "server-2" && s1 != s2 {
+				t.Errorf("%s moved from %s to %s", key, s1, s2)
+			}
+		}
+	})
+
+	t.Run("multi-key commands with keys on different servers fail", func(t *testing.T) {
+		st := &redis.ShardedTransport{Transport: tr, Servers: servers}
+		cli := &redis.Client{Transport: st}
+
+		// Find two keys placed on different servers.
+		a, b := "key-0", ""
+		for i := 1; b == ""; i++ {
+			if key := fmt.Sprintf("key-%d", i); server(t, st, key) != server(t, st, a) {
+				b = key
+			}
+		}
+
+		// The keys at all the positions of commands are checked.
+		for _, cmd := range [][]interface{}{
+			{"MGET", a, b},
+			{"ZUNIONSTORE", a, "1", b},
+			{"ZINTERSTORE", a, "2", a, b},
+			{"SORT", a, "BY", "nosort", "STORE", b},
+			{"GEORADIUS", a, "0", "0", "1", "km", "STORE", b},
+			{"XREAD", "COUNT", "1", "STREAMS", a, b, "0-0", "0-0"},
+			{"RENAME", a, b},
+		} {
+			if err := cli.Exec(ctx, cmd[0].(string), cmd[1:]...); err != redis.ErrCrossShard {
+				t.Errorf("%v: expected ErrCrossShard but got %v", cmd, err)
+			}
+		}
+	})
+
+	tests := []struct {
+		scenario  string
+		transport *redis.ShardedTransport
+		cmd       string
+		args      []interface{}
+		key       string
+		err       error
+	}{
+		{
+			scenario: "commands are routed by the key of their rule",
+			cmd:      "EVAL",
+			args:     []interface{}{"return 1", "1", "key-1"},
+			key:      "key-1",
+		},
+		{
+			scenario: "commands without keys are sent to the first server",
+			cmd:      "DBSIZE",
+			key:      "",
+		},
+		{
+			scenario: "the keys of subcommands are found",
+			cmd:      "OBJECT",
+			args:     []interface{}{"ENCODING", "key-3"},
+			key:      "key-3",
+		},
+		{
+			scenario: "the keys counted by numkeys are found",
+			cmd:      "ZUNION",
+			args:     []interface{}{"1", "key-4", "WITHSCORES"},
+			key:      "key-4",
+		},
+		{
+			scenario: "commands with unknown keys fail",
+			cmd:      "HELLO.WORLD",
+			args:     []interface{}{"key-1"},
+			err:      redis.ErrUnknownKeys,
+		},
+		{
+			scenario: "commands whose keys can't be found from their arguments fail",
+			cmd:      "MIGRATE",
+			args:     []interface{}{"127.0.0.1", "6379", "", "0", "1000", "KEYS", "key-1"},
+			err:      redis.ErrUnknownKeys,
+		},
+		{
+			scenario:  "keys with the same hash tag are placed on the same server",
+			transport: &redis.ShardedTransport{HashTags: true},
+			cmd:       "MGET",
+			args:      []interface{}{"{user}.1", "{user}.2", "{user}.3", "{user}.4", "{user}.5"},
+			key:       "{user}.1",
+		},
+		{
+			scenario: "the hash function is pluggable",
+			transport: &redis.ShardedTransport{
+				Hash: func(string) uint64 { return 42 },
+			},
+			cmd:  "MGET",
+			args: []interface{}{"key-1", "key-2", "key-3", "key-4", "key-5"},
+			key:  "key-1",
+		},
+		{
+			scenario: "key rules are configurable per command",
+			transport: &redis.ShardedTransport{
+				KeyRules: map[string]redis.KeyRule{"CUSTOM": {First: 1, Last: 1}},
+			},
+			cmd:  "CUSTOM",
+			args: []interface{}{"arg", "key-7"},
+			key:  "key-7",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.scenario, func(t *testing.T) {
+			st := test.transport
+			if st == nil {
+				st = &redis.ShardedTransport{}
+			}
+			st.Transport, st.Servers = tr, servers
+
+			cli := &redis.Client{Transport: st}
+
+			name, err := redis.String(cli.Query(ctx, test.cmd, test.args...))
+			if err != test.err {
+				t.Fatal("bad error:", err)
+			}
+			if test.err != nil {
+				return
+			}
+
+			expect := "server-0"
+			if test.key != "" {
+				expect = server(t, st, test.key)
+			}
+
+			if name != expect {
+				t.Errorf("the command was sent to %s instead of %s", name, expect)
+			}
+		})
+	}
+}
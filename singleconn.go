@@ -0,0 +1,206 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// A SingleConnTransport is a RoundTripper which sends all requests on a single
+// connection. It is intended for programs like command line tools, serverless
+// functions, or sidecars, which send few requests and don't need the pool of
+// connections and the background goroutines of a Transport:
+//
+//	client := &redis.Client{
+//		Addr:      "localhost:6379",
+//		Transport: &redis.SingleConnTransport{},
+//	}
+//
+// The connection is dialed by the first request, and dialed again after
+// network errors or when a request is sent to a different address. Requests
+// are serialized, each request waits for the response of the previous one to
+// be closed. The connection is never pinged while idle, programs which may
+// leave it idle for longer than the server timeout should configure retries
+// on their client.
+type SingleConnTransport struct {
+	// Transport configures the connection (dialer, TLS, credentials, setup
+	// commands, ...), its pool and pinger are never started. If nil, the
+	// default configuration of a Transport is used.
+	Transport *Transport
+
+	once   sync.Once
+	lock   chan struct{}
+	config *Transport
+	conn   *Conn
+	addr   string
+}
+
+// RoundTrip satisfies the RoundTripper interface.
+func (t *SingleConnTransport) RoundTrip(req *Request) (*Response, error) {
+	t.once.Do(t.init)
+
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	select {
+	case t.lock <- struct{}{}:
+	case <-ctx.Done():
+		req.Close()
+		return nil, ctx.Err()
+	}
+
+	conn, err := t.connect(ctx, req.Addr)
+	if err != nil {
+		<-t.lock
+		req.Close()
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+
+	err = conn.WriteCommands(req.Cmds...)
+	req.Close()
+	conn.SetWriteDeadline(time.Time{})
+
+	if err != nil {
+		laddr := conn.LocalAddr()
+		raddr := conn.RemoteAddr()
+		t.release(err)
+		return nil, &net.OpError{Op: "request", Net: "redis", Source: laddr, Addr: raddr, Err: err}
+	}
+
+	cancel := watchCancel(ctx, conn)
+
+	switch {
+	case req.IsTransaction():
+		args := conn.ReadTxArgs(len(req.Cmds) - 2)
+		return &Response{
+			TxArgs: &singleConnTxArgs{
+				singleConnPutter: singleConnPutter{transport: t, cancel: cancel},
+				TxArgs:           args,
+			},
+			Request: req,
+		}, nil
+
+	case req.IsPipeline():
+		args := conn.ReadPipelineArgs(len(req.Cmds))
+		return &Response{
+			TxArgs: &singleConnTxArgs{
+				singleConnPutter: singleConnPutter{transport: t, cancel: cancel},
+				TxArgs:           args,
+			},
+			Request: req,
+		}, nil
+
+	default:
+		args := conn.ReadArgs()
+		args.Len() // waits for the first bytes of the response to arrive
+		return &Response{
+			Args: &singleConnArgs{
+				singleConnPutter: singleConnPutter{transport: t, cancel: cancel},
+				Args:             args,
+			},
+			Request: req,
+		}, nil
+	}
+}
+
+// CloseIdleConnections closes the connection of the transport if no requests
+// are using it.
+func (t *SingleConnTransport) CloseIdleConnections() {
+	t.once.Do(t.init)
+
+	select {
+	case t.lock <- struct{}{}:
+		t.closeConn()
+		<-t.lock
+	default:
+	}
+}
+
+func (t *SingleConnTransport) init() {
+	t.lock = make(chan struct{}, 1)
+
+	if t.config = t.Transport; t.config == nil {
+		t.config = &Transport{}
+	}
+}
+
+// connect returns the connection to addr, dialing it if needed. It must be
+// called while holding the lock.
+func (t *SingleConnTransport) connect(ctx context.Context, addr string) (*Conn, error) {
+	if t.conn != nil && t.addr == addr {
+		return t.conn, nil
+	}
+
+	t.closeConn()
+
+	t.config.setupOnce.Do(t.config.initSetup)
+	network, address := splitNetworkAddress(addr)
+
+	conn, err := t.config.dial(ctx, network, address)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = &net.OpError{Op: "dial", Net: "redis", Err: ctxErr}
+		}
+		return nil, err
+	}
+
+	t.conn, t.addr = conn, addr
+	return conn, nil
+}
+
+func (t *SingleConnTransport) closeConn() {
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+}
+
+// release unlocks the transport when a request completed, discarding the
+// connection if err indicates that it is no longer usable.
+func (t *SingleConnTransport) release(err error) {
+	if err != nil && !isStableError(err) {
+		t.closeConn()
+	}
+	<-t.lock
+}
+
+type singleConnPutter struct {
+	transport *SingleConnTransport
+	cancel    *cancelWatcher
+	once      sync.Once
+}
+
+func (c *singleConnPutter) close(err error) error {
+	err = c.cancel.close(err)
+	c.once.Do(func() { c.transport.release(err) })
+	return err
+}
+
+type singleConnArgs struct {
+	singleConnPutter
+	Args
+}
+
+func (a *singleConnArgs) Close() error {
+	return a.singleConnPutter.close(a.Args.Close())
+}
+
+func (a *singleConnArgs) NextType() Type {
+	return NextType(a.Args)
+}
+
+type singleConnTxArgs struct {
+	singleConnPutter
+	TxArgs
+}
+
+func (a *singleConnTxArgs) Close() error {
+	return a.singleConnPutter.close(a.TxArgs.Close())
+}
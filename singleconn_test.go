@@ -0,0 +1,118 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestSingleConnTransport(t *testing.T) {
+	var mutex sync.Mutex
+	var conns = map[*rawConn]bool{}
+	var names []string
+
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		conns[c] = true
+
+		switch cmd {
+		case "CLIENT":
+			if args[0] == "SETNAME" {
+				names = append(names, args[1])
+				return "+OK\r\n"
+			}
+			return "" // other setup commands of the transport
+		case "GET":
+			return "$5\r\nhello\r\n"
+		case "DEBUG":
+			c.Close()
+			return ""
+		default:
+			return "-ERR unknown command\r\n"
+		}
+	})
+
+	connections := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(conns)
+	}
+
+	tr := &redis.SingleConnTransport{Transport: &redis.Transport{ClientName: "single"}}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+	ctx := context.Background()
+
+	t.Run("requests are sent on a single connection", func(t *testing.T) {
+		var wg sync.WaitGroup
+
+		for i := 0; i != 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if s, err := redis.String(cli.Query(ctx, "GET", "key")); err != nil {
+					t.Error(err)
+				} else if s != "hello" {
+					t.Error("bad value:", s)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if n := connections(); n != 1 {
+			t.Error("bad number of connections:", n)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if len(names) != 1 || names[0] != "single" {
+			t.Error("the connection was not setup with the configuration of the transport:", names)
+		}
+	})
+
+	t.Run("errors returned by the server do not discard the connection", func(t *testing.T) {
+		if err := cli.Exec(ctx, "UNKNOWN"); err == nil {
+			t.Error("expected an error")
+		}
+
+		if err := cli.Exec(ctx, "GET", "key"); err != nil {
+			t.Error(err)
+		}
+
+		if n := connections(); n != 1 {
+			t.Error("bad number of connections:", n)
+		}
+	})
+
+	t.Run("the connection is dialed again after the server closed it", func(t *testing.T) {
+		if err := cli.Exec(ctx, "DEBUG", "SLEEP", "0"); err == nil {
+			t.Error("expected an error")
+		}
+
+		if err := cli.Exec(ctx, "GET", "key"); err != nil {
+			t.Error(err)
+		}
+
+		if n := connections(); n != 2 {
+			t.Error("bad number of connections:", n)
+		}
+	})
+
+	t.Run("closing idle connections closes the connection", func(t *testing.T) {
+		tr.CloseIdleConnections()
+
+		if err := cli.Exec(ctx, "GET", "key"); err != nil {
+			t.Error(err)
+		}
+
+		if n := connections(); n != 3 {
+			t.Error("bad number of connections:", n)
+		}
+	})
+}
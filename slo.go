@@ -0,0 +1,302 @@
+package redis
+
+import (
+	"sync"
+	"time"
+)
+
+// An SLO tracks the latency of requests against objectives set per class of
+// commands, and reports how fast the error budget of each objective is burnt.
+//
+// The burn rate over a window is the fraction of requests slower than the
+// objective during the window, divided by the fraction allowed by the target.
+// A burn rate of 1 consumes exactly the error budget over the period of the
+// objective, higher values exhaust it early. Alerts fire when the burn rate of
+// their window crosses their threshold, and resolve when it drops below.
+//
+// Servers and proxies configured with an SLO feed it the latency of every
+// request they serve, programs may also call Observe directly:
+//
+//	slo := &redis.SLO{
+//		Objectives: map[redis.CommandClass]redis.Objective{
+//			redis.ClassRead:  {Latency: 2 * time.Millisecond, Target: 0.999},
+//			redis.ClassWrite: {Latency: 5 * time.Millisecond, Target: 0.99},
+//		},
+//		OnBurn: func(event redis.BurnEvent) {
+//			log.Printf("%s requests burn their error budget %.1fx faster than allowed over %s",
+//				event.Class, event.Rate, event.Window)
+//		},
+//	}
+//
+//	server := &redis.Server{Handler: proxy, SLO: slo}
+//
+// SLO values must not be copied after first use.
+type SLO struct {
+	// Objectives maps classes of commands to their latency objective.
+	// Requests of classes without an objective are not tracked.
+	Objectives map[CommandClass]Objective
+
+	// Alerts is the list of burn rate alerts evaluated for each objective. If
+	// nil, DefaultBurnAlerts is used.
+	Alerts []BurnAlert
+
+	// OnBurn, if not nil, is called when an alert fires or resolves. Alerts
+	// are evaluated when requests are observed, the function is called by the
+	// goroutines serving requests and must not block.
+	OnBurn func(BurnEvent)
+
+	once    sync.Once
+	classes map[CommandClass]*sloClass
+}
+
+// Objective is the latency objective of a class of commands.
+type Objective struct {
+	// Latency is the duration above which requests are considered too slow.
+	Latency time.Duration
+
+	// Target is the fraction of requests that must be faster than Latency,
+	// for example 0.999. It must be lower than 1, which would leave no error
+	// budget.
+	Target float64
+}
+
+// BurnAlert configures an alert firing when the burn rate of the error budget
+// over Window exceeds Threshold.
+type BurnAlert struct {
+	// Window is the duration over which the burn rate is computed, it must be
+	// positive.
+	Window time.Duration
+
+	// Threshold is the burn rate above which the alert fires.
+	Threshold float64
+
+	// MinRequests is the number of requests that must be observed during the
+	// window for the alert to fire, so a few slow requests on an idle server
+	// don't fire alerts. If zero, any number of requests may fire the alert.
+	MinRequests int64
+}
+
+// DefaultBurnAlerts are the alerts used by SLOs which don't configure any. They
+// are the fast and slow burn alerts commonly used with 30 days objectives: the
+// first one fires when 2% of the error budget is consumed in an hour, the
+// second one when 5% is consumed in six hours. Both need at least 100 requests
+// in their window.
+var DefaultBurnAlerts = []BurnAlert{
+	{Window: time.Hour, Threshold: 14.4, MinRequests: 100},
+	{Window: 6 * time.Hour, Threshold: 6, MinRequests: 100},
+}
+
+// BurnEvent is passed to the OnBurn function of an SLO when an alert fires or
+// resolves.
+type BurnEvent struct {
+	Class     CommandClass
+	Window    time.Duration
+	Threshold float64
+	Rate      float64 // burn rate at the time of the event
+	Firing    bool    // true when the alert fires, false when it resolves
+}
+
+// sloBuckets is the number of buckets that the window of each alert is divided
+// into, requests leave the window one bucket at a time.
+const sloBuckets = 10
+
+// sloClass carries the counters of requests of a class, one per alert.
+type sloClass struct {
+	objective Objective
+	mutex     sync.Mutex
+	windows   []sloWindow
+	firing    []bool
+}
+
+// sloWindow counts the requests of a window in a ring of buckets, and keeps
+// the sums of the buckets so the burn rate is computed without scanning them.
+// The buckets expired since the last request are subtracted from the sums
+// when the next one is observed.
+type sloWindow struct {
+	width   time.Duration
+	slot    int64 // index of the time slot of the latest bucket, since the epoch
+	buckets [sloBuckets]sloBucket
+	total   int64
+	slow    int64
+}
+
+type sloBucket struct {
+	total int64
+	slow  int64
+}
+
+// Observe records a request of the given class which took elapsed to be
+// served. The method is safe to call on a nil value, it does nothing in that
+// case.
+func (s *SLO) Observe(class CommandClass, elapsed time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.once.Do(s.init)
+
+	c := s.classes[class]
+	if c == nil {
+		return
+	}
+
+	var events []BurnEvent
+	now := time.Now()
+	slow := elapsed > c.objective.Latency
+
+	c.mutex.Lock()
+	for i, alert := range s.alerts() {
+		w := &c.windows[i]
+		w.observe(now, slow)
+		rate := w.burnRate(c.objective)
+
+		if firing := rate >= alert.Threshold && w.total >= alert.MinRequests; firing != c.firing[i] {
+			c.firing[i] = firing
+			events = append(events, BurnEvent{
+				Class:     class,
+				Window:    alert.Window,
+				Threshold: alert.Threshold,
+				Rate:      rate,
+				Firing:    firing,
+			})
+		}
+	}
+	c.mutex.Unlock()
+
+	if s.OnBurn != nil {
+		for _, event := range events {
+			s.OnBurn(event)
+		}
+	}
+}
+
+// BurnRate returns the current burn rate of the error budget of class over
+// window, which must be the window of one of the alerts, the burn rate over
+// other windows is not tracked and zero is returned.
+func (s *SLO) BurnRate(class CommandClass, window time.Duration) float64 {
+	s.once.Do(s.init)
+
+	c := s.classes[class]
+	if c == nil {
+		return 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, alert := range s.alerts() {
+		if alert.Window == window {
+			w := &c.windows[i]
+			w.expire(time.Now())
+			return w.burnRate(c.objective)
+		}
+	}
+
+	return 0
+}
+
+// Firing returns true if any of the alerts of class is firing.
+func (s *SLO) Firing(class CommandClass) bool {
+	s.once.Do(s.init)
+
+	c := s.classes[class]
+	if c == nil {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, firing := range c.firing {
+		if firing {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *SLO) init() {
+	alerts := s.alerts()
+
+	for _, alert := range alerts {
+		if alert.Window <= 0 {
+			panic("redis: invalid SLO alert window " + alert.Window.String())
+		}
+	}
+
+	s.classes = make(map[CommandClass]*sloClass, len(s.Objectives))
+
+	for class, objective := range s.Objectives {
+		c := &sloClass{
+			objective: objective,
+			windows:   make([]sloWindow, len(alerts)),
+			firing:    make([]bool, len(alerts)),
+		}
+
+		for i, alert := range alerts {
+			c.windows[i].width = alert.Window / sloBuckets
+			if c.windows[i].width <= 0 {
+				c.windows[i].width = 1
+			}
+		}
+
+		s.classes[class] = c
+	}
+}
+
+func (s *SLO) alerts() []BurnAlert {
+	if len(s.Alerts) != 0 {
+		return s.Alerts
+	}
+	return DefaultBurnAlerts
+}
+
+// observeRequest records req, the class of transactions is the highest class
+// of their commands.
+func (s *SLO) observeRequest(req *Request, elapsed time.Duration) {
+	if s != nil && len(req.Cmds) != 0 {
+		s.Observe(classOfRequest(req), elapsed)
+	}
+}
+
+func (w *sloWindow) observe(now time.Time, slow bool) {
+	w.expire(now)
+
+	b := &w.buckets[w.slot%sloBuckets]
+	b.total++
+	w.total++
+
+	if slow {
+		b.slow++
+		w.slow++
+	}
+}
+
+// expire moves the window to the time slot of now, removing the requests of
+// the buckets which left the window from the sums.
+func (w *sloWindow) expire(now time.Time) {
+	slot := now.UnixNano() / int64(w.width)
+
+	if slot-w.slot >= sloBuckets {
+		*w = sloWindow{width: w.width, slot: slot}
+		return
+	}
+
+	for ; w.slot < slot; w.slot++ {
+		b := &w.buckets[(w.slot+1)%sloBuckets]
+		w.total -= b.total
+		w.slow -= b.slow
+		*b = sloBucket{}
+	}
+}
+
+func (w *sloWindow) burnRate(objective Objective) float64 {
+	budget := 1 - objective.Target
+
+	if w.total == 0 || budget <= 0 {
+		return 0
+	}
+
+	return (float64(w.slow) / float64(w.total)) / budget
+}
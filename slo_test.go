@@ -0,0 +1,185 @@
+package redis_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestSLO(t *testing.T) {
+	var mutex sync.Mutex
+	var events []redis.BurnEvent
+
+	slo := &redis.SLO{
+		Objectives: map[redis.CommandClass]redis.Objective{
+			redis.ClassRead: {Latency: time.Millisecond, Target: 0.9},
+		},
+		Alerts: []redis.BurnAlert{
+			{Window: 100 * time.Millisecond, Threshold: 2},
+		},
+		OnBurn: func(event redis.BurnEvent) {
+			mutex.Lock()
+			events = append(events, event)
+			mutex.Unlock()
+		},
+	}
+
+	lastEvent := func() (redis.BurnEvent, int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if len(events) == 0 {
+			return redis.BurnEvent{}, 0
+		}
+		return events[len(events)-1], len(events)
+	}
+
+	for i := 0; i != 10; i++ {
+		slo.Observe(redis.ClassRead, 100*time.Microsecond)
+	}
+
+	// Requests of classes without objectives are ignored.
+	slo.Observe(redis.ClassWrite, time.Second)
+
+	if rate := slo.BurnRate(redis.ClassRead, 100*time.Millisecond); rate != 0 {
+		t.Error("bad burn rate with fast requests only:", rate)
+	}
+
+	// One third of the requests are too slow while the target allows one
+	// tenth, the budget burns more than three times faster than allowed.
+	for i := 0; i != 5; i++ {
+		slo.Observe(redis.ClassRead, 2*time.Millisecond)
+	}
+
+	if rate := slo.BurnRate(redis.ClassRead, 100*time.Millisecond); rate < 3.3 || rate > 3.4 {
+		t.Error("bad burn rate with slow requests:", rate)
+	}
+
+	if event, n := lastEvent(); n != 1 || !event.Firing || event.Class != redis.ClassRead || event.Threshold != 2 {
+		t.Errorf("the alert must fire when the burn rate crosses the threshold: %+v", event)
+	}
+
+	if !slo.Firing(redis.ClassRead) {
+		t.Error("the alert must be reported as firing")
+	}
+
+	// The slow requests leave the window, the alert resolves on the next
+	// request.
+	time.Sleep(150 * time.Millisecond)
+	slo.Observe(redis.ClassRead, 100*time.Microsecond)
+
+	if event, n := lastEvent(); n != 2 || event.Firing || event.Rate != 0 {
+		t.Errorf("the alert must resolve when the burn rate drops below the threshold: %+v", event)
+	}
+
+	if slo.Firing(redis.ClassRead) {
+		t.Error("the alert must not be reported as firing anymore")
+	}
+}
+
+func TestSLOMinRequests(t *testing.T) {
+	slo := &redis.SLO{
+		Objectives: map[redis.CommandClass]redis.Objective{
+			redis.ClassRead: {Latency: time.Millisecond, Target: 0.9},
+		},
+		Alerts: []redis.BurnAlert{
+			{Window: time.Minute, Threshold: 2, MinRequests: 10},
+		},
+	}
+
+	// A single slow request burns the budget ten times faster than allowed,
+	// but the window doesn't have enough requests to fire the alert yet.
+	slo.Observe(redis.ClassRead, 2*time.Millisecond)
+
+	if rate := slo.BurnRate(redis.ClassRead, time.Minute); rate < 9.9 || rate > 10.1 {
+		t.Error("bad burn rate:", rate)
+	}
+
+	if slo.Firing(redis.ClassRead) {
+		t.Error("the alert must not fire with less than MinRequests requests")
+	}
+
+	for i := 0; i != 9; i++ {
+		slo.Observe(redis.ClassRead, 2*time.Millisecond)
+	}
+
+	if !slo.Firing(redis.ClassRead) {
+		t.Error("the alert must fire once MinRequests requests were observed")
+	}
+
+	// Only the windows of the alerts are tracked.
+	if rate := slo.BurnRate(redis.ClassRead, time.Hour); rate != 0 {
+		t.Error("bad burn rate over a window without alerts:", rate)
+	}
+}
+
+func TestSLOInvalidWindow(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("alerts with a zero window must be rejected")
+		}
+	}()
+
+	slo := &redis.SLO{
+		Objectives: map[redis.CommandClass]redis.Objective{
+			redis.ClassRead: {Latency: time.Millisecond, Target: 0.9},
+		},
+		Alerts: []redis.BurnAlert{{Threshold: 2}},
+	}
+
+	slo.Observe(redis.ClassRead, time.Millisecond)
+}
+
+func TestServerSLO(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slo := &redis.SLO{
+		Objectives: map[redis.CommandClass]redis.Objective{
+			redis.ClassRead:  {Latency: time.Millisecond, Target: 0.99},
+			redis.ClassWrite: {Latency: time.Second, Target: 0.99},
+		},
+		Alerts: []redis.BurnAlert{
+			{Window: time.Minute, Threshold: 10},
+		},
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			if req.Cmds[0].Cmd == "GET" {
+				time.Sleep(2 * time.Millisecond)
+			}
+			res.Write("OK")
+		}),
+		SLO: slo,
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: l.Addr().String(), Transport: tr}
+	ctx := context.Background()
+
+	if err := cli.Exec(ctx, "GET", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Exec(ctx, "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slo.Firing(redis.ClassRead) {
+		t.Error("slow reads must burn the error budget of their objective")
+	}
+
+	if slo.Firing(redis.ClassWrite) {
+		t.Error("fast writes must not burn the error budget of their objective")
+	}
+}
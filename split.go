@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/fasthash/jody"
+)
+
+// TrafficSplit routes a share of the keys of a ProxyRoute to another pool of
+// upstream servers, to migrate a keyspace between clusters online.
+//
+// Keys are selected by a stable hash, a key is always routed to the same pool
+// for a given percentage, and raising the percentage only moves keys from the
+// pool of the route to the pool of the split.
+type TrafficSplit struct {
+	// Registry exposes the upstream servers of the pool that the share of
+	// the keys is routed to.
+	Registry ServerRegistry
+
+	// Percent is the percentage of the keys routed to Registry, between 0 and
+	// 100. The value can be changed while the proxy is serving requests, by
+	// the program or with CONFIG SET when the tunable is registered on a
+	// TunableRegistry, or gradually with Ramp.
+	Percent IntTunable
+
+	// DualWrite, when true, mirrors the writes to the other pool: writes of
+	// the keys routed to Registry are also sent to the pool of the route, and
+	// the other way around. Mirroring keeps both pools up to date, so the
+	// migration can be rolled back by lowering Percent.
+	//
+	// Mirrored writes are sent after the response of the pool that the key
+	// is routed to was written to the client, their errors are logged. They
+	// are sent before the next request of the client connection is served,
+	// which keeps them in the order of the client, but adds the latency of
+	// the other pool to the requests that the client pipelines after a write.
+	DualWrite bool
+}
+
+// Ramp changes the percentage of the keys routed to the pool of the split to
+// percent, one point at a time at regular intervals over the given duration.
+// The method blocks until the percentage was reached or ctx is canceled. When
+// the duration is too short to be divided in steps, the percentage is changed
+// at once.
+func (split *TrafficSplit) Ramp(ctx context.Context, percent int64, duration time.Duration) error {
+	if percent < 0 || percent > 100 {
+		return errors.New("redis: the percentage of a traffic split must be between 0 and 100")
+	}
+
+	from := split.Percent.Load()
+	steps := percent - from
+	if steps < 0 {
+		steps = -steps
+	}
+
+	if steps == 0 {
+		return nil
+	}
+
+	interval := duration / time.Duration(steps)
+	if interval <= 0 {
+		split.Percent.Store(percent)
+		return nil
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for p := from; p != percent; {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if p < percent {
+			p++
+		} else {
+			p--
+		}
+
+		split.Percent.Store(p)
+	}
+
+	return nil
+}
+
+// contains returns true if key is routed to the pool of the split.
+func (split *TrafficSplit) contains(key string) bool {
+	return int64(jody.HashString64(key)%100) < split.Percent.Load()
+}
+
+// mirror sends cmds, a copy of the write commands of req, to the pool exposed
+// by r. The context is the one of the request received by the proxy.
+func (proxy *ReverseProxy) mirror(ctx context.Context, req *Request, r ServerRegistry, keys []string, cmds []Command) {
+	ctx, cancel := WithDeadlineBudget(ctx, proxy.DeadlineMargin)
+	defer cancel()
+
+	upstream, err := proxy.lookupUpstream(ctx, r, keys)
+	if err != nil {
+		proxy.logRequest(req, err)
+		return
+	}
+
+	res, err := proxy.roundTrip(&Request{
+		Addr:    upstream,
+		Cmds:    cmds,
+		Context: ctx,
+	})
+
+	if err == nil {
+		err = res.Close()
+	}
+
+	if err != nil {
+		proxy.logRequest(req, err)
+	}
+}
+
+// loadCommands returns a copy of cmds with their arguments loaded in memory,
+// the arguments of cmds are consumed. The commands can then be sent to multiple
+// upstream servers, each of them getting its own copy made by copyByteArgs.
+func loadCommands(cmds []Command) []Command {
+	loaded := make([]Command, len(cmds))
+	copy(loaded, cmds)
+
+	for i := range loaded {
+		loaded[i].loadByteArgs()
+	}
+
+	return loaded
+}
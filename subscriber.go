@@ -24,11 +24,28 @@ type SubConn struct {
 	wmtx sync.Mutex
 	wbuf bufio.Writer
 	enc  objconv.Encoder
+
+	stats backlogStats
+
+	// closed is closed by Close, it stops the goroutine of Messages when the
+	// program stops receiving messages.
+	once   sync.Once
+	closed chan struct{}
+
+	// release, if not nil, is called when the connection is closed, it
+	// unregisters the subscriptions of clients from their Close method.
+	release func()
+}
+
+// SubMessage is a message received on a SubConn.
+type SubMessage struct {
+	Channel string
+	Payload []byte
 }
 
 // NewSubConn creates a new SubConn from a pre-existing network connection.
 func NewSubConn(conn net.Conn) *SubConn {
-	sub := &SubConn{conn: conn}
+	sub := &SubConn{conn: conn, closed: make(chan struct{})}
 	sub.rbuf.Reset(conn)
 	sub.wbuf.Reset(conn)
 	sub.dec = *resp.NewDecoder(&sub.rbuf)
@@ -109,9 +126,70 @@ func (sub *SubConn) ReadMessage() (channel string, message []byte, err error) {
 	}
 }
 
+// Messages starts reading messages from the connection in a background
+// goroutine and returns a channel they are delivered on. Up to size messages
+// are buffered, when the program falls further behind the policy decides what
+// happens to new messages: BacklogBlock stops reading from the connection until
+// the program catches up, BacklogDisconnect closes the connection, and the
+// drop policies discard messages. Zero or negative sizes mean
+// DefaultBrokerMaxPending.
+//
+// The channel is closed after the connection was lost and the buffered
+// messages were received, or right away when Close is called, dropping the
+// buffered messages, so programs which stop receiving messages must call Close
+// to release the goroutines of the subscription. Messages must be called at
+// most once and must not be mixed with calls to ReadMessage.
+func (sub *SubConn) Messages(size int, policy BacklogPolicy) <-chan SubMessage {
+	if size <= 0 {
+		size = DefaultBrokerMaxPending
+	}
+
+	b := newBacklog(size, policy, 0, &sub.stats, func() { sub.conn.Close() })
+	c := make(chan SubMessage)
+
+	go func() {
+		defer b.close()
+		for {
+			channel, message, err := sub.ReadMessage()
+			if err != nil {
+				return
+			}
+			b.push(SubMessage{Channel: channel, Payload: message}, true)
+		}
+	}()
+
+	go func() {
+		defer close(c)
+		for {
+			v, ok := b.pop()
+			if !ok {
+				return
+			}
+			select {
+			case c <- v.(SubMessage):
+			case <-sub.closed:
+				return
+			}
+		}
+	}()
+
+	return c
+}
+
+// Stats returns the counters of messages buffered by Messages.
+func (sub *SubConn) Stats() BacklogStats {
+	return sub.stats.load()
+}
+
 // Close closes the connection, writing commands or reading messages from the
 // connection after Close was called will return errors.
 func (sub *SubConn) Close() error {
+	sub.once.Do(func() {
+		close(sub.closed)
+		if sub.release != nil {
+			sub.release()
+		}
+	})
 	return sub.conn.Close()
 }
 
@@ -0,0 +1,235 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A TracingTransport is a RoundTripper which starts a span with its Tracer for
+// every request, and ends it when the response is closed, or when the request
+// fails. The context of the span is propagated to the underlying transport
+// through the request, so connections dialed on behalf of the request and
+// requests sent by nested transports are traced as its children.
+//
+// The package doesn't depend on a tracing library, the Tracer interface is
+// meant to be implemented by adapters. For example, with OpenTelemetry:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, req *redis.Request) (context.Context, redis.Span) {
+//		ctx, span := t.Tracer.Start(ctx, redis.SpanName(req),
+//			trace.WithSpanKind(trace.SpanKindClient),
+//			trace.WithAttributes(
+//				attribute.String("db.system", "redis"),
+//				attribute.String("server.address", req.Addr),
+//			),
+//		)
+//		return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ trace.Span }
+//
+//	func (s otelSpan) End(info redis.SpanInfo) {
+//		s.SetAttributes(attribute.Int("db.response.values", info.Values))
+//		if info.Err != nil {
+//			s.RecordError(info.Err)
+//			s.SetStatus(codes.Error, info.Err.Error())
+//		}
+//		s.Span.End()
+//	}
+//
+//	client := &redis.Client{
+//		Addr: "localhost:6379",
+//		Transport: &redis.TracingTransport{
+//			Tracer: otelTracer{otel.Tracer("redis")},
+//		},
+//	}
+type TracingTransport struct {
+	// Transport is used to send the requests. If nil, DefaultTransport is
+	// used.
+	Transport RoundTripper
+
+	// Tracer starts the spans of requests. If nil, requests are not traced.
+	Tracer Tracer
+}
+
+// A Tracer starts the spans of requests sent by a TracingTransport.
+type Tracer interface {
+	// Start starts a span for req, and returns a context carrying the span,
+	// which is used to send the request. The request must not be modified.
+	Start(ctx context.Context, req *Request) (context.Context, Span)
+}
+
+// A Span is the unit of work of a request traced by a TracingTransport.
+type Span interface {
+	// End is called once, when the response is closed or when the request
+	// fails.
+	End(info SpanInfo)
+}
+
+// SpanInfo carries the outcome of a traced request.
+type SpanInfo struct {
+	// Addr is the address that the request was sent to.
+	Addr string
+
+	// Values is the number of values read from the response, for
+	// transactions and pipelines it sums the values of all commands.
+	Values int
+
+	// Err is the error of the request, or the first error of the response,
+	// including redis error replies. Err is nil if the request succeeded.
+	Err error
+}
+
+// SpanName returns a name for the span of req: the upper-case name of its
+// command, or MULTI and PIPELINE for transactions and pipelines.
+func SpanName(req *Request) string {
+	switch {
+	case req.IsTransaction():
+		return "MULTI"
+	case len(req.Cmds) > 1:
+		return "PIPELINE"
+	case len(req.Cmds) == 1:
+		return strings.ToUpper(req.Cmds[0].Cmd)
+	default:
+		return ""
+	}
+}
+
+// RoundTrip satisfies the RoundTripper interface.
+func (t *TracingTransport) RoundTrip(req *Request) (*Response, error) {
+	if t.Tracer == nil {
+		return t.transport().RoundTrip(req)
+	}
+
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx, span := t.Tracer.Start(ctx, req)
+
+	r := *req
+	r.Context = ctx
+
+	res, err := t.transport().RoundTrip(&r)
+	if err != nil {
+		span.End(SpanInfo{Addr: req.Addr, Err: err})
+		return nil, err
+	}
+
+	tr := &tracedResponse{span: span, addr: req.Addr}
+	res.Request = req
+
+	if res.TxArgs != nil {
+		res.TxArgs = &tracedTxArgs{TxArgs: res.TxArgs, res: tr}
+		if res.Args != nil {
+			res.Args = &tracedArgs{Args: res.Args, res: tr}
+		}
+	} else {
+		res.Args = &tracedArgs{Args: res.Args, res: tr, end: true}
+	}
+
+	return res, nil
+}
+
+// CloseIdleConnections closes the idle connections of the underlying
+// transport, if it supports it.
+func (t *TracingTransport) CloseIdleConnections() {
+	if c, ok := t.transport().(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+func (t *TracingTransport) transport() RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return DefaultTransport
+}
+
+// tracedResponse accumulates the outcome of a response until its span ends.
+type tracedResponse struct {
+	span   Span
+	addr   string
+	values int64
+	once   sync.Once
+	mutex  sync.Mutex
+	err    error
+}
+
+func (r *tracedResponse) fail(err error) {
+	if err != nil {
+		r.mutex.Lock()
+		if r.err == nil {
+			r.err = err
+		}
+		r.mutex.Unlock()
+	}
+}
+
+func (r *tracedResponse) end(err error) {
+	r.fail(err)
+	r.once.Do(func() {
+		r.mutex.Lock()
+		err := r.err
+		r.mutex.Unlock()
+
+		r.span.End(SpanInfo{
+			Addr:   r.addr,
+			Values: int(atomic.LoadInt64(&r.values)),
+			Err:    err,
+		})
+	})
+}
+
+// tracedArgs counts the values read from an argument list, and ends the span
+// of the response when it's closed if end is true.
+type tracedArgs struct {
+	Args
+	res *tracedResponse
+	end bool
+}
+
+func (args *tracedArgs) Next(dst interface{}) bool {
+	if !args.Args.Next(dst) {
+		return false
+	}
+	atomic.AddInt64(&args.res.values, 1)
+	return true
+}
+
+func (args *tracedArgs) NextType() Type {
+	return NextType(args.Args)
+}
+
+func (args *tracedArgs) Close() error {
+	err := args.Args.Close()
+	if args.end {
+		args.res.end(err)
+	} else {
+		args.res.fail(err)
+	}
+	return err
+}
+
+type tracedTxArgs struct {
+	TxArgs
+	res *tracedResponse
+}
+
+func (tx *tracedTxArgs) Next() Args {
+	args := tx.TxArgs.Next()
+	if args == nil {
+		return nil
+	}
+	return &tracedArgs{Args: args, res: tx.res}
+}
+
+func (tx *tracedTxArgs) Close() error {
+	err := tx.TxArgs.Close()
+	tx.res.end(err)
+	return err
+}
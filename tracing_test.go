@@ -0,0 +1,191 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+type spanKey struct{}
+
+type testSpan struct {
+	name string
+	info redis.SpanInfo
+}
+
+type testTracer struct {
+	mutex sync.Mutex
+	spans []*testSpan
+	ended chan *testSpan
+}
+
+func newTestTracer() *testTracer {
+	return &testTracer{ended: make(chan *testSpan, 10)}
+}
+
+func (t *testTracer) Start(ctx context.Context, req *redis.Request) (context.Context, redis.Span) {
+	span := &testSpan{name: redis.SpanName(req)}
+	t.mutex.Lock()
+	t.spans = append(t.spans, span)
+	t.mutex.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), testSpanEnder{span, t.ended}
+}
+
+type testSpanEnder struct {
+	span  *testSpan
+	ended chan *testSpan
+}
+
+func (s testSpanEnder) End(info redis.SpanInfo) {
+	s.span.info = info
+	s.ended <- s.span
+}
+
+func TestTracingTransport(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context)
+	}{
+		{
+			scenario: "spans end when responses are closed and count the values read",
+			function: testTracingTransportResponse,
+		},
+		{
+			scenario: "error replies are recorded on spans",
+			function: testTracingTransportErrorReply,
+		},
+		{
+			scenario: "spans end when requests fail, and carry the context passed to the transport",
+			function: testTracingTransportFailure,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			testFunc(t, ctx)
+		})
+	}
+}
+
+func newTracedServer(tracer redis.Tracer) (*redis.Client, func()) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		switch req.Cmds[0].Cmd {
+		case "LRANGE":
+			res.WriteStream(3)
+			res.Write("a")
+			res.Write("b")
+			res.Write("c")
+		default:
+			res.Write(errors.New("ERR unsupported"))
+		}
+	}))
+
+	tr := &redis.Transport{}
+	cli := &redis.Client{Addr: url, Transport: &redis.TracingTransport{Transport: tr, Tracer: tracer}}
+
+	return cli, func() {
+		tr.CloseIdleConnections()
+		srv.Close()
+	}
+}
+
+func testTracingTransportResponse(t *testing.T, ctx context.Context) {
+	tracer := newTestTracer()
+	cli, teardown := newTracedServer(tracer)
+	defer teardown()
+
+	args := cli.Query(ctx, "LRANGE", "key", 0, -1)
+
+	select {
+	case span := <-tracer.ended:
+		t.Fatalf("span ended before the response was closed: %+v", span)
+	default:
+	}
+
+	var values []string
+	for {
+		var v string
+		if !args.Next(&v) {
+			break
+		}
+		values = append(values, v)
+	}
+	if err := args.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	span := <-tracer.ended
+
+	if span.name != "LRANGE" {
+		t.Error("bad span name:", span.name)
+	}
+	if span.info.Addr != cli.Addr {
+		t.Error("bad span address:", span.info.Addr)
+	}
+	if span.info.Values != len(values) || len(values) != 3 {
+		t.Errorf("bad number of values: %d/%d", span.info.Values, len(values))
+	}
+	if span.info.Err != nil {
+		t.Error("unexpected error:", span.info.Err)
+	}
+}
+
+func testTracingTransportErrorReply(t *testing.T, ctx context.Context) {
+	tracer := newTestTracer()
+	cli, teardown := newTracedServer(tracer)
+	defer teardown()
+
+	if err := cli.Exec(ctx, "SET", "key", "value"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	span := <-tracer.ended
+
+	if span.name != "SET" {
+		t.Error("bad span name:", span.name)
+	}
+	if span.info.Err == nil || span.info.Err.Error() != "ERR unsupported" {
+		t.Error("bad span error:", span.info.Err)
+	}
+}
+
+func testTracingTransportFailure(t *testing.T, ctx context.Context) {
+	tracer := newTestTracer()
+	failure := errors.New("failure")
+
+	var propagated interface{}
+	cli := &redis.Client{
+		Addr: "127.0.0.1:0",
+		Transport: &redis.TracingTransport{
+			Transport: roundTripperFunc(func(req *redis.Request) (*redis.Response, error) {
+				propagated = req.Context.Value(spanKey{})
+				req.Close()
+				return nil, failure
+			}),
+			Tracer: tracer,
+		},
+	}
+
+	if err := cli.Exec(ctx, "GET", "key"); err != failure {
+		t.Fatal("bad error:", err)
+	}
+
+	span := <-tracer.ended
+
+	if propagated != span {
+		t.Error("the context of the span was not passed to the transport")
+	}
+	if span.info.Err != failure {
+		t.Error("bad span error:", span.info.Err)
+	}
+}
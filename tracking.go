@@ -0,0 +1,393 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTrackingNotSupported is returned when a TrackingClient connects to a server
+// which doesn't support RESP3, which is required to receive invalidations.
+var ErrTrackingNotSupported = errors.New("redis: the server doesn't support RESP3, which is required by client-side caching")
+
+// A TrackingClient wraps a Client to cache the results of read commands in
+// memory, using the server-assisted client-side caching of redis to invalidate
+// them when the keys are modified, by any client.
+//
+// The TrackingClient opens a dedicated connection to the server of the Client,
+// switches it to RESP3 and enables CLIENT TRACKING in broadcasting mode on it,
+// so the server pushes the names of the keys that are modified on the
+// connection. Results are cached until their key is invalidated or they are
+// evicted, and nothing is cached while the invalidation connection is down.
+// The connection is closed when the TrackingClient or the Client is closed.
+//
+// Commands matching none of the Commands patterns are forwarded to the Client,
+// and unless they are reads they invalidate the cached results of all their
+// keys, so programs read their own writes without waiting for the invalidation
+// pushed by the server. The keys of commands are found from the specification
+// of the standard redis commands; results of commands without keys, or whose
+// keys can't be found, are not cached since the server pushes no invalidation
+// for them, and writes without keys, or whose keys can't be found, purge the
+// cache.
+//
+// TrackingClient values are safe for concurrent use by multiple goroutines.
+type TrackingClient struct {
+	// Client is used to send commands that cannot be served from the cache,
+	// and its transport to open the invalidation connection. If nil,
+	// DefaultClient is used.
+	Client *Client
+
+	// Commands is the list of patterns of the read commands that are cached.
+	// Patterns are matched against upper-case command names using the syntax
+	// of path.Match, for example "GET" or "H*GET".
+	Commands []string
+
+	// Prefixes limits the invalidations pushed by the server to the keys with
+	// one of the prefixes, which must cover all cached keys. If empty, the
+	// server pushes invalidations for every key that is modified.
+	Prefixes []string
+
+	// Size is the maximum number of results kept in the cache. If zero,
+	// DefaultCacheSize is used.
+	Size int
+
+	// PingInterval is the interval at which the invalidation connection is
+	// checked with a PING command. If zero, the ping interval of the
+	// transport of the Client is used, or 30 seconds.
+	PingInterval time.Duration
+
+	mutex   sync.Mutex
+	gen     uint64
+	results cacheStore
+	conn    *Conn
+	dialing bool
+	closed  bool
+	hooked  bool
+}
+
+// Exec behaves like Client.Exec, but may be served from the cache.
+func (c *TrackingClient) Exec(ctx context.Context, cmd string, args ...interface{}) error {
+	return ParseArgs(c.Query(ctx, cmd, args...), nil)
+}
+
+// Query behaves like Client.Query, but may be served from the cache.
+//
+// The returned Args are fully loaded in memory when cmd is cached.
+func (c *TrackingClient) Query(ctx context.Context, cmd string, args ...interface{}) Args {
+	keys, ok := cacheKeys(cmd, args)
+
+	if !c.cached(cmd) || !ok || len(keys) == 0 {
+		if ClassOf(cmd) == ClassRead {
+			return c.client().Query(ctx, cmd, args...)
+		}
+		invalidate := func() { c.Invalidate(keys...) }
+		if !ok || len(keys) == 0 {
+			invalidate = c.purge
+		}
+		invalidate()
+		return &cacheWriteArgs{Args: c.client().Query(ctx, cmd, args...), invalidate: invalidate}
+	}
+
+	id := cacheID(cmd, args)
+
+	c.mutex.Lock()
+	tracking := c.conn != nil
+	values, ok := c.results.lookup(id, time.Time{})
+	gen := c.gen
+	c.mutex.Unlock()
+
+	if ok {
+		return List(values...)
+	}
+
+	if !tracking {
+		if err := c.track(ctx); err != nil {
+			return newArgsError(err)
+		}
+		// Results read before tracking started may be stale, gen is loaded
+		// again after the invalidation connection was established.
+		c.mutex.Lock()
+		tracking = c.conn != nil
+		gen = c.gen
+		c.mutex.Unlock()
+	}
+
+	r := c.client().Query(ctx, cmd, args...)
+	values = make([]interface{}, 0, r.Len())
+
+	for {
+		var v interface{}
+		if !r.Next(&v) {
+			break
+		}
+		// Byte slices are converted to strings so the program cannot mutate
+		// the cached values through the Args returned by later queries.
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		values = append(values, v)
+	}
+
+	if err := r.Close(); err != nil {
+		return newArgsError(err)
+	}
+
+	c.mutex.Lock()
+	// An invalidation was received or the invalidation connection was lost
+	// while the command was in flight, the result may be stale.
+	if tracking && gen == c.gen {
+		c.results.store(&cacheEntry{
+			id:     id,
+			keys:   keys,
+			values: values,
+		}, c.size())
+	}
+	c.mutex.Unlock()
+
+	return List(values...)
+}
+
+// Invalidate removes the cached results of commands issued on the given keys.
+func (c *TrackingClient) Invalidate(keys ...string) {
+	c.mutex.Lock()
+	c.gen++
+
+	for _, key := range keys {
+		c.results.invalidate(key)
+	}
+
+	c.mutex.Unlock()
+}
+
+// purge removes all results from the cache.
+func (c *TrackingClient) purge() {
+	c.mutex.Lock()
+	c.gen++
+	c.results.purge()
+	c.mutex.Unlock()
+}
+
+// Close closes the invalidation connection and empties the cache, the client
+// forwards all commands to its Client afterwards.
+func (c *TrackingClient) Close() error {
+	c.mutex.Lock()
+	conn := c.conn
+	c.conn, c.closed = nil, true
+	c.gen++
+	c.results.purge()
+	c.mutex.Unlock()
+
+	if conn != nil {
+		return conn.Close()
+	}
+	return nil
+}
+
+// track opens the invalidation connection, unless it's already being opened
+// by another goroutine, in which case the method returns immediately and the
+// command is not cached.
+func (c *TrackingClient) track(ctx context.Context) error {
+	c.mutex.Lock()
+	if c.dialing || c.closed || c.conn != nil {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.dialing = true
+	c.mutex.Unlock()
+
+	conn, err := c.dial(ctx)
+
+	c.mutex.Lock()
+	c.dialing = false
+	if err == nil && c.closed {
+		conn.Close()
+		err = ErrClientClosed
+	}
+	if err == nil {
+		c.conn = conn
+		c.gen++
+	}
+	hooked := c.hooked
+	c.hooked = c.hooked || err == nil
+	c.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if !hooked {
+		if _, err := c.client().onClose(c.Close); err != nil {
+			c.Close()
+			return err
+		}
+	}
+
+	go c.ping(conn)
+	go c.read(conn)
+	return nil
+}
+
+func (c *TrackingClient) dial(ctx context.Context) (*Conn, error) {
+	client := c.client()
+	addr := client.Addr
+	if len(addr) == 0 {
+		addr = "localhost:6379"
+	}
+	network, address := splitNetworkAddress(addr)
+
+	var conn *Conn
+	var err error
+
+	if t, ok := client.transport().(*Transport); ok {
+		t.once.Do(t.init)
+		conn, err = t.dial(ctx, network, address)
+	} else {
+		conn, err = DialContext(ctx, network, address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if ok, err := conn.negotiateRESP3(c.invalidate(conn)); err != nil || !ok {
+		conn.Close()
+		if err == nil {
+			err = ErrTrackingNotSupported
+		}
+		return nil, err
+	}
+
+	args := []interface{}{"TRACKING", "ON", "BCAST"}
+	for _, prefix := range c.Prefixes {
+		args = append(args, "PREFIX", prefix)
+	}
+
+	if err := conn.WriteCommands(Command{Cmd: "CLIENT", Args: List(args...)}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := conn.ReadArgs().Close(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("redis: enabling client tracking: %w", err)
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// invalidate returns the function handling the push messages received on the
+// invalidation connection conn.
+func (c *TrackingClient) invalidate(conn *Conn) func([]interface{}) {
+	return func(msg []interface{}) {
+		if len(msg) != 2 || fmt.Sprintf("%s", msg[0]) != "invalidate" {
+			return
+		}
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		if c.conn != conn {
+			return
+		}
+
+		c.gen++
+
+		keys, ok := msg[1].([]interface{})
+		if !ok {
+			// A nil list of keys is sent when the server flushed the database.
+			c.results.purge()
+			return
+		}
+
+		for _, key := range keys {
+			c.results.invalidate(cacheString(key))
+		}
+	}
+}
+
+// read reads the replies to pings on the invalidation connection, which drives
+// the processing of the invalidations pushed by the server.
+func (c *TrackingClient) read(conn *Conn) {
+	timeout := 2 * c.pingInterval()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+
+		if err := conn.ReadArgs().Close(); err != nil {
+			break
+		}
+	}
+
+	c.lost(conn)
+}
+
+func (c *TrackingClient) ping(conn *Conn) {
+	ticker := time.NewTicker(c.pingInterval())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := conn.WriteCommands(Command{Cmd: "PING"}); err != nil {
+			c.lost(conn)
+			return
+		}
+	}
+}
+
+// lost is called when the invalidation connection failed, the cache is emptied
+// since invalidations may have been missed, and a new connection is opened by
+// the next command.
+func (c *TrackingClient) lost(conn *Conn) {
+	c.mutex.Lock()
+	if c.conn == conn {
+		c.conn = nil
+		c.gen++
+		c.results.purge()
+	}
+	c.mutex.Unlock()
+	conn.Close()
+}
+
+func (c *TrackingClient) client() *Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return DefaultClient
+}
+
+func (c *TrackingClient) cached(cmd string) bool {
+	cmd = strings.ToUpper(cmd)
+
+	for _, pattern := range c.Commands {
+		if match, _ := path.Match(pattern, cmd); match {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *TrackingClient) size() int {
+	if c.Size > 0 {
+		return c.Size
+	}
+	return DefaultCacheSize
+}
+
+func (c *TrackingClient) pingInterval() time.Duration {
+	if c.PingInterval != 0 {
+		return c.PingInterval
+	}
+	if t, ok := c.client().transport().(*Transport); ok {
+		return t.pingInterval()
+	}
+	return 30 * time.Second
+}
@@ -0,0 +1,134 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestTrackingClient(t *testing.T) {
+	var reads int32
+	var mutex sync.Mutex
+	var store = map[string]string{}
+	var tracking []*rawConn
+
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch cmd {
+		case "HELLO":
+			return "%1\r\n+proto\r\n:3\r\n"
+		case "CLIENT":
+			if args[0] == "TRACKING" {
+				tracking = append(tracking, c)
+			}
+			return "+OK\r\n"
+		case "PING":
+			return "+PONG\r\n"
+		case "GET":
+			atomic.AddInt32(&reads, 1)
+			v := store[args[0]]
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+		case "SET":
+			store[args[0]] = args[1]
+			for _, tc := range tracking {
+				fmt.Fprintf(tc, ">2\r\n$10\r\ninvalidate\r\n*1\r\n$%d\r\n%s\r\n", len(args[0]), args[0])
+			}
+			return "+OK\r\n"
+		default:
+			return "-ERR unknown command\r\n"
+		}
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	other := &redis.Client{Addr: addr, Transport: tr}
+	client := &redis.Client{Addr: addr, Transport: tr}
+	defer client.Close()
+
+	cli := &redis.TrackingClient{
+		Client:   client,
+		Commands: []string{"GET"},
+	}
+
+	get := func(key string) string {
+		s, err := redis.String(cli.Query(ctx, "GET", key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	if err := other.Exec(ctx, "SET", "A", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i != 3; i++ {
+		if s := get("A"); s != "1" {
+			t.Fatal("bad value:", s)
+		}
+	}
+
+	if n := atomic.LoadInt32(&reads); n != 1 {
+		t.Error("bad number of reads after caching a result:", n)
+	}
+
+	// Writes made by other clients are observed through the invalidations
+	// pushed by the server.
+	if err := other.Exec(ctx, "SET", "A", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, ctx, func() bool { return get("A") == "2" })
+
+	// Writes made through the tracking client are observed immediately.
+	if err := cli.Exec(ctx, "SET", "A", "3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := get("A"); s != "3" {
+		t.Error("bad value after a write:", s)
+	}
+
+	// Closing the client closes the invalidation connection, the results are
+	// not cached anymore.
+	if err := cli.Close(); err != nil {
+		t.Error(err)
+	}
+
+	n := atomic.LoadInt32(&reads)
+	get("A")
+	get("A")
+
+	if m := atomic.LoadInt32(&reads); m != n+2 {
+		t.Error("bad number of reads after closing the client:", m-n)
+	}
+}
+
+func TestTrackingClientNotSupported(t *testing.T) {
+	addr := newRESP3Server(t, map[string]string{
+		"HELLO": "-ERR unknown command 'HELLO'\r\n",
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.TrackingClient{
+		Client:   &redis.Client{Addr: addr, Transport: tr},
+		Commands: []string{"GET"},
+	}
+
+	if err := cli.Exec(context.Background(), "GET", "A"); err != redis.ErrTrackingNotSupported {
+		t.Error("bad error:", err)
+	}
+}
@@ -2,15 +2,23 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"net"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/segmentio/objconv/resp"
+	"github.com/segmentio/redis-go/resputil"
 )
 
+// ErrTransportClosed is returned by RoundTrip when sending requests on a
+// transport that was shut down.
+var ErrTransportClosed = errors.New("redis: transport closed")
+
 // RoundTripper is an interface representing the ability to execute a single
 // Redis transaction, obtaining the Response for a given Request.
 //
@@ -50,9 +58,37 @@ type RoundTripper interface {
 // functionality, see Client.
 type Transport struct {
 	// DialContext specifies the dial function for creating network connections.
-	// If DialContext is nil, then the transport dials using package net.
+	// If DialContext is nil, then the transport dials using DefaultDialer, or
+	// connects to Windows named pipes for "npipe://" addresses.
 	DialContext func(context.Context, string, string) (net.Conn, error)
 
+	// TLSConfig, if not nil, is the TLS configuration used to establish the
+	// connections of the transport over TLS. Connections to addresses using
+	// the rediss:// scheme are established over TLS with the default
+	// configuration when TLSConfig is nil. If ServerName is empty, the host of
+	// the address is used to verify the certificate of the server, or the host
+	// name that the address was resolved from by a DNSTransport.
+	TLSConfig *tls.Config
+
+	// TLSHandshakeTimeout is the maximum amount of time waiting for the TLS
+	// handshake to complete. If zero, the handshake times out after 10
+	// seconds, or earlier if the context of the request has a deadline.
+	TLSHandshakeTimeout time.Duration
+
+	// Username and Password are the credentials sent with AUTH on every new
+	// connection, before any other command, to talk to servers which require
+	// authentication. The username is only sent when it's not empty, servers
+	// configured with requirepass only expect a password.
+	Username string
+	Password string
+
+	// Credentials, if not nil, is called on every new connection to get the
+	// credentials sent with AUTH, instead of Username and Password. It allows
+	// programs to rotate passwords without recreating the transport. No AUTH
+	// command is sent when the returned password is empty, and errors
+	// returned by the function abort the creation of the connection.
+	Credentials func(ctx context.Context, address string) (username, password string, err error)
+
 	// MaxIdleConns controls the maximum number of idle (keep-alive) connections
 	// across all hosts. Zero means no limit.
 	MaxIdleConns int
@@ -61,6 +97,35 @@ type Transport struct {
 	// (keep-alive) connections to keep per-host. Zero means no limit.
 	MaxIdleConnsPerHost int
 
+	// MaxIdleConnsByHost overrides MaxIdleConnsPerHost for specific hosts,
+	// keyed by the address set on requests. It allows a single transport to
+	// size its pools independently for servers with different loads, for
+	// example a small sidecar server and a large shared one.
+	MaxIdleConnsByHost map[string]int
+
+	// MaxConnLifetime, if not zero, is the maximum amount of time that a
+	// connection is reused for. Older connections are closed when they are
+	// released, or when found in the pool, so the transport follows changes
+	// of DNS records and reconnects to new nodes after failovers. Zero means
+	// connections are reused indefinitely.
+	//
+	// Connections shared by automatic pipelining stop receiving new requests
+	// once they reach their lifetime, and are closed when the requests in
+	// flight on them complete.
+	MaxConnLifetime time.Duration
+
+	// MaxIdleTime, if not zero, is the maximum amount of time that a
+	// connection stays idle in the pool before being closed. Some load
+	// balancers silently drop idle connections, setting MaxIdleTime below
+	// their timeout avoids sending requests on dead connections. Zero means
+	// idle connections are only closed when they fail a ping, see
+	// PingInterval.
+	//
+	// Expired connections are found when they would be reused, and by the
+	// periodic pings of the transport. Connections shared by automatic
+	// pipelining are not recycled.
+	MaxIdleTime time.Duration
+
 	// PingInterval is the amount of time between pings that the transport sends
 	// to the hosts it connects to.
 	PingInterval time.Duration
@@ -69,8 +134,270 @@ type Transport struct {
 	// to ping requests before discarding connections.
 	PingTimeout time.Duration
 
-	once sync.Once
-	pool *connPool
+	// ClientName, if not empty, is the name set with CLIENT SETNAME on every new
+	// connection established by the transport. The name is a template which
+	// may reference the ${program}, ${host}, ${pid}, and ${version} variables,
+	// see DefaultClientName for an example.
+	ClientName string
+
+	// LibName and LibVersion are the name and version of the library reported
+	// to the servers with CLIENT SETINFO on every new connection, they are
+	// displayed by CLIENT LIST. If empty, "redis-go" and the version of this
+	// package are used. Libraries built on top of this package typically
+	// override them, for example with "redis-go(mylib_v1.0.0)".
+	LibName    string
+	LibVersion string
+
+	// ClientInfo carries additional attributes reported to the servers with
+	// CLIENT SETINFO on every new connection, they are exposed to the
+	// handlers of servers of this package by ClientAttributes. Vanilla redis
+	// only supports the lib-name and lib-ver attributes.
+	ClientInfo map[string]string
+
+	// NoClientInfo, when set to true, disables the CLIENT SETINFO commands.
+	//
+	// Errors returned by servers which don't support the command, like
+	// versions of redis older than 7.2, are ignored.
+	NoClientInfo bool
+
+	// DB is the logical database selected with SELECT on every new connection,
+	// so all the connections of the pool operate on the same database. Zero
+	// is the default database of redis, no SELECT command is sent in that
+	// case. Programs using multiple databases need one transport per database.
+	DB int
+
+	// NoEvict, when set to true, sends CLIENT NO-EVICT ON on every new
+	// connection, so the server doesn't evict the connections of the transport
+	// when its client memory limit is reached. This is typically useful for
+	// monitoring or administration tools.
+	NoEvict bool
+
+	// NoTouch, when set to true, sends CLIENT NO-TOUCH ON on every new
+	// connection, so commands sent by the transport don't alter the LRU/LFU
+	// statistics of the keys they access.
+	NoTouch bool
+
+	// ReadOnly, when set to true, sends READONLY on every new connection, so
+	// replicas of a redis cluster serve the reads of the slots they replicate
+	// instead of redirecting them to their primary. Errors returned by servers
+	// which don't run in cluster mode are ignored, see ReadBalancer.
+	ReadOnly bool
+
+	// StrictTypes enables strict decoding of the responses, when set to true
+	// the values read from the responses aren't coerced to the type of the
+	// destination they are decoded into. For example, decoding an integer
+	// into a string returns a *TypeMismatchError instead of formatting the integer.
+	StrictTypes bool
+
+	// DecodeOptions configures the Go types of values decoded from responses
+	// into interface{} destinations.
+	DecodeOptions DecodeOptions
+
+	// ReadBufferSize and WriteBufferSize are the sizes of the buffers used
+	// when reading from and writing to connections. If zero,
+	// DefaultBufferSize is used.
+	//
+	// The write buffer bounds the memory used to send requests, pipelines
+	// larger than the buffer are written across multiple flushes instead of
+	// being assembled in memory first.
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// WireLogger, if not nil, dumps the traffic of the connections established
+	// by the transport. It is intended to debug protocol issues, and has a
+	// significant performance cost.
+	WireLogger *resputil.WireLogger
+
+	// Compression, when true, negotiates the compression of the traffic of new
+	// connections with the servers, which is supported by servers of this
+	// package with Compression enabled. Other servers, like vanilla redis,
+	// reject the negotiation and the connections are used uncompressed.
+	Compression bool
+
+	// Checksum, when true, negotiates the validation of the traffic of new
+	// connections with CRC-32C checksums, which is supported by servers of
+	// this package with Checksum enabled. Reads on a connection fail with
+	// ErrChecksumMismatch when corrupted data is received. Other servers
+	// reject the negotiation and the connections are used without checksums.
+	Checksum bool
+
+	// RESP3, when true, switches new connections to the RESP3 protocol with a
+	// HELLO 3 command, falling back to RESP2 when the server rejects it. The
+	// replies are translated so they are read the same way with both
+	// protocols, for example maps are read as arrays of key/value pairs and
+	// booleans as integers.
+	//
+	// Some proxies don't support HELLO and close the connection or never
+	// reply, the transport waits up to PingTimeout for the reply and then
+	// establishes a new RESP2 connection. Addresses which don't support RESP3
+	// are remembered for a while, so new connections to them skip HELLO. The
+	// protocol used with each address is reported by Stats.
+	RESP3 bool
+
+	// OnPush is called with the address of the server and the values of push
+	// messages received on connections using RESP3, like the invalidation
+	// messages of client-side caching. If nil, push messages are discarded.
+	//
+	// The function is called by the goroutines reading responses, it must not
+	// block or use the transport.
+	OnPush func(address string, msg []interface{})
+
+	// ArgEncoding defines how the transport encodes command arguments that
+	// have no obvious representation in the redis protocol, like nil values,
+	// booleans, or NaN. The zero-value rejects nil values and NaN, and
+	// encodes booleans as "1" and "0".
+	ArgEncoding ArgEncoding
+
+	// OnConnect is called on every new connection established by the transport,
+	// before it is used to send requests. The function may issue commands on the
+	// connection (CLIENT SETNAME, SELECT, custom handshakes, ...), it must read
+	// all responses to the commands it sends so the connection is left in a
+	// stable state.
+	//
+	// If OnConnect returns an error the connection is closed and the error is
+	// returned to the caller that triggered the creation of the connection.
+	//
+	// The context passed to OnConnect is the one of the request that caused the
+	// connection to be established, its deadline (if any) is applied to the
+	// connection while the function runs.
+	OnConnect func(ctx context.Context, conn *Conn) error
+
+	// Limiter, if not nil, limits the number of requests that the transport
+	// has in flight, adapting the limit to the latency of the responses.
+	// Requests exceeding the limit fail immediately with ErrOverloaded. A
+	// request is in flight until its response is closed.
+	//
+	// The limiter applies to all requests sent by the transport, programs
+	// talking to multiple servers should use one transport per server.
+	Limiter *AdaptiveLimiter
+
+	// HedgeDelay, if not zero, enables hedged requests: when a request made
+	// of a single read-only command got no response after HedgeDelay, it is
+	// sent again on another connection and the first response is used. The
+	// other response is discarded when it arrives, returning its connection
+	// to the pool.
+	//
+	// Hedging trades extra load on the servers for lower tail latency, the
+	// delay is typically set to a high percentile of the latency of requests.
+	HedgeDelay time.Duration
+
+	// HedgeAddr, if not nil, returns the address that hedged requests of
+	// requests sent to addr are sent to, for example a replica of the server.
+	// If nil, or if it returns an empty string, hedged requests are sent to
+	// the same address.
+	HedgeAddr func(addr string) string
+
+	// PipelinedConnsPerHost, if not zero, enables automatic pipelining:
+	// concurrent requests to the same host share PipelinedConnsPerHost
+	// connections instead of using one connection each. The commands of
+	// requests sent at the same time are written back to back, and often
+	// flushed in a single write, then the responses are read in the order of
+	// the requests. It lets programs sending many concurrent requests reach a
+	// much higher throughput with a handful of connections.
+	//
+	// Requests which change the state of their connection or block it, like
+	// WATCH, SUBSCRIBE, or BLPOP, are still sent on dedicated connections.
+	// Shared connections are not pinged, and are closed by
+	// CloseIdleConnections only when they have no requests in flight. A slow
+	// command delays the responses of all requests queued after it.
+	PipelinedConnsPerHost int
+
+	once       sync.Once
+	setupOnce  sync.Once
+	pool       *connPool
+	clientName string
+	clientInfo [][2]string
+	scripts    scriptCache
+	protocols  protocolCache
+	hedges     hedgeStats
+	pipelines  pipelinePools
+	stats      poolStats
+}
+
+// TransportStats carries statistics about the connections of a Transport.
+type TransportStats struct {
+	// Protocols is the version of the protocol, 2 or 3, that the transport
+	// uses on new connections to each address it connected to. It is only
+	// set when the transport has RESP3 enabled.
+	Protocols map[string]int
+
+	// Hedges is the number of hedged requests sent by the transport.
+	Hedges int64
+
+	// HedgeWins is the number of hedged requests which got their response
+	// before the original requests.
+	HedgeWins int64
+
+	// Conns is the number of open connections, which are either idle, active,
+	// or shared by pipelined requests.
+	Conns int
+
+	// IdleConns is the number of connections waiting in the pool to be used
+	// by a request.
+	IdleConns int
+
+	// ActiveConns is the number of connections used by in-flight requests.
+	ActiveConns int
+
+	// PipelinedConns is the number of connections shared by pipelined
+	// requests, see PipelinedConnsPerHost.
+	PipelinedConns int
+
+	// Dials is the number of connections that the transport attempted to
+	// establish, DialErrors is the number of attempts which failed.
+	Dials      int64
+	DialErrors int64
+
+	// Pings is the number of pings sent on idle connections, PingErrors is
+	// the number of pings which failed, the connections are then closed.
+	Pings      int64
+	PingErrors int64
+
+	// Waits is the number of pipelined requests which had to wait for the
+	// responses of the requests sent before them on their connection, and
+	// WaitTime the total amount of time they waited.
+	Waits    int64
+	WaitTime time.Duration
+}
+
+// poolStats counts the events of the connections of a transport.
+type poolStats struct {
+	dials      int64
+	dialErrors int64
+	waits      int64
+	waitTime   int64
+}
+
+// wait records that a request waited for d, s may be nil.
+func (s *poolStats) wait(d time.Duration) {
+	if s != nil {
+		atomic.AddInt64(&s.waits, 1)
+		atomic.AddInt64(&s.waitTime, int64(d))
+	}
+}
+
+// Stats returns statistics about the connections of t.
+func (t *Transport) Stats() TransportStats {
+	t.once.Do(t.init)
+
+	idle, active := t.pool.connCounts()
+	pipelined := t.pipelines.conns()
+
+	return TransportStats{
+		Protocols:      t.protocols.load(),
+		Hedges:         atomic.LoadInt64(&t.hedges.sent),
+		HedgeWins:      atomic.LoadInt64(&t.hedges.wins),
+		Conns:          idle + active + pipelined,
+		IdleConns:      idle,
+		ActiveConns:    active,
+		PipelinedConns: pipelined,
+		Dials:          atomic.LoadInt64(&t.stats.dials),
+		DialErrors:     atomic.LoadInt64(&t.stats.dialErrors),
+		Pings:          atomic.LoadInt64(&t.pool.pings),
+		PingErrors:     atomic.LoadInt64(&t.pool.pingErrors),
+		Waits:          atomic.LoadInt64(&t.stats.waits),
+		WaitTime:       time.Duration(atomic.LoadInt64(&t.stats.waitTime)),
+	}
 }
 
 // CloseIdleConnections closes any connections which were previously connected
@@ -79,6 +406,36 @@ type Transport struct {
 func (t *Transport) CloseIdleConnections() {
 	t.once.Do(t.init)
 	t.pool.closeIdleConnections()
+	t.pipelines.closeIdle()
+}
+
+// Shutdown gracefully shuts down the transport. Shutdown works by first
+// preventing new requests from being sent and closing all idle connections,
+// then waiting for in-flight requests to complete, that is for their
+// responses to be closed. If ctx expires before all requests completed, the
+// connections of the remaining requests are closed and the context's error is
+// returned.
+//
+// After Shutdown was called, RoundTrip returns ErrTransportClosed.
+func (t *Transport) Shutdown(ctx context.Context) error {
+	const maxPollInterval = 500 * time.Millisecond
+	const minPollInterval = 10 * time.Millisecond
+
+	t.once.Do(t.init)
+	t.pool.close()
+
+	for i := 0; t.pool.inflightRequests() != 0; i++ {
+		select {
+		case <-ctx.Done():
+			t.pool.closeActiveConnections()
+			t.pipelines.close()
+			return ctx.Err()
+		case <-time.After(backoff(i, minPollInterval, maxPollInterval)):
+		}
+	}
+
+	t.pipelines.close()
+	return nil
 }
 
 // Subscribe uses the transport's configuration to open a connection to a redis
@@ -94,6 +451,8 @@ func (t *Transport) PSubscribe(ctx context.Context, network string, address stri
 }
 
 func (t *Transport) sub(ctx context.Context, network string, address string, command string, channels ...string) (*SubConn, error) {
+	t.once.Do(t.init)
+
 	deadline, ok := ctx.Deadline()
 	if !ok {
 		var cancel context.CancelFunc
@@ -104,10 +463,17 @@ func (t *Transport) sub(ctx context.Context, network string, address string, com
 		defer cancel()
 	}
 
-	conn, err := t.dialContext(ctx, network, address)
+	c, err := t.dial(ctx, network, address)
 	if err != nil {
 		return nil, err
 	}
+	conn := c.conn
+
+	if r, ok := conn.(*resp3Conn); ok {
+		// Messages of subscriptions are push messages in RESP3, they are read
+		// by the SubConn as arrays like in RESP2.
+		r.push = nil
+	}
 
 	subch := make(chan *SubConn, 1)
 	errch := make(chan error, 1)
@@ -145,29 +511,71 @@ func (t *Transport) sub(ctx context.Context, network string, address string, com
 func (t *Transport) RoundTrip(req *Request) (*Response, error) {
 	t.once.Do(t.init)
 
+	if t.HedgeDelay > 0 && len(req.Cmds) == 1 && classOfRequest(req) == ClassRead {
+		return t.roundTripHedged(req)
+	}
+
+	if t.PipelinedConnsPerHost > 0 && canPipeline(req) {
+		return t.roundTripPipelined(req)
+	}
+
+	return t.roundTrip(req)
+}
+
+func (t *Transport) roundTrip(req *Request) (*Response, error) {
 	ctx := req.Context
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
-	conn := t.pool.getConn(req.Addr)
-	if conn == nil {
+	if !t.pool.startRequest() {
+		req.Close()
+		return nil, ErrTransportClosed
+	}
+
+	var conn *Conn
+	var once sync.Once
+	var limiterRelease func(error)
+
+	release := func(err error) {
+		once.Do(func() {
+			if limiterRelease != nil {
+				limiterRelease(err)
+			}
+			t.pool.endRequest(conn)
+		})
+	}
+
+	if t.Limiter != nil {
+		r, err := t.Limiter.acquire()
+		if err != nil {
+			release(nil)
+			req.Close()
+			return nil, err
+		}
+		limiterRelease = r
+	}
+
+	if conn = t.pool.getConn(req.Addr); conn == nil {
 		network, address := splitNetworkAddress(req.Addr)
-		c, err := t.dialContext(ctx, network, address)
+		c, err := t.dial(ctx, network, address)
 		if err != nil {
 			if ctxErr := ctx.Err(); ctxErr != nil {
 				err = &net.OpError{Op: "dial", Net: "redis", Err: ctxErr}
 			}
+			release(err)
 			return nil, err
 		}
-		conn = NewClientConn(c)
+		conn = c
 	}
 
+	t.pool.activate(conn)
+
 	resch := make(chan *Response, 1)
 	errch := make(chan error, 1)
 
 	go t.writeRequest(conn, req, errch)
-	go t.readResponse(conn, req, resch)
+	go t.readResponse(conn, req, release, resch)
 
 	var res *Response
 	var err error
@@ -184,6 +592,7 @@ func (t *Transport) RoundTrip(req *Request) (*Response, error) {
 		raddr := conn.RemoteAddr()
 		conn.Close()
 		err = &net.OpError{Op: "request", Net: "redis", Source: laddr, Addr: raddr, Err: err}
+		release(err)
 	}
 
 	return res, err
@@ -197,26 +606,50 @@ func (t *Transport) writeRequest(conn *Conn, req *Request, errch chan<- error) {
 	}
 }
 
-func (t *Transport) readResponse(conn *Conn, req *Request, resch chan<- *Response) {
+func (t *Transport) readResponse(conn *Conn, req *Request, release func(error), resch chan<- *Response) {
 	var res *Response
 
-	if req.IsTransaction() {
-		res = t.readTransactionResponse(conn, req)
-	} else {
-		res = t.readSimpleResponse(conn, req)
+	switch {
+	case req.IsTransaction():
+		res = t.readTransactionResponse(conn, req, release)
+	case req.IsPipeline():
+		res = t.readPipelineResponse(conn, req, release)
+	default:
+		res = t.readSimpleResponse(conn, req, release)
 	}
 
 	resch <- res
 }
 
-func (t *Transport) readTransactionResponse(conn *Conn, req *Request) *Response {
+func (t *Transport) readTransactionResponse(conn *Conn, req *Request, release func(error)) *Response {
+	cancel := watchCancel(req.Context, conn)
 	args := conn.ReadTxArgs(len(req.Cmds) - 2)
 	return &Response{
 		TxArgs: &transportTxArgs{
 			connPoolPutter: connPoolPutter{
-				host: req.Addr,
-				conn: conn,
-				pool: t.pool,
+				host:    req.Addr,
+				conn:    conn,
+				pool:    t.pool,
+				release: release,
+				cancel:  cancel,
+			},
+			TxArgs: args,
+		},
+		Request: req,
+	}
+}
+
+func (t *Transport) readPipelineResponse(conn *Conn, req *Request, release func(error)) *Response {
+	cancel := watchCancel(req.Context, conn)
+	args := conn.ReadPipelineArgs(len(req.Cmds))
+	return &Response{
+		TxArgs: &transportTxArgs{
+			connPoolPutter: connPoolPutter{
+				host:    req.Addr,
+				conn:    conn,
+				pool:    t.pool,
+				release: release,
+				cancel:  cancel,
 			},
 			TxArgs: args,
 		},
@@ -224,15 +657,18 @@ func (t *Transport) readTransactionResponse(conn *Conn, req *Request) *Response
 	}
 }
 
-func (t *Transport) readSimpleResponse(conn *Conn, req *Request) *Response {
+func (t *Transport) readSimpleResponse(conn *Conn, req *Request, release func(error)) *Response {
+	cancel := watchCancel(req.Context, conn)
 	args := conn.ReadArgs()
 	args.Len() // waits for the first bytes of the response to arrive
 	return &Response{
 		Args: &transportArgs{
 			connPoolPutter: connPoolPutter{
-				host: req.Addr,
-				conn: conn,
-				pool: t.pool,
+				host:    req.Addr,
+				conn:    conn,
+				pool:    t.pool,
+				release: release,
+				cancel:  cancel,
 			},
 			Args: args,
 		},
@@ -244,6 +680,13 @@ func (t *Transport) init() {
 	pool := &connPool{
 		maxIdleConns:        t.MaxIdleConns,
 		maxIdleConnsPerHost: t.MaxIdleConnsPerHost,
+		maxIdleConnsByHost:  make(map[string]int, len(t.MaxIdleConnsByHost)),
+		maxConnLifetime:     t.MaxConnLifetime,
+		maxIdleTime:         t.MaxIdleTime,
+	}
+
+	for host, max := range t.MaxIdleConnsByHost {
+		pool.maxIdleConnsByHost[host] = max
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -257,12 +700,190 @@ func (t *Transport) init() {
 			case <-ctx.Done():
 				return
 			}
+			pool.closeExpiredConnections()
 			pool.pingIdleConnections(pingTimeout)
 		}
 	}(t.pingInterval(), t.pingTimeout())
 
 	runtime.SetFinalizer(pool, func(*connPool) { cancel() })
+	pool.stop = cancel
 	t.pool = pool
+
+	t.setupOnce.Do(t.initSetup)
+}
+
+// initSetup prepares the state used to setup new connections, it is separate
+// from init so connections can be dialed without starting the pool.
+func (t *Transport) initSetup() {
+	if len(t.ClientName) != 0 {
+		t.clientName = expandClientName(t.ClientName)
+	}
+
+	if !t.NoClientInfo {
+		t.clientInfo = makeClientInfo(t.LibName, t.LibVersion, t.ClientInfo)
+	}
+}
+
+func (t *Transport) dial(ctx context.Context, network string, address string) (*Conn, error) {
+	atomic.AddInt64(&t.stats.dials, 1)
+
+	c, err := t.dialContext(ctx, network, address)
+	if err != nil {
+		atomic.AddInt64(&t.stats.dialErrors, 1)
+		return nil, err
+	}
+
+	conn := newClientConn(c, t.ReadBufferSize, t.WriteBufferSize)
+	conn.strict = t.StrictTypes
+	conn.options = t.DecodeOptions
+	conn.emitter.encoding = t.ArgEncoding
+
+	if err := t.setupConn(ctx, conn, address); err != nil {
+		conn.Close()
+
+		if err == errHelloUnsupported {
+			// The address is now known not to support RESP3, the new
+			// connection is setup without HELLO.
+			return t.dial(ctx, network, address)
+		}
+
+		atomic.AddInt64(&t.stats.dialErrors, 1)
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (t *Transport) setupConn(ctx context.Context, conn *Conn, address string) error {
+	cmds := t.setupCommands()
+	onConnect := t.OnConnect
+
+	if len(cmds) == 0 && onConnect == nil && !t.Compression && !t.Checksum && !t.RESP3 && !t.hasCredentials() {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	if t.Compression || t.Checksum {
+		if err := conn.negotiate(t.Compression, t.Checksum); err != nil {
+			return err
+		}
+	}
+
+	// Servers which require authentication reject all other commands until
+	// the connection is authenticated, including HELLO 3.
+	if t.hasCredentials() {
+		if err := t.authenticate(ctx, conn, address); err != nil {
+			return err
+		}
+	}
+
+	if t.RESP3 && t.protocols.tryRESP3(address) {
+		if err := t.negotiateRESP3(ctx, conn, address); err != nil {
+			return err
+		}
+	}
+
+	if len(cmds) != 0 {
+		// The setup commands are sent in a single pipeline, then the responses
+		// are all read, the first error aborts the setup. The READONLY and
+		// CLIENT SETINFO commands come last, the errors of servers which don't
+		// support them are ignored.
+		info := len(cmds) - t.optionalSetupCommands()
+
+		if err := conn.WriteCommands(cmds...); err != nil {
+			return err
+		}
+		for i := range cmds {
+			if err := conn.ReadArgs().Close(); err != nil {
+				if _, ok := err.(*resp.Error); !ok || i < info {
+					return err
+				}
+			}
+		}
+	}
+
+	if onConnect != nil {
+		return onConnect(ctx, conn)
+	}
+
+	return nil
+}
+
+// authenticate sends AUTH on conn with the credentials of the transport.
+func (t *Transport) authenticate(ctx context.Context, conn *Conn, address string) error {
+	username, password := t.Username, t.Password
+
+	if t.Credentials != nil {
+		var err error
+		if username, password, err = t.Credentials(ctx, address); err != nil {
+			return err
+		}
+	}
+
+	if len(password) == 0 {
+		return nil
+	}
+
+	args := List(password)
+	if len(username) != 0 {
+		args = List(username, password)
+	}
+
+	if err := conn.WriteCommands(Command{Cmd: "AUTH", Args: args}); err != nil {
+		return err
+	}
+
+	return conn.ReadArgs().Close()
+}
+
+func (t *Transport) hasCredentials() bool {
+	return len(t.Password) != 0 || t.Credentials != nil
+}
+
+// setupCommands returns the list of commands that the transport sends on new
+// connections, before calling the OnConnect hook.
+func (t *Transport) setupCommands() []Command {
+	var cmds []Command
+
+	if t.DB != 0 {
+		cmds = append(cmds, Command{Cmd: "SELECT", Args: List(t.DB)})
+	}
+
+	if t.clientName != "" {
+		cmds = append(cmds, Command{Cmd: "CLIENT", Args: List("SETNAME", t.clientName)})
+	}
+
+	if t.NoEvict {
+		cmds = append(cmds, Command{Cmd: "CLIENT", Args: List("NO-EVICT", "ON")})
+	}
+
+	if t.NoTouch {
+		cmds = append(cmds, Command{Cmd: "CLIENT", Args: List("NO-TOUCH", "ON")})
+	}
+
+	if t.ReadOnly {
+		cmds = append(cmds, Command{Cmd: "READONLY"})
+	}
+
+	for _, attr := range t.clientInfo {
+		cmds = append(cmds, Command{Cmd: "CLIENT", Args: List("SETINFO", attr[0], attr[1])})
+	}
+
+	return cmds
+}
+
+// optionalSetupCommands returns the number of READONLY and CLIENT SETINFO
+// commands among the setup commands, which are allowed to fail.
+func (t *Transport) optionalSetupCommands() int {
+	n := len(t.clientInfo)
+	if t.ReadOnly {
+		n++
+	}
+	return n
 }
 
 func (t *Transport) dialContext(ctx context.Context, network string, address string) (net.Conn, error) {
@@ -270,7 +891,82 @@ func (t *Transport) dialContext(ctx context.Context, network string, address str
 	if dialContext == nil {
 		dialContext = DefaultDialer.DialContext
 	}
-	return dialContext(ctx, network, address)
+
+	useTLS := t.TLSConfig != nil
+
+	switch network {
+	case "redis":
+		network = "tcp"
+	case "rediss":
+		network, useTLS = "tcp", true
+	}
+
+	var c net.Conn
+	var err error
+
+	if network == pipeNetwork && t.DialContext == nil {
+		c, err = dialPipe(ctx, pipePath(address))
+	} else {
+		c, err = dialContext(ctx, network, address)
+	}
+
+	if err == nil && useTLS {
+		c, err = t.handshake(ctx, c, address)
+	}
+
+	if err == nil && t.WireLogger != nil {
+		c = t.WireLogger.Conn(c)
+	}
+
+	return c, err
+}
+
+// handshake establishes a TLS session on c, which is closed if the handshake
+// fails.
+func (t *Transport) handshake(ctx context.Context, c net.Conn, address string) (net.Conn, error) {
+	var config *tls.Config
+
+	if t.TLSConfig != nil {
+		config = t.TLSConfig.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+
+	if len(config.ServerName) == 0 {
+		if name, _ := ctx.Value(tlsServerNameKey{}).(string); len(name) != 0 {
+			config.ServerName = name
+		} else {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				host = address
+			}
+			config.ServerName = host
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.tlsHandshakeTimeout())
+	defer cancel()
+
+	conn := tls.Client(c, config)
+
+	if err := conn.HandshakeContext(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// tlsServerNameKey is the context key carrying the host name that the TLS
+// certificates of servers are verified against, when requests are sent to an
+// IP address resolved from it by a DNSTransport.
+type tlsServerNameKey struct{}
+
+func (t *Transport) tlsHandshakeTimeout() time.Duration {
+	if timeout := t.TLSHandshakeTimeout; timeout != 0 {
+		return timeout
+	}
+	return 10 * time.Second
 }
 
 func (t *Transport) pingTimeout() time.Duration {
@@ -288,15 +984,35 @@ func (t *Transport) pingInterval() time.Duration {
 }
 
 // DefaultTransport is the default implementation of Transport and is used by
-// DefaultClient. It establishes network connections as needed and caches them
-// for reuse by subsequent calls.
+// DefaultClient, and by all clients which don't set their own Transport. It
+// establishes network connections as needed and caches them for reuse by
+// subsequent calls, so programs get connection pooling without having to
+// construct a Transport.
+//
+// Programs may assign a different RoundTripper to DefaultTransport at startup
+// to change the default behavior of all clients.
 var DefaultTransport RoundTripper = &Transport{
-	PingTimeout:  10 * time.Second,
-	PingInterval: 15 * time.Second,
+	MaxIdleConns:        DefaultMaxIdleConns,
+	MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+	PingTimeout:         10 * time.Second,
+	PingInterval:        15 * time.Second,
 }
 
+const (
+	// DefaultMaxIdleConns is the maximum number of idle connections kept by
+	// DefaultTransport across all hosts.
+	DefaultMaxIdleConns = 256
+
+	// DefaultMaxIdleConnsPerHost is the maximum number of idle connections kept
+	// by DefaultTransport for each host.
+	DefaultMaxIdleConnsPerHost = 64
+)
+
 // DefaultDialer is the default dialer used by Transports when no DialContext
-// is set.
+// is set, and by the functions of the package which open connections, like
+// DialContext. Programs running where it is not available (like GOOS=js
+// GOARCH=wasm in web browsers) set the DialContext field of their transports
+// instead, see examples/wasm for a transport dialing WebSocket connections.
 var DefaultDialer = &net.Dialer{
 	Timeout:   10 * time.Second,
 	KeepAlive: 30 * time.Second,
@@ -304,15 +1020,21 @@ var DefaultDialer = &net.Dialer{
 }
 
 type connPoolPutter struct {
-	host string
-	conn *Conn
-	pool *connPool
-	once sync.Once
+	host    string
+	conn    *Conn
+	pool    *connPool
+	once    sync.Once
+	release func(error)
+	cancel  *cancelWatcher
 }
 
 func (c *connPoolPutter) close(err error) error {
+	err = c.cancel.close(err)
+	if c.release != nil {
+		c.release(err)
+	}
 	if err != nil {
-		if _, stable := err.(*resp.Error); !stable {
+		if !isStableError(err) {
 			c.once.Do(func() { c.conn.Close() })
 		}
 	}
@@ -329,6 +1051,10 @@ func (a *transportArgs) Close() error {
 	return a.connPoolPutter.close(a.Args.Close())
 }
 
+func (a *transportArgs) NextType() Type {
+	return NextType(a.Args)
+}
+
 type transportTxArgs struct {
 	connPoolPutter
 	TxArgs
@@ -2,12 +2,27 @@ package redis_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/segmentio/objconv/resp"
 	redis "github.com/segmentio/redis-go"
 )
 
@@ -32,6 +47,106 @@ func TestTransport(t *testing.T) {
 			scenario: "cancelling an inflight request returns an net.OpError with context.Canceled as reason",
 			function: testTransportCancelRoundTrip,
 		},
+		{
+			scenario: "the OnConnect hook is called once on every new connection",
+			function: testTransportOnConnect,
+		},
+		{
+			scenario: "errors returned by the OnConnect hook are reported and the connection is discarded",
+			function: testTransportOnConnectError,
+		},
+		{
+			scenario: "setting a client name issues CLIENT SETNAME on new connections",
+			function: testTransportClientName,
+		},
+		{
+			scenario: "setting a database issues SELECT on new connections",
+			function: testTransportSelectDB,
+		},
+		{
+			scenario: "commands of a pipeline not answered before the server closed the connection fail with ErrServerClosed",
+			function: testTransportServerClosed,
+		},
+		{
+			scenario: "setting NoEvict and NoTouch configures the modes on new connections",
+			function: testTransportClientModes,
+		},
+		{
+			scenario: "the transport reports its attributes with CLIENT SETINFO and servers expose them to handlers",
+			function: testTransportClientInfo,
+		},
+		{
+			scenario: "errors returned by servers which don't support CLIENT SETINFO are ignored",
+			function: testTransportClientInfoNotSupported,
+		},
+		{
+			scenario: "setting credentials authenticates new connections with AUTH",
+			function: testTransportAuth,
+		},
+		{
+			scenario: "canceling a request while reading its response interrupts the read",
+			function: testTransportCancelRead,
+		},
+		{
+			scenario: "requests exceeding the limit of an adaptive limiter are shed",
+			function: testTransportLimiter,
+		},
+		{
+			scenario: "setting a hedge delay sends slow read-only requests again and uses the first response",
+			function: testTransportHedging,
+		},
+		{
+			scenario: "requests and responses larger than the connection buffers are written across multiple flushes",
+			function: testTransportBufferSizes,
+		},
+		{
+			scenario: "enabling compression on both the transport and the server compresses the traffic",
+			function: testTransportCompression,
+		},
+		{
+			scenario: "enabling compression on the transport only leaves the traffic uncompressed",
+			function: testTransportCompressionNotSupported,
+		},
+		{
+			scenario: "enabling checksums on both the transport and the server validates the traffic",
+			function: testTransportChecksum,
+		},
+		{
+			scenario: "reading corrupted data on a connection with checksums fails with ErrChecksumMismatch",
+			function: testTransportChecksumMismatch,
+		},
+		{
+			scenario: "enabling RESP3 on the transport translates the replies and passes push messages to OnPush",
+			function: testTransportRESP3,
+		},
+		{
+			scenario: "enabling RESP3 on the transport falls back to RESP2 when the server rejects HELLO 3",
+			function: testTransportRESP3NotSupported,
+		},
+		{
+			scenario: "enabling RESP3 on the transport falls back to RESP2 on new connections when the server drops or ignores HELLO 3",
+			function: testTransportRESP3Downgrade,
+		},
+		{
+			scenario: "shutting down a transport waits for in-flight requests and rejects new ones",
+			function: testTransportShutdown,
+		},
+		{
+			scenario: "shutting down a transport closes the connections of in-flight requests when the context expires",
+			function: testTransportShutdownTimeout,
+		},
+		{
+			scenario: "setting a TLS configuration or using the rediss:// scheme establishes connections over TLS",
+			function: testTransportTLS,
+		},
+		{
+			scenario: "TLS handshakes which don't complete in time are aborted",
+			function: testTransportTLSHandshakeTimeout,
+		},
+		{
+			scenario: "the statistics of the transport report its connections, dials, and pings",
+			function: testTransportStats,
+		},
 	}
 
 	for _, test := range tests {
@@ -151,3 +266,1290 @@ func testTransportCancelRoundTrip(t *testing.T) {
 		t.Errorf("bad root cause of the error: %#v", e.Err)
 	}
 }
+
+func testTransportOnConnect(t *testing.T) {
+	var names int32
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		if req.Cmds[0].Cmd == "CLIENT" {
+			atomic.AddInt32(&names, 1)
+		}
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{
+		OnConnect: func(ctx context.Context, conn *redis.Conn) error {
+			if err := conn.WriteCommands(redis.Command{Cmd: "CLIENT", Args: redis.List("SETNAME", "test")}); err != nil {
+				return err
+			}
+			return conn.ReadArgs().Close()
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	for i := 0; i != 3; i++ {
+		if err := cli.Exec(context.Background(), "SET", "hello", "world"); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&names); n != 1 {
+		t.Error("bad number of calls to the OnConnect hook:", n)
+	}
+}
+
+func testTransportOnConnectError(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	setupErr := errors.New("setup failed")
+
+	tr := &redis.Transport{
+		OnConnect: func(ctx context.Context, conn *redis.Conn) error {
+			return setupErr
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	if err := cli.Exec(context.Background(), "SET", "hello", "world"); err != setupErr {
+		t.Error("bad error:", err)
+	}
+}
+
+func testTransportClientName(t *testing.T) {
+	names := make(chan string, 1)
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		if cmd := req.Cmds[0]; cmd.Cmd == "CLIENT" {
+			var sub, name string
+			cmd.ParseArgs(&sub, &name)
+			names <- name
+		}
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{ClientName: "test.${pid}"}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	if err := cli.Exec(context.Background(), "SET", "hello", "world"); err != nil {
+		t.Error(err)
+	}
+
+	if name, expect := <-names, "test."+strconv.Itoa(os.Getpid()); name != expect {
+		t.Errorf("bad client name: %q != %q", name, expect)
+	}
+}
+
+func testTransportServerClosed(t *testing.T) {
+	tests := []struct {
+		scenario string
+		reset    bool
+		class    redis.ErrClass
+	}{
+		{
+			scenario: "the server closes the connection (FIN)",
+			reset:    false,
+			class:    redis.ErrClassServerClosed,
+		},
+		{
+			scenario: "the server resets the connection (RST)",
+			reset:    true,
+			class:    redis.ErrClassUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		reset := test.reset
+		t.Run(test.scenario, func(t *testing.T) {
+			addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+				if cmd == "CLIENT" {
+					return "" // setup commands of the transport
+				}
+				if args[0] != "B" {
+					return "$1\r\nx\r\n"
+				}
+				// The server answers B and closes the connection, the
+				// commands which follow are never answered.
+				io.WriteString(c, "$1\r\nb\r\n")
+				if reset {
+					c.Conn.(*net.TCPConn).SetLinger(0)
+				}
+				c.Close()
+				return ""
+			})
+
+			tr := &redis.Transport{}
+			defer tr.CloseIdleConnections()
+
+			cli := &redis.Client{Addr: addr, Transport: tr}
+
+			tx := cli.Pipeline(context.Background(),
+				redis.Command{Cmd: "GET", Args: redis.List("A")},
+				redis.Command{Cmd: "GET", Args: redis.List("B")},
+				redis.Command{Cmd: "GET", Args: redis.List("C")},
+				redis.Command{Cmd: "GET", Args: redis.List("D")},
+			)
+
+			for _, expect := range []string{"x", "b"} {
+				var s string
+				if err := redis.ParseArgs(tx.Next(), &s); err != nil {
+					t.Fatal(err)
+				}
+				if s != expect {
+					t.Errorf("bad value: %q != %q", s, expect)
+				}
+			}
+
+			var errs []error
+			for i := 0; i != 2; i++ {
+				errs = append(errs, redis.ParseArgs(tx.Next(), nil))
+			}
+
+			for _, err := range errs {
+				if class := redis.ErrorClass(err); class != test.class {
+					t.Errorf("bad error class: %s != %s (%v)", class, test.class, err)
+				}
+			}
+
+			if errs[0] != errs[1] {
+				t.Errorf("commands which were not answered reported different errors: %v, %v", errs[0], errs[1])
+			}
+
+			if err := tx.Close(); err != errs[0] {
+				t.Error("bad error returned by Close:", err)
+			}
+
+			// The connection must not be reused, the next request succeeds
+			// on a new connection.
+			var s string
+			if err := redis.ParseArgs(cli.Query(context.Background(), "GET", "A"), &s); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func testTransportSelectDB(t *testing.T) {
+	var mutex sync.Mutex
+	var selects []string
+	var sessions = map[string]string{}
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch cmd := req.Cmds[0]; cmd.Cmd {
+		case "SELECT":
+			var db string
+			cmd.ParseArgs(&db)
+			selects = append(selects, db)
+			sessions[req.Addr] = db
+			res.Write("OK")
+		default:
+			res.Write(sessions[req.Addr])
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{DB: 2}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	for i := 0; i != 2; i++ {
+		// The database is selected again after reconnecting.
+		tr.CloseIdleConnections()
+
+		s, err := redis.String(cli.Query(context.Background(), "GET", "hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != "2" {
+			t.Errorf("the request was not sent on a connection using the database: %q", s)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !reflect.DeepEqual(selects, []string{"2", "2"}) {
+		t.Error("bad SELECT commands:", selects)
+	}
+}
+
+func testTransportClientModes(t *testing.T) {
+	modes := make(chan string, 4)
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		if cmd := req.Cmds[0]; cmd.Cmd == "CLIENT" {
+			var mode, value string
+			cmd.ParseArgs(&mode, &value)
+			modes <- mode + " " + value
+		}
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{NoEvict: true, NoTouch: true}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	for i := 0; i != 2; i++ {
+		// The modes are applied again after reconnecting.
+		tr.CloseIdleConnections()
+
+		if err := cli.Exec(context.Background(), "SET", "hello", "world"); err != nil {
+			t.Fatal(err)
+		}
+
+		if mode := <-modes; mode != "NO-EVICT ON" {
+			t.Errorf("bad mode: %q", mode)
+		}
+
+		if mode := <-modes; mode != "NO-TOUCH ON" {
+			t.Errorf("bad mode: %q", mode)
+		}
+	}
+}
+
+func testTransportClientInfo(t *testing.T) {
+	attrs := make(chan map[string]string, 1)
+
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		attrs <- redis.ClientAttributes(req.Context)
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{
+		LibName:    "redis-go(mylib)",
+		ClientInfo: map[string]string{"service": "my service"},
+	}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	if err := cli.Exec(context.Background(), "SET", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	info := <-attrs
+
+	if name := info["lib-name"]; name != "redis-go(mylib)" {
+		t.Errorf("bad lib-name: %q", name)
+	}
+
+	if len(info["lib-ver"]) == 0 {
+		t.Error("missing lib-ver attribute")
+	}
+
+	if service := info["service"]; service != "my-service" {
+		t.Errorf("bad service attribute: %q", service)
+	}
+}
+
+func testTransportClientInfoNotSupported(t *testing.T) {
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		if cmd == "CLIENT" && args[0] == "SETINFO" {
+			return "-ERR unknown subcommand 'SETINFO'\r\n"
+		}
+		return "+OK\r\n"
+	})
+
+	tr := &redis.Transport{ClientName: "test"}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+
+	if err := cli.Exec(context.Background(), "SET", "hello", "world"); err != nil {
+		t.Error(err)
+	}
+
+	t.Run("errors of other setup commands abort the setup", func(t *testing.T) {
+		addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+			if cmd == "CLIENT" {
+				return "-ERR unknown subcommand\r\n"
+			}
+			return "+OK\r\n"
+		})
+
+		tr := &redis.Transport{ClientName: "test"}
+		defer tr.CloseIdleConnections()
+
+		cli := &redis.Client{Addr: addr, Transport: tr}
+
+		if err := cli.Exec(context.Background(), "SET", "hello", "world"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func testTransportAuth(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			res.Write("OK")
+		}),
+		RequirePass: "secret",
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	addr := l.Addr().String()
+
+	exec := func(tr *redis.Transport) error {
+		defer tr.CloseIdleConnections()
+		cli := &redis.Client{Addr: addr, Transport: tr}
+		return cli.Exec(context.Background(), "SET", "hello", "world")
+	}
+
+	if err := exec(&redis.Transport{}); err == nil || err.Error() != redis.ErrNoAuth.Error() {
+		t.Error("bad error without credentials:", err)
+	}
+
+	if err := exec(&redis.Transport{Password: "wrong"}); err == nil || err.Error() != redis.ErrWrongPass.Error() {
+		t.Error("bad error with a wrong password:", err)
+	}
+
+	if err := exec(&redis.Transport{Password: "secret", RESP3: true}); err != nil {
+		t.Error(err)
+	}
+
+	if err := exec(&redis.Transport{Username: "default", Password: "secret"}); err != nil {
+		t.Error(err)
+	}
+
+	var calls int32
+
+	tr := &redis.Transport{
+		Credentials: func(ctx context.Context, address string) (string, string, error) {
+			atomic.AddInt32(&calls, 1)
+			if address != addr {
+				t.Errorf("bad address passed to the credentials provider: %q", address)
+			}
+			return "default", "secret", nil
+		},
+	}
+
+	for i := 0; i != 2; i++ {
+		// The credentials are fetched again for every new connection.
+		tr.CloseIdleConnections()
+
+		if err := exec(tr); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Error("bad number of calls to the credentials provider:", n)
+	}
+}
+
+func testTransportCancelRead(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The server sends the first value of the response and never sends the
+	// second one.
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Read(make([]byte, 512))
+		conn.Write([]byte("*2\r\n$5\r\nhello\r\n"))
+		time.Sleep(time.Second)
+	}()
+
+	url := l.Addr().String()
+	tr := &redis.Transport{NoClientInfo: true}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	args := cli.Query(ctx, "LRANGE", "key", 0, -1)
+
+	var s string
+	if !args.Next(&s) || s != "hello" {
+		t.Fatalf("bad first value: %q", s)
+	}
+
+	start := time.Now()
+	cancel()
+
+	if err := args.Close(); err != context.Canceled {
+		t.Error("bad error:", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Error("closing the response took too long after the cancellation:", elapsed)
+	}
+}
+
+func testTransportLimiter(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	limiter := &redis.AdaptiveLimiter{InitialLimit: 1, MaxLimit: 1}
+	tr := &redis.Transport{Limiter: limiter}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+	ctx := context.Background()
+
+	// The response is not closed, the request remains in flight.
+	args := cli.Query(ctx, "GET", "hello")
+
+	if err := cli.Exec(ctx, "GET", "world"); err != redis.ErrOverloaded {
+		t.Error("bad error:", err)
+	}
+
+	if err := args.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if n := limiter.Inflight(); n != 0 {
+		t.Error("bad number of requests in flight:", n)
+	}
+
+	if err := cli.Exec(ctx, "GET", "world"); err != nil {
+		t.Error(err)
+	}
+}
+
+func testTransportStats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		switch cmd {
+		case "CLIENT":
+			return "" // setup commands of the transport
+		case "PING":
+			return "+PONG\r\n"
+		default:
+			return "+OK\r\n"
+		}
+	})
+
+	tr := &redis.Transport{
+		PingInterval: 10 * time.Millisecond,
+		PingTimeout:  100 * time.Millisecond,
+	}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+
+	args := cli.Query(ctx, "GET", "A")
+
+	if stats := tr.Stats(); stats.Conns != 1 || stats.ActiveConns != 1 || stats.IdleConns != 0 {
+		t.Errorf("bad stats while a request is in flight: %+v", stats)
+	}
+
+	if err := args.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := tr.Stats(); stats.Conns != 1 || stats.ActiveConns != 0 || stats.IdleConns != 1 || stats.Dials != 1 {
+		t.Errorf("bad stats after the request completed: %+v", stats)
+	}
+
+	waitFor(t, ctx, func() bool { return tr.Stats().Pings != 0 })
+
+	unused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unused.Close()
+
+	if err := (&redis.Client{Addr: unused.Addr().String(), Transport: tr}).Exec(ctx, "GET", "A"); err == nil {
+		t.Fatal("expected an error when connecting to a closed port")
+	}
+
+	if stats := tr.Stats(); stats.Dials != 2 || stats.DialErrors != 1 || stats.PingErrors != 0 {
+		t.Errorf("bad stats after a dial error: %+v", stats)
+	}
+
+	tr.CloseIdleConnections()
+
+	if stats := tr.Stats(); stats.Conns != 0 || stats.IdleConns != 0 {
+		t.Errorf("bad stats after closing the idle connections: %+v", stats)
+	}
+}
+
+func testTransportHedging(t *testing.T) {
+	// The servers reply with their name, delaying the first command they
+	// receive.
+	newHedgeServer := func(name string, delay time.Duration) string {
+		var calls int32
+		return newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+			if cmd == "CLIENT" {
+				return "" // setup commands of the transport
+			}
+			if atomic.AddInt32(&calls, 1) == 1 {
+				time.Sleep(delay)
+			}
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(name), name)
+		})
+	}
+
+	tests := []struct {
+		scenario  string
+		cmd       string
+		delay     time.Duration
+		replica   bool
+		value     string
+		hedges    int64
+		hedgeWins int64
+	}{
+		{
+			scenario: "requests answered before the delay are not hedged",
+			cmd:      "GET",
+			value:    "primary",
+		},
+		{
+			scenario:  "slow requests are hedged on another connection",
+			cmd:       "GET",
+			delay:     time.Second,
+			value:     "primary",
+			hedges:    1,
+			hedgeWins: 1,
+		},
+		{
+			scenario:  "hedged requests are sent to the address returned by HedgeAddr",
+			cmd:       "GET",
+			delay:     time.Second,
+			replica:   true,
+			value:     "replica",
+			hedges:    1,
+			hedgeWins: 1,
+		},
+		{
+			scenario: "write requests are not hedged",
+			cmd:      "SET",
+			delay:    100 * time.Millisecond,
+			value:    "primary",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.scenario, func(t *testing.T) {
+			primary := newHedgeServer("primary", test.delay)
+			replica := newHedgeServer("replica", 0)
+
+			tr := &redis.Transport{HedgeDelay: 20 * time.Millisecond}
+			defer tr.CloseIdleConnections()
+
+			if test.replica {
+				tr.HedgeAddr = func(string) string { return replica }
+			}
+
+			cli := &redis.Client{Addr: primary, Transport: tr}
+
+			start := time.Now()
+
+			value, err := redis.String(cli.Query(context.Background(), test.cmd, "key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if value != test.value {
+				t.Errorf("bad value: %q != %q", value, test.value)
+			}
+
+			if test.hedgeWins != 0 {
+				if elapsed := time.Since(start); elapsed >= test.delay {
+					t.Error("the hedged request did not shorten the latency:", elapsed)
+				}
+			}
+
+			stats := tr.Stats()
+
+			if stats.Hedges != test.hedges {
+				t.Error("bad number of hedged requests:", stats.Hedges)
+			}
+
+			if stats.HedgeWins != test.hedgeWins {
+				t.Error("bad number of hedged requests which won:", stats.HedgeWins)
+			}
+		})
+	}
+}
+
+func testTransportBufferSizes(t *testing.T) {
+	const bufferSize = 512
+	const count = 10000
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			var values []string
+			var value string
+
+			for req.Cmds[0].Args.Next(&value) {
+				values = append(values, value)
+			}
+
+			res.Write(values)
+		}),
+		ReadBufferSize:  bufferSize,
+		WriteBufferSize: bufferSize,
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	var maxWrite int64
+	tr := &redis.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			c, err := (&net.Dialer{}).DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return &writeSizeConn{Conn: c, max: &maxWrite}, nil
+		},
+		ReadBufferSize:  bufferSize,
+		WriteBufferSize: bufferSize,
+	}
+	defer tr.CloseIdleConnections()
+
+	values := make([]interface{}, count)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+
+	cli := &redis.Client{Addr: l.Addr().String(), Transport: tr}
+	args := cli.Query(context.Background(), "ECHO", values...)
+
+	if n := args.Len(); n != count {
+		t.Error("bad number of values:", n)
+	}
+
+	var value string
+	for i := 0; args.Next(&value); i++ {
+		if value != strconv.Itoa(i) {
+			t.Errorf("bad value at index %d: %q", i, value)
+			break
+		}
+	}
+
+	if err := args.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if n := atomic.LoadInt64(&maxWrite); n > bufferSize {
+		t.Error("writes exceeded the size of the write buffer:", n)
+	}
+}
+
+type writeSizeConn struct {
+	net.Conn
+	max *int64
+}
+
+func (c *writeSizeConn) Write(b []byte) (int, error) {
+	for n := int64(len(b)); ; {
+		max := atomic.LoadInt64(c.max)
+		if n <= max || atomic.CompareAndSwapInt64(c.max, max, n) {
+			break
+		}
+	}
+	return c.Conn.Write(b)
+}
+
+func testTransportCompression(t *testing.T) {
+	if n := testCompression(t, true); n > 4096 {
+		t.Error("too many bytes were written for a compressed value:", n)
+	}
+}
+
+func testTransportCompressionNotSupported(t *testing.T) {
+	if n := testCompression(t, false); n < 65536 {
+		t.Error("too few bytes were written for an uncompressed value:", n)
+	}
+}
+
+// testCompression sends a large value to a server echoing it, and returns the
+// number of bytes written by the transport.
+func testCompression(t *testing.T, compression bool) int64 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			if req.Cmds[0].Cmd == "HELLO" {
+				// Like vanilla redis, which rejects unknown HELLO attributes.
+				res.Write(resp.NewError("ERR Syntax error in HELLO option 'COMPRESS'"))
+				return
+			}
+			var value []byte
+			req.Cmds[0].ParseArgs(&value)
+			res.Write(value)
+		}),
+		Compression: compression,
+	}
+	defer srv.Close()
+	go srv.Serve(l)
+
+	var written int64
+	tr := &redis.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			c, err := (&net.Dialer{}).DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return &writeCountConn{Conn: c, count: &written}, nil
+		},
+		Compression: true,
+	}
+	defer tr.CloseIdleConnections()
+
+	value := strings.Repeat("0123456789", 6554)
+	cli := &redis.Client{Addr: l.Addr().String(), Transport: tr}
+
+	for i := 0; i != 2; i++ {
+		var echo string
+
+		if err := redis.ParseArgs(cli.Query(context.Background(), "ECHO", value), &echo); err != nil {
+			t.Fatal(err)
+		}
+
+		if echo != value {
+			t.Fatal("the value was not echoed back")
+		}
+	}
+
+	return atomic.LoadInt64(&written) / 2
+}
+
+type writeCountConn struct {
+	net.Conn
+	count *int64
+}
+
+func (c *writeCountConn) Write(b []byte) (int, error) {
+	atomic.AddInt64(c.count, int64(len(b)))
+	return c.Conn.Write(b)
+}
+
+func testTransportChecksum(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var value []byte
+		req.Cmds[0].ParseArgs(&value)
+		res.Write(value)
+	}))
+	srv.Checksum = true
+	srv.Compression = true
+	defer srv.Close()
+
+	tr := &redis.Transport{Checksum: true, Compression: true}
+	defer tr.CloseIdleConnections()
+
+	value := strings.Repeat("0123456789", 10000)
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	for i := 0; i != 2; i++ {
+		var echo string
+
+		if err := redis.ParseArgs(cli.Query(context.Background(), "ECHO", value), &echo); err != nil {
+			t.Fatal(err)
+		}
+
+		if echo != value {
+			t.Fatal("the value was not echoed back")
+		}
+	}
+}
+
+func testTransportChecksumMismatch(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("0123456789")
+	}))
+	srv.Checksum = true
+	defer srv.Close()
+
+	var corrupt int32
+	tr := &redis.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			c, err := (&net.Dialer{}).DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return &corruptConn{Conn: c, corrupt: &corrupt}, nil
+		},
+		Checksum: true,
+	}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+	ctx := context.Background()
+
+	if err := cli.Exec(ctx, "GET", "A"); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&corrupt, 1)
+
+	if err := cli.Exec(ctx, "GET", "A"); !errors.Is(err, redis.ErrChecksumMismatch) {
+		t.Error("bad error:", err)
+	}
+}
+
+// corruptConn flips the last bit of the data it reads when corrupt is set.
+type corruptConn struct {
+	net.Conn
+	corrupt *int32
+}
+
+func (c *corruptConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n != 0 && atomic.LoadInt32(c.corrupt) != 0 {
+		b[n-1] ^= 1
+	}
+	return n, err
+}
+
+func testTransportRESP3(t *testing.T) {
+	addr := newRESP3Server(t, map[string]string{
+		"HELLO": "%2\r\n+server\r\n+redis\r\n+proto\r\n:3\r\n",
+		// The reply is preceded by a push message, and has an attribute.
+		"HGETALL": ">2\r\n+invalidate\r\n*1\r\n$1\r\nA\r\n" +
+			"|1\r\n+ttl\r\n:3600\r\n%2\r\n$1\r\na\r\n,1.5\r\n$1\r\nb\r\n#t\r\n",
+		"GET":      "=8\r\ntxt:abcd\r\n",
+		"EXISTS":   "_\r\n",
+		"SMEMBERS": "~2\r\n+x\r\n+y\r\n",
+		"FAIL":     "!11\r\nERR failure\r\n",
+	})
+
+	pushes := make(chan []interface{}, 1)
+	tr := &redis.Transport{
+		RESP3: true,
+		OnPush: func(address string, msg []interface{}) {
+			pushes <- msg
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+	ctx := context.Background()
+
+	readArgsEqual(t, cli.Query(ctx, "HGETALL", "A"), nil, "a", "1.5", "b", "1")
+
+	select {
+	case msg := <-pushes:
+		if fmt.Sprintf("%s", msg) != "[invalidate [A]]" {
+			t.Error("bad push message:", msg)
+		}
+	default:
+		t.Error("no push message was received")
+	}
+
+	if s, err := redis.String(cli.Query(ctx, "GET", "A")); err != nil {
+		t.Error(err)
+	} else if s != "abcd" {
+		t.Error("bad verbatim string:", s)
+	}
+
+	var p *string
+	if err := redis.ParseArgs(cli.Query(ctx, "EXISTS", "A"), &p); err != nil {
+		t.Error(err)
+	} else if p != nil {
+		t.Error("bad null:", *p)
+	}
+
+	readArgsEqual(t, cli.Query(ctx, "SMEMBERS", "A"), nil, "x", "y")
+
+	if err := cli.Exec(ctx, "FAIL"); err == nil || err.Error() != "ERR failure" {
+		t.Error("bad error:", err)
+	}
+}
+
+func testTransportRESP3NotSupported(t *testing.T) {
+	addr := newRESP3Server(t, map[string]string{
+		"HELLO": "-ERR unknown command 'HELLO'\r\n",
+		"SET":   "+OK\r\n",
+	})
+
+	tr := &redis.Transport{RESP3: true}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+
+	if s, err := cli.ExecStatus(context.Background(), "SET", "A", "1"); err != nil {
+		t.Error(err)
+	} else if s != "OK" {
+		t.Error("bad status:", s)
+	}
+
+	if protocols := tr.Stats().Protocols; !reflect.DeepEqual(protocols, map[string]int{addr: 2}) {
+		t.Error("bad protocols:", protocols)
+	}
+}
+
+func testTransportRESP3Downgrade(t *testing.T) {
+	tests := []struct {
+		scenario string
+		hello    func(c *rawConn)
+	}{
+		{
+			scenario: "the server closes the connection",
+			hello:    func(c *rawConn) { c.Close() },
+		},
+		{
+			scenario: "the server never replies",
+			hello:    func(c *rawConn) { time.Sleep(time.Second) },
+		},
+	}
+
+	for _, test := range tests {
+		hello := test.hello
+		t.Run(test.scenario, func(t *testing.T) {
+			var mutex sync.Mutex
+			var hellos int
+
+			addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+				switch cmd {
+				case "HELLO":
+					mutex.Lock()
+					hellos++
+					mutex.Unlock()
+					hello(c)
+					return ""
+				case "SET":
+					return "+OK\r\n"
+				default:
+					return ""
+				}
+			})
+
+			tr := &redis.Transport{RESP3: true, PingTimeout: 50 * time.Millisecond}
+			defer tr.CloseIdleConnections()
+
+			cli := &redis.Client{Addr: addr, Transport: tr}
+
+			for i := 0; i != 2; i++ {
+				if s, err := cli.ExecStatus(context.Background(), "SET", "A", "1"); err != nil {
+					t.Fatal(err)
+				} else if s != "OK" {
+					t.Error("bad status:", s)
+				}
+
+				// New connections to the address must not send HELLO again.
+				tr.CloseIdleConnections()
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if hellos != 1 {
+				t.Error("bad number of HELLO commands:", hellos)
+			}
+
+			if protocols := tr.Stats().Protocols; !reflect.DeepEqual(protocols, map[string]int{addr: 2}) {
+				t.Error("bad protocols:", protocols)
+			}
+		})
+	}
+}
+
+// newRESP3Server starts a server responding to commands with the raw replies
+// of the given map, it returns the address of the server.
+func newRESP3Server(t *testing.T, replies map[string]string) string {
+	return newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		return replies[cmd]
+	})
+}
+
+// rawConn is a connection of a server started by newRawServer, writes are
+// synchronized so they can be made by any goroutine.
+type rawConn struct {
+	net.Conn
+	mutex sync.Mutex
+}
+
+func (c *rawConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Conn.Write(b)
+}
+
+// newRawServer starts a server responding to commands with the raw replies
+// returned by handler, it returns the address of the server.
+func newRawServer(t *testing.T, handler func(c *rawConn, cmd string, args []string) string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				c := &rawConn{Conn: nc}
+				defer c.Close()
+				conn := redis.NewServerConn(nc)
+
+				for {
+					var cmd redis.Command
+					var args []string
+					var arg string
+					r := conn.ReadCommands()
+
+					if !r.Read(&cmd) {
+						r.Close()
+						return
+					}
+
+					for cmd.Args.Next(&arg) {
+						args = append(args, arg)
+					}
+
+					cmd.Args.Close()
+					r.Close()
+
+					reply := handler(c, cmd.Cmd, args)
+
+					// Transports report their attributes on new connections.
+					if len(reply) == 0 && cmd.Cmd == "CLIENT" && len(args) != 0 && args[0] == "SETINFO" {
+						reply = "+OK\r\n"
+					}
+
+					if _, err := io.WriteString(c, reply); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+func testTransportShutdown(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("OK")
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	cli := &redis.Client{Addr: url, Transport: tr}
+	ctx := context.Background()
+
+	// The response is not closed, the request remains in flight.
+	args := cli.Query(ctx, "GET", "hello")
+
+	done := make(chan error, 1)
+	go func() { done <- tr.Shutdown(ctx) }()
+
+	select {
+	case err := <-done:
+		t.Fatal("shutdown returned before the in-flight request completed:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := cli.Exec(ctx, "GET", "world"); !errors.Is(err, redis.ErrTransportClosed) {
+		t.Error("bad error:", err)
+	}
+
+	var value string
+	if err := redis.ParseArgs(args, &value); err != nil {
+		t.Error(err)
+	} else if value != "OK" {
+		t.Error("bad value:", value)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("shutdown did not return after the in-flight request completed")
+	}
+}
+
+func testTransportShutdownTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	srv, url := newServerTimeout(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		<-unblock
+		res.Write("OK")
+	}), time.Second)
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	cli := &redis.Client{Addr: url, Transport: tr}
+	errch := make(chan error, 1)
+
+	go func() {
+		var value string
+		errch <- redis.ParseArgs(cli.Query(context.Background(), "GET", "hello"), &value)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := tr.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Error("bad error:", err)
+	}
+
+	select {
+	case err := <-errch:
+		if err == nil {
+			t.Error("a request interrupted by a shutdown should fail")
+		}
+	case <-time.After(time.Second):
+		t.Error("the connection of the in-flight request was not closed")
+	}
+}
+
+func testTransportTLS(t *testing.T) {
+	cert, roots := newTestCertificate(t, "127.0.0.1")
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			res.Write("OK")
+		}),
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	ctx := context.Background()
+	addr := l.Addr().String()
+
+	tr := &redis.Transport{TLSConfig: &tls.Config{RootCAs: roots}}
+	defer tr.CloseIdleConnections()
+
+	for _, addr := range []string{addr, "rediss://" + addr} {
+		cli := &redis.Client{Addr: addr, Transport: tr}
+
+		if s, err := redis.String(cli.Query(ctx, "GET", "key")); err != nil || s != "OK" {
+			t.Errorf("%s: bad response: %q %v", addr, s, err)
+		}
+	}
+
+	// Without the configuration, the certificate of the server is verified
+	// against the system roots, which don't know about it.
+	cli := &redis.Client{Addr: "rediss://" + addr, Transport: &redis.Transport{}}
+
+	var certErr *tls.CertificateVerificationError
+	if err := cli.Exec(ctx, "GET", "key"); !errors.As(err, &certErr) {
+		t.Error("the certificate of the server must be verified:", err)
+	}
+}
+
+func testTransportTLSHandshakeTimeout(t *testing.T) {
+	// The server accepts connections but never completes the handshake.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	tr := &redis.Transport{TLSHandshakeTimeout: 50 * time.Millisecond}
+	cli := &redis.Client{Addr: "rediss://" + l.Addr().String(), Transport: tr}
+
+	start := time.Now()
+
+	if err := cli.Exec(context.Background(), "GET", "key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected the handshake to time out:", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("the handshake timed out too late:", elapsed)
+	}
+}
+
+// newTestCertificate returns a self-signed certificate for the given IP
+// addresses and host names, and the pool of roots trusting it.
+func newTestCertificate(t *testing.T, hosts ...string) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"redis-go"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, roots
+}
@@ -0,0 +1,250 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// TTLMode is the way a TTLRewriter computes the new TTL of keys.
+type TTLMode int
+
+const (
+	// TTLSet sets the TTL of all keys to the TTL of the rewriter.
+	TTLSet TTLMode = iota
+
+	// TTLExtend adds the TTL of the rewriter to the TTL of keys, keys without
+	// expiration are left unchanged.
+	TTLExtend
+
+	// TTLCap lowers the TTL of keys to the TTL of the rewriter when it's
+	// greater, keys without expiration are given the TTL of the rewriter.
+	TTLCap
+)
+
+// A TTLRewriter adjusts the TTL of the keys matching a pattern in bulk.
+//
+// Keys are scanned with SCAN, their TTLs are read and rewritten in pipelines of
+// one command per key of each batch returned by SCAN. The TTLs of keys that are
+// modified by other clients while they are being rewritten may be overwritten.
+type TTLRewriter struct {
+	// Client is used to scan and rewrite keys.
+	Client *Client
+
+	// Mode is the way the new TTL of keys is computed.
+	Mode TTLMode
+
+	// TTL is the TTL applied to keys, added to their TTL with TTLExtend. It is
+	// rounded to the millisecond and must be positive.
+	TTL time.Duration
+
+	// DryRun, when true, computes and reports the changes without writing
+	// them, the OnChange function can be used to review them.
+	DryRun bool
+
+	// OnChange, if not nil, is called with the key, the current TTL and the
+	// new TTL of every key whose TTL is rewritten. The current TTL is negative
+	// for keys without expiration. The function may be called concurrently
+	// by multiple goroutines.
+	OnChange func(key string, before, after time.Duration)
+
+	// Concurrency is the maximum number of batches of keys rewritten
+	// concurrently. If zero, batches are rewritten one at a time.
+	Concurrency int
+
+	// KeysPerSecond limits the rate at which keys are rewritten. Zero means
+	// no limit.
+	KeysPerSecond int
+
+	// ScanCount is the COUNT hint passed to SCAN, which bounds the size of the
+	// pipelines. If zero, the server's default is used.
+	ScanCount int
+}
+
+// TTLReport reports the work done by a call to TTLRewriter.Rewrite.
+type TTLReport struct {
+	Scanned   int // number of keys scanned
+	Changed   int // number of keys whose TTL was rewritten, or would be in dry-run mode
+	Unchanged int // number of keys whose TTL was already correct, or which had no expiration with TTLExtend
+	Missing   int // number of keys which expired or were deleted after being scanned
+}
+
+// Rewrite rewrites the TTL of the keys matching pattern.
+//
+// The method stops and returns the first error it encounters, along with the
+// report of the keys rewritten so far.
+func (r *TTLRewriter) Rewrite(ctx context.Context, pattern string) (TTLReport, error) {
+	var report TTLReport
+
+	if r.TTL < time.Millisecond {
+		return report, errors.New("redis: the TTL of a TTL rewriter must be at least one millisecond")
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var errs = make(chan error, 1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan []string)
+	limit := &rateLimiter{rate: r.KeysPerSecond, start: time.Now()}
+
+	concurrency := r.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	for i := 0; i != concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for batch := range batches {
+				limit.wait(ctx, len(batch))
+
+				batchReport, err := r.rewrite(ctx, batch)
+
+				mutex.Lock()
+				report.Scanned += batchReport.Scanned
+				report.Changed += batchReport.Changed
+				report.Unchanged += batchReport.Unchanged
+				report.Missing += batchReport.Missing
+				mutex.Unlock()
+
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					cancel()
+				}
+			}
+		}()
+	}
+
+	err := r.scan(ctx, pattern, batches)
+	close(batches)
+	wg.Wait()
+
+	select {
+	case e := <-errs:
+		err = e
+	default:
+	}
+
+	return report, err
+}
+
+func (r *TTLRewriter) scan(ctx context.Context, pattern string, batches chan<- []string) error {
+	cursor := "0"
+
+	for {
+		var batch []string
+		var args = []interface{}{cursor, "MATCH", pattern}
+
+		if r.ScanCount > 0 {
+			args = append(args, "COUNT", r.ScanCount)
+		}
+
+		if err := ParseArgs(r.Client.Query(ctx, "SCAN", args...), &cursor, &batch); err != nil {
+			return err
+		}
+
+		if len(batch) != 0 {
+			select {
+			case batches <- batch:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// rewrite reads the TTLs of keys in a pipeline, and writes the new TTLs in a
+// second pipeline.
+func (r *TTLRewriter) rewrite(ctx context.Context, keys []string) (TTLReport, error) {
+	report := TTLReport{Scanned: len(keys)}
+
+	cmds := make([]Command, len(keys))
+	for i, key := range keys {
+		cmds[i] = Command{Cmd: "PTTL", Args: List(key)}
+	}
+
+	ttls := make([]int64, len(keys))
+	tx := r.Client.Pipeline(ctx, cmds...)
+
+	for i := range ttls {
+		if err := ParseArgs(tx.Next(), &ttls[i]); err != nil {
+			tx.Close()
+			return TTLReport{}, err
+		}
+	}
+
+	if err := tx.Close(); err != nil {
+		return TTLReport{}, err
+	}
+
+	var writes []Command
+
+	for i, key := range keys {
+		before := time.Duration(ttls[i]) * time.Millisecond
+		after, ok := r.newTTL(ttls[i])
+
+		switch {
+		case ttls[i] == -2:
+			report.Missing++
+		case !ok:
+			report.Unchanged++
+		default:
+			report.Changed++
+			if r.OnChange != nil {
+				r.OnChange(key, before, time.Duration(after)*time.Millisecond)
+			}
+			writes = append(writes, Command{Cmd: "PEXPIRE", Args: List(key, after)})
+		}
+	}
+
+	if r.DryRun || len(writes) == 0 {
+		return report, nil
+	}
+
+	tx = r.Client.Pipeline(ctx, writes...)
+
+	for range writes {
+		if err := ParseArgs(tx.Next(), nil); err != nil {
+			tx.Close()
+			return report, err
+		}
+	}
+
+	return report, tx.Close()
+}
+
+// newTTL returns the new TTL of a key in milliseconds given its current TTL,
+// and whether it differs from the current one.
+func (r *TTLRewriter) newTTL(ttl int64) (int64, bool) {
+	d := r.TTL.Milliseconds()
+
+	switch {
+	case ttl == -2:
+		return 0, false
+	case r.Mode == TTLExtend:
+		if ttl < 0 {
+			return 0, false
+		}
+		return ttl + d, true
+	case r.Mode == TTLCap:
+		if ttl >= 0 && ttl <= d {
+			return 0, false
+		}
+		return d, true
+	default:
+		return d, ttl != d
+	}
+}
@@ -0,0 +1,120 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestTTLRewriter(t *testing.T) {
+	tests := []struct {
+		scenario string
+		mode     redis.TTLMode
+		dryRun   bool
+		report   redis.TTLReport
+		ttls     map[string]int64
+	}{
+		{
+			scenario: "set",
+			mode:     redis.TTLSet,
+			report:   redis.TTLReport{Scanned: 4, Changed: 3, Missing: 1},
+			ttls:     map[string]int64{"persistent": 1000, "short": 1000, "long": 1000},
+		},
+		{
+			scenario: "extend",
+			mode:     redis.TTLExtend,
+			report:   redis.TTLReport{Scanned: 4, Changed: 2, Unchanged: 1, Missing: 1},
+			ttls:     map[string]int64{"persistent": -1, "short": 1500, "long": 6000},
+		},
+		{
+			scenario: "cap",
+			mode:     redis.TTLCap,
+			report:   redis.TTLReport{Scanned: 4, Changed: 2, Unchanged: 1, Missing: 1},
+			ttls:     map[string]int64{"persistent": 1000, "short": 500, "long": 1000},
+		},
+		{
+			scenario: "dry-run",
+			mode:     redis.TTLSet,
+			dryRun:   true,
+			report:   redis.TTLReport{Scanned: 4, Changed: 3, Missing: 1},
+			ttls:     map[string]int64{"persistent": -1, "short": 500, "long": 5000},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			var mutex sync.Mutex
+			var ttls = map[string]int64{"persistent": -1, "short": 500, "long": 5000}
+
+			srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+				var key string
+				var ttl int64
+				cmd := req.Cmds[0]
+
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				switch cmd.Cmd {
+				case "SCAN":
+					res.WriteStream(2)
+					res.Write("0")
+					res.Write([]string{"persistent", "short", "long", "deleted"})
+				case "PTTL":
+					cmd.ParseArgs(&key)
+					if ttl, ok := ttls[key]; ok {
+						res.Write(ttl)
+					} else {
+						res.Write(-2)
+					}
+				case "PEXPIRE":
+					cmd.ParseArgs(&key, &ttl)
+					ttls[key] = ttl
+					res.Write(1)
+				}
+			}))
+			defer srv.Close()
+
+			tr := &redis.Transport{}
+			defer tr.CloseIdleConnections()
+
+			var changes []string
+			var changesMutex sync.Mutex
+
+			rewriter := &redis.TTLRewriter{
+				Client: &redis.Client{Addr: url, Transport: tr},
+				Mode:   test.mode,
+				TTL:    time.Second,
+				DryRun: test.dryRun,
+				OnChange: func(key string, before, after time.Duration) {
+					changesMutex.Lock()
+					changes = append(changes, key)
+					changesMutex.Unlock()
+				},
+			}
+
+			report, err := rewriter.Rewrite(context.Background(), "*")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if report != test.report {
+				t.Errorf("bad report: %+v", report)
+			}
+
+			if len(changes) != test.report.Changed {
+				t.Errorf("bad changes: %q", changes)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if !reflect.DeepEqual(ttls, test.ttls) {
+				t.Errorf("bad TTLs: %v", ttls)
+			}
+		})
+	}
+}
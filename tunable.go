@@ -0,0 +1,362 @@
+package redis
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+// A Tunable is a configuration parameter which can be read and changed while
+// a program is running, typically by the CONFIG GET and CONFIG SET commands.
+//
+// The interface is the same as flag.Value, values from the flag package can
+// be registered as tunables. Implementations must be safe to use concurrently
+// from multiple goroutines, since tunables are changed by the goroutines
+// serving CONFIG SET while the components they configure are reading them.
+type Tunable interface {
+	// String returns the representation of the current value.
+	String() string
+
+	// Set parses s and changes the value, or returns an error if s is not
+	// a valid value.
+	Set(s string) error
+}
+
+// A TunableRegistry holds the tunables of a server. Server components
+// register their tunables under the names reported and changed by CONFIG GET
+// and CONFIG SET, and programs can be notified of changes to react to them.
+// The limits of servers and brokers are registered by Server.RegisterTunables
+// and Broker.RegisterTunables.
+//
+// The zero value is an empty registry ready to use.
+type TunableRegistry struct {
+	mutex    sync.RWMutex
+	tunables map[string]Tunable
+	notify   []func(name string, value string)
+}
+
+// Register adds t to the registry under name. Names are case insensitive, the
+// method panics if a tunable was already registered with the same name.
+func (r *TunableRegistry) Register(name string, t Tunable) {
+	name = strings.ToLower(name)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.tunables[name]; exists {
+		panic("redis: multiple registrations for tunable " + name)
+	}
+
+	if r.tunables == nil {
+		r.tunables = make(map[string]Tunable)
+	}
+
+	r.tunables[name] = t
+}
+
+// Lookup returns the tunable registered under name, or nil if none exists.
+func (r *TunableRegistry) Lookup(name string) Tunable {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.tunables[strings.ToLower(name)]
+}
+
+// Get returns the names and values of the tunables matching the glob-style
+// pattern, as a flat list of name/value pairs sorted by name.
+func (r *TunableRegistry) Get(pattern string) []string {
+	pattern = strings.ToLower(pattern)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.tunables))
+
+	for name := range r.tunables {
+		if match, _ := path.Match(pattern, name); match {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	pairs := make([]string, 0, 2*len(names))
+
+	for _, name := range names {
+		pairs = append(pairs, name, r.tunables[name].String())
+	}
+
+	return pairs
+}
+
+// Set changes the values of tunables, pairs is a flat list of name/value
+// pairs. Changes are applied all at once: if one of the names is unknown or
+// one of the values is invalid, the tunables that were already changed are
+// restored and a *resp.Error carrying the message of redis is returned.
+//
+// The functions registered with Notify are called for each changed tunable
+// after all of them were set.
+func (r *TunableRegistry) Set(pairs ...string) error {
+	if len(pairs)%2 != 0 {
+		return errWrongNumberOfArgs("config|set")
+	}
+
+	r.mutex.Lock()
+
+	tunables := make([]Tunable, len(pairs)/2)
+
+	for i := range tunables {
+		name := strings.ToLower(pairs[2*i])
+
+		if tunables[i] = r.tunables[name]; tunables[i] == nil {
+			r.mutex.Unlock()
+			return resp.NewError("ERR Unsupported CONFIG parameter: " + name)
+		}
+	}
+
+	saved := make([]string, len(tunables))
+
+	for i, t := range tunables {
+		saved[i] = t.String()
+
+		if err := t.Set(pairs[2*i+1]); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				tunables[j].Set(saved[j])
+			}
+			r.mutex.Unlock()
+			return resp.NewError(fmt.Sprintf("ERR Invalid argument '%s' for CONFIG SET '%s' - %s", pairs[2*i+1], strings.ToLower(pairs[2*i]), err))
+		}
+	}
+
+	notify := r.notify
+	r.mutex.Unlock()
+
+	for i, t := range tunables {
+		for _, f := range notify {
+			f(strings.ToLower(pairs[2*i]), t.String())
+		}
+	}
+
+	return nil
+}
+
+// Notify registers f to be called with the name and new value of tunables
+// changed by Set.
+func (r *TunableRegistry) Notify(f func(name string, value string)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.notify = append(r.notify, f)
+}
+
+// HandleConfig registers handlers for the CONFIG GET and CONFIG SET commands
+// on mux, backed by the registry. CONFIG GET accepts multiple patterns, and
+// CONFIG SET multiple name/value pairs.
+func (r *TunableRegistry) HandleConfig(mux *ServeMux) {
+	mux.HandleArity("CONFIG GET", -3, HandlerFunc(r.serveConfigGet))
+	mux.HandleArity("CONFIG SET", -4, HandlerFunc(r.serveConfigSet))
+}
+
+func (r *TunableRegistry) serveConfigGet(res ResponseWriter, req *Request) {
+	var pairs []string
+	var pattern string
+	var seen = make(map[string]bool)
+
+	for req.Cmds[0].Args.Next(&pattern) {
+		p := r.Get(pattern)
+
+		for i := 0; i < len(p); i += 2 {
+			if !seen[p[i]] {
+				seen[p[i]] = true
+				pairs = append(pairs, p[i], p[i+1])
+			}
+		}
+	}
+
+	if err := req.Cmds[0].Args.Close(); err != nil {
+		res.Write(err)
+		return
+	}
+
+	res.WriteStream(len(pairs))
+
+	for _, s := range pairs {
+		res.Write(s)
+	}
+}
+
+func (r *TunableRegistry) serveConfigSet(res ResponseWriter, req *Request) {
+	var pairs []string
+	var arg string
+
+	for req.Cmds[0].Args.Next(&arg) {
+		pairs = append(pairs, arg)
+	}
+
+	if err := req.Cmds[0].Args.Close(); err != nil {
+		res.Write(err)
+		return
+	}
+
+	if err := r.Set(pairs...); err != nil {
+		res.Write(err)
+		return
+	}
+
+	res.Write("OK")
+}
+
+// IntTunable is a Tunable holding an integer.
+type IntTunable struct {
+	// Min and Max bound the values accepted by Set, they are ignored if both
+	// are zero.
+	Min int64
+	Max int64
+
+	value int64
+}
+
+// Load returns the current value of t.
+func (t *IntTunable) Load() int64 { return atomic.LoadInt64(&t.value) }
+
+// Store changes the value of t, bypassing the bounds check.
+func (t *IntTunable) Store(v int64) { atomic.StoreInt64(&t.value, v) }
+
+// String satisfies the Tunable interface.
+func (t *IntTunable) String() string { return strconv.FormatInt(t.Load(), 10) }
+
+// Set satisfies the Tunable interface.
+func (t *IntTunable) Set(s string) error {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("argument couldn't be parsed into an integer")
+	}
+	if (t.Min != 0 || t.Max != 0) && (v < t.Min || v > t.Max) {
+		return fmt.Errorf("argument must be between %d and %d inclusive", t.Min, t.Max)
+	}
+	t.Store(v)
+	return nil
+}
+
+// DurationTunable is a Tunable holding a duration, represented as an integer
+// number of units, like the timeout of redis which is set in seconds.
+type DurationTunable struct {
+	// Unit of the representation of the duration, time.Second if zero.
+	Unit time.Duration
+
+	value int64
+}
+
+// Load returns the current value of t.
+func (t *DurationTunable) Load() time.Duration { return time.Duration(atomic.LoadInt64(&t.value)) }
+
+// Store changes the value of t.
+func (t *DurationTunable) Store(d time.Duration) { atomic.StoreInt64(&t.value, int64(d)) }
+
+// String satisfies the Tunable interface.
+func (t *DurationTunable) String() string {
+	return strconv.FormatInt(int64(t.Load()/t.unit()), 10)
+}
+
+// Set satisfies the Tunable interface.
+func (t *DurationTunable) Set(s string) error {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("argument couldn't be parsed into a positive integer")
+	}
+	t.Store(time.Duration(v) * t.unit())
+	return nil
+}
+
+func (t *DurationTunable) unit() time.Duration {
+	if t.Unit == 0 {
+		return time.Second
+	}
+	return t.Unit
+}
+
+// BoolTunable is a Tunable holding a boolean, represented as "yes" or "no".
+type BoolTunable struct {
+	value int32
+}
+
+// Load returns the current value of t.
+func (t *BoolTunable) Load() bool { return atomic.LoadInt32(&t.value) != 0 }
+
+// Store changes the value of t.
+func (t *BoolTunable) Store(v bool) {
+	var i int32
+	if v {
+		i = 1
+	}
+	atomic.StoreInt32(&t.value, i)
+}
+
+// String satisfies the Tunable interface.
+func (t *BoolTunable) String() string {
+	if t.Load() {
+		return "yes"
+	}
+	return "no"
+}
+
+// Set satisfies the Tunable interface.
+func (t *BoolTunable) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "yes":
+		t.Store(true)
+	case "no":
+		t.Store(false)
+	default:
+		return fmt.Errorf("argument must be 'yes' or 'no'")
+	}
+	return nil
+}
+
+// StringTunable is a Tunable holding a string, like an eviction policy.
+type StringTunable struct {
+	// Values is the list of values accepted by Set, any value is accepted if
+	// the list is empty. Values are case insensitive.
+	Values []string
+
+	mutex sync.RWMutex
+	value string
+}
+
+// Load returns the current value of t.
+func (t *StringTunable) Load() string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.value
+}
+
+// Store changes the value of t, bypassing the check against Values.
+func (t *StringTunable) Store(s string) {
+	t.mutex.Lock()
+	t.value = s
+	t.mutex.Unlock()
+}
+
+// String satisfies the Tunable interface.
+func (t *StringTunable) String() string { return t.Load() }
+
+// Set satisfies the Tunable interface.
+func (t *StringTunable) Set(s string) error {
+	if len(t.Values) == 0 {
+		t.Store(s)
+		return nil
+	}
+
+	for _, v := range t.Values {
+		if strings.EqualFold(v, s) {
+			t.Store(v)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("argument must be one of the following: %s", strings.Join(t.Values, ", "))
+}
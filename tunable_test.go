@@ -0,0 +1,102 @@
+package redis_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestTunableRegistry(t *testing.T) {
+	timeout := &redis.DurationTunable{}
+	slowlog := &redis.DurationTunable{Unit: time.Microsecond}
+	maxclients := &redis.IntTunable{Min: 1, Max: 10000}
+	policy := &redis.StringTunable{Values: []string{"noeviction", "allkeys-lru"}}
+	protected := &redis.BoolTunable{}
+
+	maxclients.Store(100)
+	policy.Store("noeviction")
+
+	reg := &redis.TunableRegistry{}
+	reg.Register("timeout", timeout)
+	reg.Register("slowlog-log-slower-than", slowlog)
+	reg.Register("maxclients", maxclients)
+	reg.Register("maxmemory-policy", policy)
+	reg.Register("protected-mode", protected)
+
+	var changes []string
+	reg.Notify(func(name string, value string) { changes = append(changes, name, value) })
+
+	mux := redis.NewServeMux()
+	reg.HandleConfig(mux)
+
+	tests := []struct {
+		scenario string
+		args     []interface{}
+		res      []interface{}
+	}{
+		{
+			scenario: "getting a tunable returns its name and value",
+			args:     []interface{}{"GET", "maxclients"},
+			res:      []interface{}{"maxclients", "100"},
+		},
+		{
+			scenario: "getting tunables with glob patterns returns all matches sorted by name",
+			args:     []interface{}{"GET", "max*", "timeout", "maxclients"},
+			res:      []interface{}{"maxclients", "100", "maxmemory-policy", "noeviction", "timeout", "0"},
+		},
+		{
+			scenario: "setting multiple tunables changes all of them",
+			args:     []interface{}{"SET", "timeout", "30", "slowlog-log-slower-than", "1000", "protected-mode", "yes"},
+			res:      []interface{}{"OK"},
+		},
+		{
+			scenario: "setting an unknown tunable fails",
+			args:     []interface{}{"SET", "whatever", "1"},
+			res:      []interface{}{resp.NewError("ERR Unsupported CONFIG parameter: whatever")},
+		},
+		{
+			scenario: "setting an invalid value fails and restores the tunables already changed",
+			args:     []interface{}{"SET", "maxmemory-policy", "allkeys-lru", "maxclients", "0"},
+			res:      []interface{}{resp.NewError("ERR Invalid argument '0' for CONFIG SET 'maxclients' - argument must be between 1 and 10000 inclusive")},
+		},
+		{
+			scenario: "setting with an odd number of arguments fails",
+			args:     []interface{}{"SET", "timeout", "1", "maxclients"},
+			res:      []interface{}{resp.NewError("ERR wrong number of arguments for 'config|set' command")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			res := &testResponseWriter{}
+			mux.ServeRedis(res, redis.NewRequest("", "CONFIG", redis.List(test.args...)))
+
+			if !reflect.DeepEqual(res.values, test.res) {
+				t.Errorf("bad response:\nexpected: %#v\nfound:    %#v", test.res, res.values)
+			}
+		})
+	}
+
+	if d := timeout.Load(); d != 30*time.Second {
+		t.Error("bad timeout:", d)
+	}
+
+	if d := slowlog.Load(); d != time.Millisecond {
+		t.Error("bad slowlog threshold:", d)
+	}
+
+	if !protected.Load() {
+		t.Error("protected mode was not enabled")
+	}
+
+	if s := policy.Load(); s != "noeviction" {
+		t.Error("the eviction policy was not restored after the failed change:", s)
+	}
+
+	if expected := []string{"timeout", "30", "slowlog-log-slower-than", "1000", "protected-mode", "yes"}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("bad change notifications:\nexpected: %q\nfound:    %q", expected, changes)
+	}
+}
@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tx is a builder of transactions. Commands are queued on the Tx, then sent to
+// a Redis server by Exec, wrapped in MULTI and EXEC on a single connection of
+// the client's transport, so they run atomically.
+//
+// The zero value is an empty transaction ready to use.
+type Tx struct {
+	cmds []Command
+}
+
+// Queue adds a command with cmd and args to the transaction.
+func (tx *Tx) Queue(cmd string, args ...interface{}) {
+	tx.cmds = append(tx.cmds, Command{Cmd: cmd, Args: List(args...)})
+}
+
+// Len returns the number of commands queued on the transaction.
+func (tx *Tx) Len() int {
+	return len(tx.cmds)
+}
+
+// Reset removes the commands queued on the transaction, so it can be reused.
+func (tx *Tx) Reset() {
+	tx.cmds = tx.cmds[:0]
+}
+
+// Exec runs the commands queued on the transaction on the Redis server at the
+// address set on client, and returns the values of their replies in the order
+// the commands were queued. Replies made of multiple values, like the reply
+// to LRANGE, are returned as a Value of type TypeArray.
+//
+// Redis runs all the commands of a transaction even if some of them fail, the
+// method then returns the values of all replies along with the first error,
+// the values of the commands that failed are zero. If the server refused to
+// run the transaction, for example because one of the commands was unknown,
+// no values are returned.
+//
+// The commands remain queued on the transaction after Exec returns.
+func (tx *Tx) Exec(ctx context.Context, client *Client) ([]Value, error) {
+	txArgs := client.MultiQuery(ctx, tx.cmds...)
+	values := make([]Value, 0, len(tx.cmds))
+
+	var err error
+
+	for txArgs.Len() != 0 {
+		args := txArgs.Next()
+
+		v, e := readValue(args)
+		if e == nil {
+			e = args.Close()
+		} else {
+			args.Close()
+		}
+
+		if e != nil && err == nil {
+			err = e
+		}
+
+		values = append(values, v)
+	}
+
+	if e := txArgs.Close(); e != nil {
+		return nil, e
+	}
+
+	return values, err
+}
+
+// readValue reads the values remaining in args and returns them as a Value,
+// arrays when there are more than one.
+func readValue(args Args) (Value, error) {
+	var list []interface{}
+
+	for args.Len() != 0 {
+		var x interface{}
+
+		if !args.Next(&x) {
+			break
+		}
+
+		list = append(list, x)
+	}
+
+	if len(list) == 1 {
+		if v, ok := makeValue(list[0]); ok {
+			return v, nil
+		}
+		return Value{}, fmt.Errorf("redis: unsupported value of type %T in the reply of a transaction", list[0])
+	}
+
+	return Value{Type: TypeArray, Array: list}, nil
+}
@@ -0,0 +1,88 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestTx(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.WriteStream(len(req.Cmds))
+
+		for _, cmd := range req.Cmds {
+			switch cmd.Cmd {
+			case "INCR":
+				res.Write(42)
+			case "GET":
+				res.Write(nil)
+			case "SET":
+				res.Write("OK")
+			case "LRANGE":
+				res.Write([][]byte{[]byte("A"), []byte("B")})
+			default:
+				res.Write(resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value"))
+			}
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+	ctx := context.Background()
+
+	t.Run("the values of the replies are returned in the order of the commands", func(t *testing.T) {
+		tx := &redis.Tx{}
+		tx.Queue("SET", "A", "1")
+		tx.Queue("INCR", "B")
+		tx.Queue("GET", "C")
+		tx.Queue("LRANGE", "D", 0, -1)
+
+		values, err := tx.Exec(ctx, cli)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		types := make([]redis.Type, len(values))
+		for i, v := range values {
+			types[i] = v.Type
+		}
+
+		if expect := []redis.Type{redis.TypeString, redis.TypeInt, redis.TypeNil, redis.TypeArray}; !reflect.DeepEqual(types, expect) {
+			t.Errorf("bad types: %v", types)
+		}
+
+		if values[1].Int != 42 {
+			t.Error("bad integer:", values[1].Int)
+		}
+
+		if len(values[3].Array) != 2 {
+			t.Error("bad array:", values[3].Array)
+		}
+	})
+
+	t.Run("errors of commands are returned with the values of the other commands", func(t *testing.T) {
+		tx := &redis.Tx{}
+		tx.Queue("HGET", "A", "B")
+		tx.Queue("INCR", "B")
+
+		values, err := tx.Exec(ctx, cli)
+		if _, ok := err.(*resp.Error); !ok {
+			t.Error("bad error:", err)
+		}
+
+		if len(values) != 2 || values[1].Int != 42 {
+			t.Error("bad values:", values)
+		}
+
+		// The connection must remain usable after a failed command.
+		if n, err := cli.ExecInt(ctx, "INCR", "B"); err != nil || n != 42 {
+			t.Error(n, err)
+		}
+	})
+}
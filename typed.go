@@ -0,0 +1,245 @@
+package redis
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// This file contains typed helpers for the most common commands, they are thin
+// wrappers around Exec and Query which convert the replies to Go types. Other
+// commands are sent with Exec and Query directly.
+
+// SetOptions configures the behavior of Client.Set.
+type SetOptions struct {
+	// TTL, if not zero, is the expiration of the key. It is rounded to the
+	// millisecond.
+	TTL time.Duration
+
+	// KeepTTL retains the expiration of the key when it's overwritten.
+	KeepTTL bool
+
+	// NX only sets the key if it doesn't exist.
+	NX bool
+
+	// XX only sets the key if it already exists.
+	XX bool
+}
+
+// Get returns the value of key, or ErrNoSuchKey if the key doesn't exist,
+// using GET.
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	return c.queryString(ctx, "GET", key)
+}
+
+// Set sets key to value, using SET. The method returns false when the key was
+// not set because of the NX or XX options.
+func (c *Client) Set(ctx context.Context, key string, value interface{}, opts SetOptions) (bool, error) {
+	args := []interface{}{key, value}
+
+	if opts.TTL != 0 {
+		args = append(args, "PX", opts.TTL.Milliseconds())
+	}
+
+	if opts.KeepTTL {
+		args = append(args, "KEEPTTL")
+	}
+
+	if opts.NX {
+		args = append(args, "NX")
+	}
+
+	if opts.XX {
+		args = append(args, "XX")
+	}
+
+	s, err := c.ExecStatus(ctx, "SET", args...)
+	return s == "OK", err
+}
+
+// MGet returns the values of keys, using MGET. Keys which don't exist are
+// absent from the returned map.
+func (c *Client) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	r := c.Query(ctx, "MGET", stringArgs(keys)...)
+	values := make(map[string]string, len(keys))
+
+	for _, key := range keys {
+		var v *string
+
+		if !r.Next(&v) {
+			break
+		}
+
+		if v != nil {
+			values[key] = *v
+		}
+	}
+
+	return values, r.Close()
+}
+
+// Incr increments the integer value of key by one and returns the new value,
+// using INCR.
+func (c *Client) Incr(ctx context.Context, key string) (int64, error) {
+	return c.ExecInt(ctx, "INCR", key)
+}
+
+// IncrBy increments the integer value of key by n and returns the new value,
+// using INCRBY.
+func (c *Client) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return c.ExecInt(ctx, "INCRBY", key, n)
+}
+
+// Del removes keys and returns the number of keys that were removed, using
+// DEL.
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	return c.ExecInt(ctx, "DEL", stringArgs(keys)...)
+}
+
+// Exists returns the number of keys which exist, using EXISTS. Keys mentioned
+// multiple times are counted multiple times.
+func (c *Client) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return c.ExecInt(ctx, "EXISTS", stringArgs(keys)...)
+}
+
+// Expire sets the expiration of key, rounded to the millisecond, using
+// PEXPIRE. The method returns false if the key doesn't exist.
+func (c *Client) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	n, err := c.ExecInt(ctx, "PEXPIRE", key, ttl.Milliseconds())
+	return n == 1, err
+}
+
+// TTL returns the time to live of key, using PTTL. The duration is negative
+// for keys without expiration, and ErrNoSuchKey is returned if the key doesn't
+// exist.
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.ExecInt(ctx, "PTTL", key)
+
+	switch {
+	case err != nil:
+		return 0, err
+	case ttl == -2:
+		return 0, ErrNoSuchKey
+	default:
+		return time.Duration(ttl) * time.Millisecond, nil
+	}
+}
+
+// HGet returns the value of field in the hash at key, or ErrNoSuchKey if the
+// key or the field doesn't exist, using HGET.
+func (c *Client) HGet(ctx context.Context, key, field string) (string, error) {
+	return c.queryString(ctx, "HGET", key, field)
+}
+
+// HSet sets fields of the hash at key and returns the number of fields that
+// were added, using HSET.
+func (c *Client) HSet(ctx context.Context, key string, fields map[string]interface{}) (int64, error) {
+	names := make([]string, 0, len(fields))
+
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	// Sorting the fields makes the commands deterministic, which helps when
+	// reading logs or samples.
+	sort.Strings(names)
+
+	args := make([]interface{}, 0, 1+2*len(fields))
+	args = append(args, key)
+
+	for _, name := range names {
+		args = append(args, name, fields[name])
+	}
+
+	return c.ExecInt(ctx, "HSET", args...)
+}
+
+// HGetAll returns the fields and values of the hash at key, using HGETALL. The
+// map is empty if the key doesn't exist.
+func (c *Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	r := c.Query(ctx, "HGETALL", key)
+	fields := make(map[string]string)
+
+	for {
+		var field, value string
+
+		if !r.Next(&field) || !r.Next(&value) {
+			break
+		}
+
+		fields[field] = value
+	}
+
+	return fields, r.Close()
+}
+
+// HDel removes fields from the hash at key and returns the number of fields
+// that were removed, using HDEL.
+func (c *Client) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	return c.ExecInt(ctx, "HDEL", append([]interface{}{key}, stringArgs(fields)...)...)
+}
+
+// HIncrBy increments the integer value of field in the hash at key by n and
+// returns the new value, using HINCRBY.
+func (c *Client) HIncrBy(ctx context.Context, key, field string, n int64) (int64, error) {
+	return c.ExecInt(ctx, "HINCRBY", key, field, n)
+}
+
+// LPush inserts values at the head of the list at key and returns the length
+// of the list, using LPUSH.
+func (c *Client) LPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return c.ExecInt(ctx, "LPUSH", append([]interface{}{key}, values...)...)
+}
+
+// RPush inserts values at the tail of the list at key and returns the length
+// of the list, using RPUSH.
+func (c *Client) RPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return c.ExecInt(ctx, "RPUSH", append([]interface{}{key}, values...)...)
+}
+
+// LRange returns the elements of the list at key between the start and stop
+// offsets, using LRANGE. Negative offsets count from the end of the list.
+func (c *Client) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return readStrings(c.Query(ctx, "LRANGE", key, start, stop))
+}
+
+// SAdd adds members to the set at key and returns the number of members that
+// were added, using SADD.
+func (c *Client) SAdd(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return c.ExecInt(ctx, "SADD", append([]interface{}{key}, members...)...)
+}
+
+// SRem removes members from the set at key and returns the number of members
+// that were removed, using SREM.
+func (c *Client) SRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return c.ExecInt(ctx, "SREM", append([]interface{}{key}, members...)...)
+}
+
+// SMembers returns the members of the set at key, using SMEMBERS.
+func (c *Client) SMembers(ctx context.Context, key string) ([]string, error) {
+	return readStrings(c.Query(ctx, "SMEMBERS", key))
+}
+
+// queryString returns the bulk string reply of the command, or ErrNoSuchKey if
+// the reply is nil.
+func (c *Client) queryString(ctx context.Context, cmd string, args ...interface{}) (string, error) {
+	var s *string
+
+	if err := ParseArgs(c.Query(ctx, cmd, args...), &s); err != nil {
+		return "", err
+	}
+
+	if s == nil {
+		return "", ErrNoSuchKey
+	}
+
+	return *s, nil
+}
+
+func stringArgs(list []string) []interface{} {
+	args := make([]interface{}, len(list))
+	for i, s := range list {
+		args[i] = s
+	}
+	return args
+}
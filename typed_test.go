@@ -0,0 +1,236 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestClientTypedCommands(t *testing.T) {
+	var mutex sync.Mutex
+	var command string
+	var reply string
+
+	addr := newRawServer(t, func(c *rawConn, cmd string, args []string) string {
+		if cmd == "CLIENT" {
+			return "" // setup commands of the transport
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		command = strings.Join(append([]string{cmd}, args...), " ")
+		return reply
+	})
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: addr, Transport: tr}
+
+	tests := []struct {
+		scenario string
+		function func(context.Context) (interface{}, error)
+		reply    string
+		command  string
+		expect   interface{}
+		err      error
+	}{
+		{
+			scenario: "Get",
+			function: func(ctx context.Context) (interface{}, error) { return cli.Get(ctx, "A") },
+			reply:    "$5\r\nhello\r\n",
+			command:  "GET A",
+			expect:   "hello",
+		},
+		{
+			scenario: "Get on a missing key",
+			function: func(ctx context.Context) (interface{}, error) { return cli.Get(ctx, "A") },
+			reply:    "$-1\r\n",
+			command:  "GET A",
+			expect:   "",
+			err:      redis.ErrNoSuchKey,
+		},
+		{
+			scenario: "Set",
+			function: func(ctx context.Context) (interface{}, error) {
+				return cli.Set(ctx, "A", 42, redis.SetOptions{TTL: 2 * time.Second, NX: true})
+			},
+			reply:   "+OK\r\n",
+			command: "SET A 42 PX 2000 NX",
+			expect:  true,
+		},
+		{
+			scenario: "Set with an unmet condition",
+			function: func(ctx context.Context) (interface{}, error) {
+				return cli.Set(ctx, "A", "hello", redis.SetOptions{KeepTTL: true, XX: true})
+			},
+			reply:   "$-1\r\n",
+			command: "SET A hello KEEPTTL XX",
+			expect:  false,
+		},
+		{
+			scenario: "MGet",
+			function: func(ctx context.Context) (interface{}, error) { return cli.MGet(ctx, "A", "B", "C") },
+			reply:    "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n3\r\n",
+			command:  "MGET A B C",
+			expect:   map[string]string{"A": "1", "C": "3"},
+		},
+		{
+			scenario: "Incr",
+			function: func(ctx context.Context) (interface{}, error) { return cli.Incr(ctx, "A") },
+			reply:    ":1\r\n",
+			command:  "INCR A",
+			expect:   int64(1),
+		},
+		{
+			scenario: "IncrBy",
+			function: func(ctx context.Context) (interface{}, error) { return cli.IncrBy(ctx, "A", -5) },
+			reply:    ":-4\r\n",
+			command:  "INCRBY A -5",
+			expect:   int64(-4),
+		},
+		{
+			scenario: "Del",
+			function: func(ctx context.Context) (interface{}, error) { return cli.Del(ctx, "A", "B") },
+			reply:    ":2\r\n",
+			command:  "DEL A B",
+			expect:   int64(2),
+		},
+		{
+			scenario: "Exists",
+			function: func(ctx context.Context) (interface{}, error) { return cli.Exists(ctx, "A") },
+			reply:    ":0\r\n",
+			command:  "EXISTS A",
+			expect:   int64(0),
+		},
+		{
+			scenario: "Expire",
+			function: func(ctx context.Context) (interface{}, error) { return cli.Expire(ctx, "A", time.Minute) },
+			reply:    ":1\r\n",
+			command:  "PEXPIRE A 60000",
+			expect:   true,
+		},
+		{
+			scenario: "TTL",
+			function: func(ctx context.Context) (interface{}, error) { return cli.TTL(ctx, "A") },
+			reply:    ":1500\r\n",
+			command:  "PTTL A",
+			expect:   1500 * time.Millisecond,
+		},
+		{
+			scenario: "TTL on a missing key",
+			function: func(ctx context.Context) (interface{}, error) { return cli.TTL(ctx, "A") },
+			reply:    ":-2\r\n",
+			command:  "PTTL A",
+			expect:   time.Duration(0),
+			err:      redis.ErrNoSuchKey,
+		},
+		{
+			scenario: "HGet",
+			function: func(ctx context.Context) (interface{}, error) { return cli.HGet(ctx, "A", "f") },
+			reply:    "$1\r\nv\r\n",
+			command:  "HGET A f",
+			expect:   "v",
+		},
+		{
+			scenario: "HSet",
+			function: func(ctx context.Context) (interface{}, error) {
+				return cli.HSet(ctx, "A", map[string]interface{}{"b": 2, "a": "1"})
+			},
+			reply:   ":2\r\n",
+			command: "HSET A a 1 b 2",
+			expect:  int64(2),
+		},
+		{
+			scenario: "HGetAll",
+			function: func(ctx context.Context) (interface{}, error) { return cli.HGetAll(ctx, "A") },
+			reply:    "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n",
+			command:  "HGETALL A",
+			expect:   map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			scenario: "HDel",
+			function: func(ctx context.Context) (interface{}, error) { return cli.HDel(ctx, "A", "a", "b") },
+			reply:    ":1\r\n",
+			command:  "HDEL A a b",
+			expect:   int64(1),
+		},
+		{
+			scenario: "HIncrBy",
+			function: func(ctx context.Context) (interface{}, error) { return cli.HIncrBy(ctx, "A", "f", 3) },
+			reply:    ":3\r\n",
+			command:  "HINCRBY A f 3",
+			expect:   int64(3),
+		},
+		{
+			scenario: "LPush",
+			function: func(ctx context.Context) (interface{}, error) { return cli.LPush(ctx, "A", "x", "y") },
+			reply:    ":2\r\n",
+			command:  "LPUSH A x y",
+			expect:   int64(2),
+		},
+		{
+			scenario: "RPush",
+			function: func(ctx context.Context) (interface{}, error) { return cli.RPush(ctx, "A", 1) },
+			reply:    ":3\r\n",
+			command:  "RPUSH A 1",
+			expect:   int64(3),
+		},
+		{
+			scenario: "LRange",
+			function: func(ctx context.Context) (interface{}, error) { return cli.LRange(ctx, "A", 0, -1) },
+			reply:    "*2\r\n$1\r\ny\r\n$1\r\nx\r\n",
+			command:  "LRANGE A 0 -1",
+			expect:   []string{"y", "x"},
+		},
+		{
+			scenario: "SAdd",
+			function: func(ctx context.Context) (interface{}, error) { return cli.SAdd(ctx, "A", "x") },
+			reply:    ":1\r\n",
+			command:  "SADD A x",
+			expect:   int64(1),
+		},
+		{
+			scenario: "SRem",
+			function: func(ctx context.Context) (interface{}, error) { return cli.SRem(ctx, "A", "x", "y") },
+			reply:    ":1\r\n",
+			command:  "SREM A x y",
+			expect:   int64(1),
+		},
+		{
+			scenario: "SMembers",
+			function: func(ctx context.Context) (interface{}, error) { return cli.SMembers(ctx, "A") },
+			reply:    "*1\r\n$1\r\nx\r\n",
+			command:  "SMEMBERS A",
+			expect:   []string{"x"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			mutex.Lock()
+			reply = test.reply
+			mutex.Unlock()
+
+			v, err := test.function(context.Background())
+			if err != test.err {
+				t.Error("bad error:", err)
+			}
+
+			if !reflect.DeepEqual(v, test.expect) {
+				t.Errorf("bad value: %#v != %#v", v, test.expect)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if command != test.command {
+				t.Errorf("bad command: %q != %q", command, test.command)
+			}
+		})
+	}
+}
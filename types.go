@@ -0,0 +1,187 @@
+package redis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/segmentio/objconv"
+)
+
+// Type is an enumeration representing the types of values of the redis
+// protocol.
+type Type int
+
+const (
+	// TypeUnknown is returned when the type of a value couldn't be determined,
+	// for example because the argument list was already fully consumed.
+	TypeUnknown Type = iota
+
+	// TypeNil is the type of nil bulk strings and nil arrays.
+	TypeNil
+
+	// TypeString is the type of simple strings (status replies like "OK").
+	TypeString
+
+	// TypeError is the type of error replies.
+	TypeError
+
+	// TypeInt is the type of integer replies.
+	TypeInt
+
+	// TypeBulk is the type of bulk strings.
+	TypeBulk
+
+	// TypeArray is the type of arrays.
+	TypeArray
+)
+
+// String returns a human-readable representation of t.
+func (t Type) String() string {
+	switch t {
+	case TypeNil:
+		return "nil"
+	case TypeString:
+		return "string"
+	case TypeError:
+		return "error"
+	case TypeInt:
+		return "integer"
+	case TypeBulk:
+		return "bulk"
+	case TypeArray:
+		return "array"
+	default:
+		return "unknown"
+	}
+}
+
+// TypedArgs is an extension of the Args interface implemented by argument
+// lists that are able to report the type of their next value without
+// consuming it.
+//
+// All argument lists returned by this package implement TypedArgs, but values
+// wrapping them may not, programs should use the ExpectType function instead
+// of asserting to this interface.
+type TypedArgs interface {
+	Args
+
+	// NextType returns the type of the next value that would be produced by a
+	// call to Next, or TypeUnknown if there are no more values to read.
+	NextType() Type
+}
+
+// NextType returns the type of the next value in args, or TypeUnknown if it
+// could not be determined.
+func NextType(args Args) Type {
+	if a, ok := args.(TypedArgs); ok {
+		return a.NextType()
+	}
+	return TypeUnknown
+}
+
+// ExpectType returns an error if the type of the next value in args isn't one
+// of the given types. The value is not consumed, the program still has to call
+// Next to read it.
+//
+// If the type of the next value cannot be determined, because args doesn't
+// implement TypedArgs, the function returns nil.
+//
+// ExpectType is intended to catch mismatches between commands and the code
+// decoding their responses early during development, for example:
+//
+//	args := client.Query(ctx, "INCR", "counter")
+//	if err := redis.ExpectType(args, redis.TypeInt); err != nil {
+//		...
+//	}
+func ExpectType(args Args, types ...Type) error {
+	a, ok := args.(TypedArgs)
+	if !ok {
+		return nil
+	}
+
+	t := a.NextType()
+
+	for _, expect := range types {
+		if t == expect {
+			return nil
+		}
+	}
+
+	return &TypeMismatchError{Expect: types, Found: t}
+}
+
+// TypeMismatchError is returned when the type of a value doesn't match what the program
+// expected.
+type TypeMismatchError struct {
+	Expect []Type
+	Found  Type
+}
+
+// Error satisfies the error interface.
+func (e *TypeMismatchError) Error() string {
+	expect := make([]string, len(e.Expect))
+
+	for i, t := range e.Expect {
+		expect[i] = t.String()
+	}
+
+	return fmt.Sprintf("redis: expected value of type %s but found %s", strings.Join(expect, " or "), e.Found)
+}
+
+func makeType(t objconv.Type) Type {
+	switch t {
+	case objconv.Nil:
+		return TypeNil
+	case objconv.Bool, objconv.Int, objconv.Uint:
+		return TypeInt
+	case objconv.String:
+		return TypeString
+	case objconv.Bytes, objconv.Float, objconv.Time, objconv.Duration:
+		return TypeBulk
+	case objconv.Error:
+		return TypeError
+	case objconv.Array, objconv.Map:
+		return TypeArray
+	default:
+		return TypeUnknown
+	}
+}
+
+// checkStrictType is used in strict decoding mode to verify that a value of
+// type t can be decoded into dst without being coerced.
+func checkStrictType(t objconv.Type, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil
+	}
+
+	var expect Type
+
+	switch v.Elem().Kind() {
+	case reflect.String:
+		if t != objconv.Int {
+			return nil
+		}
+		expect = TypeBulk
+
+	case reflect.Slice:
+		if v.Elem().Type().Elem().Kind() != reflect.Uint8 || t != objconv.Int {
+			return nil
+		}
+		expect = TypeBulk
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if t != objconv.String && t != objconv.Bytes {
+			return nil
+		}
+		expect = TypeInt
+
+	default:
+		return nil
+	}
+
+	return &TypeMismatchError{Expect: []Type{expect}, Found: makeType(t)}
+}
@@ -0,0 +1,82 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestExpectType(t *testing.T) {
+	tests := []struct {
+		args   redis.Args
+		expect redis.Type
+	}{
+		{args: redis.List(nil), expect: redis.TypeNil},
+		{args: redis.List(42), expect: redis.TypeInt},
+		{args: redis.List("OK"), expect: redis.TypeString},
+		{args: redis.List([]byte("Hello World!")), expect: redis.TypeBulk},
+		{args: redis.MultiArgs(redis.List(), redis.List(1)), expect: redis.TypeInt},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expect.String(), func(t *testing.T) {
+			if typ := redis.NextType(test.args); typ != test.expect {
+				t.Error("bad type:", typ)
+			}
+
+			if err := redis.ExpectType(test.args, test.expect); err != nil {
+				t.Error(err)
+			}
+
+			if err := redis.ExpectType(test.args, redis.TypeArray); err == nil {
+				t.Error("expected a type mismatch error but got <nil>")
+			}
+		})
+	}
+}
+
+func TestStrictTypes(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write(42)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	t.Run("strict", func(t *testing.T) {
+		tr := &redis.Transport{StrictTypes: true}
+		defer tr.CloseIdleConnections()
+
+		cli := &redis.Client{Addr: url, Transport: tr}
+
+		var s string
+		err := redis.ParseArgs(cli.Query(ctx, "INCR", "counter"), &s)
+
+		if _, ok := err.(*redis.TypeMismatchError); !ok {
+			t.Error("expected a type mismatch error but got", err)
+		}
+
+		// The connection must still be usable after a type mismatch.
+		var i int
+		if err := redis.ParseArgs(cli.Query(ctx, "INCR", "counter"), &i); err != nil {
+			t.Error(err)
+		} else if i != 42 {
+			t.Error("bad value:", i)
+		}
+	})
+
+	t.Run("coerce", func(t *testing.T) {
+		tr := &redis.Transport{}
+		defer tr.CloseIdleConnections()
+
+		cli := &redis.Client{Addr: url, Transport: tr}
+
+		var s string
+		if err := redis.ParseArgs(cli.Query(ctx, "INCR", "counter"), &s); err != nil {
+			t.Error(err)
+		} else if s != "42" {
+			t.Error("bad value:", s)
+		}
+	})
+}
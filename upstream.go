@@ -0,0 +1,444 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UpstreamStats carries metrics about the requests that a proxy sends to one
+// of its upstream servers.
+type UpstreamStats struct {
+	// Addr is the address of the upstream server.
+	Addr string
+
+	// Conns is the number of pipelined connections open to the upstream.
+	Conns int
+
+	// Inflight is the number of requests currently sent to the upstream.
+	Inflight int
+
+	// Queued is the number of requests waiting to be sent to the upstream
+	// because MaxUpstreamRequests was reached.
+	Queued int
+}
+
+// upstreamPool multiplexes requests from all clients of a proxy, or from all
+// goroutines using a transport, onto a fixed number of connections to an
+// upstream server. Requests are pipelined, the order in which responses are
+// read matches the order in which requests were written thanks to the quetex
+// of each connection.
+//
+// Writes are coalesced: a request written while other requests are waiting to
+// write on the same connection leaves its commands in the write buffer, the
+// last of the waiting requests flushes them all at once.
+type upstreamPool struct {
+	addr  string
+	size  int
+	dial  func(ctx context.Context, network string, address string) (*Conn, error)
+	stats *poolStats
+	mutex sync.Mutex
+	conns []*pipelinedConn
+	next  int
+
+	// maxConnLifetime, if not zero, is the maximum amount of time that a
+	// connection receives new requests, see Transport.MaxConnLifetime.
+	maxConnLifetime time.Duration
+
+	// refs is the number of requests about to be sent on the pool, the pool
+	// is not idle until they acquired a connection.
+	refs int32
+
+	// dialing is the number of connections being dialed, dialed is closed
+	// when one of them completes.
+	dialing int
+	dialed  chan struct{}
+}
+
+type pipelinedConn struct {
+	conn    *Conn
+	wmutex  sync.Mutex
+	order   quetex
+	broken  int32
+	retired int32
+	writers int32
+	users   int32
+}
+
+// roundTrip sends req on one of the connections of the pool. When it returns a
+// response, release is called with the error of the response once it has been
+// closed, release may be nil.
+func (p *upstreamPool) roundTrip(req *Request, release func(error)) (*Response, error) {
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Commands of requests canceled before being sent are dropped.
+	if err := ctx.Err(); err != nil {
+		req.Close()
+		return nil, err
+	}
+
+	pc, err := p.getConn(ctx)
+	if err != nil {
+		req.Close()
+		return nil, err
+	}
+
+	atomic.AddInt32(&pc.writers, 1)
+	pc.wmutex.Lock()
+	ready := pc.order.acquire()
+	flush := atomic.AddInt32(&pc.writers, -1) == 0
+	err = pc.conn.writeCommands(req.Cmds, flush)
+	req.Close()
+	pc.wmutex.Unlock()
+
+	// Our turn to read must come even if the write failed or the request was
+	// canceled, otherwise the requests queued after this one would never get
+	// to read their response.
+	wait, ctxErr := waitTurn(ctx, ready)
+	if wait != 0 {
+		p.stats.wait(wait)
+	}
+	if ctxErr != nil {
+		go pc.drain(ready, req, err)
+		return nil, ctxErr
+	}
+
+	if err == nil && atomic.LoadInt32(&pc.broken) != 0 {
+		err = errPipelineBroken
+	}
+
+	if err != nil {
+		pc.fail()
+		pc.release()
+		return nil, err
+	}
+
+	// Reads on the connection aren't interrupted when the context is
+	// canceled, the caller stops waiting for the response and it's drained in
+	// the background. If it doesn't arrive within drainTimeout the connection
+	// is closed, and the requests pipelined after this one fail.
+	if ctx.Done() != nil {
+		arrived := make(chan error, 1)
+		go func() { arrived <- pc.conn.waitResponse() }()
+
+		select {
+		case err = <-arrived:
+		case <-ctx.Done():
+			go func() {
+				pc.conn.SetReadDeadline(time.Now().Add(drainTimeout))
+				pc.discard(req, <-arrived)
+			}()
+			return nil, ctx.Err()
+		}
+
+		if err != nil {
+			pc.done(err)
+			return nil, err
+		}
+	}
+
+	switch {
+	case req.IsTransaction():
+		return &Response{
+			TxArgs:  &pipelinedTxArgs{pc: pc, release: release, TxArgs: pc.conn.ReadTxArgs(len(req.Cmds) - 2)},
+			Request: req,
+		}, nil
+
+	case req.IsPipeline():
+		return &Response{
+			TxArgs:  &pipelinedTxArgs{pc: pc, release: release, TxArgs: pc.conn.ReadPipelineArgs(len(req.Cmds))},
+			Request: req,
+		}, nil
+
+	default:
+		return &Response{
+			Args:    &pipelinedArgs{pc: pc, release: release, Args: pc.conn.ReadArgs()},
+			Request: req,
+		}, nil
+	}
+}
+
+func (p *upstreamPool) getConn(ctx context.Context) (*pipelinedConn, error) {
+	for {
+		p.mutex.Lock()
+
+		conns := p.conns[:0]
+		now := time.Now()
+
+		for _, pc := range p.conns {
+			switch {
+			case atomic.LoadInt32(&pc.broken) != 0:
+				pc.conn.Close()
+			case p.tooOld(pc, now):
+				pc.retire()
+			default:
+				conns = append(conns, pc)
+			}
+		}
+
+		p.conns = conns
+
+		// Connections are dialed without holding the mutex, so a slow dial
+		// doesn't block the requests sent on the other connections.
+		if len(p.conns)+p.dialing < p.size {
+			p.dialing++
+			p.mutex.Unlock()
+			return p.dialConn(ctx)
+		}
+
+		if len(p.conns) != 0 {
+			p.next = (p.next + 1) % len(p.conns)
+			pc := p.conns[p.next]
+			atomic.AddInt32(&pc.users, 1)
+			p.mutex.Unlock()
+			return pc, nil
+		}
+
+		// All the connections are being dialed, wait for one of them.
+		if p.dialed == nil {
+			p.dialed = make(chan struct{})
+		}
+		dialed := p.dialed
+		p.mutex.Unlock()
+
+		select {
+		case <-dialed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (p *upstreamPool) dialConn(ctx context.Context) (*pipelinedConn, error) {
+	network, address := splitNetworkAddress(p.addr)
+	conn, err := p.dial(ctx, network, address)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.dialing--
+
+	if p.dialed != nil {
+		close(p.dialed)
+		p.dialed = nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &pipelinedConn{conn: conn, users: 1}
+	p.conns = append(p.conns, pc)
+	return pc, nil
+}
+
+// tooOld returns true if pc was established more than maxConnLifetime ago.
+func (p *upstreamPool) tooOld(pc *pipelinedConn, now time.Time) bool {
+	return p.maxConnLifetime != 0 && now.Sub(pc.conn.created) >= p.maxConnLifetime
+}
+
+func (p *upstreamPool) len() int {
+	p.mutex.Lock()
+	n := len(p.conns)
+	p.mutex.Unlock()
+	return n
+}
+
+// closeIdle closes the connections which have no requests in flight.
+func (p *upstreamPool) closeIdle() {
+	p.mutex.Lock()
+
+	conns := p.conns[:0]
+
+	for _, pc := range p.conns {
+		if atomic.LoadInt32(&pc.users) == 0 {
+			pc.conn.Close()
+		} else {
+			conns = append(conns, pc)
+		}
+	}
+
+	p.conns = conns
+	p.mutex.Unlock()
+}
+
+// idle returns true if no requests are in flight or about to be sent on the
+// pool.
+func (p *upstreamPool) idle() bool {
+	if atomic.LoadInt32(&p.refs) != 0 {
+		return false
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.dialing != 0 {
+		return false
+	}
+
+	for _, pc := range p.conns {
+		if atomic.LoadInt32(&pc.users) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// close closes all the connections of the pool.
+func (p *upstreamPool) close() {
+	p.mutex.Lock()
+
+	for _, pc := range p.conns {
+		pc.conn.Close()
+	}
+
+	p.conns = nil
+	p.mutex.Unlock()
+}
+
+// waitTurn waits for ready to be closed, returning how long it waited, and the
+// error of ctx if it was canceled first.
+func waitTurn(ctx context.Context, ready <-chan struct{}) (time.Duration, error) {
+	select {
+	case <-ready:
+		return 0, nil
+	default:
+	}
+
+	start := time.Now()
+
+	select {
+	case <-ready:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		return time.Since(start), ctx.Err()
+	}
+}
+
+// done must be called when the response of a request has been fully read, it
+// gives the turn to the next request pipelined on the connection.
+func (pc *pipelinedConn) done(err error) {
+	if err != nil && !isStableError(err) {
+		pc.fail()
+	} else {
+		pc.conn.SetReadDeadline(time.Time{})
+	}
+	pc.release()
+}
+
+// fail closes the connection after an error left it in an unknown state, for
+// example when the response of a canceled request didn't arrive in time. The
+// requests pipelined after it can't tell which response is theirs anymore,
+// they fail with errPipelineBroken when they get their turn to read.
+func (pc *pipelinedConn) fail() {
+	atomic.StoreInt32(&pc.broken, 1)
+	pc.conn.Close()
+}
+
+// release gives the turn to the next request pipelined on the connection.
+// Retired connections are closed when their last request releases them.
+func (pc *pipelinedConn) release() {
+	if atomic.AddInt32(&pc.users, -1) == 0 && atomic.LoadInt32(&pc.retired) != 0 {
+		pc.conn.Close()
+	}
+	pc.order.release()
+}
+
+// retire must be called after removing pc from its pool, the connection is
+// closed right away if it has no requests in flight, or by the last of them
+// when it releases the connection.
+func (pc *pipelinedConn) retire() {
+	atomic.StoreInt32(&pc.retired, 1)
+
+	if atomic.LoadInt32(&pc.users) == 0 {
+		pc.conn.Close()
+	}
+}
+
+// drain waits for the turn of a canceled request to read its response, then
+// discards it.
+func (pc *pipelinedConn) drain(ready <-chan struct{}, req *Request, err error) {
+	<-ready
+
+	if err == nil && atomic.LoadInt32(&pc.broken) != 0 {
+		err = errPipelineBroken
+	}
+
+	if err == nil {
+		pc.conn.SetReadDeadline(time.Now().Add(drainTimeout))
+	}
+
+	pc.discard(req, err)
+}
+
+// discard reads and discards the response of req, err is the error which
+// occurred before reading, if any. If the response can't be read, or doesn't
+// arrive within the read deadline of the connection, the connection is closed.
+func (pc *pipelinedConn) discard(req *Request, err error) {
+	if err == nil {
+		switch {
+		case req.IsTransaction():
+			err = pc.conn.ReadTxArgs(len(req.Cmds) - 2).Close()
+		case req.IsPipeline():
+			err = pc.conn.ReadPipelineArgs(len(req.Cmds)).Close()
+		default:
+			err = pc.conn.ReadArgs().Close()
+		}
+	}
+
+	pc.done(err)
+}
+
+// drainTimeout is the maximum amount of time spent draining the response of a
+// canceled request.
+const drainTimeout = 1 * time.Second
+
+// errPipelineBroken is returned to the requests pipelined on a connection
+// after a request whose response couldn't be read.
+var errPipelineBroken = errors.New("redis: the response of a request pipelined before this one was lost, the connection was closed")
+
+type pipelinedArgs struct {
+	Args
+	pc      *pipelinedConn
+	release func(error)
+	once    sync.Once
+}
+
+func (a *pipelinedArgs) Close() error {
+	err := a.Args.Close()
+	a.once.Do(func() {
+		a.pc.done(err)
+		if a.release != nil {
+			a.release(err)
+		}
+	})
+	return err
+}
+
+func (a *pipelinedArgs) NextType() Type {
+	return NextType(a.Args)
+}
+
+type pipelinedTxArgs struct {
+	TxArgs
+	pc      *pipelinedConn
+	release func(error)
+	once    sync.Once
+}
+
+func (a *pipelinedTxArgs) Close() error {
+	err := a.TxArgs.Close()
+	a.once.Do(func() {
+		a.pc.done(err)
+		if a.release != nil {
+			a.release(err)
+		}
+	})
+	return err
+}
@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUpstreamPoolCancel(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &Server{
+		Handler: HandlerFunc(func(res ResponseWriter, req *Request) {
+			var key string
+			req.Cmds[0].ParseArgs(&key)
+			if key == "slow" {
+				time.Sleep(100 * time.Millisecond)
+			}
+			res.Write(key)
+		}),
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	pool := &upstreamPool{addr: l.Addr().String(), size: 1, dial: DialContext}
+	defer pool.close()
+
+	get := func(ctx context.Context, key string) (*Response, error) {
+		return pool.roundTrip(&Request{
+			Cmds:    []Command{{Cmd: "GET", Args: List(key)}},
+			Context: ctx,
+		}, nil)
+	}
+
+	slow, err := get(context.Background(), "slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second request is sent, but canceled while waiting for the response
+	// of the first one, its response must be drained.
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error)
+
+	go func() {
+		_, err := get(ctx, "canceled")
+		errch <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if err := <-errch; err != context.Canceled {
+		t.Error("bad error:", err)
+	}
+
+	// Requests canceled before being sent are dropped.
+	if _, err := get(ctx, "dropped"); err != context.Canceled {
+		t.Error("bad error:", err)
+	}
+
+	resch := make(chan *Response)
+
+	go func() {
+		res, err := get(context.Background(), "next")
+		if err != nil {
+			t.Error(err)
+		}
+		resch <- res
+	}()
+
+	if s, err := String(slow.Args); err != nil {
+		t.Error(err)
+	} else if s != "slow" {
+		t.Errorf("bad response: %q", s)
+	}
+
+	if res := <-resch; res != nil {
+		if s, err := String(res.Args); err != nil {
+			t.Error(err)
+		} else if s != "next" {
+			t.Errorf("bad response: %q", s)
+		}
+	}
+
+	if n := pool.len(); n != 1 {
+		t.Error("the connection must be reused after draining responses:", n)
+	}
+}
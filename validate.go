@@ -0,0 +1,365 @@
+package redis
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/objconv/resp"
+)
+
+// commandsJSON is the specification of the standard redis commands, in the
+// format of the commands.json file of the redis repository: each command is
+// described by its arity, its flags, the grammar of its arguments, and the
+// positions of its keys. Subcommands are listed as separate entries, like
+// "CONFIG GET", which name their container command.
+//
+// It is the single source of the static properties of commands: the classes
+// of commands and the positions of their keys are derived from it.
+//
+//go:embed commands.json
+var commandsJSON []byte
+
+// A Validator is a Handler which checks the requests it receives against the
+// specification of the standard redis commands before passing them to its
+// Handler. Malformed requests are answered with the error a redis server would
+// return and never reach the handler:
+//
+//	server := &redis.Server{
+//		Handler: &redis.Validator{Handler: proxy},
+//	}
+//
+// The validator checks the number of arguments of each command, that the
+// arguments follow the grammar of the command (tokens, integer and float
+// values, optional and repeated arguments), and that the number of keys given
+// to commands like EVAL or FCALL doesn't exceed the number of arguments.
+//
+// The arguments of validated requests are loaded in memory, so the handler can
+// read them again.
+type Validator struct {
+	// Handler is the handler that valid requests are passed to.
+	Handler Handler
+
+	// RejectUnknown configures the validator to reject commands and
+	// subcommands missing from the specification. By default they are passed
+	// to the handler unchecked.
+	RejectUnknown bool
+}
+
+// ServeRedis satisfies the Handler interface.
+func (v *Validator) ServeRedis(res ResponseWriter, req *Request) {
+	cmds := make([]Command, len(req.Cmds))
+	copy(cmds, req.Cmds)
+
+	for i := range cmds {
+		cmd := &cmds[i]
+		cmd.loadByteArgs()
+
+		if err := v.validate(cmd); err != nil {
+			writeErrors(res, req, err)
+			return
+		}
+	}
+
+	r := *req
+	r.Cmds = cmds
+	v.Handler.ServeRedis(res, &r)
+}
+
+// validate checks cmd against its specification, its arguments must have been
+// loaded in memory.
+func (v *Validator) validate(cmd *Command) error {
+	var args []string
+
+	switch a := cmd.Args.(type) {
+	case nil:
+	case *byteArgs:
+		args = make([]string, len(a.args))
+		for i, arg := range a.args {
+			args[i] = string(arg)
+		}
+	default:
+		// The arguments couldn't be loaded, the handler gets the error.
+		return nil
+	}
+
+	spec := lookupCommandSpec(cmd.Cmd)
+	if spec == nil {
+		if v.RejectUnknown {
+			return resp.NewError(fmt.Sprintf("ERR unknown command '%s'", cmd.Cmd))
+		}
+		return nil
+	}
+
+	names := 1
+
+	if spec.subs != nil && len(args) != 0 {
+		sub := spec.subs[strings.ToUpper(args[0])]
+		if sub == nil {
+			if v.RejectUnknown {
+				return resp.NewError(fmt.Sprintf("ERR unknown subcommand '%s'. Try %s HELP.", args[0], strings.ToUpper(cmd.Cmd)))
+			}
+			return nil
+		}
+		spec, args, names = sub, args[1:], 2
+	}
+
+	return spec.validate(args, names)
+}
+
+type commandSpec struct {
+	Arity     int        `json:"arity"`
+	Group     string     `json:"group"`
+	Container string     `json:"container"`
+	Flags     []string   `json:"command_flags"`
+	KeySpecs  []keySpec  `json:"key_specs"`
+	Arguments []argsSpec `json:"arguments"`
+
+	name  string
+	class CommandClass
+	subs  map[string]*commandSpec
+}
+
+type argsSpec struct {
+	Name          string     `json:"name"`
+	Type          string     `json:"type"`
+	Token         string     `json:"token"`
+	Optional      bool       `json:"optional"`
+	Multiple      bool       `json:"multiple"`
+	MultipleToken bool       `json:"multiple_token"`
+	Arguments     []argsSpec `json:"arguments"`
+}
+
+// keySpec describes how to find keys in the arguments of a command: a search
+// for the position of the first key, either fixed or following a keyword, then
+// a range of keys, or a number of keys given by one of the arguments. When both
+// are nil the keys can't be found from the arguments.
+type keySpec struct {
+	Flags []string `json:"flags"`
+
+	BeginSearch struct {
+		Index *struct {
+			Pos int `json:"pos"`
+		} `json:"index"`
+
+		Keyword *struct {
+			Keyword   string `json:"keyword"`
+			StartFrom int    `json:"startfrom"`
+		} `json:"keyword"`
+	} `json:"begin_search"`
+
+	FindKeys struct {
+		Range *struct {
+			LastKey int `json:"lastkey"`
+			Step    int `json:"step"`
+			Limit   int `json:"limit"`
+		} `json:"range"`
+
+		Keynum *struct {
+			KeyNumIdx int `json:"keynumidx"`
+			FirstKey  int `json:"firstkey"`
+			KeyStep   int `json:"keystep"`
+		} `json:"keynum"`
+	} `json:"find_keys"`
+}
+
+var commandSpecs struct {
+	once  sync.Once
+	table map[string]*commandSpec
+}
+
+// lookupCommandSpec returns the specification of the named command, or nil if
+// the command is unknown.
+func lookupCommandSpec(name string) *commandSpec {
+	commandSpecs.once.Do(loadCommandSpecs)
+	spec, ok := commandSpecs.table[name]
+	if !ok {
+		spec = commandSpecs.table[strings.ToUpper(name)]
+	}
+	return spec
+}
+
+func loadCommandSpecs() {
+	var specs map[string]*commandSpec
+
+	if err := json.Unmarshal(commandsJSON, &specs); err != nil {
+		panic("redis: invalid command specification: " + err.Error())
+	}
+
+	table := make(map[string]*commandSpec, len(specs))
+
+	for name, spec := range specs {
+		if len(spec.Container) == 0 {
+			spec.name = strings.ToLower(name)
+			spec.class = classOfFlags(spec.Flags)
+			table[name] = spec
+		}
+	}
+
+	for name, spec := range specs {
+		if len(spec.Container) != 0 {
+			parent := table[spec.Container]
+			if parent.subs == nil {
+				parent.subs = make(map[string]*commandSpec)
+			}
+			sub := strings.TrimPrefix(name, spec.Container+" ")
+			spec.name = parent.name + "|" + strings.ToLower(sub)
+			spec.class = classOfFlags(spec.Flags)
+			parent.subs[sub] = spec
+
+			// The class of containers is the highest class of their
+			// subcommands, since only the command name is known when
+			// requests are classified.
+			if spec.class > parent.class {
+				parent.class = spec.class
+			}
+		}
+	}
+
+	commandSpecs.table = table
+}
+
+// validate checks args against the specification, names is the number of
+// command and subcommand names which precede the arguments.
+func (spec *commandSpec) validate(args []string, names int) error {
+	argc := names + len(args)
+
+	switch {
+	case spec.Arity > 0 && argc != spec.Arity,
+		spec.Arity < 0 && argc < -spec.Arity:
+		return errWrongNumberOfArgs(spec.name)
+	}
+
+	// Commands without a described grammar are only checked for arity.
+	if spec.Arguments == nil {
+		return nil
+	}
+
+	m := argsMatcher{args: args}
+
+	if !m.sequence(spec.Arguments, 0, func(i int) bool { return i == len(args) }) {
+		if m.err != nil {
+			return m.err
+		}
+		return resp.NewError("ERR syntax error")
+	}
+
+	// The grammar can't express the relation between the number of keys and
+	// the keys of commands like EVAL, it's checked separately. Positions of
+	// key specs count the command and subcommand names.
+	for _, ks := range spec.KeySpecs {
+		if ks.BeginSearch.Index == nil || ks.FindKeys.Keynum == nil {
+			continue
+		}
+
+		pos := ks.BeginSearch.Index.Pos
+		keynum := ks.FindKeys.Keynum
+		numkeys, _ := strconv.Atoi(args[pos+keynum.KeyNumIdx-names])
+
+		switch {
+		case numkeys < 0:
+			return resp.NewError("ERR Number of keys can't be negative")
+		case numkeys > 0 && pos+keynum.FirstKey+(numkeys-1)*keynum.KeyStep >= argc:
+			return resp.NewError("ERR Number of keys can't be greater than number of args")
+		}
+	}
+
+	return nil
+}
+
+// argsMatcher matches lists of arguments against the grammar of commands. The
+// grammar is ambiguous (optional arguments may look like tokens, repeated
+// arguments may be followed by arguments of the same type), so the matcher
+// backtracks: each method calls its continuation with the position following
+// the arguments it matched, and tries the next alternative if it returns false.
+type argsMatcher struct {
+	args []string
+
+	// err is the type error found at the furthest position, it is reported
+	// when no alternative matches the arguments.
+	err    error
+	errPos int
+}
+
+func (m *argsMatcher) sequence(specs []argsSpec, i int, next func(int) bool) bool {
+	if len(specs) == 0 {
+		return next(i)
+	}
+	return m.arg(&specs[0], i, func(j int) bool {
+		return m.sequence(specs[1:], j, next)
+	})
+}
+
+func (m *argsMatcher) arg(spec *argsSpec, i int, next func(int) bool) bool {
+	if spec.Multiple {
+		if m.repeat(spec, i, true, next) {
+			return true
+		}
+	} else if m.one(spec, i, true, next) {
+		return true
+	}
+	return spec.Optional && next(i)
+}
+
+func (m *argsMatcher) repeat(spec *argsSpec, i int, first bool, next func(int) bool) bool {
+	return m.one(spec, i, first || spec.MultipleToken, func(j int) bool {
+		return (j > i && m.repeat(spec, j, false, next)) || next(j)
+	})
+}
+
+func (m *argsMatcher) one(spec *argsSpec, i int, token bool, next func(int) bool) bool {
+	if token && len(spec.Token) != 0 {
+		if i == len(m.args) || !strings.EqualFold(m.args[i], spec.Token) {
+			return false
+		}
+		i++
+	}
+
+	switch spec.Type {
+	case "pure-token":
+		return next(i)
+
+	case "block":
+		return m.sequence(spec.Arguments, i, next)
+
+	case "oneof":
+		for j := range spec.Arguments {
+			if m.arg(&spec.Arguments[j], i, next) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if i == len(m.args) {
+		return false
+	}
+
+	if err := checkArgType(spec.Type, m.args[i]); err != nil {
+		if m.err == nil || i >= m.errPos {
+			m.err, m.errPos = err, i
+		}
+		return false
+	}
+
+	return next(i + 1)
+}
+
+func checkArgType(typ string, arg string) error {
+	switch typ {
+	case "integer", "unix-time":
+		if _, err := strconv.ParseInt(arg, 10, 64); err != nil {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+
+	case "double":
+		if f, err := strconv.ParseFloat(arg, 64); err != nil || math.IsNaN(f) {
+			return resp.NewError("ERR value is not a valid float")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestValidator(t *testing.T) {
+	tests := []struct {
+		scenario string
+		validate *redis.Validator
+		cmd      string
+		args     []interface{}
+		err      string
+	}{
+		{
+			scenario: "valid commands reach the handler with their arguments",
+			cmd:      "SET",
+			args:     []interface{}{"key", "value", "nx", "EX", 10},
+		},
+		{
+			scenario: "commands with the wrong number of arguments are rejected",
+			cmd:      "GET",
+			args:     []interface{}{"a", "b"},
+			err:      "ERR wrong number of arguments for 'get' command",
+		},
+		{
+			scenario: "subcommands are checked against their own arity",
+			cmd:      "CONFIG",
+			args:     []interface{}{"GET"},
+			err:      "ERR wrong number of arguments for 'config|get' command",
+		},
+		{
+			scenario: "unexpected tokens are rejected",
+			cmd:      "EXPIRE",
+			args:     []interface{}{"key", 10, "SOON"},
+			err:      "ERR syntax error",
+		},
+		{
+			scenario: "integer arguments are checked",
+			cmd:      "SET",
+			args:     []interface{}{"key", "value", "PX", "soon"},
+			err:      "ERR value is not an integer or out of range",
+		},
+		{
+			scenario: "float arguments are checked",
+			cmd:      "ZADD",
+			args:     []interface{}{"key", "NX", "high", "member"},
+			err:      "ERR value is not a valid float",
+		},
+		{
+			scenario: "repeated blocks must be complete",
+			cmd:      "MSET",
+			args:     []interface{}{"a", 1, "b"},
+			err:      "ERR syntax error",
+		},
+		{
+			scenario: "repeated arguments may be followed by arguments of the same type",
+			cmd:      "BLPOP",
+			args:     []interface{}{"a", "b", "c", 0.5},
+		},
+		{
+			scenario: "the number of keys can't exceed the number of arguments",
+			cmd:      "EVAL",
+			args:     []interface{}{"return 1", 3, "a", "b"},
+			err:      "ERR Number of keys can't be greater than number of args",
+		},
+		{
+			scenario: "keys and arguments of scripts are accepted",
+			cmd:      "FCALL",
+			args:     []interface{}{"f", 1, "a", "b", "c"},
+		},
+		{
+			scenario: "the keys of commands with a number of keys are checked",
+			cmd:      "ZUNIONSTORE",
+			args:     []interface{}{"dst", 3, "a", "b"},
+			err:      "ERR Number of keys can't be greater than number of args",
+		},
+		{
+			scenario: "stream commands are validated",
+			cmd:      "XADD",
+			args:     []interface{}{"stream", "MAXLEN", "~", 1000, "*", "field", "value"},
+		},
+		{
+			scenario: "keys and ids of streams may be repeated",
+			cmd:      "XREAD",
+			args:     []interface{}{"COUNT", 10, "STREAMS", "a", "b", "0-0", "0-0"},
+		},
+		{
+			scenario: "unknown commands are passed to the handler by default",
+			cmd:      "HELLO.WORLD",
+			args:     []interface{}{"a"},
+		},
+		{
+			scenario: "unknown commands are rejected when configured to",
+			validate: &redis.Validator{RejectUnknown: true},
+			cmd:      "HELLO.WORLD",
+			args:     []interface{}{"a"},
+			err:      "ERR unknown command 'HELLO.WORLD'",
+		},
+		{
+			scenario: "unknown subcommands are rejected when configured to",
+			validate: &redis.Validator{RejectUnknown: true},
+			cmd:      "CONFIG",
+			args:     []interface{}{"FROB"},
+			err:      "ERR unknown subcommand 'FROB'. Try CONFIG HELP.",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			validator := test.validate
+			if validator == nil {
+				validator = &redis.Validator{}
+			}
+
+			handled := make(chan int, 1)
+			validator.Handler = redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+				handled <- req.Cmds[0].Args.Len()
+				res.Write("OK")
+			})
+
+			srv, url := newServer(validator)
+			defer srv.Close()
+
+			tr := &redis.Transport{}
+			defer tr.CloseIdleConnections()
+			cli := &redis.Client{Addr: url, Transport: tr}
+
+			err := cli.Exec(ctx, test.cmd, test.args...)
+
+			switch {
+			case len(test.err) == 0 && err != nil:
+				t.Fatal(err)
+			case len(test.err) != 0 && (err == nil || err.Error() != test.err):
+				t.Fatalf("expected %q but got %v", test.err, err)
+			}
+
+			select {
+			case n := <-handled:
+				if len(test.err) != 0 {
+					t.Error("the invalid request reached the handler")
+				} else if n != len(test.args) {
+					t.Errorf("the handler got %d arguments instead of %d", n, len(test.args))
+				}
+			default:
+				if len(test.err) == 0 {
+					t.Error("the request didn't reach the handler")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Value represents a single value of a redis reply, as returned by QueryOne.
+type Value struct {
+	// Type is the type of the value, TypeNil for nil replies.
+	Type Type
+
+	// Int is set on values of type TypeInt.
+	Int int64
+
+	// Bytes is set on values of type TypeString and TypeBulk.
+	Bytes []byte
+
+	// Array is set on values of type TypeArray, nested values are decoded
+	// as string, []byte, int64, nil, or []interface{}.
+	Array []interface{}
+}
+
+// IsNil returns true if v is a nil reply.
+func (v Value) IsNil() bool {
+	return v.Type == TypeNil
+}
+
+// String returns a string representation of v, nil values are represented by
+// an empty string.
+func (v Value) String() string {
+	switch v.Type {
+	case TypeInt:
+		return strconv.FormatInt(v.Int, 10)
+	case TypeString, TypeBulk:
+		return string(v.Bytes)
+	case TypeArray:
+		return fmt.Sprint(v.Array)
+	default:
+		return ""
+	}
+}
+
+// QueryOne issues a request with cmd and args to the Redis server at the
+// address set on the client, and returns the single value of the reply.
+//
+// Unlike Query, the method returns an error if the reply has more or less
+// than one value, instead of silently ignoring the values that the program
+// didn't read. Nil replies are returned as a Value of type TypeNil.
+func (c *Client) QueryOne(ctx context.Context, cmd string, args ...interface{}) (Value, error) {
+	var v Value
+	var a = c.Query(ctx, cmd, args...)
+
+	if n := a.Len(); n != 1 {
+		if err := a.Close(); err != nil {
+			return v, err
+		}
+		return v, fmt.Errorf("redis: expected exactly one value in the reply to %s but found %d", cmd, n)
+	}
+
+	var x interface{}
+	a.Next(&x)
+
+	if err := a.Close(); err != nil {
+		return Value{}, err
+	}
+
+	if v, ok := makeValue(x); ok {
+		return v, nil
+	}
+
+	return v, fmt.Errorf("redis: unsupported value of type %T in the reply to %s", x, cmd)
+}
+
+// makeValue converts x, a value decoded from a reply, to a Value. The function
+// returns false if x has none of the types produced by the decoding of replies.
+func makeValue(x interface{}) (v Value, ok bool) {
+	switch x := x.(type) {
+	case nil:
+		v.Type = TypeNil
+	case int64:
+		v.Type, v.Int = TypeInt, x
+	case int:
+		v.Type, v.Int = TypeInt, int64(x)
+	case []byte:
+		v.Type, v.Bytes = TypeBulk, x
+	case string:
+		v.Type, v.Bytes = TypeString, []byte(x)
+	case []interface{}:
+		v.Type, v.Array = TypeArray, x
+	default:
+		return v, false
+	}
+	return v, true
+}
@@ -0,0 +1,72 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestQueryOne(t *testing.T) {
+	srv, url := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var key string
+		req.Cmds[0].ParseArgs(&key)
+
+		switch key {
+		case "status":
+			res.Write("OK")
+		case "bulk":
+			res.Write([]byte("hello"))
+		case "int":
+			res.Write(42)
+		case "nil":
+			res.Write(nil)
+		case "one":
+			res.Write([]string{"A"})
+		case "many":
+			res.Write([]string{"A", "B"})
+		case "none":
+			res.Write([]string{})
+		case "nested":
+			res.WriteStream(1)
+			res.Write([]string{"A", "B"})
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	cli := &redis.Client{Addr: url, Transport: tr}
+
+	tests := []struct {
+		key   string
+		value redis.Value
+		fail  bool
+	}{
+		{key: "status", value: redis.Value{Type: redis.TypeString, Bytes: []byte("OK")}},
+		{key: "bulk", value: redis.Value{Type: redis.TypeBulk, Bytes: []byte("hello")}},
+		{key: "int", value: redis.Value{Type: redis.TypeInt, Int: 42}},
+		{key: "nil", value: redis.Value{Type: redis.TypeNil}},
+		{key: "one", value: redis.Value{Type: redis.TypeString, Bytes: []byte("A")}},
+		{key: "many", fail: true},
+		{key: "none", fail: true},
+		{key: "nested", value: redis.Value{Type: redis.TypeArray, Array: []interface{}{"A", "B"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			v, err := cli.QueryOne(context.Background(), "GET", test.key)
+
+			switch {
+			case test.fail && err == nil:
+				t.Error("expected an error but got", v)
+			case !test.fail && err != nil:
+				t.Error(err)
+			case !test.fail && !reflect.DeepEqual(v, test.value):
+				t.Errorf("bad value: %#v", v)
+			}
+		})
+	}
+}
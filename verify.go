@@ -0,0 +1,300 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// VerifyOptions configures the comparison of keys done by Verify.
+type VerifyOptions struct {
+	// SampleRate is the fraction of the scanned keys which are compared,
+	// between 0 and 1. If zero, all keys are compared.
+	SampleRate float64
+
+	// Concurrency is the maximum number of keys compared concurrently. If
+	// zero, keys are compared one at a time.
+	Concurrency int
+
+	// KeysPerSecond limits the rate at which keys are compared, to bound the
+	// load put on the servers. Zero means no limit.
+	KeysPerSecond int
+
+	// TTLTolerance is the maximum difference between the expirations of a key
+	// on the two servers for them to be considered equal, which accounts for
+	// the time elapsed between the reads and the writes to each server.
+	TTLTolerance time.Duration
+
+	// ScanCount is the COUNT hint passed to SCAN. If zero, the server's
+	// default is used.
+	ScanCount int
+
+	// MaxMismatches stops the verification once the given number of
+	// mismatches were found. If zero, all keys are verified.
+	MaxMismatches int
+}
+
+// MismatchKind is the reason why a key differs between two servers.
+type MismatchKind string
+
+const (
+	// MismatchMissing is reported when the key doesn't exist on the second
+	// server.
+	MismatchMissing MismatchKind = "missing"
+
+	// MismatchType is reported when the key has different types.
+	MismatchType MismatchKind = "type"
+
+	// MismatchValue is reported when the key has different values.
+	MismatchValue MismatchKind = "value"
+
+	// MismatchTTL is reported when the expirations of the key differ by more
+	// than the tolerance, or only one of them has an expiration.
+	MismatchTTL MismatchKind = "ttl"
+)
+
+// A Mismatch describes a key which differs between two servers.
+type Mismatch struct {
+	Key  string
+	Kind MismatchKind
+}
+
+// VerifyReport reports the work done by a call to Verify.
+type VerifyReport struct {
+	Scanned    int // number of keys scanned on the first server
+	Compared   int // number of keys compared, after sampling
+	Mismatches []Mismatch
+}
+
+// Verify compares the keys matching pattern on the servers of the clients a and
+// b, for example to validate a migration done with the dual writes of a proxy
+// Migration. Keys are scanned on a, so keys only existing on b are not
+// reported.
+//
+// Strings, hashes, lists, sets and sorted sets are compared by value, keys of
+// other types are only compared by type. Keys which are modified while they
+// are compared may be reported as mismatches.
+//
+// The function stops and returns the first error it encounters, along with the
+// report of the keys verified so far.
+func Verify(ctx context.Context, a, b *Client, pattern string, opts VerifyOptions) (VerifyReport, error) {
+	var report VerifyReport
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var errs = make(chan error, 1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if len(pattern) == 0 {
+		pattern = "*"
+	}
+
+	keys := make(chan string)
+	limit := &rateLimiter{rate: opts.KeysPerSecond, start: time.Now()}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	for i := 0; i != concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for key := range keys {
+				limit.wait(ctx, 1)
+
+				kind, ok, err := verifyKey(ctx, a, b, key, opts.TTLTolerance)
+
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					cancel()
+					continue
+				}
+
+				mutex.Lock()
+				report.Compared++
+				if !ok {
+					report.Mismatches = append(report.Mismatches, Mismatch{Key: key, Kind: kind})
+
+					if opts.MaxMismatches > 0 && len(report.Mismatches) >= opts.MaxMismatches {
+						cancel()
+					}
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	err := verifyScan(ctx, a, pattern, opts, keys, func() {
+		mutex.Lock()
+		report.Scanned++
+		mutex.Unlock()
+	})
+	close(keys)
+	wg.Wait()
+
+	select {
+	case e := <-errs:
+		err = e
+	default:
+	}
+
+	if opts.MaxMismatches > 0 && len(report.Mismatches) >= opts.MaxMismatches {
+		// The context was canceled because enough mismatches were found.
+		err = nil
+	}
+
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		return report.Mismatches[i].Key < report.Mismatches[j].Key
+	})
+
+	return report, err
+}
+
+func verifyScan(ctx context.Context, c *Client, pattern string, opts VerifyOptions, keys chan<- string, scanned func()) error {
+	cursor := "0"
+
+	for {
+		var batch []string
+		var args = []interface{}{cursor, "MATCH", pattern}
+
+		if opts.ScanCount > 0 {
+			args = append(args, "COUNT", opts.ScanCount)
+		}
+
+		if err := ParseArgs(c.Query(ctx, "SCAN", args...), &cursor, &batch); err != nil {
+			return err
+		}
+
+		for _, key := range batch {
+			scanned()
+
+			if opts.SampleRate > 0 && opts.SampleRate < 1 && rand.Float64() >= opts.SampleRate {
+				continue
+			}
+
+			select {
+			case keys <- key:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// verifyKey compares key on the servers of a and b, returning whether they are
+// equal, and the kind of mismatch if they are not.
+func verifyKey(ctx context.Context, a, b *Client, key string, tolerance time.Duration) (MismatchKind, bool, error) {
+	typeA, valueA, ttlA, err := readKey(ctx, a, key)
+	if err != nil {
+		return "", false, err
+	}
+
+	if typeA == "none" {
+		// The key was deleted after it was scanned.
+		return "", true, nil
+	}
+
+	typeB, valueB, ttlB, err := readKey(ctx, b, key)
+	if err != nil {
+		return "", false, err
+	}
+
+	switch {
+	case typeB == "none":
+		return MismatchMissing, false, nil
+	case typeA != typeB:
+		return MismatchType, false, nil
+	case !reflect.DeepEqual(valueA, valueB):
+		return MismatchValue, false, nil
+	}
+
+	if (ttlA < 0) != (ttlB < 0) {
+		return MismatchTTL, false, nil
+	}
+
+	if diff := time.Duration(ttlA-ttlB) * time.Millisecond; diff > tolerance || -diff > tolerance {
+		return MismatchTTL, false, nil
+	}
+
+	return "", true, nil
+}
+
+// readKey reads the type, value and expiration in milliseconds of key. Values
+// are returned as lists of strings, sorted for unordered types.
+func readKey(ctx context.Context, c *Client, key string) (typ string, value []string, ttl int64, err error) {
+	if err = ParseArgs(c.Query(ctx, "TYPE", key), &typ); err != nil {
+		return
+	}
+
+	var args Args
+
+	switch typ {
+	case "string":
+		var s string
+		if err = ParseArgs(c.Query(ctx, "GET", key), &s); err != nil {
+			return
+		}
+		value = []string{s}
+	case "hash":
+		args = c.Query(ctx, "HGETALL", key)
+	case "list":
+		args = c.Query(ctx, "LRANGE", key, 0, -1)
+	case "set":
+		args = c.Query(ctx, "SMEMBERS", key)
+	case "zset":
+		args = c.Query(ctx, "ZRANGE", key, 0, -1, "WITHSCORES")
+	}
+
+	if args != nil {
+		var s string
+
+		for args.Next(&s) {
+			value = append(value, s)
+		}
+
+		if err = args.Close(); err != nil {
+			return
+		}
+
+		switch typ {
+		case "hash":
+			value = sortPairs(value)
+		case "set":
+			sort.Strings(value)
+		}
+	}
+
+	err = ParseArgs(c.Query(ctx, "PTTL", key), &ttl)
+	return
+}
+
+// sortPairs sorts a flat list of field/value pairs by field.
+func sortPairs(list []string) []string {
+	pairs := make([][2]string, 0, len(list)/2)
+
+	for i := 0; i+1 < len(list); i += 2 {
+		pairs = append(pairs, [2]string{list[i], list[i+1]})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+
+	sorted := make([]string, 0, len(list))
+	for _, p := range pairs {
+		sorted = append(sorted, p[0], p[1])
+	}
+	return sorted
+}
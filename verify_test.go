@@ -0,0 +1,122 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestVerify(t *testing.T) {
+	type entry struct {
+		value interface{} // string or []string for sets
+		ttl   int64
+	}
+
+	newBackend := func(entries map[string]entry) (*redis.Server, string) {
+		return newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+			var key string
+			cmd := req.Cmds[0]
+			cmd.Args.Next(&key)
+			e, ok := entries[key]
+
+			switch cmd.Cmd {
+			case "TYPE":
+				switch e.value.(type) {
+				case string:
+					res.Write("string")
+				case []string:
+					res.Write("set")
+				default:
+					res.Write("none")
+				}
+			case "PTTL":
+				if ok {
+					res.Write(e.ttl)
+				} else {
+					res.Write(-2)
+				}
+			case "GET":
+				res.Write(e.value)
+			case "SMEMBERS":
+				res.Write(e.value)
+			case "SCAN":
+				keys := make([]string, 0, len(entries))
+				for k := range entries {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				res.WriteStream(2)
+				res.Write("0")
+				res.Write(keys)
+			}
+		}))
+	}
+
+	a, urlA := newBackend(map[string]entry{
+		"equal":      {value: "A", ttl: -1},
+		"value":      {value: "A", ttl: -1},
+		"missing":    {value: "A", ttl: -1},
+		"type":       {value: "A", ttl: -1},
+		"ttl":        {value: "A", ttl: 10000},
+		"ttl-close":  {value: "A", ttl: 10000},
+		"set":        {value: []string{"1", "2"}, ttl: -1},
+		"persistent": {value: "A", ttl: -1},
+	})
+	defer a.Close()
+
+	b, urlB := newBackend(map[string]entry{
+		"equal":      {value: "A", ttl: -1},
+		"value":      {value: "B", ttl: -1},
+		"type":       {value: []string{"A"}, ttl: -1},
+		"ttl":        {value: "A", ttl: 5000},
+		"ttl-close":  {value: "A", ttl: 9990},
+		"set":        {value: []string{"2", "1"}, ttl: -1},
+		"persistent": {value: "A", ttl: 10000},
+	})
+	defer b.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	clientA := &redis.Client{Addr: urlA, Transport: tr}
+	clientB := &redis.Client{Addr: urlB, Transport: tr}
+	ctx := context.Background()
+
+	report, err := redis.Verify(ctx, clientA, clientB, "*", redis.VerifyOptions{
+		Concurrency:  3,
+		TTLTolerance: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := redis.VerifyReport{
+		Scanned:  8,
+		Compared: 8,
+		Mismatches: []redis.Mismatch{
+			{Key: "missing", Kind: redis.MismatchMissing},
+			{Key: "persistent", Kind: redis.MismatchTTL},
+			{Key: "ttl", Kind: redis.MismatchTTL},
+			{Key: "type", Kind: redis.MismatchType},
+			{Key: "value", Kind: redis.MismatchValue},
+		},
+	}
+
+	if !reflect.DeepEqual(report, expect) {
+		t.Errorf("bad report: %+v", report)
+	}
+
+	t.Run("the verification stops after the maximum number of mismatches", func(t *testing.T) {
+		report, err := redis.Verify(ctx, clientA, clientB, "*", redis.VerifyOptions{MaxMismatches: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Mismatches) != 1 {
+			t.Errorf("bad number of mismatches: %+v", report)
+		}
+	})
+}
@@ -0,0 +1,298 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Warmer copies keys from a source server to a destination server, it is
+// typically used to pre-load the cache of a server before routing traffic to
+// it, for example before a failover cutover.
+//
+// Only string and hash keys are copied, keys of other types are skipped. The
+// expiration of keys is preserved.
+type Warmer struct {
+	// Source is the client used to read keys.
+	Source *Client
+
+	// Destination is the client used to write keys.
+	Destination *Client
+
+	// Concurrency is the maximum number of keys copied concurrently. If zero,
+	// keys are copied one at a time.
+	Concurrency int
+
+	// BytesPerSecond limits the rate at which values are copied. Zero means
+	// no limit.
+	BytesPerSecond int
+
+	// ScanCount is the COUNT hint passed to SCAN when expanding patterns of the
+	// manifest. If zero, the server's default is used.
+	ScanCount int
+}
+
+// WarmStats reports the work done by a call to Warmer.Warm.
+type WarmStats struct {
+	Keys    int // number of keys copied
+	Skipped int // number of keys skipped (missing keys or unsupported types)
+	Bytes   int // number of bytes of values copied
+}
+
+// ReadManifest reads a list of keys and key patterns from r, one per line.
+// Empty lines and lines starting with '#' are ignored.
+func ReadManifest(r io.Reader) ([]string, error) {
+	var entries []string
+	var scanner = bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(line) != 0 && line[0] != '#' {
+			entries = append(entries, line)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// Warm copies the keys listed in manifest from the source to the destination.
+// Entries of the manifest containing glob characters ('*', '?' or '[') are
+// expanded with SCAN on the source.
+//
+// The method stops and returns the first error it encounters.
+func (w *Warmer) Warm(ctx context.Context, manifest []string) (WarmStats, error) {
+	var stats WarmStats
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var errs = make(chan error, 1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keys := make(chan string)
+	limit := &rateLimiter{rate: w.BytesPerSecond, start: time.Now()}
+
+	for i, n := 0, w.concurrency(); i != n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for key := range keys {
+				n, ok, err := w.copyKey(ctx, key)
+
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					cancel()
+					continue
+				}
+
+				mutex.Lock()
+				if ok {
+					stats.Keys++
+					stats.Bytes += n
+				} else {
+					stats.Skipped++
+				}
+				mutex.Unlock()
+
+				limit.wait(ctx, n)
+			}
+		}()
+	}
+
+	err := w.expand(ctx, manifest, keys)
+	close(keys)
+	wg.Wait()
+
+	select {
+	case e := <-errs:
+		err = e
+	default:
+	}
+
+	return stats, err
+}
+
+func (w *Warmer) concurrency() int {
+	if w.Concurrency > 0 {
+		return w.Concurrency
+	}
+	return 1
+}
+
+func (w *Warmer) expand(ctx context.Context, manifest []string, keys chan<- string) error {
+	for _, entry := range manifest {
+		if !strings.ContainsAny(entry, "*?[") {
+			select {
+			case keys <- entry:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := w.scan(ctx, entry, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Warmer) scan(ctx context.Context, pattern string, keys chan<- string) error {
+	cursor := "0"
+
+	for {
+		var batch []string
+		var args = []interface{}{cursor, "MATCH", pattern}
+
+		if w.ScanCount > 0 {
+			args = append(args, "COUNT", w.ScanCount)
+		}
+
+		if err := ParseArgs(w.Source.Query(ctx, "SCAN", args...), &cursor, &batch); err != nil {
+			return err
+		}
+
+		for _, key := range batch {
+			select {
+			case keys <- key:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// copyKey copies a single key, returning the number of bytes copied and
+// whether the key was copied at all.
+//
+// The type, expiration and value of the key are read in a single transaction,
+// so they are consistent even when the key is modified concurrently. The value
+// is read with both GET and HGETALL, the command which doesn't match the type
+// of the key fails with a WRONGTYPE error which is ignored.
+func (w *Warmer) copyKey(ctx context.Context, key string) (int, bool, error) {
+	var typ string
+	var ttl int64
+	var value []byte
+	var fields []string
+	var field string
+
+	tx := w.Source.MultiQuery(ctx,
+		Command{Cmd: "TYPE", Args: List(key)},
+		Command{Cmd: "PTTL", Args: List(key)},
+		Command{Cmd: "GET", Args: List(key)},
+		Command{Cmd: "HGETALL", Args: List(key)},
+	)
+
+	if tx.Len() != 4 { // the transaction failed
+		return 0, false, tx.Close()
+	}
+
+	if err := ParseArgs(tx.Next(), &typ); err != nil {
+		tx.Close()
+		return 0, false, err
+	}
+
+	if err := ParseArgs(tx.Next(), &ttl); err != nil {
+		tx.Close()
+		return 0, false, err
+	}
+
+	getErr := ParseArgs(tx.Next(), &value)
+
+	args := tx.Next()
+	for args.Next(&field) {
+		fields = append(fields, field)
+	}
+	hgetallErr := args.Close()
+
+	if err := tx.Close(); err != nil {
+		return 0, false, err
+	}
+
+	switch typ {
+	case "string":
+		if getErr != nil {
+			return 0, false, getErr
+		}
+
+		args := []interface{}{key, value}
+		if ttl > 0 {
+			args = append(args, "PX", ttl)
+		}
+
+		return len(value), true, w.Destination.Exec(ctx, "SET", args...)
+
+	case "hash":
+		if hgetallErr != nil {
+			return 0, false, hgetallErr
+		}
+
+		if len(fields) == 0 {
+			return 0, false, nil
+		}
+
+		var size int
+		values := make([]interface{}, 0, len(fields)+1)
+		values = append(values, key)
+
+		for _, f := range fields {
+			values = append(values, f)
+			size += len(f)
+		}
+
+		if ttl <= 0 {
+			return size, true, w.Destination.Exec(ctx, "HMSET", values...)
+		}
+
+		// The hash and its expiration are set in a transaction so the key
+		// never exists without its expiration on the destination.
+		return size, true, w.Destination.MultiExec(ctx,
+			Command{Cmd: "HMSET", Args: List(values...)},
+			Command{Cmd: "PEXPIRE", Args: List(key, ttl)},
+		)
+
+	default: // "none" for missing keys, or unsupported types
+		return 0, false, nil
+	}
+}
+
+// rateLimiter throttles a stream of bytes to a maximum rate.
+type rateLimiter struct {
+	mutex sync.Mutex
+	rate  int
+	start time.Time
+	total int
+}
+
+func (r *rateLimiter) wait(ctx context.Context, n int) {
+	if r.rate <= 0 {
+		return
+	}
+
+	r.mutex.Lock()
+	r.total += n
+	delay := time.Duration(float64(r.total)/float64(r.rate)*float64(time.Second)) - time.Since(r.start)
+	r.mutex.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/objconv/resp"
+	redis "github.com/segmentio/redis-go"
+)
+
+func TestReadManifest(t *testing.T) {
+	manifest, err := redis.ReadManifest(strings.NewReader("# keys to warm\nuser:1\n\n  session:*  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []string{"user:1", "session:*"}; !reflect.DeepEqual(manifest, expect) {
+		t.Errorf("bad manifest: %q", manifest)
+	}
+}
+
+func TestWarmer(t *testing.T) {
+	values := map[string]string{
+		"user:1":    "Luke",
+		"session:a": "A",
+		"session:b": "B",
+	}
+	hashes := map[string][]string{
+		"profile:1": {"name", "Luke", "planet", "Tatooine"},
+	}
+
+	wrongType := resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	// The source expects the type, expiration and value of keys to be read
+	// in transactions.
+	source, sourceURL := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		if len(req.Cmds) == 1 && req.Cmds[0].Cmd == "SCAN" {
+			res.WriteStream(2)
+			res.Write("0")
+			res.Write([]string{"session:a", "session:b"})
+			return
+		}
+
+		res.WriteStream(len(req.Cmds))
+
+		for _, cmd := range req.Cmds {
+			var key string
+			cmd.ParseArgs(&key)
+
+			value, isString := values[key]
+			hash, isHash := hashes[key]
+
+			switch cmd.Cmd {
+			case "TYPE":
+				if isString {
+					res.Write("string")
+				} else if isHash {
+					res.Write("hash")
+				} else {
+					res.Write("none")
+				}
+			case "PTTL":
+				if isHash {
+					res.Write(60000)
+				} else {
+					res.Write(-1)
+				}
+			case "GET":
+				if isHash {
+					res.Write(wrongType)
+				} else {
+					res.Write(value)
+				}
+			case "HGETALL":
+				if isString {
+					res.Write(wrongType)
+				} else {
+					res.Write(hash)
+				}
+			}
+		}
+	}))
+	defer source.Close()
+
+	var mutex sync.Mutex
+	var writes = map[string]string{}
+
+	destination, destinationURL := newServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		if len(req.Cmds) > 1 {
+			res.WriteStream(len(req.Cmds))
+		}
+
+		for _, cmd := range req.Cmds {
+			var key string
+			var values []string
+			var value string
+
+			cmd.Args.Next(&key)
+
+			for cmd.Args.Next(&value) {
+				values = append(values, value)
+			}
+
+			mutex.Lock()
+			writes[cmd.Cmd+" "+key] = strings.Join(values, " ")
+			mutex.Unlock()
+
+			if cmd.Cmd == "PEXPIRE" {
+				res.Write(1)
+			} else {
+				res.Write("OK")
+			}
+		}
+	}))
+	defer destination.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	warmer := &redis.Warmer{
+		Source:      &redis.Client{Addr: sourceURL, Transport: tr},
+		Destination: &redis.Client{Addr: destinationURL, Transport: tr},
+		Concurrency: 2,
+	}
+
+	stats, err := warmer.Warm(context.Background(), []string{"user:1", "profile:1", "missing", "session:*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := (redis.WarmStats{Keys: 4, Skipped: 1, Bytes: 28}); stats != expect {
+		t.Errorf("bad stats: %+v", stats)
+	}
+
+	expect := map[string]string{
+		"SET user:1":        "Luke",
+		"SET session:a":     "A",
+		"SET session:b":     "B",
+		"HMSET profile:1":   "name Luke planet Tatooine",
+		"PEXPIRE profile:1": "60000",
+	}
+
+	if !reflect.DeepEqual(writes, expect) {
+		t.Errorf("bad writes: %q", writes)
+	}
+}